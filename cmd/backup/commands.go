@@ -0,0 +1,251 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/delivery/cli"
+)
+
+// command is a subcommand of backup-tool
+type command struct {
+	name        string
+	summary     string
+	run         func(args []string)
+	flags       func(flags *flag.FlagSet) // Defines the flags the command parses, which completion offers; nil if it takes none
+	subcommands []string                  // Words the command expects first, e.g. sync for catalog
+}
+
+// commands lists the subcommands in the order help shows them. Running without one backs up.
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "backup", summary: "Back up databases, interactively or from a config file (the default)", run: backupMain, flags: new(backupFlags).define},
+		{name: "restore", summary: "Pick a backup and load it into a database", run: restoreMain, flags: new(restoreFlags).define},
+		{name: "list", summary: "List the backups restore can pick from", run: listMain, flags: new(listFlags).define},
+		{name: "prune", summary: "Remove old backups, keeping those later backups build on", run: pruneMain, flags: new(pruneFlags).define},
+		{name: "validate", summary: "Report every problem in a config file without running it", run: validateMain, flags: new(validateFlags).define},
+		{name: "serve", summary: "Run backups of a config file on request over HTTP and gRPC", run: serveMain, flags: new(serveFlags).define},
+		{name: "clone", summary: "Copy a database from one environment into another", run: cloneMain, flags: new(cloneFlags).define},
+		{name: "pull", summary: "Fetch a backup back from a store", run: pullMain, flags: new(pullFlags).define},
+		{name: "inspect", summary: "Summarize what a backup holds", run: inspectMain},
+		{name: "diff", summary: "Compare the schemas of two dumps", run: diffMain},
+		{name: "chain", summary: "Print the backups a restore of the newest state applies", run: chainMain, flags: new(chainFlags).define, subcommands: []string{"show"}},
+		{name: "catalog", summary: "Learn of the backups in the stores of a config", run: catalogMain, flags: new(catalogFlags).define, subcommands: []string{"sync"}},
+		{name: "fsck", summary: "Cross-check the catalog against the backups on disk and in stores", run: fsckMain, flags: new(fsckFlags).define},
+		{name: "gc", summary: "Remove the chunks no deduplicated backup uses any more", run: gcMain, flags: new(gcFlags).define},
+		{name: "repack", summary: "Move plain backups into the chunk store", run: repackMain, flags: new(repackFlags).define},
+		{name: "rekey", summary: "Move encrypted backups to the KMS key of the config", run: rekeyMain, flags: new(rekeyFlags).define},
+		{name: "drill", summary: "Restore the newest backups into scratch containers and run their checks", run: drillMain, flags: new(drillFlags).define},
+		{name: "status", summary: "Check that the newest backups are fresh enough, for monitoring", run: statusMain, flags: new(statusFlags).define},
+		{name: "stats", summary: "Show how the size and duration of backups developed", run: statsMain, flags: new(statsFlags).define},
+		{name: "report", summary: "Write the backups, drills and removals of a period as audit evidence", run: reportMain, flags: new(reportFlags).define},
+		{name: "operator", summary: "Back up pods described by DatabaseBackup resources", run: operatorMain, flags: new(operatorFlags).define},
+		{name: "generate", summary: "Render deployment files from a config file", run: generateMain, flags: new(generateFlags).define, subcommands: []string{"k8s-cronjob"}},
+		{name: "install", summary: "Run a config file on a schedule with a systemd timer or launchd agent", run: installMain, flags: new(installFlags).define},
+		{name: "version", summary: "Print the version, formats and supported engines of this build", run: versionMain, flags: new(versionFlags).define},
+		{name: "completion", summary: "Print a shell completion script", run: completionMain, subcommands: []string{"bash", "zsh", "fish"}},
+		{name: "help", summary: "List the commands", run: func([]string) { printHelp(os.Stdout) }},
+	}
+}
+
+// findCommand returns the command with the given name
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// printHelp lists the commands, for help and the usage of a run without one
+func printHelp(out io.Writer) {
+	program := filepath.Base(os.Args[0])
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\nCommands:\n", program)
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(out, "\nGlobal flags, in front of the command or among its own:\n")
+	flags := flag.NewFlagSet(program, flag.ContinueOnError)
+	flags.SetOutput(out)
+	globalFlags(flags)
+	flags.PrintDefaults()
+	fmt.Fprintf(out, "\nRun '%s <command> -h' for the flags of a command.\n", program)
+}
+
+// globalFlags defines the flags every command accepts, in front of the command as well as among its own
+func globalFlags(flags *flag.FlagSet) {
+	flags.BoolFunc("no-color", "Print without colors, as when NO_COLOR is set or the output is not a terminal", func(value string) error {
+		noColor, err := strconv.ParseBool(value)
+		if noColor {
+			cli.DisableColor()
+		}
+		return err
+	})
+	flags.Func("lang", "Language of prompts and summaries: "+strings.Join(cli.Locales(), ", ")+" (default from LANG)", func(value string) error {
+		return cli.SetLocale(cli.Locale(value))
+	})
+}
+
+// newFlagSet returns the flag set of a command: the global flags and those define adds
+func newFlagSet(name string, define func(*flag.FlagSet)) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	globalFlags(flags)
+	define(flags)
+	return flags
+}
+
+// parseFlags parses args with the flag set of a command
+func parseFlags(name string, define func(*flag.FlagSet), args []string) *flag.FlagSet {
+	flags := newFlagSet(name, define)
+	flags.Parse(args)
+	return flags
+}
+
+// leadingGlobalFlags returns how many of args are global flags and their values in front of the command
+func leadingGlobalFlags(args []string) int {
+	flags := flag.NewFlagSet("", flag.ContinueOnError)
+	globalFlags(flags)
+	n := 0
+	for n < len(args) && strings.HasPrefix(args[n], "-") {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[n], "-"), "=")
+		f := flags.Lookup(name)
+		if f == nil {
+			break
+		}
+		n++
+		if !hasValue && !isBoolFlag(f) {
+			n = min(n+1, len(args))
+		}
+	}
+	return n
+}
+
+// parseGlobalFlags applies the global flags in front of the command and returns the arguments after them
+func parseGlobalFlags(args []string) []string {
+	n := leadingGlobalFlags(args)
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ExitOnError)
+	globalFlags(flags)
+	flags.Parse(args[:n])
+	return args[n:]
+}
+
+// completeMain handles "backup-tool __complete <words>", which the completion scripts call with the
+// words of the command line after the program, the last being the one completed. It prints the
+// candidates, one per line with a tab before their description; printing none lets the shell complete files.
+func completeMain(words []string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	// Global flags in front of the command are skipped, leaving the word being completed
+	words = words[leadingGlobalFlags(words[:len(words)-1]):]
+	current := words[len(words)-1]
+	candidate := func(word, description string) {
+		if strings.HasPrefix(word, current) {
+			fmt.Printf("%s\t%s\n", word, description)
+		}
+	}
+
+	if len(words) == 1 && !strings.HasPrefix(current, "-") {
+		for _, c := range commands {
+			candidate(c.name, c.summary)
+		}
+		return
+	}
+	c, found := findCommand(words[0])
+	var args []string
+	if found && len(words) > 1 {
+		args = words[1 : len(words)-1]
+	} else {
+		// A run without a command, whose flags come first
+		c, args = commands[0], words[:len(words)-1]
+	}
+	if len(c.subcommands) > 0 && len(args) == 0 {
+		for _, sub := range c.subcommands {
+			candidate(sub, "")
+		}
+		return
+	}
+
+	if c.flags == nil {
+		return
+	}
+	flags := newFlagSet(c.name, c.flags)
+	if !strings.HasPrefix(current, "-") || strings.Contains(current, "=") {
+		return // A value or argument, most often a file
+	}
+	if len(args) > 0 {
+		// The value of a flag that takes one, e.g. a file after -config
+		if f := flags.Lookup(strings.TrimLeft(args[len(args)-1], "-")); f != nil && !isBoolFlag(f) && !strings.Contains(args[len(args)-1], "=") {
+			return
+		}
+	}
+	prefix := "-"
+	if strings.HasPrefix(current, "--") {
+		prefix = "--"
+	}
+	flags.VisitAll(func(f *flag.Flag) {
+		candidate(prefix+f.Name, f.Usage)
+	})
+}
+
+// isBoolFlag reports whether a flag is given without a value, such as -quiet
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// completionMain handles "backup-tool completion <shell>": print a script that completes commands,
+// subcommands and flags by asking the binary itself, and files elsewhere
+func completionMain(args []string) {
+	program := filepath.Base(os.Args[0])
+	function := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(program)
+	outputService := cli.NewOutputService()
+	if len(args) != 1 {
+		outputService.PrintError("usage: backup-tool completion bash|zsh|fish")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "bash":
+		fmt.Printf(`# bash completion for %[1]s; load with: source <(%[1]s completion bash)
+%[2]s() {
+	local IFS=$'\n'
+	COMPREPLY=($("${COMP_WORDS[0]}" __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null | cut -f1))
+}
+complete -o default -F %[2]s %[1]s
+`, program, function)
+	case "zsh":
+		fmt.Printf(`#compdef %[1]s
+# zsh completion for %[1]s; load with: source <(%[1]s completion zsh)
+%[2]s() {
+	local -a candidates
+	candidates=("${(@f)$("${words[1]}" __complete "${(@)words[2,CURRENT]}" 2>/dev/null | sed 's/	/:/')}")
+	if [[ -n "${candidates[1]}" ]]; then
+		_describe '%[1]s' candidates
+	else
+		_files
+	fi
+}
+compdef %[2]s %[1]s
+`, program, function)
+	case "fish":
+		fmt.Printf(`# fish completion for %[1]s; load with: %[1]s completion fish | source
+function __%[2]s_complete
+	set -l tokens (commandline -opc) (commandline -ct)
+	$tokens[1] __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c %[1]s -a '(__%[2]s_complete)'
+`, program, strings.TrimPrefix(function, "_"))
+	default:
+		outputService.PrintError(fmt.Sprintf("unknown shell %q: use bash, zsh or fish", args[0]))
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,1683 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+	_ "time/tzdata" // Timezones in backup names work without a system zone database
+	"unicode/utf8"
+
+	"github.com/wush/db-backup-tool/internal/delivery/api"
+	"github.com/wush/db-backup-tool/internal/delivery/cli"
+	"github.com/wush/db-backup-tool/internal/delivery/configfile"
+	"github.com/wush/db-backup-tool/internal/delivery/generate"
+	"github.com/wush/db-backup-tool/internal/delivery/operator"
+	"github.com/wush/db-backup-tool/internal/delivery/report"
+	"github.com/wush/db-backup-tool/internal/delivery/rpc"
+	"github.com/wush/db-backup-tool/internal/domain"
+	"github.com/wush/db-backup-tool/internal/infrastructure"
+	"github.com/wush/db-backup-tool/internal/usecase"
+)
+
+func main() {
+	domain.Build = buildInfo()
+	if !cli.UseColor() {
+		cli.DisableColor()
+	}
+	// LocaleFromEnv only returns supported languages
+	_ = cli.SetLocale(cli.LocaleFromEnv())
+	infrastructure.RegisterEngines()
+	loadPlugins()
+
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "__complete" {
+		completeMain(args[1:])
+		return
+	}
+	args = parseGlobalFlags(args)
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if c, ok := findCommand(args[0]); ok {
+			c.run(args[1:])
+			return
+		}
+		cli.NewOutputService().PrintError(fmt.Sprintf("unknown command %q; run %s help for the list", args[0], filepath.Base(os.Args[0])))
+		os.Exit(2)
+	}
+	backupMain(args)
+}
+
+// backupFlags are the flags of backup
+type backupFlags struct {
+	configPath, profile, composePath, profileDir, tenant string
+	readEnv, plain, quiet, verbose                       bool
+	only                                                 domain.Tags
+}
+
+func (f *backupFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.configPath, "config", "", "Run non-interactively using the given config file")
+	flags.StringVar(&f.profile, "profile", "", "Replay a saved interactive profile")
+	flags.StringVar(&f.composePath, "compose", "", "Offer the databases in a docker-compose.yml in the interactive selection")
+	flags.BoolVar(&f.readEnv, "read-env", false, "Offer the credentials in the environment of docker-exec containers and kubectl-exec pods")
+	flags.StringVar(&f.profileDir, "profile-dir", "", "Directory holding profiles (default ~/.config/backup-tool/profiles)")
+	flags.BoolVar(&f.plain, "plain", false, "Use plain line prompts instead of the terminal UI")
+	flags.BoolVar(&f.quiet, "quiet", false, "Only print errors, failed backups and the summary, e.g. for cron")
+	flags.BoolVar(&f.verbose, "verbose", false, "Also print every command run, with passwords redacted, and how long each phase took")
+	f.only = make(domain.Tags)
+	flags.Func("only", "Back up only databases tagged key=value, e.g. env=prod (repeatable; all must match)", func(s string) error {
+		tags, err := domain.ParseTags(s)
+		for key, value := range tags {
+			f.only[key] = value
+		}
+		return err
+	})
+	flags.StringVar(&f.tenant, "tenant", "", "Back up only the databases of this tenant of the config")
+}
+
+// backupMain handles "backup-tool [backup]": back up databases interactively, from a profile or
+// from a config file
+func backupMain(args []string) {
+	var f backupFlags
+	flags := newFlagSet("backup", f.define)
+	flags.Usage = func() {
+		printHelp(flags.Output())
+		fmt.Fprintf(flags.Output(), "\nFlags of backup:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	verbosity := cli.VerbosityNormal
+	switch {
+	case f.quiet && f.verbose:
+		cli.NewOutputService().PrintError("-quiet and -verbose cannot be combined")
+		os.Exit(2)
+	case f.quiet:
+		verbosity = cli.VerbosityQuiet
+	case f.verbose:
+		verbosity = cli.VerbosityVerbose
+	}
+
+	configService, outputService := newServices(!f.plain && f.configPath == "" && cli.UseTUI(), verbosity)
+
+	// Dependency Injection (all dependencies resolved here)
+	backupRepo := infrastructure.NewBackupRepository()
+	catalogRepo := infrastructure.NewCatalogRepository()
+	profileRepo, err := configfile.NewProfileStore(f.profileDir)
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	tracer, shutdownTracing, err := infrastructure.NewTracer()
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	// Each run is also logged to a file in the backup directory
+	runLog := cli.NewRunLog(outputService)
+
+	backupUsecase := usecase.NewBackupUsecase(
+		backupRepo,
+		profileRepo,
+		catalogRepo,
+		infrastructure.NewChunkRepository(),
+		infrastructure.NewHeartbeatRepository(),
+		tracer,
+		configService,
+		runLog,
+	)
+
+	if verbosity == cli.VerbosityVerbose {
+		infrastructure.LogCommands(runLog.PrintCommand)
+	}
+
+	onInterrupt(runLog, backupUsecase.Interrupt)
+
+	err = run(backupUsecase, f.configPath, f.profile, f.composePath, f.readEnv, f.only, f.tenant)
+	if err != nil {
+		runLog.PrintError(err.Error())
+	}
+	if closeErr := runLog.Close(); closeErr != nil {
+		outputService.PrintError(fmt.Sprintf("Failed to write run log: %v", closeErr))
+	}
+	if traceErr := shutdownTracing(); traceErr != nil {
+		outputService.PrintError(traceErr.Error())
+	}
+	if errors.Is(err, domain.ErrInterrupted) {
+		os.Exit(130)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// onInterrupt calls stop on SIGINT or SIGTERM, so a running backup stops its commands, cleans
+// up and reports what it finished. The process exits at once when stop returns false, as
+// nothing is running, or on a second signal.
+func onInterrupt(outputService domain.OutputService, stop func() bool) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		if !stop() {
+			os.Exit(130)
+		}
+		outputService.PrintError("Interrupted: stopping the backup and cleaning up, interrupt again to exit at once")
+		<-signals
+		os.Exit(130)
+	}()
+}
+
+func run(backupUsecase *usecase.BackupUsecase, configPath, profile, composePath string, readEnv bool, only domain.Tags, tenant string) error {
+	switch {
+	case configPath != "":
+		config, err := loadConfig(configPath)
+		if err != nil {
+			return err
+		}
+		if tenant != "" {
+			if err := config.ForTenant(tenant); err != nil {
+				return err
+			}
+		}
+		return backupUsecase.ExecuteBackup(config, only)
+	case tenant != "":
+		return fmt.Errorf("-tenant needs -config")
+	case profile != "":
+		return backupUsecase.ExecuteProfileBackup(profile, only)
+	case len(only) > 0:
+		return fmt.Errorf("-only needs -config or -profile")
+	case composePath != "":
+		discovered, err := configfile.DiscoverCompose(composePath)
+		if err != nil {
+			return err
+		}
+		if len(discovered) == 0 {
+			return fmt.Errorf("no database services found in %s", composePath)
+		}
+		return backupUsecase.ExecuteDiscoveredBackup(filepath.Base(composePath), discovered, readEnv)
+	}
+
+	return backupUsecase.ExecuteInteractiveBackup(readEnv)
+}
+
+// restoreFlags are the flags of restore
+type restoreFlags struct {
+	backupDir, atFlag, configPath, verifyKey string
+	plain                                    bool
+	options                                  domain.RestoreOptions
+}
+
+func (f *restoreFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.backupDir, "backup-dir", "backup", "Directory holding the backups and their catalog")
+	flags.BoolVar(&f.plain, "plain", false, "Use plain line prompts instead of the terminal UI")
+	flags.StringVar(&f.atFlag, "at", "", "Restore a differential MongoDB backup chain to this time, e.g. \"2024-05-01 14:00\", by replaying its oplog; other engines have no log replay")
+	flags.StringVar(&f.options.Table, "table", "", "Only restore this table (schema.table for PostgreSQL) or MongoDB collection, replacing it")
+	flags.StringVar(&f.configPath, "config", "", "Config file whose checks for the backup's database run after the restore, whose signing key verifies it and whose stores backups no longer on disk are fetched from")
+	flags.StringVar(&f.verifyKey, "verify-key", "", "Public key the backup must be signed with; overrides the config file's")
+	flags.BoolVar(&f.options.SkipVerify, "insecure-skip-verify", false, "Restore even if the backup's signature is missing or does not match")
+}
+
+// restoreMain handles "backup-tool restore": pick a backup and load it into a database
+func restoreMain(args []string) {
+	var f restoreFlags
+	parseFlags("restore", f.define, args)
+	options := f.options
+
+	configService, outputService := newServices(!f.plain && cli.UseTUI(), cli.VerbosityNormal)
+
+	if f.configPath != "" {
+		config, err := loadConfig(f.configPath)
+		if err != nil {
+			outputService.PrintError(err.Error())
+			os.Exit(2)
+		}
+		config.AssignLabels()
+		options.Configured = config.Databases
+		options.VerifyKey = config.Signing.VerifyKey()
+	}
+	if f.verifyKey != "" {
+		options.VerifyKey = f.verifyKey
+	}
+
+	if f.atFlag != "" {
+		var err error
+		if options.At, err = domain.ParsePointInTime(f.atFlag); err != nil {
+			outputService.PrintError(err.Error())
+			os.Exit(2)
+		}
+	}
+
+	restoreUsecase := usecase.NewRestoreUsecase(
+		infrastructure.NewRestoreRepository(),
+		infrastructure.NewCatalogRepository(),
+		configService,
+		outputService,
+	)
+
+	if err := restoreUsecase.ExecuteInteractiveRestore(f.backupDir, options); err != nil {
+		outputService.PrintError(err.Error())
+		if errors.Is(err, domain.ErrSignatureInvalid) {
+			outputService.PrintError("Verify with -verify-key or the signing block of -config, or restore with -insecure-skip-verify to use the backup anyway")
+		}
+		os.Exit(1)
+	}
+}
+
+// cloneFlags are the flags of clone
+type cloneFlags struct {
+	plain bool
+}
+
+func (f *cloneFlags) define(flags *flag.FlagSet) {
+	flags.BoolVar(&f.plain, "plain", false, "Use plain line prompts instead of the terminal UI")
+}
+
+// cloneMain handles "backup-tool clone": copy a database from one environment into another
+func cloneMain(args []string) {
+	var f cloneFlags
+	parseFlags("clone", f.define, args)
+
+	configService, outputService := newServices(!f.plain && cli.UseTUI(), cli.VerbosityNormal)
+
+	cloneUsecase := usecase.NewCloneUsecase(
+		infrastructure.NewCloneRepository(),
+		configService,
+		outputService,
+	)
+
+	if err := cloneUsecase.ExecuteInteractiveClone(); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// gcFlags are the flags of gc
+type gcFlags struct {
+	backupDir string
+	dryRun    bool
+}
+
+func (f *gcFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.backupDir, "backup-dir", "backup", "Directory holding the backups and their chunk store")
+	flags.BoolVar(&f.dryRun, "dry-run", false, "Only report what would be removed")
+}
+
+// gcMain handles "backup-tool gc": remove the chunks that no deduplicated backup uses any more
+func gcMain(args []string) {
+	var f gcFlags
+	parseFlags("gc", f.define, args)
+
+	outputService := cli.NewOutputService()
+	dedupUsecase := usecase.NewDedupUsecase(
+		infrastructure.NewChunkRepository(),
+		infrastructure.NewCatalogRepository(),
+		outputService,
+	)
+
+	if err := dedupUsecase.Collect(f.backupDir, f.dryRun); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// repackFlags are the flags of repack
+type repackFlags struct {
+	backupDir string
+}
+
+func (f *repackFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.backupDir, "backup-dir", "backup", "Directory holding the backups and their chunk store")
+}
+
+// repackMain handles "backup-tool repack": move plain backups into the chunk store
+func repackMain(args []string) {
+	var f repackFlags
+	parseFlags("repack", f.define, args)
+
+	outputService := cli.NewOutputService()
+	dedupUsecase := usecase.NewDedupUsecase(
+		infrastructure.NewChunkRepository(),
+		infrastructure.NewCatalogRepository(),
+		outputService,
+	)
+
+	if err := dedupUsecase.Repack(f.backupDir); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// chainFlags are the flags of chain show
+type chainFlags struct {
+	backupDir string
+}
+
+func (f *chainFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.backupDir, "backup-dir", "backup", "Directory holding the backups")
+}
+
+// chainMain handles "backup-tool chain show <db>": print the backups a restore of the newest state applies
+func chainMain(args []string) {
+	outputService := cli.NewOutputService()
+	if len(args) == 0 || args[0] != "show" {
+		outputService.PrintError("usage: backup-tool chain show <database> [-backup-dir dir]")
+		os.Exit(2)
+	}
+
+	var f chainFlags
+	flags := parseFlags("chain show", f.define, args[1:])
+	// Allow the flags after the database name as well
+	database := flags.Arg(0)
+	flags.Parse(flags.Args()[min(1, flags.NArg()):])
+	if database == "" || flags.NArg() > 0 {
+		outputService.PrintError("usage: backup-tool chain show <database> [-backup-dir dir]")
+		os.Exit(2)
+	}
+
+	chainUsecase := usecase.NewChainUsecase(infrastructure.NewCatalogRepository(), outputService)
+	if err := chainUsecase.Show(f.backupDir, database); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// listFlags are the flags of list
+type listFlags struct {
+	backupDir, configPath, tenant, dbType string
+	asJSON                                bool
+}
+
+func (f *listFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.backupDir, "backup-dir", "backup", "Directory holding the backups and their catalog")
+	flags.StringVar(&f.configPath, "config", "", "List the backups of every backup directory of this config instead")
+	flags.StringVar(&f.tenant, "tenant", "", "Only list the backups of this tenant of the config")
+	flags.StringVar(&f.dbType, "type", "", "Only list backups of this database type, e.g. postgres")
+	flags.BoolVar(&f.asJSON, "json", false, "Print the backups as JSON")
+}
+
+// listMain handles "backup-tool list": print the backups restore can pick from, newest first
+func listMain(args []string) {
+	var f listFlags
+	flags := parseFlags("list", f.define, args)
+
+	outputService := cli.NewOutputService()
+	if flags.NArg() > 0 || (f.tenant != "" && f.configPath == "") {
+		outputService.PrintError("usage: backup-tool list [-backup-dir dir | -config <file> [-tenant <name>]] [-type <type>] [-json]")
+		os.Exit(2)
+	}
+	if f.dbType != "" {
+		if _, err := domain.LookupEngine(domain.DatabaseType(f.dbType)); err != nil {
+			outputService.PrintError(err.Error())
+			os.Exit(2)
+		}
+	}
+	dirs := []string{f.backupDir}
+	if f.configPath != "" {
+		config, err := configfile.Load(f.configPath)
+		if err == nil && f.tenant != "" {
+			err = config.ForTenant(f.tenant)
+		}
+		if err != nil {
+			outputService.PrintError(err.Error())
+			os.Exit(1)
+		}
+		dirs = config.BackupDirs()
+	}
+
+	entries, err := usecase.NewListUsecase(infrastructure.NewCatalogRepository()).Execute(dirs, domain.DatabaseType(f.dbType))
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	if f.asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(append([]domain.CatalogEntry{}, entries...))
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No backups in %s\n", strings.Join(dirs, ", "))
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Database
+		if entry.Label != "" && entry.Label != entry.Database {
+			name = entry.Label + " (" + entry.Database + ")"
+		}
+		where := entry.Path
+		if entry.StoreKey != "" {
+			where = "in " + strings.Join(entry.Stores, ", ")
+		}
+		fmt.Printf("%s  %-10s %-30s %9s  %s\n", entry.CreatedAt.Local().Format("2006-01-02 15:04"), entry.DatabaseType, name, entry.Size, where)
+	}
+}
+
+// pruneFlags are the flags of prune
+type pruneFlags struct {
+	backupDir, configPath, tenant string
+	keep                          int
+	dryRun                        bool
+}
+
+func (f *pruneFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.backupDir, "backup-dir", "backup", "Directory holding the backups")
+	flags.StringVar(&f.configPath, "config", "", "Prune every backup directory of this config instead, keeping what each tenant sets")
+	flags.StringVar(&f.tenant, "tenant", "", "With -config, only prune the backups of this tenant")
+	flags.IntVar(&f.keep, "keep", 0, "Newest backups kept per database")
+	flags.BoolVar(&f.dryRun, "dry-run", false, "Only report what would be removed")
+}
+
+// pruneMain handles "backup-tool prune": remove old backups, keeping those later backups build on
+func pruneMain(args []string) {
+	var f pruneFlags
+	parseFlags("prune", f.define, args)
+
+	outputService := cli.NewOutputService()
+	if f.keep < 0 || f.keep == 0 && f.configPath == "" {
+		outputService.PrintError("-keep must be at least 1")
+		os.Exit(2)
+	}
+	if f.tenant != "" && f.configPath == "" {
+		outputService.PrintError("-tenant needs -config")
+		os.Exit(2)
+	}
+
+	chainUsecase := usecase.NewChainUsecase(infrastructure.NewCatalogRepository(), outputService)
+	var err error
+	if f.configPath != "" {
+		var config domain.BackupConfig
+		config, err = configfile.Load(f.configPath)
+		if err == nil && f.tenant != "" {
+			err = config.ForTenant(f.tenant)
+		}
+		if err == nil {
+			err = chainUsecase.PruneConfig(config, f.keep, f.dryRun)
+		}
+	} else {
+		err = chainUsecase.Prune(f.backupDir, f.keep, f.dryRun)
+	}
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// inspectMain handles "backup-tool inspect <artifact>": summarize what a backup holds
+func inspectMain(args []string) {
+	outputService := cli.NewOutputService()
+	if len(args) == 0 {
+		outputService.PrintError("usage: backup-tool inspect <artifact>...")
+		os.Exit(2)
+	}
+
+	inspectUsecase := usecase.NewInspectUsecase(infrastructure.NewBackupRepository(), outputService)
+	failed := false
+	for _, path := range args {
+		if err := inspectUsecase.Inspect(path); err != nil {
+			outputService.PrintError(err.Error())
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// diffMain handles "backup-tool diff <a> <b>": compare the schemas of two dumps
+func diffMain(args []string) {
+	outputService := cli.NewOutputService()
+	if len(args) != 2 {
+		outputService.PrintError("usage: backup-tool diff <dump> <dump>")
+		os.Exit(2)
+	}
+
+	inspectUsecase := usecase.NewInspectUsecase(infrastructure.NewBackupRepository(), outputService)
+	if err := inspectUsecase.Diff(args[0], args[1]); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// rekeyFlags are the flags of rekey
+type rekeyFlags struct {
+	configPath, from, tenant string
+	reencrypt, dryRun        bool
+}
+
+func (f *rekeyFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.configPath, "config", "", "Config file whose encryption block names the key to move to")
+	flags.StringVar(&f.from, "from", "", "Only rekey backups wrapped with this key, as provider:key, e.g. aws:alias/old")
+	flags.BoolVar(&f.reencrypt, "reencrypt", false, "Encrypt the backups again under new data keys instead of only re-wrapping them")
+	flags.BoolVar(&f.dryRun, "dry-run", false, "Only report what would be rekeyed")
+	flags.StringVar(&f.tenant, "tenant", "", "Only rekey the backups of this tenant, to its key")
+}
+
+// rekeyMain handles "backup-tool rekey": move the encrypted backups of a config to the KMS
+// key of its encryption block
+func rekeyMain(args []string) {
+	var f rekeyFlags
+	parseFlags("rekey", f.define, args)
+
+	outputService := cli.NewOutputService()
+	if f.configPath == "" {
+		outputService.PrintError("-config is required")
+		os.Exit(2)
+	}
+	config, err := configfile.Load(f.configPath)
+	if err == nil && f.tenant != "" {
+		err = config.ForTenant(f.tenant)
+	}
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	rekeyUsecase := usecase.NewRekeyUsecase(infrastructure.NewBackupRepository(), infrastructure.NewCatalogRepository(), outputService)
+	options := domain.RekeyOptions{From: f.from, Reencrypt: f.reencrypt, DryRun: f.dryRun}
+	if err := rekeyUsecase.Execute(config, options); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// pullFlags are the flags of pull
+type pullFlags struct {
+	configPath, tenant string
+	options            domain.PullOptions
+}
+
+func (f *pullFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.configPath, "config", "", "Config file declaring the stores and the backup directories whose catalog holds the ID")
+	flags.StringVar(&f.options.Store, "store", "", "Only fetch from this store (default the first of the config's stores that has the backup)")
+	flags.StringVar(&f.options.Dir, "dir", ".", "Directory the backup is written to, under its own name")
+	flags.StringVar(&f.tenant, "tenant", "", "Only look for the backup among those of this tenant")
+}
+
+// pullMain handles "backup-tool pull <id>": fetch a backup of the catalog back from a store,
+// checked and decrypted
+func pullMain(args []string) {
+	var f pullFlags
+	flags := parseFlags("pull", f.define, args)
+	options := f.options
+
+	outputService := cli.NewOutputService()
+	if f.configPath == "" || flags.NArg() != 1 {
+		outputService.PrintError("usage: backup-tool pull -config <file> [-store <name>] [-dir <dir>] <id>")
+		os.Exit(2)
+	}
+	config, err := loadConfig(f.configPath)
+	if err == nil && f.tenant != "" {
+		err = config.ForTenant(f.tenant)
+	}
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	pullUsecase := usecase.NewPullUsecase(infrastructure.NewRestoreRepository(), infrastructure.NewCatalogRepository(), outputService)
+	if _, err := pullUsecase.Execute(config, flags.Arg(0), options); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// catalogFlags are the flags of catalog sync
+type catalogFlags struct {
+	configPath, tenant string
+	dryRun             bool
+}
+
+func (f *catalogFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.configPath, "config", "", "Config file declaring the stores and the backup directories whose catalog is synced")
+	flags.BoolVar(&f.dryRun, "dry-run", false, "Only report what would change in the catalog")
+	flags.StringVar(&f.tenant, "tenant", "", "Only sync the backups of this tenant")
+}
+
+// catalogMain handles "backup-tool catalog sync": learn of the backups in the stores of a
+// config, e.g. those a replaced host took
+func catalogMain(args []string) {
+	outputService := cli.NewOutputService()
+	if len(args) == 0 || args[0] != "sync" {
+		outputService.PrintError("usage: backup-tool catalog sync -config <file> [-dry-run]")
+		os.Exit(2)
+	}
+
+	var f catalogFlags
+	flags := parseFlags("catalog sync", f.define, args[1:])
+
+	if f.configPath == "" || flags.NArg() > 0 {
+		outputService.PrintError("usage: backup-tool catalog sync -config <file> [-dry-run]")
+		os.Exit(2)
+	}
+	config, err := loadConfig(f.configPath)
+	if err == nil && f.tenant != "" {
+		err = config.ForTenant(f.tenant)
+	}
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	syncUsecase := usecase.NewSyncUsecase(infrastructure.NewCatalogRepository(), outputService)
+	if err := syncUsecase.Execute(config, f.dryRun); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// fsckFlags are the flags of fsck
+type fsckFlags struct {
+	configPath, tenant string
+	repair, deep       bool
+}
+
+func (f *fsckFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.configPath, "config", "", "Config file declaring the backup directories and stores to check")
+	flags.BoolVar(&f.repair, "repair", false, "Fix what can be fixed: drop stale records, record untracked dumps, remove orphaned files and copy lost backups to their stores again")
+	flags.BoolVar(&f.deep, "deep", false, "Also fetch every copy from its stores and check it against its checksums")
+	flags.StringVar(&f.tenant, "tenant", "", "Only check the backups of this tenant")
+}
+
+// fsckMain handles "backup-tool fsck": cross-check the catalog against the backups on disk and
+// the copies in stores, optionally repairing what it can
+func fsckMain(args []string) {
+	var f fsckFlags
+	flags := parseFlags("fsck", f.define, args)
+
+	outputService := cli.NewOutputService()
+	if f.configPath == "" || flags.NArg() > 0 {
+		outputService.PrintError("usage: backup-tool fsck -config <file> [-repair] [-deep]")
+		os.Exit(2)
+	}
+	config, err := loadConfig(f.configPath)
+	if err == nil && f.tenant != "" {
+		err = config.ForTenant(f.tenant)
+	}
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	fsckUsecase := usecase.NewFsckUsecase(
+		infrastructure.NewBackupRepository(),
+		infrastructure.NewRestoreRepository(),
+		infrastructure.NewCatalogRepository(),
+		infrastructure.NewChunkRepository(),
+		outputService,
+	)
+	if err := fsckUsecase.Execute(config, domain.FsckOptions{Repair: f.repair, Deep: f.deep}); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// Exit codes of status, as Nagios and Sensu read them
+const (
+	statusOK       = 0
+	statusCritical = 2
+	statusUnknown  = 3
+)
+
+// databaseStatus is how status -json prints the status of a database
+type databaseStatus struct {
+	Type       domain.DatabaseType `json:"type"`
+	Label      string              `json:"label"`
+	Tenant     string              `json:"tenant,omitempty"`
+	LastID     string              `json:"last_id,omitempty"`
+	LastBackup *time.Time          `json:"last_backup,omitempty"`
+	AgeSeconds int64               `json:"age_seconds,omitempty"`
+	MaxAge     int64               `json:"max_age_seconds,omitempty"`
+	SizeBytes  *int64              `json:"size_bytes,omitempty"`
+	MinSize    int64               `json:"min_size_bytes,omitempty"`
+	Stale      bool                `json:"stale"`
+	TooSmall   bool                `json:"too_small"`
+	Problem    string              `json:"problem,omitempty"`
+}
+
+// statusFlags are the flags of status
+type statusFlags struct {
+	configPath, tenant string
+	maxAge             time.Duration
+	only               domain.Tags
+	asJSON             bool
+}
+
+func (f *statusFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.configPath, "config", "", "Config file naming the databases, their max_age and min_size")
+	flags.DurationVar(&f.maxAge, "max-age", 0, "Max age for databases without a max_age of their own, instead of the config's, e.g. 26h")
+	f.only = make(domain.Tags)
+	flags.Func("only", "Check only databases tagged key=value (repeatable; all must match)", func(s string) error {
+		tags, err := domain.ParseTags(s)
+		for key, value := range tags {
+			f.only[key] = value
+		}
+		return err
+	})
+	flags.StringVar(&f.tenant, "tenant", "", "Check only the databases of this tenant")
+	flags.BoolVar(&f.asJSON, "json", false, "Print the statuses as JSON")
+}
+
+// statusMain handles "backup-tool status": print the age of the newest backup of each configured
+// database and exit with 2 if any is older than its max age or smaller than its min size, for
+// Nagios or Sensu checks
+func statusMain(args []string) {
+	var f statusFlags
+	flags := parseFlags("status", f.define, args)
+
+	outputService := cli.NewOutputService()
+	if f.configPath == "" || flags.NArg() > 0 {
+		outputService.PrintError("usage: backup-tool status -config <file> [-max-age <duration>]")
+		os.Exit(2)
+	}
+	config, err := configfile.Load(f.configPath)
+	if err == nil && f.tenant != "" {
+		err = config.ForTenant(f.tenant)
+	}
+	if err != nil {
+		fmt.Printf("UNKNOWN: %v\n", err)
+		os.Exit(statusUnknown)
+	}
+	if f.maxAge > 0 {
+		config.MaxAge = f.maxAge
+	}
+	config.Databases = slices.DeleteFunc(config.Databases, func(db domain.DatabaseConfig) bool {
+		return !db.Tags.Matches(f.only)
+	})
+
+	statuses, err := usecase.NewStatusUsecase(infrastructure.NewCatalogRepository()).Execute(config, time.Now())
+	if err != nil {
+		fmt.Printf("UNKNOWN: %v\n", err)
+		os.Exit(statusUnknown)
+	}
+
+	var failed []string
+	for _, status := range statuses {
+		if problem := status.Problem(); problem != "" {
+			failed = append(failed, status.Name()+": "+problem)
+		}
+	}
+
+	if f.asJSON {
+		printed := []databaseStatus{}
+		for _, status := range statuses {
+			db := databaseStatus{
+				Type:     status.Database.Type,
+				Label:    status.Database.Label,
+				Tenant:   status.Database.Tenant,
+				MaxAge:   int64(status.MaxAge.Seconds()),
+				MinSize:  status.MinSize,
+				Stale:    status.Stale(),
+				TooSmall: status.TooSmall(),
+				Problem:  status.Problem(),
+			}
+			if status.Last != nil {
+				db.LastID = status.Last.ID
+				db.LastBackup = &status.Last.CreatedAt
+				db.AgeSeconds = int64(status.Age.Seconds())
+				if status.Size >= 0 {
+					db.SizeBytes = &status.Size
+				}
+			}
+			printed = append(printed, db)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(printed)
+	} else {
+		// The first line is the summary monitoring systems show
+		if len(failed) > 0 {
+			fmt.Printf("CRITICAL: %s\n", strings.Join(failed, "; "))
+		} else {
+			fmt.Printf("OK: %d databases backed up\n", len(statuses))
+		}
+		for _, status := range statuses {
+			last := "no backup"
+			if status.Last != nil {
+				last = "last backup " + domain.FormatAge(status.Age) + " ago"
+				if status.Size >= 0 {
+					last += ", " + domain.FormatBytes(status.Size)
+				}
+			}
+			if status.MaxAge > 0 {
+				last += ", max age " + domain.FormatAge(status.MaxAge)
+			}
+			if status.MinSize > 0 {
+				last += ", min size " + domain.FormatBytes(status.MinSize)
+			}
+			state := "OK"
+			switch {
+			case status.Stale():
+				state = "STALE"
+			case status.TooSmall():
+				state = "SMALL"
+			}
+			fmt.Printf("%-5s %s: %s\n", state, status.Name(), last)
+		}
+	}
+
+	if len(failed) > 0 {
+		os.Exit(statusCritical)
+	}
+	os.Exit(statusOK)
+}
+
+// databaseTrend is how stats -json prints the last backups of a database
+type databaseTrend struct {
+	Type           domain.DatabaseType `json:"type"`
+	Label          string              `json:"label"`
+	Tenant         string              `json:"tenant,omitempty"`
+	MedianDuration float64             `json:"median_duration_seconds,omitempty"`
+	Backups        []backupStats       `json:"backups"`
+}
+
+// backupStats is how stats -json prints one backup, oldest first
+type backupStats struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	SizeBytes int64     `json:"size_bytes,omitempty"`
+	Duration  float64   `json:"duration_seconds,omitempty"`
+	Base      string    `json:"base,omitempty"`
+}
+
+// statsFlags are the flags of stats
+type statsFlags struct {
+	configPath, tenant string
+	last               int
+	only               domain.Tags
+	asJSON             bool
+}
+
+func (f *statsFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.configPath, "config", "", "Config file naming the databases")
+	flags.IntVar(&f.last, "last", 14, "How many of the last backups of each database to show")
+	f.only = make(domain.Tags)
+	flags.Func("only", "Show only databases tagged key=value (repeatable; all must match)", func(s string) error {
+		tags, err := domain.ParseTags(s)
+		for key, value := range tags {
+			f.only[key] = value
+		}
+		return err
+	})
+	flags.StringVar(&f.tenant, "tenant", "", "Show only the databases of this tenant")
+	flags.BoolVar(&f.asJSON, "json", false, "Print the backups as JSON")
+}
+
+// statsMain handles "backup-tool stats": show how the size and duration of the last backups
+// of each configured database developed, as sparklines
+func statsMain(args []string) {
+	var f statsFlags
+	flags := parseFlags("stats", f.define, args)
+
+	outputService := cli.NewOutputService()
+	if f.configPath == "" || flags.NArg() > 0 || f.last < 1 {
+		outputService.PrintError("usage: backup-tool stats -config <file> [-last <n>]")
+		os.Exit(2)
+	}
+	config, err := configfile.Load(f.configPath)
+	if err == nil && f.tenant != "" {
+		err = config.ForTenant(f.tenant)
+	}
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+	config.Databases = slices.DeleteFunc(config.Databases, func(db domain.DatabaseConfig) bool {
+		return !db.Tags.Matches(f.only)
+	})
+
+	trends, err := usecase.NewStatsUsecase(infrastructure.NewCatalogRepository()).Execute(config, f.last)
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	if f.asJSON {
+		printed := []databaseTrend{}
+		for _, trend := range trends {
+			db := databaseTrend{
+				Type:           trend.Database.Type,
+				Label:          trend.Database.Label,
+				Tenant:         trend.Database.Tenant,
+				MedianDuration: trend.MedianDuration().Seconds(),
+				Backups:        []backupStats{},
+			}
+			for _, entry := range trend.Backups {
+				db.Backups = append(db.Backups, backupStats{
+					ID:        entry.ID,
+					CreatedAt: entry.CreatedAt,
+					SizeBytes: entry.SizeBytes,
+					Duration:  entry.Duration.Seconds(),
+					Base:      entry.Base,
+				})
+			}
+			printed = append(printed, db)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(printed)
+		return
+	}
+
+	nameWidth := len("DATABASE")
+	for _, trend := range trends {
+		nameWidth = max(nameWidth, len(trend.Name()))
+	}
+	barWidth := max(f.last, len("DURATION"))
+	fmt.Printf("%-*s  %7s  %-*s  %10s  %-*s  %8s  %8s\n", nameWidth, "DATABASE", "BACKUPS",
+		barWidth, "SIZE", "LAST", barWidth, "DURATION", "LAST", "MEDIAN")
+	for _, trend := range trends {
+		if len(trend.Backups) == 0 {
+			fmt.Printf("%-*s  %7d  no backups\n", nameWidth, trend.Name(), 0)
+			continue
+		}
+		sizes := make([]float64, len(trend.Backups))
+		durations := make([]float64, len(trend.Backups))
+		for i, entry := range trend.Backups {
+			sizes[i] = float64(entry.SizeBytes)
+			durations[i] = entry.Duration.Seconds()
+		}
+		newest := trend.Backups[len(trend.Backups)-1]
+		lastSize, lastDuration, median := "-", "-", "-"
+		if newest.SizeBytes > 0 {
+			lastSize = domain.FormatBytes(newest.SizeBytes)
+		}
+		if newest.Duration > 0 {
+			lastDuration = newest.Duration.Round(time.Second).String()
+		}
+		if d := trend.MedianDuration(); d > 0 {
+			median = d.Round(time.Second).String()
+		}
+		// Sparklines are padded by hand, as %-*s counts their bytes rather than their bars
+		fmt.Printf("%-*s  %7d  %s  %10s  %s  %8s  %8s\n", nameWidth, trend.Name(), len(trend.Backups),
+			padBars(cli.Sparkline(sizes), barWidth), lastSize, padBars(cli.Sparkline(durations), barWidth), lastDuration, median)
+	}
+}
+
+// padBars pads a sparkline with spaces to width bars
+func padBars(sparkline string, width int) string {
+	return sparkline + strings.Repeat(" ", max(0, width-utf8.RuneCountInString(sparkline)))
+}
+
+// drillFlags are the flags of drill
+type drillFlags struct {
+	configPath, tenant string
+	every              time.Duration
+	only               domain.Tags
+}
+
+func (f *drillFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.configPath, "config", "", "Config file naming the databases to drill and their checks")
+	flags.DurationVar(&f.every, "every", 0, "Drill again at this interval, e.g. 24h, until stopped (default once)")
+	f.only = make(domain.Tags)
+	flags.Func("only", "Drill only databases tagged key=value (repeatable; all must match)", func(s string) error {
+		tags, err := domain.ParseTags(s)
+		for key, value := range tags {
+			f.only[key] = value
+		}
+		return err
+	})
+	flags.StringVar(&f.tenant, "tenant", "", "Drill only the databases of this tenant")
+}
+
+// drillMain handles "backup-tool drill": restore the newest backup of each configured database
+// into a scratch container and run its checks, once or at an interval
+func drillMain(args []string) {
+	var f drillFlags
+	parseFlags("drill", f.define, args)
+
+	outputService := cli.NewOutputService()
+	if f.configPath == "" {
+		outputService.PrintError("-config is required")
+		os.Exit(2)
+	}
+
+	drillUsecase := usecase.NewDrillUsecase(
+		infrastructure.NewDrillRepository(),
+		infrastructure.NewRestoreRepository(),
+		infrastructure.NewCatalogRepository(),
+		outputService,
+	)
+	onInterrupt(outputService, drillUsecase.Interrupt)
+
+	for {
+		// The config is read for every drill, so changes apply without a restart
+		config, err := configfile.Load(f.configPath)
+		if err == nil && f.tenant != "" {
+			err = config.ForTenant(f.tenant)
+		}
+		if err == nil {
+			err = drillUsecase.Execute(config, f.only)
+		}
+		if err != nil {
+			outputService.PrintError(err.Error())
+		}
+		switch {
+		case errors.Is(err, domain.ErrInterrupted):
+			os.Exit(130)
+		case f.every <= 0 && err != nil:
+			os.Exit(1)
+		case f.every <= 0:
+			return
+		}
+		time.Sleep(f.every)
+	}
+}
+
+// reportFlags are the flags of report
+type reportFlags struct {
+	backupDir, fromFlag, toFlag, format, output string
+}
+
+func (f *reportFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.backupDir, "backup-dir", "backup", "Directory holding the backups, their catalog and audit log")
+	flags.StringVar(&f.fromFlag, "from", "", "Start of the period, e.g. \"2026-09-01\" (default 30 days before -to)")
+	flags.StringVar(&f.toFlag, "to", "", "End of the period; a date includes that day (default now)")
+	flags.StringVar(&f.format, "format", "csv", "Report format: "+strings.Join(report.Formats, ", "))
+	flags.StringVar(&f.output, "o", "", "Write the report to a file instead of stdout")
+}
+
+// reportMain handles "backup-tool report": write the backups, drills and removals of a period
+// as audit evidence
+func reportMain(args []string) {
+	var f reportFlags
+	parseFlags("report", f.define, args)
+
+	outputService := cli.NewOutputService()
+	if !slices.Contains(report.Formats, f.format) {
+		outputService.PrintError(fmt.Sprintf("-format must be one of %s", strings.Join(report.Formats, ", ")))
+		os.Exit(2)
+	}
+	to := time.Now()
+	if f.toFlag != "" {
+		var err error
+		if to, err = domain.ParsePointInTime(f.toFlag); err != nil {
+			outputService.PrintError(err.Error())
+			os.Exit(2)
+		}
+		if len(f.toFlag) == len(time.DateOnly) {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+	from := to.AddDate(0, 0, -30)
+	if f.fromFlag != "" {
+		var err error
+		if from, err = domain.ParsePointInTime(f.fromFlag); err != nil {
+			outputService.PrintError(err.Error())
+			os.Exit(2)
+		}
+	}
+
+	reportUsecase := usecase.NewReportUsecase(infrastructure.NewCatalogRepository())
+	compliance, err := reportUsecase.Generate(f.backupDir, from, to)
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+	content, err := report.Render(compliance, f.format)
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	if f.output == "" {
+		os.Stdout.Write(content)
+	} else if err := os.WriteFile(f.output, content, 0644); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// validateFlags are the flags of validate
+type validateFlags struct {
+	configPath string
+	asJSON     bool
+}
+
+func (f *validateFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.configPath, "config", "", "Config file to check")
+	flags.BoolVar(&f.asJSON, "json", false, "Print the problems as JSON")
+}
+
+// validateMain handles "backup-tool validate": report every problem in a config file without running it
+func validateMain(args []string) {
+	var f validateFlags
+	parseFlags("validate", f.define, args)
+
+	outputService := cli.NewOutputService()
+	if f.configPath == "" {
+		outputService.PrintError("-config is required")
+		os.Exit(2)
+	}
+
+	problems, err := configfile.CheckFile(f.configPath)
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, problem := range problems {
+		if !problem.Warning {
+			failed = true
+		}
+	}
+
+	if f.asJSON {
+		if problems == nil {
+			problems = []configfile.Problem{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(problems)
+	} else {
+		for _, problem := range problems {
+			severity := "error"
+			if problem.Warning {
+				severity = "warning"
+			}
+			location := f.configPath
+			if problem.Line > 0 {
+				location = fmt.Sprintf("%s:%d", location, problem.Line)
+			}
+			fmt.Printf("%s: %s: %s\n", location, severity, problem.Error())
+		}
+		if !failed {
+			outputService.PrintSuccess(fmt.Sprintf("%s is valid", f.configPath))
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// serveFlags are the flags of serve
+type serveFlags struct {
+	configPath, listen, grpcListen, tokenFile, usersFile string
+}
+
+func (f *serveFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.configPath, "config", "", "Config file to back up; it is read again for every run")
+	flags.StringVar(&f.listen, "listen", ":8080", "Address to listen on")
+	flags.StringVar(&f.grpcListen, "grpc-listen", "", "Address to serve gRPC on, e.g. :9090 (default off)")
+	flags.StringVar(&f.tokenFile, "token-file", "", "File holding the API token (default $BACKUP_API_TOKEN)")
+	flags.StringVar(&f.usersFile, "users-file", "", "File listing API users, their tokens and roles: viewer, operator or admin")
+}
+
+// serveMain handles "backup-tool serve": run backups of a config file on request over an HTTP API,
+// a web dashboard and optionally gRPC
+func serveMain(args []string) {
+	var f serveFlags
+	parseFlags("serve", f.define, args)
+
+	outputService := cli.NewOutputService()
+	if f.configPath == "" {
+		outputService.PrintError("-config is required")
+		os.Exit(2)
+	}
+
+	token := os.Getenv("BACKUP_API_TOKEN")
+	if f.tokenFile != "" {
+		data, err := os.ReadFile(f.tokenFile)
+		if err != nil {
+			outputService.PrintError(fmt.Sprintf("failed to read token file: %v", err))
+			os.Exit(1)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	var users []domain.APIUser
+	if f.usersFile != "" {
+		var err error
+		if users, err = configfile.LoadUsers(f.usersFile); err != nil {
+			outputService.PrintError(err.Error())
+			os.Exit(1)
+		}
+	}
+	// The single token of older setups keeps every permission
+	if token != "" {
+		users = append(users, domain.NewAPIUser("token", domain.RoleAdmin, token))
+	}
+
+	// Fail at startup rather than on the first triggered run
+	if _, err := loadConfig(f.configPath); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	tracer, shutdownTracing, err := infrastructure.NewTracer()
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+	defer shutdownTracing()
+
+	catalogRepo := infrastructure.NewCatalogRepository()
+	daemon := usecase.NewDaemonUsecase(
+		func() (domain.BackupConfig, error) {
+			return loadConfig(f.configPath)
+		},
+		func(output domain.OutputService) *usecase.BackupUsecase {
+			return usecase.NewBackupUsecase(
+				infrastructure.NewBackupRepository(),
+				nil, // Profiles are not used by config file runs
+				catalogRepo,
+				infrastructure.NewChunkRepository(),
+				infrastructure.NewHeartbeatRepository(),
+				tracer,
+				cli.NewConfigService(),
+				output,
+			)
+		},
+		func(output domain.OutputService) *usecase.RestoreUsecase {
+			return usecase.NewRestoreUsecase(
+				infrastructure.NewRestoreRepository(),
+				catalogRepo,
+				cli.NewConfigService(),
+				output,
+			)
+		},
+		catalogRepo,
+		infrastructure.NewChunkRepository(),
+	)
+
+	server, err := api.NewServer(daemon, users)
+	if err != nil {
+		outputService.PrintError(fmt.Sprintf("%v: set BACKUP_API_TOKEN or use -token-file or -users-file", err))
+		os.Exit(2)
+	}
+
+	if f.grpcListen != "" {
+		grpcServer, err := rpc.NewServer(daemon, users)
+		if err != nil {
+			outputService.PrintError(err.Error())
+			os.Exit(2)
+		}
+		listener, err := net.Listen("tcp", f.grpcListen)
+		if err != nil {
+			outputService.PrintError(err.Error())
+			os.Exit(1)
+		}
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				outputService.PrintError(err.Error())
+				os.Exit(1)
+			}
+		}()
+		outputService.PrintSuccess(fmt.Sprintf("Serving gRPC on %s", f.grpcListen))
+	}
+
+	// Expectations are checked whether or not alerts are configured yet, as the config is read
+	// again for every check
+	alerts := usecase.NewAlertUsecase(catalogRepo, infrastructure.NewHeartbeatRepository(), outputService)
+	go alerts.Run(context.Background(), func() (domain.BackupConfig, error) {
+		return configfile.Load(f.configPath)
+	})
+
+	outputService.PrintSuccess(fmt.Sprintf("Serving the backup API and dashboard on %s", f.listen))
+	httpServer := &http.Server{
+		Addr:              f.listen,
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := httpServer.ListenAndServe(); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// operatorFlags are the flags of operator
+type operatorFlags struct {
+	namespace, backupDir, kubeconfig, kubeContext string
+}
+
+func (f *operatorFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.namespace, "namespace", "", "Namespace to watch (default all namespaces)")
+	flags.StringVar(&f.backupDir, "backup-dir", "/backups", "Directory the backups are written under")
+	flags.StringVar(&f.kubeconfig, "kubeconfig", "", "Kubeconfig file (default in-cluster config, KUBECONFIG or ~/.kube/config)")
+	flags.StringVar(&f.kubeContext, "context", "", "Kubeconfig context (default current)")
+}
+
+// operatorMain handles "backup-tool operator": back up pods described by DatabaseBackup resources in a cluster
+func operatorMain(args []string) {
+	var f operatorFlags
+	parseFlags("operator", f.define, args)
+
+	outputService := cli.NewOutputService()
+	tracer, shutdownTracing, err := infrastructure.NewTracer()
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+	defer shutdownTracing()
+
+	catalogRepo := infrastructure.NewCatalogRepository()
+	controller, err := operator.NewController(f.kubeconfig, f.kubeContext, f.namespace, f.backupDir,
+		func(output domain.OutputService) *usecase.BackupUsecase {
+			return usecase.NewBackupUsecase(
+				infrastructure.NewBackupRepository(),
+				nil, // Profiles are not used by the operator
+				catalogRepo,
+				infrastructure.NewChunkRepository(),
+				infrastructure.NewHeartbeatRepository(),
+				tracer,
+				cli.NewConfigService(),
+				output,
+			)
+		},
+		outputService,
+	)
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	watched := "all namespaces"
+	if f.namespace != "" {
+		watched = "namespace " + f.namespace
+	}
+	outputService.PrintSuccess(fmt.Sprintf("Watching DatabaseBackup resources in %s", watched))
+	if err := controller.Run(ctx); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// generateFlags are the flags of generate k8s-cronjob
+type generateFlags struct {
+	configPath, output string
+	options            generate.CronJobOptions
+}
+
+func (f *generateFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.configPath, "config", "", "Config file to run in the cluster (method kubectl-exec)")
+	flags.StringVar(&f.options.Name, "name", "backup-tool", "Name of the CronJob and the objects around it")
+	flags.StringVar(&f.options.Namespace, "namespace", "", "Namespace of the CronJob (default the databases' namespace)")
+	flags.StringVar(&f.options.Schedule, "schedule", "0 3 * * *", "Cron schedule")
+	flags.StringVar(&f.options.TimeZone, "timezone", "", "IANA time zone for the schedule (default the cluster's)")
+	flags.StringVar(&f.options.Image, "image", "backup-tool:latest", "Image with the backup-tool binary")
+	flags.StringVar(&f.options.Secret, "secret", "", "Secret holding the passwords (default <name>-credentials)")
+	flags.BoolVar(&f.options.WithSecret, "with-secret", false, "Also render the Secret with the passwords from the config")
+	flags.StringVar(&f.options.Claim, "pvc", "", "PersistentVolumeClaim for the backups (default <name>-backups)")
+	flags.StringVar(&f.options.Storage, "storage", "20Gi", "Size of the PersistentVolumeClaim")
+	flags.StringVar(&f.output, "o", "", "Write the manifests to a file instead of stdout")
+}
+
+// generateMain handles "backup-tool generate <kind>": render deployment files from a config file
+func generateMain(args []string) {
+	outputService := cli.NewOutputService()
+	if len(args) == 0 || args[0] != "k8s-cronjob" {
+		outputService.PrintError("usage: backup-tool generate k8s-cronjob -config <file> [flags]")
+		os.Exit(2)
+	}
+
+	var f generateFlags
+	parseFlags("generate k8s-cronjob", f.define, args[1:])
+	options := f.options
+
+	if f.configPath == "" {
+		outputService.PrintError("-config is required")
+		os.Exit(2)
+	}
+	config, err := configfile.Load(f.configPath)
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	manifests, notes, err := generate.CronJob(config, options)
+	if err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+
+	if f.output == "" {
+		os.Stdout.Write(manifests)
+	} else if err := os.WriteFile(f.output, manifests, 0600); err != nil {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+	for _, note := range notes {
+		fmt.Fprintf(os.Stderr, "Note: %s\n", note)
+	}
+}
+
+// installFlags are the flags of install
+type installFlags struct {
+	useSystemd, useLaunchd, install bool
+	configPath, outputDir           string
+	options                         generate.ServiceOptions
+}
+
+func (f *installFlags) define(flags *flag.FlagSet) {
+	flags.BoolVar(&f.useSystemd, "systemd", false, "Render a systemd service and timer (default on Linux)")
+	flags.BoolVar(&f.useLaunchd, "launchd", false, "Render a launchd agent (default on macOS)")
+	flags.StringVar(&f.configPath, "config", "", "Config file to run on the schedule")
+	flags.StringVar(&f.options.Name, "name", "backup-tool", "Name of the units, or label of the agent")
+	flags.StringVar(&f.options.Schedule, "schedule", "0 3 * * *", "Cron schedule")
+	flags.StringVar(&f.options.TimeZone, "timezone", "", "IANA time zone for the schedule (systemd; default the host's)")
+	flags.StringVar(&f.options.Binary, "binary", "", "backup-tool binary the service runs (default this one)")
+	flags.StringVar(&f.options.User, "user", "", "User the system service runs as (default root)")
+	flags.BoolVar(&f.options.UserUnit, "user-unit", false, "Render user units for systemctl --user instead of system units")
+	flags.StringVar(&f.options.EnvironmentFile, "env-file", "", "File of KEY=VALUE lines with the variables the config reads with env")
+	flags.Func("credential", "systemd credential NAME=path the config reads with credential (repeatable)", func(s string) error {
+		f.options.Credentials = append(f.options.Credentials, s)
+		return nil
+	})
+	flags.StringVar(&f.outputDir, "o", "", "Write the files to a directory instead of stdout")
+	flags.BoolVar(&f.install, "install", false, "Install the files and enable the schedule")
+}
+
+// installMain handles "backup-tool install": run a config file on a schedule with a systemd timer
+// or a launchd agent
+func installMain(args []string) {
+	outputService := cli.NewOutputService()
+	var f installFlags
+	parseFlags("install", f.define, args)
+	options := f.options
+
+	fail := func(err error) {
+		outputService.PrintError(err.Error())
+		os.Exit(1)
+	}
+	if f.configPath == "" {
+		outputService.PrintError("-config is required")
+		os.Exit(2)
+	}
+	if f.useSystemd && f.useLaunchd {
+		outputService.PrintError("-systemd and -launchd cannot be combined")
+		os.Exit(2)
+	}
+	launchd := f.useLaunchd || (!f.useSystemd && runtime.GOOS == "darwin")
+
+	var err error
+	if options.Config, err = filepath.Abs(f.configPath); err != nil {
+		fail(err)
+	}
+	if options.EnvironmentFile != "" {
+		if options.EnvironmentFile, err = filepath.Abs(options.EnvironmentFile); err != nil {
+			fail(err)
+		}
+	}
+	if options.Binary == "" {
+		if options.Binary, err = os.Executable(); err != nil {
+			fail(err)
+		}
+	}
+	if err := checkServiceConfig(options); err != nil {
+		fail(err)
+	}
+
+	var files []generate.UnitFile
+	var notes []string
+	unitDir := "/etc/systemd/system"
+	mode := os.FileMode(0644)
+	if launchd {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			fail(err)
+		}
+		unitDir = filepath.Join(home, "Library", "LaunchAgents")
+		options.LogFile = filepath.Join(home, "Library", "Logs", options.Name+".log")
+		file, fileNotes, err := generate.Launchd(options)
+		if err != nil {
+			fail(err)
+		}
+		files, notes = []generate.UnitFile{file}, fileNotes
+		if options.EnvironmentFile != "" {
+			mode = 0600 // The property list holds the variables of the environment file
+		}
+	} else {
+		if options.UserUnit {
+			configDir, err := os.UserConfigDir()
+			if err != nil {
+				fail(err)
+			}
+			unitDir = filepath.Join(configDir, "systemd", "user")
+		}
+		if files, notes, err = generate.Systemd(options); err != nil {
+			fail(err)
+		}
+	}
+
+	switch {
+	case f.install:
+		f.outputDir = unitDir
+	case f.outputDir == "":
+		for i, file := range files {
+			if len(files) > 1 {
+				if i > 0 {
+					fmt.Println()
+				}
+				fmt.Printf("# %s\n", file.Name)
+			}
+			os.Stdout.Write(file.Content)
+		}
+	}
+	if f.outputDir != "" {
+		if err := os.MkdirAll(f.outputDir, 0755); err != nil {
+			fail(err)
+		}
+		for _, file := range files {
+			path := filepath.Join(f.outputDir, file.Name)
+			if err := os.WriteFile(path, file.Content, mode); err != nil {
+				fail(err)
+			}
+			outputService.PrintSuccess(fmt.Sprintf("Wrote %s", path))
+		}
+	}
+
+	var commands [][]string
+	switch {
+	case launchd:
+		commands = [][]string{{"launchctl", "load", "-w", filepath.Join(unitDir, files[0].Name)}}
+	case options.UserUnit:
+		commands = [][]string{{"systemctl", "--user", "daemon-reload"}, {"systemctl", "--user", "enable", "--now", options.Name + ".timer"}}
+	default:
+		commands = [][]string{{"systemctl", "daemon-reload"}, {"systemctl", "enable", "--now", options.Name + ".timer"}}
+	}
+	if !f.install {
+		var lines []string
+		for _, command := range commands {
+			lines = append(lines, strings.Join(command, " "))
+		}
+		notes = append(notes, fmt.Sprintf("copy the files to %s and run: %s", unitDir, strings.Join(lines, " && ")))
+		commands = nil
+	}
+	for _, command := range commands {
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fail(fmt.Errorf("%s failed: %w", strings.Join(command, " "), err))
+		}
+	}
+	if f.install && !launchd {
+		outputService.PrintSuccess(fmt.Sprintf("Enabled %s.timer; run it now with systemctl start %s.service", options.Name, options.Name))
+	}
+	for _, note := range notes {
+		fmt.Fprintf(os.Stderr, "Note: %s\n", note)
+	}
+}
+
+// checkServiceConfig loads the config the service will run, with the variables of its environment
+// file and its credentials in place, so a mistake shows now rather than at the first scheduled run
+func checkServiceConfig(options generate.ServiceOptions) error {
+	if options.EnvironmentFile != "" {
+		env, err := generate.ReadEnvironmentFile(options.EnvironmentFile)
+		if err != nil {
+			return err
+		}
+		for key, value := range env {
+			os.Setenv(key, value)
+		}
+	}
+	if len(options.Credentials) > 0 {
+		dir, err := os.MkdirTemp("", "backup-credentials-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		for _, credential := range options.Credentials {
+			name, path, _ := strings.Cut(credential, "=")
+			if err := os.Symlink(path, filepath.Join(dir, filepath.Base(name))); err != nil {
+				return err
+			}
+		}
+		os.Setenv("CREDENTIALS_DIRECTORY", dir)
+		defer os.Unsetenv("CREDENTIALS_DIRECTORY")
+	}
+	_, err := configfile.Load(options.Config)
+	return err
+}
+
+// loadConfig reads a config file for a backup run and registers the S3 stores it declares
+func loadConfig(path string) (domain.BackupConfig, error) {
+	config, err := configfile.Load(path)
+	if err != nil {
+		return config, err
+	}
+	return config, infrastructure.RegisterS3Stores(config.S3Stores)
+}
+
+// loadPlugins registers the engine and store plugins in BACKUP_PLUGIN_DIR, or in
+// ~/.config/backup-tool/plugins. A plugin that fails to load only costs its own engine or store.
+func loadPlugins() {
+	dir := os.Getenv("BACKUP_PLUGIN_DIR")
+	if dir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return
+		}
+		dir = filepath.Join(configDir, "backup-tool", "plugins")
+	}
+
+	if _, err := infrastructure.LoadPlugins(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// newServices returns the prompt and output services for either the terminal UI or plain
+// lines, the output showing as much as verbosity selects
+func newServices(useTUI bool, verbosity cli.Verbosity) (domain.ConfigService, domain.OutputService) {
+	if useTUI {
+		return cli.NewTUIConfigService(), cli.NewTUIOutputService(verbosity)
+	}
+	return cli.NewConfigService(), cli.NewOutputServiceWithVerbosity(verbosity)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/delivery/cli"
+	"github.com/wush/db-backup-tool/internal/delivery/configfile"
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// Stamped in by release builds, e.g.
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%FT%TZ)" ./cmd/backup
+//
+// Builds without them fall back to what the Go toolchain recorded.
+var version, commit, buildDate string
+
+// pseudoVersion matches what Go records for modules built at a commit rather than a tag
+var pseudoVersion = regexp.MustCompile(`\d{14}-[0-9a-f]{12}|\+dirty$`)
+
+// buildInfo describes the running binary from the stamped values, or the module version and
+// VCS details the toolchain recorded for go install and builds from a checkout
+func buildInfo() domain.BuildInfo {
+	build := domain.Build
+	if info, ok := debug.ReadBuildInfo(); ok {
+		build.GoVersion = info.GoVersion
+		// Builds from a checkout get a pseudo-version, which says less than the commit
+		if v := info.Main.Version; v != "" && v != "(devel)" && !pseudoVersion.MatchString(v) {
+			build.Version = strings.TrimPrefix(v, "v")
+		}
+		var dirty bool
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				build.Commit = setting.Value[:min(12, len(setting.Value))]
+			case "vcs.time":
+				build.Date = setting.Value
+			case "vcs.modified":
+				dirty = setting.Value == "true"
+			}
+		}
+		if dirty && build.Commit != "" {
+			build.Commit += "-dirty"
+		}
+	}
+
+	if version != "" {
+		build.Version = strings.TrimPrefix(version, "v")
+	}
+	if commit != "" {
+		build.Commit = commit
+	}
+	if buildDate != "" {
+		build.Date = buildDate
+	}
+	return build
+}
+
+// versionInfo is how version -json prints the build
+type versionInfo struct {
+	domain.BuildInfo
+	ConfigFormat int          `json:"config_format"` // configfile.CurrentVersion
+	Engines      []engineInfo `json:"engines"`
+}
+
+// engineInfo is one supported database engine and the tools it was tested with
+type engineInfo struct {
+	Type        domain.DatabaseType `json:"type"`
+	Name        string              `json:"name"`
+	TestedTools []string            `json:"tested_tools,omitempty"` // Empty for plugins
+}
+
+// versionFlags are the flags of version
+type versionFlags struct {
+	asJSON bool
+}
+
+func (f *versionFlags) define(flags *flag.FlagSet) {
+	flags.BoolVar(&f.asJSON, "json", false, "Print the version as JSON")
+}
+
+// versionMain handles "backup-tool version": print the build, the formats it reads and writes and
+// the engines it supports, with the tool versions each was tested with
+func versionMain(args []string) {
+	var f versionFlags
+	flags := parseFlags("version", f.define, args)
+
+	if flags.NArg() > 0 {
+		cli.NewOutputService().PrintError("usage: backup-tool version [-json]")
+		os.Exit(2)
+	}
+
+	printed := versionInfo{BuildInfo: domain.Build, ConfigFormat: configfile.CurrentVersion, Engines: []engineInfo{}}
+	for _, dbType := range domain.EngineTypes() {
+		engine, err := domain.LookupEngine(dbType)
+		if err != nil {
+			continue
+		}
+		info := engineInfo{Type: dbType, Name: engine.Name()}
+		if tested, ok := engine.(domain.TestedEngine); ok {
+			info.TestedTools = tested.TestedTools()
+		}
+		printed.Engines = append(printed.Engines, info)
+	}
+
+	if f.asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(printed)
+		return
+	}
+
+	fmt.Printf("backup-tool %s\n", printed.BuildInfo)
+	if printed.GoVersion != "" {
+		fmt.Printf("Built with %s\n", printed.GoVersion)
+	}
+	fmt.Printf("Config format %d, artifact format %d\n\nEngines:\n", printed.ConfigFormat, printed.Format)
+	for _, engine := range printed.Engines {
+		tested := "plugin, not tested with this build"
+		if len(engine.TestedTools) > 0 {
+			tested = "tested with " + strings.Join(engine.TestedTools, ", ")
+		}
+		fmt.Printf("  %-12s %-12s %s\n", engine.Type, engine.Name, tested)
+	}
+}
@@ -0,0 +1,394 @@
+package api
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+	"github.com/wush/db-backup-tool/internal/usecase"
+)
+
+// Server exposes the daemon usecase over HTTP. Every request needs "Authorization: Bearer <token>"
+// with the token of a user whose role allows it.
+type Server struct {
+	daemon *usecase.DaemonUsecase
+	users  []domain.APIUser
+}
+
+// NewServer creates an API server for users, of whom there must be at least one
+func NewServer(daemon *usecase.DaemonUsecase, users []domain.APIUser) (*Server, error) {
+	if len(users) == 0 {
+		return nil, fmt.Errorf("an API token is required")
+	}
+	return &Server{daemon: daemon, users: users}, nil
+}
+
+// Handler returns the routes of the API and the dashboard. The dashboard page itself holds
+// no data and is served without a token; it asks for one and sends it with its API calls.
+func (s *Server) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/v1/whoami", s.whoami)
+	api.Handle("POST /api/v1/backups", allow(domain.PermissionBackup, s.startBackup))
+	api.Handle("GET /api/v1/runs", allow(domain.PermissionView, s.listRuns))
+	api.Handle("GET /api/v1/runs/{id}", allow(domain.PermissionView, s.getRun))
+	api.Handle("GET /api/v1/catalog", allow(domain.PermissionView, s.listCatalog))
+	api.Handle("GET /api/v1/catalog/{id}/download", allow(domain.PermissionDownload, s.download))
+	api.Handle("POST /api/v1/catalog/{id}/restore", allow(domain.PermissionRestore, s.startRestore))
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.authenticate(api))
+	mux.HandleFunc("GET /{$}", serveDashboard)
+	return mux
+}
+
+// userKey is the context key of the user a request was authenticated as
+type userKey struct{}
+
+// authenticate rejects requests without the token of a user, and passes on the user of the others
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		user, found := domain.FindAPIUser(s.users, token)
+		if !ok || !found {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	})
+}
+
+// allow rejects requests of users whose role does not allow permission
+func allow(permission domain.Permission, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := r.Context().Value(userKey{}).(domain.APIUser)
+		if !user.Role.Allows(permission) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("%s's role %s does not allow %s", user.Name, user.Role, permission))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// whoami handles GET /api/v1/whoami, which tells clients such as the dashboard what the user may do
+func (s *Server) whoami(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userKey{}).(domain.APIUser)
+	writeJSON(w, http.StatusOK, userResponse{Name: user.Name, Role: user.Role, Permissions: user.Role.Permissions()})
+}
+
+// startBackup handles POST /api/v1/backups?only=env=prod&only=tier=db
+func (s *Server) startBackup(w http.ResponseWriter, r *http.Request) {
+	filter := make(domain.Tags)
+	for _, value := range r.URL.Query()["only"] {
+		tags, err := domain.ParseTags(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for key, value := range tags {
+			filter[key] = value
+		}
+	}
+
+	run, err := s.daemon.StartRun(filter)
+	writeStarted(w, run, err)
+}
+
+// startRestore handles POST /api/v1/catalog/{id}/restore, which overwrites the configured database
+// the backup was taken from
+func (s *Server) startRestore(w http.ResponseWriter, r *http.Request) {
+	run, err := s.daemon.StartRestore(r.PathValue("id"))
+	writeStarted(w, run, err)
+}
+
+// writeStarted answers a request that started a run
+func writeStarted(w http.ResponseWriter, run domain.Run, err error) {
+	switch {
+	case errors.Is(err, domain.ErrRunInProgress):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, domain.ErrBackupNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrNoRestoreTarget):
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		w.Header().Set("Location", "/api/v1/runs/"+run.ID)
+		writeJSON(w, http.StatusAccepted, newRunResponse(run))
+	}
+}
+
+// listRuns handles GET /api/v1/runs
+func (s *Server) listRuns(w http.ResponseWriter, r *http.Request) {
+	runs := s.daemon.ListRuns()
+	response := make([]runResponse, 0, len(runs))
+	for _, run := range runs {
+		response = append(response, newRunResponse(run))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getRun handles GET /api/v1/runs/{id}
+func (s *Server) getRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.daemon.GetRun(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, newRunResponse(run))
+}
+
+// listCatalog handles GET /api/v1/catalog
+func (s *Server) listCatalog(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.daemon.ListBackups()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []domain.CatalogEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// download handles GET /api/v1/catalog/{id}/download. Dump files are sent as they are;
+// MongoDB dump directories are sent as a gzipped tar.
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	entry, ok, err := s.daemon.FindBackup(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "backup not found")
+		return
+	}
+
+	if entry.StoreKey != "" {
+		writeError(w, http.StatusConflict, "backup is only kept in stores "+strings.Join(entry.Stores, ", ")+"; pull or restore it from there")
+		return
+	}
+	info, err := os.Stat(entry.Path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "backup file is missing")
+		return
+	}
+
+	name := filepath.Base(entry.Path)
+	if !info.IsDir() {
+		content, packed, err := s.daemon.OpenPackedBackup(entry)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		if !packed {
+			http.ServeFile(w, r, entry.Path)
+			return
+		}
+		// Deduplicated backups are put back together from their chunks as they are sent
+		defer content.Close()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		io.Copy(w, content)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".tar.gz"))
+	// The status is already sent, so a failure part way can only cut the stream short
+	writeTarGz(w, entry.Path)
+}
+
+// writeTarGz writes the directory dir as a gzipped tar, with paths relative to its parent
+func writeTarGz(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	base := filepath.Dir(dir)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// userResponse is the JSON form of the user a request was made as
+type userResponse struct {
+	Name        string              `json:"name"`
+	Role        domain.Role         `json:"role"`
+	Permissions []domain.Permission `json:"permissions"`
+}
+
+// runResponse is the JSON form of a run
+type runResponse struct {
+	ID         string           `json:"id"`
+	Kind       domain.RunKind   `json:"kind"`
+	Status     domain.RunStatus `json:"status"`
+	Filter     domain.Tags      `json:"filter,omitempty"`
+	Backup     string           `json:"backup,omitempty"`
+	Current    string           `json:"current,omitempty"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+	Results    []resultResponse `json:"results"`
+	Restore    *restoreResponse `json:"restore,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// resultResponse is the JSON form of a backup result
+type resultResponse struct {
+	DatabaseType domain.DatabaseType `json:"database_type"`
+	Database     string              `json:"database"`
+	Label        string              `json:"label,omitempty"`
+	Tags         domain.Tags         `json:"tags,omitempty"`
+	Success      bool                `json:"success"`
+	BackupPath   string              `json:"backup_path,omitempty"`
+	Size         string              `json:"size,omitempty"`
+	SizeBytes    int64               `json:"size_bytes,omitempty"`
+	SnapshotARN  string              `json:"snapshot_arn,omitempty"` // RDS snapshot backups
+	Error        string              `json:"error,omitempty"`
+	ErrorKind    string              `json:"error_kind,omitempty"` // connection_failed, tool_missing, auth_failed, disk_full or transfer_corrupt
+	Stderr       string              `json:"stderr,omitempty"`
+	Warnings     []string            `json:"warnings,omitempty"` // e.g. a size far below the previous backups
+	Duration     string              `json:"duration"`
+}
+
+// restoreResponse is the JSON form of a restore result
+type restoreResponse struct {
+	DatabaseType domain.DatabaseType `json:"database_type"`
+	Database     string              `json:"database"`
+	BackupPath   string              `json:"backup_path"`
+	Success      bool                `json:"success"`
+	PreparedDir  string              `json:"prepared_dir,omitempty"`
+	Claim        string              `json:"claim,omitempty"`    // Snapshot restores: the PersistentVolumeClaim created
+	Instance     string              `json:"instance,omitempty"` // RDS snapshot restores: the DB instance or cluster created
+	Checks       []checkResponse     `json:"checks,omitempty"`
+	Error        string              `json:"error,omitempty"`
+	ErrorKind    string              `json:"error_kind,omitempty"` // connection_failed, tool_missing, auth_failed, disk_full or transfer_corrupt
+	Stderr       string              `json:"stderr,omitempty"`
+	Duration     string              `json:"duration"`
+}
+
+// checkResponse is the JSON form of a check run after a restore
+type checkResponse struct {
+	Query  string `json:"query"`
+	Expect string `json:"expect,omitempty"`
+	Result string `json:"result"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+func newRunResponse(run domain.Run) runResponse {
+	response := runResponse{
+		ID:        run.ID,
+		Kind:      run.Kind,
+		Status:    run.Status,
+		Filter:    run.Filter,
+		Backup:    run.Backup,
+		Current:   run.Current,
+		StartedAt: run.StartedAt,
+		Results:   make([]resultResponse, 0, len(run.Results)),
+		Error:     run.Error,
+	}
+	if !run.FinishedAt.IsZero() {
+		response.FinishedAt = &run.FinishedAt
+	}
+
+	for _, result := range run.Results {
+		r := resultResponse{
+			DatabaseType: result.DatabaseType,
+			Database:     result.Database,
+			Label:        result.Label,
+			Tags:         result.Tags,
+			Success:      result.Success,
+			BackupPath:   result.BackupPath,
+			Size:         result.Size,
+			SizeBytes:    result.SizeBytes,
+			SnapshotARN:  result.SnapshotARN,
+			Stderr:       result.Stderr,
+			Warnings:     result.Warnings,
+			Duration:     result.Duration.String(),
+		}
+		if result.Error != nil {
+			r.Error = result.Error.Error()
+			r.ErrorKind = domain.ErrorKind(result.Error)
+		}
+		response.Results = append(response.Results, r)
+	}
+
+	if result := run.Restore; result != nil {
+		response.Restore = &restoreResponse{
+			DatabaseType: result.DatabaseType,
+			Database:     result.Database,
+			BackupPath:   result.BackupPath,
+			Success:      result.Success,
+			PreparedDir:  result.PreparedDir,
+			Claim:        result.Claim,
+			Instance:     result.Instance,
+			Stderr:       result.Stderr,
+			Duration:     result.Duration.String(),
+		}
+		if result.Error != nil {
+			response.Restore.Error = result.Error.Error()
+			response.Restore.ErrorKind = domain.ErrorKind(result.Error)
+		}
+		for _, check := range result.Checks {
+			c := checkResponse{Query: check.Query, Expect: check.Expect, Result: check.Result, Passed: check.Error == nil}
+			if check.Error != nil {
+				c.Error = check.Error.Error()
+			}
+			response.Restore.Checks = append(response.Restore.Checks, c)
+		}
+	}
+	return response
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -11,77 +11,72 @@ import (
 
 // ConfigServiceImpl implements domain.ConfigService
 type ConfigServiceImpl struct {
-	reader *bufio.Reader
+	prompter   prompter
+	last       domain.BackupConfig
+	configured map[domain.DatabaseType]int // Databases of each type asked for, nil without remembered answers
+	workloads  []domain.Workload
 }
 
-// NewConfigService creates a new config service
+// NewConfigService creates a config service using plain line prompts
 func NewConfigService() domain.ConfigService {
 	return &ConfigServiceImpl{
-		reader: bufio.NewReader(os.Stdin),
+		prompter: &linePrompter{reader: bufio.NewReader(os.Stdin)},
 	}
 }
 
+// NewTUIConfigService creates a config service using the interactive terminal UI
+func NewTUIConfigService() domain.ConfigService {
+	return &ConfigServiceImpl{
+		prompter: &tuiPrompter{},
+	}
+}
+
+// RememberAnswers offers the answers of a previous session as defaults
+func (s *ConfigServiceImpl) RememberAnswers(last domain.BackupConfig) {
+	s.last = last
+	s.configured = make(map[domain.DatabaseType]int)
+}
+
+// OfferWorkloads offers the running containers or pods to pick from
+func (s *ConfigServiceImpl) OfferWorkloads(workloads []domain.Workload) {
+	s.workloads = workloads
+}
+
 // SelectBackupMethod prompts user to select backup method
 func (s *ConfigServiceImpl) SelectBackupMethod() (domain.BackupMethod, error) {
-	fmt.Println("Select backup method:")
-	fmt.Println("  1. docker-run    (Use temporary container)")
-	fmt.Println("  2. docker-exec   (Exec into existing Docker container)")
-	fmt.Println("  3. kubectl-exec  (Exec into Kubernetes pod)")
-	
-	for {
-		fmt.Print("\nEnter choice [1-3]: ")
-		input, _ := s.reader.ReadString('\n')
-		input = strings.TrimSpace(input)
-		
-		switch input {
-		case "1":
-			return domain.BackupMethodDockerRun, nil
-		case "2":
-			return domain.BackupMethodDockerExec, nil
-		case "3":
-			return domain.BackupMethodKubectlExec, nil
-		default:
-			fmt.Println(colorRed + "Invalid choice. Please enter 1, 2, or 3." + colorReset)
-		}
+	methods := []domain.BackupMethod{
+		domain.BackupMethodDockerRun,
+		domain.BackupMethodDockerExec,
+		domain.BackupMethodKubectlExec,
+		domain.BackupMethodSSH,
 	}
+	
+	choice := s.prompter.Select(t("Select backup method"), []string{
+		t("docker-run    (Use temporary container)"),
+		t("docker-exec   (Exec into existing Docker container)"),
+		t("kubectl-exec  (Exec into Kubernetes pod)"),
+		t("ssh           (Run the tools on the database's machine over SSH)"),
+	})
+	return methods[choice], nil
 }
 
 // SelectDatabases prompts user to select databases to backup
 func (s *ConfigServiceImpl) SelectDatabases() ([]domain.DatabaseType, error) {
-	fmt.Println("\nSelect databases to backup:")
-	fmt.Println("  1. PostgreSQL")
-	fmt.Println("  2. MySQL")
-	fmt.Println("  3. MariaDB")
-	fmt.Println("  4. MongoDB")
-	fmt.Println("  5. All databases")
-	
-	fmt.Print("\nEnter choices (comma-separated, e.g., 1,2,4): ")
-	input, _ := s.reader.ReadString('\n')
-	input = strings.TrimSpace(input)
-	
-	if input == "5" {
-		return []domain.DatabaseType{
-			domain.DatabaseTypePostgres,
-			domain.DatabaseTypeMySQL,
-			domain.DatabaseTypeMariaDB,
-			domain.DatabaseTypeMongoDB,
-		}, nil
-	}
-	
-	choices := strings.Split(input, ",")
-	var selected []domain.DatabaseType
+	dbTypes := domain.EngineTypes()
+	
+	var options []string
+	for _, dbType := range dbTypes {
+		options = append(options, databaseLabel(dbType))
+	}
 	
+	choices := s.prompter.MultiSelect(t("Select databases to backup"), append(options, t(backOption)), t("All databases"))
+	if wentBack(choices, len(options)) {
+		return nil, domain.ErrBack
+	}
+	var selected []domain.DatabaseType
 	for _, choice := range choices {
-		choice = strings.TrimSpace(choice)
-		switch choice {
-		case "1":
-			selected = append(selected, domain.DatabaseTypePostgres)
-		case "2":
-			selected = append(selected, domain.DatabaseTypeMySQL)
-		case "3":
-			selected = append(selected, domain.DatabaseTypeMariaDB)
-		case "4":
-			selected = append(selected, domain.DatabaseTypeMongoDB)
+		if choice < len(dbTypes) {
+			selected = append(selected, dbTypes[choice])
 		}
 	}
 	
@@ -92,98 +87,604 @@ func (s *ConfigServiceImpl) SelectDatabases() ([]domain.DatabaseType, error) {
 	return selected, nil
 }
 
+// SelectDiscoveredDatabases prompts user to pick databases found in a compose file
+func (s *ConfigServiceImpl) SelectDiscoveredDatabases(source string, found []domain.DiscoveredDatabase) ([]domain.DiscoveredDatabase, error) {
+	var options []string
+	for _, db := range found {
+		options = append(options, fmt.Sprintf("%-10s  %s  (%s, container %s)", databaseLabel(db.Config.Type), db.Service, db.Image, db.Config.Container))
+	}
+	
+	choices := s.prompter.MultiSelect(tf("Databases found in %s (none to choose types instead)", source), append(options, t(backOption)), t("All of them"))
+	if wentBack(choices, len(options)) {
+		return nil, domain.ErrBack
+	}
+	var selected []domain.DiscoveredDatabase
+	for _, choice := range choices {
+		if choice < len(found) {
+			selected = append(selected, found[choice])
+		}
+	}
+	return selected, nil
+}
+
+// ConfigureDiscoveredDatabase prompts user to confirm the details of a discovered database
+func (s *ConfigServiceImpl) ConfigureDiscoveredDatabase(found domain.DiscoveredDatabase, method domain.BackupMethod) (domain.DatabaseConfig, error) {
+	s.prompter.Heading(tf("Configuring %s (service %s)", strings.ToUpper(found.Config.Type.String()), found.Service))
+	config := s.configureDatabase(found.Config, method, t("Database Name"))
+	s.promptDumpOptions(&config, method)
+	return config, nil
+}
+
+// SelectAnotherDatabase asks whether to add one more database, such as a second PostgreSQL instance
+func (s *ConfigServiceImpl) SelectAnotherDatabase(canGoBack bool) (domain.DatabaseType, bool, error) {
+	dbTypes := domain.EngineTypes()
+	
+	var options []string
+	for _, dbType := range dbTypes {
+		options = append(options, databaseLabel(dbType))
+	}
+	options = append(options, t("No, continue"))
+	if canGoBack {
+		options = append(options, t(backOption))
+	}
+	
+	choice := s.prompter.Select(t("Add another database?"), options)
+	switch choice {
+	case len(dbTypes):
+		return "", false, nil
+	case len(dbTypes) + 1:
+		return "", false, domain.ErrBack
+	}
+	return dbTypes[choice], true, nil
+}
+
+// PromptLabel asks for a label telling a database apart from others of its type
+func (s *ConfigServiceImpl) PromptLabel(config domain.DatabaseConfig) (string, error) {
+	return s.promptInput(t("Label"), valueOrDefault(config.Label, config.Database)), nil
+}
+
 // GetKubernetesNamespace prompts user for Kubernetes namespace
 func (s *ConfigServiceImpl) GetKubernetesNamespace() (string, error) {
-	fmt.Println()
-	namespace := s.promptInput("Kubernetes Namespace", "default")
+	namespace := s.promptInput(t("Kubernetes Namespace"), valueOrDefault(s.last.K8sNamespace, "default"))
 	return namespace, nil
 }
 
+// GetKubernetesContext prompts user for the default kubeconfig and context
+func (s *ConfigServiceImpl) GetKubernetesContext() (string, string, error) {
+	kubeconfig := s.promptRemembered(t("Kubeconfig Path"), t("Kubeconfig Path (blank for KUBECONFIG or ~/.kube/config)"), s.last.Kubeconfig)
+	kubeContext := s.promptRemembered(t("Kube Context"), t("Kube Context (blank for current context)"), s.last.KubeContext)
+	return kubeconfig, kubeContext, nil
+}
+
 // ConfigureDatabase prompts user to configure a specific database
 func (s *ConfigServiceImpl) ConfigureDatabase(dbType domain.DatabaseType, method domain.BackupMethod) (domain.DatabaseConfig, error) {
-	config := domain.DatabaseConfig{
-		Type: dbType,
+	s.prompter.Heading(tf("Configuring %s", strings.ToUpper(dbType.String())))
+	config := s.configureDatabase(s.remembered(dbType), method, t("Database Name"))
+	s.promptDumpOptions(&config, method)
+	return config, nil
+}
+
+// PromptTarget prompts user for the container or pod of a database before anything else
+func (s *ConfigServiceImpl) PromptTarget(dbType domain.DatabaseType, method domain.BackupMethod) (domain.DatabaseConfig, error) {
+	s.prompter.Heading(tf("Configuring %s", strings.ToUpper(dbType.String())))
+	config := s.remembered(dbType)
+	s.promptTarget(&config, method)
+	return config, nil
+}
+
+// ConfirmCredentials asks whether to use the credentials found in the container or pod
+func (s *ConfigServiceImpl) ConfirmCredentials(target domain.DatabaseConfig, found domain.DatabaseConfig, method domain.BackupMethod) (bool, error) {
+	var details []string
+	if found.User != "" {
+		details = append(details, tf("user %s", found.User))
+	}
+	if found.Password != "" {
+		details = append(details, tf("password %s", redactedSecret))
+	}
+	if found.Database != "" {
+		details = append(details, tf("database %s", found.Database))
 	}
 	
-	fmt.Printf("\n%s=== Configuring %s ===%s\n", colorBlue, strings.ToUpper(dbType.String()), colorReset)
+	prompt := tf("Use %s from the environment of %s?", strings.Join(details, ", "), location(target, method))
+	return s.prompter.Confirm(prompt), nil
+}
+
+// ConfigureTargetDatabase prompts user for the remaining details of a database whose
+// container or pod is already known
+func (s *ConfigServiceImpl) ConfigureTargetDatabase(known domain.DatabaseConfig, method domain.BackupMethod) (domain.DatabaseConfig, error) {
+	config := s.configureConnection(known, t("Database Name"))
+	s.promptDumpOptions(&config, method)
+	return config, nil
+}
+
+// ConfigureRestoreTarget prompts user for the database to restore into
+func (s *ConfigServiceImpl) ConfigureRestoreTarget(entry domain.CatalogEntry, method domain.BackupMethod) (domain.DatabaseConfig, error) {
+	s.prompter.Heading(tf("Restore target (%s)", strings.ToUpper(entry.DatabaseType.String())))
+	config := s.configureDatabase(domain.DatabaseConfig{Type: entry.DatabaseType, Database: entry.Database}, method, t("Target Database Name"))
 	
-	switch dbType {
-	case domain.DatabaseTypePostgres:
-		config.Host = s.promptInput("PostgreSQL Host", "postgres")
-		config.User = s.promptInput("PostgreSQL User", "postgres")
-		config.Database = s.promptInput("Database Name", "mydb")
-		config.Password = s.promptPassword("PostgreSQL Password")
-		config.Version = s.promptInput("PostgreSQL Version", "15")
-		
-		if method == domain.BackupMethodDockerExec {
-			config.Container = s.promptInput("Container Name", "test-postgres")
-		} else if method == domain.BackupMethodKubectlExec {
-			config.Pod = s.promptInput("Pod Name", "postgres-0")
+	// Community edition cannot stop a single database, only the whole container
+	if config.Type == domain.DatabaseTypeNeo4j && method == domain.BackupMethodDockerExec &&
+		s.prompter.Confirm(t("Stop the container while loading (Neo4j Community)?")) {
+		config.Neo4j.Strategy = domain.Neo4jStopContainer
+	}
+	return config, nil
+}
+
+// connectionDefaults are offered when nothing better is known about a database; other
+// engines get defaults derived from their type
+var connectionDefaults = map[domain.DatabaseType]domain.DatabaseConfig{
+	domain.DatabaseTypePostgres: {Host: "postgres", User: "postgres", Version: "15", Container: "test-postgres", Pod: "postgres-0"},
+	domain.DatabaseTypeMySQL:    {Host: "mysql", User: "root", Version: "8", Container: "test-mysql", Pod: "mysql-0"},
+	domain.DatabaseTypeMariaDB:  {Host: "mariadb", User: "root", Version: "11", Container: "test-mariadb", Pod: "mariadb-0"},
+	domain.DatabaseTypeMongoDB:  {Host: "mongodb", Version: "7", Container: "test-mongodb", Pod: "mongodb-0"},
+	
+	domain.DatabaseTypeTimescaleDB: {Host: "timescaledb", User: "postgres", Version: "latest-pg16", Container: "test-timescaledb", Pod: "timescaledb-0"},
+	domain.DatabaseTypeInfluxDB:    {Host: "influxdb", Version: "2", Container: "test-influxdb", Pod: "influxdb-0"},
+	domain.DatabaseTypeCockroachDB: {Host: "cockroachdb", User: "root", Version: "latest-v24.1", Container: "test-cockroachdb", Pod: "cockroachdb-0"},
+	domain.DatabaseTypeYugabyteDB:  {Host: "yugabytedb", User: "yugabyte", Version: "latest", Container: "test-yugabytedb", Pod: "yb-tserver-0"},
+	domain.DatabaseTypeNeo4j:       {Host: "neo4j", User: "neo4j", Version: "5-community", Container: "test-neo4j", Pod: "neo4j-0"},
+	domain.DatabaseTypeEtcd:        {Host: "127.0.0.1", Database: "etcd", Version: "3.5.15-0"},
+	domain.DatabaseTypeRabbitMQ:    {Host: "rabbitmq", User: "guest", Database: "rabbitmq", Version: "3-management"},
+}
+
+func defaultsFor(dbType domain.DatabaseType) domain.DatabaseConfig {
+	if defaults, ok := connectionDefaults[dbType]; ok {
+		return defaults
+	}
+	return domain.DatabaseConfig{Host: dbType.String(), Container: "test-" + dbType.String(), Pod: dbType.String() + "-0"}
+}
+
+// remembered returns the connection details given last time for the next database of dbType
+// to be configured: the second PostgreSQL database is offered those of the second one before
+func (s *ConfigServiceImpl) remembered(dbType domain.DatabaseType) domain.DatabaseConfig {
+	config := domain.DatabaseConfig{Type: dbType}
+	if s.configured == nil {
+		return config
+	}
+	
+	skip := s.configured[dbType]
+	s.configured[dbType]++
+	for _, db := range s.last.Databases {
+		if db.Type != dbType {
+			continue
 		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		// Only what is typed in: secrets are not remembered, and dump options are asked anyway
+		config.Host, config.User, config.Database, config.AuthDatabase = db.Host, db.User, db.Database, db.AuthDatabase
+		config.Version, config.Container, config.Pod = db.Version, db.Container, db.Pod
+		break
+	}
+	return config
+}
+
+// configureDatabase asks for the connection details of one database, offering the values
+// already set in known as defaults. A password that is already known is not asked again.
+func (s *ConfigServiceImpl) configureDatabase(known domain.DatabaseConfig, method domain.BackupMethod, databasePrompt string) domain.DatabaseConfig {
+	if method == domain.BackupMethodDockerRun {
+		s.promptManaged(&known)
+	}
+	config := s.configureConnection(known, databasePrompt)
+	s.promptTarget(&config, method)
+	return config
+}
+
+// configureConnection asks for the host, credentials, database and version
+func (s *ConfigServiceImpl) configureConnection(known domain.DatabaseConfig, databasePrompt string) domain.DatabaseConfig {
+	config := known
+	defaults := defaultsFor(config.Type)
+	name := databaseLabel(config.Type)
+	
+	config.Host = s.promptInput(tf("%s Host", name), valueOrDefault(known.Host, defaults.Host))
+	if config.Type == domain.DatabaseTypeMongoDB {
+		config.Database = s.promptInput(databasePrompt, valueOrDefault(known.Database, "mydb"))
+		if known.User != "" {
+			config.User = s.promptInput(t("MongoDB User"), known.User)
+		} else {
+			config.User = s.promptOptional(t("MongoDB User (blank for no authentication)"))
+		}
+		if config.User != "" {
+			if config.Password == "" {
+				config.Password = s.promptPassword(t("MongoDB Password"))
+			}
+			config.AuthDatabase = s.promptInput(t("Authentication Database"), valueOrDefault(known.AuthDatabase, "admin"))
+		}
+	} else if config.Type == domain.DatabaseTypeEtcd {
+		config.Database = s.promptInput(t("Name for the Snapshots"), valueOrDefault(known.Database, defaults.Database))
+		if known.User != "" {
+			config.User = s.promptInput(t("etcd User"), known.User)
+		} else {
+			config.User = s.promptOptional(t("etcd User (blank for no authentication)"))
+		}
+		if config.User != "" && config.Password == "" {
+			config.Password = s.promptPassword(t("etcd Password"))
+		}
+	} else if config.Type == domain.DatabaseTypeRabbitMQ {
+		config.Database = s.promptInput(t("Name for the Backups"), valueOrDefault(known.Database, defaults.Database))
+		config.User = s.promptInput(t("RabbitMQ Management User"), valueOrDefault(known.User, defaults.User))
+		if config.Password == "" {
+			config.Password = s.promptPassword(t("RabbitMQ Management Password"))
+		}
+	} else if config.Type == domain.DatabaseTypeInfluxDB {
+		config.Database = s.promptInput(t("Bucket (database for InfluxDB 1.x)"), valueOrDefault(known.Database, "mybucket"))
+		if known.User != "" {
+			config.User = s.promptInput(t("Organization"), known.User)
+		} else {
+			config.User = s.promptOptional(t("Organization (blank for the token's own)"))
+		}
+		if config.Password == "" {
+			config.Password = s.promptPassword(t("API Token (blank for InfluxDB 1.x)"))
+		}
+	} else {
+		config.User = s.promptInput(tf("%s User", name), valueOrDefault(known.User, defaults.User))
+		config.Database = s.promptInput(databasePrompt, valueOrDefault(known.Database, "mydb"))
+		if config.Password == "" && config.NeedsPassword() {
+			config.Password = s.promptPassword(tf("%s Password", name))
+		}
+	}
+	config.Version = s.promptInput(tf("%s Version", name), valueOrDefault(known.Version, defaults.Version))
+	if config.Type.TakesClientCerts() {
+		s.promptCerts(&config)
+	}
+	
+	return config
+}
+
+// managedProviders are offered in the order of the wizard, with the names people know them by
+var managedProviders = []struct{ provider, name string }{
+	{domain.ManagedRDS, "Amazon RDS"},
+	{domain.ManagedCloudSQL, "Google Cloud SQL"},
+	{domain.ManagedAtlas, "MongoDB Atlas"},
+}
+
+// managedLabel names the provider running a managed database, e.g. "Amazon RDS (IAM)"
+func managedLabel(managed *domain.ManagedOptions) string {
+	label := managed.Provider
+	for _, known := range managedProviders {
+		if known.provider == managed.Provider {
+			label = known.name
+		}
+	}
+	if managed.IAMAuth {
+		label += " (IAM)"
+	}
+	return label
+}
+
+// promptManaged asks whether a database reached over the network is run by a cloud provider
+// that offers its type, and for RDS and Cloud SQL whether to log in with IAM
+func (s *ConfigServiceImpl) promptManaged(config *domain.DatabaseConfig) {
+	providers := []string{""}
+	options := []string{t("No, it is self-hosted")}
+	for _, managed := range managedProviders {
+		if (domain.ManagedOptions{Provider: managed.provider}).Validate(config.Type, domain.BackupMethodDockerRun) == nil {
+			providers = append(providers, managed.provider)
+			options = append(options, managed.name)
+		}
+	}
+	if len(providers) == 1 {
+		return
+	}
+	
+	config.Managed = nil
+	choice := s.prompter.Select(t("Is the database a managed cloud service?"), options)
+	if choice == 0 {
+		return
+	}
+	managed := &domain.ManagedOptions{Provider: providers[choice]}
+	if managed.Provider != domain.ManagedAtlas && s.prompter.Confirm(t("Log in with an IAM token instead of a password?")) {
+		managed.IAMAuth = true
+		config.Password = ""
+		if managed.Provider == domain.ManagedRDS {
+			managed.Region = s.promptOptional(t("AWS Region (blank for the aws CLI's default)"))
+		}
+	}
+	config.Managed = managed
+}
+
+// promptCerts asks for the client certificates of a database that requires TLS
+func (s *ConfigServiceImpl) promptCerts(config *domain.DatabaseConfig) {
+	if config.Certs != nil || !s.prompter.Confirm(t("Connect with TLS certificates?")) {
+		return
+	}
+	certs := &domain.ClientCerts{CA: s.promptOptional(t("CA Certificate Path (blank to skip server verification)"))}
+	if config.Type == domain.DatabaseTypeMongoDB {
+		// The MongoDB tools read the key from the certificate's file
+		certs.Cert = s.promptOptional(t("Client Certificate and Key PEM Path (blank to skip)"))
+		config.Certs = certs
+		return
+	}
+	certs.Cert = s.promptOptional(t("Client Certificate Path (blank to use the password)"))
+	if certs.Cert != "" {
+		certs.Key = s.promptInput(t("Client Key Path"), strings.TrimSuffix(certs.Cert, ".crt")+".key")
+	}
+	config.Certs = certs
+}
+
+// promptTarget asks for the container or pod that the exec methods run the tools in, or the
+// machine that ssh runs them on
+func (s *ConfigServiceImpl) promptTarget(config *domain.DatabaseConfig, method domain.BackupMethod) {
+	defaults := defaultsFor(config.Type)
+	if config.Type.ReachedOverAPI() {
+		return // Not in a container or pod
+	}
+	if method == domain.BackupMethodDockerExec {
+		config.Container = s.promptWorkload(t("Container Name"), config.Type, valueOrDefault(config.Container, defaults.Container))
+	} else if method == domain.BackupMethodKubectlExec {
+		config.Pod = s.promptWorkload(t("Pod Name"), config.Type, valueOrDefault(config.Pod, defaults.Pod))
+		s.promptKubeTarget(config)
+	} else if method == domain.BackupMethodSSH {
+		config.SSHHost = s.promptInput(t("SSH Host (user@host[:port])"), valueOrDefault(config.SSHHost, config.Host))
+		config.SSHKey = s.promptRemembered(t("SSH Key Path"), t("SSH Key Path (blank for the SSH agent and ~/.ssh)"), config.SSHKey)
+	}
+}
+
+// promptWorkload lets user pick one of the offered containers or pods whose image is of dbType,
+// defaultValue first if it is one of them, or type another name
+func (s *ConfigServiceImpl) promptWorkload(prompt string, dbType domain.DatabaseType, defaultValue string) string {
+	var names, options []string
+	for _, workload := range s.workloads {
+		if imageType, _, ok := domain.ImageDatabase(workload.Image); !ok || imageType != dbType {
+			continue
+		}
+		option := fmt.Sprintf("%s  (%s)", workload.Name, workload.Image)
+		if workload.Name == defaultValue {
+			names, options = append([]string{workload.Name}, names...), append([]string{option}, options...)
+		} else {
+			names, options = append(names, workload.Name), append(options, option)
+		}
+	}
+	if len(names) == 0 {
+		return s.promptInput(prompt, defaultValue)
+	}
+	
+	choice := s.prompter.Select(prompt, append(options, t("Other (type the name)")))
+	if choice < len(names) {
+		return names[choice]
+	}
+	return s.promptInput(prompt, defaultValue)
+}
+
+// promptDumpOptions asks how a database is dumped, which only matters when taking a backup
+func (s *ConfigServiceImpl) promptDumpOptions(config *domain.DatabaseConfig, method domain.BackupMethod) {
+	switch config.Type {
+	case domain.DatabaseTypePostgres, domain.DatabaseTypeTimescaleDB:
+		config.Globals = s.prompter.Confirm(t("Also back up roles and tablespaces (pg_dumpall --globals-only)?"))
 		
-	case domain.DatabaseTypeMySQL:
-		config.Host = s.promptInput("MySQL Host", "mysql")
-		config.User = s.promptInput("MySQL User", "root")
-		config.Database = s.promptInput("Database Name", "mydb")
-		config.Password = s.promptPassword("MySQL Password")
-		config.Version = s.promptInput("MySQL Version", "8")
-		
-		if method == domain.BackupMethodDockerExec {
-			config.Container = s.promptInput("Container Name", "test-mysql")
-		} else if method == domain.BackupMethodKubectlExec {
-			config.Pod = s.promptInput("Pod Name", "mysql-0")
+	case domain.DatabaseTypeMariaDB, domain.DatabaseTypeMySQL:
+		if config.Type == domain.DatabaseTypeMariaDB && method != domain.BackupMethodDockerRun {
+			config.Physical = s.prompter.Confirm(t("Physical backup of the whole server with mariabackup (faster for large datasets)?"))
+		}
+		if !config.Physical && s.prompter.Confirm(t("Consistent snapshot with routines and events (--single-transaction --routines --events)?")) {
+			config.MySQLDump = domain.MySQLDumpOptions{SingleTransaction: true, Routines: true, Events: true}
 		}
 		
-	case domain.DatabaseTypeMariaDB:
-		config.Host = s.promptInput("MariaDB Host", "mariadb")
-		config.User = s.promptInput("MariaDB User", "root")
-		config.Database = s.promptInput("Database Name", "mydb")
-		config.Password = s.promptPassword("MariaDB Password")
-		config.Version = s.promptInput("MariaDB Version", "11")
+	case domain.DatabaseTypeMongoDB:
+		config.Archive = s.prompter.Confirm(t("Write a single compressed archive instead of a directory?"))
 		
+	case domain.DatabaseTypeNeo4j:
+		strategies := []string{domain.Neo4jOnline, domain.Neo4jStopDatabase}
+		options := []string{t("Online backup (Enterprise)"), t("Stop the database while dumping (Enterprise)")}
 		if method == domain.BackupMethodDockerExec {
-			config.Container = s.promptInput("Container Name", "test-mariadb")
-		} else if method == domain.BackupMethodKubectlExec {
-			config.Pod = s.promptInput("Pod Name", "mariadb-0")
+			strategies = append(strategies, domain.Neo4jStopContainer)
+			options = append(options, t("Stop the container while dumping (Community)"))
+		} else if method == domain.BackupMethodDockerRun {
+			strategies, options = strategies[:1], options[:1]
+		}
+		config.Neo4j.Strategy = strategies[s.prompter.Select(t("Select Neo4j backup strategy"), options)]
+	}
+}
+
+// ConfirmConnectionTest asks whether to test the connection to a database just configured
+func (s *ConfigServiceImpl) ConfirmConnectionTest(config domain.DatabaseConfig) (bool, error) {
+	return s.prompter.Confirm(tf("Test the connection to %s now?", displayName(config.Database, config.Label))), nil
+}
+
+// ReviewConnectionFailure asks what to do with a database that could not be reached
+func (s *ConfigServiceImpl) ReviewConnectionFailure(config domain.DatabaseConfig) (domain.ReviewAction, error) {
+	actions := []domain.ReviewAction{domain.ReviewEdit, domain.ReviewProceed, domain.ReviewRemove}
+	choice := s.prompter.Select(t("What would you like to do?"), []string{
+		t("Edit the database and test again"),
+		t("Keep it as it is"),
+		t("Leave it out of the backup"),
+	})
+	return actions[choice], nil
+}
+
+// ReviewBackup asks user to confirm the backup and, if not, whether to fix one of its
+// databases instead of cancelling
+func (s *ConfigServiceImpl) ReviewBackup(config domain.BackupConfig) (domain.ReviewAction, int, error) {
+	if s.prompter.Confirm(t("Proceed with backup?")) {
+		return domain.ReviewProceed, 0, nil
+	}
+	
+	for {
+		actions := []domain.ReviewAction{domain.ReviewEdit}
+		options := []string{t("Edit a database")}
+		if len(config.Databases) > 1 {
+			actions = append(actions, domain.ReviewRemove)
+			options = append(options, t("Remove a database"))
 		}
+		actions = append(actions, domain.ReviewCancel)
+		options = append(options, t("Cancel the backup"))
 		
-	case domain.DatabaseTypeMongoDB:
-		config.Host = s.promptInput("MongoDB Host", "mongodb")
-		config.Database = s.promptInput("Database Name", "mydb")
-		config.Version = s.promptInput("MongoDB Version", "7")
+		action := actions[s.prompter.Select(t("What would you like to do?"), options)]
+		if action == domain.ReviewCancel {
+			return action, 0, nil
+		}
 		
-		if method == domain.BackupMethodDockerExec {
-			config.Container = s.promptInput("Container Name", "test-mongodb")
-		} else if method == domain.BackupMethodKubectlExec {
-			config.Pod = s.promptInput("Pod Name", "mongodb-0")
+		title := t("Database to edit")
+		if action == domain.ReviewRemove {
+			title = t("Database to remove")
+		}
+		var databases []string
+		for _, db := range config.Databases {
+			databases = append(databases, fmt.Sprintf("%s - %s", databaseLabel(db.Type), displayName(db.Database, db.Label)))
 		}
+		choice := s.prompter.Select(title, append(databases, t(backOption)))
+		if choice < len(databases) {
+			return action, choice, nil
+		}
+	}
+}
+
+// EditDatabase asks again for the details of a database, its current values as defaults
+func (s *ConfigServiceImpl) EditDatabase(config domain.DatabaseConfig, method domain.BackupMethod) (domain.DatabaseConfig, error) {
+	s.prompter.Heading(tf("Editing %s (a blank password keeps the current one)", strings.ToUpper(config.Type.String())))
+	known := config
+	known.Password = ""
+	// A label that was only the database name follows a new name
+	if known.Label == known.Database {
+		known.Label = ""
 	}
 	
-	return config, nil
+	edited := s.configureDatabase(known, method, t("Database Name"))
+	if edited.Password == "" {
+		edited.Password = config.Password
+	}
+	s.promptDumpOptions(&edited, method)
+	return edited, nil
+}
+
+// PromptPassword asks for a database password that is not stored in a profile
+func (s *ConfigServiceImpl) PromptPassword(config domain.DatabaseConfig) (string, error) {
+	return s.promptPassword(tf("%s Password (%s)", databaseLabel(config.Type), config.Database)), nil
+}
+
+// PromptProfileName asks whether to save the session as a profile; empty means no
+func (s *ConfigServiceImpl) PromptProfileName() (string, error) {
+	return s.promptOptional(t("Save these answers as a profile? Enter a name (blank to skip)")), nil
+}
+
+// SelectDatabaseType prompts user to select a single database type
+func (s *ConfigServiceImpl) SelectDatabaseType() (domain.DatabaseType, error) {
+	dbTypes := domain.EngineTypes()
+	
+	var options []string
+	for _, dbType := range dbTypes {
+		options = append(options, databaseLabel(dbType))
+	}
+	
+	choice := s.prompter.Select(t("Select database type"), options)
+	return dbTypes[choice], nil
+}
+
+// SelectBackup prompts user to pick one of the available backups
+func (s *ConfigServiceImpl) SelectBackup(entries []domain.CatalogEntry) (domain.CatalogEntry, error) {
+	if len(entries) == 0 {
+		return domain.CatalogEntry{}, fmt.Errorf("no backups available")
+	}
+	
+	var options []string
+	for _, entry := range entries {
+		options = append(options, backupLabel(entry))
+	}
+	
+	choice := s.prompter.Select(t("Select backup to restore"), options)
+	return entries[choice], nil
+}
+
+// ConfirmRestore asks user to confirm overwriting the target database
+func (s *ConfigServiceImpl) ConfirmRestore(entry domain.CatalogEntry, target domain.DatabaseConfig, method domain.BackupMethod) (bool, error) {
+	where := location(target, method)
+	
+	into := target.Database
+	if entry.Database != "" && entry.Database != target.Database {
+		into = tf("%s (renamed from %s)", target.Database, entry.Database)
+	}
+	
+	prompt := tf("Restore %s into %s on %s? Existing data may be overwritten", entry.Path, into, where)
+	return s.prompter.Confirm(prompt), nil
+}
+
+// ConfirmClone asks user to confirm overwriting the clone target
+func (s *ConfigServiceImpl) ConfirmClone(config domain.CloneConfig) (bool, error) {
+	prompt := tf("Copy %s from %s into %s on %s? Existing data may be overwritten",
+		config.Source.Database, location(config.Source, config.SourceMethod),
+		config.Target.Database, location(config.Target, config.TargetMethod))
+	return s.prompter.Confirm(prompt), nil
+}
+
+// location describes where a database is reached: its host, container or pod
+func location(config domain.DatabaseConfig, method domain.BackupMethod) string {
+	switch method {
+	case domain.BackupMethodDockerExec:
+		return fmt.Sprintf("container %s", config.Container)
+	case domain.BackupMethodKubectlExec:
+		if config.KubeContext != "" {
+			return fmt.Sprintf("pod %s (context %s)", config.Pod, config.KubeContext)
+		}
+		return fmt.Sprintf("pod %s", config.Pod)
+	case domain.BackupMethodSSH:
+		return fmt.Sprintf("%s over ssh", config.SSHHost)
+	}
+	return config.Host
+}
+
+// backupLabel describes a backup in one line: "2024-05-01 02:00  mydb  12M  (container db-1)"
+func backupLabel(entry domain.CatalogEntry) string {
+	label := fmt.Sprintf("%s  %s", entry.CreatedAt.Format("2006-01-02 15:04"), displayName(valueOrDefault(entry.Database, "?"), entry.Label))
+	if entry.Size != "" {
+		label += "  " + entry.Size
+	}
+	if entry.Source != "" {
+		label += fmt.Sprintf("  (%s)", entry.Source)
+	}
+	if len(entry.Tags) > 0 {
+		label += "  " + entry.Tags.String()
+	}
+	if entry.Base != "" {
+		label += "  [differential]"
+	}
+	if entry.StoreKey != "" {
+		label += "  [in " + strings.Join(entry.Stores, ", ") + "]"
+	}
+	return label
 }
 
-// ConfirmBackup asks user to confirm backup operation
-func (s *ConfigServiceImpl) ConfirmBackup(config domain.BackupConfig) (bool, error) {
-	fmt.Print("\nProceed with backup? (y/n): ")
-	input, _ := s.reader.ReadString('\n')
-	input = strings.ToLower(strings.TrimSpace(input))
-	return input == "y" || input == "yes", nil
+// backOption is offered by the steps of the wizard that can return to the one before
+const backOption = "← Back"
+
+// wentBack reports whether the back option, listed after count others, is all that was
+// picked; picked along with others, e.g. by choosing all, it is ignored
+func wentBack(choices []int, count int) bool {
+	return len(choices) == 1 && choices[0] == count
+}
+
+func databaseLabel(dbType domain.DatabaseType) string {
+	if engine, err := domain.LookupEngine(dbType); err == nil {
+		return engine.Name()
+	}
+	return dbType.String()
 }
 
 // Helper methods
 func (s *ConfigServiceImpl) promptInput(prompt, defaultValue string) string {
-	fmt.Printf("%s [%s]: ", prompt, defaultValue)
-	input, _ := s.reader.ReadString('\n')
-	input = strings.TrimSpace(input)
-	
-	if input == "" {
-		return defaultValue
+	return s.prompter.Input(prompt, defaultValue)
+}
+
+func (s *ConfigServiceImpl) promptOptional(prompt string) string {
+	return s.prompter.Optional(prompt)
+}
+
+// promptRemembered asks for a value that may be left empty, offering the one given last time
+// as default if there was one
+func (s *ConfigServiceImpl) promptRemembered(prompt, optionalPrompt, last string) string {
+	if last != "" {
+		return s.promptInput(prompt, last)
+	}
+	return s.promptOptional(optionalPrompt)
+}
+
+func (s *ConfigServiceImpl) promptKubeTarget(config *domain.DatabaseConfig) {
+	config.KubeContext = s.promptOptional(t("Kube Context (blank for run default)"))
+	if config.KubeContext != "" {
+		config.Kubeconfig = s.promptOptional(t("Kubeconfig Path (blank for run default)"))
 	}
-	return input
 }
 
 func (s *ConfigServiceImpl) promptPassword(prompt string) string {
-	fmt.Printf("%s: ", prompt)
-	input, _ := s.reader.ReadString('\n')
-	return strings.TrimSpace(input)
+	return s.prompter.Password(prompt)
 }
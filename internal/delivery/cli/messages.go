@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Locale is a language the prompts and summaries are shown in, as an ISO 639-1 code
+type Locale string
+
+const (
+	LocaleEnglish    Locale = "en"
+	LocaleSpanish    Locale = "es"
+	LocaleIndonesian Locale = "id"
+)
+
+// catalogs translate the English prompts and summary text, which serve as their own keys, so
+// a message missing from a catalog is shown in English. Run logs, errors from the lower
+// layers and the machine-readable output stay English.
+var catalogs = map[Locale]map[string]string{
+	LocaleEnglish:    {},
+	LocaleSpanish:    spanishMessages,
+	LocaleIndonesian: indonesianMessages,
+}
+
+// locale is the language of the output, set by SetLocale before anything is printed
+var locale = LocaleEnglish
+
+// SetLocale shows prompts and summaries in the given language
+func SetLocale(l Locale) error {
+	if _, ok := catalogs[l]; !ok {
+		return fmt.Errorf("unsupported language %q, use one of %s", l, strings.Join(Locales(), ", "))
+	}
+	locale = l
+	return nil
+}
+
+// Locales lists the supported languages
+func Locales() []string {
+	var names []string
+	for l := range catalogs {
+		names = append(names, string(l))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LocaleFromEnv picks the language from LC_ALL, LC_MESSAGES or LANG, as in es_ES.UTF-8,
+// falling back to English for unset and unsupported languages
+func LocaleFromEnv() Locale {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		language, _, _ := strings.Cut(strings.ToLower(value), "_")
+		language, _, _ = strings.Cut(language, ".")
+		if _, ok := catalogs[Locale(language)]; ok {
+			return Locale(language)
+		}
+		return LocaleEnglish
+	}
+	return LocaleEnglish
+}
+
+// t translates a message into the current language
+func t(message string) string {
+	if translated, ok := catalogs[locale][message]; ok {
+		return translated
+	}
+	return message
+}
+
+// tf translates a format string and formats it
+func tf(format string, args ...interface{}) string {
+	return fmt.Sprintf(t(format), args...)
+}
+
+// yesAnswers are the answers to a yes/no line prompt taken as yes, besides the English ones
+var yesAnswers = map[Locale][]string{
+	LocaleSpanish:    {"s", "si", "sí"},
+	LocaleIndonesian: {"ya"},
+}
+
+// isYes reports whether a line prompt answer means yes
+func isYes(answer string) bool {
+	answer = strings.ToLower(answer)
+	if answer == "y" || answer == "yes" {
+		return true
+	}
+	for _, yes := range yesAnswers[locale] {
+		if answer == yes {
+			return true
+		}
+	}
+	return false
+}
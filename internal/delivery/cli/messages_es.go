@@ -0,0 +1,171 @@
+package cli
+
+// spanishMessages translates the prompts and summaries into Spanish
+var spanishMessages = map[string]string{
+	// Prompts
+	"(y/n)":                   "(s/n)",
+	"Yes":                     "Sí",
+	"No":                      "No",
+	"\nEnter choice [1-%d]: ": "\nElija una opción [1-%d]: ",
+	"Invalid choice. Please enter a number between 1 and %d.":     "Opción no válida. Escriba un número entre 1 y %d.",
+	"\nEnter choices (comma-separated, e.g., 1,2,4): ":            "\nElija opciones (separadas por comas, p. ej., 1,2,4): ",
+	"↑/↓ move • enter select • esc cancel":                        "↑/↓ mover • enter elegir • esc cancelar",
+	"↑/↓ move • space toggle • a %s • enter confirm • esc cancel": "↑/↓ mover • espacio marcar • a %s • enter confirmar • esc cancelar",
+
+	// Configuration
+	"Select database type":                                             "Elija el tipo de base de datos",
+	"Select databases to backup":                                       "Elija las bases de datos a respaldar",
+	"Select backup method":                                             "Elija el método de respaldo",
+	"Select backup to restore":                                         "Elija el respaldo a restaurar",
+	"Select Neo4j backup strategy":                                     "Elija la estrategia de respaldo de Neo4j",
+	"docker-run    (Use temporary container)":                          "docker-run    (Usar un contenedor temporal)",
+	"docker-exec   (Exec into existing Docker container)":              "docker-exec   (Ejecutar en un contenedor Docker existente)",
+	"kubectl-exec  (Exec into Kubernetes pod)":                         "kubectl-exec  (Ejecutar en un pod de Kubernetes)",
+	"ssh           (Run the tools on the database's machine over SSH)": "ssh           (Ejecutar las herramientas en la máquina de la base de datos por SSH)",
+	"Configuring %s":                                                   "Configurando %s",
+	"Configuring %s (service %s)":                                      "Configurando %s (servicio %s)",
+	"Databases found in %s (none to choose types instead)":             "Bases de datos encontradas en %s (ninguna para elegir tipos)",
+	"All databases":                                                    "Todas las bases de datos",
+	"All of them":                                                      "Todas",
+	"user %s":                                                          "usuario %s",
+	"password %s":                                                      "contraseña %s",
+	"database %s":                                                      "base de datos %s",
+	"Use %s from the environment of %s?":                               "¿Usar %s del entorno de %s?",
+	"Container Name":                                                   "Nombre del contenedor",
+	"Other (type the name)":                                            "Otro (escribir el nombre)",
+	"Pod Name":                                                         "Nombre del pod",
+	"SSH Host (user@host[:port])":                                      "Host SSH (usuario@host[:puerto])",
+	"SSH Key Path":                                                     "Ruta de la clave SSH",
+	"SSH Key Path (blank for the SSH agent and ~/.ssh)":                "Ruta de la clave SSH (vacía para el agente SSH y ~/.ssh)",
+	"Kube Context (blank for current context)":                         "Contexto de Kube (vacío para el contexto actual)",
+	"Kube Context (blank for run default)":                             "Contexto de Kube (vacío para el de la ejecución)",
+	"Kubeconfig Path (blank for KUBECONFIG or ~/.kube/config)":         "Ruta de kubeconfig (vacía para KUBECONFIG o ~/.kube/config)",
+	"Kubeconfig Path (blank for run default)":                          "Ruta de kubeconfig (vacía para la de la ejecución)",
+	"%s Host":                 "Host de %s",
+	"%s User":                 "Usuario de %s",
+	"%s Password":             "Contraseña de %s",
+	"%s Password (%s)":        "Contraseña de %s (%s)",
+	"%s Version":              "Versión de %s",
+	"Database Name":           "Nombre de la base de datos",
+	"Target Database Name":    "Nombre de la base de datos de destino",
+	"Authentication Database": "Base de datos de autenticación",
+	"MongoDB User":            "Usuario de MongoDB",
+	"MongoDB User (blank for no authentication)":                      "Usuario de MongoDB (vacío para no autenticarse)",
+	"MongoDB Password":                                                "Contraseña de MongoDB",
+	"etcd User":                                                       "Usuario de etcd",
+	"etcd User (blank for no authentication)":                         "Usuario de etcd (vacío para no autenticarse)",
+	"etcd Password":                                                   "Contraseña de etcd",
+	"RabbitMQ Management User":                                        "Usuario de gestión de RabbitMQ",
+	"RabbitMQ Management Password":                                    "Contraseña de gestión de RabbitMQ",
+	"API Token (blank for InfluxDB 1.x)":                              "Token de API (vacío para InfluxDB 1.x)",
+	"Organization":                                                    "Organización",
+	"Organization (blank for the token's own)":                        "Organización (vacía para la del token)",
+	"Bucket (database for InfluxDB 1.x)":                              "Bucket (base de datos en InfluxDB 1.x)",
+	"Connect with TLS certificates?":                                  "¿Conectar con certificados TLS?",
+	"CA Certificate Path (blank to skip server verification)":         "Ruta del certificado de CA (vacía para no verificar el servidor)",
+	"Client Certificate Path (blank to use the password)":             "Ruta del certificado de cliente (vacía para usar la contraseña)",
+	"Client Certificate and Key PEM Path (blank to skip)":             "Ruta del PEM con certificado y clave de cliente (vacía para omitir)",
+	"Client Key Path":                                                 "Ruta de la clave de cliente",
+	"Is the database a managed cloud service?":                        "¿La base de datos es un servicio gestionado en la nube?",
+	"No, it is self-hosted":                                           "No, está autoalojada",
+	"Log in with an IAM token instead of a password?":                 "¿Iniciar sesión con un token de IAM en lugar de una contraseña?",
+	"AWS Region (blank for the aws CLI's default)":                    "Región de AWS (vacía para la predeterminada del CLI de aws)",
+	"Also back up roles and tablespaces (pg_dumpall --globals-only)?": "¿Respaldar también roles y tablespaces (pg_dumpall --globals-only)?",
+	"Consistent snapshot with routines and events (--single-transaction --routines --events)?": "¿Instantánea consistente con rutinas y eventos (--single-transaction --routines --events)?",
+	"Physical backup of the whole server with mariabackup (faster for large datasets)?":        "¿Respaldo físico de todo el servidor con mariabackup (más rápido con muchos datos)?",
+	"Write a single compressed archive instead of a directory?":                                "¿Escribir un único archivo comprimido en lugar de un directorio?",
+	"Online backup (Enterprise)":                                      "Respaldo en línea (Enterprise)",
+	"Stop the container while dumping (Community)":                    "Detener el contenedor durante el volcado (Community)",
+	"Stop the database while dumping (Enterprise)":                    "Detener la base de datos durante el volcado (Enterprise)",
+	"Stop the container while loading (Neo4j Community)?":             "¿Detener el contenedor durante la carga (Neo4j Community)?",
+	"Name for the Backups":                                            "Nombre de los respaldos",
+	"Name for the Snapshots":                                          "Nombre de las instantáneas",
+	"Add another database?":                                           "¿Agregar otra base de datos?",
+	"← Back":                                                          "← Volver",
+	"What would you like to do?":                                      "¿Qué desea hacer?",
+	"Edit a database":                                                 "Editar una base de datos",
+	"Remove a database":                                               "Quitar una base de datos",
+	"Cancel the backup":                                               "Cancelar el respaldo",
+	"Database to edit":                                                "Base de datos a editar",
+	"Database to remove":                                              "Base de datos a quitar",
+	"Editing %s (a blank password keeps the current one)":             "Editando %s (una contraseña vacía conserva la actual)",
+	"Test the connection to %s now?":                                  "¿Probar ahora la conexión con %s?",
+	"Edit the database and test again":                                "Editar la base de datos y volver a probar",
+	"Keep it as it is":                                                "Dejarla como está",
+	"Leave it out of the backup":                                      "Excluirla del respaldo",
+	"Proceed with backup?":                                            "¿Continuar con el respaldo?",
+	"No, continue":                                                    "No, continuar",
+	"Save these answers as a profile? Enter a name (blank to skip)":   "¿Guardar estas respuestas como perfil? Escriba un nombre (vacío para omitir)",
+	"Restore target (%s)":                                             "Destino de la restauración (%s)",
+	"%s (renamed from %s)":                                            "%s (renombrada desde %s)",
+	"Restore %s into %s on %s? Existing data may be overwritten":      "¿Restaurar %s en %s sobre %s? Los datos existentes pueden sobrescribirse",
+	"Copy %s from %s into %s on %s? Existing data may be overwritten": "¿Copiar %s desde %s a %s sobre %s? Los datos existentes pueden sobrescribirse",
+
+	// Summaries
+	"Interactive Database Backup Tool": "Herramienta interactiva de respaldo de bases de datos",
+	"Supports":                         "Admite",
+	"Configuration Summary":            "Resumen de la configuración",
+	"Backup Method":                    "Método de respaldo",
+	"Run ID":                           "ID de ejecución",
+	"Timestamp":                        "Marca de tiempo",
+	"Name Timezone":                    "Zona horaria del nombre",
+	"Backup Directory":                 "Directorio de respaldos",
+	"Copied To":                        "Copiado a",
+	"Parallel Backups":                 "Respaldos en paralelo",
+	"Parallel Uploads":                 "Subidas en paralelo",
+	"Kubernetes Namespace":             "Namespace de Kubernetes",
+	"Kube Context":                     "Contexto de Kube",
+	"Kubeconfig":                       "Kubeconfig",
+	"(current)":                        "(actual)",
+	"Databases to backup":              "Bases de datos a respaldar",
+	"  %d. %s - %s (Host: %s, User: %s, Password: %s)": "  %d. %s - %s (Host: %s, Usuario: %s, Contraseña: %s)",
+	" [tenant: %s]":        " [cliente: %s]",
+	" [tags: %s]":          " [etiquetas: %s]",
+	" [context: %s]":       " [contexto: %s]",
+	" [masking: %d rules]": " [enmascarado: %d reglas]",
+	" [physical]":          " [físico]",
+	" [with roles]":        " [con roles]",
+	" [to: %s]":            " [a: %s]",
+	" [copied to: %s]":     " [copiado a: %s]",
+	"none":                 "ninguno",
+	"Estimated size":       "Tamaño estimado",
+	"unknown":              "desconocido",
+	"Total":                "Total",
+	"Free space":           "Espacio libre",
+	"Free space in %s: %s": "Espacio libre en %s: %s",
+	"The backups may not fit: ~%s needed, %s free": "Puede que los respaldos no quepan: se necesitan ~%s, hay %s libres",
+	"Starting backup on %s...":                     "Iniciando el respaldo en %s...",
+	"Starting backup...":                           "Iniciando el respaldo...",
+	"Method":                                       "Método",
+	"Host":                                         "Host",
+	"Database":                                     "Base de datos",
+	"Label":                                        "Etiqueta",
+	"Tags":                                         "Etiquetas",
+	"Container":                                    "Contenedor",
+	"Pod":                                          "Pod",
+	"SSH Host":                                     "Host SSH",
+	"Managed by":                                   "Gestionada por",
+	"Context":                                      "Contexto",
+	"Backup completed: %s (%s) [%s]":               "Respaldo completado: %s (%s) [%s]",
+	"%s in store %s":                               "%s en el almacén %s",
+	"Backup failed: %v [%s]":                       "Falló el respaldo: %v [%s]",
+	"Drill failed: %v [%s]":                        "Falló el simulacro: %v [%s]",
+	"Drill failed: %s restored, %d of %d checks failed [%s]": "Falló el simulacro: %s restaurado, %d de %d comprobaciones fallaron [%s]",
+	"Drill passed: %s restored, %d checks passed [%s]":       "Simulacro superado: %s restaurado, %d comprobaciones superadas [%s]",
+	"%s, %s new in %d of %d chunks":                          "%s, %s nuevos en %d de %d fragmentos",
+	"Command output":                                         "Salida del comando",
+	"Hint":                                                   "Sugerencia",
+	"Backup Process Interrupted!":                            "¡Proceso de respaldo interrumpido!",
+	"Backup Process Completed!":                              "¡Proceso de respaldo completado!",
+	"Results":                                                "Resultados",
+	"Successful":                                             "Correctos",
+	"Failed":                                                 "Fallidos",
+	"Interrupted":                                            "Interrumpidos",
+	"Warnings":                                               "Advertencias",
+	"Backup files":                                           "Archivos de respaldo",
+	"the disk is full; free up space in the backup or temp directory":                                                     "el disco está lleno; libere espacio en el directorio de respaldos o temporal",
+	"check the user and password, or the permissions of the kube context":                                                 "revise el usuario y la contraseña, o los permisos del contexto de kube",
+	"the dump tool is not installed where it ran; docker-run brings its own":                                              "la herramienta de volcado no está instalada donde se ejecutó; docker-run trae la suya",
+	"check that Docker or the cluster is reachable, the database is running and the host, container or pod name is right": "compruebe que Docker o el clúster sean accesibles, que la base de datos esté en marcha y que el host, el contenedor o el pod sean correctos",
+	"the connection to Docker or the cluster lost data; run the backup again":                                             "la conexión con Docker o el clúster perdió datos; vuelva a ejecutar el respaldo",
+}
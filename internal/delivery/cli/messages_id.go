@@ -0,0 +1,171 @@
+package cli
+
+// indonesianMessages translates the prompts and summaries into Indonesian
+var indonesianMessages = map[string]string{
+	// Prompts
+	"(y/n)":                   "(y/t)",
+	"Yes":                     "Ya",
+	"No":                      "Tidak",
+	"\nEnter choice [1-%d]: ": "\nMasukkan pilihan [1-%d]: ",
+	"Invalid choice. Please enter a number between 1 and %d.":     "Pilihan tidak valid. Masukkan angka antara 1 dan %d.",
+	"\nEnter choices (comma-separated, e.g., 1,2,4): ":            "\nMasukkan pilihan (dipisah koma, mis. 1,2,4): ",
+	"↑/↓ move • enter select • esc cancel":                        "↑/↓ pindah • enter pilih • esc batal",
+	"↑/↓ move • space toggle • a %s • enter confirm • esc cancel": "↑/↓ pindah • spasi tandai • a %s • enter konfirmasi • esc batal",
+
+	// Configuration
+	"Select database type":                                             "Pilih jenis database",
+	"Select databases to backup":                                       "Pilih database yang akan dicadangkan",
+	"Select backup method":                                             "Pilih metode backup",
+	"Select backup to restore":                                         "Pilih backup yang akan dipulihkan",
+	"Select Neo4j backup strategy":                                     "Pilih strategi backup Neo4j",
+	"docker-run    (Use temporary container)":                          "docker-run    (Gunakan container sementara)",
+	"docker-exec   (Exec into existing Docker container)":              "docker-exec   (Jalankan di container Docker yang ada)",
+	"kubectl-exec  (Exec into Kubernetes pod)":                         "kubectl-exec  (Jalankan di pod Kubernetes)",
+	"ssh           (Run the tools on the database's machine over SSH)": "ssh           (Jalankan alat di mesin basis data lewat SSH)",
+	"Configuring %s":                                                   "Mengonfigurasi %s",
+	"Configuring %s (service %s)":                                      "Mengonfigurasi %s (layanan %s)",
+	"Databases found in %s (none to choose types instead)":             "Database yang ditemukan di %s (tidak ada untuk memilih jenis)",
+	"All databases":                                                    "Semua database",
+	"All of them":                                                      "Semuanya",
+	"user %s":                                                          "pengguna %s",
+	"password %s":                                                      "kata sandi %s",
+	"database %s":                                                      "database %s",
+	"Use %s from the environment of %s?":                               "Gunakan %s dari environment %s?",
+	"Container Name":                                                   "Nama container",
+	"Other (type the name)":                                            "Lainnya (ketik namanya)",
+	"Pod Name":                                                         "Nama pod",
+	"SSH Host (user@host[:port])":                                      "Host SSH (user@host[:port])",
+	"SSH Key Path":                                                     "Path kunci SSH",
+	"SSH Key Path (blank for the SSH agent and ~/.ssh)":                "Path kunci SSH (kosongkan untuk agen SSH dan ~/.ssh)",
+	"Kube Context (blank for current context)":                         "Kube context (kosongkan untuk context saat ini)",
+	"Kube Context (blank for run default)":                             "Kube context (kosongkan untuk bawaan run)",
+	"Kubeconfig Path (blank for KUBECONFIG or ~/.kube/config)":         "Path kubeconfig (kosongkan untuk KUBECONFIG atau ~/.kube/config)",
+	"Kubeconfig Path (blank for run default)":                          "Path kubeconfig (kosongkan untuk bawaan run)",
+	"%s Host":                 "Host %s",
+	"%s User":                 "Pengguna %s",
+	"%s Password":             "Kata sandi %s",
+	"%s Password (%s)":        "Kata sandi %s (%s)",
+	"%s Version":              "Versi %s",
+	"Database Name":           "Nama database",
+	"Target Database Name":    "Nama database tujuan",
+	"Authentication Database": "Database autentikasi",
+	"MongoDB User":            "Pengguna MongoDB",
+	"MongoDB User (blank for no authentication)":                      "Pengguna MongoDB (kosongkan tanpa autentikasi)",
+	"MongoDB Password":                                                "Kata sandi MongoDB",
+	"etcd User":                                                       "Pengguna etcd",
+	"etcd User (blank for no authentication)":                         "Pengguna etcd (kosongkan tanpa autentikasi)",
+	"etcd Password":                                                   "Kata sandi etcd",
+	"RabbitMQ Management User":                                        "Pengguna management RabbitMQ",
+	"RabbitMQ Management Password":                                    "Kata sandi management RabbitMQ",
+	"API Token (blank for InfluxDB 1.x)":                              "Token API (kosongkan untuk InfluxDB 1.x)",
+	"Organization":                                                    "Organisasi",
+	"Organization (blank for the token's own)":                        "Organisasi (kosongkan untuk milik token)",
+	"Bucket (database for InfluxDB 1.x)":                              "Bucket (database untuk InfluxDB 1.x)",
+	"Connect with TLS certificates?":                                  "Hubungkan dengan sertifikat TLS?",
+	"CA Certificate Path (blank to skip server verification)":         "Path sertifikat CA (kosongkan untuk melewati verifikasi server)",
+	"Client Certificate Path (blank to use the password)":             "Path sertifikat klien (kosongkan untuk memakai kata sandi)",
+	"Client Certificate and Key PEM Path (blank to skip)":             "Path PEM sertifikat dan kunci klien (kosongkan untuk melewati)",
+	"Client Key Path":                                                 "Path kunci klien",
+	"Is the database a managed cloud service?":                        "Apakah database ini layanan cloud terkelola?",
+	"No, it is self-hosted":                                           "Tidak, di-host sendiri",
+	"Log in with an IAM token instead of a password?":                 "Masuk dengan token IAM alih-alih kata sandi?",
+	"AWS Region (blank for the aws CLI's default)":                    "Region AWS (kosongkan untuk bawaan CLI aws)",
+	"Also back up roles and tablespaces (pg_dumpall --globals-only)?": "Cadangkan juga role dan tablespace (pg_dumpall --globals-only)?",
+	"Consistent snapshot with routines and events (--single-transaction --routines --events)?": "Snapshot konsisten dengan routine dan event (--single-transaction --routines --events)?",
+	"Physical backup of the whole server with mariabackup (faster for large datasets)?":        "Backup fisik seluruh server dengan mariabackup (lebih cepat untuk data besar)?",
+	"Write a single compressed archive instead of a directory?":                                "Tulis satu arsip terkompresi, bukan direktori?",
+	"Online backup (Enterprise)":                                      "Backup online (Enterprise)",
+	"Stop the container while dumping (Community)":                    "Hentikan container selama dump (Community)",
+	"Stop the database while dumping (Enterprise)":                    "Hentikan database selama dump (Enterprise)",
+	"Stop the container while loading (Neo4j Community)?":             "Hentikan container selama load (Neo4j Community)?",
+	"Name for the Backups":                                            "Nama untuk backup",
+	"Name for the Snapshots":                                          "Nama untuk snapshot",
+	"Add another database?":                                           "Tambah database lain?",
+	"← Back":                                                          "← Kembali",
+	"What would you like to do?":                                      "Apa yang ingin dilakukan?",
+	"Edit a database":                                                 "Ubah database",
+	"Remove a database":                                               "Hapus database",
+	"Cancel the backup":                                               "Batalkan backup",
+	"Database to edit":                                                "Database yang akan diubah",
+	"Database to remove":                                              "Database yang akan dihapus",
+	"Editing %s (a blank password keeps the current one)":             "Mengubah %s (kata sandi kosong mempertahankan yang sekarang)",
+	"Test the connection to %s now?":                                  "Uji koneksi ke %s sekarang?",
+	"Edit the database and test again":                                "Ubah database dan uji lagi",
+	"Keep it as it is":                                                "Biarkan seperti ini",
+	"Leave it out of the backup":                                      "Keluarkan dari backup",
+	"Proceed with backup?":                                            "Lanjutkan backup?",
+	"No, continue":                                                    "Tidak, lanjutkan",
+	"Save these answers as a profile? Enter a name (blank to skip)":   "Simpan jawaban ini sebagai profil? Masukkan nama (kosongkan untuk melewati)",
+	"Restore target (%s)":                                             "Tujuan pemulihan (%s)",
+	"%s (renamed from %s)":                                            "%s (diganti nama dari %s)",
+	"Restore %s into %s on %s? Existing data may be overwritten":      "Pulihkan %s ke %s di %s? Data yang ada mungkin ditimpa",
+	"Copy %s from %s into %s on %s? Existing data may be overwritten": "Salin %s dari %s ke %s di %s? Data yang ada mungkin ditimpa",
+
+	// Summaries
+	"Interactive Database Backup Tool": "Alat Backup Database Interaktif",
+	"Supports":                         "Mendukung",
+	"Configuration Summary":            "Ringkasan Konfigurasi",
+	"Backup Method":                    "Metode backup",
+	"Run ID":                           "ID run",
+	"Timestamp":                        "Stempel waktu",
+	"Name Timezone":                    "Zona waktu nama",
+	"Backup Directory":                 "Direktori backup",
+	"Copied To":                        "Disalin ke",
+	"Parallel Backups":                 "Backup paralel",
+	"Parallel Uploads":                 "Unggahan paralel",
+	"Kubernetes Namespace":             "Namespace Kubernetes",
+	"Kube Context":                     "Kube context",
+	"Kubeconfig":                       "Kubeconfig",
+	"(current)":                        "(saat ini)",
+	"Databases to backup":              "Database yang akan dicadangkan",
+	"  %d. %s - %s (Host: %s, User: %s, Password: %s)": "  %d. %s - %s (Host: %s, Pengguna: %s, Kata sandi: %s)",
+	" [tenant: %s]":        " [tenant: %s]",
+	" [tags: %s]":          " [tag: %s]",
+	" [context: %s]":       " [context: %s]",
+	" [masking: %d rules]": " [masking: %d aturan]",
+	" [physical]":          " [fisik]",
+	" [with roles]":        " [dengan role]",
+	" [to: %s]":            " [ke: %s]",
+	" [copied to: %s]":     " [disalin ke: %s]",
+	"none":                 "tidak ada",
+	"Estimated size":       "Perkiraan ukuran",
+	"unknown":              "tidak diketahui",
+	"Total":                "Total",
+	"Free space":           "Ruang kosong",
+	"Free space in %s: %s": "Ruang kosong di %s: %s",
+	"The backups may not fit: ~%s needed, %s free": "Backup mungkin tidak muat: perlu ~%s, tersedia %s",
+	"Starting backup on %s...":                     "Memulai backup di %s...",
+	"Starting backup...":                           "Memulai backup...",
+	"Method":                                       "Metode",
+	"Host":                                         "Host",
+	"Database":                                     "Database",
+	"Label":                                        "Label",
+	"Tags":                                         "Tag",
+	"Container":                                    "Container",
+	"Pod":                                          "Pod",
+	"SSH Host":                                     "Host SSH",
+	"Managed by":                                   "Dikelola oleh",
+	"Context":                                      "Context",
+	"Backup completed: %s (%s) [%s]":               "Backup selesai: %s (%s) [%s]",
+	"%s in store %s":                               "%s di penyimpanan %s",
+	"Backup failed: %v [%s]":                       "Backup gagal: %v [%s]",
+	"Drill failed: %v [%s]":                        "Latihan gagal: %v [%s]",
+	"Drill failed: %s restored, %d of %d checks failed [%s]": "Latihan gagal: %s dipulihkan, %d dari %d pemeriksaan gagal [%s]",
+	"Drill passed: %s restored, %d checks passed [%s]":       "Latihan berhasil: %s dipulihkan, %d pemeriksaan lolos [%s]",
+	"%s, %s new in %d of %d chunks":                          "%s, %s baru dalam %d dari %d chunk",
+	"Command output":                                         "Keluaran perintah",
+	"Hint":                                                   "Petunjuk",
+	"Backup Process Interrupted!":                            "Proses Backup Terhenti!",
+	"Backup Process Completed!":                              "Proses Backup Selesai!",
+	"Results":                                                "Hasil",
+	"Successful":                                             "Berhasil",
+	"Failed":                                                 "Gagal",
+	"Interrupted":                                            "Terhenti",
+	"Warnings":                                               "Peringatan",
+	"Backup files":                                           "Berkas backup",
+	"the disk is full; free up space in the backup or temp directory":                                                     "disk penuh; kosongkan ruang di direktori backup atau temp",
+	"check the user and password, or the permissions of the kube context":                                                 "periksa pengguna dan kata sandi, atau izin kube context",
+	"the dump tool is not installed where it ran; docker-run brings its own":                                              "alat dump tidak terpasang di tempat dijalankan; docker-run membawa miliknya sendiri",
+	"check that Docker or the cluster is reachable, the database is running and the host, container or pod name is right": "pastikan Docker atau cluster dapat dijangkau, database berjalan dan nama host, container atau pod benar",
+	"the connection to Docker or the cluster lost data; run the backup again":                                             "koneksi ke Docker atau cluster kehilangan data; jalankan backup lagi",
+}
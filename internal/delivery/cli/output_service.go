@@ -1,13 +1,23 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
 
 	"github.com/wush/db-backup-tool/internal/domain"
 )
 
-const (
+// ANSI colors of the plain output, emptied by DisableColor
+var (
 	colorRed    = "\033[0;31m"
 	colorGreen  = "\033[0;32m"
 	colorYellow = "\033[1;33m"
@@ -16,97 +26,526 @@ const (
 	colorReset  = "\033[0m"
 )
 
-// OutputServiceImpl implements domain.OutputService
-type OutputServiceImpl struct{}
+// OutputServiceImpl implements domain.OutputService. Databases backed up in parallel print
+// through it at once, so each call's lines are written together, and while backups run in
+// parallel their start and result lines are prefixed with the database they belong to.
+type OutputServiceImpl struct {
+	mu        sync.Mutex
+	parallel  bool
+	verbosity Verbosity
+	secrets   secrets
+}
 
 // NewOutputService creates a new output service
 func NewOutputService() domain.OutputService {
-	return &OutputServiceImpl{}
+	return NewOutputServiceWithVerbosity(VerbosityNormal)
+}
+
+// NewOutputServiceWithVerbosity creates an output service showing as much as verbosity selects
+func NewOutputServiceWithVerbosity(verbosity Verbosity) domain.OutputService {
+	return &OutputServiceImpl{verbosity: verbosity}
 }
 
 // PrintHeader prints the application header
 func (s *OutputServiceImpl) PrintHeader() {
+	if s.verbosity == VerbosityQuiet {
+		return
+	}
+	
 	fmt.Println(colorBlue + "========================================")
-	fmt.Println("  Interactive Database Backup Tool")
+	fmt.Println("  " + t("Interactive Database Backup Tool"))
 	fmt.Println("  Clean Architecture Edition")
-	fmt.Println("  Supports: PostgreSQL, MySQL, MariaDB, MongoDB")
+	var names []string
+	for _, dbType := range domain.EngineTypes() {
+		names = append(names, databaseLabel(dbType))
+	}
+	fmt.Printf("  %s: %s\n", t("Supports"), strings.Join(names, ", "))
 	fmt.Println("========================================" + colorReset)
 	fmt.Println()
 }
 
 // PrintConfigSummary prints the backup configuration summary
 func (s *OutputServiceImpl) PrintConfigSummary(config domain.BackupConfig) {
-	fmt.Printf("\n%s=== Configuration Summary ===%s\n", colorCyan, colorReset)
-	fmt.Printf("Backup Method: %s\n", config.Method)
-	fmt.Printf("Timestamp: %s\n", config.Timestamp.Format("2006-01-02 15:04:05"))
-	fmt.Printf("Backup Directory: %s\n", config.BackupDir)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	// Uploads run beside the next dumps, so runs with stores interleave as well
+	s.parallel = config.Overlapping()
+	s.secrets.add(config.Databases...)
+	if s.verbosity == VerbosityQuiet {
+		return
+	}
+	
+	fmt.Printf("\n%s=== %s ===%s\n", colorCyan, t("Configuration Summary"), colorReset)
+	fmt.Printf("%s: %s\n", t("Backup Method"), config.Method)
+	if config.RunID != "" {
+		fmt.Printf("%s: %s\n", t("Run ID"), config.RunID)
+	}
+	fmt.Printf("%s: %s\n", t("Timestamp"), config.Timestamp.Format("2006-01-02 15:04:05"))
+	if config.Timezone != "" {
+		fmt.Printf("%s: %s\n", t("Name Timezone"), config.Timezone)
+	}
+	fmt.Printf("%s: %s\n", t("Backup Directory"), config.BackupDir)
+	if len(config.Stores) > 0 {
+		fmt.Printf("%s: %s\n", t("Copied To"), strings.Join(config.Stores, ", "))
+	}
+	if config.Parallel > 1 && len(config.Databases) > 1 {
+		fmt.Printf("%s: %d\n", t("Parallel Backups"), config.Parallel)
+	}
+	if config.Uploads.Parallel > 0 && len(config.Stores) > 0 {
+		fmt.Printf("%s: %d\n", t("Parallel Uploads"), config.Uploads.Parallel)
+	}
 	
 	if config.Method == domain.BackupMethodKubectlExec {
-		fmt.Printf("Kubernetes Namespace: %s\n", config.K8sNamespace)
+		fmt.Printf("%s: %s\n", t("Kubernetes Namespace"), config.K8sNamespace)
+		fmt.Printf("%s: %s\n", t("Kube Context"), valueOrDefault(config.KubeContext, t("(current)")))
+		if config.Kubeconfig != "" {
+			fmt.Printf("%s: %s\n", t("Kubeconfig"), config.Kubeconfig)
+		}
 	}
 	
-	fmt.Printf("\nDatabases to backup:\n")
+	fmt.Printf("\n%s:\n", t("Databases to backup"))
 	for i, db := range config.Databases {
-		fmt.Printf("  %d. %s - %s (Host: %s)\n", i+1, db.Type, db.Database, db.Host)
+		fmt.Print(tf("  %d. %s - %s (Host: %s, User: %s, Password: %s)",
+			i+1, db.Type, displayName(db.Database, db.Label), db.Host, valueOrDefault(db.User, "-"), redact(db.Password)))
+		if db.Tenant != "" {
+			fmt.Print(tf(" [tenant: %s]", db.Tenant))
+		}
+		if len(db.Tags) > 0 {
+			fmt.Print(tf(" [tags: %s]", db.Tags))
+		}
+		if db.KubeContext != "" {
+			fmt.Print(tf(" [context: %s]", db.KubeContext))
+		}
+		if len(db.Masking) > 0 {
+			fmt.Print(tf(" [masking: %d rules]", len(db.Masking)))
+		}
+		if db.Physical {
+			fmt.Print(t(" [physical]"))
+		}
+		if db.Globals {
+			fmt.Print(t(" [with roles]"))
+		}
+		if db.DumpMode != "" && db.DumpMode != domain.DumpModeFull {
+			fmt.Printf(" [%s]", db.DumpMode)
+		}
+		if db.BackupDir != "" {
+			fmt.Print(tf(" [to: %s]", db.BackupDir))
+		}
+		if db.Stores != nil {
+			fmt.Print(tf(" [copied to: %s]", valueOrDefault(strings.Join(db.Stores, ", "), t("none"))))
+		}
+		fmt.Println()
+	}
+}
+
+// PrintEstimate prints the expected dump sizes and warns when they may not fit on disk
+func (s *OutputServiceImpl) PrintEstimate(estimate domain.BackupEstimate) {
+	if s.verbosity == VerbosityQuiet {
+		return
+	}
+	
+	fmt.Printf("\n%s:\n", t("Estimated size"))
+	for _, db := range estimate.Databases {
+		if db.Error != nil {
+			fmt.Printf("  %s - %s: %s%s (%v)%s\n", db.DatabaseType, displayName(db.Database, db.Label), colorYellow, t("unknown"), db.Error, colorReset)
+			continue
+		}
+		fmt.Printf("  %s - %s: ~%s\n", db.DatabaseType, displayName(db.Database, db.Label), domain.FormatBytes(db.Bytes))
+	}
+	
+	total := estimate.Total()
+	fmt.Printf("  %s: ~%s\n", t("Total"), domain.FormatBytes(total))
+	
+	if estimate.FreeError != nil {
+		fmt.Printf("%s: %s%s (%v)%s\n", t("Free space"), colorYellow, t("unknown"), estimate.FreeError, colorReset)
+		return
+	}
+	fmt.Println(tf("Free space in %s: %s", estimate.BackupDir, domain.FormatBytes(estimate.FreeBytes)))
+	if total > estimate.FreeBytes {
+		fmt.Printf("%s⚠ %s%s\n", colorYellow,
+			tf("The backups may not fit: ~%s needed, %s free", domain.FormatBytes(total), domain.FormatBytes(estimate.FreeBytes)), colorReset)
 	}
 }
 
 // PrintBackupStart prints backup start message
 func (s *OutputServiceImpl) PrintBackupStart(dbType domain.DatabaseType, config domain.DatabaseConfig, method domain.BackupMethod) {
-	fmt.Printf("%s[%s] Starting backup...%s\n", colorBlue, strings.ToUpper(dbType.String()), colorReset)
-	fmt.Printf("  Method: %s\n", method)
-	fmt.Printf("  Host: %s\n", config.Host)
-	fmt.Printf("  Database: %s\n", config.Database)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	if s.verbosity == VerbosityQuiet {
+		return
+	}
+	// Details of backups running side by side would be hard to tell apart, so they get one line
+	if s.parallel {
+		fmt.Printf("%s%s %s%s\n", colorBlue, resultPrefix(dbType, config.Database, config.Label), tf("Starting backup on %s...", location(config, method)), colorReset)
+		return
+	}
+	
+	fmt.Printf("%s[%s] %s%s\n", colorBlue, strings.ToUpper(dbType.String()), t("Starting backup..."), colorReset)
+	fmt.Printf("  %s: %s\n", t("Method"), method)
+	fmt.Printf("  %s: %s\n", t("Host"), config.Host)
+	fmt.Printf("  %s: %s\n", t("Database"), config.Database)
+	if config.Label != "" && config.Label != config.Database {
+		fmt.Printf("  %s: %s\n", t("Label"), config.Label)
+	}
+	if len(config.Tags) > 0 {
+		fmt.Printf("  %s: %s\n", t("Tags"), config.Tags)
+	}
 	
 	if method == domain.BackupMethodDockerExec {
-		fmt.Printf("  Container: %s\n", config.Container)
+		fmt.Printf("  %s: %s\n", t("Container"), config.Container)
 	} else if method == domain.BackupMethodKubectlExec {
-		fmt.Printf("  Pod: %s\n", config.Pod)
+		fmt.Printf("  %s: %s\n", t("Pod"), config.Pod)
+		if config.KubeContext != "" {
+			fmt.Printf("  %s: %s\n", t("Context"), config.KubeContext)
+		}
+	} else if method == domain.BackupMethodSSH {
+		fmt.Printf("  %s: %s\n", t("SSH Host"), config.SSHHost)
+	} else if config.Managed != nil {
+		fmt.Printf("  %s: %s\n", t("Managed by"), managedLabel(config.Managed))
 	}
 }
 
 // PrintBackupResult prints backup result
 func (s *OutputServiceImpl) PrintBackupResult(result domain.BackupResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	// Warnings are shown even when quiet, as nothing else points at the backup
+	if result.Success && s.verbosity == VerbosityQuiet && len(result.Warnings) == 0 {
+		return
+	}
+	// Without the start line above it, a result has to name its database
+	if s.parallel || s.verbosity == VerbosityQuiet {
+		fmt.Print(resultPrefix(result.DatabaseType, result.Database, result.Label) + " ")
+	}
 	if result.Success {
-		fmt.Printf("%s✓ Backup completed: %s (%s) [%s]%s\n\n",
-			colorGreen, result.BackupPath, result.Size, result.Duration, colorReset)
+		fmt.Printf("%s✓ %s%s\n", colorGreen,
+			tf("Backup completed: %s (%s) [%s]", backupLocation(result), sizeText(result), result.Duration), colorReset)
+		for _, warning := range result.Warnings {
+			fmt.Printf("%s⚠ %s%s\n", colorYellow, warning, colorReset)
+		}
+		fmt.Println()
+	} else if errors.Is(result.Error, domain.ErrInterrupted) {
+		fmt.Printf("%s⊘ Backup %v [%s]%s\n\n",
+			colorYellow, result.Error, result.Duration, colorReset)
+	} else {
+		fmt.Printf("%s✗ %s%s\n", colorRed,
+			tf("Backup failed: %v [%s]", result.Error, result.Duration), colorReset)
+		printStderr(result.Stderr)
+		printHint(result.Error)
+		fmt.Println()
+	}
+}
+
+// resultPrefix names the database a line of a parallel run belongs to: "[POSTGRES mydb]"
+func resultPrefix(dbType domain.DatabaseType, database, label string) string {
+	return fmt.Sprintf("[%s %s]", strings.ToUpper(dbType.String()), displayName(database, label))
+}
+
+// backupLocation shows where a backup went: its path, or for a streamed one its name and store
+func backupLocation(result domain.BackupResult) string {
+	if result.StreamedTo == "" {
+		return result.BackupPath
+	}
+	return tf("%s in store %s", filepath.Base(result.BackupPath), result.StreamedTo)
+}
+
+// sizeText shows the size of a backup and, if it was deduplicated, the storage it added
+func sizeText(result domain.BackupResult) string {
+	if result.Packed == nil {
+		return result.Size
+	}
+	return tf("%s, %s new in %d of %d chunks", result.Size,
+		domain.FormatBytes(result.Packed.StoredBytes), result.Packed.NewChunks, result.Packed.Chunks)
+}
+
+// PrintRestoreStart prints restore start message
+func (s *OutputServiceImpl) PrintRestoreStart(entry domain.CatalogEntry, target domain.DatabaseConfig, method domain.BackupMethod) {
+	fmt.Printf("\n%s[%s] Starting restore...%s\n", colorBlue, strings.ToUpper(target.Type.String()), colorReset)
+	fmt.Printf("  Backup: %s\n", entry.Path)
+	fmt.Printf("  Method: %s\n", method)
+	fmt.Printf("  Host: %s\n", target.Host)
+	fmt.Printf("  Database: %s\n", target.Database)
+	
+	if method == domain.BackupMethodDockerExec {
+		fmt.Printf("  Container: %s\n", target.Container)
+	} else if method == domain.BackupMethodKubectlExec {
+		fmt.Printf("  Pod: %s\n", target.Pod)
+		if target.KubeContext != "" {
+			fmt.Printf("  Context: %s\n", target.KubeContext)
+		}
+	} else if method == domain.BackupMethodSSH {
+		fmt.Printf("  SSH Host: %s\n", target.SSHHost)
+	} else if target.Managed != nil {
+		fmt.Printf("  Managed by: %s\n", managedLabel(target.Managed))
+	}
+}
+
+// PrintRestoreResult prints restore result
+func (s *OutputServiceImpl) PrintRestoreResult(result domain.RestoreResult) {
+	if result.Success && domain.IsHostSnapshot(result.BackupPath) {
+		fmt.Printf("%s✓ Snapshot extracted into %s [%s]%s\n",
+			colorGreen, result.PreparedDir, result.Duration, colorReset)
+		fmt.Printf("  Stop the server, replace its data directory with the contents of\n")
+		fmt.Printf("  %s (e.g. rsync -a --delete %s/ <data dir>/) and start it again.\n\n", result.PreparedDir, result.PreparedDir)
+	} else if result.Success && result.PreparedDir != "" {
+		fmt.Printf("%s✓ Physical backup prepared in %s [%s]%s\n",
+			colorGreen, result.PreparedDir, result.Duration, colorReset)
+		fmt.Printf("  Stop the server, empty its data directory and run\n")
+		fmt.Printf("  mariabackup --copy-back --target-dir=%s\n", result.PreparedDir)
+		fmt.Printf("  then fix ownership (chown -R mysql:mysql) and start the server again.\n\n")
+	} else if result.Success && result.Claim != "" {
+		fmt.Printf("%s✓ Snapshot restored into claim %s [%s]%s\n",
+			colorGreen, result.Claim, result.Duration, colorReset)
+		fmt.Printf("  Point the database's pod at claim %s in place of its current one,\n", result.Claim)
+		fmt.Printf("  e.g. by editing the claim in the pod or StatefulSet, and restart it.\n\n")
+	} else if result.Success && result.Instance != "" {
+		fmt.Printf("%s✓ Snapshot restored into %s [%s]%s\n",
+			colorGreen, result.Instance, result.Duration, colorReset)
+		fmt.Printf("  RDS is still creating it; once it is available, point the application at its\n")
+		fmt.Printf("  endpoint. Aurora clusters need an instance added before they accept connections.\n\n")
+	} else if result.Success && result.Table != "" {
+		fmt.Printf("%s✓ Restore completed: %s from %s -> %s [%s]%s\n\n",
+			colorGreen, result.Table, result.BackupPath, result.Database, result.Duration, colorReset)
+	} else if result.Success {
+		fmt.Printf("%s✓ Restore completed: %s -> %s [%s]%s\n",
+			colorGreen, result.BackupPath, result.Database, result.Duration, colorReset)
+		printChecks(result.Checks)
+		fmt.Println()
 	} else {
-		fmt.Printf("%s✗ Backup failed: %v [%s]%s\n\n",
+		fmt.Printf("%s✗ Restore failed: %v [%s]%s\n",
 			colorRed, result.Error, result.Duration, colorReset)
+		printStderr(result.Stderr)
+		printHint(result.Error)
+		fmt.Println()
+	}
+}
+
+// PrintCloneStart prints clone start message
+func (s *OutputServiceImpl) PrintCloneStart(config domain.CloneConfig) {
+	fmt.Printf("\n%s[%s] Starting clone...%s\n", colorBlue, strings.ToUpper(config.Source.Type.String()), colorReset)
+	fmt.Printf("  From: %s on %s (%s)\n", config.Source.Database, location(config.Source, config.SourceMethod), config.SourceMethod)
+	fmt.Printf("  To:   %s on %s (%s)\n", config.Target.Database, location(config.Target, config.TargetMethod), config.TargetMethod)
+}
+
+// PrintChain prints a full backup and the differential backups that build on it, oldest first,
+// marking the backups a restore of the newest state applies
+func (s *OutputServiceImpl) PrintChain(chain domain.BackupChain) {
+	full := chain.Full
+	fmt.Printf("\n%s[%s] %s%s\n", colorBlue, strings.ToUpper(full.DatabaseType.String()),
+		displayName(valueOrDefault(full.Database, "?"), full.Label), colorReset)
+	fmt.Printf("  %s✓ full          %s  %s%s\n", colorGreen, full.CreatedAt.Format("2006-01-02 15:04"), full.Path, colorReset)
+	for i := len(chain.Differential) - 1; i >= 0; i-- {
+		entry := chain.Differential[i]
+		if i == 0 {
+			fmt.Printf("  %s✓ differential  %s  %s%s\n", colorGreen, entry.CreatedAt.Format("2006-01-02 15:04"), entry.Path, colorReset)
+		} else {
+			fmt.Printf("    differential  %s  %s (superseded)\n", entry.CreatedAt.Format("2006-01-02 15:04"), entry.Path)
+		}
+	}
+	if len(chain.Differential) > 0 {
+		fmt.Printf("  Restoring the newest state applies the full backup and the newest differential one\n")
+	}
+}
+
+// PrintDumpSummary prints the format, versions and tables of a backup artifact
+func (s *OutputServiceImpl) PrintDumpSummary(summary domain.DumpSummary) {
+	format := summary.Format
+	var details []string
+	if summary.Compressed != "" {
+		details = append(details, summary.Compressed)
+	}
+	if summary.Chunked {
+		details = append(details, "deduplicated")
+	}
+	if len(details) > 0 {
+		format += " (" + strings.Join(details, ", ") + ")"
+	}
+
+	fmt.Printf("\n%s%s%s\n", colorBlue, summary.Path, colorReset)
+	fmt.Printf("  Format:   %s\n", format)
+	if summary.Version != "" {
+		fmt.Printf("  Version:  %s\n", summary.Version)
+	}
+	if summary.Database != "" {
+		fmt.Printf("  Database: %s\n", summary.Database)
+	}
+	fmt.Printf("  Size:     %s\n", domain.FormatBytes(summary.SizeBytes))
+	for _, note := range summary.Notes {
+		fmt.Printf("  %s%s%s\n", colorYellow, note, colorReset)
+	}
+	if len(summary.Tables) == 0 {
+		return
+	}
+
+	width := 0
+	for _, table := range summary.Tables {
+		width = max(width, len(table.QualifiedName()))
+	}
+	fmt.Printf("  Tables:   %d\n", len(summary.Tables))
+	for _, table := range summary.Tables {
+		columns := ""
+		if len(table.Columns) > 0 {
+			columns = fmt.Sprintf("  %d columns", len(table.Columns))
+		}
+		fmt.Printf("    %-*s  ~%d rows%s\n", width, table.QualifiedName(), table.Rows, columns)
+	}
+}
+
+// PrintDrillResult prints whether a backup restored into its scratch server and each check
+// with what its query returned
+func (s *OutputServiceImpl) PrintDrillResult(result domain.DrillResult) {
+	fmt.Print(resultPrefix(result.DatabaseType, result.Database, result.Label) + " ")
+	failed := domain.FailedChecks(result.Checks)
+	
+	switch {
+	case result.Error != nil:
+		fmt.Printf("%s✗ %s%s\n", colorRed, tf("Drill failed: %v [%s]", result.Error, result.Duration), colorReset)
+		printStderr(result.Stderr)
+		printHint(result.Error)
+	case failed > 0:
+		fmt.Printf("%s✗ %s%s\n", colorRed,
+			tf("Drill failed: %s restored, %d of %d checks failed [%s]", result.BackupPath, failed, len(result.Checks), result.Duration), colorReset)
+	default:
+		fmt.Printf("%s✓ %s%s\n", colorGreen,
+			tf("Drill passed: %s restored, %d checks passed [%s]", result.BackupPath, len(result.Checks), result.Duration), colorReset)
+	}
+	printChecks(result.Checks)
+	fmt.Println()
+}
+
+// printChecks prints each check with what its query returned, or why it failed
+func printChecks(checks []domain.CheckResult) {
+	for _, check := range checks {
+		if check.Error != nil {
+			fmt.Printf("    %s✗ %s: %v%s\n", colorRed, check.Query, check.Error, colorReset)
+		} else {
+			fmt.Printf("    %s✓ %s: %s%s\n", colorGreen, check.Query, check.Result, colorReset)
+		}
+	}
+}
+
+// PrintSchemaDiff prints the tables and columns one dump adds, removes and changes against another
+func (s *OutputServiceImpl) PrintSchemaDiff(diff domain.SchemaDiff) {
+	fmt.Printf("\n%s%s -> %s%s\n", colorBlue, diff.From, diff.To, colorReset)
+	if diff.IsEmpty() {
+		fmt.Printf("  %s✓ Same tables and columns%s\n", colorGreen, colorReset)
+		return
 	}
+	for _, table := range diff.Added {
+		fmt.Printf("  %s+ %s%s\n", colorGreen, table.QualifiedName(), colorReset)
+	}
+	for _, table := range diff.Removed {
+		fmt.Printf("  %s- %s%s\n", colorRed, table.QualifiedName(), colorReset)
+	}
+	for _, change := range diff.Changed {
+		fmt.Printf("  %s~ %s%s\n", colorYellow, change.Table, colorReset)
+		for _, column := range change.Added {
+			fmt.Printf("      %s+ %s%s\n", colorGreen, column, colorReset)
+		}
+		for _, column := range change.Removed {
+			fmt.Printf("      %s- %s%s\n", colorRed, column, colorReset)
+		}
+		for _, column := range change.Altered {
+			fmt.Printf("      %s~ %s%s\n", colorYellow, column.From, colorReset)
+			fmt.Printf("        -> %s\n", column.To)
+		}
+	}
+}
+
+// PrintPhase prints how long a phase of a backup took, in verbose output
+func (s *OutputServiceImpl) PrintPhase(dbType domain.DatabaseType, label, phase string, elapsed time.Duration) {
+	if s.verbosity != VerbosityVerbose {
+		return
+	}
+	
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	fmt.Println(phaseLine(dbType, label, phase, elapsed))
+}
+
+// phaseLine describes how long a phase of a backup took: "  [POSTGRES mydb] dump took 1.2s"
+func phaseLine(dbType domain.DatabaseType, label, phase string, elapsed time.Duration) string {
+	return fmt.Sprintf("  %s %s took %s", resultPrefix(dbType, label, label), phase, elapsed.Round(time.Millisecond))
+}
+
+// PrintCommand prints a command about to run with the passwords of the run's databases
+// redacted, in verbose output
+func (s *OutputServiceImpl) PrintCommand(where, command string) {
+	if s.verbosity != VerbosityVerbose {
+		return
+	}
+	
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	fmt.Println(s.commandLine(where, command))
+}
+
+// commandLine shows a command and where it runs with the run's passwords redacted
+func (s *OutputServiceImpl) commandLine(where, command string) string {
+	return fmt.Sprintf("  %s$ %s%s", colorCyan, s.secrets.redact(where+": "+command), colorReset)
 }
 
 // PrintSummary prints final summary
 func (s *OutputServiceImpl) PrintSummary(results []domain.BackupResult) {
-	fmt.Printf("\n%s========================================%s\n", colorBlue, colorReset)
-	fmt.Printf("%sBackup Process Completed!%s\n", colorGreen, colorReset)
-	fmt.Printf("%s========================================%s\n", colorBlue, colorReset)
-	
 	successCount := 0
 	failureCount := 0
+	interruptedCount := 0
+	warningCount := 0
 	
 	for _, result := range results {
+		warningCount += len(result.Warnings)
 		if result.Success {
 			successCount++
+		} else if errors.Is(result.Error, domain.ErrInterrupted) {
+			interruptedCount++
 		} else {
 			failureCount++
 		}
 	}
 	
-	fmt.Printf("\nResults:\n")
-	fmt.Printf("  %sSuccessful: %d%s\n", colorGreen, successCount, colorReset)
+	fmt.Printf("\n%s========================================%s\n", colorBlue, colorReset)
+	if interruptedCount > 0 {
+		fmt.Printf("%s%s%s\n", colorYellow, t("Backup Process Interrupted!"), colorReset)
+	} else {
+		fmt.Printf("%s%s%s\n", colorGreen, t("Backup Process Completed!"), colorReset)
+	}
+	fmt.Printf("%s========================================%s\n", colorBlue, colorReset)
+	
+	fmt.Printf("\n%s:\n", t("Results"))
+	fmt.Printf("  %s%s: %d%s\n", colorGreen, t("Successful"), successCount, colorReset)
 	if failureCount > 0 {
-		fmt.Printf("  %sFailed: %d%s\n", colorRed, failureCount, colorReset)
+		fmt.Printf("  %s%s: %d%s\n", colorRed, t("Failed"), failureCount, colorReset)
+	}
+	if interruptedCount > 0 {
+		fmt.Printf("  %s%s: %d%s\n", colorYellow, t("Interrupted"), interruptedCount, colorReset)
+	}
+	if warningCount > 0 {
+		fmt.Printf("  %s%s: %d%s\n", colorYellow, t("Warnings"), warningCount, colorReset)
 	}
 	
-	fmt.Println("\nBackup files:")
+	fmt.Printf("\n%s:\n", t("Backup files"))
 	for _, result := range results {
+		name := displayName(result.Database, result.Label)
+		if len(result.Tags) > 0 {
+			name += fmt.Sprintf(" (%s)", result.Tags)
+		}
 		if result.Success {
-			fmt.Printf("  %s✓%s %s: %s (%s)\n",
-				colorGreen, colorReset, result.DatabaseType, result.BackupPath, result.Size)
+			fmt.Printf("  %s✓%s %s - %s: %s (%s)\n",
+				colorGreen, colorReset, result.DatabaseType, name, result.BackupPath, result.Size)
+			for _, warning := range result.Warnings {
+				fmt.Printf("    %s⚠ %s%s\n", colorYellow, warning, colorReset)
+			}
+		} else if errors.Is(result.Error, domain.ErrInterrupted) {
+			fmt.Printf("  %s⊘%s %s - %s: %v\n",
+				colorYellow, colorReset, result.DatabaseType, name, result.Error)
 		} else {
-			fmt.Printf("  %s✗%s %s: %v\n",
-				colorRed, colorReset, result.DatabaseType, result.Error)
+			fmt.Printf("  %s✗%s %s - %s: %v\n",
+				colorRed, colorReset, result.DatabaseType, name, result.Error)
 		}
 	}
 	fmt.Println()
@@ -114,10 +553,100 @@ func (s *OutputServiceImpl) PrintSummary(results []domain.BackupResult) {
 
 // PrintError prints an error message
 func (s *OutputServiceImpl) PrintError(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
 	fmt.Printf("%s✗ Error: %s%s\n", colorRed, message, colorReset)
 }
 
 // PrintSuccess prints a success message
 func (s *OutputServiceImpl) PrintSuccess(message string) {
+	if s.verbosity == VerbosityQuiet {
+		return
+	}
+	
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
 	fmt.Printf("%s✓ %s%s\n", colorGreen, message, colorReset)
 }
+
+// printStderr prints the captured stderr of a failed command, indented under the result
+func printStderr(stderr string) {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return
+	}
+	
+	fmt.Printf("  %s:\n", t("Command output"))
+	for _, line := range strings.Split(stderr, "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+}
+
+// printHint suggests what to check for the recognised kinds of failure
+func printHint(err error) {
+	var hint string
+	switch {
+	case errors.Is(err, domain.ErrDiskFull):
+		hint = "the disk is full; free up space in the backup or temp directory"
+	case errors.Is(err, domain.ErrAuthFailed):
+		hint = "check the user and password, or the permissions of the kube context"
+	case errors.Is(err, domain.ErrToolMissing):
+		hint = "the dump tool is not installed where it ran; docker-run brings its own"
+	case errors.Is(err, domain.ErrConnectionFailed):
+		hint = "check that Docker or the cluster is reachable, the database is running and the host, container or pod name is right"
+	case errors.Is(err, domain.ErrTransferCorrupt):
+		hint = "the connection to Docker or the cluster lost data; run the backup again"
+	}
+	if hint != "" {
+		fmt.Printf("  %s%s: %s%s\n", colorYellow, t("Hint"), t(hint), colorReset)
+	}
+}
+
+// redactedSecret replaces secrets in output; its fixed length hides the real length
+const redactedSecret = "********"
+
+// redact hides a secret, showing only whether it is set
+func redact(secret string) string {
+	if secret == "" {
+		return "(none)"
+	}
+	return redactedSecret
+}
+
+// displayName shows a database with its label when the label tells it apart from others
+func displayName(database, label string) string {
+	if label == "" || label == database {
+		return database
+	}
+	return fmt.Sprintf("%s [%s]", database, label)
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// UseTUI reports whether the interactive terminal UI can be used: both stdin
+// and stdout must be terminals and TERM must not be "dumb"
+func UseTUI() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) &&
+		term.IsTerminal(int(os.Stdout.Fd())) &&
+		os.Getenv("TERM") != "dumb"
+}
+
+// UseColor reports whether output may be colored: NO_COLOR is not set and stdout is a
+// terminal, so logs captured by cron or systemd hold no escape codes
+func UseColor() bool {
+	return os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// DisableColor prints the plain output and the terminal UI without colors. Call it before
+// anything is printed.
+func DisableColor() {
+	colorRed, colorGreen, colorYellow, colorBlue, colorCyan, colorReset = "", "", "", "", "", ""
+	lipgloss.SetColorProfile(termenv.Ascii)
+}
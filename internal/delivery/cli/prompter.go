@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// prompter abstracts how questions are asked, so the same configuration flow
+// can run on plain line prompts or on the terminal UI
+type prompter interface {
+	// Heading announces a group of related questions
+	Heading(title string)
+
+	// Select asks for exactly one of options and returns its index
+	Select(title string, options []string) int
+
+	// MultiSelect asks for any number of options; allLabel names the "select everything" choice
+	MultiSelect(title string, options []string, allLabel string) []int
+
+	// Input asks for a value, returning defaultValue when the answer is empty
+	Input(prompt, defaultValue string) string
+
+	// Optional asks for a value that may be left empty
+	Optional(prompt string) string
+
+	// Password asks for a secret value
+	Password(prompt string) string
+
+	// Confirm asks a yes/no question
+	Confirm(prompt string) bool
+}
+
+// linePrompter asks questions with plain line-based input, for dumb terminals and pipes
+type linePrompter struct {
+	reader *bufio.Reader
+}
+
+func (p *linePrompter) Heading(title string) {
+	fmt.Printf("\n%s=== %s ===%s\n", colorBlue, title, colorReset)
+}
+
+func (p *linePrompter) Select(title string, options []string) int {
+	fmt.Printf("%s:\n", title)
+	for i, option := range options {
+		fmt.Printf("  %d. %s\n", i+1, option)
+	}
+
+	for {
+		fmt.Print(tf("\nEnter choice [1-%d]: ", len(options)))
+		choice, err := strconv.Atoi(p.readLine())
+		if err == nil && choice >= 1 && choice <= len(options) {
+			return choice - 1
+		}
+		fmt.Printf("%s%s%s\n", colorRed, tf("Invalid choice. Please enter a number between 1 and %d.", len(options)), colorReset)
+	}
+}
+
+func (p *linePrompter) MultiSelect(title string, options []string, allLabel string) []int {
+	fmt.Printf("\n%s:\n", title)
+	for i, option := range options {
+		fmt.Printf("  %d. %s\n", i+1, option)
+	}
+	fmt.Printf("  %d. %s\n", len(options)+1, allLabel)
+
+	fmt.Print(t("\nEnter choices (comma-separated, e.g., 1,2,4): "))
+	input := p.readLine()
+
+	var selected []int
+	for _, choice := range strings.Split(input, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(choice))
+		if err != nil || n < 1 || n > len(options)+1 {
+			continue
+		}
+		if n == len(options)+1 {
+			selected = selected[:0]
+			for i := range options {
+				selected = append(selected, i)
+			}
+			return selected
+		}
+		selected = append(selected, n-1)
+	}
+	return selected
+}
+
+func (p *linePrompter) Input(prompt, defaultValue string) string {
+	fmt.Printf("%s [%s]: ", prompt, defaultValue)
+	input := p.readLine()
+	if input == "" {
+		return defaultValue
+	}
+	return input
+}
+
+func (p *linePrompter) Optional(prompt string) string {
+	fmt.Printf("%s: ", prompt)
+	return p.readLine()
+}
+
+func (p *linePrompter) Password(prompt string) string {
+	fmt.Printf("%s: ", prompt)
+	
+	// Read without echo when attached to a terminal; piped input is read as a normal line
+	fd := int(os.Stdin.Fd())
+	if p.reader.Buffered() == 0 && term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Println(redactedSecret)
+		if err == nil {
+			return string(password)
+		}
+	}
+	// Spaces are part of a password, so only the line ending is dropped
+	input, _ := p.reader.ReadString('\n')
+	return strings.TrimRight(input, "\r\n")
+}
+
+func (p *linePrompter) Confirm(prompt string) bool {
+	fmt.Printf("\n%s %s: ", prompt, t("(y/n)"))
+	return isYes(p.readLine())
+}
+
+func (p *linePrompter) readLine() string {
+	input, _ := p.reader.ReadString('\n')
+	return strings.TrimSpace(input)
+}
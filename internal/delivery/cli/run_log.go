@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// RunLog passes output on to the console and also writes it, as plain text, to a log file
+// per run in <backup_dir>/logs, so a failed run can be looked into later. The file is opened
+// once the configuration is known; what was printed before is written to it then.
+type RunLog struct {
+	inner   domain.OutputService
+	secrets secrets
+
+	mu      sync.Mutex
+	pending []logLine // Lines printed before the file was opened
+	file    *os.File
+	dir     string
+	keep    int
+	runID   string
+}
+
+// logLine is a line of the log and when it was printed
+type logLine struct {
+	at   time.Time
+	text string
+}
+
+// NewRunLog wraps an output service so that each run is also logged to a file
+func NewRunLog(inner domain.OutputService) *RunLog {
+	return &RunLog{inner: inner}
+}
+
+// Close ends the log and removes the oldest logs beyond the configured number
+func (l *RunLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	l.write(logLine{at: time.Now(), text: "Run finished"})
+	err := l.file.Close()
+	l.file = nil
+
+	if pruneErr := pruneLogs(l.dir, l.keep); err == nil {
+		err = pruneErr
+	}
+	return err
+}
+
+// open starts the log file of a run, unless logging is disabled
+func (l *RunLog) open(config domain.BackupConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil || config.Logs.Disabled {
+		return
+	}
+
+	l.dir = config.Logs.Dir
+	if l.dir == "" {
+		l.dir = filepath.Join(config.BackupDir, "logs")
+	}
+	l.keep = config.Logs.Keep
+	if l.keep == 0 {
+		l.keep = domain.DefaultLogKeep
+	}
+
+	timestamp := config.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	path := filepath.Join(l.dir, timestamp.Format(domain.DefaultTimestampFormat)+".log")
+
+	err := os.MkdirAll(l.dir, 0755)
+	if err == nil {
+		l.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	}
+	if err != nil {
+		l.inner.PrintError(fmt.Sprintf("Failed to open run log: %v", err))
+		return
+	}
+	l.runID = config.RunID
+	for _, line := range l.pending {
+		l.write(line)
+	}
+	l.pending = nil
+}
+
+// logf writes a timestamped line to the log, or keeps it until the log is opened
+func (l *RunLog) logf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.add(logLine{at: time.Now(), text: fmt.Sprintf(format, args...)})
+}
+
+// add writes a line to the log, or keeps it until the log is opened. l.mu must be held.
+func (l *RunLog) add(line logLine) {
+	if l.file == nil {
+		l.pending = append(l.pending, line)
+		return
+	}
+	l.write(line)
+}
+
+// write adds a line to the open log file, tagged with the run's ID so the lines of a run can be
+// found among those of others, e.g. once collected by a log shipper
+func (l *RunLog) write(line logLine) {
+	if l.runID == "" {
+		fmt.Fprintf(l.file, "%s %s\n", line.at.Format(time.TimeOnly), line.text)
+		return
+	}
+	fmt.Fprintf(l.file, "%s [%s] %s\n", line.at.Format(time.TimeOnly), l.runID, line.text)
+}
+
+// logFailure writes a line with the command output indented under it, in one go so lines of
+// databases backed up in parallel do not end up in between
+func (l *RunLog) logFailure(output, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.add(logLine{at: now, text: fmt.Sprintf(format, args...)})
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return
+	}
+	for _, line := range strings.Split(output, "\n") {
+		l.add(logLine{at: now, text: "    " + line})
+	}
+}
+
+// PrintHeader prints the application header
+func (l *RunLog) PrintHeader() {
+	l.logf("Run started")
+	l.inner.PrintHeader()
+}
+
+// PrintConfigSummary opens the run log and prints the backup configuration summary
+func (l *RunLog) PrintConfigSummary(config domain.BackupConfig) {
+	l.open(config)
+	l.secrets.add(config.Databases...)
+	l.logf("Method %s, backup directory %s", config.Method, config.BackupDir)
+	for _, db := range config.Databases {
+		l.logf("  %s - %s (%s)", db.Type, displayName(db.Database, db.Label), location(db, config.Method))
+	}
+	l.inner.PrintConfigSummary(config)
+}
+
+// PrintEstimate prints the expected dump sizes and the free space at the destination
+func (l *RunLog) PrintEstimate(estimate domain.BackupEstimate) {
+	for _, db := range estimate.Databases {
+		if db.Error != nil {
+			l.logf("Estimate %s - %s: unknown (%v)", db.DatabaseType, displayName(db.Database, db.Label), db.Error)
+		} else {
+			l.logf("Estimate %s - %s: ~%s", db.DatabaseType, displayName(db.Database, db.Label), domain.FormatBytes(db.Bytes))
+		}
+	}
+	if estimate.FreeError == nil {
+		l.logf("Free space in %s: %s", estimate.BackupDir, domain.FormatBytes(estimate.FreeBytes))
+	}
+	l.inner.PrintEstimate(estimate)
+}
+
+// PrintBackupStart prints backup start message
+func (l *RunLog) PrintBackupStart(dbType domain.DatabaseType, config domain.DatabaseConfig, method domain.BackupMethod) {
+	l.logf("Backing up %s - %s on %s", dbType, displayName(config.Database, config.Label), location(config, method))
+	l.inner.PrintBackupStart(dbType, config, method)
+}
+
+// PrintBackupResult prints backup result
+func (l *RunLog) PrintBackupResult(result domain.BackupResult) {
+	name := displayName(result.Database, result.Label)
+	if result.Success {
+		l.logf("OK %s - %s: %s (%s) in %s", result.DatabaseType, name, result.BackupPath, sizeText(result), result.Duration)
+		for _, warning := range result.Warnings {
+			l.logf("WARNING %s - %s: %s", result.DatabaseType, name, warning)
+		}
+	} else if errors.Is(result.Error, domain.ErrInterrupted) {
+		l.logf("INTERRUPTED %s - %s: %v in %s", result.DatabaseType, name, result.Error, result.Duration)
+	} else {
+		l.logFailure(result.Stderr, "FAILED %s - %s: %v in %s", result.DatabaseType, name, result.Error, result.Duration)
+	}
+	l.inner.PrintBackupResult(result)
+}
+
+// PrintRestoreStart prints restore start message
+func (l *RunLog) PrintRestoreStart(entry domain.CatalogEntry, target domain.DatabaseConfig, method domain.BackupMethod) {
+	l.logf("Restoring %s into %s on %s", entry.Path, target.Database, location(target, method))
+	l.inner.PrintRestoreStart(entry, target, method)
+}
+
+// PrintRestoreResult prints restore result
+func (l *RunLog) PrintRestoreResult(result domain.RestoreResult) {
+	if result.Success {
+		l.logf("OK restore of %s into %s in %s", result.BackupPath, result.Database, result.Duration)
+	} else {
+		l.logFailure(result.Stderr, "FAILED restore of %s into %s: %v in %s", result.BackupPath, result.Database, result.Error, result.Duration)
+	}
+	l.logChecks(result.Checks)
+	l.inner.PrintRestoreResult(result)
+}
+
+// PrintCloneStart prints clone start message
+func (l *RunLog) PrintCloneStart(config domain.CloneConfig) {
+	l.logf("Cloning %s from %s into %s on %s", config.Source.Database, location(config.Source, config.SourceMethod),
+		config.Target.Database, location(config.Target, config.TargetMethod))
+	l.inner.PrintCloneStart(config)
+}
+
+// PrintChain prints a full backup and the differential backups that build on it
+func (l *RunLog) PrintChain(chain domain.BackupChain) {
+	l.inner.PrintChain(chain)
+}
+
+// PrintDumpSummary prints what a backup artifact holds
+func (l *RunLog) PrintDumpSummary(summary domain.DumpSummary) {
+	l.inner.PrintDumpSummary(summary)
+}
+
+// PrintDrillResult logs the outcome of a restore drill and each of its checks
+func (l *RunLog) PrintDrillResult(result domain.DrillResult) {
+	name := displayName(result.Database, result.Label)
+	if result.Error != nil {
+		l.logFailure(result.Stderr, "FAILED drill of %s - %s: %v in %s", result.DatabaseType, name, result.Error, result.Duration)
+	} else if result.Passed() {
+		l.logf("OK drill of %s - %s: %s restored and checked in %s", result.DatabaseType, name, result.BackupPath, result.Duration)
+	} else {
+		l.logf("FAILED drill of %s - %s: %s restored but checks failed in %s", result.DatabaseType, name, result.BackupPath, result.Duration)
+	}
+	l.logChecks(result.Checks)
+	l.inner.PrintDrillResult(result)
+}
+
+// logChecks logs each check of a restore with its outcome
+func (l *RunLog) logChecks(checks []domain.CheckResult) {
+	for _, check := range checks {
+		if check.Error != nil {
+			l.logf("  FAILED check %s: %v", check.Query, check.Error)
+		} else {
+			l.logf("  OK check %s: %s", check.Query, check.Result)
+		}
+	}
+}
+
+// PrintSchemaDiff prints how the tables of two dumps differ
+func (l *RunLog) PrintSchemaDiff(diff domain.SchemaDiff) {
+	l.inner.PrintSchemaDiff(diff)
+}
+
+// PrintPhase logs how long a phase of a backup took
+func (l *RunLog) PrintPhase(dbType domain.DatabaseType, label, phase string, elapsed time.Duration) {
+	l.logf("%s - %s: %s took %s", dbType, label, phase, elapsed.Round(time.Millisecond))
+	l.inner.PrintPhase(dbType, label, phase, elapsed)
+}
+
+// PrintCommand logs a command about to run with the run's passwords redacted
+func (l *RunLog) PrintCommand(where, command string) {
+	l.logf("$ %s", l.secrets.redact(where+": "+command))
+	l.inner.PrintCommand(where, command)
+}
+
+// PrintSummary prints final summary
+func (l *RunLog) PrintSummary(results []domain.BackupResult) {
+	failed, interrupted := 0, 0
+	for _, result := range results {
+		if errors.Is(result.Error, domain.ErrInterrupted) {
+			interrupted++
+		} else if !result.Success {
+			failed++
+		}
+	}
+	if interrupted > 0 {
+		l.logf("Summary: %d succeeded, %d failed, %d interrupted", len(results)-failed-interrupted, failed, interrupted)
+	} else {
+		l.logf("Summary: %d succeeded, %d failed", len(results)-failed, failed)
+	}
+	for _, result := range results {
+		name := displayName(result.Database, result.Label)
+		if result.Success {
+			l.logf("  OK %s - %s: %s (%s)", result.DatabaseType, name, result.BackupPath, result.Size)
+		} else if errors.Is(result.Error, domain.ErrInterrupted) {
+			l.logf("  INTERRUPTED %s - %s: %v", result.DatabaseType, name, result.Error)
+		} else {
+			l.logf("  FAILED %s - %s: %v", result.DatabaseType, name, result.Error)
+		}
+	}
+	l.inner.PrintSummary(results)
+}
+
+// PrintError prints an error message
+func (l *RunLog) PrintError(message string) {
+	l.logf("ERROR %s", message)
+	l.inner.PrintError(message)
+}
+
+// PrintSuccess prints a success message
+func (l *RunLog) PrintSuccess(message string) {
+	l.logf("%s", message)
+	l.inner.PrintSuccess(message)
+}
+
+// pruneLogs removes the oldest run logs in dir beyond keep
+func pruneLogs(dir string, keep int) error {
+	logs, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil || len(logs) <= keep {
+		return err
+	}
+
+	// Names are timestamps, so they sort oldest first
+	sort.Strings(logs)
+	for _, path := range logs[:len(logs)-keep] {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove old run log: %w", err)
+		}
+	}
+	return nil
+}
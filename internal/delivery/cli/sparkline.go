@@ -0,0 +1,27 @@
+package cli
+
+import "strings"
+
+// sparkBars are the eighths of a character cell a sparkline draws values with
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline draws values as a line of bars scaled from zero to the largest one, so a backup
+// half the size of the others stands out while steady growth stays flat. Values of zero or
+// less, such as durations that were not recorded, are left blank.
+func Sparkline(values []float64) string {
+	var largest float64
+	for _, value := range values {
+		largest = max(largest, value)
+	}
+
+	var b strings.Builder
+	for _, value := range values {
+		if value <= 0 {
+			b.WriteRune(' ')
+			continue
+		}
+		bar := int(value / largest * float64(len(sparkBars)-1))
+		b.WriteRune(sparkBars[bar])
+	}
+	return b.String()
+}
@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// TUIOutputService renders a live status row per database while backups run,
+// and falls back to the plain output for everything else. Rows are found by label, as
+// databases backed up in parallel start and finish in any order.
+type TUIOutputService struct {
+	OutputServiceImpl
+	databases []domain.DatabaseConfig
+	programMu sync.Mutex // Guards program, which the first of the parallel backups starts
+	program   *tea.Program
+	finished  chan struct{}
+}
+
+// NewTUIOutputService creates an output service for the interactive terminal UI. verbosity
+// applies to what is printed outside the live view, which is always shown.
+func NewTUIOutputService(verbosity Verbosity) domain.OutputService {
+	return &TUIOutputService{OutputServiceImpl: OutputServiceImpl{verbosity: verbosity}}
+}
+
+// PrintConfigSummary prints the backup configuration summary and remembers the databases to track
+func (s *TUIOutputService) PrintConfigSummary(config domain.BackupConfig) {
+	s.OutputServiceImpl.PrintConfigSummary(config)
+	s.databases = config.Databases
+}
+
+// PrintBackupStart marks the database as running, starting the live view on first use
+func (s *TUIOutputService) PrintBackupStart(dbType domain.DatabaseType, config domain.DatabaseConfig, method domain.BackupMethod) {
+	s.programMu.Lock()
+	defer s.programMu.Unlock()
+
+	if s.program == nil {
+		s.start()
+	}
+	s.program.Send(rowStartedMsg{dbType: dbType, label: config.Label})
+}
+
+// PrintBackupResult marks the database as finished
+func (s *TUIOutputService) PrintBackupResult(result domain.BackupResult) {
+	s.programMu.Lock()
+	defer s.programMu.Unlock()
+
+	if s.program == nil {
+		s.OutputServiceImpl.PrintBackupResult(result)
+		return
+	}
+	s.program.Send(rowFinishedMsg{result: result})
+	for _, warning := range result.Warnings {
+		s.program.Println(fmt.Sprintf("%s %s⚠ %s%s", resultPrefix(result.DatabaseType, result.Database, result.Label), colorYellow, warning, colorReset))
+	}
+}
+
+// PrintPhase prints how long a phase took above the live view, in verbose output
+func (s *TUIOutputService) PrintPhase(dbType domain.DatabaseType, label, phase string, elapsed time.Duration) {
+	s.programMu.Lock()
+	defer s.programMu.Unlock()
+
+	if s.program == nil {
+		s.OutputServiceImpl.PrintPhase(dbType, label, phase, elapsed)
+	} else if s.verbosity == VerbosityVerbose {
+		s.program.Println(phaseLine(dbType, label, phase, elapsed))
+	}
+}
+
+// PrintCommand prints a command about to run above the live view, in verbose output
+func (s *TUIOutputService) PrintCommand(where, command string) {
+	s.programMu.Lock()
+	defer s.programMu.Unlock()
+
+	if s.program == nil {
+		s.OutputServiceImpl.PrintCommand(where, command)
+	} else if s.verbosity == VerbosityVerbose {
+		s.program.Println(s.commandLine(where, command))
+	}
+}
+
+// PrintSummary stops the live view and prints the final summary
+func (s *TUIOutputService) PrintSummary(results []domain.BackupResult) {
+	s.programMu.Lock()
+	if s.program != nil {
+		s.program.Quit()
+		<-s.finished
+		s.program = nil
+	}
+	s.programMu.Unlock()
+	s.OutputServiceImpl.PrintSummary(results)
+}
+
+func (s *TUIOutputService) start() {
+	model := newProgressModel(s.databases)
+	s.program = tea.NewProgram(model)
+	s.finished = make(chan struct{})
+
+	go func() {
+		_, err := s.program.Run()
+		close(s.finished)
+		if errors.Is(err, tea.ErrInterrupted) {
+			os.Exit(130)
+		}
+	}()
+}
+
+type rowStartedMsg struct {
+	dbType domain.DatabaseType
+	label  string
+}
+
+type rowFinishedMsg struct{ result domain.BackupResult }
+
+type rowState int
+
+const (
+	rowPending rowState = iota
+	rowRunning
+	rowDone
+)
+
+type progressRow struct {
+	dbType  domain.DatabaseType
+	key     string // The database's label, unique in a run
+	label   string
+	state   rowState
+	started time.Time
+	result  domain.BackupResult
+}
+
+// progressModel shows one line per database with a spinner and elapsed time
+type progressModel struct {
+	rows     []progressRow
+	spinner  spinner.Model
+	stopping bool // Ctrl+C was pressed once and the run is cleaning up
+}
+
+func newProgressModel(databases []domain.DatabaseConfig) *progressModel {
+	m := &progressModel{spinner: spinner.New(spinner.WithSpinner(spinner.Dot))}
+	for _, db := range databases {
+		m.rows = append(m.rows, progressRow{
+			dbType: db.Type,
+			key:    db.Label,
+			label:  fmt.Sprintf("%-8s %s", db.Type, displayName(db.Database, db.Label)),
+		})
+	}
+	return m
+}
+
+func (m *progressModel) Init() tea.Cmd { return m.spinner.Tick }
+
+func (m *progressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case rowStartedMsg:
+		if row := m.row(msg.dbType, msg.label); row != nil {
+			row.state = rowRunning
+			row.started = time.Now()
+		}
+	case rowFinishedMsg:
+		if row := m.row(msg.result.DatabaseType, msg.result.Label); row != nil {
+			row.state = rowDone
+			row.result = msg.result
+		}
+	case tea.KeyMsg:
+		// The terminal is in raw mode, so Ctrl+C arrives as a key rather than a signal. The first
+		// one is passed on as SIGINT so the run stops and cleans up; a second exits at once, as
+		// does the first where a process cannot signal itself.
+		if msg.Type == tea.KeyCtrlC {
+			if !m.stopping && interruptSelf() == nil {
+				m.stopping = true
+				return m, nil
+			}
+			return m, tea.Interrupt
+		}
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// row returns the row of a database, or nil if it is not tracked
+func (m *progressModel) row(dbType domain.DatabaseType, label string) *progressRow {
+	for i := range m.rows {
+		if m.rows[i].dbType == dbType && m.rows[i].key == label {
+			return &m.rows[i]
+		}
+	}
+	return nil
+}
+
+func (m *progressModel) View() string {
+	var b strings.Builder
+	b.WriteString("\n")
+	for _, row := range m.rows {
+		switch row.state {
+		case rowPending:
+			b.WriteString(tuiHelpStyle.Render(fmt.Sprintf("  ○ %s  waiting", row.label)))
+		case rowRunning:
+			b.WriteString(fmt.Sprintf("  %s %s  %s", m.spinner.View(), row.label,
+				time.Since(row.started).Round(time.Second)))
+		case rowDone:
+			if row.result.Success {
+				b.WriteString(tuiSuccessStyle.Render(fmt.Sprintf("  ✓ %s  %s (%s) [%s]",
+					row.label, backupLocation(row.result), sizeText(row.result), row.result.Duration.Round(time.Millisecond))))
+			} else {
+				b.WriteString(tuiErrorStyle.Render(fmt.Sprintf("  ✗ %s  %v", row.label, row.result.Error)))
+			}
+		}
+		b.WriteString("\n")
+	}
+	if m.stopping {
+		b.WriteString(tuiHelpStyle.Render("  Stopping and cleaning up, press Ctrl+C again to exit at once"))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// interruptSelf sends SIGINT to this process
+func interruptSelf() error {
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		return err
+	}
+	return self.Signal(os.Interrupt)
+}
@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	tuiTitleStyle    = lipgloss.NewStyle().Bold(true)
+	tuiHeadingStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("4"))
+	tuiCursorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	tuiAnswerStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	tuiHelpStyle     = lipgloss.NewStyle().Faint(true)
+	tuiSuccessStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	tuiErrorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	tuiDefaultPrompt = "› "
+)
+
+// tuiPrompter asks questions with bubbletea widgets: arrow-key lists,
+// checkboxes and masked password fields
+type tuiPrompter struct{}
+
+func (p *tuiPrompter) Heading(title string) {
+	fmt.Println()
+	fmt.Println(tuiHeadingStyle.Render(title))
+}
+
+func (p *tuiPrompter) Select(title string, options []string) int {
+	m := runModel(&selectModel{title: title, options: options})
+	return m.(*selectModel).cursor
+}
+
+func (p *tuiPrompter) MultiSelect(title string, options []string, allLabel string) []int {
+	m := runModel(&selectModel{
+		title:    title,
+		options:  options,
+		multi:    true,
+		allLabel: allLabel,
+		checked:  make([]bool, len(options)),
+	}).(*selectModel)
+
+	var selected []int
+	for i, checked := range m.checked {
+		if checked {
+			selected = append(selected, i)
+		}
+	}
+	return selected
+}
+
+func (p *tuiPrompter) Input(prompt, defaultValue string) string {
+	value := runModel(newInputModel(prompt, defaultValue, false)).(*inputModel).value()
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func (p *tuiPrompter) Optional(prompt string) string {
+	return runModel(newInputModel(prompt, "", false)).(*inputModel).value()
+}
+
+func (p *tuiPrompter) Password(prompt string) string {
+	return runModel(newInputModel(prompt, "", true)).(*inputModel).value()
+}
+
+func (p *tuiPrompter) Confirm(prompt string) bool {
+	m := runModel(&selectModel{title: prompt, options: []string{t("Yes"), t("No")}, inline: true})
+	return m.(*selectModel).cursor == 0
+}
+
+// runModel runs a single-question program; Ctrl+C aborts the whole tool like it does with line prompts
+func runModel(model tea.Model) tea.Model {
+	final, err := tea.NewProgram(model).Run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if c, ok := final.(interface{ cancelled() bool }); ok && c.cancelled() {
+		os.Exit(130)
+	}
+	return final
+}
+
+// selectModel is a single- or multi-select list
+type selectModel struct {
+	title    string
+	options  []string
+	multi    bool
+	inline   bool
+	allLabel string
+	checked  []bool
+	cursor   int
+	done     bool
+	aborted  bool
+}
+
+func (m *selectModel) Init() tea.Cmd { return nil }
+
+func (m *selectModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	switch key.String() {
+	case "ctrl+c", "esc":
+		m.aborted = true
+		return m, tea.Quit
+	case "up", "k", "left", "h":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j", "right", "l", "tab":
+		if m.cursor < len(m.options)-1 {
+			m.cursor++
+		}
+	case " ", "x":
+		if m.multi {
+			m.checked[m.cursor] = !m.checked[m.cursor]
+		}
+	case "a":
+		if m.multi {
+			all := !m.allChecked()
+			for i := range m.checked {
+				m.checked[i] = all
+			}
+		}
+	case "enter":
+		if m.multi && !m.anyChecked() {
+			m.checked[m.cursor] = true
+		}
+		m.done = true
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func (m *selectModel) View() string {
+	if m.done {
+		return fmt.Sprintf("%s %s\n", tuiTitleStyle.Render(m.title), tuiAnswerStyle.Render(m.answer()))
+	}
+	if m.aborted {
+		return ""
+	}
+
+	var b strings.Builder
+	if m.inline {
+		b.WriteString(tuiTitleStyle.Render(m.title) + " ")
+		for i, option := range m.options {
+			if i == m.cursor {
+				b.WriteString(tuiCursorStyle.Render("[" + option + "]"))
+			} else {
+				b.WriteString(" " + option + " ")
+			}
+		}
+		b.WriteString("\n")
+		return b.String()
+	}
+
+	b.WriteString(tuiTitleStyle.Render(m.title) + "\n")
+	for i, option := range m.options {
+		cursor := "  "
+		if i == m.cursor {
+			cursor = tuiCursorStyle.Render(tuiDefaultPrompt)
+		}
+		if m.multi {
+			box := "[ ]"
+			if m.checked[i] {
+				box = "[x]"
+			}
+			b.WriteString(fmt.Sprintf("%s%s %s\n", cursor, box, option))
+		} else {
+			b.WriteString(fmt.Sprintf("%s%s\n", cursor, option))
+		}
+	}
+
+	help := t("↑/↓ move • enter select • esc cancel")
+	if m.multi {
+		help = tf("↑/↓ move • space toggle • a %s • enter confirm • esc cancel", strings.ToLower(m.allLabel))
+	}
+	b.WriteString(tuiHelpStyle.Render(help) + "\n")
+	return b.String()
+}
+
+func (m *selectModel) answer() string {
+	if !m.multi {
+		return strings.Fields(m.options[m.cursor])[0]
+	}
+	var names []string
+	for i, checked := range m.checked {
+		if checked {
+			names = append(names, m.options[i])
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func (m *selectModel) anyChecked() bool {
+	for _, checked := range m.checked {
+		if checked {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *selectModel) allChecked() bool {
+	for _, checked := range m.checked {
+		if !checked {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *selectModel) cancelled() bool { return m.aborted }
+
+// inputModel is a single-line text field, optionally masked
+type inputModel struct {
+	prompt  string
+	input   textinput.Model
+	masked  bool
+	done    bool
+	aborted bool
+}
+
+func newInputModel(prompt, defaultValue string, masked bool) *inputModel {
+	input := textinput.New()
+	input.Prompt = ""
+	input.Placeholder = defaultValue
+	if masked {
+		input.EchoMode = textinput.EchoPassword
+		input.EchoCharacter = '•'
+	}
+	input.Focus()
+
+	return &inputModel{prompt: prompt, input: input, masked: masked}
+}
+
+func (m *inputModel) Init() tea.Cmd { return textinput.Blink }
+
+func (m *inputModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			m.aborted = true
+			return m, tea.Quit
+		case tea.KeyEnter:
+			m.done = true
+			return m, tea.Quit
+		}
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m *inputModel) View() string {
+	if m.aborted {
+		return ""
+	}
+	if m.done {
+		answer := m.value()
+		if answer == "" {
+			answer = m.input.Placeholder
+		}
+		if m.masked {
+			answer = redact(m.value())
+		}
+		return fmt.Sprintf("%s %s\n", tuiTitleStyle.Render(m.prompt+":"), tuiAnswerStyle.Render(answer))
+	}
+	return fmt.Sprintf("%s %s\n", tuiTitleStyle.Render(m.prompt+":"), m.input.View())
+}
+
+func (m *inputModel) value() string {
+	if m.masked {
+		// Spaces are part of a password
+		return m.input.Value()
+	}
+	return strings.TrimSpace(m.input.Value())
+}
+
+func (m *inputModel) cancelled() bool { return m.aborted }
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// Verbosity selects how much the console output shows
+type Verbosity int
+
+const (
+	// VerbosityNormal shows each backup as it starts and finishes
+	VerbosityNormal Verbosity = iota
+	// VerbosityQuiet shows only errors, failed backups and the summary, e.g. for cron
+	VerbosityQuiet
+	// VerbosityVerbose also shows every command run, with passwords redacted, and how long
+	// each phase of a backup took
+	VerbosityVerbose
+)
+
+// secrets collects the passwords of the databases in a run, so the commands shown do not
+// reveal them
+type secrets struct {
+	mu     sync.Mutex
+	values []string
+}
+
+// add remembers the password of each database, and the one in its uri, as written in a
+// command line: as is, quoted for sh and escaped for a URI
+func (s *secrets) add(databases ...domain.DatabaseConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, db := range databases {
+		for _, secret := range []string{db.Password, uriPassword(db.URI)} {
+			if secret != "" {
+				s.values = append(s.values, domain.SecretForms(secret)...)
+			}
+		}
+	}
+}
+
+// uriPassword returns the password in the userinfo of a connection URI, or "" if it has none
+func uriPassword(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.User == nil {
+		return ""
+	}
+	password, _ := u.User.Password()
+	return password
+}
+
+// redact replaces the remembered passwords in text
+func (s *secrets) redact(text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, value := range s.values {
+		text = strings.ReplaceAll(text, value, redactedSecret)
+	}
+	return text
+}
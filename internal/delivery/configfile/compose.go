@@ -0,0 +1,236 @@
+package configfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// composeFile is the part of a docker-compose.yml needed to find databases
+type composeFile struct {
+	Name     string                    `yaml:"name"`
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Image         string    `yaml:"image"`
+	ContainerName string    `yaml:"container_name"`
+	Environment   yaml.Node `yaml:"environment"` // Mapping or list of KEY=VALUE
+	EnvFile       yaml.Node `yaml:"env_file"`    // Path, list of paths or list of {path, required}
+}
+
+// envFile is one env_file entry; files are required unless marked otherwise
+type envFile struct {
+	Path     string `yaml:"path"`
+	Required *bool  `yaml:"required"`
+}
+
+// composeVariable matches $$, $VAR, ${VAR}, ${VAR:-default} and ${VAR-default}
+var composeVariable = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?-)([^}]*))?\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// DiscoverCompose lists the database services of a Docker Compose file, recognised by their
+// image, with the container name, version and the credentials from their environment
+func DiscoverCompose(path string) ([]domain.DiscoveredDatabase, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+
+	var file composeFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("invalid compose file %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	variables, err := readEnvFile(filepath.Join(dir, ".env"), false)
+	if err != nil {
+		return nil, err
+	}
+	lookup := func(name string) (string, bool) {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+		value, ok := variables[name]
+		return value, ok
+	}
+
+	project := interpolate(file.Name, lookup)
+	if project == "" {
+		project = os.Getenv("COMPOSE_PROJECT_NAME")
+	}
+	if project == "" {
+		absolute, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		project = filepath.Base(absolute)
+	}
+	project = projectName(project)
+
+	names := make([]string, 0, len(file.Services))
+	for name := range file.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var found []domain.DiscoveredDatabase
+	for _, name := range names {
+		service := file.Services[name]
+		image := interpolate(service.Image, lookup)
+		dbType, version, ok := domain.ImageDatabase(image)
+		if !ok {
+			continue
+		}
+
+		env, err := serviceEnvironment(service, dir, lookup)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+
+		config := domain.CredentialsFromEnv(dbType, env)
+		config.Host = name
+		config.Version = version
+		config.Container = interpolate(service.ContainerName, lookup)
+		if config.Container == "" {
+			config.Container = fmt.Sprintf("%s-%s-1", project, name)
+		}
+
+		found = append(found, domain.DiscoveredDatabase{Service: name, Image: image, Config: config})
+	}
+
+	return found, nil
+}
+
+// serviceEnvironment merges a service's env_file entries and environment, which wins
+func serviceEnvironment(service composeService, dir string, lookup func(string) (string, bool)) (map[string]string, error) {
+	env := make(map[string]string)
+
+	var files []envFile
+	switch service.EnvFile.Kind {
+	case yaml.ScalarNode:
+		files = append(files, envFile{Path: service.EnvFile.Value})
+	case yaml.SequenceNode:
+		for _, item := range service.EnvFile.Content {
+			file := envFile{Path: item.Value}
+			if item.Kind != yaml.ScalarNode {
+				if err := item.Decode(&file); err != nil {
+					return nil, fmt.Errorf("invalid env_file: %w", err)
+				}
+			}
+			files = append(files, file)
+		}
+	}
+	for _, file := range files {
+		path := interpolate(file.Path, lookup)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		values, err := readEnvFile(path, file.Required == nil || *file.Required)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			env[key] = value
+		}
+	}
+
+	switch service.Environment.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(service.Environment.Content); i += 2 {
+			key, value := service.Environment.Content[i].Value, service.Environment.Content[i+1]
+			if value.Tag == "!!null" {
+				env[key], _ = lookup(key)
+				continue
+			}
+			env[key] = interpolate(value.Value, lookup)
+		}
+	case yaml.SequenceNode:
+		for _, item := range service.Environment.Content {
+			key, value, ok := strings.Cut(item.Value, "=")
+			if !ok {
+				// A bare name passes the variable through from the shell
+				env[key], _ = lookup(key)
+				continue
+			}
+			env[key] = interpolate(value, lookup)
+		}
+	}
+
+	return env, nil
+}
+
+// readEnvFile reads KEY=VALUE lines; a missing file is an error only if required
+func readEnvFile(path string, required bool) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, scanner.Err()
+}
+
+// interpolate expands variables the way compose does; unset variables become empty
+func interpolate(s string, lookup func(string) (string, bool)) string {
+	return composeVariable.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+		groups := composeVariable.FindStringSubmatch(match)
+		if groups[4] != "" {
+			value, _ := lookup(groups[4])
+			return value
+		}
+		value, set := lookup(groups[1])
+		switch groups[2] {
+		case ":-":
+			if value == "" {
+				return groups[3]
+			}
+		case "-":
+			if !set {
+				return groups[3]
+			}
+		}
+		return value
+	})
+}
+
+// projectName normalises a project name the way compose does for container names
+func projectName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
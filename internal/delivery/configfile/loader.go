@@ -0,0 +1,1674 @@
+package configfile
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// File is the on-disk representation of a backup configuration
+type File struct {
+	Version     int               `yaml:"version,omitempty"` // Format version, see CurrentVersion
+	Method      string            `yaml:"method"`
+	BackupDir   string            `yaml:"backup_dir,omitempty"`
+	TempDir     string            `yaml:"temp_dir,omitempty"`
+	Dedup       bool              `yaml:"dedup,omitempty"`    // Store backups as shared chunks
+	Parallel    int               `yaml:"parallel,omitempty"` // Databases backed up at once
+	Uploads     *UploadsBlock     `yaml:"uploads,omitempty"`  // Copies of finished backups to stores
+	Kubernetes  *KubernetesBlock  `yaml:"kubernetes,omitempty"`
+	Limits      *LimitsBlock      `yaml:"limits,omitempty"`
+	Compression *CompressionBlock `yaml:"compression,omitempty"`
+	Naming      *NamingBlock      `yaml:"naming,omitempty"`
+	Logs        *LogsBlock        `yaml:"logs,omitempty"`
+	Heartbeat   *HeartbeatBlock   `yaml:"heartbeat,omitempty"`
+	Stores      []string          `yaml:"stores,omitempty"`     // Stores finished backups are copied to
+	PartSize    string            `yaml:"part_size,omitempty"`  // e.g. 5G; larger backups are copied to stores in parts
+	S3Stores    []S3StoreBlock    `yaml:"s3_stores,omitempty"`  // Built-in S3 stores, named in stores
+	StreamTo    string            `yaml:"stream_to,omitempty"`  // S3 store SQL dumps are streamed to instead of the backup directory
+	LocalKeep   int               `yaml:"local_keep,omitempty"` // Newest backups per database kept on disk; older ones are only kept in the stores
+	Signing     *SigningBlock     `yaml:"signing,omitempty"`
+	Encryption  *EncryptionBlock  `yaml:"encryption,omitempty"`
+	Tenants     []TenantBlock     `yaml:"tenants,omitempty"` // Customers whose backups are kept apart
+	MaxAge      string            `yaml:"max_age,omitempty"` // e.g. 26h or 2d; status fails for databases with no backup this recent
+	Alerts      *AlertsBlock      `yaml:"alerts,omitempty"`
+	Anomalies   *AnomaliesBlock   `yaml:"anomalies,omitempty"`
+	Databases   []DatabaseBlock   `yaml:"databases"`
+}
+
+// TenantBlock groups the databases of one customer, whose backups go to a directory of its
+// own and use its stores and KMS key
+type TenantBlock struct {
+	Name       string           `yaml:"name"`
+	BackupDir  string           `yaml:"backup_dir"`           // Not shared with the deployment or any other tenant
+	Stores     *[]string        `yaml:"stores,omitempty"`     // Instead of the top-level stores; [] keeps the backups local
+	Encryption *EncryptionBlock `yaml:"encryption,omitempty"` // Instead of the top-level encryption
+	Keep       int              `yaml:"keep,omitempty"`       // Newest backups per database prune -config keeps
+	Databases  []DatabaseBlock  `yaml:"databases"`
+}
+
+func (b *TenantBlock) toTenant() domain.Tenant {
+	tenant := domain.Tenant{Name: b.Name, BackupDir: b.BackupDir, Stores: storeNames(b.Stores), Keep: b.Keep}
+	if b.Encryption != nil {
+		encryption := b.Encryption.toEncryption()
+		tenant.Encryption = &encryption
+	}
+	return tenant
+}
+
+// databaseEntry is a database block, where it is in the file and the tenant it belongs to
+type databaseEntry struct {
+	path   string
+	tenant *TenantBlock
+	block  DatabaseBlock
+}
+
+// databaseEntries lists the databases of the file, those of the deployment first and then
+// those of each tenant
+func (f *File) databaseEntries() []databaseEntry {
+	var entries []databaseEntry
+	for i, db := range f.Databases {
+		entries = append(entries, databaseEntry{path: fmt.Sprintf("databases[%d]", i), block: db})
+	}
+	for i := range f.Tenants {
+		tenant := &f.Tenants[i]
+		for j, db := range tenant.Databases {
+			entries = append(entries, databaseEntry{path: fmt.Sprintf("tenants[%d].databases[%d]", i, j), tenant: tenant, block: db})
+		}
+	}
+	return entries
+}
+
+// EncryptionBlock encrypts every backup with a data key of its own, wrapped with a KMS key
+type EncryptionBlock struct {
+	Provider string `yaml:"provider"`          // aws, gcp or vault
+	Key      string `yaml:"key"`               // Key ID, ARN or alias; CryptoKey resource name; transit key name
+	Region   string `yaml:"region,omitempty"`  // aws only
+	Address  string `yaml:"address,omitempty"` // vault only; default VAULT_ADDR
+	Mount    string `yaml:"mount,omitempty"`   // vault only; default transit
+}
+
+func (b *EncryptionBlock) toEncryption() domain.Encryption {
+	return domain.Encryption{Provider: b.Provider, Key: b.Key, Region: b.Region, Address: b.Address, Mount: b.Mount}
+}
+
+// SigningBlock signs every backup with an Ed25519 key and makes restores verify it
+type SigningBlock struct {
+	Key       string `yaml:"key,omitempty"`        // PEM private key; hosts that only restore can leave it out
+	PublicKey string `yaml:"public_key,omitempty"` // PEM public key restores verify with; default the one of key
+}
+
+// S3StoreBlock declares a store that copies backups to an S3 bucket
+type S3StoreBlock struct {
+	Name        string           `yaml:"name"`
+	Bucket      string           `yaml:"bucket"`
+	Prefix      string           `yaml:"prefix,omitempty"`
+	Region      string           `yaml:"region,omitempty"`
+	Endpoint    string           `yaml:"endpoint,omitempty"`    // S3-compatible services such as MinIO
+	Concurrency int              `yaml:"concurrency,omitempty"` // Parts of a file uploaded at once; default 5
+	ObjectLock  *ObjectLockBlock `yaml:"object_lock,omitempty"`
+
+	StorageClass string          `yaml:"storage_class,omitempty"` // e.g. GLACIER or DEEP_ARCHIVE for the backups; default STANDARD
+	Retrieval    *RetrievalBlock `yaml:"retrieval,omitempty"`     // How backups in GLACIER or DEEP_ARCHIVE are retrieved for restores
+}
+
+// RetrievalBlock says how copies archived in Glacier are brought back for restores
+type RetrievalBlock struct {
+	Tier string `yaml:"tier,omitempty"` // expedited, standard (default) or bulk
+	Days int    `yaml:"days,omitempty"` // How long the retrieved copy stays; default 1
+}
+
+// ObjectLockBlock locks every uploaded object for retain, in a bucket with Object Lock enabled
+type ObjectLockBlock struct {
+	Mode   string `yaml:"mode"`   // compliance or governance
+	Retain string `yaml:"retain"` // e.g. 30d or 720h
+}
+
+// LogsBlock controls the log file kept for each run
+type LogsBlock struct {
+	Dir      string `yaml:"dir,omitempty"`      // Default <backup_dir>/logs
+	Keep     int    `yaml:"keep,omitempty"`     // Newest run logs kept, default 30
+	Disabled bool   `yaml:"disabled,omitempty"` // Only print to the console
+}
+
+// HeartbeatBlock points at a dead man's switch that is pinged when a run starts, succeeds
+// and fails. The ping URLs follow from url and provider; the *_url keys override them.
+type HeartbeatBlock struct {
+	URL        string `yaml:"url,omitempty"`
+	Provider   string `yaml:"provider,omitempty"` // healthchecks (default) or cronitor
+	StartURL   string `yaml:"start_url,omitempty"`
+	SuccessURL string `yaml:"success_url,omitempty"`
+	FailureURL string `yaml:"failure_url,omitempty"`
+}
+
+// AlertsBlock has serve report databases whose newest backup is older than their max_age or
+// smaller than their min_size, and again once they recover
+type AlertsBlock struct {
+	URL      string `yaml:"url"`                // POSTed a plain text message, e.g. https://ntfy.sh/<topic>
+	Interval string `yaml:"interval,omitempty"` // How often the expectations are checked, default 5m
+}
+
+// AnomaliesBlock sets when a new backup is flagged with a warning for straying from the
+// previous ones of its database
+type AnomaliesBlock struct {
+	SizeDrop string `yaml:"size_drop,omitempty"` // e.g. 50% for half the average size, default 50%; off turns the check off
+	Slowdown string `yaml:"slowdown,omitempty"`  // e.g. 3x for three times the median duration, the default; off turns the check off
+}
+
+// NamingBlock controls how backup files are named
+type NamingBlock struct {
+	Template        string `yaml:"template,omitempty"`         // e.g. "{{.Database}}-{{.Timestamp}}.sql.gz"
+	TimestampFormat string `yaml:"timestamp_format,omitempty"` // Go time layout
+	Timezone        string `yaml:"timezone,omitempty"`         // UTC, Local or an IANA name
+	Environment     string `yaml:"environment,omitempty"`      // Available as {{.Environment}}
+}
+
+// LimitsBlock throttles backups so they don't starve the database host
+type LimitsBlock struct {
+	Rate    string  `yaml:"rate,omitempty"`     // Dump throughput per second, e.g. 20M
+	Nice    int     `yaml:"nice,omitempty"`     // 1-19
+	IONice  string  `yaml:"ionice,omitempty"`   // idle or best-effort
+	CPUs    float64 `yaml:"cpus,omitempty"`     // docker-run only
+	Memory  string  `yaml:"memory,omitempty"`   // docker-run only, e.g. 512M
+	MinFree string  `yaml:"min_free,omitempty"` // Free space kept in the backup directory, e.g. 10G
+}
+
+// CompressionBlock picks the tool that compresses backups on the host and how many threads it uses
+type CompressionBlock struct {
+	Tool    string `yaml:"tool,omitempty"`    // gzip (default), pigz, or zstd, which names backups .zst instead of .gz
+	Threads int    `yaml:"threads,omitempty"` // pigz and zstd only; default one per CPU
+}
+
+// UploadsBlock tunes the copies of finished backups to stores, which run while the next
+// databases are backed up
+type UploadsBlock struct {
+	Parallel int `yaml:"parallel,omitempty"` // Backups copied at once; default as many as parallel
+	Queue    int `yaml:"queue,omitempty"`    // Finished backups waiting for their copies before dumps wait; default 4
+}
+
+// MySQLDumpBlock tunes mysqldump for MySQL and MariaDB databases
+type MySQLDumpBlock struct {
+	SingleTransaction bool   `yaml:"single_transaction,omitempty"`
+	Routines          bool   `yaml:"routines,omitempty"`
+	Events            bool   `yaml:"events,omitempty"`
+	Triggers          *bool  `yaml:"triggers,omitempty"`        // Included unless set to false
+	SetGTIDPurged     string `yaml:"set_gtid_purged,omitempty"` // OFF, ON, AUTO or COMMENTED; MySQL only
+}
+
+// SnapshotBlock makes a database entry take a CSI VolumeSnapshot instead of a dump
+type SnapshotBlock struct {
+	PVC   string `yaml:"pvc,omitempty"`   // Empty uses the only claim the pod mounts
+	Class string `yaml:"class,omitempty"` // VolumeSnapshotClass; empty uses the default
+}
+
+// HostSnapshotBlock makes a database entry archive a ZFS or LVM snapshot of its data volume
+type HostSnapshotBlock struct {
+	Type   string `yaml:"type"`           // zfs or lvm
+	Volume string `yaml:"volume"`         // ZFS dataset or LVM volume as vg/lv
+	Path   string `yaml:"path,omitempty"` // Data directory within the volume
+	Size   string `yaml:"size,omitempty"` // LVM snapshot space, e.g. 5G
+}
+
+// CertsBlock names the client certificates of a CockroachDB or YugabyteDB entry
+type CertsBlock struct {
+	CA   string `yaml:"ca,omitempty"`   // Root certificate; empty encrypts without verifying the server
+	Cert string `yaml:"cert,omitempty"` // Client certificate; empty authenticates with the password
+	Key  string `yaml:"key,omitempty"`
+	Mode string `yaml:"mode,omitempty"` // require, verify-ca or verify-full; empty verifies fully with ca
+}
+
+// ManagedBlock marks a database entry as run by a cloud provider
+type ManagedBlock struct {
+	Provider string `yaml:"provider"`           // rds, cloudsql or atlas
+	IAMAuth  bool   `yaml:"iam_auth,omitempty"` // rds and cloudsql: log in with a token from the aws or gcloud CLI
+	Region   string `yaml:"region,omitempty"`   // rds only; empty uses the aws CLI's region
+}
+
+// RDSSnapshotBlock makes a managed RDS entry take a native snapshot instead of a dump
+type RDSSnapshotBlock struct {
+	Instance string          `yaml:"instance,omitempty"` // DB instance identifier
+	Cluster  string          `yaml:"cluster,omitempty"`  // Aurora cluster identifier, instead of instance
+	Export   *RDSExportBlock `yaml:"export,omitempty"`
+}
+
+// RDSExportBlock exports each RDS snapshot to S3 once it is available
+type RDSExportBlock struct {
+	Bucket string `yaml:"bucket"`
+	Prefix string `yaml:"prefix,omitempty"`
+	Role   string `yaml:"role"`    // ARN of the IAM role RDS writes to the bucket as
+	KMSKey string `yaml:"kms_key"` // ARN of the KMS key encrypting the export
+}
+
+// Neo4jBlock selects how a Neo4j database is backed up
+type Neo4jBlock struct {
+	Strategy   string `yaml:"strategy,omitempty"`    // online (default), stop-database or stop-container
+	BackupPort int    `yaml:"backup_port,omitempty"` // Online backups; default 6362
+}
+
+// KubernetesBlock holds the run-wide cluster settings for kubectl-exec
+type KubernetesBlock struct {
+	Namespace  string `yaml:"namespace,omitempty"`
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+	Context    string `yaml:"context,omitempty"`
+}
+
+// DatabaseBlock describes one database entry
+type DatabaseBlock struct {
+	Label        string             `yaml:"label,omitempty"`
+	Type         string             `yaml:"type"`
+	Tags         domain.Tags        `yaml:"tags,omitempty"`
+	Host         string             `yaml:"host,omitempty"`
+	Port         int                `yaml:"port,omitempty"`
+	User         string             `yaml:"user,omitempty"`
+	Password     string             `yaml:"password,omitempty"`
+	Database     string             `yaml:"database"`
+	Version      string             `yaml:"version,omitempty"`
+	Container    string             `yaml:"container,omitempty"`
+	Pod          string             `yaml:"pod,omitempty"`
+	Kubeconfig   string             `yaml:"kubeconfig,omitempty"`
+	KubeContext  string             `yaml:"kube_context,omitempty"`
+	SSHHost      string             `yaml:"ssh_host,omitempty"` // [user@]host[:port]
+	SSHKey       string             `yaml:"ssh_key,omitempty"`
+	AuthDB       string             `yaml:"auth_database,omitempty"`
+	URI          string             `yaml:"uri,omitempty"`
+	TLS          bool               `yaml:"tls,omitempty"`
+	Oplog        bool               `yaml:"oplog,omitempty"`
+	Archive      bool               `yaml:"archive,omitempty"`
+	Differential bool               `yaml:"differential,omitempty"`
+	FullEvery    string             `yaml:"full_every,omitempty"` // e.g. 7d or 72h
+	MySQLDump    *MySQLDumpBlock    `yaml:"mysqldump,omitempty"`
+	Physical     bool               `yaml:"physical,omitempty"`
+	Snapshot     *SnapshotBlock     `yaml:"snapshot,omitempty"`
+	HostSnapshot *HostSnapshotBlock `yaml:"host_snapshot,omitempty"`
+	Globals      bool               `yaml:"globals,omitempty"`
+	Certs        *CertsBlock        `yaml:"certs,omitempty"`
+	Managed      *ManagedBlock      `yaml:"managed,omitempty"`
+	RDSSnapshot  *RDSSnapshotBlock  `yaml:"rds_snapshot,omitempty"`
+	Checks       []CheckBlock       `yaml:"checks,omitempty"`
+	Neo4j        *Neo4jBlock        `yaml:"neo4j,omitempty"`
+	Mode         string             `yaml:"mode,omitempty"` // full, schema-only or data-only
+	Masking      []MaskingBlock     `yaml:"masking,omitempty"`
+	Compress     bool               `yaml:"compress_in_container,omitempty"` // gzip SQL dumps before they leave the container or pod
+	Limits       *LimitsBlock       `yaml:"limits,omitempty"`
+	Compression  *CompressionBlock  `yaml:"compression,omitempty"` // Instead of the top-level compression
+	BackupDir    string             `yaml:"backup_dir,omitempty"`  // Instead of the top-level backup_dir
+	Stores       *[]string          `yaml:"stores,omitempty"`      // Instead of the top-level stores; [] keeps the backups local
+	PartSize     string             `yaml:"part_size,omitempty"`   // Instead of the top-level part_size
+	StreamTo     string             `yaml:"stream_to,omitempty"`   // Instead of the top-level stream_to
+	LocalKeep    int                `yaml:"local_keep,omitempty"`  // Instead of the top-level local_keep
+	TempDir      string             `yaml:"temp_dir,omitempty"`    // Instead of the top-level temp_dir, inside the container or pod
+	MaxAge       string             `yaml:"max_age,omitempty"`     // Instead of the top-level max_age
+	MinSize      string             `yaml:"min_size,omitempty"`    // e.g. 100M; smaller backups fail status and raise alerts
+	Anomalies    *AnomaliesBlock    `yaml:"anomalies,omitempty"`   // Instead of the top-level anomalies
+}
+
+// MaskingBlock describes one masking rule: either table and column, or pattern
+type MaskingBlock struct {
+	Table       string `yaml:"table,omitempty"`
+	Column      string `yaml:"column,omitempty"`
+	Pattern     string `yaml:"pattern,omitempty"`
+	Replacement string `yaml:"replacement"`
+}
+
+// CheckBlock is a query run against the database once a drill restored it
+type CheckBlock struct {
+	Query  string `yaml:"query"`            // SQL, or a mongosh expression for MongoDB
+	Expect string `yaml:"expect,omitempty"` // e.g. "> 0" or "= active"; empty only needs the query to succeed
+}
+
+// Load reads, renders and validates a config file
+func Load(path string) (domain.BackupConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return domain.BackupConfig{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	return Parse(filepath.Base(path), content)
+}
+
+// Parse renders template expressions in content and converts it into a BackupConfig
+func Parse(name string, content []byte) (domain.BackupConfig, error) {
+	rendered, err := render(name, content)
+	if err != nil {
+		return domain.BackupConfig{}, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(rendered, &doc); err != nil {
+		return domain.BackupConfig{}, fmt.Errorf("invalid config file: %w", err)
+	}
+
+	// Older files are upgraded in memory; the migrated nodes keep their original line numbers
+	if _, err := migrate(&doc); err != nil {
+		return domain.BackupConfig{}, fmt.Errorf("invalid config file: %w", err)
+	}
+	if problems := checkKeys(&doc, reflect.TypeOf(File{}), "", make(map[string]int)); len(problems) > 0 {
+		return domain.BackupConfig{}, fmt.Errorf("invalid config file: line %d: %w", problems[0].Line, problems[0])
+	}
+
+	var file File
+	if doc.Kind != 0 {
+		if err := doc.Decode(&file); err != nil {
+			return domain.BackupConfig{}, fmt.Errorf("invalid config file: %w", err)
+		}
+	}
+
+	if err := file.Validate(); err != nil {
+		return domain.BackupConfig{}, err
+	}
+
+	return file.ToBackupConfig(), nil
+}
+
+// Validate checks that the file describes a runnable backup, reporting the first problem found
+func (f *File) Validate() error {
+	if problems := f.problems(); len(problems) > 0 {
+		return problems[0]
+	}
+	return nil
+}
+
+// problems lists everything that keeps the file from describing a runnable backup
+func (f *File) problems() []Problem {
+	var problems []Problem
+	add := func(path, format string, args ...interface{}) {
+		problems = append(problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	method := domain.BackupMethod(f.Method)
+	if !method.IsValid() {
+		add("method", "invalid method %q", f.Method)
+	}
+
+	if len(f.databaseEntries()) == 0 {
+		add("databases", "no databases configured")
+	}
+
+	if _, err := f.Limits.toLimits(); err != nil {
+		add("limits", "%v", err)
+	}
+	if err := f.Compression.toCompression().Validate(); err != nil {
+		add("compression", "%v", err)
+	}
+
+	if f.Naming != nil {
+		if err := f.Naming.check(); err != nil {
+			add("naming", "%v", err)
+		}
+	}
+
+	if f.Parallel < 0 {
+		add("parallel", "parallel must not be negative")
+	}
+	if f.Uploads != nil {
+		if f.Uploads.Parallel < 0 {
+			add("uploads.parallel", "parallel must not be negative")
+		}
+		if f.Uploads.Queue < 0 {
+			add("uploads.queue", "queue must not be negative")
+		}
+	}
+	if _, err := parseDays("max_age", f.MaxAge); err != nil {
+		add("max_age", "%v", err)
+	}
+	if _, err := f.Alerts.toAlerts(); err != nil {
+		add("alerts", "%v", err)
+	}
+	if _, err := f.Anomalies.toAnomalies(); err != nil {
+		add("anomalies", "%v", err)
+	}
+
+	if f.Logs != nil && f.Logs.Keep < 0 {
+		add("logs.keep", "keep must not be negative")
+	}
+
+	if _, err := f.Heartbeat.toURLs(); err != nil {
+		add("heartbeat", "%v", err)
+	}
+
+	if f.Signing != nil && f.Signing.Key == "" && f.Signing.PublicKey == "" {
+		add("signing", "signing needs a key or a public_key")
+	}
+
+	if f.Encryption != nil {
+		if err := f.Encryption.toEncryption().Validate(); err != nil {
+			add("encryption", "%v", err)
+		}
+		// Chunks are shared between backups, so they could only be stored in plain
+		if f.Dedup {
+			add("dedup", "dedup cannot be combined with encryption")
+		}
+	}
+
+	declared := make(map[string]int)
+	for i, store := range f.S3Stores {
+		path := fmt.Sprintf("s3_stores[%d]", i)
+		if j, ok := declared[store.Name]; ok && store.Name != "" {
+			add(path+".name", "name %q is already used by s3_stores[%d]", store.Name, j)
+		}
+		declared[store.Name] = i
+		if _, err := parseRetain(store.ObjectLock); err != nil {
+			add(path+".object_lock.retain", "%v", err)
+		} else if err := store.toConfig().Validate(); err != nil {
+			add(path, "%v", err)
+		}
+	}
+	knownStore := func(name string) bool {
+		_, ok := declared[name]
+		_, err := domain.LookupStore(name)
+		return ok || err == nil
+	}
+
+	for i, name := range f.Stores {
+		if !knownStore(name) {
+			add(fmt.Sprintf("stores[%d]", i), "no store named %q is declared in s3_stores or installed as a plugin", name)
+		}
+	}
+	if _, err := parsePartSize(f.PartSize); err != nil {
+		add("part_size", "%v", err)
+	}
+	// Only the built-in S3 stores take a dump as it is made; plugins are handed finished files
+	streamStore := func(path, name string) {
+		if _, ok := declared[name]; !ok {
+			add(path, "no store named %q is declared in s3_stores; dumps can only be streamed to S3 stores", name)
+		}
+	}
+	if f.StreamTo != "" {
+		streamStore("stream_to", f.StreamTo)
+	}
+	if f.LocalKeep < 0 {
+		add("local_keep", "local_keep must not be negative")
+	}
+
+	// Every tenant's backups go to a directory nothing else writes to
+	dirs := map[string]string{filepath.Clean(valueOrDefault(f.BackupDir, "backup")): "backup_dir"}
+	for i, db := range f.Databases {
+		if db.BackupDir != "" {
+			dirs[filepath.Clean(db.BackupDir)] = fmt.Sprintf("databases[%d].backup_dir", i)
+		}
+	}
+	tenants := make(map[string]int)
+	for i, tenant := range f.Tenants {
+		path := fmt.Sprintf("tenants[%d]", i)
+		if err := tenant.toTenant().Validate(); err != nil {
+			add(path, "%v", err)
+		}
+		if j, ok := tenants[tenant.Name]; ok && tenant.Name != "" {
+			add(path+".name", "name %q is already used by tenants[%d]", tenant.Name, j)
+		}
+		tenants[tenant.Name] = i
+		if other, ok := dirs[filepath.Clean(tenant.BackupDir)]; ok && tenant.BackupDir != "" {
+			add(path+".backup_dir", "backup_dir %q is already used by %s", tenant.BackupDir, other)
+		}
+		dirs[filepath.Clean(tenant.BackupDir)] = path + ".backup_dir"
+		if len(tenant.Databases) == 0 {
+			add(path+".databases", "no databases configured")
+		}
+		if tenant.Stores != nil {
+			for j, name := range *tenant.Stores {
+				if !knownStore(name) {
+					add(fmt.Sprintf("%s.stores[%d]", path, j), "no store named %q is declared in s3_stores or installed as a plugin", name)
+				}
+			}
+		}
+		if tenant.Encryption != nil {
+			if err := tenant.Encryption.toEncryption().Validate(); err != nil {
+				add(path+".encryption", "%v", err)
+			} else if f.Dedup {
+				add(path+".encryption", "dedup cannot be combined with encryption")
+			}
+		}
+	}
+
+	labels := make(map[string]string)
+	for _, entry := range f.databaseEntries() {
+		path, db := entry.path, entry.block
+		// Labels only have to be unique within a tenant, whose backups are kept apart
+		if db.Label != "" {
+			scope := ""
+			if entry.tenant != nil {
+				scope = entry.tenant.Name
+			}
+			if other, ok := labels[scope+"\x00"+db.Label]; ok {
+				add(path+".label", "label %q is already used by %s", db.Label, other)
+			} else {
+				labels[scope+"\x00"+db.Label] = path
+			}
+		}
+		if entry.tenant != nil && db.BackupDir != "" {
+			add(path+".backup_dir", "the backups of a tenant's databases go to the tenant's backup_dir")
+		}
+		if !domain.DatabaseType(db.Type).IsValid() {
+			add(path+".type", "invalid type %q", db.Type)
+		}
+		if db.Database == "" && !domain.DatabaseType(db.Type).ReachedOverAPI() {
+			add(path, "database is required")
+		}
+		if err := db.Tags.Validate(); err != nil {
+			add(path+".tags", "%v", err)
+		}
+		if db.Stores != nil {
+			for j, name := range *db.Stores {
+				if !knownStore(name) {
+					add(fmt.Sprintf("%s.stores[%d]", path, j), "no store named %q is declared in s3_stores or installed as a plugin", name)
+				}
+			}
+		}
+		if _, err := parsePartSize(db.PartSize); err != nil {
+			add(path+".part_size", "%v", err)
+		}
+		if db.StreamTo != "" {
+			streamStore(path+".stream_to", db.StreamTo)
+		}
+		// Backups moved off the disk have to be kept somewhere
+		switch stores := f.Stores; {
+		case db.LocalKeep < 0:
+			add(path+".local_keep", "local_keep must not be negative")
+		case db.LocalKeep > 0 || f.LocalKeep > 0:
+			if db.Stores != nil {
+				stores = *db.Stores
+			} else if entry.tenant != nil && entry.tenant.Stores != nil {
+				stores = *entry.tenant.Stores
+			}
+			if len(stores) == 0 {
+				add(path, "local_keep needs stores to keep the backups it moves off the disk")
+			}
+		}
+		if streamTo := valueOrDefault(db.StreamTo, f.StreamTo); streamTo != "" {
+			stream := domain.DatabaseConfig{
+				Type:         domain.DatabaseType(db.Type),
+				Physical:     db.Physical,
+				Snapshot:     db.Snapshot.toOptions(),
+				HostSnapshot: db.HostSnapshot.toOptions(),
+				RDSSnapshot:  db.RDSSnapshot.toOptions(),
+			}
+			if f.Encryption != nil || entry.tenant != nil && entry.tenant.Encryption != nil {
+				stream.Encryption = &domain.Encryption{}
+			}
+			switch err := stream.CheckStream(); {
+			case err != nil:
+				add(path, "cannot stream to store %s: %v", streamTo, err)
+			case f.Signing != nil:
+				// Signatures are made over the finished file
+				add(path, "cannot stream to store %s: signed backups cannot be streamed", streamTo)
+			}
+		}
+		// The directory is inside the container, pod or machine, where a relative path has no clear base
+		if db.TempDir != "" && !strings.HasPrefix(db.TempDir, "/") {
+			add(path+".temp_dir", "temp_dir must be an absolute path in the container, pod or machine")
+		}
+		if domain.DatabaseType(db.Type).ReachedOverAPI() {
+			// Reached over its API whatever the method, so no container or pod is needed
+			if db.Host == "" {
+				add(path, "host is required for %s", db.Type)
+			}
+		} else {
+			if method == domain.BackupMethodDockerExec && db.Container == "" {
+				add(path, "container is required for %s", method)
+			}
+			if method == domain.BackupMethodKubectlExec && db.Pod == "" {
+				add(path, "pod is required for %s", method)
+			}
+			if method == domain.BackupMethodSSH {
+				if !domain.DatabaseType(db.Type).BackedUpOverSSH() {
+					add(path, "%s is not supported for %s", method, db.Type)
+				} else if db.SSHHost == "" {
+					add(path, "ssh_host is required for %s", method)
+				}
+			}
+			if method == domain.BackupMethodDockerRun && ((db.Host == "" && db.URI == "") || db.Version == "") {
+				add(path, "host and version are required for %s", method)
+			}
+		}
+		if domain.DatabaseType(db.Type) != domain.DatabaseTypeMongoDB && (db.AuthDB != "" || db.URI != "" || db.TLS || db.Oplog || db.Archive) {
+			add(path, "auth_database, uri, tls, oplog and archive are only supported for MongoDB")
+		}
+		if db.Differential && domain.DatabaseType(db.Type) != domain.DatabaseTypeMongoDB {
+			add(path+".differential", "differential backups are only supported for MongoDB")
+		}
+		if db.FullEvery != "" {
+			if !db.Differential {
+				add(path+".full_every", "full_every needs differential")
+			} else if _, err := parseFullEvery(db.FullEvery); err != nil {
+				add(path+".full_every", "%v", err)
+			}
+		}
+		if _, err := parseDays("max_age", db.MaxAge); err != nil {
+			add(path+".max_age", "%v", err)
+		}
+		if _, err := parseSize(db.MinSize); err != nil {
+			add(path+".min_size", "%v", err)
+		}
+		if _, err := db.Anomalies.toAnomalies(); err != nil {
+			add(path+".anomalies", "%v", err)
+		}
+		if len(db.Masking) > 0 && !domain.DatabaseType(db.Type).DumpsSQL() {
+			add(path+".masking", "masking is only supported for SQL databases")
+		}
+		for j, rule := range db.Masking {
+			// Hypertable rows are dumped as the rows of their chunks, which table rules do not match
+			if rule.Table != "" && domain.DatabaseType(db.Type) == domain.DatabaseTypeTimescaleDB {
+				add(fmt.Sprintf("%s.masking[%d]", path, j), "TimescaleDB dumps hypertable rows in chunk tables; mask them with a pattern instead")
+			}
+		}
+		if len(db.Checks) > 0 && !domain.DatabaseType(db.Type).RunsChecks() {
+			add(path+".checks", "checks are only supported for PostgreSQL, TimescaleDB, MySQL, MariaDB and MongoDB")
+		}
+		for j, check := range db.checks() {
+			if err := check.Validate(); err != nil {
+				add(fmt.Sprintf("%s.checks[%d]", path, j), "%v", err)
+			}
+		}
+		if _, err := db.Limits.toLimits(); err != nil {
+			add(path+".limits", "%v", err)
+		}
+		if err := db.Compression.toCompression().Validate(); err != nil {
+			add(path+".compression", "%v", err)
+		}
+		if mode := domain.DumpMode(db.Mode); !mode.IsValid() {
+			add(path+".mode", "mode must be %s, %s or %s", domain.DumpModeFull, domain.DumpModeSchemaOnly, domain.DumpModeDataOnly)
+		} else if mode != "" && mode != domain.DumpModeFull && (!domain.DatabaseType(db.Type).DumpsSQL() || db.Physical) {
+			add(path+".mode", "schema-only and data-only dumps are only supported for logical SQL dumps")
+		} else if mode != "" && mode != domain.DumpModeFull && domain.DatabaseType(db.Type) == domain.DatabaseTypeTimescaleDB {
+			add(path+".mode", "TimescaleDB dumps must be full, as hypertables cannot be restored from part of their catalog")
+		}
+		if db.Compress {
+			switch {
+			case !domain.DatabaseType(db.Type).DumpsSQL() || db.Physical:
+				add(path+".compress_in_container", "compress_in_container is only supported for logical SQL dumps")
+			case method == domain.BackupMethodDockerRun:
+				add(path+".compress_in_container", "compress_in_container needs %s, %s or %s", domain.BackupMethodDockerExec, domain.BackupMethodKubectlExec, domain.BackupMethodSSH)
+			case len(db.Masking) > 0:
+				add(path+".compress_in_container", "compress_in_container cannot be combined with masking, which needs the plain dump")
+			}
+		}
+		if db.Globals && !domain.DatabaseType(db.Type).UsesPgDump() {
+			add(path+".globals", "globals are only supported for PostgreSQL and TimescaleDB")
+		}
+		if db.Neo4j != nil {
+			if domain.DatabaseType(db.Type) != domain.DatabaseTypeNeo4j {
+				add(path+".neo4j", "neo4j options are only supported for Neo4j")
+			} else if err := db.Neo4j.toOptions().Validate(method); err != nil {
+				add(path+".neo4j", "%v", err)
+			}
+		}
+		if db.Certs != nil {
+			switch {
+			case !domain.DatabaseType(db.Type).TakesClientCerts():
+				add(path+".certs", "certs are not supported for %s", db.Type)
+			default:
+				if err := db.Certs.toCerts().Validate(domain.DatabaseType(db.Type)); err != nil {
+					add(path+".certs", "%v", err)
+				}
+			}
+		}
+		if db.Managed != nil {
+			if err := db.Managed.toOptions().Validate(domain.DatabaseType(db.Type), method); err != nil {
+				add(path+".managed", "%v", err)
+			} else if db.Managed.IAMAuth && db.Password != "" {
+				add(path+".managed", "iam_auth logs in with a token; leave password empty")
+			}
+		}
+		if db.Physical {
+			switch {
+			case domain.DatabaseType(db.Type) != domain.DatabaseTypeMariaDB:
+				add(path+".physical", "physical backups are only supported for MariaDB")
+			case method == domain.BackupMethodDockerRun:
+				add(path+".physical", "physical backups need docker-exec, kubectl-exec or ssh")
+			case len(db.Masking) > 0 || db.MySQLDump != nil:
+				add(path+".physical", "masking and mysqldump options do not apply to physical backups")
+			}
+		}
+		if db.Snapshot != nil {
+			switch {
+			case method != domain.BackupMethodKubectlExec:
+				add(path+".snapshot", "volume snapshots need %s", domain.BackupMethodKubectlExec)
+			case db.Physical || db.Archive || db.Oplog || db.Differential || db.Globals:
+				add(path+".snapshot", "physical, archive, oplog, differential and globals do not apply to volume snapshots")
+			case len(db.Masking) > 0 || db.MySQLDump != nil || db.Mode != "":
+				add(path+".snapshot", "masking, mysqldump options and mode do not apply to volume snapshots")
+			}
+		}
+		if db.HostSnapshot != nil {
+			snapshot := db.HostSnapshot
+			switch {
+			case method == domain.BackupMethodKubectlExec || method == domain.BackupMethodSSH:
+				add(path+".host_snapshot", "host snapshots need %s or %s on the database's machine", domain.BackupMethodDockerRun, domain.BackupMethodDockerExec)
+			case db.Snapshot != nil:
+				add(path+".host_snapshot", "snapshot and host_snapshot cannot be combined")
+			case db.Physical || db.Archive || db.Oplog || db.Differential || db.Globals:
+				add(path+".host_snapshot", "physical, archive, oplog, differential and globals do not apply to host snapshots")
+			case len(db.Masking) > 0 || db.MySQLDump != nil || db.Mode != "":
+				add(path+".host_snapshot", "masking, mysqldump options and mode do not apply to host snapshots")
+			case snapshot.Type != domain.HostSnapshotZFS && snapshot.Type != domain.HostSnapshotLVM:
+				add(path+".host_snapshot.type", "type must be %s or %s", domain.HostSnapshotZFS, domain.HostSnapshotLVM)
+			case snapshot.Volume == "":
+				add(path+".host_snapshot.volume", "volume is required")
+			case snapshot.Type == domain.HostSnapshotLVM && strings.Count(strings.TrimPrefix(snapshot.Volume, "/dev/"), "/") != 1:
+				add(path+".host_snapshot.volume", "LVM volumes are given as vg/lv")
+			case snapshot.Size != "" && snapshot.Type != domain.HostSnapshotLVM:
+				add(path+".host_snapshot.size", "size only applies to LVM snapshots")
+			case filepath.IsAbs(snapshot.Path) || strings.HasPrefix(filepath.Clean(snapshot.Path), ".."):
+				add(path+".host_snapshot.path", "path must be relative to the volume")
+			}
+		}
+		if db.RDSSnapshot != nil {
+			switch {
+			case db.Snapshot != nil || db.HostSnapshot != nil:
+				add(path+".rds_snapshot", "rds_snapshot cannot be combined with snapshot or host_snapshot")
+			case db.Physical || db.Archive || db.Oplog || db.Differential || db.Globals:
+				add(path+".rds_snapshot", "physical, archive, oplog, differential and globals do not apply to RDS snapshots")
+			case len(db.Masking) > 0 || db.MySQLDump != nil || db.Mode != "":
+				add(path+".rds_snapshot", "masking, mysqldump options and mode do not apply to RDS snapshots")
+			default:
+				if err := db.RDSSnapshot.toOptions().Validate(db.Managed.toOptions()); err != nil {
+					add(path+".rds_snapshot", "%v", err)
+				}
+			}
+		}
+		if db.MySQLDump != nil {
+			dbType := domain.DatabaseType(db.Type)
+			if dbType != domain.DatabaseTypeMySQL && dbType != domain.DatabaseTypeMariaDB {
+				add(path+".mysqldump", "mysqldump options are only supported for MySQL and MariaDB")
+			} else if err := db.MySQLDump.toOptions().Validate(dbType); err != nil {
+				add(path+".mysqldump", "%v", err)
+			}
+		}
+		for j, rule := range db.maskingRules() {
+			if err := rule.Validate(); err != nil {
+				add(fmt.Sprintf("%s.masking[%d]", path, j), "%v", err)
+			}
+		}
+	}
+
+	return problems
+}
+
+// ToBackupConfig converts the file into the domain configuration, applying defaults
+func (f *File) ToBackupConfig() domain.BackupConfig {
+	config := domain.BackupConfig{
+		Method:       domain.BackupMethod(f.Method),
+		Timestamp:    time.Now(),
+		BackupDir:    valueOrDefault(f.BackupDir, "backup"),
+		TempDir:      valueOrDefault(f.TempDir, "/tmp/db-backups"),
+		K8sNamespace: "default",
+		Dedup:        f.Dedup,
+		Parallel:     f.Parallel,
+		Uploads:      f.Uploads.toUploads(),
+		Stores:       f.Stores,
+		StreamTo:     f.StreamTo,
+		LocalKeep:    f.LocalKeep,
+	}
+	// Validate has already rejected an unparsable max_age, part size, alerts and anomalies
+	config.MaxAge, _ = parseDays("max_age", f.MaxAge)
+	config.PartSize, _ = parsePartSize(f.PartSize)
+	config.Alerts, _ = f.Alerts.toAlerts()
+	config.Anomalies, _ = f.Anomalies.toAnomalies()
+
+	for _, store := range f.S3Stores {
+		config.S3Stores = append(config.S3Stores, store.toConfig())
+	}
+
+	if f.Signing != nil {
+		config.Signing = &domain.Signing{Key: f.Signing.Key, PublicKey: f.Signing.PublicKey}
+	}
+
+	if f.Encryption != nil {
+		encryption := f.Encryption.toEncryption()
+		config.Encryption = &encryption
+	}
+
+	// Validate has already rejected unparsable limits
+	config.Limits, _ = f.Limits.toLimits()
+	config.Compression = f.Compression.toCompression()
+
+	if f.Naming != nil {
+		config.NameTemplate = f.Naming.Template
+		config.TimestampFormat = f.Naming.TimestampFormat
+		config.Timezone = f.Naming.Timezone
+		config.Environment = f.Naming.Environment
+	}
+
+	if f.Logs != nil {
+		config.Logs = domain.LogSettings{Dir: f.Logs.Dir, Keep: f.Logs.Keep, Disabled: f.Logs.Disabled}
+	}
+
+	// Validate has already rejected malformed URLs
+	config.Heartbeat, _ = f.Heartbeat.toURLs()
+
+	if f.Kubernetes != nil {
+		config.K8sNamespace = valueOrDefault(f.Kubernetes.Namespace, "default")
+		config.Kubeconfig = f.Kubernetes.Kubeconfig
+		config.KubeContext = f.Kubernetes.Context
+	}
+
+	for _, tenant := range f.Tenants {
+		config.Tenants = append(config.Tenants, tenant.toTenant())
+	}
+
+	for _, entry := range f.databaseEntries() {
+		db := entry.block
+		limits, _ := db.Limits.toLimits()
+		fullEvery, _ := parseFullEvery(db.FullEvery)
+		maxAge, _ := parseDays("max_age", db.MaxAge)
+		minSize, _ := parseSize(db.MinSize)
+		partSize, _ := parsePartSize(db.PartSize)
+		anomalies, _ := db.Anomalies.toAnomalies()
+		if db.Database == "" && domain.DatabaseType(db.Type).ReachedOverAPI() {
+			db.Database = db.Type // Backed up whole; the name only labels the backups
+		}
+		config.Databases = append(config.Databases, domain.DatabaseConfig{
+			Label:               db.Label,
+			Tags:                db.Tags,
+			Type:                domain.DatabaseType(db.Type),
+			Host:                db.Host,
+			Port:                db.Port,
+			User:                db.User,
+			Password:            db.Password,
+			Database:            db.Database,
+			Version:             db.Version,
+			Container:           db.Container,
+			Pod:                 db.Pod,
+			SSHHost:             db.SSHHost,
+			SSHKey:              db.SSHKey,
+			Kubeconfig:          db.Kubeconfig,
+			KubeContext:         db.KubeContext,
+			AuthDatabase:        db.AuthDB,
+			URI:                 db.URI,
+			TLS:                 db.TLS,
+			Oplog:               db.Oplog,
+			Archive:             db.Archive,
+			Differential:        db.Differential,
+			FullEvery:           fullEvery,
+			MySQLDump:           db.MySQLDump.toOptions(),
+			Physical:            db.Physical,
+			Snapshot:            db.Snapshot.toOptions(),
+			HostSnapshot:        db.HostSnapshot.toOptions(),
+			Globals:             db.Globals,
+			Certs:               db.Certs.toCerts(),
+			Managed:             db.Managed.toOptions(),
+			RDSSnapshot:         db.RDSSnapshot.toOptions(),
+			Checks:              db.checks(),
+			Neo4j:               db.Neo4j.toOptions(),
+			DumpMode:            domain.DumpMode(db.Mode),
+			Masking:             db.maskingRules(),
+			CompressInContainer: db.Compress,
+			Limits:              limits,
+			Compression:         db.Compression.toCompression(),
+			BackupDir:           db.BackupDir,
+			Stores:              storeNames(db.Stores),
+			TempDir:             db.TempDir,
+			MaxAge:              maxAge,
+			MinSize:             minSize,
+			PartSize:            partSize,
+			StreamTo:            db.StreamTo,
+			LocalKeep:           db.LocalKeep,
+			Anomalies:           anomalies,
+		})
+		if entry.tenant != nil {
+			dbConfig := &config.Databases[len(config.Databases)-1]
+			tenant := entry.tenant.toTenant()
+			dbConfig.Tenant = tenant.Name
+			dbConfig.BackupDir = tenant.BackupDir
+			if dbConfig.Stores == nil {
+				dbConfig.Stores = tenant.Stores
+			}
+			dbConfig.Encryption = tenant.Encryption
+		}
+	}
+
+	return config
+}
+
+// FromBackupConfig converts a domain configuration into its file representation
+func FromBackupConfig(config domain.BackupConfig) File {
+	file := File{
+		Version:     CurrentVersion,
+		Method:      config.Method.String(),
+		BackupDir:   config.BackupDir,
+		TempDir:     config.TempDir,
+		Dedup:       config.Dedup,
+		Parallel:    config.Parallel,
+		Uploads:     uploadsBlock(config.Uploads),
+		Stores:      config.Stores,
+		PartSize:    formatSize(config.PartSize),
+		StreamTo:    config.StreamTo,
+		LocalKeep:   config.LocalKeep,
+		Limits:      limitsBlock(config.Limits),
+		Compression: compressionBlock(config.Compression),
+		MaxAge:      formatDays(config.MaxAge),
+		Anomalies:   anomaliesBlock(config.Anomalies),
+	}
+
+	for _, store := range config.S3Stores {
+		file.S3Stores = append(file.S3Stores, s3StoreBlock(store))
+	}
+
+	if config.Signing != nil {
+		file.Signing = &SigningBlock{Key: config.Signing.Key, PublicKey: config.Signing.PublicKey}
+	}
+
+	if e := config.Encryption; e != nil {
+		file.Encryption = &EncryptionBlock{Provider: e.Provider, Key: e.Key, Region: e.Region, Address: e.Address, Mount: e.Mount}
+	}
+
+	if config.NameTemplate != "" || config.TimestampFormat != "" || config.Timezone != "" || config.Environment != "" {
+		file.Naming = &NamingBlock{
+			Template:        config.NameTemplate,
+			TimestampFormat: config.TimestampFormat,
+			Timezone:        config.Timezone,
+			Environment:     config.Environment,
+		}
+	}
+
+	if config.Logs != (domain.LogSettings{}) {
+		file.Logs = &LogsBlock{Dir: config.Logs.Dir, Keep: config.Logs.Keep, Disabled: config.Logs.Disabled}
+	}
+
+	if config.Heartbeat != (domain.HeartbeatURLs{}) {
+		file.Heartbeat = &HeartbeatBlock{
+			StartURL:   config.Heartbeat.Start,
+			SuccessURL: config.Heartbeat.Success,
+			FailureURL: config.Heartbeat.Failure,
+		}
+	}
+
+	if config.Alerts != (domain.Alerts{}) {
+		file.Alerts = &AlertsBlock{URL: config.Alerts.URL, Interval: formatDays(config.Alerts.Interval)}
+	}
+
+	if config.Method == domain.BackupMethodKubectlExec {
+		file.Kubernetes = &KubernetesBlock{
+			Namespace:  config.K8sNamespace,
+			Kubeconfig: config.Kubeconfig,
+			Context:    config.KubeContext,
+		}
+	}
+
+	tenants := make(map[string]*TenantBlock)
+	for _, tenant := range config.Tenants {
+		block := TenantBlock{Name: tenant.Name, BackupDir: tenant.BackupDir, Stores: storesBlock(tenant.Stores), Keep: tenant.Keep}
+		if e := tenant.Encryption; e != nil {
+			block.Encryption = &EncryptionBlock{Provider: e.Provider, Key: e.Key, Region: e.Region, Address: e.Address, Mount: e.Mount}
+		}
+		file.Tenants = append(file.Tenants, block)
+	}
+	for i := range file.Tenants {
+		tenants[file.Tenants[i].Name] = &file.Tenants[i]
+	}
+
+	for _, db := range config.Databases {
+		label := db.Label
+		if label == db.Database {
+			label = ""
+		}
+		block := DatabaseBlock{
+			Label:        label,
+			Tags:         db.Tags,
+			Type:         db.Type.String(),
+			Host:         db.Host,
+			Port:         db.Port,
+			User:         db.User,
+			Password:     db.Password,
+			Database:     db.Database,
+			Version:      db.Version,
+			Container:    db.Container,
+			Pod:          db.Pod,
+			SSHHost:      db.SSHHost,
+			SSHKey:       db.SSHKey,
+			Kubeconfig:   db.Kubeconfig,
+			KubeContext:  db.KubeContext,
+			AuthDB:       db.AuthDatabase,
+			URI:          db.URI,
+			TLS:          db.TLS,
+			Oplog:        db.Oplog,
+			Archive:      db.Archive,
+			Differential: db.Differential,
+			FullEvery:    formatDays(db.FullEvery),
+			MySQLDump:    mysqlDumpBlock(db.MySQLDump),
+			Physical:     db.Physical,
+			Snapshot:     snapshotBlock(db.Snapshot),
+			HostSnapshot: hostSnapshotBlock(db.HostSnapshot),
+			Globals:      db.Globals,
+			Certs:        certsBlock(db.Certs),
+			Managed:      managedBlock(db.Managed),
+			RDSSnapshot:  rdsSnapshotBlock(db.RDSSnapshot),
+			Checks:       checkBlocks(db.Checks),
+			Neo4j:        neo4jBlock(db.Neo4j),
+			Mode:         string(db.DumpMode),
+			Masking:      maskingBlocks(db.Masking),
+			Compress:     db.CompressInContainer,
+			Limits:       limitsBlock(db.Limits),
+			Compression:  compressionBlock(db.Compression),
+			BackupDir:    db.BackupDir,
+			Stores:       storesBlock(db.Stores),
+			PartSize:     formatSize(db.PartSize),
+			StreamTo:     db.StreamTo,
+			LocalKeep:    db.LocalKeep,
+			TempDir:      db.TempDir,
+			MaxAge:       formatDays(db.MaxAge),
+			MinSize:      formatSize(db.MinSize),
+			Anomalies:    anomaliesBlock(db.Anomalies),
+		}
+
+		// The tenant's destinations were copied to its databases when the file was read
+		tenant, ok := tenants[db.Tenant]
+		if !ok {
+			file.Databases = append(file.Databases, block)
+			continue
+		}
+		block.BackupDir = ""
+		if reflect.DeepEqual(block.Stores, tenant.Stores) {
+			block.Stores = nil
+		}
+		tenant.Databases = append(tenant.Databases, block)
+	}
+
+	return file
+}
+
+// maskingRules converts the masking blocks of a database into domain rules
+func (db DatabaseBlock) maskingRules() []domain.MaskingRule {
+	var rules []domain.MaskingRule
+	for _, block := range db.Masking {
+		rules = append(rules, domain.MaskingRule{
+			Table:       block.Table,
+			Column:      block.Column,
+			Pattern:     block.Pattern,
+			Replacement: block.Replacement,
+		})
+	}
+	return rules
+}
+
+// checks converts the check blocks of a database into domain checks
+func (db DatabaseBlock) checks() []domain.Check {
+	var checks []domain.Check
+	for _, block := range db.Checks {
+		checks = append(checks, domain.Check{Query: block.Query, Expect: block.Expect})
+	}
+	return checks
+}
+
+func checkBlocks(checks []domain.Check) []CheckBlock {
+	var blocks []CheckBlock
+	for _, check := range checks {
+		blocks = append(blocks, CheckBlock{Query: check.Query, Expect: check.Expect})
+	}
+	return blocks
+}
+
+func maskingBlocks(rules []domain.MaskingRule) []MaskingBlock {
+	var blocks []MaskingBlock
+	for _, rule := range rules {
+		blocks = append(blocks, MaskingBlock{
+			Table:       rule.Table,
+			Column:      rule.Column,
+			Pattern:     rule.Pattern,
+			Replacement: rule.Replacement,
+		})
+	}
+	return blocks
+}
+
+// check renders the template with sample values, so mistakes surface before the first backup
+func (b *NamingBlock) check() error {
+	if b.Template == "" && b.TimestampFormat == "" && b.Timezone == "" {
+		return nil
+	}
+
+	timestamp, err := domain.FormatTimestamp(time.Now(), b.TimestampFormat, b.Timezone)
+	if err != nil {
+		return err
+	}
+	_, err = domain.BackupName{
+		Label:       "mydb",
+		Database:    "mydb",
+		Type:        domain.DatabaseTypePostgres.String(),
+		Host:        "localhost",
+		Method:      domain.BackupMethodDockerRun.String(),
+		Mode:        string(domain.DumpModeFull),
+		Environment: b.Environment,
+		Timestamp:   timestamp,
+		Ext:         ".sql",
+	}.Render(valueOrDefault(b.Template, domain.DefaultNameTemplate))
+	return err
+}
+
+// toURLs works out the ping URLs; a nil block means no pings
+func (b *HeartbeatBlock) toURLs() (domain.HeartbeatURLs, error) {
+	if b == nil {
+		return domain.HeartbeatURLs{}, nil
+	}
+
+	var urls domain.HeartbeatURLs
+	if b.URL != "" {
+		base, err := url.Parse(b.URL)
+		if err != nil {
+			return urls, fmt.Errorf("invalid url: %w", err)
+		}
+		switch b.Provider {
+		case "", "healthchecks":
+			// healthchecks.io takes /start and /fail after the check URL
+			urls.Start = strings.TrimSuffix(b.URL, "/") + "/start"
+			urls.Success = b.URL
+			urls.Failure = strings.TrimSuffix(b.URL, "/") + "/fail"
+		case "cronitor":
+			// Cronitor telemetry URLs take the event as the state parameter
+			urls.Start = withQuery(base, "state", "run")
+			urls.Success = withQuery(base, "state", "complete")
+			urls.Failure = withQuery(base, "state", "fail")
+		default:
+			return urls, fmt.Errorf("invalid provider %q, expected healthchecks or cronitor", b.Provider)
+		}
+	}
+
+	urls.Start = valueOrDefault(b.StartURL, urls.Start)
+	urls.Success = valueOrDefault(b.SuccessURL, urls.Success)
+	urls.Failure = valueOrDefault(b.FailureURL, urls.Failure)
+	if urls == (domain.HeartbeatURLs{}) {
+		return urls, fmt.Errorf("url or one of start_url, success_url and failure_url is required")
+	}
+
+	for _, u := range []string{urls.Start, urls.Success, urls.Failure} {
+		if u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return urls, fmt.Errorf("invalid url: %w", err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+			return urls, fmt.Errorf("invalid url %q, expected an http or https URL", u)
+		}
+	}
+	return urls, nil
+}
+
+// toAlerts converts the block into domain alerts; a nil block sends none
+func (b *AlertsBlock) toAlerts() (domain.Alerts, error) {
+	if b == nil {
+		return domain.Alerts{}, nil
+	}
+	u, err := url.Parse(b.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return domain.Alerts{}, fmt.Errorf("url must be an http or https URL")
+	}
+	interval, err := parseDays("interval", b.Interval)
+	if err != nil {
+		return domain.Alerts{}, err
+	}
+	return domain.Alerts{URL: b.URL, Interval: interval}, nil
+}
+
+// toAnomalies converts the block into domain anomalies; a nil block uses the defaults
+func (b *AnomaliesBlock) toAnomalies() (domain.Anomalies, error) {
+	if b == nil {
+		return domain.Anomalies{}, nil
+	}
+	sizeDrop, err := parseFraction("size_drop", b.SizeDrop)
+	if err != nil {
+		return domain.Anomalies{}, err
+	}
+	slowdown, err := parseFactor("slowdown", b.Slowdown)
+	if err != nil {
+		return domain.Anomalies{}, err
+	}
+	return domain.Anomalies{SizeDrop: sizeDrop, Slowdown: slowdown}, nil
+}
+
+// anomaliesBlock converts domain anomalies back into a block, nil for the defaults
+func anomaliesBlock(anomalies domain.Anomalies) *AnomaliesBlock {
+	if anomalies == (domain.Anomalies{}) {
+		return nil
+	}
+	return &AnomaliesBlock{SizeDrop: formatFraction(anomalies.SizeDrop), Slowdown: formatFactor(anomalies.Slowdown)}
+}
+
+// parseFraction parses the setting called name, a percentage below 100% such as 50%, or off,
+// which is negative. Empty is zero.
+func parseFraction(name, s string) (float64, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "off":
+		return -1, nil
+	}
+	percent, ok := strings.CutSuffix(s, "%")
+	n, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+	if !ok || err != nil || n <= 0 || n >= 100 {
+		return 0, fmt.Errorf("invalid %s %q, use a percentage such as 50%% or off", name, s)
+	}
+	return n / 100, nil
+}
+
+// formatFraction writes a fraction that parseFraction reads back
+func formatFraction(f float64) string {
+	switch {
+	case f == 0:
+		return ""
+	case f < 0:
+		return "off"
+	}
+	// Rounded to hundredths of a percent, as 0.3*100 is not quite 30
+	return strconv.FormatFloat(math.Round(f*10000)/100, 'f', -1, 64) + "%"
+}
+
+// parseFactor parses the setting called name, a factor above 1 such as 3x, or off, which is
+// negative. Empty is zero.
+func parseFactor(name, s string) (float64, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "off":
+		return -1, nil
+	}
+	n, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || n <= 1 {
+		return 0, fmt.Errorf("invalid %s %q, use a factor above 1 such as 3x or off", name, s)
+	}
+	return n, nil
+}
+
+// formatFactor writes a factor that parseFactor reads back
+func formatFactor(f float64) string {
+	switch {
+	case f == 0:
+		return ""
+	case f < 0:
+		return "off"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64) + "x"
+}
+
+// withQuery returns u with the query parameter key set to value
+func withQuery(u *url.URL, key, value string) string {
+	copied := *u
+	query := copied.Query()
+	query.Set(key, value)
+	copied.RawQuery = query.Encode()
+	return copied.String()
+}
+
+// toCompression converts the block into domain compression; a nil block uses the defaults
+func (b *CompressionBlock) toCompression() domain.Compression {
+	if b == nil {
+		return domain.Compression{}
+	}
+	return domain.Compression{Tool: b.Tool, Threads: b.Threads}
+}
+
+// compressionBlock converts domain compression back into a block, nil for the defaults
+func compressionBlock(compression domain.Compression) *CompressionBlock {
+	if compression == (domain.Compression{}) {
+		return nil
+	}
+	return &CompressionBlock{Tool: compression.Tool, Threads: compression.Threads}
+}
+
+// toUploads converts the block into domain uploads; a nil block uses the defaults
+func (b *UploadsBlock) toUploads() domain.Uploads {
+	if b == nil {
+		return domain.Uploads{}
+	}
+	return domain.Uploads{Parallel: b.Parallel, Queue: b.Queue}
+}
+
+// uploadsBlock converts domain uploads back into a block, nil for the defaults
+func uploadsBlock(uploads domain.Uploads) *UploadsBlock {
+	if uploads == (domain.Uploads{}) {
+		return nil
+	}
+	return &UploadsBlock{Parallel: uploads.Parallel, Queue: uploads.Queue}
+}
+
+// toLimits converts the block into domain limits; a nil block means no limits
+func (b *LimitsBlock) toLimits() (domain.ResourceLimits, error) {
+	if b == nil {
+		return domain.ResourceLimits{}, nil
+	}
+
+	rate, err := parseSize(b.Rate)
+	if err != nil {
+		return domain.ResourceLimits{}, fmt.Errorf("rate: %w", err)
+	}
+	memory, err := parseSize(b.Memory)
+	if err != nil {
+		return domain.ResourceLimits{}, fmt.Errorf("memory: %w", err)
+	}
+	minFree, err := parseSize(b.MinFree)
+	if err != nil {
+		return domain.ResourceLimits{}, fmt.Errorf("min_free: %w", err)
+	}
+
+	limits := domain.ResourceLimits{
+		BytesPerSecond: rate,
+		Nice:           b.Nice,
+		IOClass:        b.IONice,
+		CPUs:           b.CPUs,
+		MemoryBytes:    memory,
+		MinFreeBytes:   minFree,
+	}
+	return limits, limits.Validate()
+}
+
+// toOptions converts the block into domain dump options; a nil block keeps mysqldump's defaults
+func (b *MySQLDumpBlock) toOptions() domain.MySQLDumpOptions {
+	if b == nil {
+		return domain.MySQLDumpOptions{}
+	}
+	return domain.MySQLDumpOptions{
+		SingleTransaction: b.SingleTransaction,
+		Routines:          b.Routines,
+		Events:            b.Events,
+		SkipTriggers:      b.Triggers != nil && !*b.Triggers,
+		SetGTIDPurged:     strings.ToUpper(b.SetGTIDPurged),
+	}
+}
+
+func (b *SnapshotBlock) toOptions() *domain.SnapshotOptions {
+	if b == nil {
+		return nil
+	}
+	return &domain.SnapshotOptions{PVC: b.PVC, Class: b.Class}
+}
+
+func snapshotBlock(options *domain.SnapshotOptions) *SnapshotBlock {
+	if options == nil {
+		return nil
+	}
+	return &SnapshotBlock{PVC: options.PVC, Class: options.Class}
+}
+
+func (b *Neo4jBlock) toOptions() domain.Neo4jOptions {
+	if b == nil {
+		return domain.Neo4jOptions{}
+	}
+	return domain.Neo4jOptions{Strategy: b.Strategy, BackupPort: b.BackupPort}
+}
+
+func neo4jBlock(options domain.Neo4jOptions) *Neo4jBlock {
+	if options == (domain.Neo4jOptions{}) {
+		return nil
+	}
+	return &Neo4jBlock{Strategy: options.Strategy, BackupPort: options.BackupPort}
+}
+
+func (b *CertsBlock) toCerts() *domain.ClientCerts {
+	if b == nil {
+		return nil
+	}
+	return &domain.ClientCerts{CA: b.CA, Cert: b.Cert, Key: b.Key, Mode: b.Mode}
+}
+
+func (b *ManagedBlock) toOptions() *domain.ManagedOptions {
+	if b == nil {
+		return nil
+	}
+	return &domain.ManagedOptions{Provider: b.Provider, IAMAuth: b.IAMAuth, Region: b.Region}
+}
+
+func managedBlock(options *domain.ManagedOptions) *ManagedBlock {
+	if options == nil {
+		return nil
+	}
+	return &ManagedBlock{Provider: options.Provider, IAMAuth: options.IAMAuth, Region: options.Region}
+}
+
+func (b *RDSSnapshotBlock) toOptions() *domain.RDSSnapshotOptions {
+	if b == nil {
+		return nil
+	}
+	options := &domain.RDSSnapshotOptions{Instance: b.Instance, Cluster: b.Cluster}
+	if b.Export != nil {
+		options.Export = &domain.RDSExportOptions{Bucket: b.Export.Bucket, Prefix: b.Export.Prefix, Role: b.Export.Role, KMSKey: b.Export.KMSKey}
+	}
+	return options
+}
+
+func rdsSnapshotBlock(options *domain.RDSSnapshotOptions) *RDSSnapshotBlock {
+	if options == nil {
+		return nil
+	}
+	block := &RDSSnapshotBlock{Instance: options.Instance, Cluster: options.Cluster}
+	if export := options.Export; export != nil {
+		block.Export = &RDSExportBlock{Bucket: export.Bucket, Prefix: export.Prefix, Role: export.Role, KMSKey: export.KMSKey}
+	}
+	return block
+}
+
+// toConfig converts the block, leaving the lock without a retention if retain does not parse
+func (b S3StoreBlock) toConfig() domain.S3StoreConfig {
+	config := domain.S3StoreConfig{
+		Name:        b.Name,
+		Bucket:      b.Bucket,
+		Prefix:      b.Prefix,
+		Region:      b.Region,
+		Endpoint:    b.Endpoint,
+		Concurrency: b.Concurrency,
+
+		StorageClass: strings.ToUpper(b.StorageClass),
+	}
+	if b.ObjectLock != nil {
+		retain, _ := parseRetain(b.ObjectLock)
+		config.ObjectLock = &domain.ObjectLock{Mode: b.ObjectLock.Mode, Retain: retain}
+	}
+	if b.Retrieval != nil {
+		config.Retrieval = domain.Retrieval{Tier: b.Retrieval.Tier, Days: b.Retrieval.Days}
+	}
+	return config
+}
+
+func s3StoreBlock(config domain.S3StoreConfig) S3StoreBlock {
+	block := S3StoreBlock{
+		Name:        config.Name,
+		Bucket:      config.Bucket,
+		Prefix:      config.Prefix,
+		Region:      config.Region,
+		Endpoint:    config.Endpoint,
+		Concurrency: config.Concurrency,
+
+		StorageClass: config.StorageClass,
+	}
+	if config.ObjectLock != nil {
+		block.ObjectLock = &ObjectLockBlock{Mode: config.ObjectLock.Mode, Retain: formatDays(config.ObjectLock.Retain)}
+	}
+	if config.Retrieval != (domain.Retrieval{}) {
+		block.Retrieval = &RetrievalBlock{Tier: config.Retrieval.Tier, Days: config.Retrieval.Days}
+	}
+	return block
+}
+
+// parseRetain parses the retention of an object lock, days such as 30d or a Go duration
+func parseRetain(lock *ObjectLockBlock) (time.Duration, error) {
+	if lock == nil {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(lock.Retain, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(lock.Retain)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid retain %q, use a duration such as 30d or 720h", lock.Retain)
+	}
+	return d, nil
+}
+
+// storeNames keeps a database's stores apart from none being set: nil uses the run's stores
+func storeNames(stores *[]string) []string {
+	if stores == nil {
+		return nil
+	}
+	return append([]string{}, *stores...)
+}
+
+func storesBlock(stores []string) *[]string {
+	if stores == nil {
+		return nil
+	}
+	return &stores
+}
+
+func certsBlock(certs *domain.ClientCerts) *CertsBlock {
+	if certs == nil {
+		return nil
+	}
+	return &CertsBlock{CA: certs.CA, Cert: certs.Cert, Key: certs.Key, Mode: certs.Mode}
+}
+
+func (b *HostSnapshotBlock) toOptions() *domain.HostSnapshotOptions {
+	if b == nil {
+		return nil
+	}
+	return &domain.HostSnapshotOptions{Kind: b.Type, Volume: b.Volume, Path: b.Path, Size: b.Size}
+}
+
+func hostSnapshotBlock(options *domain.HostSnapshotOptions) *HostSnapshotBlock {
+	if options == nil {
+		return nil
+	}
+	return &HostSnapshotBlock{Type: options.Kind, Volume: options.Volume, Path: options.Path, Size: options.Size}
+}
+
+func mysqlDumpBlock(options domain.MySQLDumpOptions) *MySQLDumpBlock {
+	if options == (domain.MySQLDumpOptions{}) {
+		return nil
+	}
+	block := &MySQLDumpBlock{
+		SingleTransaction: options.SingleTransaction,
+		Routines:          options.Routines,
+		Events:            options.Events,
+		SetGTIDPurged:     options.SetGTIDPurged,
+	}
+	if options.SkipTriggers {
+		block.Triggers = new(bool)
+	}
+	return block
+}
+
+func limitsBlock(limits domain.ResourceLimits) *LimitsBlock {
+	if limits.IsZero() {
+		return nil
+	}
+	return &LimitsBlock{
+		Rate:    formatSize(limits.BytesPerSecond),
+		Nice:    limits.Nice,
+		IONice:  limits.IOClass,
+		CPUs:    limits.CPUs,
+		Memory:  formatSize(limits.MemoryBytes),
+		MinFree: formatSize(limits.MinFreeBytes),
+	}
+}
+
+// parseSize parses a byte count with an optional K, M or G suffix (powers of 1024), e.g. "20M" or "512MiB"
+func parseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	if s == "" {
+		return 0, nil
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// parsePartSize reads a part size like parseSize, refusing sizes below domain.MinPartSize
+func parsePartSize(value string) (int64, error) {
+	size, err := parseSize(value)
+	if err != nil {
+		return 0, err
+	}
+	if size != 0 && size < domain.MinPartSize {
+		return 0, fmt.Errorf("%s is too small for a part; use at least %s", value, formatSize(domain.MinPartSize))
+	}
+	return size, nil
+}
+
+// formatSize renders bytes with the largest exact unit: 20971520 -> "20M"
+func formatSize(bytes int64) string {
+	if bytes == 0 {
+		return ""
+	}
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}} {
+		if bytes%unit.size == 0 {
+			return fmt.Sprintf("%d%s", bytes/unit.size, unit.suffix)
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// parseFullEvery parses full_every, a Go duration such as 72h or a number of days such as 7d.
+// Empty is zero, which uses the default.
+func parseFullEvery(s string) (time.Duration, error) {
+	return parseDays("full_every", s)
+}
+
+// parseDays parses the setting called name, a Go duration such as 72h or a number of days
+// such as 7d. Empty is zero.
+func parseDays(name, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid %s %q", name, s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q, use a duration such as 7d or 72h", name, s)
+	}
+	return d, nil
+}
+
+// formatDays writes a duration that parseFullEvery and parseRetain read back, in days where it can
+func formatDays(d time.Duration) string {
+	switch {
+	case d == 0:
+		return ""
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
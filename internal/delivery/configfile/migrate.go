@@ -0,0 +1,76 @@
+package configfile
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config format version this build reads natively and writes
+const CurrentVersion = 1
+
+// migrations[i] upgrades a document from version i to i+1 in place. When the format changes
+// incompatibly, bump CurrentVersion and append the step that rewrites older files.
+var migrations = []func(root *yaml.Node) error{
+	// 0 -> 1: files written before the version field existed already use the version 1 layout
+	func(root *yaml.Node) error { return nil },
+}
+
+// migrate upgrades a parsed document to CurrentVersion, returning the version it was written in
+func migrate(doc *yaml.Node) (int, error) {
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		// Empty or malformed; decoding reports it
+		return CurrentVersion, nil
+	}
+
+	version := 0
+	node := mappingValue(root, "version")
+	if node != nil {
+		v, err := strconv.Atoi(node.Value)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("line %d: invalid version %q", node.Line, node.Value)
+		}
+		version = v
+	}
+	if version > CurrentVersion {
+		return version, fmt.Errorf("line %d: config version %d is newer than this tool supports (%d); upgrade backup-tool", node.Line, version, CurrentVersion)
+	}
+
+	for v := version; v < CurrentVersion; v++ {
+		if err := migrations[v](root); err != nil {
+			return version, fmt.Errorf("failed to migrate config from version %d to %d: %w", v, v+1, err)
+		}
+	}
+	setVersion(root, CurrentVersion)
+
+	return version, nil
+}
+
+// mappingValue returns the value node of key in a mapping, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setVersion records the version a document has been migrated to, adding the key at the top if missing
+func setVersion(root *yaml.Node, version int) {
+	value := strconv.Itoa(version)
+	if node := mappingValue(root, "version"); node != nil {
+		node.Value = value
+		return
+	}
+
+	root.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"},
+		{Kind: yaml.ScalarNode, Tag: "!!int", Value: value},
+	}, root.Content...)
+}
@@ -0,0 +1,104 @@
+package configfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// lastAnswersFile keeps the answers of the last interactive session next to the profiles.
+// Profile names cannot start with a dot, so it never clashes with one.
+const lastAnswersFile = ".last-answers.yaml"
+
+// ProfileStore implements domain.ProfileRepository with one config file per profile
+type ProfileStore struct {
+	dir string
+}
+
+// NewProfileStore creates a store in dir, or ~/.config/backup-tool/profiles when dir is empty
+func NewProfileStore(dir string) (domain.ProfileRepository, error) {
+	if dir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate config directory: %w", err)
+		}
+		dir = filepath.Join(configDir, "backup-tool", "profiles")
+	}
+
+	return &ProfileStore{dir: dir}, nil
+}
+
+// SaveProfile stores a configuration under name, without secrets
+func (s *ProfileStore) SaveProfile(name string, config domain.BackupConfig) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	return s.write(path, config)
+}
+
+// LoadProfile returns a previously saved configuration
+func (s *ProfileStore) LoadProfile(name string) (domain.BackupConfig, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return domain.BackupConfig{}, err
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return domain.BackupConfig{}, fmt.Errorf("profile %q not found in %s", name, s.dir)
+	}
+	return Load(path)
+}
+
+// SaveLastAnswers stores the answers of the last interactive session, without secrets
+func (s *ProfileStore) SaveLastAnswers(config domain.BackupConfig) error {
+	return s.write(filepath.Join(s.dir, lastAnswersFile), config)
+}
+
+// LoadLastAnswers returns the answers of the last interactive session, or an empty
+// configuration before the first one
+func (s *ProfileStore) LoadLastAnswers() (domain.BackupConfig, error) {
+	path := filepath.Join(s.dir, lastAnswersFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return domain.BackupConfig{}, nil
+	}
+	return Load(path)
+}
+
+// write stores config as a config file at path, without passwords
+func (s *ProfileStore) write(path string, config domain.BackupConfig) error {
+	file := FromBackupConfig(config)
+	for i := range file.Databases {
+		file.Databases[i].Password = ""
+	}
+	for _, tenant := range file.Tenants {
+		for i := range tenant.Databases {
+			tenant.Databases[i].Password = ""
+		}
+	}
+
+	var content bytes.Buffer
+	encoder := yaml.NewEncoder(&content)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(file); err != nil {
+		return fmt.Errorf("failed to encode profile: %w", err)
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	return os.WriteFile(path, content.Bytes(), 0600)
+}
+
+func (s *ProfileStore) path(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid profile name %q", name)
+	}
+	return filepath.Join(s.dir, name+".yaml"), nil
+}
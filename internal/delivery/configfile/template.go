@@ -0,0 +1,103 @@
+package configfile
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// templateFuncs returns the functions available inside config files
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// env returns an environment variable, or an empty string if unset
+		"env": os.Getenv,
+
+		// default returns value unless it is empty: {{ env "PG_PORT" | default "5432" }}
+		"default": func(defaultValue string, value interface{}) string {
+			s := fmt.Sprint(value)
+			if value == nil || s == "" {
+				return defaultValue
+			}
+			return s
+		},
+
+		// required fails rendering when value is empty: {{ env "PG_PASS" | required "PG_PASS is not set" }}
+		"required": func(message string, value interface{}) (string, error) {
+			s := fmt.Sprint(value)
+			if value == nil || s == "" {
+				return "", fmt.Errorf("%s", message)
+			}
+			return s, nil
+		},
+
+		// credential reads a systemd credential passed with LoadCredential=: {{ credential "pg-pass" }}
+		"credential": func(name string) (string, error) {
+			dir := os.Getenv("CREDENTIALS_DIRECTORY")
+			if dir == "" {
+				return "", fmt.Errorf("credential %q: CREDENTIALS_DIRECTORY is not set, so this is not a systemd service with credentials", name)
+			}
+			content, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return "", fmt.Errorf("credential %q: %w", name, err)
+			}
+			return strings.TrimRight(string(content), "\r\n"), nil
+		},
+
+		// now returns the current time, for timestamped paths: {{ now | date "2006-01" }}
+		"now": time.Now,
+		"date": func(layout string, t time.Time) string {
+			return t.Format(layout)
+		},
+
+		"quote": func(s string) string {
+			return fmt.Sprintf("%q", s)
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"trim":  strings.TrimSpace,
+		"b64enc": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"b64dec": func(s string) (string, error) {
+			decoded, err := base64.StdEncoding.DecodeString(s)
+			return string(decoded), err
+		},
+	}
+}
+
+// render expands Go template expressions in a config file before it is parsed
+func render(name string, content []byte) ([]byte, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(templateFuncs()).
+		Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, namePlaceholders()); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// namePlaceholders lets backup name templates such as {{.Database}} pass through config rendering
+// unchanged, so they can be written in a config file without escaping
+func namePlaceholders() map[string]string {
+	placeholders := make(map[string]string)
+	fields := reflect.TypeOf(domain.BackupName{})
+	for i := 0; i < fields.NumField(); i++ {
+		name := fields.Field(i).Name
+		placeholders[name] = "{{." + name + "}}"
+	}
+	return placeholders
+}
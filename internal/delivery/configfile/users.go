@@ -0,0 +1,93 @@
+package configfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// UsersFile lists who may call the API of serve, and with which role
+type UsersFile struct {
+	Users []UserBlock `yaml:"users"`
+}
+
+// UserBlock is one user of the API and the token it authenticates with
+type UserBlock struct {
+	Name        string `yaml:"name"`
+	Role        string `yaml:"role"`                   // viewer, operator or admin
+	Token       string `yaml:"token,omitempty"`        // e.g. '{{ env "CI_TOKEN" }}'
+	TokenSHA256 string `yaml:"token_sha256,omitempty"` // Hex SHA-256 of the token instead, so the file holds no secret
+}
+
+// LoadUsers reads and renders a users file, as Load does a config file
+func LoadUsers(path string) ([]domain.APIUser, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+	rendered, err := render(filepath.Base(path), content)
+	if err != nil {
+		return nil, err
+	}
+
+	var file UsersFile
+	decoder := yaml.NewDecoder(bytes.NewReader(rendered))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid users file: %w", err)
+	}
+
+	var users []domain.APIUser
+	names := make(map[string]int)
+	tokens := make(map[[sha256.Size]byte]int)
+	for i, block := range file.Users {
+		user, err := block.toUser()
+		if err == nil {
+			err = user.Validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid users file: users[%d]: %w", i, err)
+		}
+		if j, ok := names[user.Name]; ok {
+			return nil, fmt.Errorf("invalid users file: users[%d]: name %q is already used by users[%d]", i, user.Name, j)
+		}
+		// The token alone tells users apart, so two users with one token would share a role
+		if j, ok := tokens[user.TokenSHA256]; ok {
+			return nil, fmt.Errorf("invalid users file: users[%d]: the token is already used by users[%d]", i, j)
+		}
+		names[user.Name], tokens[user.TokenSHA256] = i, i
+		users = append(users, user)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("invalid users file: no users configured")
+	}
+	return users, nil
+}
+
+func (b UserBlock) toUser() (domain.APIUser, error) {
+	switch {
+	case b.Token != "" && b.TokenSHA256 != "":
+		return domain.APIUser{}, fmt.Errorf("set token or token_sha256, not both")
+	case b.Token != "":
+		return domain.NewAPIUser(b.Name, domain.Role(b.Role), b.Token), nil
+	case b.TokenSHA256 == "":
+		return domain.APIUser{}, fmt.Errorf("token or token_sha256 is required")
+	}
+
+	sum, err := hex.DecodeString(b.TokenSHA256)
+	if err != nil || len(sum) != sha256.Size {
+		return domain.APIUser{}, fmt.Errorf("token_sha256 must be 64 hex digits, as sha256sum prints them")
+	}
+	user := domain.APIUser{Name: b.Name, Role: domain.Role(b.Role)}
+	copy(user.TokenSHA256[:], sum)
+	return user, nil
+}
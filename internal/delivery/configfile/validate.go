@@ -0,0 +1,300 @@
+package configfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// Problem is one issue found in a config file. Line is 0 when it cannot be attributed to a line.
+type Problem struct {
+	Line    int    `json:"line,omitempty"`
+	Path    string `json:"path,omitempty"` // e.g. databases[0].container
+	Message string `json:"message"`
+	Warning bool   `json:"warning,omitempty"` // Worth a look, but the file can still run
+}
+
+func (p Problem) Error() string {
+	if p.Path == "" {
+		return p.Message
+	}
+	return fmt.Sprintf("%s: %s", p.Path, p.Message)
+}
+
+var (
+	templateErrorLine = regexp.MustCompile(`^template: [^:]*:(\d+)(?::\d+)?: (.*)$`)
+	yamlErrorLine     = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+)
+
+// CheckFile reads a config file and reports every problem in it, rather than stopping at the first
+func CheckFile(path string) ([]Problem, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return Check(path, content), nil
+}
+
+// Check reports the schema errors, unknown keys, missing fields and unresolvable credentials in content.
+// Lines refer to the rendered file, which matches the source unless a template expression spans lines.
+func Check(name string, content []byte) []Problem {
+	rendered, problems, ok := renderChecked(name, content)
+	if !ok {
+		return problems
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(rendered, &root); err != nil {
+		return append(problems, yamlProblem(err.Error()))
+	}
+
+	version, err := migrate(&root)
+	if err != nil {
+		return append(problems, yamlProblem(err.Error()))
+	}
+
+	lines := make(map[string]int)
+	problems = append(problems, checkKeys(&root, reflect.TypeOf(File{}), "", lines)...)
+
+	// An empty file has nothing to decode; the checks below report what is missing
+	var file File
+	if root.Kind != 0 {
+		if err := root.Decode(&file); err != nil {
+			var typeErr *yaml.TypeError
+			if !errors.As(err, &typeErr) {
+				return append(problems, yamlProblem(err.Error()))
+			}
+			for _, message := range typeErr.Errors {
+				problems = append(problems, yamlProblem(message))
+			}
+		}
+	}
+
+	if version < CurrentVersion && root.Kind != 0 {
+		problems = append(problems, Problem{
+			Path:    "version",
+			Message: fmt.Sprintf("written for version %d and migrated on every load; set version: %d after checking the file", version, CurrentVersion),
+			Warning: true,
+		})
+	}
+
+	for _, problem := range append(file.problems(), file.credentialProblems()...) {
+		problem.Line = lineOf(lines, problem.Path)
+		problems = append(problems, problem)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+// renderChecked renders content like Load, but records every failed required call instead of stopping at
+// the first. ok is false when the template itself is broken.
+func renderChecked(name string, content []byte) (rendered []byte, problems []Problem, ok bool) {
+	funcs := templateFuncs()
+	funcs["required"] = func(message string, value interface{}) string {
+		s := fmt.Sprint(value)
+		if value == nil || s == "" {
+			problems = append(problems, Problem{
+				Line:    lineContaining(content, strconv.Quote(message)),
+				Message: fmt.Sprintf("unresolved value: %s", message),
+			})
+			return ""
+		}
+		return s
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(funcs).Parse(string(content))
+	if err == nil {
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, namePlaceholders()); err == nil {
+			return buf.Bytes(), problems, true
+		}
+	}
+
+	problem := Problem{Message: err.Error()}
+	if match := templateErrorLine.FindStringSubmatch(err.Error()); match != nil {
+		problem.Line, _ = strconv.Atoi(match[1])
+		problem.Message = match[2]
+	}
+	return nil, append(problems, problem), false
+}
+
+// credentialProblems flags credentials that will not be usable at run time
+func (f *File) credentialProblems() []Problem {
+	var problems []Problem
+
+	if f.Kubernetes != nil && f.Kubernetes.Kubeconfig != "" {
+		if _, err := os.Stat(f.Kubernetes.Kubeconfig); err != nil {
+			problems = append(problems, Problem{Path: "kubernetes.kubeconfig", Message: fmt.Sprintf("kubeconfig %s not found", f.Kubernetes.Kubeconfig)})
+		}
+	}
+
+	for _, entry := range f.databaseEntries() {
+		path, db := entry.path, entry.block
+		if db.Kubeconfig != "" {
+			if _, err := os.Stat(db.Kubeconfig); err != nil {
+				problems = append(problems, Problem{Path: path + ".kubeconfig", Message: fmt.Sprintf("kubeconfig %s not found", db.Kubeconfig)})
+			}
+		}
+
+		target := domain.DatabaseConfig{Type: domain.DatabaseType(db.Type), User: db.User, URI: db.URI, Version: db.Version, Managed: db.Managed.toOptions()}
+		if db.Password == "" && target.NeedsPassword() {
+			problems = append(problems, Problem{
+				Path:    path,
+				Message: "password is empty; check the environment variable it is read from",
+				Warning: true,
+			})
+		}
+	}
+
+	return problems
+}
+
+// checkKeys reports keys that t does not know, recording the line of every known key and list item in lines
+func checkKeys(node *yaml.Node, t reflect.Type, path string, lines map[string]int) []Problem {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var problems []Problem
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			problems = append(problems, checkKeys(child, t, path, lines)...)
+		}
+
+	case yaml.SequenceNode:
+		if t.Kind() != reflect.Slice {
+			return nil
+		}
+		for i, item := range node.Content {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			lines[itemPath] = item.Line
+			problems = append(problems, checkKeys(item, t.Elem(), itemPath, lines)...)
+		}
+
+	case yaml.MappingNode:
+		if t.Kind() != reflect.Struct {
+			return nil
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := joinPath(path, key.Value)
+
+			field, ok := fields[key.Value]
+			if !ok {
+				message := fmt.Sprintf("unknown key %q", key.Value)
+				if suggestion := closestKey(key.Value, fields); suggestion != "" {
+					message += fmt.Sprintf(", did you mean %q?", suggestion)
+				}
+				problems = append(problems, Problem{Line: key.Line, Path: path, Message: message})
+				continue
+			}
+
+			lines[keyPath] = key.Line
+			problems = append(problems, checkKeys(value, field, keyPath, lines)...)
+		}
+	}
+
+	return problems
+}
+
+// yamlFields maps the yaml keys of a struct to their field types
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = t.Field(i).Type
+		}
+	}
+	return fields
+}
+
+// closestKey suggests a known key for a likely typo, or returns "" when nothing is close
+func closestKey(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		if d := editDistance(key, name); d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// lineOf finds the line of path, falling back to its closest parent that appears in the file
+func lineOf(lines map[string]int, path string) int {
+	for path != "" {
+		if line, ok := lines[path]; ok {
+			return line
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return 0
+}
+
+// lineContaining returns the first line of content containing s, or 0
+func lineContaining(content []byte, s string) int {
+	for i, line := range strings.Split(string(content), "\n") {
+		if strings.Contains(line, s) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// yamlProblem turns a yaml error such as "yaml: line 3: mapping values are not allowed" into a Problem
+func yamlProblem(message string) Problem {
+	if match := yamlErrorLine.FindStringSubmatch(strings.TrimSpace(message)); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return Problem{Line: line, Message: match[2]}
+	}
+	return Problem{Message: message}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,337 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/wush/db-backup-tool/internal/delivery/configfile"
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// Paths inside the generated pod
+const (
+	configDir  = "/etc/backup-tool"
+	configFile = "backup.yaml"
+	backupDir  = "/backups"
+)
+
+// CronJobOptions describe the generated CronJob and the objects around it
+type CronJobOptions struct {
+	Name       string // Name of the CronJob, its ServiceAccount, RBAC and ConfigMap
+	Namespace  string // Namespace of the CronJob; empty uses the databases' namespace
+	Schedule   string
+	TimeZone   string // IANA zone for Schedule; empty uses the cluster's default
+	Image      string
+	Secret     string // Secret holding the passwords; empty uses <Name>-credentials
+	WithSecret bool   // Also render the Secret, filled with the passwords from the config
+	Claim      string // PersistentVolumeClaim for the backups; empty uses <Name>-backups
+	Storage    string // Size requested by the claim
+}
+
+// secretEnv is one value the pod reads from the Secret
+type secretEnv struct {
+	name  string // Environment variable
+	key   string // Key in the Secret
+	value string // Value from the config, for WithSecret
+}
+
+// CronJob renders a CronJob that runs the config inside the cluster on a schedule, with a
+// ServiceAccount allowed to exec into the database pods, the config in a ConfigMap, passwords
+// from a Secret and a volume for the backups. It returns the manifests and notes for the user.
+func CronJob(config domain.BackupConfig, options CronJobOptions) ([]byte, []string, error) {
+	if config.Method != domain.BackupMethodKubectlExec {
+		return nil, nil, fmt.Errorf("a CronJob needs method kubectl-exec, not %s: there is no Docker daemon to use in the cluster", config.Method)
+	}
+	if _, err := domain.ParseSchedule(options.Schedule); err != nil {
+		return nil, nil, err
+	}
+	// The pod writes everything to one volume, where tenants' backups would not be kept apart
+	if len(config.Tenants) > 0 {
+		return nil, nil, fmt.Errorf("a CronJob cannot keep the backups of tenants apart; run them with serve instead")
+	}
+	storage, err := resource.ParseQuantity(options.Storage)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid storage size %q: %w", options.Storage, err)
+	}
+
+	var notes []string
+	if config.Kubeconfig != "" || config.KubeContext != "" {
+		notes = append(notes, "the CronJob backs up the cluster it runs in; the kubeconfig and context of the config are left out, so apply the manifests to that cluster")
+		config.Kubeconfig, config.KubeContext = "", ""
+	}
+	for _, db := range config.Databases {
+		if db.Kubeconfig != "" || db.KubeContext != "" {
+			return nil, nil, fmt.Errorf("%s sets its own kubeconfig or context: a CronJob can only reach the cluster it runs in", db.Label)
+		}
+	}
+
+	dbNamespace := valueOrDefault(config.K8sNamespace, "default")
+	namespace := valueOrDefault(options.Namespace, dbNamespace)
+	secretName := valueOrDefault(options.Secret, options.Name+"-credentials")
+	claimName := valueOrDefault(options.Claim, options.Name+"-backups")
+
+	content, env, err := clusterConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta := func(name, namespace string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app.kubernetes.io/name": "backup-tool", "app.kubernetes.io/instance": options.Name},
+		}
+	}
+
+	rules := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}},
+		{APIGroups: []string{""}, Resources: []string{"pods/exec"}, Verbs: []string{"create"}},
+	}
+	for _, db := range config.Databases {
+		if db.Snapshot != nil {
+			rules = append(rules,
+				rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"persistentvolumeclaims"}, Verbs: []string{"get"}},
+				rbacv1.PolicyRule{APIGroups: []string{"snapshot.storage.k8s.io"}, Resources: []string{"volumesnapshots"}, Verbs: []string{"get", "create", "delete"}},
+			)
+			break
+		}
+	}
+
+	objects := []runtime.Object{
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: meta(options.Name, namespace),
+		},
+		&rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+			ObjectMeta: meta(options.Name, dbNamespace),
+			Rules:      rules,
+		},
+		&rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+			ObjectMeta: meta(options.Name, dbNamespace),
+			RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: options.Name},
+			Subjects:   []rbacv1.Subject{{Kind: "ServiceAccount", Name: options.Name, Namespace: namespace}},
+		},
+		&corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: meta(options.Name, namespace),
+			Data:       map[string]string{configFile: content},
+		},
+	}
+
+	if len(env) > 0 {
+		if options.WithSecret {
+			secret := &corev1.Secret{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+				ObjectMeta: meta(secretName, namespace),
+				StringData: make(map[string]string),
+			}
+			for _, e := range env {
+				secret.StringData[e.key] = e.value
+			}
+			objects = append(objects, secret)
+		} else {
+			command := fmt.Sprintf("kubectl -n %s create secret generic %s", namespace, secretName)
+			for _, e := range env {
+				command += fmt.Sprintf(" --from-literal=%s=...", e.key)
+			}
+			notes = append(notes, "create the Secret with the passwords before the first run: "+command)
+		}
+	}
+
+	objects = append(objects,
+		&corev1.PersistentVolumeClaim{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+			ObjectMeta: meta(claimName, namespace),
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: storage},
+				},
+			},
+		},
+		cronJob(meta(options.Name, namespace), options, secretName, claimName, env),
+	)
+
+	var out bytes.Buffer
+	for i, object := range objects {
+		if i > 0 {
+			out.WriteString("---\n")
+		}
+		manifest, err := marshal(object)
+		if err != nil {
+			return nil, nil, err
+		}
+		out.Write(manifest)
+	}
+	return out.Bytes(), notes, nil
+}
+
+// cronJob builds the CronJob itself
+func cronJob(meta metav1.ObjectMeta, options CronJobOptions, secretName, claimName string, env []secretEnv) *batchv1.CronJob {
+	var vars []corev1.EnvVar
+	for _, e := range env {
+		vars = append(vars, corev1.EnvVar{
+			Name: e.name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+					Key:                  e.key,
+				},
+			},
+		})
+	}
+
+	var timeZone *string
+	if options.TimeZone != "" {
+		timeZone = &options.TimeZone
+	}
+	history := int32(3)
+	backoffLimit := int32(0) // A failed backup is reported, not retried against a struggling database
+	fsGroup := int64(65532)  // The image runs as nonroot (65532) and must write to the volume
+
+	return &batchv1.CronJob{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+		ObjectMeta: meta,
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   options.Schedule,
+			TimeZone:                   timeZone,
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: &history,
+			FailedJobsHistoryLimit:     &history,
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: meta.Labels},
+						Spec: corev1.PodSpec{
+							ServiceAccountName: meta.Name,
+							RestartPolicy:      corev1.RestartPolicyNever,
+							SecurityContext:    &corev1.PodSecurityContext{FSGroup: &fsGroup},
+							Containers: []corev1.Container{{
+								Name:  "backup",
+								Image: options.Image,
+								Args:  []string{"-config", configDir + "/" + configFile},
+								Env:   vars,
+								VolumeMounts: []corev1.VolumeMount{
+									{Name: "config", MountPath: configDir, ReadOnly: true},
+									{Name: "backups", MountPath: backupDir},
+								},
+							}},
+							Volumes: []corev1.Volume{
+								{Name: "config", VolumeSource: corev1.VolumeSource{
+									ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: meta.Name}},
+								}},
+								{Name: "backups", VolumeSource: corev1.VolumeSource{
+									PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+								}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// clusterConfig writes the config file for the pod: backups go to the volume, and passwords
+// and MongoDB URIs are read from environment variables filled from the Secret
+func clusterConfig(config domain.BackupConfig) (string, []secretEnv, error) {
+	config.BackupDir = backupDir
+	config.AssignLabels()
+	config.Databases = append([]domain.DatabaseConfig(nil), config.Databases...)
+	for i := range config.Databases {
+		config.Databases[i].BackupDir = "" // Only the volume is mounted in the pod
+	}
+
+	var env []secretEnv
+	placeholders := make(map[string]string)
+	file := configfile.FromBackupConfig(config)
+	for i, db := range config.Databases {
+		block := &file.Databases[i]
+		if db.Password != "" || db.NeedsPassword() {
+			placeholder := fmt.Sprintf("__PASSWORD_%d__", i)
+			env = append(env, secretEnv{name: envName(db.Label, "PASSWORD"), key: secretKey(db.Label, "password"), value: db.Password})
+			placeholders[placeholder] = env[len(env)-1].name
+			block.Password = placeholder
+		}
+		if db.URI != "" {
+			placeholder := fmt.Sprintf("__URI_%d__", i)
+			env = append(env, secretEnv{name: envName(db.Label, "URI"), key: secretKey(db.Label, "uri"), value: db.URI})
+			placeholders[placeholder] = env[len(env)-1].name
+			block.URI = placeholder
+		}
+	}
+
+	var content bytes.Buffer
+	encoder := yaml.NewEncoder(&content)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(file); err != nil {
+		return "", nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	// quote keeps passwords with YAML special characters intact after rendering
+	rendered := content.String()
+	for placeholder, name := range placeholders {
+		rendered = strings.ReplaceAll(rendered, placeholder, fmt.Sprintf(`{{ env %q | required %q | quote }}`, name, name+" is not set"))
+	}
+	return rendered, env, nil
+}
+
+var nonAlnum = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// envName turns a label into an environment variable such as BACKUP_ORDERS_DB_PASSWORD
+func envName(label, suffix string) string {
+	return "BACKUP_" + strings.ToUpper(nonAlnum.ReplaceAllString(label, "_")) + "_" + suffix
+}
+
+// secretKey turns a label into a Secret key such as orders-db-password
+func secretKey(label, suffix string) string {
+	return strings.Trim(strings.ToLower(nonAlnum.ReplaceAllString(label, "-")), "-") + "-" + suffix
+}
+
+// marshal renders an object as YAML without the empty status and timestamps of unsaved objects
+func marshal(object runtime.Object) ([]byte, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render manifest: %w", err)
+	}
+	prune(content)
+	return sigsyaml.Marshal(content)
+}
+
+// prune removes null creationTimestamp fields and empty status objects
+func prune(content map[string]any) {
+	for key, value := range content {
+		switch v := value.(type) {
+		case nil:
+			if key == "creationTimestamp" {
+				delete(content, key)
+			}
+		case map[string]any:
+			prune(v)
+			if key == "status" && len(v) == 0 {
+				delete(content, key)
+			}
+		}
+	}
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
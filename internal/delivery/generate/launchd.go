@@ -0,0 +1,143 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// maxCalendarIntervals bounds the entries a schedule may expand to, as launchd lists every combination
+const maxCalendarIntervals = 1000
+
+// calendarKey is one field of a StartCalendarInterval entry and its value
+type calendarKey struct {
+	key   string
+	value int
+}
+
+// Launchd renders a launchd agent that runs the config with -quiet on the schedule, with the
+// variables of the environment file set. launchd runs a start missed during sleep on wake.
+func Launchd(options ServiceOptions) (UnitFile, []string, error) {
+	if err := options.validate(); err != nil {
+		return UnitFile{}, nil, err
+	}
+	switch {
+	case options.TimeZone != "":
+		return UnitFile{}, nil, fmt.Errorf("launchd runs schedules in the host's time zone and cannot set -timezone")
+	case len(options.Credentials) > 0:
+		return UnitFile{}, nil, fmt.Errorf("credentials are a systemd feature; pass the variables with -env-file instead")
+	case options.User != "" || options.UserUnit:
+		return UnitFile{}, nil, fmt.Errorf("a launchd agent runs as the user who loads it and cannot set -user or -user-unit")
+	}
+	intervals, err := calendarIntervals(options.Schedule)
+	if err != nil {
+		return UnitFile{}, nil, err
+	}
+
+	var env map[string]string
+	var notes []string
+	if options.EnvironmentFile != "" {
+		if env, err = ReadEnvironmentFile(options.EnvironmentFile); err != nil {
+			return UnitFile{}, nil, err
+		}
+		notes = append(notes, "the variables of the environment file are copied into the property list; keep it readable only by you and render it again after changing them")
+	}
+
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	out.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	out.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	plistString(&out, "\t", "Label", options.Name)
+	out.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range []string{options.Binary, "-config", options.Config, "-quiet"} {
+		plistValue(&out, "\t\t", "string", arg)
+	}
+	out.WriteString("\t</array>\n")
+
+	if len(env) > 0 {
+		keys := make([]string, 0, len(env))
+		for key := range env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+		for _, key := range keys {
+			plistString(&out, "\t\t", key, env[key])
+		}
+		out.WriteString("\t</dict>\n")
+	}
+
+	out.WriteString("\t<key>StartCalendarInterval</key>\n\t<array>\n")
+	for _, interval := range intervals {
+		out.WriteString("\t\t<dict>\n")
+		for _, field := range interval {
+			plistValue(&out, "\t\t\t", "key", field.key)
+			plistValue(&out, "\t\t\t", "integer", fmt.Sprint(field.value))
+		}
+		out.WriteString("\t\t</dict>\n")
+	}
+	out.WriteString("\t</array>\n")
+
+	if options.LogFile != "" {
+		plistString(&out, "\t", "StandardOutPath", options.LogFile)
+		plistString(&out, "\t", "StandardErrorPath", options.LogFile)
+	}
+	out.WriteString("</dict>\n</plist>\n")
+
+	return UnitFile{Name: options.Name + ".plist", Content: out.Bytes()}, notes, nil
+}
+
+// calendarIntervals expands a cron expression into StartCalendarInterval entries, one per combination
+// of the restricted fields. Cron's rule that either day field matches becomes entries for each.
+func calendarIntervals(schedule string) ([][]calendarKey, error) {
+	s, err := domain.ParseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	minute, hour, dom, month, dow := s.Values()
+
+	base := expand([][]calendarKey{nil}, "Month", month)
+	var intervals [][]calendarKey
+	switch {
+	case dom != nil && dow != nil:
+		intervals = append(expand(base, "Day", dom), expand(base, "Weekday", dow)...)
+	default:
+		intervals = expand(expand(base, "Day", dom), "Weekday", dow)
+	}
+	intervals = expand(expand(intervals, "Hour", hour), "Minute", minute)
+
+	if len(intervals) > maxCalendarIntervals {
+		return nil, fmt.Errorf("schedule %q expands to %d launchd start times, more than %d; use a simpler schedule", schedule, len(intervals), maxCalendarIntervals)
+	}
+	return intervals, nil
+}
+
+// expand adds every value of a field to each interval; a field without values is left out, matching any
+func expand(intervals [][]calendarKey, key string, values []int) [][]calendarKey {
+	if values == nil {
+		return intervals
+	}
+	expanded := make([][]calendarKey, 0, len(intervals)*len(values))
+	for _, interval := range intervals {
+		for _, v := range values {
+			expanded = append(expanded, append(append([]calendarKey(nil), interval...), calendarKey{key, v}))
+		}
+	}
+	return expanded
+}
+
+// plistString writes a key and its string value
+func plistString(out *bytes.Buffer, indent, key, value string) {
+	plistValue(out, indent, "key", key)
+	plistValue(out, indent, "string", value)
+}
+
+// plistValue writes one element with its text escaped
+func plistValue(out *bytes.Buffer, indent, element, text string) {
+	fmt.Fprintf(out, "%s<%s>", indent, element)
+	xml.EscapeText(out, []byte(text))
+	fmt.Fprintf(out, "</%s>\n", element)
+}
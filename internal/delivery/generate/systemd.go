@@ -0,0 +1,218 @@
+package generate
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// ServiceOptions describe a systemd service and timer, or a launchd agent, that runs a config on a schedule
+type ServiceOptions struct {
+	Name            string   // Name of the units, or label of the agent
+	Schedule        string   // Cron expression
+	TimeZone        string   // IANA zone for Schedule; empty uses the host's (systemd only)
+	Binary          string   // Absolute path of the backup-tool binary
+	Config          string   // Absolute path of the config file
+	User            string   // User a system service runs as; empty is root (systemd only)
+	UserUnit        bool     // Render user units, run by the user's service manager (systemd only)
+	EnvironmentFile string   // KEY=VALUE lines with the variables the config reads through env
+	Credentials     []string // NAME=path pairs the config reads through credential (systemd only)
+	LogFile         string   // Where the agent's output goes (launchd only)
+}
+
+// UnitFile is a rendered unit or property list and the file name it is installed under
+type UnitFile struct {
+	Name    string
+	Content []byte
+}
+
+var (
+	unitName       = regexp.MustCompile(`^[A-Za-z0-9:_.@-]+$`)
+	credentialName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	userName       = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$|^[0-9]+$`) // A user name or UID, as User= takes
+	systemdDays    = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+)
+
+// Systemd renders a oneshot service that runs the config with -quiet and a timer that starts it on
+// the schedule, catching up on a run missed while the host was off. It returns the units and notes for the user.
+func Systemd(options ServiceOptions) ([]UnitFile, []string, error) {
+	if err := options.validate(); err != nil {
+		return nil, nil, err
+	}
+	if options.UserUnit && options.User != "" {
+		return nil, nil, fmt.Errorf("a user unit runs as the user who enables it and cannot set -user")
+	}
+	if options.User != "" && !userName.MatchString(options.User) {
+		return nil, nil, fmt.Errorf("invalid user %q: use a user name or numeric UID", options.User)
+	}
+	credentials := make([][2]string, 0, len(options.Credentials))
+	for _, credential := range options.Credentials {
+		name, path, ok := strings.Cut(credential, "=")
+		if !ok || !credentialName.MatchString(name) || !filepath.IsAbs(path) {
+			return nil, nil, fmt.Errorf("credential %q must be NAME=/absolute/path", credential)
+		}
+		credentials = append(credentials, [2]string{name, path})
+	}
+	calendars, err := onCalendar(options.Schedule, options.TimeZone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var notes []string
+	var service bytes.Buffer
+	fmt.Fprintf(&service, "# Generated by backup-tool install; started by %s.timer\n", options.Name)
+	service.WriteString("[Unit]\n")
+	fmt.Fprintf(&service, "Description=Database backups of %s\n", escapeSpecifiers(options.Config))
+	service.WriteString("Wants=network-online.target\nAfter=network-online.target\n\n")
+	service.WriteString("[Service]\nType=oneshot\n")
+	fmt.Fprintf(&service, "ExecStart=%s -config %s -quiet\n", execArgument(options.Binary), execArgument(options.Config))
+	service.WriteString("TimeoutStartSec=infinity\n") // A dump takes as long as it takes; SIGTERM still stops it cleanly
+	if options.User != "" {
+		fmt.Fprintf(&service, "User=%s\n", options.User)
+	}
+	if options.EnvironmentFile != "" {
+		fmt.Fprintf(&service, "EnvironmentFile=%s\n", escapeSpecifiers(options.EnvironmentFile))
+	}
+	for _, credential := range credentials {
+		fmt.Fprintf(&service, "LoadCredential=%s:%s\n", credential[0], escapeSpecifiers(credential[1]))
+	}
+	service.WriteString("NoNewPrivileges=yes\nPrivateTmp=yes\n")
+	if options.EnvironmentFile == "" && len(credentials) == 0 {
+		notes = append(notes, "the service reads passwords from the config itself; keep it readable only by the service's user, or move them to -env-file or -credential")
+	}
+	if options.UserUnit {
+		notes = append(notes, "user units only run while the user is logged in unless lingering is on: loginctl enable-linger")
+	}
+
+	var timer bytes.Buffer
+	timer.WriteString("# Generated by backup-tool install\n")
+	timer.WriteString("[Unit]\n")
+	fmt.Fprintf(&timer, "Description=Schedule of %s.service (%s)\n\n", options.Name, escapeSpecifiers(options.Schedule))
+	timer.WriteString("[Timer]\n")
+	for _, calendar := range calendars {
+		fmt.Fprintf(&timer, "OnCalendar=%s\n", calendar)
+	}
+	timer.WriteString("Persistent=true\n\n")
+	timer.WriteString("[Install]\nWantedBy=timers.target\n")
+
+	return []UnitFile{
+		{Name: options.Name + ".service", Content: service.Bytes()},
+		{Name: options.Name + ".timer", Content: timer.Bytes()},
+	}, notes, nil
+}
+
+// validate checks the options shared by systemd units and launchd agents
+func (o ServiceOptions) validate() error {
+	if !unitName.MatchString(o.Name) {
+		return fmt.Errorf("invalid name %q: use letters, digits and :_.@-", o.Name)
+	}
+	if _, err := domain.ParseSchedule(o.Schedule); err != nil {
+		return err
+	}
+	if o.TimeZone != "" {
+		if _, err := time.LoadLocation(o.TimeZone); err != nil {
+			return fmt.Errorf("invalid time zone %q: %w", o.TimeZone, err)
+		}
+	}
+	for _, path := range []string{o.Binary, o.Config, o.EnvironmentFile} {
+		if path != "" && !filepath.IsAbs(path) {
+			return fmt.Errorf("%s must be an absolute path, as the service does not run in this directory", path)
+		}
+	}
+	return nil
+}
+
+// onCalendar turns a cron expression into OnCalendar= values. Cron runs on a day matching either day
+// field when both are restricted, where one calendar event needs both, so that takes two events.
+func onCalendar(schedule, timeZone string) ([]string, error) {
+	s, err := domain.ParseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	minute, hour, dom, month, dow := s.Values()
+	event := func(dom, dow []int) string {
+		var days []string
+		for _, d := range dow {
+			days = append(days, systemdDays[d])
+		}
+		calendar := fmt.Sprintf("*-%s-%s %s:%s:00", calendarField(month), calendarField(dom), calendarField(hour), calendarField(minute))
+		if len(days) > 0 {
+			calendar = strings.Join(days, ",") + " " + calendar
+		}
+		if timeZone != "" {
+			calendar += " " + timeZone
+		}
+		return calendar
+	}
+
+	if dom != nil && dow != nil {
+		return []string{event(dom, nil), event(nil, dow)}, nil
+	}
+	return []string{event(dom, dow)}, nil
+}
+
+// calendarField writes the values of one field as a list, or * for all of them
+func calendarField(values []int) string {
+	if values == nil {
+		return "*"
+	}
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%02d", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// escapeSpecifiers keeps systemd from expanding % specifiers in a value
+func escapeSpecifiers(value string) string {
+	return strings.ReplaceAll(value, "%", "%%")
+}
+
+// execArgument quotes an ExecStart= argument so spaces, quotes and $ reach the command as written
+func execArgument(arg string) string {
+	arg = strings.ReplaceAll(escapeSpecifiers(arg), "$", "$$")
+	if !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// ReadEnvironmentFile reads the KEY=VALUE lines of a file in the format of systemd's EnvironmentFile=,
+// skipping blank lines and # comments and removing quotes around a value
+func ReadEnvironmentFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return env, nil
+}
@@ -0,0 +1,37 @@
+package operator
+
+import (
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// resultCollector is the output service of a backup run by the controller: it keeps the results
+// for the resource status and prints nothing, since the controller logs one line per backup
+type resultCollector struct {
+	results []domain.BackupResult
+}
+
+func (c *resultCollector) PrintSummary(results []domain.BackupResult) {
+	c.results = results
+}
+
+func (c *resultCollector) PrintHeader()                                  {}
+func (c *resultCollector) PrintConfigSummary(config domain.BackupConfig) {}
+func (c *resultCollector) PrintEstimate(estimate domain.BackupEstimate)  {}
+func (c *resultCollector) PrintBackupStart(dbType domain.DatabaseType, config domain.DatabaseConfig, method domain.BackupMethod) {
+}
+func (c *resultCollector) PrintBackupResult(result domain.BackupResult) {}
+func (c *resultCollector) PrintRestoreStart(entry domain.CatalogEntry, target domain.DatabaseConfig, method domain.BackupMethod) {
+}
+func (c *resultCollector) PrintRestoreResult(result domain.RestoreResult) {}
+func (c *resultCollector) PrintCloneStart(config domain.CloneConfig)      {}
+func (c *resultCollector) PrintChain(chain domain.BackupChain)            {}
+func (c *resultCollector) PrintDumpSummary(summary domain.DumpSummary)    {}
+func (c *resultCollector) PrintSchemaDiff(diff domain.SchemaDiff)         {}
+func (c *resultCollector) PrintDrillResult(result domain.DrillResult)     {}
+func (c *resultCollector) PrintError(message string)                      {}
+func (c *resultCollector) PrintSuccess(message string)                    {}
+func (c *resultCollector) PrintCommand(where, command string)             {}
+func (c *resultCollector) PrintPhase(dbType domain.DatabaseType, label, phase string, elapsed time.Duration) {
+}
@@ -0,0 +1,388 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+	"github.com/wush/db-backup-tool/internal/usecase"
+)
+
+// checkInterval is how often schedules are evaluated when no resource changes
+const checkInterval = 30 * time.Second
+
+// Controller watches DatabaseBackup resources and backs up the selected pods on their schedule
+type Controller struct {
+	dynamic     dynamic.Interface
+	clientset   kubernetes.Interface
+	namespace   string // Empty watches every namespace
+	backupDir   string
+	kubeconfig  string
+	kubeContext string
+	newBackup   func(output domain.OutputService) *usecase.BackupUsecase
+	output      domain.OutputService
+}
+
+// NewController creates a controller for the given kubeconfig file and context; empty values
+// fall back to KUBECONFIG, ~/.kube/config or the in-cluster config. Backups are written under backupDir.
+func NewController(
+	kubeconfig, kubeContext, namespace, backupDir string,
+	newBackup func(output domain.OutputService) *usecase.BackupUsecase,
+	output domain.OutputService,
+) (*Controller, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubernetes config: %w", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	return &Controller{
+		dynamic:     dynamicClient,
+		clientset:   clientset,
+		namespace:   namespace,
+		backupDir:   backupDir,
+		kubeconfig:  kubeconfig,
+		kubeContext: kubeContext,
+		newBackup:   newBackup,
+		output:      output,
+	}, nil
+}
+
+// Run watches DatabaseBackup resources until ctx is cancelled. Backups run one at a time.
+func (c *Controller) Run(ctx context.Context) error {
+	if _, err := c.dynamic.Resource(Resource).Namespace(c.namespace).List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+		return fmt.Errorf("failed to list databasebackups (is the CRD installed?): %w", err)
+	}
+
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.dynamic, 10*time.Minute, c.namespace, nil)
+	informer := factory.ForResource(Resource).Informer()
+
+	wake := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { notify() },
+		UpdateFunc: func(any, any) { notify() },
+	})
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return ctx.Err()
+	}
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		for _, item := range informer.GetStore().List() {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if obj, ok := item.(*unstructured.Unstructured); ok {
+				c.reconcile(ctx, obj)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile backs up one resource if it is due and keeps its status current
+func (c *Controller) reconcile(ctx context.Context, obj *unstructured.Unstructured) {
+	var spec Spec
+	var status Status
+	if err := decode(obj, "spec", &spec); err != nil {
+		c.setInvalid(ctx, obj, status, err)
+		return
+	}
+	if err := decode(obj, "status", &status); err != nil {
+		status = Status{}
+	}
+
+	schedule, location, err := spec.validate()
+	if err != nil {
+		c.setInvalid(ctx, obj, status, err)
+		return
+	}
+
+	if spec.Suspend {
+		if status.Phase != PhaseSuspended {
+			c.updateStatus(ctx, obj, func(s *Status) {
+				s.Phase = PhaseSuspended
+				s.Message = ""
+				s.NextScheduleTime = nil
+			})
+		}
+		return
+	}
+
+	now := time.Now()
+	due := status.ObservedGeneration != obj.GetGeneration() && schedule == nil
+	var next time.Time
+	if schedule != nil {
+		last := obj.GetCreationTimestamp().Time
+		if status.LastScheduleTime != nil {
+			last = status.LastScheduleTime.Time
+		}
+		// Missed runs, e.g. while the operator was down, collapse into one
+		next = schedule.Next(last.In(location))
+		due = !next.IsZero() && !next.After(now)
+	}
+
+	if !due {
+		if status.Phase == "" || status.Phase == PhaseSuspended || status.Phase == PhaseInvalid || !sameTime(status.NextScheduleTime, next) {
+			c.updateStatus(ctx, obj, func(s *Status) {
+				if s.Phase == "" || s.Phase == PhaseSuspended || s.Phase == PhaseInvalid {
+					s.Phase = PhasePending
+					s.Message = ""
+				}
+				s.NextScheduleTime = timeOrNil(next)
+			})
+		}
+		return
+	}
+
+	c.backup(ctx, obj, spec, schedule, location, now)
+}
+
+// backup runs one backup of the resource and records the outcome in its status
+func (c *Controller) backup(ctx context.Context, obj *unstructured.Unstructured, spec Spec, schedule *domain.Schedule, location *time.Location, now time.Time) {
+	name := fmt.Sprintf("%s/%s", obj.GetNamespace(), obj.GetName())
+	c.updateStatus(ctx, obj, func(s *Status) {
+		s.Phase = PhaseRunning
+		s.Message = ""
+		s.LastScheduleTime = &metav1.Time{Time: now}
+		s.ObservedGeneration = obj.GetGeneration()
+	})
+
+	result, pod, err := c.runBackup(ctx, obj, spec, now)
+
+	var next time.Time
+	if schedule != nil {
+		next = schedule.Next(time.Now().In(location))
+	}
+	c.updateStatus(ctx, obj, func(s *Status) {
+		s.NextScheduleTime = timeOrNil(next)
+		if err != nil {
+			s.Phase = PhaseFailed
+			s.Message = err.Error()
+			return
+		}
+		s.Phase = PhaseSucceeded
+		s.Message = ""
+		s.LastSuccessfulTime = &metav1.Time{Time: time.Now()}
+		s.LastBackup = &LastBackup{
+			Path:      result.BackupPath,
+			Size:      result.Size,
+			SizeBytes: result.SizeBytes,
+			Pod:       pod,
+			Duration:  result.Duration.Round(time.Second).String(),
+		}
+	})
+
+	if err != nil {
+		c.output.PrintError(fmt.Sprintf("%s: %v", name, err))
+		return
+	}
+	c.output.PrintSuccess(fmt.Sprintf("%s: backed up %s to %s (%s)", name, pod, result.BackupPath, result.Size))
+}
+
+// runBackup resolves the pod and password of a resource and dumps its database
+func (c *Controller) runBackup(ctx context.Context, obj *unstructured.Unstructured, spec Spec, now time.Time) (domain.BackupResult, string, error) {
+	namespace := obj.GetNamespace()
+	pod, err := c.selectPod(ctx, namespace, spec.Target.PodSelector)
+	if err != nil {
+		return domain.BackupResult{}, "", err
+	}
+
+	password := ""
+	if ref := spec.Database.PasswordSecretRef; ref != nil {
+		if password, err = c.secretValue(ctx, namespace, *ref); err != nil {
+			return domain.BackupResult{}, pod, err
+		}
+	}
+
+	directory := spec.Storage.Directory
+	if directory == "" {
+		directory = namespace
+	}
+	label := spec.Database.Label
+	if label == "" {
+		label = obj.GetName()
+	}
+
+	config := domain.BackupConfig{
+		Method:       domain.BackupMethodKubectlExec,
+		Timestamp:    now,
+		BackupDir:    filepath.Join(c.backupDir, directory),
+		TempDir:      "/tmp/db-backups",
+		K8sNamespace: namespace,
+		Kubeconfig:   c.kubeconfig,
+		KubeContext:  c.kubeContext,
+		NameTemplate: spec.Storage.NameTemplate,
+		Databases: []domain.DatabaseConfig{{
+			Label:        label,
+			Type:         domain.DatabaseType(spec.Database.Type),
+			User:         spec.Database.User,
+			Password:     password,
+			Database:     spec.Database.Name,
+			Pod:          pod,
+			Tags:         spec.Database.Tags,
+			DumpMode:     domain.DumpMode(spec.Database.Mode),
+			AuthDatabase: spec.Database.AuthDatabase,
+		}},
+	}
+
+	results := &resultCollector{}
+	err = c.newBackup(results).ExecuteBackup(config, nil)
+	if len(results.results) == 0 {
+		if err == nil {
+			err = fmt.Errorf("backup produced no result")
+		}
+		return domain.BackupResult{}, pod, err
+	}
+
+	result := results.results[0]
+	if !result.Success {
+		return result, pod, fmt.Errorf("backup of %s failed: %w", pod, result.Error)
+	}
+	return result, pod, nil
+}
+
+// selectPod returns the first running pod matching selector, by name
+func (c *Controller) selectPod(ctx context.Context, namespace string, selector metav1.LabelSelector) (string, error) {
+	labelSelector, err := metav1.LabelSelectorAsSelector(&selector)
+	if err != nil {
+		return "", fmt.Errorf("invalid podSelector: %w", err)
+	}
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector.String()})
+	if err != nil {
+		return "", fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var running []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			running = append(running, pod.Name)
+		}
+	}
+	if len(running) == 0 {
+		return "", fmt.Errorf("no running pod matches %s in %s", labelSelector, namespace)
+	}
+	sort.Strings(running)
+	return running[0], nil
+}
+
+// secretValue reads one key of a Secret
+func (c *Controller) secretValue(ctx context.Context, namespace string, ref SecretKeyRef) (string, error) {
+	secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", ref.Name, err)
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+	}
+	return string(value), nil
+}
+
+// setInvalid reports a spec problem once instead of on every check
+func (c *Controller) setInvalid(ctx context.Context, obj *unstructured.Unstructured, status Status, err error) {
+	if status.Phase == PhaseInvalid && status.Message == err.Error() {
+		return
+	}
+	c.updateStatus(ctx, obj, func(s *Status) {
+		s.Phase = PhaseInvalid
+		s.Message = err.Error()
+		s.NextScheduleTime = nil
+		s.ObservedGeneration = obj.GetGeneration()
+	})
+	c.output.PrintError(fmt.Sprintf("%s/%s: %v", obj.GetNamespace(), obj.GetName(), err))
+}
+
+// updateStatus applies change to the latest version of the resource's status
+func (c *Controller) updateStatus(ctx context.Context, obj *unstructured.Unstructured, change func(s *Status)) {
+	resource := c.dynamic.Resource(Resource).Namespace(obj.GetNamespace())
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		var status Status
+		if err := decode(current, "status", &status); err != nil {
+			status = Status{}
+		}
+		change(&status)
+
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+		if err != nil {
+			return err
+		}
+		current.Object["status"] = content
+		_, err = resource.UpdateStatus(ctx, current, metav1.UpdateOptions{})
+		return err
+	})
+	// A resource deleted meanwhile needs no status
+	if err != nil && !apierrors.IsNotFound(err) {
+		c.output.PrintError(fmt.Sprintf("%s/%s: failed to update status: %v", obj.GetNamespace(), obj.GetName(), err))
+	}
+}
+
+// decode converts one top-level field of a resource into a typed value
+func decode(obj *unstructured.Unstructured, field string, into any) error {
+	content, ok := obj.Object[field].(map[string]any)
+	if !ok {
+		return nil
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(content, into)
+}
+
+func sameTime(a *metav1.Time, b time.Time) bool {
+	if a == nil {
+		return b.IsZero()
+	}
+	return a.Unix() == b.Unix()
+}
+
+func timeOrNil(t time.Time) *metav1.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &metav1.Time{Time: t}
+}
@@ -0,0 +1,126 @@
+package operator
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// Resource identifies DatabaseBackup custom resources
+var Resource = schema.GroupVersionResource{Group: "backup.wush.dev", Version: "v1alpha1", Resource: "databasebackups"}
+
+// Phases reported in DatabaseBackup status
+const (
+	PhasePending   = "Pending"
+	PhaseRunning   = "Running"
+	PhaseSucceeded = "Succeeded"
+	PhaseFailed    = "Failed"
+	PhaseSuspended = "Suspended"
+	PhaseInvalid   = "Invalid"
+)
+
+// Spec is the desired state of a DatabaseBackup
+type Spec struct {
+	Schedule string       `json:"schedule,omitempty"` // Cron expression; empty backs up once per change of the spec
+	TimeZone string       `json:"timeZone,omitempty"` // IANA zone for Schedule; empty is UTC
+	Suspend  bool         `json:"suspend,omitempty"`
+	Database DatabaseSpec `json:"database"`
+	Target   TargetSpec   `json:"target"`
+	Storage  StorageSpec  `json:"storage,omitempty"`
+}
+
+// DatabaseSpec describes the database inside the target pod
+type DatabaseSpec struct {
+	Type              string            `json:"type"`
+	Name              string            `json:"name"`
+	Label             string            `json:"label,omitempty"` // Empty uses the resource name
+	User              string            `json:"user,omitempty"`
+	AuthDatabase      string            `json:"authDatabase,omitempty"`
+	PasswordSecretRef *SecretKeyRef     `json:"passwordSecretRef,omitempty"`
+	Mode              string            `json:"mode,omitempty"`
+	Tags              map[string]string `json:"tags,omitempty"`
+}
+
+// SecretKeyRef points at one key of a Secret in the resource's namespace
+type SecretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// TargetSpec selects the pod to back up in the resource's namespace
+type TargetSpec struct {
+	PodSelector metav1.LabelSelector `json:"podSelector"`
+}
+
+// StorageSpec says where under the operator's backup directory the dumps go
+type StorageSpec struct {
+	Directory    string `json:"directory,omitempty"` // Relative path; empty uses the namespace
+	NameTemplate string `json:"nameTemplate,omitempty"`
+}
+
+// Status is the observed state of a DatabaseBackup
+type Status struct {
+	Phase              string       `json:"phase,omitempty"`
+	Message            string       `json:"message,omitempty"`
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	LastScheduleTime   *metav1.Time `json:"lastScheduleTime,omitempty"`
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	NextScheduleTime   *metav1.Time `json:"nextScheduleTime,omitempty"`
+	LastBackup         *LastBackup  `json:"lastBackup,omitempty"`
+}
+
+// LastBackup describes the most recent successful backup
+type LastBackup struct {
+	Path      string `json:"path"`
+	Size      string `json:"size,omitempty"`
+	SizeBytes int64  `json:"sizeBytes,omitempty"`
+	Pod       string `json:"pod"`
+	Duration  string `json:"duration"`
+}
+
+// validate checks the spec and returns its parsed schedule (nil without one) and time zone
+func (s Spec) validate() (*domain.Schedule, *time.Location, error) {
+	dbType := domain.DatabaseType(s.Database.Type)
+	switch {
+	case !dbType.IsValid():
+		return nil, nil, fmt.Errorf("database.type must be one of %v", domain.EngineTypes())
+	case s.Database.Name == "":
+		return nil, nil, fmt.Errorf("database.name is required")
+	case s.Database.User == "" && dbType != domain.DatabaseTypeMongoDB:
+		return nil, nil, fmt.Errorf("database.user is required")
+	case !domain.DumpMode(s.Database.Mode).IsValid():
+		return nil, nil, fmt.Errorf("database.mode must be full, schema-only or data-only")
+	case len(s.Target.PodSelector.MatchLabels) == 0 && len(s.Target.PodSelector.MatchExpressions) == 0:
+		return nil, nil, fmt.Errorf("target.podSelector must not be empty")
+	case s.Storage.Directory != "" && !filepath.IsLocal(s.Storage.Directory):
+		return nil, nil, fmt.Errorf("storage.directory must be a relative path inside the backup directory")
+	}
+	if err := domain.Tags(s.Database.Tags).Validate(); err != nil {
+		return nil, nil, fmt.Errorf("database.tags: %w", err)
+	}
+	if ref := s.Database.PasswordSecretRef; ref != nil && (ref.Name == "" || ref.Key == "") {
+		return nil, nil, fmt.Errorf("database.passwordSecretRef needs name and key")
+	}
+
+	location := time.UTC
+	if s.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(s.TimeZone); err != nil {
+			return nil, nil, fmt.Errorf("invalid timeZone: %w", err)
+		}
+	}
+
+	if s.Schedule == "" {
+		return nil, location, nil
+	}
+	schedule, err := domain.ParseSchedule(s.Schedule)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &schedule, location, nil
+}
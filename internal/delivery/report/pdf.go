@@ -0,0 +1,178 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// Layout of the PDF pages: A4 portrait with 8 point Courier, whose glyphs are 0.6 em wide
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	pageMargin   = 40
+	fontSize     = 8
+	lineHeight   = 10
+	lineColumns  = (pageWidth - 2*pageMargin) * 10 / (6 * fontSize)
+	linesPerPage = (pageHeight - 2*pageMargin) / lineHeight
+)
+
+// pdfTimeFormat is how times are written in the PDF, in the zone of the report's period
+const pdfTimeFormat = "2006-01-02 15:04:05"
+
+// renderPDF writes the report as plain text pages, which is all an auditor's evidence needs
+// and keeps the tool free of a PDF library
+func renderPDF(report domain.ComplianceReport) []byte {
+	var lines []string
+	add := func(format string, args ...any) {
+		lines = append(lines, wrap(fmt.Sprintf(format, args...), lineColumns)...)
+	}
+	stamp := func(t time.Time) string {
+		return t.In(report.From.Location()).Format(pdfTimeFormat)
+	}
+
+	add("BACKUP COMPLIANCE REPORT")
+	add("")
+	add("Backup directory:  %s", report.BackupDir)
+	add("Period:            %s to %s", stamp(report.From), stamp(report.To))
+	add("Generated:         %s", stamp(report.GeneratedAt))
+	add("")
+	add("SUMMARY")
+	add("  Backups taken:     %d (%s)", len(report.Backups), domain.FormatBytes(report.TotalBytes()))
+	add("  Failed backups:    %d", len(report.Failures))
+	add("  Restore drills:    %d, %d failed", len(report.Verifications), report.FailedVerifications())
+	add("  Backups removed:   %d", len(report.Removals))
+
+	add("")
+	add("BACKUPS")
+	if len(report.Backups) == 0 {
+		add("  None")
+	}
+	for _, entry := range report.Backups {
+		add("  %s  %-11s %-24s %10s  %s", stamp(entry.CreatedAt), entry.DatabaseType, label(entry), domain.FormatBytes(entry.SizeBytes), entry.Path)
+		if removed := report.RemovedAt(entry.Path); !removed.IsZero() {
+			add("      removed %s", stamp(removed))
+		}
+	}
+
+	sections := []struct {
+		title  string
+		events []domain.AuditEvent
+	}{
+		{"FAILED BACKUPS", report.Failures},
+		{"RESTORE DRILLS", report.Verifications},
+		{"REMOVALS", report.Removals},
+	}
+	for _, section := range sections {
+		add("")
+		add("%s", section.title)
+		if len(section.events) == 0 {
+			add("  None")
+		}
+		for _, event := range section.events {
+			result := ""
+			switch {
+			case event.Kind != domain.AuditEventDrill:
+			case event.Passed:
+				result = "PASSED  "
+			default:
+				result = "FAILED  "
+			}
+			add("  %s  %-11s %-24s %s%s", stamp(event.Time), event.Backup.DatabaseType, label(event.Backup), result, event.Backup.Path)
+			if event.Detail != "" {
+				add("      %s", event.Detail)
+			}
+		}
+	}
+
+	var pages [][]string
+	for len(lines) > linesPerPage {
+		pages = append(pages, lines[:linesPerPage])
+		lines = lines[linesPerPage:]
+	}
+	return writePDF(append(pages, lines))
+}
+
+// label names the database of entry by its label, falling back to the database name
+func label(entry domain.CatalogEntry) string {
+	if entry.Label != "" {
+		return entry.Label
+	}
+	return entry.Database
+}
+
+// wrap breaks line into pieces of at most columns characters, indenting the continuations
+func wrap(line string, columns int) []string {
+	runes := []rune(line)
+	var lines []string
+	for len(runes) > columns {
+		lines = append(lines, string(runes[:columns]))
+		runes = append([]rune("        "), runes[columns:]...)
+	}
+	return append(lines, string(runes))
+}
+
+// writePDF writes a PDF 1.4 document with one page of text per element of pages
+func writePDF(pages [][]string) []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 3 are the catalog, the page tree and the font; each page is followed by its content
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", fontSize, lineHeight, pageMargin, pageHeight-pageMargin-fontSize)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) '\n", pdfString(line))
+		}
+		fmt.Fprintf(&content, "ET\nBT\n/F1 %d Tf\n%d %d Td\n(Page %d of %d) Tj\nET\n", fontSize, pageMargin, pageMargin/2, i+1, len(pages))
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfString escapes s for a PDF string literal in WinAnsiEncoding, replacing characters
+// outside Latin-1 with "?"
+func pdfString(s string) string {
+	var out strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			out.WriteByte('\\')
+			out.WriteByte(byte(r))
+		case r < 32:
+			out.WriteByte(' ')
+		case r < 256:
+			out.WriteByte(byte(r))
+		default:
+			out.WriteByte('?')
+		}
+	}
+	return out.String()
+}
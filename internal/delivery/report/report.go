@@ -0,0 +1,160 @@
+// Package report renders compliance reports as CSV, JSON or PDF
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// Formats are the formats Render writes
+var Formats = []string{"csv", "json", "pdf"}
+
+// Render writes report in format, one of Formats
+func Render(report domain.ComplianceReport, format string) ([]byte, error) {
+	switch format {
+	case "csv":
+		return renderCSV(report)
+	case "json":
+		return renderJSON(report)
+	case "pdf":
+		return renderPDF(report), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected csv, json or pdf", format)
+	}
+}
+
+// row is one line of the CSV report: a backup or an event of the period
+type row struct {
+	record string // backup, backup_failed, drill or removal
+	time   time.Time
+	entry  domain.CatalogEntry
+	result string
+	detail string
+}
+
+// rows lists the backups and events of report in the order they happened
+func rows(report domain.ComplianceReport) []row {
+	var rows []row
+	for _, entry := range report.Backups {
+		r := row{record: "backup", time: entry.CreatedAt, entry: entry, result: "ok"}
+		if removed := report.RemovedAt(entry.Path); !removed.IsZero() {
+			r.detail = "removed " + removed.Format(time.RFC3339)
+		}
+		rows = append(rows, r)
+	}
+	for _, event := range report.Failures {
+		rows = append(rows, row{record: string(event.Kind), time: event.Time, entry: event.Backup, result: "failed", detail: event.Detail})
+	}
+	for _, event := range report.Verifications {
+		result := "failed"
+		if event.Passed {
+			result = "passed"
+		}
+		rows = append(rows, row{record: string(event.Kind), time: event.Time, entry: event.Backup, result: result, detail: event.Detail})
+	}
+	for _, event := range report.Removals {
+		rows = append(rows, row{record: string(event.Kind), time: event.Time, entry: event.Backup, result: "removed", detail: event.Detail})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].time.Before(rows[j].time)
+	})
+	return rows
+}
+
+// renderCSV writes one line per backup and event, so the report can be filtered in a spreadsheet
+func renderCSV(report domain.ComplianceReport) ([]byte, error) {
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+	w.Write([]string{"record", "time", "database_type", "database", "label", "path", "size_bytes", "run_id", "result", "detail"})
+	for _, r := range rows(report) {
+		size := ""
+		if r.entry.SizeBytes > 0 {
+			size = strconv.FormatInt(r.entry.SizeBytes, 10)
+		}
+		w.Write([]string{
+			r.record,
+			r.time.Format(time.RFC3339),
+			r.entry.DatabaseType.String(),
+			r.entry.Database,
+			r.entry.Label,
+			r.entry.Path,
+			size,
+			r.entry.RunID,
+			r.result,
+			r.detail,
+		})
+	}
+	w.Flush()
+	return out.Bytes(), w.Error()
+}
+
+// jsonReport is the JSON form of a compliance report
+type jsonReport struct {
+	BackupDir     string              `json:"backup_dir"`
+	From          time.Time           `json:"from"`
+	To            time.Time           `json:"to"`
+	GeneratedAt   time.Time           `json:"generated_at"`
+	Summary       jsonSummary         `json:"summary"`
+	Backups       []jsonBackup        `json:"backups"`
+	FailedBackups []domain.AuditEvent `json:"failed_backups"`
+	Verifications []domain.AuditEvent `json:"verifications"`
+	Removals      []domain.AuditEvent `json:"removals"`
+}
+
+type jsonSummary struct {
+	Backups             int    `json:"backups"`
+	SizeBytes           int64  `json:"size_bytes"`
+	Size                string `json:"size"`
+	FailedBackups       int    `json:"failed_backups"`
+	Verifications       int    `json:"verifications"`
+	FailedVerifications int    `json:"failed_verifications"`
+	Removals            int    `json:"removals"`
+}
+
+// jsonBackup is a catalog entry with when it was removed, if it was in the period
+type jsonBackup struct {
+	domain.CatalogEntry
+	RemovedAt *time.Time `json:"removed_at,omitempty"`
+}
+
+func renderJSON(report domain.ComplianceReport) ([]byte, error) {
+	out := jsonReport{
+		BackupDir:   report.BackupDir,
+		From:        report.From,
+		To:          report.To,
+		GeneratedAt: report.GeneratedAt,
+		Summary: jsonSummary{
+			Backups:             len(report.Backups),
+			SizeBytes:           report.TotalBytes(),
+			Size:                domain.FormatBytes(report.TotalBytes()),
+			FailedBackups:       len(report.Failures),
+			Verifications:       len(report.Verifications),
+			FailedVerifications: report.FailedVerifications(),
+			Removals:            len(report.Removals),
+		},
+		Backups:       make([]jsonBackup, 0, len(report.Backups)),
+		FailedBackups: append([]domain.AuditEvent{}, report.Failures...),
+		Verifications: append([]domain.AuditEvent{}, report.Verifications...),
+		Removals:      append([]domain.AuditEvent{}, report.Removals...),
+	}
+	for _, entry := range report.Backups {
+		backup := jsonBackup{CatalogEntry: entry}
+		if removed := report.RemovedAt(entry.Path); !removed.IsZero() {
+			backup.RemovedAt = &removed
+		}
+		out.Backups = append(out.Backups, backup)
+	}
+
+	content, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
@@ -0,0 +1,249 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	backupv1 "github.com/wush/db-backup-tool/api/backup/v1"
+	"github.com/wush/db-backup-tool/internal/domain"
+	"github.com/wush/db-backup-tool/internal/usecase"
+)
+
+// Server exposes the daemon usecase over gRPC. Every call needs "authorization: Bearer <token>"
+// metadata with the token of a user whose role allows it.
+type Server struct {
+	backupv1.UnimplementedBackupServiceServer
+
+	daemon *usecase.DaemonUsecase
+	users  []domain.APIUser
+}
+
+// permissions is what each method needs; methods missing here are refused
+var permissions = map[string]domain.Permission{
+	backupv1.BackupService_StartBackup_FullMethodName:  domain.PermissionBackup,
+	backupv1.BackupService_StartRestore_FullMethodName: domain.PermissionRestore,
+	backupv1.BackupService_GetRun_FullMethodName:       domain.PermissionView,
+	backupv1.BackupService_ListRuns_FullMethodName:     domain.PermissionView,
+	backupv1.BackupService_WatchRun_FullMethodName:     domain.PermissionView,
+	backupv1.BackupService_ListBackups_FullMethodName:  domain.PermissionView,
+}
+
+// NewServer creates a gRPC server for the daemon usecase and users, of whom there must be at least one
+func NewServer(daemon *usecase.DaemonUsecase, users []domain.APIUser) (*grpc.Server, error) {
+	if len(users) == 0 {
+		return nil, fmt.Errorf("an API token is required")
+	}
+
+	s := &Server{daemon: daemon, users: users}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := s.authorize(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorize(stream.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	backupv1.RegisterBackupServiceServer(server, s)
+	return server, nil
+}
+
+// authorize rejects calls without the token of a user, and those the user's role does not allow
+func (s *Server) authorize(ctx context.Context, method string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(value, "Bearer ")
+		user, found := domain.FindAPIUser(s.users, token)
+		if !ok || !found {
+			continue
+		}
+		permission, ok := permissions[method]
+		if !ok {
+			return status.Errorf(codes.PermissionDenied, "%s is not available", method)
+		}
+		if !user.Role.Allows(permission) {
+			return status.Errorf(codes.PermissionDenied, "%s's role %s does not allow %s", user.Name, user.Role, permission)
+		}
+		return nil
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+// StartBackup starts a backup of the configured databases
+func (s *Server) StartBackup(ctx context.Context, req *backupv1.StartBackupRequest) (*backupv1.Run, error) {
+	filter := domain.Tags(req.GetOnly())
+	if err := filter.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	run, err := s.daemon.StartRun(filter)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toRun(run), nil
+}
+
+// StartRestore restores a catalog entry into its configured database
+func (s *Server) StartRestore(ctx context.Context, req *backupv1.StartRestoreRequest) (*backupv1.Run, error) {
+	run, err := s.daemon.StartRestore(req.GetBackupId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toRun(run), nil
+}
+
+// GetRun returns one run
+func (s *Server) GetRun(ctx context.Context, req *backupv1.GetRunRequest) (*backupv1.Run, error) {
+	run, ok := s.daemon.GetRun(req.GetId())
+	if !ok {
+		return nil, status.Error(codes.NotFound, domain.ErrRunNotFound.Error())
+	}
+	return toRun(run), nil
+}
+
+// ListRuns returns the runs kept in memory, newest first
+func (s *Server) ListRuns(ctx context.Context, req *backupv1.ListRunsRequest) (*backupv1.ListRunsResponse, error) {
+	response := &backupv1.ListRunsResponse{}
+	for _, run := range s.daemon.ListRuns() {
+		response.Runs = append(response.Runs, toRun(run))
+	}
+	return response, nil
+}
+
+// WatchRun streams a run until it has finished
+func (s *Server) WatchRun(req *backupv1.WatchRunRequest, stream grpc.ServerStreamingServer[backupv1.Run]) error {
+	err := s.daemon.WatchRun(stream.Context(), req.GetId(), func(run domain.Run) error {
+		return stream.Send(toRun(run))
+	})
+	if err != nil {
+		return toStatus(err)
+	}
+	return nil
+}
+
+// ListBackups returns the catalog, newest first
+func (s *Server) ListBackups(ctx context.Context, req *backupv1.ListBackupsRequest) (*backupv1.ListBackupsResponse, error) {
+	entries, err := s.daemon.ListBackups()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	response := &backupv1.ListBackupsResponse{}
+	for _, entry := range entries {
+		response.Backups = append(response.Backups, &backupv1.Backup{
+			Id:           entry.ID,
+			DatabaseType: entry.DatabaseType.String(),
+			Database:     entry.Database,
+			Label:        entry.Label,
+			Tags:         entry.Tags,
+			Method:       entry.Method.String(),
+			Source:       entry.Source,
+			Path:         entry.Path,
+			Size:         entry.Size,
+			SizeBytes:    entry.SizeBytes,
+			CreatedAt:    timestamppb.New(entry.CreatedAt),
+			Duration:     durationpb.New(entry.Duration),
+		})
+	}
+	return response, nil
+}
+
+// toStatus maps usecase errors to gRPC status codes
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrRunInProgress):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, domain.ErrRunNotFound), errors.Is(err, domain.ErrBackupNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, domain.ErrNoRestoreTarget):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+var runKinds = map[domain.RunKind]backupv1.RunKind{
+	domain.RunKindBackup:  backupv1.RunKind_RUN_KIND_BACKUP,
+	domain.RunKindRestore: backupv1.RunKind_RUN_KIND_RESTORE,
+}
+
+var runStatuses = map[domain.RunStatus]backupv1.RunStatus{
+	domain.RunStatusRunning:   backupv1.RunStatus_RUN_STATUS_RUNNING,
+	domain.RunStatusSucceeded: backupv1.RunStatus_RUN_STATUS_SUCCEEDED,
+	domain.RunStatusFailed:    backupv1.RunStatus_RUN_STATUS_FAILED,
+}
+
+func toRun(run domain.Run) *backupv1.Run {
+	response := &backupv1.Run{
+		Id:        run.ID,
+		Kind:      runKinds[run.Kind],
+		Status:    runStatuses[run.Status],
+		Filter:    run.Filter,
+		BackupId:  run.Backup,
+		Current:   run.Current,
+		StartedAt: timestamppb.New(run.StartedAt),
+		Error:     run.Error,
+	}
+	if !run.FinishedAt.IsZero() {
+		response.FinishedAt = timestamppb.New(run.FinishedAt)
+	}
+
+	for _, result := range run.Results {
+		response.Results = append(response.Results, &backupv1.BackupResult{
+			DatabaseType: result.DatabaseType.String(),
+			Database:     result.Database,
+			Label:        result.Label,
+			Tags:         result.Tags,
+			Success:      result.Success,
+			BackupPath:   result.BackupPath,
+			Size:         result.Size,
+			SizeBytes:    result.SizeBytes,
+			Error:        errorString(result.Error),
+			ErrorKind:    domain.ErrorKind(result.Error),
+			Stderr:       result.Stderr,
+			Duration:     durationpb.New(result.Duration),
+		})
+	}
+
+	if result := run.Restore; result != nil {
+		response.Restore = &backupv1.RestoreResult{
+			DatabaseType: result.DatabaseType.String(),
+			Database:     result.Database,
+			BackupPath:   result.BackupPath,
+			Success:      result.Success,
+			PreparedDir:  result.PreparedDir,
+			Error:        errorString(result.Error),
+			ErrorKind:    domain.ErrorKind(result.Error),
+			Stderr:       result.Stderr,
+			Duration:     durationpb.New(result.Duration),
+		}
+	}
+	return response
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
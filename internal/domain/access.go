@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+)
+
+// Role decides what an API user may do. Every role may do what the ones before it may.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // Lists runs and backups
+	RoleOperator Role = "operator" // Also starts backups and downloads backups
+	RoleAdmin    Role = "admin"    // Also restores backups, overwriting databases
+)
+
+// Permission is something the API lets users with a role do
+type Permission string
+
+const (
+	PermissionView     Permission = "view"
+	PermissionBackup   Permission = "backup"
+	PermissionDownload Permission = "download"
+	PermissionRestore  Permission = "restore"
+)
+
+// IsValid reports whether r is a known role
+func (r Role) IsValid() bool {
+	return r == RoleViewer || r == RoleOperator || r == RoleAdmin
+}
+
+// Allows reports whether users with the role may do p
+func (r Role) Allows(p Permission) bool {
+	switch p {
+	case PermissionView:
+		return r.IsValid()
+	case PermissionBackup, PermissionDownload:
+		return r == RoleOperator || r == RoleAdmin
+	case PermissionRestore:
+		return r == RoleAdmin
+	}
+	return false
+}
+
+// Permissions lists what the role allows, so clients can offer only that
+func (r Role) Permissions() []Permission {
+	var permissions []Permission
+	for _, p := range []Permission{PermissionView, PermissionBackup, PermissionDownload, PermissionRestore} {
+		if r.Allows(p) {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
+
+// APIUser is a person, or a system such as a CI job, calling the API with a token of its own.
+// Only the token's SHA-256 is kept.
+type APIUser struct {
+	Name        string
+	Role        Role
+	TokenSHA256 [sha256.Size]byte
+}
+
+// NewAPIUser creates a user who authenticates with token
+func NewAPIUser(name string, role Role, token string) APIUser {
+	return APIUser{Name: name, Role: role, TokenSHA256: sha256.Sum256([]byte(token))}
+}
+
+// Validate checks that the user has a name and a known role
+func (u APIUser) Validate() error {
+	if u.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !u.Role.IsValid() {
+		return fmt.Errorf("invalid role %q, expected %s, %s or %s", u.Role, RoleViewer, RoleOperator, RoleAdmin)
+	}
+	return nil
+}
+
+// FindAPIUser returns the user whose token is token. Every user is compared in constant time,
+// so how long it takes tells nothing about the tokens.
+func FindAPIUser(users []APIUser, token string) (APIUser, bool) {
+	sum := sha256.Sum256([]byte(token))
+	var found APIUser
+	ok := false
+	for _, user := range users {
+		if subtle.ConstantTimeCompare(sum[:], user.TokenSHA256[:]) == 1 && !ok {
+			found, ok = user, true
+		}
+	}
+	return found, ok
+}
@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// pointInTimeFormats are the forms restore -at accepts, in local time unless they carry an offset
+var pointInTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// BackupChain is a full backup and the differential backups that build on it. Each
+// differential backup holds every change since the full backup, so restoring the newest
+// state needs only the full backup and the newest differential one.
+type BackupChain struct {
+	Full         CatalogEntry
+	Differential []CatalogEntry // Newest first
+}
+
+// RestoreChain returns the backups a restore of the newest state in the chain applies, in order
+func (c BackupChain) RestoreChain() []CatalogEntry {
+	if len(c.Differential) == 0 {
+		return []CatalogEntry{c.Full}
+	}
+	return []CatalogEntry{c.Full, c.Differential[0]}
+}
+
+// IsDifferential reports whether the backup builds on a full backup
+func (e CatalogEntry) IsDifferential() bool {
+	return e.Base != ""
+}
+
+// Chains groups entries, newest first as ListEntries returns them, into chains, newest chain
+// first. Differential backups whose full backup is not among the entries are returned as
+// broken, since they can no longer be restored.
+func Chains(entries []CatalogEntry) (chains []BackupChain, broken []CatalogEntry) {
+	index := make(map[string]int)
+	for _, entry := range entries {
+		if !entry.IsDifferential() {
+			index[filepath.Clean(entry.Path)] = len(chains)
+			chains = append(chains, BackupChain{Full: entry})
+		}
+	}
+	for _, entry := range entries {
+		if !entry.IsDifferential() {
+			continue
+		}
+		i, ok := index[filepath.Clean(entry.Base)]
+		if !ok {
+			broken = append(broken, entry)
+			continue
+		}
+		chains[i].Differential = append(chains[i].Differential, entry)
+	}
+	return chains, broken
+}
+
+// ParsePointInTime parses the time a restore should reach, e.g. "2024-05-01 14:00"
+func ParsePointInTime(s string) (time.Time, error) {
+	for _, layout := range pointInTimeFormats {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid point in time %q, expected e.g. \"2006-01-02 15:04\"", s)
+}
+
+// PointInTime picks from the entries of one database, newest first, the backup a restore to at
+// applies. Within the chain of the newest full backup taken before at, that is the oldest
+// differential backup taken after at, whose oplog is replayed up to at; otherwise the newest
+// backup of the chain, which is as close to at as the backups get.
+func PointInTime(entries []CatalogEntry, at time.Time) (CatalogEntry, error) {
+	chains, _ := Chains(entries)
+	for _, chain := range chains {
+		if chain.Full.CreatedAt.After(at) {
+			continue
+		}
+		for i := len(chain.Differential) - 1; i >= 0; i-- {
+			if !chain.Differential[i].CreatedAt.Before(at) {
+				return chain.Differential[i], nil
+			}
+		}
+		restore := chain.RestoreChain()
+		return restore[len(restore)-1], nil
+	}
+	return CatalogEntry{}, fmt.Errorf("no backup was taken before %s", at.Format("2006-01-02 15:04:05"))
+}
+
+// Dependents returns the entries that build on the backup at path
+func Dependents(entries []CatalogEntry, path string) []CatalogEntry {
+	var dependents []CatalogEntry
+	for _, entry := range entries {
+		if entry.IsDifferential() && filepath.Clean(entry.Base) == filepath.Clean(path) {
+			dependents = append(dependents, entry)
+		}
+	}
+	return dependents
+}
+
+// BaseInUseError is returned when removing a full backup that differential backups still build on
+type BaseInUseError struct {
+	Path       string
+	Dependents []CatalogEntry
+}
+
+func (e *BaseInUseError) Error() string {
+	return fmt.Sprintf("%s is the full backup of %d differential backups; remove them first", e.Path, len(e.Dependents))
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// ChecksumExt is appended to the path of a backup to name the file listing the SHA-256 of
+// each of its files, as sha256sum prints them. It is written before the backup is copied to
+// stores and travels with the copy, so a copy fetched back can be checked.
+const ChecksumExt = ".sha256"
+
+// ErrNoChecksum is returned when checking a backup that has no checksum file, such as one
+// copied to a store before checksums were written
+var ErrNoChecksum = errors.New("no checksum file")
+
+// ErrChecksumMismatch is returned for a backup whose files no longer have the SHA-256 its
+// checksum file lists
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ChecksumPath returns where the checksum file of the backup at backupPath is kept
+func ChecksumPath(backupPath string) string {
+	return strings.TrimSuffix(backupPath, string(filepath.Separator)) + ChecksumExt
+}
+
+// IsChecksumFile reports whether path is the checksum file of a backup rather than a backup
+func IsChecksumFile(path string) bool {
+	return strings.HasSuffix(path, ChecksumExt)
+}
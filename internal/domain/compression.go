@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tools that compress backups on the host
+const (
+	CompressionGzip = "gzip" // Go's built-in gzip, on one thread
+	CompressionPigz = "pigz" // pigz, gzip on several threads; it has to be installed
+	CompressionZstd = "zstd" // zstd on several threads, for backups named .zst; it has to be installed
+)
+
+// Compressed extensions of backup names, which pick how the backups are compressed
+const (
+	GzipExt = ".gz"
+	ZstdExt = ".zst"
+)
+
+// Compression sets how backups are compressed on their way to disk. The name of a backup
+// picks the format: names ending in .gz are gzipped, with Go's gzip or pigz, names ending
+// in .zst are compressed with zstd, and other names are left alone.
+type Compression struct {
+	Tool    string // CompressionGzip, CompressionPigz or CompressionZstd; empty is CompressionGzip
+	Threads int    // pigz and zstd threads; zero uses one per CPU
+}
+
+// Validate checks that the tool is known
+func (c Compression) Validate() error {
+	switch c.Tool {
+	case "", CompressionGzip, CompressionPigz, CompressionZstd:
+	default:
+		return fmt.Errorf("unknown tool %q, expected gzip, pigz or zstd", c.Tool)
+	}
+	if c.Threads < 0 {
+		return fmt.Errorf("threads must not be negative")
+	}
+	return nil
+}
+
+// Name returns the name a backup gets with c: zstd compresses every backup that would be
+// gzipped instead, so it swaps a .gz suffix for .zst
+func (c Compression) Name(name string) string {
+	if c.Tool == CompressionZstd {
+		if base, ok := strings.CutSuffix(name, GzipExt); ok {
+			return base + ZstdExt
+		}
+	}
+	return name
+}
+
+// TrimCompressedExt returns name without a .gz or .zst suffix
+func TrimCompressedExt(name string) string {
+	for _, ext := range []string{GzipExt, ZstdExt} {
+		if base, ok := strings.CutSuffix(name, ext); ok {
+			return base
+		}
+	}
+	return name
+}
@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"net/url"
+	"strings"
+)
+
+// CredentialsFromEnv reads the user, password and database that the official (and Bitnami)
+// images create on first start from a container's environment variables
+func CredentialsFromEnv(dbType DatabaseType, env map[string]string) DatabaseConfig {
+	config := DatabaseConfig{Type: dbType}
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if env[key] != "" {
+				return env[key]
+			}
+		}
+		return ""
+	}
+
+	switch dbType {
+	case DatabaseTypePostgres, DatabaseTypeTimescaleDB:
+		config.User = first("POSTGRES_USER", "POSTGRESQL_USERNAME")
+		config.Password = first("POSTGRES_PASSWORD", "POSTGRESQL_PASSWORD")
+		config.Database = first("POSTGRES_DB", "POSTGRESQL_DATABASE", "POSTGRES_USER", "POSTGRESQL_USERNAME")
+
+	case DatabaseTypeMySQL, DatabaseTypeMariaDB:
+		// The root account can dump every database, so prefer it when its password is known
+		if root := first("MARIADB_ROOT_PASSWORD", "MYSQL_ROOT_PASSWORD"); root != "" {
+			config.User = "root"
+			config.Password = root
+		} else {
+			config.User = first("MARIADB_USER", "MYSQL_USER")
+			config.Password = first("MARIADB_PASSWORD", "MYSQL_PASSWORD")
+		}
+		config.Database = first("MARIADB_DATABASE", "MYSQL_DATABASE")
+
+	case DatabaseTypeMongoDB:
+		config.User = first("MONGO_INITDB_ROOT_USERNAME", "MONGODB_ROOT_USER")
+		config.Password = first("MONGO_INITDB_ROOT_PASSWORD", "MONGODB_ROOT_PASSWORD")
+		config.Database = first("MONGO_INITDB_DATABASE", "MONGODB_DATABASE")
+		if config.User != "" {
+			config.AuthDatabase = "admin"
+		}
+
+	case DatabaseTypeCockroachDB:
+		config.User = first("COCKROACH_USER")
+		config.Password = first("COCKROACH_PASSWORD")
+		config.Database = first("COCKROACH_DATABASE")
+
+	case DatabaseTypeYugabyteDB:
+		config.User = first("YSQL_USER")
+		config.Password = first("YSQL_PASSWORD")
+		config.Database = first("YSQL_DB", "YSQL_USER")
+
+	case DatabaseTypeNeo4j:
+		// NEO4J_AUTH is user/password, or none
+		if user, password, ok := strings.Cut(first("NEO4J_AUTH"), "/"); ok {
+			config.User, config.Password = user, password
+		}
+		config.Database = "neo4j"
+
+	case DatabaseTypeInfluxDB:
+		// The 2.x image sets up an organization, bucket and token on first start; 1.x backups need none
+		config.User = first("DOCKER_INFLUXDB_INIT_ORG")
+		config.Password = first("DOCKER_INFLUXDB_INIT_ADMIN_TOKEN")
+		config.Database = first("DOCKER_INFLUXDB_INIT_BUCKET", "INFLUXDB_DB")
+	}
+
+	return config
+}
+
+// SecretForms returns secret as it can appear in a command line, for redacting it: as is,
+// quoted for sh and escaped for a URI
+func SecretForms(secret string) []string {
+	return []string{secret, strings.ReplaceAll(secret, "'", `'\''`), url.QueryEscape(secret), url.PathEscape(secret)}
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "path/filepath"
+
+// ChunkStoreDir is the directory under the backup directory that holds deduplicated chunks
+const ChunkStoreDir = "chunks"
+
+// ChunkStore returns the chunk store of a backup directory
+func ChunkStore(backupDir string) string {
+	return filepath.Join(backupDir, ChunkStoreDir)
+}
+
+// PackStats describes a backup that was split into chunks
+type PackStats struct {
+	Bytes       int64 // Content of the backup
+	Chunks      int
+	NewChunks   int   // Chunks not already in the store
+	StoredBytes int64 // Compressed size of the new chunks, the storage the backup really added
+}
+
+// CollectStats describes a garbage collection of the chunk store
+type CollectStats struct {
+	Manifests    int // Packed backups found
+	Chunks       int // Chunks still referenced
+	Missing      int // Referenced chunks that are not in the store
+	Removed      int
+	RemovedBytes int64
+}
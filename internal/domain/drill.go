@@ -0,0 +1,114 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Check is a query run against a restored database whose result has to pass Expect, so a
+// restore is shown to hold the data rather than only to have run
+type Check struct {
+	Query  string // SQL, or a mongosh expression such as db.users.countDocuments() for MongoDB
+	Expect string // Comparison with the result, e.g. "> 0" or "= active"; empty only needs the query to succeed
+}
+
+// checkOperators are the comparisons Expect can start with, longest first so ">=" is not read as ">"
+var checkOperators = []string{">=", "<=", "!=", "==", ">", "<", "="}
+
+// Validate checks that the query is set and Expect is a comparison
+func (c Check) Validate() error {
+	if strings.TrimSpace(c.Query) == "" {
+		return fmt.Errorf("query is required")
+	}
+	_, _, err := c.comparison()
+	return err
+}
+
+// comparison splits Expect into its operator and the value compared with
+func (c Check) comparison() (string, string, error) {
+	expect := strings.TrimSpace(c.Expect)
+	if expect == "" {
+		return "", "", nil
+	}
+	for _, op := range checkOperators {
+		if value, ok := strings.CutPrefix(expect, op); ok {
+			return op, strings.TrimSpace(value), nil
+		}
+	}
+	return "", "", fmt.Errorf("expect %q must start with one of %s", c.Expect, strings.Join(checkOperators, " "))
+}
+
+// Evaluate compares the result of the query with Expect. Both sides are compared as numbers
+// when they are numbers and as text otherwise, where only = and != apply.
+func (c Check) Evaluate(result string) error {
+	op, want, err := c.comparison()
+	if err != nil || op == "" {
+		return err
+	}
+	result = strings.TrimSpace(result)
+
+	got, gotErr := strconv.ParseFloat(result, 64)
+	expected, expectedErr := strconv.ParseFloat(want, 64)
+	numeric := gotErr == nil && expectedErr == nil
+
+	var passed bool
+	switch {
+	case op == "=" || op == "==":
+		passed = numeric && got == expected || !numeric && result == want
+	case op == "!=":
+		passed = numeric && got != expected || !numeric && result != want
+	case !numeric:
+		return fmt.Errorf("%q is not a number to compare with %s", result, c.Expect)
+	case op == ">":
+		passed = got > expected
+	case op == ">=":
+		passed = got >= expected
+	case op == "<":
+		passed = got < expected
+	case op == "<=":
+		passed = got <= expected
+	}
+	if !passed {
+		return fmt.Errorf("got %q, expected %s", result, c.Expect)
+	}
+	return nil
+}
+
+// CheckResult is the outcome of one Check
+type CheckResult struct {
+	Check
+	Result string // What the query printed
+	Error  error  // Nil when the check passed
+}
+
+// FailedChecks counts the checks in results that did not pass
+func FailedChecks(results []CheckResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.Error != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// DrillResult is the outcome of restoring a database's newest backup into a scratch server
+// and running its checks there
+type DrillResult struct {
+	DatabaseType DatabaseType
+	Database     string
+	Label        string
+	BackupPath   string // Empty when there was no backup to restore
+	BackupTime   time.Time
+	Checks       []CheckResult
+	Error        error  // Why the backup could not be restored, if it could not
+	Stderr       string // Output of the failed command, if any
+	Duration     time.Duration
+}
+
+// Passed reports whether the backup restored and every check passed
+func (r DrillResult) Passed() bool {
+	return r.Error == nil && FailedChecks(r.Checks) == 0
+}
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// KMS providers that wrap the data keys of encrypted backups
+const (
+	KMSAWS   = "aws"   // AWS KMS
+	KMSGCP   = "gcp"   // Google Cloud KMS, through the gcloud CLI
+	KMSVault = "vault" // HashiCorp Vault's transit secrets engine
+)
+
+// KeyExt is appended to the path of an encrypted backup to name the file holding its wrapped
+// data key
+const KeyExt = ".key"
+
+// Encryption configures envelope encryption: every backup is encrypted with a data key of its
+// own, and only that key is encrypted, or wrapped, with the KMS key. Rotating the KMS key, or
+// moving to another, only re-wraps the small data keys and leaves the backups as they are.
+type Encryption struct {
+	Provider string // KMSAWS, KMSGCP or KMSVault
+	Key      string // AWS key ID, ARN or alias; GCP CryptoKey resource name; Vault transit key name
+	Region   string // AWS only; empty uses the AWS configuration's
+	Address  string // Vault only; empty uses VAULT_ADDR
+	Mount    string // Vault only: the transit engine's mount path, default "transit"
+}
+
+// Validate checks that the provider is known and the settings fit it
+func (e Encryption) Validate() error {
+	switch e.Provider {
+	case KMSAWS, KMSGCP, KMSVault:
+	case "":
+		return fmt.Errorf("provider is required: aws, gcp or vault")
+	default:
+		return fmt.Errorf("unknown provider %q, expected aws, gcp or vault", e.Provider)
+	}
+	if e.Key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if e.Region != "" && e.Provider != KMSAWS {
+		return fmt.Errorf("region only applies to the aws provider")
+	}
+	if (e.Address != "" || e.Mount != "") && e.Provider != KMSVault {
+		return fmt.Errorf("address and mount only apply to the vault provider")
+	}
+	if e.Provider == KMSGCP && !strings.HasPrefix(e.Key, "projects/") {
+		return fmt.Errorf("key must be a CryptoKey resource name, projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>")
+	}
+	return nil
+}
+
+// String names the KMS key, e.g. "aws:alias/backups", for catalogs and messages
+func (e Encryption) String() string {
+	return e.Provider + ":" + e.Key
+}
+
+// RekeyOptions narrow and deepen what rekey does
+type RekeyOptions struct {
+	From      string // Only backups whose data key is wrapped with this key, as Encryption.String names it
+	Reencrypt bool   // Encrypt the backups again under new data keys instead of only re-wrapping them
+	DryRun    bool   // Only report which backups would be rekeyed
+}
+
+// KeyPath returns where the wrapped data key of the backup at backupPath is kept
+func KeyPath(backupPath string) string {
+	return strings.TrimSuffix(backupPath, string(filepath.Separator)) + KeyExt
+}
+
+// IsKeyFile reports whether path holds the wrapped data key of a backup rather than a backup
+func IsKeyFile(path string) bool {
+	return strings.HasSuffix(path, KeyExt)
+}
+
+// IsEncryptable reports whether the backup at path is encrypted when encryption is configured.
+// Snapshot records only point at data the provider keeps, and are read to size and list them.
+func IsEncryptable(path string) bool {
+	return !IsSnapshotBackup(path) && !IsRDSSnapshot(path)
+}
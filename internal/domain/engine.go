@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DatabaseEngine dumps, restores and verifies the backups of one database type. Engines are
+// registered with RegisterEngine, so the layers above look them up by type instead of
+// switching over every type they know.
+type DatabaseEngine interface {
+	// Type is the key the engine is registered under, as written in configuration files
+	Type() DatabaseType
+
+	// Name is how the engine is shown to users, e.g. "PostgreSQL"
+	Name() string
+
+	// Dump writes a backup of config.Database to backupPath
+	Dump(config DatabaseConfig, method BackupMethod, backupPath, namespace, tempDir string) error
+
+	// Restore loads sourceDatabase from the backup at backupPath into config.Database
+	Restore(config DatabaseConfig, method BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error
+
+	// Verify checks that a finished backup is non-empty and looks complete
+	Verify(backupPath string) error
+
+	// DefaultPort is the port the database server listens on unless configured otherwise
+	DefaultPort() int
+
+	// Image returns the container image holding the engine's client tools for version
+	Image(version string) string
+}
+
+// TestedEngine is implemented by engines that name the client tools they run and the versions
+// their backups and restores were tested with, which version lists
+type TestedEngine interface {
+	DatabaseEngine
+
+	// TestedTools returns the tools and versions, e.g. "pg_dump 12-17"
+	TestedTools() []string
+}
+
+var engines = struct {
+	sync.RWMutex
+	byType map[DatabaseType]DatabaseEngine
+	order  []DatabaseType
+}{byType: make(map[DatabaseType]DatabaseEngine)}
+
+// RegisterEngine makes an engine available under its type. Registering a type twice panics,
+// as two engines for one type are a programming error.
+func RegisterEngine(engine DatabaseEngine) {
+	engines.Lock()
+	defer engines.Unlock()
+
+	if _, exists := engines.byType[engine.Type()]; exists {
+		panic(fmt.Sprintf("database engine %s registered twice", engine.Type()))
+	}
+	engines.byType[engine.Type()] = engine
+	engines.order = append(engines.order, engine.Type())
+}
+
+// LookupEngine returns the engine registered for dbType
+func LookupEngine(dbType DatabaseType) (DatabaseEngine, error) {
+	engines.RLock()
+	defer engines.RUnlock()
+
+	engine, ok := engines.byType[dbType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+	return engine, nil
+}
+
+// EngineTypes returns the types of the registered engines in the order they were registered
+func EngineTypes() []DatabaseType {
+	engines.RLock()
+	defer engines.RUnlock()
+
+	return append([]DatabaseType(nil), engines.order...)
+}
@@ -1,6 +1,12 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
 
 // DatabaseType represents the type of database
 type DatabaseType string
@@ -10,6 +16,36 @@ const (
 	DatabaseTypeMySQL    DatabaseType = "mysql"
 	DatabaseTypeMariaDB  DatabaseType = "mariadb"
 	DatabaseTypeMongoDB  DatabaseType = "mongodb"
+	
+	// TimescaleDB is PostgreSQL with the timescaledb extension, dumped with pg_dump
+	DatabaseTypeTimescaleDB DatabaseType = "timescaledb"
+	
+	// InfluxDB 1.x is backed up with influxd backup -portable, 2.x with influx backup. For 2.x,
+	// Database is the bucket, Password an API token and User the organization, if any.
+	DatabaseTypeInfluxDB DatabaseType = "influxdb"
+	
+	// CockroachDB is backed up with BACKUP INTO the cluster's userfile storage, which is then
+	// downloaded; YugabyteDB's YSQL API is dumped with ysql_dump like PostgreSQL
+	DatabaseTypeCockroachDB DatabaseType = "cockroachdb"
+	DatabaseTypeYugabyteDB  DatabaseType = "yugabytedb"
+	
+	// Neo4j 5 is backed up with neo4j-admin, next to the database's data directory
+	DatabaseTypeNeo4j DatabaseType = "neo4j"
+	
+	// etcd is snapshotted over its client API from Host; Database only names the backups
+	DatabaseTypeEtcd DatabaseType = "etcd"
+	
+	// RabbitMQ's definitions are exported over the management API from Host, like etcd
+	DatabaseTypeRabbitMQ DatabaseType = "rabbitmq"
+)
+
+// DumpMode selects what a logical dump contains
+type DumpMode string
+
+const (
+	DumpModeFull       DumpMode = "full"
+	DumpModeSchemaOnly DumpMode = "schema-only"
+	DumpModeDataOnly   DumpMode = "data-only"
 )
 
 // BackupMethod represents the method used for backup
@@ -19,10 +55,12 @@ const (
 	BackupMethodDockerRun   BackupMethod = "docker-run"
 	BackupMethodDockerExec  BackupMethod = "docker-exec"
 	BackupMethodKubectlExec BackupMethod = "kubectl-exec"
+	BackupMethodSSH         BackupMethod = "ssh"
 )
 
 // DatabaseConfig holds configuration for a database
 type DatabaseConfig struct {
+	Label     string // Tells several instances of one type apart; empty uses Database
 	Type      DatabaseType
 	Host      string
 	Port      int
@@ -30,35 +68,793 @@ type DatabaseConfig struct {
 	Password  string
 	Database  string
 	Version   string
-	Container string // For docker-exec
-	Pod       string // For kubectl-exec
+	Container string   // For docker-exec
+	Pod       string   // For kubectl-exec
+	SSHHost   string   // For ssh: [user@]host[:port] of the machine the database runs on
+	SSHKey    string   // For ssh: private key to log in with; empty uses the SSH agent and ~/.ssh
+	Tags      Tags     // Grouping such as env=prod, used by -only and shown in reports
+	DumpMode  DumpMode // SQL databases only; empty is DumpModeFull
+	
+	// For kubectl-exec; empty values fall back to BackupConfig
+	Kubeconfig  string
+	KubeContext string
+	
+	// MongoDB only. URI replaces Host, User and Password, e.g. to reach a replica set.
+	// Oplog dumps the whole instance with --oplog for a consistent snapshot. Archive writes
+	// a single mongodump --archive file instead of a directory tree.
+	AuthDatabase string
+	URI          string
+	TLS          bool
+	Oplog        bool
+	Archive      bool
+	
+	// MongoDB only: between full backups, dump just the oplog entries of the database written
+	// since the last full one. A new full backup is taken once the last is FullEvery old.
+	Differential bool
+	FullEvery    time.Duration // Zero uses DefaultFullEvery
+	
+	// PostgreSQL and TimescaleDB only: also dump roles and tablespaces with pg_dumpall --globals-only,
+	// which the database dump refers to but does not contain
+	Globals bool
+	
+	// MySQL and MariaDB only
+	MySQLDump MySQLDumpOptions
+	
+	// Neo4j only
+	Neo4j Neo4jOptions
+	
+	// MariaDB only: copy the whole server with mariabackup instead of dumping SQL.
+	// Needs docker-exec, kubectl-exec or ssh, which can read the data directory.
+	Physical bool
+	
+	// Take a CSI VolumeSnapshot of the database's PersistentVolumeClaim instead of dumping it.
+	// Needs kubectl-exec; nil dumps as usual.
+	Snapshot *SnapshotOptions
+	
+	// Take a ZFS or LVM snapshot of the filesystem holding the data directory on the machine the
+	// tool runs on and archive it instead of dumping. Needs docker-run or docker-exec.
+	HostSnapshot *HostSnapshotOptions
+	
+	// PostgreSQL, TimescaleDB, MySQL, MariaDB, MongoDB, CockroachDB, YugabyteDB, etcd and
+	// RabbitMQ only: connect over TLS with these certificates. Nil connects without TLS.
+	Certs *ClientCerts
+	
+	// A database run by a cloud provider such as RDS, Cloud SQL or Atlas, reached over the network
+	// with docker-run. Dumps leave out what needs a superuser, which the providers do not grant.
+	// Nil is a database run by its owner.
+	Managed *ManagedOptions
+	
+	// Take a native RDS or Aurora snapshot of the managed database instead of dumping it, and
+	// optionally export it to S3. Needs managed.provider rds; nil dumps as usual.
+	RDSSnapshot *RDSSnapshotOptions
+	
+	// Queries run against the database once a backup has been restored into it, see Check
+	Checks []Check
+	
+	// Rules applied to SQL dumps before they are written
+	Masking []MaskingRule
+	
+	// SQL dumps with docker-exec, kubectl-exec and ssh only: gzip the dump where it is taken,
+	// so less crosses the exec stream. It is written as it arrives, so it cannot be masked.
+	CompressInContainer bool
+	
+	// Empty limits fall back to BackupConfig
+	Limits ResourceLimits
+	
+	// How the database's backups are compressed on the host; zero values use
+	// BackupConfig.Compression
+	Compression Compression
+	
+	// Where the database's backups and their catalog go instead of BackupConfig.BackupDir;
+	// empty uses BackupConfig's
+	BackupDir string
+	
+	// Stores the database's backups are copied to instead of BackupConfig.Stores. Nil uses
+	// BackupConfig's; an empty list keeps them local.
+	Stores []string
+	
+	// Largest object a copy in the stores may be: larger backups are copied in parts of this
+	// many bytes, listed in their catalog entry and manifest. Zero uses BackupConfig.PartSize.
+	PartSize int64
+	
+	// Store the database's dumps are streamed to while they are taken instead of being written
+	// to BackupDir, for hosts without room for them; empty uses BackupConfig.StreamTo. A
+	// streamed backup is kept in that store only, see StreamingStore and CheckStream.
+	StreamTo string
+	
+	// Set by the backup for the dump it streams: the key the dump goes under in StreamTo
+	StreamKey string
+	
+	// Newest backups kept on disk once they are in all their Stores: older ones are removed
+	// from BackupDir and kept in the stores alone, from which restore retrieves them. Zero
+	// uses BackupConfig.LocalKeep; both zero keep every backup on disk.
+	LocalKeep int
+	
+	// Directory in the container or pod that restores copy dumps into before loading them,
+	// e.g. a volume when /tmp is a small tmpfs; empty uses BackupConfig.TempDir
+	TempDir string
+	
+	// Name of the Tenant the database belongs to, whose backup directory, stores and KMS key
+	// it was given; empty for a database of the deployment itself
+	Tenant string
+	
+	// KMS key the database's backups are encrypted with instead of BackupConfig.Encryption;
+	// nil uses BackupConfig's
+	Encryption *Encryption
+	
+	// Expectations status and the alerts of serve check: the newest backup is at most MaxAge
+	// old, zero using BackupConfig.MaxAge, and at least MinSize bytes, zero not checking it
+	MaxAge  time.Duration
+	MinSize int64
+	
+	// When a new backup is flagged for straying from the previous ones; zero values use
+	// BackupConfig.Anomalies
+	Anomalies Anomalies
+}
+
+// I/O scheduling classes for ResourceLimits.IOClass
+const (
+	IOClassIdle       = "idle"
+	IOClassBestEffort = "best-effort"
+)
+
+// ResourceLimits keeps a backup from starving the database host
+type ResourceLimits struct {
+	BytesPerSecond int64   // Dump throughput cap; 0 is unlimited
+	Nice           int     // nice level for dump tools, 1-19; 0 leaves the priority alone
+	IOClass        string  // ionice class for dump tools; empty leaves it alone
+	CPUs           float64 // docker-run only: CPU cap for the temporary container
+	MemoryBytes    int64   // docker-run only: memory cap for the temporary container
+	MinFreeBytes   int64   // Abort when free space in the backup directory drops below this; 0 disables
+}
+
+// Values for MySQLDumpOptions.SetGTIDPurged
+const (
+	GTIDPurgedOff       = "OFF"
+	GTIDPurgedOn        = "ON"
+	GTIDPurgedAuto      = "AUTO"
+	GTIDPurgedCommented = "COMMENTED"
+)
+
+// MySQLDumpOptions make mysqldump take consistent InnoDB snapshots and include stored code
+type MySQLDumpOptions struct {
+	SingleTransaction bool   // Dump inside one transaction instead of locking tables
+	Routines          bool   // Include stored procedures and functions
+	Events            bool   // Include scheduled events
+	SkipTriggers      bool   // Leave out triggers, which mysqldump includes by default
+	SetGTIDPurged     string // --set-gtid-purged value (MySQL only); empty leaves mysqldump's default
+}
+
+// ClientCerts are the files a client verifies the server and authenticates itself with. The
+// paths are read where the client runs: in the container or pod for docker-exec and
+// kubectl-exec, on the database's machine for ssh, and on this machine for docker-run, which
+// mounts them into its container.
+type ClientCerts struct {
+	CA   string // Certificate the server's is verified against; empty only encrypts
+	Cert string // Client certificate; empty authenticates with the password. MongoDB takes the key in the same file.
+	Key  string // Key of Cert
+	Mode string // TLSModeRequire, TLSModeVerifyCA or TLSModeVerifyFull; empty verifies fully with CA, else only encrypts
+}
+
+// TLS modes for ClientCerts.Mode, named after libpq's sslmode and translated for the other clients
+const (
+	TLSModeRequire    = "require"     // Encrypt without verifying the server
+	TLSModeVerifyCA   = "verify-ca"   // Verify the server's certificate against CA but not its host name
+	TLSModeVerifyFull = "verify-full" // Verify the certificate and that it names the host connected to
+)
+
+// Cloud providers for ManagedOptions.Provider
+const (
+	ManagedRDS      = "rds"      // Amazon RDS and Aurora
+	ManagedCloudSQL = "cloudsql" // Google Cloud SQL
+	ManagedAtlas    = "atlas"    // MongoDB Atlas
+)
+
+// ManagedOptions describe how a database run by a cloud provider is logged in to
+type ManagedOptions struct {
+	Provider string
+	IAMAuth  bool   // RDS and Cloud SQL only: log in as User with a short-lived token from the aws or gcloud CLI instead of Password
+	Region   string // RDS only: the instance's region; empty uses the aws CLI's configured one
+}
+
+// RDSSnapshotOptions select the RDS instance or Aurora cluster an RDS snapshot backup takes
+type RDSSnapshotOptions struct {
+	Instance string            // DB instance identifier
+	Cluster  string            // Aurora DB cluster identifier, instead of Instance
+	Export   *RDSExportOptions // Nil keeps the snapshot in RDS only
+}
+
+// RDSExportOptions export a finished RDS snapshot to S3, where RDS writes it as Parquet files
+type RDSExportOptions struct {
+	Bucket string
+	Prefix string // Empty writes to the root of the bucket
+	Role   string // ARN of the IAM role RDS writes to the bucket as
+	KMSKey string // ARN of the KMS key the export is encrypted with
+}
+
+// Neo4j backup strategies for Neo4jOptions.Strategy
+const (
+	Neo4jOnline        = "online"         // neo4j-admin database backup from the running server (Enterprise)
+	Neo4jStopDatabase  = "stop-database"  // STOP DATABASE, neo4j-admin database dump, START DATABASE (Enterprise)
+	Neo4jStopContainer = "stop-container" // Stop the container and dump from its volumes (Community, docker-exec)
+)
+
+// Neo4jOptions select how a Neo4j database is backed up. neo4j-admin database dump needs the
+// database offline, which Community edition only allows by stopping the whole server.
+type Neo4jOptions struct {
+	Strategy   string // Empty is Neo4jOnline, which takes no downtime
+	BackupPort int    // Online only: where the server accepts backups; 0 is 6362
+}
+
+// SnapshotOptions select the volume a snapshot backup copies and how
+type SnapshotOptions struct {
+	PVC   string // Claim to snapshot; empty uses the only claim mounted by the pod
+	Class string // VolumeSnapshotClass; empty uses the cluster's default
+}
+
+// Filesystems HostSnapshotOptions can snapshot
+const (
+	HostSnapshotZFS = "zfs"
+	HostSnapshotLVM = "lvm"
+)
+
+// DefaultLVMSnapshotSize is the space an LVM snapshot gets for changes made while it exists
+const DefaultLVMSnapshotSize = "1G"
+
+// HostSnapshotOptions select the local volume a host snapshot backup copies
+type HostSnapshotOptions struct {
+	Kind   string // HostSnapshotZFS or HostSnapshotLVM
+	Volume string // ZFS dataset such as tank/pgdata, or LVM logical volume such as vg0/mysql
+	Path   string // Directory within the volume to archive; empty archives all of it
+	Size   string // LVM only; empty is DefaultLVMSnapshotSize
+}
+
+// MaskingRule rewrites sensitive data in a SQL dump. A rule either replaces one column of a
+// table in every row, or replaces a regular expression on every line of the dump.
+type MaskingRule struct {
+	Table       string
+	Column      string
+	Pattern     string
+	Replacement string // "{row}" expands to the row number, "NULL" stores NULL; $1 works with Pattern
 }
 
 // BackupConfig holds backup configuration
 type BackupConfig struct {
-	Method        BackupMethod
-	Timestamp     time.Time
-	BackupDir     string
-	TempDir       string
-	K8sNamespace  string
-	Databases     []DatabaseConfig
+	Method          BackupMethod
+	RunID           string // UUID of the run, carried by its log, catalog entries, heartbeat reports and traces; set when the run starts
+	Timestamp       time.Time
+	BackupDir       string
+	TempDir         string
+	K8sNamespace    string
+	Kubeconfig      string // Empty uses KUBECONFIG or ~/.kube/config
+	KubeContext     string // Empty uses the kubeconfig's current context
+	Limits          ResourceLimits
+	Compression     Compression     // How .gz backups are gzipped and how many threads compression uses
+	NameTemplate    string // Backup name template; empty uses DefaultNameTemplate or DefaultMongoNameTemplate
+	TimestampFormat string // Go time layout for {{.Timestamp}}; empty uses DefaultTimestampFormat
+	Timezone        string // Zone for {{.Timestamp}}: UTC, Local or an IANA name; empty keeps local time without offset
+	Environment     string // Label for name templates, e.g. prod
+	Logs            LogSettings
+	Heartbeat       HeartbeatURLs
+	Dedup           bool            // Store single-file backups as chunks shared between runs, see ChunkStore
+	Parallel        int             // Databases backed up at once; 0 or 1 backs them up one after another
+	Uploads         Uploads         // How finished backups are copied to stores while the next databases are backed up
+	Stores          []string        // Names of the BackupStores every finished backup is copied to
+	PartSize        int64           // Copies in stores are split into parts of at most this many bytes, see DatabaseConfig.PartSize; 0 copies them whole
+	StreamTo        string          // Store dumps are streamed to instead of the backup directory, see DatabaseConfig.StreamTo
+	LocalKeep       int             // Newest backups per database kept on disk besides the stores, see DatabaseConfig.LocalKeep; 0 keeps all
+	S3Stores        []S3StoreConfig // Built-in stores declared in the configuration, registered when it is loaded
+	Signing         *Signing        // Key backups are signed with and restores verify, if any
+	Encryption      *Encryption     // KMS key backups are encrypted with, if any
+	Tenants         []Tenant        // Customers whose databases are among Databases, each kept apart
+	MaxAge          time.Duration   // Oldest the newest backup of a database may be, see DatabaseConfig.MaxAge; zero is not checked
+	Alerts          Alerts          // Where serve reports databases missing their expectations; no URL sends none
+	Anomalies       Anomalies       // When new backups are flagged, see DatabaseConfig.Anomalies
+	Databases       []DatabaseConfig
+}
+
+// Overlapping reports whether the backups of the run overlap: several dumps at once, or dumps
+// going on while earlier backups are copied to their stores
+func (c BackupConfig) Overlapping() bool {
+	if len(c.Databases) < 2 {
+		return false
+	}
+	if c.Parallel > 1 {
+		return true
+	}
+	for _, db := range c.Databases {
+		if len(db.Stores) > 0 || db.Stores == nil && len(c.Stores) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// BackupDirs returns the backup directory and those databases use instead, without
+// duplicates, so every catalog the configuration writes to can be read
+func (c BackupConfig) BackupDirs() []string {
+	dirs := []string{c.BackupDir}
+	seen := map[string]bool{filepath.Clean(c.BackupDir): true}
+	for _, db := range c.Databases {
+		if db.BackupDir != "" && !seen[filepath.Clean(db.BackupDir)] {
+			seen[filepath.Clean(db.BackupDir)] = true
+			dirs = append(dirs, db.BackupDir)
+		}
+	}
+	return dirs
+}
+
+// HeartbeatURLs are pinged around non-interactive runs, so a dead man's switch such as
+// healthchecks.io or Cronitor notices failed and missing backups. Empty URLs are skipped.
+type HeartbeatURLs struct {
+	Start   string
+	Success string
+	Failure string
+}
+
+// DefaultLogKeep is how many run logs are kept when LogSettings.Keep is not set
+const DefaultLogKeep = 30
+
+// LogSettings control the log file written for each run, next to the console output
+type LogSettings struct {
+	Dir      string // Empty uses <BackupDir>/logs
+	Keep     int    // Newest run logs kept; 0 uses DefaultLogKeep
+	Disabled bool
 }
 
 // BackupResult represents the result of a backup operation
 type BackupResult struct {
 	DatabaseType DatabaseType
 	Database     string
+	Label        string
+	Tags         Tags
 	Success      bool
 	BackupPath   string
-	Size         string
+	Size         string // Human-readable SizeBytes, e.g. "1.5 GiB"
+	SizeBytes    int64
 	Error        error
+	Stderr       string // Output of the failed command, if any
 	Duration     time.Duration
+	Packed       *PackStats // Set when the backup was stored as chunks
+	
+	// Differential MongoDB backups: the oplog position a full backup starts from, or the
+	// full backup a differential one applies on top of
+	OplogTimestamp string
+	Base           string
+	
+	// RDS snapshot backups: the snapshot the record points at
+	SnapshotARN string
+	
+	// Encrypted backups: the KMS key the data key is wrapped with
+	EncryptionKey string
+	
+	// Streamed backups: the store the dump went to instead of BackupPath, which holds nothing
+	StreamedTo string
+	
+	// Things about a successful backup worth a look, such as a size far below the previous ones
+	Warnings []string
+}
+
+// SizeEstimate is the engine's idea of how large a database's dump will be
+type SizeEstimate struct {
+	DatabaseType DatabaseType
+	Database     string
+	Label        string
+	Bytes        int64
+	Error        error // Set when the engine could not be asked
+}
+
+// BackupEstimate is shown before a backup is confirmed, so a full disk is noticed up front
+type BackupEstimate struct {
+	BackupDir string
+	Databases []SizeEstimate
+	FreeBytes int64
+	FreeError error
+}
+
+// Total sums the estimates that succeeded
+func (e BackupEstimate) Total() int64 {
+	var total int64
+	for _, db := range e.Databases {
+		if db.Error == nil {
+			total += db.Bytes
+		}
+	}
+	return total
+}
+
+// FormatBytes renders a byte count in powers of 1024, e.g. "1.5 GiB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	
+	value := float64(n)
+	suffix := 0
+	for value >= unit && suffix < 4 {
+		value /= unit
+		suffix++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[suffix-1])
+}
+
+// DiscoveredDatabase is a database service found in a Docker Compose file, with the
+// connection details compose already knows filled in
+type DiscoveredDatabase struct {
+	Service string // Compose service name
+	Image   string
+	Config  DatabaseConfig
+}
+
+// Workload is a running container, or a pod, that the exec methods can back up a database in
+type Workload struct {
+	Name  string
+	Image string // The pod's first container's image, which commands are run in
+}
+
+// CatalogEntry describes a finished backup that can be listed and restored
+type CatalogEntry struct {
+	ID           string        `json:"id"`
+	DatabaseType DatabaseType  `json:"database_type"`
+	Database     string        `json:"database"`
+	Label        string        `json:"label,omitempty"`
+	Tags         Tags          `json:"tags,omitempty"`
+	Tenant       string        `json:"tenant,omitempty"`
+	Method       BackupMethod  `json:"method,omitempty"`
+	Source       string        `json:"source,omitempty"` // Host, container or pod the dump was taken from
+	Path         string        `json:"path"`
+	Size         string        `json:"size,omitempty"`
+	SizeBytes    int64         `json:"size_bytes,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Duration     time.Duration `json:"duration,omitempty"`
+	RunID        string        `json:"run_id,omitempty"` // Run that took the backup, see BackupConfig.RunID
+	
+	// Differential MongoDB backups, see BackupResult
+	OplogTimestamp string `json:"oplog_timestamp,omitempty"`
+	Base           string `json:"base,omitempty"`
+	
+	// RDS snapshot backups, see BackupResult
+	SnapshotARN string `json:"snapshot_arn,omitempty"`
+	
+	// Encrypted backups: the KMS key their data key is wrapped with, see Encryption.String
+	EncryptionKey string `json:"encryption_key,omitempty"`
+	
+	// Stores holding a copy of the backup, which pull can fetch it from after it is gone here
+	Stores []string `json:"stores,omitempty"`
+	
+	// Copies split into parts, in order, each kept under its PartKey; empty for whole copies
+	Parts []Part `json:"parts,omitempty"`
+	
+	// Copies to stores that failed and are resumed by later runs
+	Pending []PendingCopy `json:"pending,omitempty"`
+	
+	// Backups no longer on disk but kept in Stores: the key of their copies, which restore
+	// retrieves them under. Set when they are listed for restore rather than recorded.
+	StoreKey string `json:"store_key,omitempty"`
+	
+	// The release that wrote the backup and the ArtifactFormat it used, see Compatibility
+	ToolVersion string `json:"tool_version,omitempty"`
+	Format      int    `json:"format,omitempty"`
+}
+
+// RestoreOptions narrow what a restore applies
+type RestoreOptions struct {
+	At         time.Time        // Reach this point in time from the backups around it instead of picking one
+	Table      string           // Only this table or collection, replacing it in the target
+	Configured []DatabaseConfig // Labelled databases of a config file; the backup's database brings its checks
+	VerifyKey  string           // Public key the backup must be signed with; empty refuses signed backups
+	SkipVerify bool             // Restore even if the signature is missing or does not match
+}
+
+// RestoreResult represents the result of a restore operation
+type RestoreResult struct {
+	DatabaseType DatabaseType
+	Database     string
+	BackupPath   string
+	Table        string // Set when only this table or collection was restored
+	Success      bool
+	Error        error
+	Stderr       string        // Output of the failed command, if any
+	PreparedDir  string        // Physical backups and host snapshots: the data directory to copy back
+	Claim        string        // Snapshot backups: the PersistentVolumeClaim created from the snapshot
+	Instance     string        // RDS snapshots: the DB instance or cluster created from the snapshot
+	Checks       []CheckResult // The target's checks, run once the restore succeeded
+	Duration     time.Duration
+}
+
+// CloneConfig describes copying a database from one environment into another
+type CloneConfig struct {
+	Source          DatabaseConfig
+	SourceMethod    BackupMethod
+	SourceNamespace string
+	Target          DatabaseConfig
+	TargetMethod    BackupMethod
+	TargetNamespace string
+	TempDir         string // Scratch directory inside containers and pods, as in BackupConfig
+}
+
+// AssignLabels gives every database a label unique within its tenant, defaulting to its
+// database name. Repeated labels get a numeric suffix: mydb, mydb-2, mydb-3.
+func (c *BackupConfig) AssignLabels() {
+	seen := make(map[string]int)
+	for i := range c.Databases {
+		db := &c.Databases[i]
+		if db.Label == "" {
+			db.Label = db.Database
+		}
+		
+		// Tenants keep their backups apart, so their labels cannot clash
+		base := db.Label
+		for seen[db.Tenant+"\x00"+db.Label] > 0 {
+			seen[db.Tenant+"\x00"+base]++
+			db.Label = fmt.Sprintf("%s-%d", base, seen[db.Tenant+"\x00"+base])
+		}
+		seen[db.Tenant+"\x00"+db.Label]++
+	}
+}
+
+// NeedsPassword reports whether the database is reached with a password. MongoDB
+// is dumped without credentials unless a user is set, InfluxDB 1.x without any, and
+// clients with a certificate authenticate with that, except MySQL, MariaDB and MongoDB,
+// which use it alongside the password. CockroachDB without TLS is insecure
+// and takes no password, nor does Neo4j dumped from a stopped container or etcd without
+// authentication. Managed databases logging in with IAM get a token instead.
+func (c DatabaseConfig) NeedsPassword() bool {
+	if c.Managed != nil && c.Managed.IAMAuth {
+		return false
+	}
+	if c.Certs != nil && c.Certs.Cert != "" && c.Type != DatabaseTypeMySQL && c.Type != DatabaseTypeMariaDB && c.Type != DatabaseTypeMongoDB {
+		return false
+	}
+	if c.Type == DatabaseTypeCockroachDB {
+		return c.Certs != nil
+	}
+	if c.Type == DatabaseTypeNeo4j {
+		return c.Neo4j.Strategy != Neo4jStopContainer
+	}
+	if c.Type == DatabaseTypeEtcd {
+		return c.User != ""
+	}
+	if c.Type == DatabaseTypeMongoDB {
+		return c.User != "" && c.URI == ""
+	}
+	if c.Type == DatabaseTypeInfluxDB {
+		return !c.IsInfluxV1()
+	}
+	return true
+}
+
+// CheckStream reports why the database's dumps cannot be streamed to a store, or nil if they
+// can. Only SQL dumps are written in one pass that can be checked on the way, and encryption
+// needs the finished file.
+func (c DatabaseConfig) CheckStream() error {
+	switch c.Type {
+	case DatabaseTypePostgres, DatabaseTypeTimescaleDB, DatabaseTypeMySQL, DatabaseTypeMariaDB, DatabaseTypeYugabyteDB:
+	default:
+		return fmt.Errorf("only PostgreSQL, TimescaleDB, MySQL, MariaDB and YugabyteDB dumps can be streamed")
+	}
+	switch {
+	case c.Physical:
+		return fmt.Errorf("physical backups cannot be streamed")
+	case c.Snapshot != nil || c.HostSnapshot != nil || c.RDSSnapshot != nil:
+		return fmt.Errorf("snapshot backups cannot be streamed")
+	case c.Encryption != nil:
+		return fmt.Errorf("encrypted backups cannot be streamed")
+	}
+	return nil
+}
+
+// IsInfluxV1 reports whether the database is an InfluxDB 1.x server, which is backed up
+// with influxd backup rather than influx backup
+func (c DatabaseConfig) IsInfluxV1() bool {
+	return c.Type == DatabaseTypeInfluxDB && (c.Version == "1" || strings.HasPrefix(c.Version, "1."))
+}
+
+// TLSMode returns the mode the client connects in, resolving an empty Mode
+func (c ClientCerts) TLSMode() string {
+	switch {
+	case c.Mode != "":
+		return c.Mode
+	case c.CA != "":
+		return TLSModeVerifyFull
+	}
+	return TLSModeRequire
 }
 
 // Validation methods
-func (dt DatabaseType) IsValid() bool {
+func (c ClientCerts) Validate(dbType DatabaseType) error {
+	switch c.Mode {
+	case "", TLSModeRequire:
+	case TLSModeVerifyCA, TLSModeVerifyFull:
+		if c.CA == "" && dbType != DatabaseTypeMongoDB {
+			return fmt.Errorf("mode %s needs a ca certificate", c.Mode)
+		}
+	default:
+		return fmt.Errorf("mode must be %s, %s or %s", TLSModeRequire, TLSModeVerifyCA, TLSModeVerifyFull)
+	}
+	if dbType == DatabaseTypeMongoDB {
+		if c.Key != "" {
+			return fmt.Errorf("MongoDB reads the client key from the cert file; leave key empty")
+		}
+		return nil
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		return fmt.Errorf("cert and key must be given together")
+	}
+	return nil
+}
+
+func (o ManagedOptions) Validate(dbType DatabaseType, method BackupMethod) error {
+	switch o.Provider {
+	case ManagedRDS:
+		if dbType != DatabaseTypePostgres && dbType != DatabaseTypeMySQL && dbType != DatabaseTypeMariaDB {
+			return fmt.Errorf("%s is only supported for PostgreSQL, MySQL and MariaDB", o.Provider)
+		}
+	case ManagedCloudSQL:
+		if dbType != DatabaseTypePostgres && dbType != DatabaseTypeMySQL {
+			return fmt.Errorf("%s is only supported for PostgreSQL and MySQL", o.Provider)
+		}
+	case ManagedAtlas:
+		if dbType != DatabaseTypeMongoDB {
+			return fmt.Errorf("%s is only supported for MongoDB", o.Provider)
+		}
+		if o.IAMAuth {
+			return fmt.Errorf("iam_auth is only supported for %s and %s", ManagedRDS, ManagedCloudSQL)
+		}
+	default:
+		return fmt.Errorf("provider must be %s, %s or %s", ManagedRDS, ManagedCloudSQL, ManagedAtlas)
+	}
+	if o.Region != "" && o.Provider != ManagedRDS {
+		return fmt.Errorf("region only applies to %s", ManagedRDS)
+	}
+	if method != BackupMethodDockerRun {
+		return fmt.Errorf("managed databases need %s, which reaches them over the network", BackupMethodDockerRun)
+	}
+	return nil
+}
+
+func (o RDSSnapshotOptions) Validate(managed *ManagedOptions) error {
+	if managed == nil || managed.Provider != ManagedRDS {
+		return fmt.Errorf("RDS snapshots need managed.provider %s", ManagedRDS)
+	}
+	if (o.Instance == "") == (o.Cluster == "") {
+		return fmt.Errorf("set either instance or cluster")
+	}
+	if o.Export != nil && (o.Export.Bucket == "" || o.Export.Role == "" || o.Export.KMSKey == "") {
+		return fmt.Errorf("export needs bucket, role and kms_key")
+	}
+	return nil
+}
+
+func (r MaskingRule) Validate() error {
+	switch {
+	case r.Pattern != "" && (r.Table != "" || r.Column != ""):
+		return fmt.Errorf("use either pattern or table and column")
+	case r.Pattern != "":
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	case r.Table == "" || r.Column == "":
+		return fmt.Errorf("table and column are required")
+	}
+	return nil
+}
+
+func (o MySQLDumpOptions) Validate(dbType DatabaseType) error {
+	switch o.SetGTIDPurged {
+	case "":
+	case GTIDPurgedOff, GTIDPurgedOn, GTIDPurgedAuto, GTIDPurgedCommented:
+		if dbType == DatabaseTypeMariaDB {
+			return fmt.Errorf("set_gtid_purged is not supported by MariaDB")
+		}
+	default:
+		return fmt.Errorf("set_gtid_purged must be %s, %s, %s or %s", GTIDPurgedOff, GTIDPurgedOn, GTIDPurgedAuto, GTIDPurgedCommented)
+	}
+	return nil
+}
+
+func (o Neo4jOptions) Validate(method BackupMethod) error {
+	switch o.Strategy {
+	case "", Neo4jOnline:
+	case Neo4jStopDatabase:
+		if method == BackupMethodDockerRun {
+			return fmt.Errorf("%s needs %s or %s, as neo4j-admin database dump reads the data directory", o.Strategy, BackupMethodDockerExec, BackupMethodKubectlExec)
+		}
+	case Neo4jStopContainer:
+		if method != BackupMethodDockerExec {
+			return fmt.Errorf("%s needs %s", o.Strategy, BackupMethodDockerExec)
+		}
+	default:
+		return fmt.Errorf("strategy must be %s, %s or %s", Neo4jOnline, Neo4jStopDatabase, Neo4jStopContainer)
+	}
+	if o.BackupPort < 0 || o.BackupPort > 65535 {
+		return fmt.Errorf("backup_port must be a port number")
+	}
+	return nil
+}
+
+func (l ResourceLimits) Validate() error {
+	if l.Nice < 0 || l.Nice > 19 {
+		return fmt.Errorf("nice must be between 0 and 19")
+	}
+	if l.IOClass != "" && l.IOClass != IOClassIdle && l.IOClass != IOClassBestEffort {
+		return fmt.Errorf("ionice must be %q or %q", IOClassIdle, IOClassBestEffort)
+	}
+	if l.BytesPerSecond < 0 || l.CPUs < 0 || l.MemoryBytes < 0 || l.MinFreeBytes < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// IsZero reports whether no limit is set
+func (l ResourceLimits) IsZero() bool {
+	return l == ResourceLimits{}
+}
+
+// DumpsSQL reports whether backups of the type are SQL dumps, which can be masked and
+// restored table by table
+func (dt DatabaseType) DumpsSQL() bool {
+	return dt.WritesPgDumpFormat() || dt == DatabaseTypeMySQL || dt == DatabaseTypeMariaDB
+}
+
+// TakesClientCerts reports whether DatabaseConfig.Certs applies to databases of the type
+func (dt DatabaseType) TakesClientCerts() bool {
+	switch dt {
+	case DatabaseTypePostgres, DatabaseTypeTimescaleDB, DatabaseTypeMySQL, DatabaseTypeMariaDB,
+		DatabaseTypeMongoDB, DatabaseTypeCockroachDB, DatabaseTypeYugabyteDB:
+		return true
+	}
+	return dt.ReachedOverAPI()
+}
+
+// RunsChecks reports whether databases of the type can be queried by a Check, and so drilled
+// in a scratch server of the engine's image
+func (dt DatabaseType) RunsChecks() bool {
 	switch dt {
-	case DatabaseTypePostgres, DatabaseTypeMySQL, DatabaseTypeMariaDB, DatabaseTypeMongoDB:
+	case DatabaseTypePostgres, DatabaseTypeTimescaleDB, DatabaseTypeMySQL, DatabaseTypeMariaDB, DatabaseTypeMongoDB:
+		return true
+	}
+	return false
+}
+
+// BackedUpOverSSH reports whether databases of the type can be backed up with BackupMethodSSH,
+// which runs their client tools on the database's machine
+func (dt DatabaseType) BackedUpOverSSH() bool {
+	switch dt {
+	case DatabaseTypePostgres, DatabaseTypeTimescaleDB, DatabaseTypeMySQL, DatabaseTypeMariaDB, DatabaseTypeMongoDB:
+		return true
+	}
+	return false
+}
+
+// ReachedOverAPI reports whether databases of the type are backed up over their network API
+// from this machine rather than by client tools in a container or pod. Host is required
+// then, and Database only names the backups.
+func (dt DatabaseType) ReachedOverAPI() bool {
+	return dt == DatabaseTypeEtcd || dt == DatabaseTypeRabbitMQ
+}
+
+// WritesPgDumpFormat reports whether dumps of the type are plain pg_dump output, with table
+// data in COPY blocks. ysql_dump is a fork of pg_dump.
+func (dt DatabaseType) WritesPgDumpFormat() bool {
+	return dt.UsesPgDump() || dt == DatabaseTypeYugabyteDB
+}
+
+// UsesPgDump reports whether databases of the type are dumped with pg_dump and loaded with psql
+func (dt DatabaseType) UsesPgDump() bool {
+	return dt == DatabaseTypePostgres || dt == DatabaseTypeTimescaleDB
+}
+
+// IsValid reports whether an engine is registered for the type
+func (dt DatabaseType) IsValid() bool {
+	_, err := LookupEngine(dt)
+	return err == nil
+}
+
+func (m DumpMode) IsValid() bool {
+	switch m {
+	case "", DumpModeFull, DumpModeSchemaOnly, DumpModeDataOnly:
 		return true
 	}
 	return false
@@ -66,7 +862,7 @@ func (dt DatabaseType) IsValid() bool {
 
 func (bm BackupMethod) IsValid() bool {
 	switch bm {
-	case BackupMethodDockerRun, BackupMethodDockerExec, BackupMethodKubectlExec:
+	case BackupMethodDockerRun, BackupMethodDockerExec, BackupMethodKubectlExec, BackupMethodSSH:
 		return true
 	}
 	return false
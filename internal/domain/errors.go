@@ -0,0 +1,179 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Categories of failures, recognised from what the failing command printed. Use errors.Is
+// to branch on them, e.g. to retry only connection failures.
+var (
+	ErrConnectionFailed = errors.New("connection failed")
+	ErrToolMissing      = errors.New("tool missing")
+	ErrAuthFailed       = errors.New("authentication failed")
+	ErrDiskFull         = errors.New("disk full")
+)
+
+// ErrInterrupted is returned for a backup that was stopped, or never started, because the
+// tool was told to stop
+var ErrInterrupted = errors.New("interrupted")
+
+// ErrTransferCorrupt is returned for a dump that arrived different from how it left its
+// container or pod
+var ErrTransferCorrupt = errors.New("transfer corrupted")
+
+// ErrNoConnectionTest is returned when there is no way to test the connection to a database
+// of a type, as for engines added by plugins
+var ErrNoConnectionTest = errors.New("no connection test for this type of database")
+
+// ErrBack is returned by a step of the interactive wizard when the user chose to go back to
+// the step before it
+var ErrBack = errors.New("back to the previous step")
+
+// failurePatterns recognise the categories in command output, in order: a refused login is
+// often reported as a failed connection, so authentication is checked first
+var failurePatterns = []struct {
+	kind     error
+	patterns []string
+}{
+	{ErrDiskFull, []string{
+		"no space left on device",
+		"not enough space on the disk",
+		"disk full",
+		"disk quota exceeded",
+	}},
+	{ErrAuthFailed, []string{
+		"password authentication failed",
+		"no password supplied",
+		"access denied for user",
+		"authentication failed",
+		"auth failed",
+		"unauthorized",
+		"is forbidden",
+	}},
+	{ErrToolMissing, []string{
+		"executable file not found",
+		"command not found",
+		": not found",
+		"exit code 127",
+		"exit status 127",
+	}},
+	{ErrConnectionFailed, []string{
+		"connection refused",
+		"could not connect",
+		"connection to server",
+		"can't connect",
+		"cannot connect",
+		"could not translate host name",
+		"unknown mysql server host",
+		"no such host",
+		"server selection error",
+		"no reachable servers",
+		"connection timed out",
+		"i/o timeout",
+		"no route to host",
+		"network is unreachable",
+		"connection reset",
+		"no such container",
+	}},
+}
+
+// CommandError is returned when a dump or copy command fails, carrying the
+// command's stderr so the cause (e.g. "connection refused") is not lost
+type CommandError struct {
+	Err    error
+	Stderr string
+	Kind   error // One of the Err* categories, or nil if the failure was not recognised
+}
+
+// NewCommandError wraps a failed command's error with its stderr and the category of the failure
+func NewCommandError(err error, stderr string) *CommandError {
+	return &CommandError{Err: err, Stderr: stderr, Kind: classify(err.Error() + "\n" + stderr)}
+}
+
+func (e *CommandError) Error() string {
+	if line := lastLine(e.Stderr); line != "" {
+		return fmt.Sprintf("%v: %s", e.Err, line)
+	}
+	return e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is match the failure's category
+func (e *CommandError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// LowDiskSpaceError is returned when free space in a backup directory is below
+// ResourceLimits.MinFreeBytes, before or while a backup is written. It counts as ErrDiskFull.
+type LowDiskSpaceError struct {
+	Dir  string
+	Free int64
+	Min  int64
+}
+
+func (e *LowDiskSpaceError) Error() string {
+	return fmt.Sprintf("only %s free in %s, below the minimum of %s", FormatBytes(e.Free), e.Dir, FormatBytes(e.Min))
+}
+
+func (e *LowDiskSpaceError) Unwrap() error {
+	return ErrDiskFull
+}
+
+// ChecksumMismatchError is returned when the SHA-256 of a dump streamed out of a container or
+// pod differs from the one computed where it was written. It counts as ErrTransferCorrupt.
+type ChecksumMismatchError struct {
+	Sent     string
+	Received string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("dump changed in transfer: sent with SHA-256 %s, arrived with %s", e.Sent, e.Received)
+}
+
+func (e *ChecksumMismatchError) Unwrap() error {
+	return ErrTransferCorrupt
+}
+
+// classify returns the category of a failure from its output, or nil
+func classify(output string) error {
+	output = strings.ToLower(output)
+	for _, category := range failurePatterns {
+		for _, pattern := range category.patterns {
+			if strings.Contains(output, pattern) {
+				return category.kind
+			}
+		}
+	}
+	return nil
+}
+
+// ErrorKind names the category of err for reports and APIs: "connection_failed",
+// "tool_missing", "auth_failed", "disk_full", "transfer_corrupt", or "" if it has none
+func ErrorKind(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrDiskFull):
+		return "disk_full"
+	case errors.Is(err, ErrAuthFailed):
+		return "auth_failed"
+	case errors.Is(err, ErrToolMissing):
+		return "tool_missing"
+	case errors.Is(err, ErrConnectionFailed):
+		return "connection_failed"
+	case errors.Is(err, ErrTransferCorrupt):
+		return "transfer_corrupt"
+	}
+	return ""
+}
+
+// lastLine returns the last non-empty line, which is usually the most specific error message
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+)
+
+// imageVersion matches the version at the start of an image tag, e.g. 15 in 15-alpine
+var imageVersion = regexp.MustCompile(`^\d+(\.\d+)*`)
+
+// ImageDatabase recognises official and common database images, such as postgres:15,
+// bitnami/postgresql or mariadb:11.4, returning the version in the tag if there is one
+func ImageDatabase(image string) (DatabaseType, string, bool) {
+	repository, tag := image, ""
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repository, tag = image[:i], image[i+1:]
+	}
+	repository = strings.ToLower(repository[strings.LastIndex(repository, "/")+1:])
+
+	var dbType DatabaseType
+	switch {
+	case strings.Contains(repository, "timescaledb"):
+		dbType = DatabaseTypeTimescaleDB
+	case strings.Contains(repository, "postgres"), strings.Contains(repository, "postgis"):
+		dbType = DatabaseTypePostgres
+	case strings.Contains(repository, "influxdb"):
+		dbType = DatabaseTypeInfluxDB
+	case strings.Contains(repository, "cockroach"):
+		dbType = DatabaseTypeCockroachDB
+	case strings.Contains(repository, "yugabyte"):
+		dbType = DatabaseTypeYugabyteDB
+	case strings.Contains(repository, "neo4j"):
+		dbType = DatabaseTypeNeo4j
+	case strings.Contains(repository, "mariadb"):
+		dbType = DatabaseTypeMariaDB
+	case strings.Contains(repository, "mysql"), strings.Contains(repository, "percona"):
+		dbType = DatabaseTypeMySQL
+	case strings.Contains(repository, "mongo"):
+		dbType = DatabaseTypeMongoDB
+	default:
+		return "", "", false
+	}
+
+	// These images' tags are not plain versions, e.g. 2.14.2-pg16, v24.1.0 or 5.20-enterprise, and are kept whole
+	switch dbType {
+	case DatabaseTypeTimescaleDB, DatabaseTypeCockroachDB, DatabaseTypeYugabyteDB, DatabaseTypeNeo4j:
+		return dbType, tag, true
+	}
+	// Only a plain version makes a usable tag for the official image that docker-run starts
+	return dbType, imageVersion.FindString(tag), true
+}
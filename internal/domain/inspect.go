@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+)
+
+// DumpSummary describes what a backup artifact holds, as read from the artifact alone
+type DumpSummary struct {
+	Path       string
+	Format     string // e.g. "pg_dump plain SQL" or "mongodump archive"
+	Version    string // Versions of the dump tool and server recorded in the artifact, if any
+	Database   string
+	Compressed string // CompressionGzip or CompressionZstd; empty for plain content
+	Chunked    bool
+	SizeBytes  int64 // On disk; chunked backups share their chunks with others
+	Tables     []TableSummary
+	Notes      []string // What could not be read, or holds no tables
+}
+
+// TableSummary is one table or collection in a dump
+type TableSummary struct {
+	Schema  string // PostgreSQL schema or MongoDB database
+	Name    string
+	Columns []string // Column definitions as declared, e.g. "email text NOT NULL"; none for MongoDB
+	Rows    int64    // Estimated from the data in the dump
+}
+
+// QualifiedName returns the table name with its schema, if any
+func (t TableSummary) QualifiedName() string {
+	if t.Schema == "" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
+
+// SchemaDiff lists how the tables of one dump differ from those of another
+type SchemaDiff struct {
+	From, To string
+	Added    []TableSummary
+	Removed  []TableSummary
+	Changed  []TableChange
+}
+
+// TableChange lists the column differences of a table found in both dumps
+type TableChange struct {
+	Table   string
+	Added   []string // Column definitions
+	Removed []string
+	Altered []ColumnChange
+}
+
+// ColumnChange is a column declared differently in two dumps
+type ColumnChange struct {
+	Column   string
+	From, To string
+}
+
+// IsEmpty reports whether both dumps declare the same tables and columns
+func (d SchemaDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffSchemas compares the tables and columns of two dumps
+func DiffSchemas(from, to DumpSummary) SchemaDiff {
+	diff := SchemaDiff{From: from.Path, To: to.Path}
+
+	before := make(map[string]TableSummary)
+	for _, table := range from.Tables {
+		before[table.QualifiedName()] = table
+	}
+	after := make(map[string]bool)
+	for _, table := range to.Tables {
+		after[table.QualifiedName()] = true
+		old, ok := before[table.QualifiedName()]
+		if !ok {
+			diff.Added = append(diff.Added, table)
+			continue
+		}
+		if change := diffColumns(old, table); len(change.Added)+len(change.Removed)+len(change.Altered) > 0 {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	for _, table := range from.Tables {
+		if !after[table.QualifiedName()] {
+			diff.Removed = append(diff.Removed, table)
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].QualifiedName() < diff.Added[j].QualifiedName() })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].QualifiedName() < diff.Removed[j].QualifiedName() })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Table < diff.Changed[j].Table })
+	return diff
+}
+
+// diffColumns compares the columns of a table by name, the first word of their definitions
+func diffColumns(from, to TableSummary) TableChange {
+	change := TableChange{Table: to.QualifiedName()}
+
+	before := make(map[string]string)
+	for _, column := range from.Columns {
+		before[columnName(column)] = column
+	}
+	after := make(map[string]bool)
+	for _, column := range to.Columns {
+		name := columnName(column)
+		after[name] = true
+		old, ok := before[name]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, column)
+		case old != column:
+			change.Altered = append(change.Altered, ColumnChange{Column: name, From: old, To: column})
+		}
+	}
+	for _, column := range from.Columns {
+		if !after[columnName(column)] {
+			change.Removed = append(change.Removed, column)
+		}
+	}
+	return change
+}
+
+func columnName(definition string) string {
+	name, _, _ := strings.Cut(definition, " ")
+	return strings.Trim(name, "`\"")
+}
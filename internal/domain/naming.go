@@ -0,0 +1,224 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// DefaultNameTemplate names SQL dumps <label>_<timestamp>.sql; the label defaults to the database name
+	DefaultNameTemplate = "{{.Label}}_{{.Timestamp}}.sql"
+	
+	// DefaultMongoNameTemplate names MongoDB dump directories by timestamp only
+	DefaultMongoNameTemplate = "{{.Timestamp}}"
+	
+	// DefaultLabeledMongoNameTemplate is used instead for MongoDB entries labeled differently
+	// from their database, so several instances of one database do not share a directory
+	DefaultLabeledMongoNameTemplate = "{{.Label}}_{{.Timestamp}}"
+	
+	// DefaultMongoArchiveNameTemplate names MongoDB archives, which are single gzipped files
+	DefaultMongoArchiveNameTemplate = "{{.Label}}_{{.Timestamp}}.archive.gz"
+	
+	// DefaultPhysicalNameTemplate names mariabackup streams, which are gzipped on the way to disk
+	DefaultPhysicalNameTemplate = "{{.Label}}_{{.Timestamp}}" + PhysicalBackupExt + ".gz"
+	
+	// DefaultMongoOplogNameTemplate names differential MongoDB backups, which hold oplog entries
+	DefaultMongoOplogNameTemplate = "{{.Label}}_{{.Timestamp}}" + OplogBackupExt + ".gz"
+	
+	// OplogBackupExt marks differential MongoDB backups, which restore replays on top of their base
+	OplogBackupExt = ".oplog.bson"
+	
+	// DefaultSnapshotNameTemplate names the records of volume snapshot backups
+	DefaultSnapshotNameTemplate = "{{.Label}}_{{.Timestamp}}" + SnapshotBackupExt
+	
+	// SnapshotBackupExt marks the records of volume snapshot backups, which describe a
+	// VolumeSnapshot in the cluster rather than hold data
+	SnapshotBackupExt = ".snapshot.json"
+	
+	// DefaultRDSSnapshotNameTemplate names the records of RDS snapshot backups
+	DefaultRDSSnapshotNameTemplate = "{{.Label}}_{{.Timestamp}}" + RDSSnapshotExt
+	
+	// RDSSnapshotExt marks the records of RDS snapshot backups, which describe a snapshot kept
+	// by RDS rather than hold data
+	RDSSnapshotExt = ".rds.json"
+	
+	// DefaultHostSnapshotNameTemplate names the archives of ZFS and LVM snapshots, gzipped on the way to disk
+	DefaultHostSnapshotNameTemplate = "{{.Label}}_{{.Timestamp}}" + HostSnapshotExt + ".gz"
+	
+	// HostSnapshotExt marks tar archives of a ZFS or LVM snapshot of a data directory
+	HostSnapshotExt = ".fs.tar"
+	
+	// DefaultInfluxNameTemplate names InfluxDB backups, whose files are collected in a gzipped tar
+	DefaultInfluxNameTemplate = "{{.Label}}_{{.Timestamp}}" + InfluxBackupExt + ".gz"
+	
+	// InfluxBackupExt marks tar archives of the files influx backup or influxd backup writes
+	InfluxBackupExt = ".influx.tar"
+	
+	// DefaultCockroachNameTemplate names CockroachDB backups, whose files are collected in a gzipped tar
+	DefaultCockroachNameTemplate = "{{.Label}}_{{.Timestamp}}" + CockroachBackupExt + ".gz"
+	
+	// CockroachBackupExt marks tar archives of the files a CockroachDB BACKUP writes
+	CockroachBackupExt = ".crdb.tar"
+	
+	// DefaultNeo4jNameTemplate names Neo4j backups, tar archives of neo4j-admin's already compressed files
+	DefaultNeo4jNameTemplate = "{{.Label}}_{{.Timestamp}}" + Neo4jBackupExt
+	
+	// Neo4jBackupExt marks tar archives of a neo4j-admin database dump or backup
+	Neo4jBackupExt = ".neo4j.tar"
+	
+	// DefaultEtcdNameTemplate names etcd snapshots, gzipped on the way to disk
+	DefaultEtcdNameTemplate = "{{.Label}}_{{.Timestamp}}" + EtcdSnapshotExt + ".gz"
+	
+	// EtcdSnapshotExt marks etcd snapshots, a bbolt database followed by its SHA-256
+	EtcdSnapshotExt = ".etcd.db"
+	
+	// DefaultRabbitMQNameTemplate names RabbitMQ definitions, kept as plain JSON as they are small
+	DefaultRabbitMQNameTemplate = "{{.Label}}_{{.Timestamp}}" + RabbitMQDefinitionsExt
+	
+	// RabbitMQDefinitionsExt marks RabbitMQ definitions exported from the management API
+	RabbitMQDefinitionsExt = ".rabbitmq.json"
+	
+	// PhysicalBackupExt marks mariabackup xbstream files, which restore prepares instead of loading
+	PhysicalBackupExt = ".xbstream"
+	
+	// DefaultTimestampFormat is the Go time layout used in backup names
+	DefaultTimestampFormat = "2006-01-02_15-04-05"
+	
+	// ZonedTimestampFormat is used instead when a timezone is configured, so the name
+	// carries its UTC offset: 2025-01-02_03-04-05Z or 2025-01-02_05-04-05+0200
+	ZonedTimestampFormat = DefaultTimestampFormat + "Z0700"
+)
+
+// PartialDir is the directory next to finished backups that backups are written in until they
+// are complete and validated. Its leading dot keeps it out of backup listings.
+const PartialDir = ".partial"
+
+// PartialPath returns where the backup at backupPath is written before it is moved into place
+func PartialPath(backupPath string) string {
+	return filepath.Join(filepath.Dir(backupPath), PartialDir, filepath.Base(backupPath))
+}
+
+// globalsMarker is inserted before the extension of a PostgreSQL dump to name its globals file
+const globalsMarker = ".globals"
+
+// GlobalsPath returns where the roles and tablespaces of a PostgreSQL dump are kept:
+// mydb_<timestamp>.sql becomes mydb_<timestamp>.globals.sql, keeping a .gz or .zst suffix
+func GlobalsPath(backupPath string) string {
+	base := TrimCompressedExt(backupPath)
+	ext := filepath.Ext(base)
+	if ext != ".sql" {
+		ext = ""
+	}
+	return strings.TrimSuffix(base, ext) + globalsMarker + ".sql" + backupPath[len(base):]
+}
+
+// IsGlobalsFile reports whether path is the globals file of a PostgreSQL dump rather than a dump
+func IsGlobalsFile(path string) bool {
+	return strings.Contains(filepath.Base(path), globalsMarker+".sql")
+}
+
+// IsPhysicalBackup reports whether path holds a mariabackup stream rather than a logical dump
+func IsPhysicalBackup(path string) bool {
+	return strings.Contains(filepath.Base(path), PhysicalBackupExt)
+}
+
+// IsInfluxBackup reports whether path holds a tar archive of an InfluxDB backup
+func IsInfluxBackup(path string) bool {
+	return strings.Contains(filepath.Base(path), InfluxBackupExt)
+}
+
+// IsCockroachBackup reports whether path holds a tar archive of a CockroachDB backup
+func IsCockroachBackup(path string) bool {
+	return strings.Contains(filepath.Base(path), CockroachBackupExt)
+}
+
+// IsNeo4jBackup reports whether path holds a tar archive of a Neo4j dump or backup
+func IsNeo4jBackup(path string) bool {
+	return strings.Contains(filepath.Base(path), Neo4jBackupExt)
+}
+
+// IsEtcdSnapshot reports whether path holds an etcd snapshot
+func IsEtcdSnapshot(path string) bool {
+	return strings.Contains(filepath.Base(path), EtcdSnapshotExt)
+}
+
+// IsRabbitMQDefinitions reports whether path holds exported RabbitMQ definitions
+func IsRabbitMQDefinitions(path string) bool {
+	return strings.Contains(filepath.Base(path), RabbitMQDefinitionsExt)
+}
+
+// IsOplogBackup reports whether path holds the oplog entries of a differential MongoDB backup
+func IsOplogBackup(path string) bool {
+	return strings.Contains(filepath.Base(path), OplogBackupExt)
+}
+
+// IsSnapshotBackup reports whether path records a volume snapshot rather than holds a dump
+func IsSnapshotBackup(path string) bool {
+	return strings.HasSuffix(path, SnapshotBackupExt)
+}
+
+// IsRDSSnapshot reports whether path records an RDS or Aurora snapshot rather than holds a dump
+func IsRDSSnapshot(path string) bool {
+	return strings.HasSuffix(path, RDSSnapshotExt)
+}
+
+// IsHostSnapshot reports whether path holds an archive of a ZFS or LVM snapshot rather than a dump
+func IsHostSnapshot(path string) bool {
+	return strings.Contains(filepath.Base(path), HostSnapshotExt)
+}
+
+// FormatTimestamp formats t for a backup name. An empty timezone keeps the local time and
+// format; otherwise t is converted to the zone ("UTC", "Local" or an IANA name such as
+// "Europe/Berlin") and an empty format includes the offset.
+func FormatTimestamp(t time.Time, format, timezone string) (string, error) {
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return "", fmt.Errorf("unknown timezone %q", timezone)
+		}
+		t = t.In(loc)
+		if format == "" {
+			format = ZonedTimestampFormat
+		}
+	}
+	if format == "" {
+		format = DefaultTimestampFormat
+	}
+	return t.Format(format), nil
+}
+
+// BackupName holds the values a backup name template can use
+type BackupName struct {
+	Label       string // DatabaseConfig.Label, or the database name
+	Database    string
+	Type        string
+	Host        string
+	Method      string
+	Mode        string // full, schema-only or data-only
+	Environment string // BackupConfig.Environment, e.g. prod
+	Timestamp   string // Formatted by FormatTimestamp
+	Ext         string // ".sql", ".archive.gz", ".xbstream.gz" ".oplog.bson.gz", ".snapshot.json", ".fs.tar.gz", ".influx.tar.gz", ".crdb.tar.gz", ".neo4j.tar", ".etcd.db.gz" or ".rabbitmq.json" for archives, physical, differential, snapshot, InfluxDB, CockroachDB, Neo4j, etcd and RabbitMQ backups, or empty for MongoDB dump directories
+}
+
+// Render executes a name template such as "{{.Database}}-{{.Timestamp}}.sql.gz".
+// The result must be a plain file name; subdirectories are not allowed.
+func (n BackupName) Render(nameTemplate string) (string, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid name template: %w", err)
+	}
+	
+	var name strings.Builder
+	if err := tmpl.Execute(&name, n); err != nil {
+		return "", fmt.Errorf("invalid name template: %w", err)
+	}
+	
+	result := name.String()
+	if result == "" || result == "." || result == ".." || strings.ContainsAny(result, `/\`) {
+		return "", fmt.Errorf("name template produced an invalid file name %q", result)
+	}
+	return result, nil
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFullEvery is how long differential MongoDB backups build on one full backup
+const DefaultFullEvery = 7 * 24 * time.Hour
+
+// OplogTimestamp is a position in the MongoDB oplog: seconds since the epoch and an
+// increment ordering the operations within that second
+type OplogTimestamp struct {
+	T uint32
+	I uint32
+}
+
+// String formats the timestamp as "T:I", the form kept in the catalog
+func (ts OplogTimestamp) String() string {
+	return fmt.Sprintf("%d:%d", ts.T, ts.I)
+}
+
+// ParseOplogTimestamp parses a timestamp formatted by OplogTimestamp.String
+func ParseOplogTimestamp(s string) (OplogTimestamp, error) {
+	t, i, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return OplogTimestamp{}, fmt.Errorf("invalid oplog timestamp %q", s)
+	}
+	seconds, err := strconv.ParseUint(t, 10, 32)
+	if err != nil {
+		return OplogTimestamp{}, fmt.Errorf("invalid oplog timestamp %q", s)
+	}
+	increment, err := strconv.ParseUint(i, 10, 32)
+	if err != nil {
+		return OplogTimestamp{}, fmt.Errorf("invalid oplog timestamp %q", s)
+	}
+	return OplogTimestamp{T: uint32(seconds), I: uint32(increment)}, nil
+}
+
+// Before reports whether ts comes earlier in the oplog than other
+func (ts OplogTimestamp) Before(other OplogTimestamp) bool {
+	return ts.T < other.T || ts.T == other.T && ts.I < other.I
+}
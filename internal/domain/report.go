@@ -0,0 +1,67 @@
+package domain
+
+import "time"
+
+// AuditEventKind is what an AuditEvent records
+type AuditEventKind string
+
+// Audit event kinds
+const (
+	AuditEventBackupFailed AuditEventKind = "backup_failed" // A backup that did not complete, so it has no catalog entry
+	AuditEventDrill        AuditEventKind = "drill"         // A restore drill of a backup
+	AuditEventRemoval      AuditEventKind = "removal"       // A backup deleted by prune
+)
+
+// AuditEvent records something that happened to the backups of a backup directory that the
+// catalog does not keep, since it only lists the backups that exist
+type AuditEvent struct {
+	Time   time.Time      `json:"time"`
+	Kind   AuditEventKind `json:"kind"`
+	Backup CatalogEntry   `json:"backup"`           // The backup concerned; failed backups have no path
+	Passed bool           `json:"passed,omitempty"` // Drills: the backup restored and passed its checks
+	Detail string         `json:"detail,omitempty"` // The error, the checks run or the retention rule applied
+}
+
+// ComplianceReport lists what happened to the backups of a backup directory over a period,
+// as evidence for audits
+type ComplianceReport struct {
+	BackupDir     string
+	From          time.Time // Inclusive
+	To            time.Time // Exclusive
+	GeneratedAt   time.Time
+	Backups       []CatalogEntry // Taken in the period, oldest first, including those removed since
+	Failures      []AuditEvent   // Backups that failed in the period
+	Verifications []AuditEvent   // Restore drills in the period
+	Removals      []AuditEvent   // Backups removed in the period
+}
+
+// TotalBytes is the size of the backups taken in the period
+func (r ComplianceReport) TotalBytes() int64 {
+	var total int64
+	for _, entry := range r.Backups {
+		total += entry.SizeBytes
+	}
+	return total
+}
+
+// FailedVerifications counts the drills that did not pass
+func (r ComplianceReport) FailedVerifications() int {
+	failed := 0
+	for _, event := range r.Verifications {
+		if !event.Passed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// RemovedAt returns when the backup at path was removed, or the zero time if it still exists
+// or was removed after the period
+func (r ComplianceReport) RemovedAt(path string) time.Time {
+	for _, event := range r.Removals {
+		if event.Backup.Path == path {
+			return event.Time
+		}
+	}
+	return time.Time{}
+}
@@ -1,19 +1,256 @@
 package domain
 
+import (
+	"io"
+	"time"
+)
+
 // BackupRepository defines the interface for backup operations
 type BackupRepository interface {
-	// BackupPostgres performs a PostgreSQL backup
-	BackupPostgres(config DatabaseConfig, method BackupMethod, backupPath, namespace string) error
+	// MongoOplogTimestamp returns the position of the newest entry in the MongoDB oplog
+	MongoOplogTimestamp(config DatabaseConfig, method BackupMethod, namespace string) (OplogTimestamp, error)
+	
+	// BackupMongoOplog dumps the oplog entries of config.Database written after since
+	BackupMongoOplog(config DatabaseConfig, method BackupMethod, backupPath, namespace string, since OplogTimestamp) error
+	
+	// BackupVolumeSnapshot quiesces the database, takes a VolumeSnapshot of its claim and
+	// writes a record of it to backupPath
+	BackupVolumeSnapshot(config DatabaseConfig, method BackupMethod, backupPath, namespace string) error
+	
+	// BackupHostSnapshot quiesces the database, takes a ZFS or LVM snapshot of its data on this
+	// machine and archives the snapshot to backupPath
+	BackupHostSnapshot(config DatabaseConfig, method BackupMethod, backupPath, namespace string) error
+	
+	// BackupRDSSnapshot takes an RDS or Aurora snapshot, waits until it is available, starts
+	// its export to S3 if configured and writes a record of it to backupPath. It returns the
+	// snapshot's ARN.
+	BackupRDSSnapshot(config DatabaseConfig, backupPath string) (string, error)
+	
+	// ValidateBackup checks that a finished artifact is non-empty and looks like a complete dump
+	ValidateBackup(dbType DatabaseType, backupPath string) error
+	
+	// InspectBackup reads an artifact and summarizes its format, versions and tables
+	InspectBackup(backupPath string) (DumpSummary, error)
+	
+	// GetFileSize returns the size in bytes of a file, of all files in a directory, or of the
+	// volume a snapshot record describes
+	GetFileSize(path string) (int64, error)
+	
+	// EstimateSize asks the database engine roughly how large a dump of config.Database will be
+	EstimateSize(config DatabaseConfig, method BackupMethod, namespace string) (int64, error)
+	
+	// TestConnection runs a trivial query, such as SELECT 1, against the database the way its
+	// backup reaches it, returning ErrNoConnectionTest for engines that have none
+	TestConnection(config DatabaseConfig, method BackupMethod, namespace string) error
+	
+	// FreeSpace returns the bytes available on the filesystem that will hold dir
+	FreeSpace(dir string) (int64, error)
+	
+	// FinalizeBackup moves a complete backup from partialPath to backupPath. Directories are
+	// merged into an existing backupPath entry by entry.
+	FinalizeBackup(partialPath, backupPath string) error
+	
+	// RemoveBackup deletes what a failed backup left at path, a file or a directory, and the
+	// directory holding it once that is empty
+	RemoveBackup(path string) error
+	
+	// SignBackup writes the detached signature of the backup at path, with its globals file if
+	// it has one, made with the Ed25519 private key in keyFile
+	SignBackup(path, keyFile string) error
+	
+	// ChecksumBackup writes the checksum file of the backup at path, with its globals file if
+	// it has one, replacing an older one
+	ChecksumBackup(path string) error
+	
+	// SplitBackup cuts the backup file at path into parts of partSize bytes, the last one
+	// smaller, and hands each to put in order as a temporary file that is removed afterwards.
+	// The first skip parts, put by an earlier attempt, are only hashed. It returns the parts
+	// with their SHA-256, or on failure those put so far.
+	SplitBackup(path string, partSize int64, skip int, put func(index int, partPath string) error) ([]Part, error)
+	
+	// EncryptBackup encrypts the backup at path in place, with its globals file if it has one,
+	// under a new data key that is wrapped with the KMS key of encryption and kept next to it
+	EncryptBackup(path string, encryption Encryption) error
+	
+	// BackupEncryption returns the KMS key the data key of the backup at path is wrapped with,
+	// or nil if the backup is not encrypted
+	BackupEncryption(path string) (*Encryption, error)
+	
+	// RekeyBackup wraps the data key of the encrypted backup at path with the KMS key of
+	// encryption instead. With reencrypt the backup is encrypted again under a new data key.
+	RekeyBackup(path string, encryption Encryption, reencrypt bool) error
+	
+	// ListWorkloads returns the running containers, or the running pods in namespace, that
+	// method can run commands in; config holds the kubeconfig and context
+	ListWorkloads(config DatabaseConfig, method BackupMethod, namespace string) ([]Workload, error)
+	
+	// ReadEnvironment returns the environment variables of the database's container or pod
+	ReadEnvironment(config DatabaseConfig, method BackupMethod, namespace string) (map[string]string, error)
+	
+	// ManagedLogin returns config with a fresh IAM token as its password when it is a managed
+	// database logging in with IAM, and config as it is otherwise
+	ManagedLogin(config DatabaseConfig) (DatabaseConfig, error)
+	
+	// Interrupt stops the commands and requests running for backups, which then fail, and makes
+	// later ones fail at once. Temporary directories they left in containers and pods are removed,
+	// and databases locked or stopped for a backup are unlocked or started again.
+	Interrupt()
+}
+
+// ProfileRepository persists reusable backup configurations
+type ProfileRepository interface {
+	// SaveProfile stores a configuration under name, without secrets
+	SaveProfile(name string, config BackupConfig) error
+	
+	// LoadProfile returns a previously saved configuration
+	LoadProfile(name string) (BackupConfig, error)
+	
+	// SaveLastAnswers stores the answers of the last interactive session, without secrets
+	SaveLastAnswers(config BackupConfig) error
+	
+	// LoadLastAnswers returns the answers of the last interactive session, or an empty
+	// configuration before the first one
+	LoadLastAnswers() (BackupConfig, error)
+}
+
+// RestoreRepository defines the interface for restore operations
+type RestoreRepository interface {
+	// Query runs a SQL query or mongosh expression against config.Database and returns what it printed
+	Query(config DatabaseConfig, method BackupMethod, namespace, query string) (string, error)
+	
+	// VerifySignature checks the backup at path against its detached signature with the public
+	// key in keyFile, returning an error wrapping ErrSignatureInvalid if they do not match
+	VerifySignature(path, keyFile string) error
+	
+	// VerifyChecksum checks the backup at path against its checksum file, returning
+	// ErrNoChecksum if it has none and an error wrapping ErrChecksumMismatch if a file is
+	// missing, was added or changed
+	VerifyChecksum(path string) error
+	
+	// JoinParts writes the parts of a backup, in order, to a new file at path. fetch downloads
+	// the part with the given index to partPath, which does not exist yet; each part is checked
+	// against its size and SHA-256 before it is appended.
+	JoinParts(path string, parts []Part, fetch func(index int, partPath string) error) error
+	
+	// DecryptBackup returns path itself for a backup that is not encrypted. An encrypted one is
+	// decrypted, with its globals file, into a new directory under PartialDir next to it, and
+	// the copy's path is returned; the caller removes the directory once done with it.
+	DecryptBackup(path string) (string, error)
+	
+	// PrepareMariaDB extracts a mariabackup stream and prepares it, returning the data directory
+	// that can replace the server's own: inside the container or pod, or on the host for docker-run
+	PrepareMariaDB(config DatabaseConfig, method BackupMethod, backupPath, namespace, tempDir string) (string, error)
+	
+	// RestoreTable loads one table of a SQL dump into config.Database, replacing the table there
+	RestoreTable(config DatabaseConfig, method BackupMethod, backupPath, table, namespace string) error
+	
+	// RestoreMongoCollection loads one collection of sourceDatabase from a mongodump directory or
+	// archive into config.Database, replacing the collection there
+	RestoreMongoCollection(config DatabaseConfig, method BackupMethod, backupPath, sourceDatabase, collection, namespace, tempDir string) error
+	
+	// RestoreVolumeSnapshot creates a PersistentVolumeClaim from the snapshot recorded at
+	// backupPath and returns its name; the database has to be pointed at it
+	RestoreVolumeSnapshot(config DatabaseConfig, method BackupMethod, backupPath, namespace string) (string, error)
+	
+	// RestoreRDSSnapshot creates a new DB instance or Aurora cluster from the snapshot recorded
+	// at backupPath and returns its identifier; the database has to be pointed at it
+	RestoreRDSSnapshot(config DatabaseConfig, backupPath string) (string, error)
+	
+	// ExtractHostSnapshot unpacks the archive of a ZFS or LVM snapshot next to it, keeping
+	// owners and permissions, and returns the directory to copy back into the data directory
+	ExtractHostSnapshot(backupPath string) (string, error)
+	
+	// ReplayMongoOplog applies the oplog entries of a differential backup with mongorestore
+	// --oplogReplay, only those up to and including until unless it is zero
+	ReplayMongoOplog(config DatabaseConfig, method BackupMethod, backupPath, namespace string, until time.Time) error
+	
+	// ManagedLogin returns config with a fresh IAM token as its password, see BackupRepository
+	ManagedLogin(config DatabaseConfig) (DatabaseConfig, error)
+}
+
+// CloneRepository copies a database directly from a source into a target
+type CloneRepository interface {
+	// Clone dumps config.Source and loads it into config.Target, streaming where the engine allows
+	Clone(config CloneConfig) error
+}
+
+// ChunkRepository stores backups as content-defined chunks, so data that did not change
+// between runs is kept only once
+type ChunkRepository interface {
+	// Pack splits the backup file at path into chunks kept in storeDir and replaces the
+	// file with a manifest listing them; chunks already in the store are shared
+	Pack(path, storeDir string) (PackStats, error)
+	
+	// IsPacked reports whether the file at path is a manifest written by Pack
+	IsPacked(path string) (bool, error)
+	
+	// Open returns the content of a packed backup as it was before packing
+	Open(path string) (io.ReadCloser, error)
+	
+	// Collect removes the chunks in storeDir that no manifest under backupDir refers to;
+	// with dryRun it only reports what would be removed
+	Collect(backupDir, storeDir string, dryRun bool) (CollectStats, error)
+}
+
+// DrillRepository runs the scratch servers restore drills load backups into
+type DrillRepository interface {
+	// StartScratch starts a disposable server of config's engine and version in a container and
+	// returns config pointed at it, for docker-exec, once it accepts connections
+	StartScratch(config DatabaseConfig) (DatabaseConfig, error)
+	
+	// RemoveScratch stops a scratch server and deletes it with its data
+	RemoveScratch(scratch DatabaseConfig) error
+	
+	// Interrupt stops the commands running for drills, which then fail; scratch servers can
+	// still be removed
+	Interrupt()
+}
+
+// HeartbeatRepository reports runs to a monitoring service
+type HeartbeatRepository interface {
+	// Ping calls url, sending message (which may be empty) as the request body
+	Ping(url, message string) error
+}
+
+// CatalogRepository records finished backups so they can be found again
+type CatalogRepository interface {
+	// AddEntry records a backup in the catalog of backupDir and returns the record, which has
+	// an ID assigned unless entry already had one
+	AddEntry(backupDir string, entry CatalogEntry) (CatalogEntry, error)
+	
+	// UpdateEntry replaces the record of the backup at entry.Path, adding one for a backup that
+	// predates the catalog
+	UpdateEntry(backupDir string, entry CatalogEntry) error
+	
+	// ListEntries returns the backups of a database type under backupDir, newest first.
+	// Dumps on disk that predate the catalog are included as well.
+	ListEntries(backupDir string, dbType DatabaseType) ([]CatalogEntry, error)
+	
+	// ListRecords returns every backup recorded in the catalog of backupDir, including those
+	// no longer on disk that are kept in stores
+	ListRecords(backupDir string) ([]CatalogEntry, error)
+	
+	// ListOrphans returns the signatures, data keys, checksum and globals files under backupDir
+	// whose backup is gone, e.g. as it was deleted by hand
+	ListOrphans(backupDir string) ([]string, error)
+	
+	// WriteManifest writes entry to the manifest file at path, see ManifestExt
+	WriteManifest(path string, entry CatalogEntry) error
+	
+	// ReadManifest reads the catalog entry of a manifest file
+	ReadManifest(path string) (CatalogEntry, error)
 	
-	// BackupMySQL performs a MySQL backup
-	BackupMySQL(config DatabaseConfig, method BackupMethod, backupPath, namespace string) error
+		// RemoveEntry deletes a backup and its catalog record. It fails with a *BaseInUseError
+	// while differential backups still build on it.
+	RemoveEntry(backupDir string, entry CatalogEntry) error
 	
-	// BackupMariaDB performs a MariaDB backup
-	BackupMariaDB(config DatabaseConfig, method BackupMethod, backupPath, namespace string) error
+	// RemoveLocal deletes a backup kept in stores from disk, keeping its catalog record, so
+	// restore retrieves it from the stores, see DatabaseConfig.LocalKeep
+	RemoveLocal(entry CatalogEntry) error
 	
-	// BackupMongoDB performs a MongoDB backup
-	BackupMongoDB(config DatabaseConfig, method BackupMethod, backupPath, namespace, tempDir string) error
+	// AddEvent appends an event to the audit log of backupDir, which is never rewritten
+	AddEvent(backupDir string, event AuditEvent) error
 	
-	// GetFileSize returns the size of a file or directory
-	GetFileSize(path string, isDirectory bool) (string, error)
+	// ListEvents returns the audit log of backupDir, oldest first
+	ListEvents(backupDir string) ([]AuditEvent, error)
 }
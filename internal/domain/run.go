@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrRunInProgress is returned when a run is requested while another one is still going
+var ErrRunInProgress = errors.New("a backup or restore is already in progress")
+
+// ErrRunNotFound is returned when no run has the requested ID
+var ErrRunNotFound = errors.New("run not found")
+
+// ErrBackupNotFound is returned when no catalog entry has the requested ID
+var ErrBackupNotFound = errors.New("backup not found")
+
+// ErrNoRestoreTarget is returned when no configured database matches the backup to restore
+var ErrNoRestoreTarget = errors.New("no database in the config matches the backup")
+
+// RunKind tells backup runs from restores started in serve mode
+type RunKind string
+
+const (
+	RunKindBackup  RunKind = "backup"
+	RunKindRestore RunKind = "restore"
+)
+
+// RunStatus is the state of a run started through the API
+type RunStatus string
+
+const (
+	RunStatusRunning   RunStatus = "running"
+	RunStatusSucceeded RunStatus = "succeeded"
+	RunStatusFailed    RunStatus = "failed"
+)
+
+// Run tracks one backup of the configured databases, or one restore, started in serve mode
+type Run struct {
+	ID         string
+	Kind       RunKind
+	Status     RunStatus
+	Filter     Tags   // Backups only
+	Backup     string // Restores only: ID of the catalog entry being restored
+	Current    string // Database being backed up while running
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Results    []BackupResult
+	Restore    *RestoreResult
+	Error      string
+}
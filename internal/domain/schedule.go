@@ -0,0 +1,172 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression: minute, hour, day of month, month and day of week
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // Bit sets of the allowed values
+	domAny, dowAny                bool   // The field was "*", so only the other day field restricts
+}
+
+var scheduleMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a five-field cron expression such as "30 2 * * 1-5" or a macro such as @daily.
+// Fields accept *, numbers, ranges (a-b), lists (a,b) and steps (*/n, a-b/n). Day of week 0 and 7 are Sunday.
+func ParseSchedule(expr string) (Schedule, error) {
+	if macro, ok := scheduleMacros[strings.TrimSpace(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("schedule %q must have 5 fields (minute hour day month weekday)", expr)
+	}
+
+	var s Schedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return Schedule{}, fmt.Errorf("invalid minute in schedule %q: %w", expr, err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return Schedule{}, fmt.Errorf("invalid hour in schedule %q: %w", expr, err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return Schedule{}, fmt.Errorf("invalid day of month in schedule %q: %w", expr, err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return Schedule{}, fmt.Errorf("invalid month in schedule %q: %w", expr, err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return Schedule{}, fmt.Errorf("invalid day of week in schedule %q: %w", expr, err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+	return s, nil
+}
+
+// parseCronField returns the values allowed by one field as a bit set
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", from)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", to)
+				}
+			} else if hasStep {
+				high = max // "5/15" means from 5 to the end in steps of 15
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time after t that matches the schedule, in t's location
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// Every valid expression matches within a few years; stop in case of one like "0 0 31 2 *"
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches applies cron's rule that a day matches either day field when both are restricted
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Values returns the values each field allows in ascending order, nil for a minute, hour or month
+// field that allows them all and for a day field written as "*". Days of the week run from 0 (Sunday) to 6.
+func (s Schedule) Values() (minute, hour, dom, month, dow []int) {
+	minute, hour, month = bitValues(s.minute, 0, 59), bitValues(s.hour, 0, 23), bitValues(s.month, 1, 12)
+	if !s.domAny {
+		dom = setBits(s.dom, 1, 31)
+	}
+	if !s.dowAny {
+		dow = setBits(s.dow, 0, 6)
+	}
+	return minute, hour, dom, month, dow
+}
+
+// bitValues returns the values set in bits, or nil when all of min to max are
+func bitValues(bits uint64, min, max int) []int {
+	values := setBits(bits, min, max)
+	if len(values) == max-min+1 {
+		return nil
+	}
+	return values
+}
+
+func setBits(bits uint64, min, max int) []int {
+	var values []int
+	for v := min; v <= max; v++ {
+		if bits&(1<<uint(v)) != 0 {
+			values = append(values, v)
+		}
+	}
+	return values
+}
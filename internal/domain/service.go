@@ -1,21 +1,105 @@
 package domain
 
+import "time"
+
+// ReviewAction is what user chose to do with the configuration summary
+type ReviewAction int
+
+const (
+	ReviewProceed ReviewAction = iota
+	ReviewEdit
+	ReviewRemove
+	ReviewCancel
+)
+
 // ConfigService defines the interface for configuration operations
 type ConfigService interface {
+	// RememberAnswers offers the answers of a previous session, such as hosts, users and
+	// containers, as defaults for the questions that follow
+	RememberAnswers(last BackupConfig)
+	
+	// OfferWorkloads offers the running containers or pods, of the database's type by image,
+	// to pick from where one is asked for
+	OfferWorkloads(workloads []Workload)
+	
 	// SelectBackupMethod prompts user to select backup method
 	SelectBackupMethod() (BackupMethod, error)
 	
-	// SelectDatabases prompts user to select databases to backup
+	// SelectDatabases prompts user to select databases to backup, returning ErrBack to choose
+	// the backup method again
 	SelectDatabases() ([]DatabaseType, error)
 	
+	// SelectDiscoveredDatabases lets user pick which of the databases found in source to back up;
+	// picking none falls back to choosing database types. Returns ErrBack like SelectDatabases.
+	SelectDiscoveredDatabases(source string, found []DiscoveredDatabase) ([]DiscoveredDatabase, error)
+	
+	// ConfigureDiscoveredDatabase prompts user to check the details of a discovered database,
+	// offering what was found as defaults
+	ConfigureDiscoveredDatabase(found DiscoveredDatabase, method BackupMethod) (DatabaseConfig, error)
+	
+	// SelectAnotherDatabase asks whether to add one more database, possibly of a type already
+	// chosen. With canGoBack, it may return ErrBack to change the database configured last.
+	SelectAnotherDatabase(canGoBack bool) (DatabaseType, bool, error)
+	
+	// PromptLabel asks for a label telling a database apart from others of its type
+	PromptLabel(config DatabaseConfig) (string, error)
+	
 	// GetKubernetesNamespace prompts user for Kubernetes namespace
 	GetKubernetesNamespace() (string, error)
 	
+	// GetKubernetesContext prompts user for the default kubeconfig and context
+	GetKubernetesContext() (kubeconfig, kubeContext string, err error)
+	
 	// ConfigureDatabase prompts user to configure a specific database
 	ConfigureDatabase(dbType DatabaseType, method BackupMethod) (DatabaseConfig, error)
 	
-	// ConfirmBackup asks user to confirm backup operation
-	ConfirmBackup(config BackupConfig) (bool, error)
+	// PromptTarget prompts user for only the container or pod of a database, so its
+	// environment can be read before the other details are asked
+	PromptTarget(dbType DatabaseType, method BackupMethod) (DatabaseConfig, error)
+	
+	// ConfirmCredentials asks user whether to use the credentials found in the environment of target
+	ConfirmCredentials(target DatabaseConfig, found DatabaseConfig, method BackupMethod) (bool, error)
+	
+	// ConfigureTargetDatabase prompts user for the details of a database other than its
+	// container or pod, offering the values already set in known as defaults
+	ConfigureTargetDatabase(known DatabaseConfig, method BackupMethod) (DatabaseConfig, error)
+	
+	// ConfirmConnectionTest asks user whether to test the connection to a database just configured
+	ConfirmConnectionTest(config DatabaseConfig) (bool, error)
+	
+	// ReviewConnectionFailure asks user whether to edit a database that could not be reached,
+	// to keep it as it is (ReviewProceed) or to leave it out (ReviewRemove)
+	ReviewConnectionFailure(config DatabaseConfig) (ReviewAction, error)
+	
+	// ReviewBackup asks user to proceed with the backup, to edit or remove one of its
+	// databases, whose index is returned, or to cancel
+	ReviewBackup(config BackupConfig) (ReviewAction, int, error)
+	
+	// EditDatabase asks again for the details of a database, offering its current values as
+	// defaults; a password left blank is kept
+	EditDatabase(config DatabaseConfig, method BackupMethod) (DatabaseConfig, error)
+	
+	// PromptPassword asks for a database password that is not stored in a profile
+	PromptPassword(config DatabaseConfig) (string, error)
+	
+	// PromptProfileName asks whether to save the session as a profile; empty means no
+	PromptProfileName() (string, error)
+	
+	// SelectDatabaseType prompts user to select a single database type
+	SelectDatabaseType() (DatabaseType, error)
+	
+	// SelectBackup prompts user to pick one of the available backups
+	SelectBackup(entries []CatalogEntry) (CatalogEntry, error)
+	
+	// ConfigureRestoreTarget prompts user for the database to restore into; the
+	// database name defaults to the one in the backup and may be changed to restore a copy
+	ConfigureRestoreTarget(entry CatalogEntry, method BackupMethod) (DatabaseConfig, error)
+	
+	// ConfirmRestore asks user to confirm overwriting the target database
+	ConfirmRestore(entry CatalogEntry, target DatabaseConfig, method BackupMethod) (bool, error)
+	
+	// ConfirmClone asks user to confirm overwriting the clone target
+	ConfirmClone(config CloneConfig) (bool, error)
 }
 
 // OutputService defines the interface for output operations
@@ -26,12 +110,44 @@ type OutputService interface {
 	// PrintConfigSummary prints the backup configuration summary
 	PrintConfigSummary(config BackupConfig)
 	
+	// PrintEstimate prints the expected dump sizes and the free space at the destination
+	PrintEstimate(estimate BackupEstimate)
+	
 	// PrintBackupStart prints backup start message
 	PrintBackupStart(dbType DatabaseType, config DatabaseConfig, method BackupMethod)
 	
 	// PrintBackupResult prints backup result
 	PrintBackupResult(result BackupResult)
 	
+	// PrintRestoreStart prints restore start message
+	PrintRestoreStart(entry CatalogEntry, target DatabaseConfig, method BackupMethod)
+	
+	// PrintRestoreResult prints restore result
+	PrintRestoreResult(result RestoreResult)
+	
+	// PrintCloneStart prints clone start message
+	PrintCloneStart(config CloneConfig)
+	
+	// PrintChain prints a full backup and the differential backups that build on it
+	PrintChain(chain BackupChain)
+	
+	// PrintDumpSummary prints what a backup artifact holds
+	PrintDumpSummary(summary DumpSummary)
+	
+	// PrintSchemaDiff prints how the tables of two dumps differ
+	PrintSchemaDiff(diff SchemaDiff)
+	
+	// PrintDrillResult prints whether a database's backup restored and passed its checks
+	PrintDrillResult(result DrillResult)
+	
+	// PrintPhase reports how long a phase of a database's backup took, e.g. the dump or the
+	// copy to a store, for verbose output
+	PrintPhase(dbType DatabaseType, label, phase string, elapsed time.Duration)
+	
+	// PrintCommand reports a command run in a container, pod or on this machine, and where,
+	// for verbose output. Commands hold passwords, which have to be redacted.
+	PrintCommand(where, command string)
+	
 	// PrintSummary prints final summary
 	PrintSummary(results []BackupResult)
 	
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// SignatureExt is appended to the path of a backup to name its detached signature
+const SignatureExt = ".sig"
+
+// ErrSignatureInvalid is returned for a backup whose signature is missing, was made with
+// another key or no longer matches its content
+var ErrSignatureInvalid = errors.New("signature verification failed")
+
+// Signing configures signing backups with an Ed25519 key and verifying the signatures before
+// restores. Keys are PEM files, as written by
+// "openssl genpkey -algorithm ed25519" and "openssl pkey -pubout".
+type Signing struct {
+	Key       string // Private key backups are signed with
+	PublicKey string // Public key restores verify with; defaults to the one of Key
+}
+
+// VerifyKey returns the key file restores verify signatures with, or "" if s is nil
+func (s *Signing) VerifyKey() string {
+	if s == nil {
+		return ""
+	}
+	if s.PublicKey != "" {
+		return s.PublicKey
+	}
+	return s.Key
+}
+
+// SignaturePath returns where the detached signature of the backup at backupPath is kept
+func SignaturePath(backupPath string) string {
+	return strings.TrimSuffix(backupPath, string(filepath.Separator)) + SignatureExt
+}
+
+// IsSignatureFile reports whether path is the signature of a backup rather than a backup
+func IsSignatureFile(path string) bool {
+	return strings.HasSuffix(path, SignatureExt)
+}
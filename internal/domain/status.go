@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultAlertInterval is how often serve checks the expectations when Alerts.Interval is not set
+const DefaultAlertInterval = 5 * time.Minute
+
+// Alerts has serve check continuously that every database meets its expectations, its max age
+// and min size, and report databases that stop or start meeting them
+type Alerts struct {
+	URL      string        // POSTed a plain text message for every change, e.g. an ntfy.sh topic or a chat webhook relay
+	Interval time.Duration // How often the expectations are checked; zero uses DefaultAlertInterval
+}
+
+// BackupStatus is how fresh and large the newest backup of a configured database is
+type BackupStatus struct {
+	Database DatabaseConfig
+	Last     *CatalogEntry // Newest backup; nil when the database has none
+	Age      time.Duration // Since Last was taken
+	Size     int64         // Of Last in bytes; -1 when unknown, e.g. for a directory dumped before the catalog
+	MaxAge   time.Duration // Oldest the newest backup may be; zero is not checked
+	MinSize  int64         // Smallest the newest backup may be; zero is not checked
+}
+
+// Stale reports whether the database has no backup, or none recent enough, while a max age is set
+func (s BackupStatus) Stale() bool {
+	return s.MaxAge > 0 && (s.Last == nil || s.Age > s.MaxAge)
+}
+
+// TooSmall reports whether the newest backup is smaller than the min size, e.g. as the dump
+// came out empty or the database lost data
+func (s BackupStatus) TooSmall() bool {
+	return s.MinSize > 0 && s.Last != nil && s.Size >= 0 && s.Size < s.MinSize
+}
+
+// Problem describes how the database misses its expectations, or is empty when it meets them
+func (s BackupStatus) Problem() string {
+	switch {
+	case s.Stale() && s.Last == nil:
+		return fmt.Sprintf("no backup, expected one every %s", FormatAge(s.MaxAge))
+	case s.Stale():
+		return fmt.Sprintf("last backup %s ago, expected one every %s", FormatAge(s.Age), FormatAge(s.MaxAge))
+	case s.TooSmall():
+		return fmt.Sprintf("last backup is %s, expected at least %s", FormatBytes(s.Size), FormatBytes(s.MinSize))
+	}
+	return ""
+}
+
+// Name names the database as the catalog does, with its tenant
+func (s BackupStatus) Name() string {
+	return databaseName(s.Database)
+}
+
+// databaseName names db as the catalog does, with its tenant
+func databaseName(db DatabaseConfig) string {
+	name := fmt.Sprintf("%s %s", db.Type, db.Label)
+	if db.Tenant != "" {
+		name = db.Tenant + "/" + name
+	}
+	return name
+}
+
+// FormatAge writes a duration to the minute, e.g. 26h5m
+func FormatAge(d time.Duration) string {
+	if d < time.Minute {
+		return "<1m"
+	}
+	s := strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,298 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackupStore keeps copies of finished backups outside the backup directory, e.g. in an
+// object store. Stores are registered with RegisterStore and named in the configuration.
+type BackupStore interface {
+	// Name is how the configuration refers to the store
+	Name() string
+
+	// Put copies the backup at path, a file or a directory, into the store under key, the
+	// backup's path relative to the backup directory. Stores that can should only show the
+	// copy under key once it is complete.
+	Put(path, key string) error
+}
+
+// StreamingStore is a BackupStore that can also take a backup while it is being written, so
+// a backup streamed to it needs no room on the local disk, see DatabaseConfig.StreamTo
+type StreamingStore interface {
+	BackupStore
+
+	// Stream copies what r yields into the store under key. The copy only shows under key
+	// once r returns io.EOF; r returning an error leaves nothing there.
+	Stream(key string, r io.Reader) error
+}
+
+// FetchingStore is a BackupStore that can also fetch its copies back, which pull needs
+type FetchingStore interface {
+	BackupStore
+
+	// Get downloads what Put stored under key to path, which does not exist yet: a file, or a
+	// directory holding everything stored below key. It returns an error wrapping
+	// ErrNotInStore when nothing is stored under key.
+	Get(key, path string) error
+
+	// List returns the keys of everything stored below prefix, "" listing the whole store
+	List(prefix string) ([]string, error)
+}
+
+// ErrNotInStore is returned by FetchingStore.Get for a key nothing is stored under
+var ErrNotInStore = errors.New("not in store")
+
+// RetrievingStore is a FetchingStore whose copies may be archived in cold storage, which Get
+// cannot fetch until they are retrieved
+type RetrievingStore interface {
+	FetchingStore
+
+	// Retrieve asks for the copy under key, or everything stored below key, to be brought
+	// back from cold storage, unless that is under way, and reports whether Get can fetch it
+	Retrieve(key string) (bool, error)
+}
+
+// ErrArchived is returned by FetchingStore.Get for a copy in cold storage, see RetrievingStore
+var ErrArchived = errors.New("archived in cold storage")
+
+// ManifestExt is appended to the key of a backup in a store to name its manifest: the backup's
+// catalog entry, so other hosts learn of the backup with catalog sync
+const ManifestExt = ".manifest.json"
+
+// IsManifestKey reports whether key names the manifest of a backup in a store
+func IsManifestKey(key string) bool {
+	return strings.HasSuffix(key, ManifestExt)
+}
+
+// DefaultUploadQueue is how many finished backups may wait for their copies to stores before
+// the next dumps wait as well
+const DefaultUploadQueue = 4
+
+// Uploads say how a run copies finished backups to their stores. The copies run apart from the
+// dumps, so a database need not wait for the upload of a larger one to start its dump.
+type Uploads struct {
+	Parallel int // Backups copied at once; 0 copies as many as BackupConfig.Parallel dumps
+	Queue    int // Finished backups waiting for their copies before dumps wait; 0 uses DefaultUploadQueue
+}
+
+// Part is one piece of a backup copied to stores in parts, see DatabaseConfig.PartSize
+type Part struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// MinPartSize keeps a misread part size from splitting a backup into countless objects
+const MinPartSize = 1 << 20
+
+// partPattern matches the suffix PartKey gives the key of a part
+var partPattern = regexp.MustCompile(`\.part[0-9]{4,}$`)
+
+// PartKey returns the key the part with the given index, from 0, of the backup under key has
+// in a store: mydb.sql.gz.part0001 for the first
+func PartKey(key string, index int) string {
+	return fmt.Sprintf("%s.part%04d", key, index+1)
+}
+
+// CutPartKey returns the key of the backup a part key belongs to
+func CutPartKey(key string) (string, bool) {
+	loc := partPattern.FindStringIndex(key)
+	if loc == nil {
+		return "", false
+	}
+	return key[:loc[0]], true
+}
+
+// PendingCopy is a copy of a backup to a store that failed. Later runs resume it while the
+// backup is on disk.
+type PendingCopy struct {
+	Store string `json:"store"`
+	Parts []Part `json:"parts,omitempty"` // Parts copied before the copy failed, which are not copied again
+}
+
+// UploadStateExt ends the files uploads to stores keep their progress in, see UploadStatePath
+const UploadStateExt = ".upload.json"
+
+// UploadStatePath returns where a store keeps the progress of uploading the file at path, so
+// an interrupted upload resumes: a hidden file next to it, out of backup listings
+func UploadStatePath(path, store string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+store+UploadStateExt)
+}
+
+// StreamRecordExt ends the record a streamed dump leaves in place of itself, see
+// StreamRecordPath
+const StreamRecordExt = ".stream.json"
+
+// StreamRecordPath returns where the dump streamed instead of being written to path records
+// what the store received, until the backup is recorded in the catalog
+func StreamRecordPath(path string) string {
+	return path + StreamRecordExt
+}
+
+// IsStreamRecord reports whether path records a streamed dump rather than holds one
+func IsStreamRecord(path string) bool {
+	return strings.HasSuffix(path, StreamRecordExt)
+}
+
+// PullOptions say where pull fetches a backup from and where it puts it
+type PullOptions struct {
+	Store string // Only fetch from this store; empty tries every store of the config in turn
+	Dir   string // Directory the backup is written to, under its own name
+}
+
+// FsckOptions say how far fsck goes
+type FsckOptions struct {
+	Repair bool // Fix what can be fixed: drop stale records, record untracked dumps, remove orphans and copy lost backups to their stores again
+	Deep   bool // Also fetch every copy from its stores and check it against its checksums
+}
+
+var stores = struct {
+	sync.RWMutex
+	byName map[string]BackupStore
+	order  []string
+}{byName: make(map[string]BackupStore)}
+
+// RegisterStore makes a store available under its name. Registering a name twice panics.
+func RegisterStore(store BackupStore) {
+	stores.Lock()
+	defer stores.Unlock()
+
+	if _, exists := stores.byName[store.Name()]; exists {
+		panic(fmt.Sprintf("store %s registered twice", store.Name()))
+	}
+	stores.byName[store.Name()] = store
+	stores.order = append(stores.order, store.Name())
+}
+
+// LookupStore returns the store registered under name
+func LookupStore(name string) (BackupStore, error) {
+	stores.RLock()
+	defer stores.RUnlock()
+
+	store, ok := stores.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("no store named %s", name)
+	}
+	return store, nil
+}
+
+// StoreNames returns the names of the registered stores in the order they were registered
+func StoreNames() []string {
+	stores.RLock()
+	defer stores.RUnlock()
+
+	return append([]string(nil), stores.order...)
+}
+
+// DefaultS3Concurrency is how many parts of a file S3 stores upload at once by default
+const DefaultS3Concurrency = 5
+
+// S3StoreConfig describes a built-in store that copies backups to an S3 bucket, or to an
+// S3-compatible service at Endpoint
+type S3StoreConfig struct {
+	Name        string
+	Bucket      string
+	Prefix      string // Prepended to the keys, e.g. "db/"
+	Region      string // Empty uses the AWS configuration's region
+	Endpoint    string // S3-compatible services such as MinIO; addressed with path-style URLs
+	Concurrency int    // Parts of a file uploaded at once; 0 uses DefaultS3Concurrency
+	ObjectLock  *ObjectLock
+
+	// Storage class of the backups and their parts, e.g. GLACIER or DEEP_ARCHIVE for cold
+	// storage; their checksums, signatures and manifests stay in STANDARD. Empty uses STANDARD.
+	StorageClass string
+	Retrieval    Retrieval // How copies archived in cold storage are brought back
+}
+
+// S3 storage classes a store may put backups in. Copies in S3StorageGlacier and
+// S3StorageDeepArchive must be retrieved before they can be fetched.
+const (
+	S3StorageStandard           = "STANDARD"
+	S3StorageStandardIA         = "STANDARD_IA"
+	S3StorageOneZoneIA          = "ONEZONE_IA"
+	S3StorageIntelligentTiering = "INTELLIGENT_TIERING"
+	S3StorageGlacierIR          = "GLACIER_IR"
+	S3StorageGlacier            = "GLACIER"
+	S3StorageDeepArchive        = "DEEP_ARCHIVE"
+)
+
+// Retrieval tiers of S3 Glacier, fastest and dearest first
+const (
+	RetrievalExpedited = "expedited" // Minutes; not for DEEP_ARCHIVE
+	RetrievalStandard  = "standard"  // Hours
+	RetrievalBulk      = "bulk"      // Up to a day or two
+)
+
+// DefaultRetrievalDays is how long a retrieved copy stays fetchable by default
+const DefaultRetrievalDays = 1
+
+// Retrieval says how copies archived in cold storage are brought back for restore
+type Retrieval struct {
+	Tier string // RetrievalExpedited, RetrievalStandard or RetrievalBulk; empty uses RetrievalStandard
+	Days int    // How long the retrieved copy stays fetchable; 0 uses DefaultRetrievalDays
+}
+
+// Object Lock modes, as S3 names them in lower case
+const (
+	ObjectLockCompliance = "compliance" // Nobody, not even the root user, can delete or shorten the lock
+	ObjectLockGovernance = "governance" // Users with s3:BypassGovernanceRetention can
+)
+
+// ObjectLock makes a bucket with Object Lock enabled keep every copy unchanged and
+// undeletable until Retain after it was uploaded
+type ObjectLock struct {
+	Mode   string // ObjectLockCompliance or ObjectLockGovernance
+	Retain time.Duration
+}
+
+// Validate checks that the store names a bucket and, if set, a usable lock
+func (c S3StoreConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if c.Bucket == "" {
+		return fmt.Errorf("bucket is required")
+	}
+	if c.Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative")
+	}
+	switch c.StorageClass {
+	case "", S3StorageStandard, S3StorageStandardIA, S3StorageOneZoneIA, S3StorageIntelligentTiering,
+		S3StorageGlacierIR, S3StorageGlacier, S3StorageDeepArchive:
+	default:
+		return fmt.Errorf("storage_class must be one of %s", strings.Join([]string{S3StorageStandard, S3StorageStandardIA,
+			S3StorageOneZoneIA, S3StorageIntelligentTiering, S3StorageGlacierIR, S3StorageGlacier, S3StorageDeepArchive}, ", "))
+	}
+	switch c.Retrieval.Tier {
+	case "", RetrievalStandard, RetrievalBulk:
+	case RetrievalExpedited:
+		if c.StorageClass == S3StorageDeepArchive {
+			return fmt.Errorf("retrieval.tier %s is not offered for %s", RetrievalExpedited, S3StorageDeepArchive)
+		}
+	default:
+		return fmt.Errorf("retrieval.tier must be %s, %s or %s", RetrievalExpedited, RetrievalStandard, RetrievalBulk)
+	}
+	if c.Retrieval.Days < 0 {
+		return fmt.Errorf("retrieval.days must not be negative")
+	}
+	if c.ObjectLock != nil {
+		if c.ObjectLock.Mode != ObjectLockCompliance && c.ObjectLock.Mode != ObjectLockGovernance {
+			return fmt.Errorf("object_lock.mode must be %s or %s", ObjectLockCompliance, ObjectLockGovernance)
+		}
+		if c.ObjectLock.Retain <= 0 {
+			return fmt.Errorf("object_lock.retain must be positive, e.g. 30d")
+		}
+	}
+	return nil
+}
+
+// RetainUntil is the date a copy uploaded at uploaded stays locked until
+func (l ObjectLock) RetainUntil(uploaded time.Time) time.Time {
+	return uploaded.Add(l.Retain).UTC()
+}
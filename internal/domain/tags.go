@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tags group databases, e.g. env=prod or team=payments
+type Tags map[string]string
+
+// ParseTags parses "key=value" pairs separated by commas, as given to -only
+func ParseTags(s string) (Tags, error) {
+	tags := make(Tags)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", pair)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// Matches reports whether every tag in filter is set to the same value in t
+func (t Tags) Matches(filter Tags) bool {
+	for key, value := range filter {
+		if t[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the tags sorted by key, e.g. "env=prod,team=payments"
+func (t Tags) String() string {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + t[key]
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Validate rejects keys and values that could not be written back as key=value pairs
+func (t Tags) Validate() error {
+	for key, value := range t {
+		if key == "" || strings.ContainsAny(key, "=,") {
+			return fmt.Errorf("invalid tag key %q", key)
+		}
+		if value == "" || strings.ContainsAny(value, ",") {
+			return fmt.Errorf("invalid value %q for tag %q", value, key)
+		}
+	}
+	return nil
+}
+
+// Only keeps the databases whose tags match filter
+func (c *BackupConfig) Only(filter Tags) {
+	var databases []DatabaseConfig
+	for _, db := range c.Databases {
+		if db.Tags.Matches(filter) {
+			databases = append(databases, db)
+		}
+	}
+	c.Databases = databases
+}
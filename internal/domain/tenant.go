@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Tenant is one customer of a deployment that backs up the databases of several. Its
+// databases write to a backup directory of its own, so its artifacts and catalog are never
+// mixed with another's, and use its stores and KMS key instead of the run's.
+type Tenant struct {
+	Name       string
+	BackupDir  string
+	Stores     []string    // Nil uses BackupConfig.Stores, where copies are kept under the tenant's name
+	Encryption *Encryption // Nil uses BackupConfig.Encryption
+	Keep       int         // Newest backups per database that prune keeps; 0 leaves it to -keep
+}
+
+var tenantName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Validate checks the name, which prefixes the tenant's copies in shared stores
+func (t Tenant) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !tenantName.MatchString(t.Name) {
+		return fmt.Errorf("invalid name %q: use letters, digits, '.', '_' and '-'", t.Name)
+	}
+	if t.BackupDir == "" {
+		return fmt.Errorf("backup_dir is required, as every tenant's backups are kept apart")
+	}
+	if t.Keep < 0 {
+		return fmt.Errorf("keep must not be negative")
+	}
+	return nil
+}
+
+// Tenant returns the tenant called name
+func (c BackupConfig) Tenant(name string) (Tenant, bool) {
+	for _, tenant := range c.Tenants {
+		if tenant.Name == name {
+			return tenant, true
+		}
+	}
+	return Tenant{}, false
+}
+
+// TenantOf returns the name of the tenant whose backup directory holds path, or "" for a
+// path outside every tenant's
+func (c BackupConfig) TenantOf(path string) string {
+	for _, tenant := range c.Tenants {
+		rel, err := filepath.Rel(filepath.Clean(tenant.BackupDir), filepath.Clean(path))
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return tenant.Name
+		}
+	}
+	return ""
+}
+
+// EncryptionOf returns the KMS key backups written to backupDir are encrypted with: the
+// tenant's, if the directory is a tenant's with a key of its own, or else the run's
+func (c BackupConfig) EncryptionOf(backupDir string) *Encryption {
+	for _, tenant := range c.Tenants {
+		if filepath.Clean(tenant.BackupDir) == filepath.Clean(backupDir) && tenant.Encryption != nil {
+			return tenant.Encryption
+		}
+	}
+	return c.Encryption
+}
+
+// ForTenant keeps the databases of the tenant called name and makes its backup directory,
+// stores and KMS key those of the run, so nothing done with the config reaches another
+// tenant's backups
+func (c *BackupConfig) ForTenant(name string) error {
+	tenant, ok := c.Tenant(name)
+	if !ok {
+		return fmt.Errorf("no tenant named %q", name)
+	}
+
+	var databases []DatabaseConfig
+	for _, db := range c.Databases {
+		if db.Tenant == name {
+			databases = append(databases, db)
+		}
+	}
+	c.Databases = databases
+	c.Tenants = []Tenant{tenant}
+	c.BackupDir = tenant.BackupDir
+	if tenant.Stores != nil {
+		c.Stores = tenant.Stores
+	}
+	if tenant.Encryption != nil {
+		c.Encryption = tenant.Encryption
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package domain
+
+// Attributes describe what a span covers, e.g. the database and method of a dump.
+// Values are strings, bools or numbers.
+type Attributes map[string]interface{}
+
+// Tracer starts the spans that time a run and its phases
+type Tracer interface {
+	// Start begins a span; spans started from it are its children
+	Start(name string, attributes Attributes) Span
+}
+
+// Span is one timed step of a run
+type Span interface {
+	Tracer
+
+	// SetAttributes adds attributes known only once the step has run, such as a size
+	SetAttributes(attributes Attributes)
+
+	// End finishes the span, marking it failed if err is not nil
+	End(err error)
+}
+
+// NoopTracer is used when tracing is not configured
+var NoopTracer Tracer = noopSpan{}
+
+type noopSpan struct{}
+
+func (noopSpan) Start(string, Attributes) Span { return noopSpan{} }
+func (noopSpan) SetAttributes(Attributes)      {}
+func (noopSpan) End(error)                     {}
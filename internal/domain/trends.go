@@ -0,0 +1,144 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// TrendWindow is how many of the previous backups of a database a new one is compared with
+const TrendWindow = 7
+
+// minTrendHistory is how many previous backups it takes before a new one is compared with them
+const minTrendHistory = 3
+
+// DefaultSizeDrop flags backups less than half the size of those before them
+const DefaultSizeDrop = 0.5
+
+// DefaultSlowdown flags backups taking three times as long as those before them usually did
+const DefaultSlowdown = 3
+
+// minSlowBackup is the shortest backup flagged as slow, as a few seconds more are noise
+const minSlowBackup = time.Minute
+
+// Anomalies set how far a new backup may stray from the previous ones of its database before
+// it is flagged with a warning. The backup is kept either way.
+type Anomalies struct {
+	// Flag backups this fraction smaller than the average of the previous ones, e.g. 0.5 for
+	// half their size, as a truncated dump or dropped tables would be. Zero uses
+	// DefaultSizeDrop and a negative value turns the check off.
+	SizeDrop float64
+
+	// Flag backups taking this many times the median duration of the previous ones, e.g. 3,
+	// as lock contention or a saturated network would cause. Zero uses DefaultSlowdown and a
+	// negative value turns the check off.
+	Slowdown float64
+}
+
+// SizeWarning compares the size of a new backup with previous, the backups of the database
+// before it, newest first, and describes how it is smaller than their average if it falls
+// below SizeDrop. It is empty for backups in line with the previous ones, and while fewer than
+// minTrendHistory of them are known.
+func (a Anomalies) SizeWarning(size int64, previous []CatalogEntry) string {
+	drop := a.SizeDrop
+	if drop == 0 {
+		drop = DefaultSizeDrop
+	}
+	if drop < 0 {
+		return ""
+	}
+
+	recent := recentBackups(previous, func(entry CatalogEntry) bool { return entry.SizeBytes > 0 })
+	if len(recent) < minTrendHistory {
+		return ""
+	}
+	var total int64
+	for _, entry := range recent {
+		total += entry.SizeBytes
+	}
+	average := total / int64(len(recent))
+	if float64(size) >= float64(average)*(1-drop) {
+		return ""
+	}
+	return fmt.Sprintf("%s is %.0f%% smaller than the average of the last %d backups (%s); check for a truncated dump or dropped tables",
+		FormatBytes(size), 100*(1-float64(size)/float64(average)), len(recent), FormatBytes(average))
+}
+
+// DurationWarning compares how long a new backup took with previous, as SizeWarning does, and
+// describes how much longer than their median it took if that is Slowdown times or more.
+// Backups under a minute are never flagged.
+func (a Anomalies) DurationWarning(duration time.Duration, previous []CatalogEntry) string {
+	slowdown := a.Slowdown
+	if slowdown == 0 {
+		slowdown = DefaultSlowdown
+	}
+	if slowdown < 0 || duration < minSlowBackup {
+		return ""
+	}
+
+	recent := recentBackups(previous, func(entry CatalogEntry) bool { return entry.Duration > 0 })
+	if len(recent) < minTrendHistory {
+		return ""
+	}
+	durations := make([]time.Duration, len(recent))
+	for i, entry := range recent {
+		durations[i] = entry.Duration
+	}
+	median := Median(durations)
+	if float64(duration) < float64(median)*slowdown {
+		return ""
+	}
+	return fmt.Sprintf("took %s, %.1f× the median of the last %d backups (%s); check for locks, load or a slower network",
+		duration.Round(time.Second), float64(duration)/float64(median), len(recent), median.Round(time.Second))
+}
+
+// recentBackups returns the first TrendWindow backups of previous that keep accepts
+func recentBackups(previous []CatalogEntry, keep func(CatalogEntry) bool) []CatalogEntry {
+	var recent []CatalogEntry
+	for _, entry := range previous {
+		if len(recent) == TrendWindow {
+			break
+		}
+		if keep(entry) {
+			recent = append(recent, entry)
+		}
+	}
+	return recent
+}
+
+// Median returns the middle one of durations, the mean of the middle two for an even number,
+// and zero for none
+func Median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// BackupTrend is how the backups of a database developed over its most recent ones, for stats
+type BackupTrend struct {
+	Database DatabaseConfig
+	Backups  []CatalogEntry // Oldest first
+}
+
+// Name names the database as the catalog does, with its tenant
+func (t BackupTrend) Name() string {
+	return databaseName(t.Database)
+}
+
+// MedianDuration returns the median duration of the backups that recorded one
+func (t BackupTrend) MedianDuration() time.Duration {
+	var durations []time.Duration
+	for _, entry := range t.Backups {
+		if entry.Duration > 0 {
+			durations = append(durations, entry.Duration)
+		}
+	}
+	return Median(durations)
+}
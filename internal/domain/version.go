@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ArtifactFormat is the version of the layout of backups, their catalog entries and manifests that
+// this build writes and reads. When a change means older builds could no longer restore what a
+// newer one writes, bump it, so they refuse such backups instead of misreading them.
+const ArtifactFormat = 1
+
+// BuildInfo describes a backup-tool binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"` // When the binary was built or, failing that, committed
+	GoVersion string `json:"go_version,omitempty"`
+	Format    int    `json:"artifact_format"` // ArtifactFormat of the build
+}
+
+// Build describes the running binary; main fills it in from what was stamped in at build time
+var Build = BuildInfo{Version: "dev", Format: ArtifactFormat}
+
+// String returns e.g. "1.4.0 (commit 3f2a9c1, built 2024-05-01T10:00:00Z)"
+func (b BuildInfo) String() string {
+	var details []string
+	if b.Commit != "" {
+		details = append(details, "commit "+b.Commit)
+	}
+	if b.Date != "" {
+		details = append(details, "built "+b.Date)
+	}
+	if len(details) == 0 {
+		return b.Version
+	}
+	return fmt.Sprintf("%s (%s)", b.Version, strings.Join(details, ", "))
+}
+
+// Compatibility checks that this build can restore the backup of the entry. A backup in a newer
+// format than it reads is an error; one written by a newer release only earns a warning, as the
+// format is the same but features it used may be missing here. Entries written before they were
+// stamped pass.
+func (e CatalogEntry) Compatibility() (warning string, err error) {
+	writtenBy := e.ToolVersion
+	if writtenBy == "" {
+		writtenBy = "an unknown version"
+	}
+	if e.Format > ArtifactFormat {
+		return "", fmt.Errorf("%s was written by backup-tool %s in artifact format %d, but this build (%s) only reads up to format %d; restore it with %s or newer",
+			e.Path, writtenBy, e.Format, Build.Version, ArtifactFormat, writtenBy)
+	}
+	if newer, ok := compareVersions(e.ToolVersion, Build.Version); ok && newer > 0 {
+		return fmt.Sprintf("%s was written by backup-tool %s, newer than this build (%s); if the restore misses something, use %s or newer",
+			e.Path, e.ToolVersion, Build.Version, e.ToolVersion), nil
+	}
+	return "", nil
+}
+
+// compareVersions compares two release versions such as v1.4.0 and 1.10.2, returning -1, 0 or 1.
+// ok is false when either is not a release version, e.g. "dev" for a build from source.
+func compareVersions(a, b string) (int, bool) {
+	parse := func(v string) ([3]int, bool) {
+		var parts [3]int
+		v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "-") // Pre-releases compare as their release
+		fields := strings.Split(v, ".")
+		if len(fields) == 0 || len(fields) > 3 {
+			return parts, false
+		}
+		for i, field := range fields {
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 0 {
+				return parts, false
+			}
+			parts[i] = n
+		}
+		return parts, true
+	}
+
+	va, okA := parse(a)
+	vb, okB := parse(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for i := range va {
+		switch {
+		case va[i] > vb[i]:
+			return 1, true
+		case va[i] < vb[i]:
+			return -1, true
+		}
+	}
+	return 0, true
+}
@@ -2,8 +2,9 @@ package infrastructure
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -11,247 +12,446 @@ import (
 )
 
 // BackupRepositoryImpl implements domain.BackupRepository
-type BackupRepositoryImpl struct{}
+type BackupRepositoryImpl struct {
+	*clientPool
+}
 
 // NewBackupRepository creates a new backup repository
 func NewBackupRepository() domain.BackupRepository {
-	return &BackupRepositoryImpl{}
+	return &BackupRepositoryImpl{
+		clientPool: newClientPool(),
+	}
+}
+
+// backupPostgres performs a PostgreSQL backup, preceded by its roles and tablespaces with config.Globals
+func (r *BackupRepositoryImpl) backupPostgres(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	var globalsPath string
+	if config.Globals {
+		globalsPath = domain.GlobalsPath(backupPath)
+		err := writeToFile(globalsPath, config, func(w io.Writer) error {
+			return r.dumpPostgresGlobals(config, method, namespace, w)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to dump roles and tablespaces: %w", err)
+		}
+	}
+
+	err := writeSQLDump(config, method, backupPath, func(w io.Writer, compress bool) error {
+		return r.dumpPostgres(config, method, namespace, compress, w)
+	})
+	if err != nil && globalsPath != "" {
+		os.Remove(globalsPath)
+	}
+	return err
 }
 
-// BackupPostgres performs a PostgreSQL backup
-func (r *BackupRepositoryImpl) BackupPostgres(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
-	cwd, _ := os.Getwd()
-	
+// dumpPostgres runs pg_dump and streams the dump to w, gzipped in the container or pod with compress
+func (r *BackupRepositoryImpl) dumpPostgres(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, compress bool, w io.Writer) error {
+	w = limitWriter(w, config.Limits.BytesPerSecond)
+
 	switch method {
 	case domain.BackupMethodDockerRun:
-		cmd := exec.Command("docker", "run", "--rm",
-			"-e", fmt.Sprintf("PGPASSWORD=%s", config.Password),
-			"-v", fmt.Sprintf("%s/backup/postgres:/backup", cwd),
-			fmt.Sprintf("postgres:%s", config.Version),
-			"pg_dump", "-h", config.Host, "-U", config.User, config.Database)
-		
-		output, err := cmd.Output()
+		err := r.runContainer(runOptions(config.Limits,
+			imageFor(config),
+			append(append([]string{"pg_dump", "-h", config.Host, "-U", config.User}, strings.Fields(pgDumpFlags(config.DumpMode)+managedPgDumpFlags(config))...), config.Database),
+			append([]string{fmt.Sprintf("PGPASSWORD=%s", config.Password)}, postgresTLSVars(config, method)...),
+			certBinds(config)),
+			nil, w)
 		if err != nil {
 			return fmt.Errorf("docker run failed: %w", err)
 		}
-		return os.WriteFile(backupPath, output, 0644)
-		
+		return nil
+
 	case domain.BackupMethodDockerExec:
-		cmd := exec.Command("docker", "exec", config.Container,
-			"sh", "-c",
-			fmt.Sprintf("PGPASSWORD='%s' pg_dump -h localhost -U %s %s",
-				config.Password, config.User, config.Database))
-		
-		output, err := cmd.Output()
-		if err != nil {
+		command := []string{"sh", "-c",
+			fmt.Sprintf("%sPGPASSWORD=%s pg_dump -h localhost -U %s%s %s",
+				postgresTLSEnv(config, method), shellQuote(config.Password), shellQuote(config.User), pgDumpFlags(config.DumpMode)+managedPgDumpFlags(config), shellQuote(config.Database)),
+		}
+
+		if err := r.streamContainer(config.Container, niceCommand(config.Limits, compressCommand(compress, config.Compression, command)), w); err != nil {
 			return fmt.Errorf("docker exec failed: %w", err)
 		}
-		return os.WriteFile(backupPath, output, 0644)
-		
+		return nil
+
 	case domain.BackupMethodKubectlExec:
-		cmd := exec.Command("kubectl", "exec", "-n", namespace, config.Pod, "--",
-			"sh", "-c",
-			fmt.Sprintf("PGPASSWORD='%s' pg_dump -h localhost -U %s %s",
-				config.Password, config.User, config.Database))
-		
-		output, err := cmd.Output()
-		if err != nil {
-			return fmt.Errorf("kubectl exec failed: %w", err)
+		command := []string{"sh", "-c",
+			fmt.Sprintf("%sPGPASSWORD=%s pg_dump -h localhost -U %s%s %s",
+				postgresTLSEnv(config, method), shellQuote(config.Password), shellQuote(config.User), pgDumpFlags(config.DumpMode)+managedPgDumpFlags(config), shellQuote(config.Database)),
+		}
+
+		if err := r.streamPod(config, namespace, niceCommand(config.Limits, compressCommand(compress, config.Compression, command)), w); err != nil {
+			return fmt.Errorf("pod exec failed: %w", err)
 		}
-		return os.WriteFile(backupPath, output, 0644)
+		return nil
+
+	case domain.BackupMethodSSH:
+		command := []string{"sh", "-c",
+			fmt.Sprintf("%sPGPASSWORD=%s pg_dump -h localhost -U %s%s %s",
+				postgresTLSEnv(config, method), shellQuote(config.Password), shellQuote(config.User), pgDumpFlags(config.DumpMode)+managedPgDumpFlags(config), shellQuote(config.Database)),
+		}
+
+		if err := r.streamSSH(config, niceCommand(config.Limits, compressCommand(compress, config.Compression, command)), w); err != nil {
+			return fmt.Errorf("ssh exec failed: %w", err)
+		}
+		return nil
 	}
-	
+
 	return fmt.Errorf("unknown backup method: %s", method)
 }
 
-// BackupMySQL performs a MySQL backup
-func (r *BackupRepositoryImpl) BackupMySQL(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
-	cwd, _ := os.Getwd()
-	
+// backupMySQL performs a MySQL backup
+func (r *BackupRepositoryImpl) backupMySQL(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	return writeSQLDump(config, method, backupPath, func(w io.Writer, compress bool) error {
+		return r.dumpMySQLCompatible(config, method, namespace, "mysql", compress, w)
+	})
+}
+
+// backupMariaDB performs a MariaDB backup, logical or, with config.Physical, a mariabackup stream
+func (r *BackupRepositoryImpl) backupMariaDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	if config.Physical {
+		return writeToFile(backupPath, config, func(w io.Writer) error {
+			return r.streamMariaBackup(config, method, namespace, w)
+		})
+	}
+
+	return writeSQLDump(config, method, backupPath, func(w io.Writer, compress bool) error {
+		return r.dumpMySQLCompatible(config, method, namespace, "mariadb", compress, w)
+	})
+}
+
+// dumpMySQLCompatible runs mysqldump for MySQL and MariaDB, which only differ in image, and streams the dump to w,
+// gzipped in the container or pod with compress
+func (r *BackupRepositoryImpl) dumpMySQLCompatible(config domain.DatabaseConfig, method domain.BackupMethod, namespace, image string, compress bool, w io.Writer) error {
+	w = limitWriter(w, config.Limits.BytesPerSecond)
+
 	switch method {
 	case domain.BackupMethodDockerRun:
-		cmd := exec.Command("docker", "run", "--rm",
-			"-v", fmt.Sprintf("%s/backup/mysql:/backup", cwd),
-			fmt.Sprintf("mysql:%s", config.Version),
-			"sh", "-c",
-			fmt.Sprintf("mysqldump -h%s -u%s -p%s %s",
-				config.Host, config.User, config.Password, config.Database))
-		
-		output, err := cmd.Output()
+		err := r.runContainer(runOptions(config.Limits,
+			fmt.Sprintf("%s:%s", image, config.Version),
+			[]string{"sh", "-c",
+				fmt.Sprintf("mysqldump -h %s -u%s -p%s%s%s %s",
+					shellQuote(config.Host), shellQuote(config.User), shellQuote(config.Password), mysqlTLSFlags(config, method), mysqldumpFlags(config.MySQLDump, config.DumpMode)+managedMySQLDumpFlags(config), shellQuote(config.Database)),
+			},
+			nil,
+			certBinds(config)),
+			nil, w)
 		if err != nil {
 			return fmt.Errorf("docker run failed: %w", err)
 		}
-		return os.WriteFile(backupPath, output, 0644)
-		
+		return nil
+
 	case domain.BackupMethodDockerExec:
-		cmd := exec.Command("docker", "exec", config.Container,
-			"sh", "-c",
-			fmt.Sprintf("mysqldump -h localhost -u%s -p%s %s",
-				config.User, config.Password, config.Database))
-		
-		output, err := cmd.Output()
-		if err != nil {
+		command := []string{"sh", "-c",
+			fmt.Sprintf("mysqldump -h localhost -u%s -p%s%s%s %s",
+				shellQuote(config.User), shellQuote(config.Password), mysqlTLSFlags(config, method), mysqldumpFlags(config.MySQLDump, config.DumpMode)+managedMySQLDumpFlags(config), shellQuote(config.Database)),
+		}
+
+		if err := r.streamContainer(config.Container, niceCommand(config.Limits, compressCommand(compress, config.Compression, command)), w); err != nil {
 			return fmt.Errorf("docker exec failed: %w", err)
 		}
-		return os.WriteFile(backupPath, output, 0644)
-		
+		return nil
+
 	case domain.BackupMethodKubectlExec:
-		cmd := exec.Command("kubectl", "exec", "-n", namespace, config.Pod, "--",
-			"sh", "-c",
-			fmt.Sprintf("mysqldump -h localhost -u%s -p%s %s",
-				config.User, config.Password, config.Database))
-		
-		output, err := cmd.Output()
-		if err != nil {
-			return fmt.Errorf("kubectl exec failed: %w", err)
+		command := []string{"sh", "-c",
+			fmt.Sprintf("mysqldump -h localhost -u%s -p%s%s%s %s",
+				shellQuote(config.User), shellQuote(config.Password), mysqlTLSFlags(config, method), mysqldumpFlags(config.MySQLDump, config.DumpMode)+managedMySQLDumpFlags(config), shellQuote(config.Database)),
 		}
-		return os.WriteFile(backupPath, output, 0644)
+
+		if err := r.streamPod(config, namespace, niceCommand(config.Limits, compressCommand(compress, config.Compression, command)), w); err != nil {
+			return fmt.Errorf("pod exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodSSH:
+		command := []string{"sh", "-c",
+			fmt.Sprintf("mysqldump -h localhost -u%s -p%s%s%s %s",
+				shellQuote(config.User), shellQuote(config.Password), mysqlTLSFlags(config, method), mysqldumpFlags(config.MySQLDump, config.DumpMode)+managedMySQLDumpFlags(config), shellQuote(config.Database)),
+		}
+
+		if err := r.streamSSH(config, niceCommand(config.Limits, compressCommand(compress, config.Compression, command)), w); err != nil {
+			return fmt.Errorf("ssh exec failed: %w", err)
+		}
+		return nil
 	}
-	
+
 	return fmt.Errorf("unknown backup method: %s", method)
 }
 
-// BackupMariaDB performs a MariaDB backup
-func (r *BackupRepositoryImpl) BackupMariaDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
-	cwd, _ := os.Getwd()
-	
+// pgDumpFlags selects the part of the database pg_dump writes, preceded by a space
+func pgDumpFlags(mode domain.DumpMode) string {
+	switch mode {
+	case domain.DumpModeSchemaOnly:
+		return " --schema-only"
+	case domain.DumpModeDataOnly:
+		return " --data-only"
+	}
+	return ""
+}
+
+// mysqldumpFlags turns dump options and mode into mysqldump flags, each preceded by a space
+func mysqldumpFlags(options domain.MySQLDumpOptions, mode domain.DumpMode) string {
+	var flags strings.Builder
+	switch mode {
+	case domain.DumpModeSchemaOnly:
+		flags.WriteString(" --no-data")
+	case domain.DumpModeDataOnly:
+		flags.WriteString(" --no-create-info")
+	}
+	if options.SingleTransaction {
+		flags.WriteString(" --single-transaction")
+	}
+	if options.Routines {
+		flags.WriteString(" --routines")
+	}
+	if options.Events {
+		flags.WriteString(" --events")
+	}
+	if options.SkipTriggers {
+		flags.WriteString(" --skip-triggers")
+	}
+	if options.SetGTIDPurged != "" {
+		flags.WriteString(" --set-gtid-purged=" + options.SetGTIDPurged)
+	}
+	return flags.String()
+}
+
+// backupMongoDB performs a MongoDB backup, as a directory tree or, with config.Archive, a single archive file
+func (r *BackupRepositoryImpl) backupMongoDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	if config.Archive {
+		// mongodump gzips the archive itself, so only zstd is left to the host
+		ext := compressedExt(backupPath)
+		return writeFile(backupPath, ext == zstdExt, config, func(w io.Writer) error {
+			return r.dumpMongoArchive(config, method, namespace, ext == gzipExt, w)
+		})
+	}
+
+	ctx := r.ctx
+	timestamp := filepath.Base(backupPath)
+
 	switch method {
 	case domain.BackupMethodDockerRun:
-		cmd := exec.Command("docker", "run", "--rm",
-			"-v", fmt.Sprintf("%s/backup/mariadb:/backup", cwd),
-			fmt.Sprintf("mariadb:%s", config.Version),
-			"sh", "-c",
-			fmt.Sprintf("mysqldump -h%s -u%s -p%s %s",
-				config.Host, config.User, config.Password, config.Database))
-		
-		output, err := cmd.Output()
+		docker, err := r.docker()
 		if err != nil {
-			return fmt.Errorf("docker run failed: %w", err)
+			return err
 		}
-		return os.WriteFile(backupPath, output, 0644)
-		
-	case domain.BackupMethodDockerExec:
-		cmd := exec.Command("docker", "exec", config.Container,
-			"sh", "-c",
-			fmt.Sprintf("mysqldump -h localhost -u%s -p%s %s",
-				config.User, config.Password, config.Database))
-		
-		output, err := cmd.Output()
+
+		hostDir, err := filepath.Abs(filepath.Dir(backupPath))
 		if err != nil {
-			return fmt.Errorf("docker exec failed: %w", err)
+			return err
 		}
-		return os.WriteFile(backupPath, output, 0644)
-		
-	case domain.BackupMethodKubectlExec:
-		cmd := exec.Command("kubectl", "exec", "-n", namespace, config.Pod, "--",
-			"sh", "-c",
-			fmt.Sprintf("mysqldump -h localhost -u%s -p%s %s",
-				config.User, config.Password, config.Database))
-		
-		output, err := cmd.Output()
+
+		var stderr stderrBuffer
+		err = docker.Run(ctx, runOptions(config.Limits,
+			fmt.Sprintf("mongo:%s", config.Version),
+			mongoDumpArgs(config, method, "--out", fmt.Sprintf("/backup/%s", timestamp)),
+			nil,
+			append([]string{fmt.Sprintf("%s:/backup", hostDir)}, certBinds(config)...)),
+			nil, io.Discard, &stderr)
 		if err != nil {
-			return fmt.Errorf("kubectl exec failed: %w", err)
+			return fmt.Errorf("docker run failed: %w", stderr.wrap(err))
 		}
-		return os.WriteFile(backupPath, output, 0644)
+		return nil
+
+	case domain.BackupMethodDockerExec, domain.BackupMethodKubectlExec, domain.BackupMethodSSH:
+		// Streamed out as an archive and unpacked here, so the dump takes no room in the container or pod
+		return unpackMongoDump(backupPath, func(w io.Writer) error {
+			return r.dumpMongoArchive(config, method, namespace, true, w)
+		})
 	}
-	
+
 	return fmt.Errorf("unknown backup method: %s", method)
 }
 
-// BackupMongoDB performs a MongoDB backup
-func (r *BackupRepositoryImpl) BackupMongoDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
-	cwd, _ := os.Getwd()
-	
+// dumpMongoArchive runs mongodump --archive and streams the archive to w
+func (r *BackupRepositoryImpl) dumpMongoArchive(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, compress bool, w io.Writer) error {
+	w = limitWriter(w, config.Limits.BytesPerSecond)
+
 	switch method {
 	case domain.BackupMethodDockerRun:
-		cmd := exec.Command("docker", "run", "--rm",
-			"-v", fmt.Sprintf("%s/backup/mongodb:/backup", cwd),
-			fmt.Sprintf("mongo:%s", config.Version),
-			"mongodump", "--host", config.Host, "--db", config.Database,
-			"--out", fmt.Sprintf("/backup/%s", filepath.Base(backupPath)))
-		
-		return cmd.Run()
-		
-	case domain.BackupMethodDockerExec:
-		timestamp := filepath.Base(backupPath)
-		
-		// Create backup inside container
-		cmd := exec.Command("docker", "exec", config.Container,
-			"mongodump", "--host", "localhost", "--db", config.Database,
-			"--out", fmt.Sprintf("%s/%s", tempDir, timestamp))
-		
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to create backup in container: %w", err)
+		command := mongoDumpArgs(config, method, mongoArchiveArgs(compress)...)
+		err := r.runContainer(runOptions(config.Limits, fmt.Sprintf("mongo:%s", config.Version), command, nil, certBinds(config)), nil, w)
+		if err != nil {
+			return fmt.Errorf("docker run failed: %w", err)
 		}
-		
-		// Copy backup from container to host
-		os.MkdirAll(backupPath, 0755)
-		cmd = exec.Command("docker", "cp",
-			fmt.Sprintf("%s:%s/%s/%s", config.Container, tempDir, timestamp, config.Database),
-			backupPath+"/")
-		
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to copy backup from container: %w", err)
+		return nil
+
+	case domain.BackupMethodDockerExec:
+		command := mongoDumpArgs(config, method, mongoArchiveArgs(compress)...)
+		if err := r.streamContainer(config.Container, niceCommand(config.Limits, command), w); err != nil {
+			return fmt.Errorf("docker exec failed: %w", err)
 		}
-		
-		// Cleanup inside container
-		cmd = exec.Command("docker", "exec", config.Container,
-			"rm", "-rf", fmt.Sprintf("%s/%s", tempDir, timestamp))
-		cmd.Run()
-		
 		return nil
-		
+
 	case domain.BackupMethodKubectlExec:
-		timestamp := filepath.Base(backupPath)
-		
-		// Create backup inside pod
-		cmd := exec.Command("kubectl", "exec", "-n", namespace, config.Pod, "--",
-			"mongodump", "--host", "localhost", "--db", config.Database,
-			"--out", fmt.Sprintf("%s/%s", tempDir, timestamp))
-		
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to create backup in pod: %w", err)
+		command := mongoDumpArgs(config, method, mongoArchiveArgs(compress)...)
+		if err := r.streamPod(config, namespace, niceCommand(config.Limits, command), w); err != nil {
+			return fmt.Errorf("pod exec failed: %w", err)
 		}
-		
-		// Copy backup from pod to host
-		os.MkdirAll(backupPath, 0755)
-		cmd = exec.Command("kubectl", "cp",
-			fmt.Sprintf("%s/%s:%s/%s/%s", namespace, config.Pod, tempDir, timestamp, config.Database),
-			backupPath+"/")
-		
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to copy backup from pod: %w", err)
+		return nil
+
+	case domain.BackupMethodSSH:
+		command := mongoDumpArgs(config, method, mongoArchiveArgs(compress)...)
+		if err := r.streamSSH(config, niceCommand(config.Limits, command), w); err != nil {
+			return fmt.Errorf("ssh exec failed: %w", err)
 		}
-		
-		// Cleanup inside pod
-		cmd = exec.Command("kubectl", "exec", "-n", namespace, config.Pod, "--",
-			"rm", "-rf", fmt.Sprintf("%s/%s", tempDir, timestamp))
-		cmd.Run()
-		
 		return nil
 	}
-	
+
 	return fmt.Errorf("unknown backup method: %s", method)
 }
 
-// GetFileSize returns the size of a file or directory
-func (r *BackupRepositoryImpl) GetFileSize(path string, isDirectory bool) (string, error) {
-	var cmd *exec.Cmd
-	if isDirectory {
-		cmd = exec.Command("du", "-sh", path)
-	} else {
-		cmd = exec.Command("du", "-h", path)
+// writeSQLDump writes a SQL dump to backupPath through maskDump, or streams it to a store with
+// config.StreamTo. A dump that compressInContainer gzips arrives compressed and is written as is.
+func writeSQLDump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath string, dump func(w io.Writer, compress bool) error) error {
+	compress := compressInContainer(config, method, backupPath)
+	write := func(w io.Writer) error {
+		return maskDump(config, w, func(w io.Writer) error {
+			return dump(w, compress)
+		})
+	}
+	if config.StreamTo != "" {
+		return streamDump(backupPath, isCompressedPath(backupPath) && !compress, config, write)
 	}
-	
-	output, err := cmd.Output()
+	return writeFile(backupPath, isCompressedPath(backupPath) && !compress, config, write)
+}
+
+// writeToFile creates backupPath, compressed if it ends in .gz or .zst, passes it to write and removes it again if write fails
+func writeToFile(backupPath string, config domain.DatabaseConfig, write func(w io.Writer) error) error {
+	return writeFile(backupPath, isCompressedPath(backupPath), config, write)
+}
+
+// writeFile creates backupPath, compressed as its name says with config.Compression if compress
+// is set, passes it to write and removes it again if write fails. Writing fails once free space
+// drops below config.Limits.MinFreeBytes.
+func writeFile(backupPath string, compress bool, config domain.DatabaseConfig, write func(w io.Writer) error) error {
+	f, err := os.Create(backupPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to get file size: %w", err)
+		return fmt.Errorf("failed to create backup file: %w", err)
 	}
-	
-	fields := strings.Fields(string(output))
-	if len(fields) > 0 {
-		return fields[0], nil
+
+	guard := &diskGuard{w: f, dir: filepath.Dir(backupPath), min: config.Limits.MinFreeBytes}
+	var w io.Writer = guard
+	var compressor io.WriteCloser
+	if compress {
+		compressor = newCompressor(guard, compressedExt(backupPath), config.Compression)
+		w = compressor
+	}
+
+	err = write(w)
+	if compressor != nil {
+		if closeErr := compressor.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	// Client tools report a failed write in their own words, so the cause is kept
+	if guard.err != nil {
+		err = guard.err
+	}
+	if err != nil {
+		os.Remove(backupPath)
+		return diskFull(err)
+	}
+	return nil
+}
+
+// diskCheckInterval is how many bytes are written between checks of the free space left
+const diskCheckInterval = 32 << 20
+
+// diskGuard fails writes once the free space on the filesystem holding dir drops below min,
+// checking before the first write and every diskCheckInterval bytes after it
+type diskGuard struct {
+	w         io.Writer
+	dir       string
+	min       int64
+	unchecked int64
+	err       error
+}
+
+func (g *diskGuard) Write(p []byte) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+	if g.min > 0 && (g.unchecked == 0 || g.unchecked >= diskCheckInterval) {
+		g.unchecked = 0
+		if free, err := diskFree(g.dir); err == nil && free < g.min {
+			g.err = &domain.LowDiskSpaceError{Dir: g.dir, Free: free, Min: g.min}
+			return 0, g.err
+		}
+	}
+	n, err := g.w.Write(p)
+	g.unchecked += int64(n)
+	return n, err
+}
+
+// FinalizeBackup moves a backup into place. Renames within the backup directory are atomic, so
+// a file appears complete or not at all. MongoDB dump directories are shared by the databases
+// of a run, so a directory is merged into one that exists already.
+func (r *BackupRepositoryImpl) FinalizeBackup(partialPath, backupPath string) error {
+	info, err := os.Stat(partialPath)
+	if err != nil {
+		return fmt.Errorf("failed to finalize backup: %w", err)
+	}
+
+	if _, err := os.Stat(backupPath); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(partialPath)
+		if err != nil {
+			return fmt.Errorf("failed to finalize backup: %w", err)
+		}
+		for _, entry := range entries {
+			if err := os.Rename(filepath.Join(partialPath, entry.Name()), filepath.Join(backupPath, entry.Name())); err != nil {
+				return fmt.Errorf("failed to move backup into place: %w", err)
+			}
+		}
+	} else if err := os.Rename(partialPath, backupPath); err != nil {
+		return fmt.Errorf("failed to move backup into place: %w", err)
+	}
+
+	// The staging directory goes once the last backup has left it
+	os.Remove(partialPath)
+	os.Remove(filepath.Dir(partialPath))
+	return nil
+}
+
+// GetFileSize returns the size of a file, the total size of the files in a directory, or the
+// size of the volume a snapshot record describes or of the dump a stream record does
+func (r *BackupRepositoryImpl) GetFileSize(path string) (int64, error) {
+	if domain.IsStreamRecord(path) {
+		record, err := readStreamRecord(path)
+		return record.Size, err
+	}
+	if domain.IsSnapshotBackup(path) {
+		record, err := readSnapshotRecord(path)
+		return record.Size, err
+	}
+	if domain.IsRDSSnapshot(path) {
+		record, err := readRDSSnapshotRecord(path)
+		return record.Size, err
+	}
+	return dirSize(path)
+}
+
+// dirSize returns the size of a file, or the total size of the files under a directory
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file size: %w", err)
 	}
-	
-	return "unknown", nil
+	return size, nil
 }
@@ -0,0 +1,442 @@
+package infrastructure
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// catalogFile is the name of the catalog kept at the root of each backup directory
+const catalogFile = "catalog.json"
+
+// eventsFile is the name of the audit log next to the catalog, one JSON event per line
+const eventsFile = "events.jsonl"
+
+// timestampSuffix matches the default timestamp at the end of backup names, with the UTC
+// offset that is added when a timezone is configured
+var timestampSuffix = regexp.MustCompile(`_\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2}(Z|[+-]\d{4})?$`)
+
+// CatalogRepositoryImpl implements domain.CatalogRepository with a JSON file per backup directory
+type CatalogRepositoryImpl struct {
+	mu sync.Mutex
+}
+
+// NewCatalogRepository creates a new catalog repository
+func NewCatalogRepository() domain.CatalogRepository {
+	return &CatalogRepositoryImpl{}
+}
+
+// AddEntry records a backup in the catalog of backupDir
+func (r *CatalogRepositoryImpl) AddEntry(backupDir string, entry domain.CatalogEntry) (domain.CatalogEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries, err := readCatalog(backupDir)
+	if err != nil {
+		return entry, err
+	}
+
+	if entry.ID == "" {
+		entry.ID = newCatalogID()
+	}
+	entries = append(entries, entry)
+
+	return entry, writeCatalog(backupDir, entries)
+}
+
+// UpdateEntry replaces the record of the backup at entry.Path, adding one for a backup that
+// predates the catalog
+func (r *CatalogRepositoryImpl) UpdateEntry(backupDir string, entry domain.CatalogEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries, err := readCatalog(backupDir)
+	if err != nil {
+		return err
+	}
+
+	for i, recorded := range entries {
+		if filepath.Clean(recorded.Path) == filepath.Clean(entry.Path) {
+			entries[i] = entry
+			return writeCatalog(backupDir, entries)
+		}
+	}
+	if entry.ID == "" {
+		entry.ID = newCatalogID()
+	}
+	return writeCatalog(backupDir, append(entries, entry))
+}
+
+// ListEntries returns the backups of a database type under backupDir, newest first
+func (r *CatalogRepositoryImpl) ListEntries(backupDir string, dbType domain.DatabaseType) ([]domain.CatalogEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	catalog, err := readCatalog(backupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []domain.CatalogEntry
+	known := make(map[string]bool)
+	for _, entry := range catalog {
+		if entry.DatabaseType != dbType {
+			continue
+		}
+		// Skip dumps that were deleted by hand since they were recorded
+		if _, err := os.Stat(entry.Path); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+		known[filepath.Clean(entry.Path)] = true
+	}
+
+	scanned, err := scanBackups(backupDir, dbType)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range scanned {
+		if !known[filepath.Clean(entry.Path)] {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+// ListRecords returns the records of the catalog of backupDir as they are, whether or not the
+// backups are still on disk
+func (r *CatalogRepositoryImpl) ListRecords(backupDir string) ([]domain.CatalogEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return readCatalog(backupDir)
+}
+
+// ListOrphans looks through the database type directories of backupDir for sidecar files that
+// no backup next to them claims
+func (r *CatalogRepositoryImpl) ListOrphans(backupDir string) ([]string, error) {
+	dirs, err := os.ReadDir(backupDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var orphans []string
+	for _, dir := range dirs {
+		if !dir.IsDir() || !domain.DatabaseType(dir.Name()).IsValid() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(backupDir, dir.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup directory: %w", err)
+		}
+
+		claimed := make(map[string]bool)
+		var sidecars []string
+		for _, file := range files {
+			path := filepath.Join(backupDir, dir.Name(), file.Name())
+			if strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			if isSidecar(file.Name()) {
+				sidecars = append(sidecars, path)
+				continue
+			}
+			for _, companion := range []string{domain.GlobalsPath(path), domain.SignaturePath(path), domain.KeyPath(path), domain.ChecksumPath(path)} {
+				claimed[companion] = true
+			}
+		}
+		for _, path := range sidecars {
+			if !claimed[path] {
+				orphans = append(orphans, path)
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// isSidecar reports whether name is a file kept next to a backup rather than a backup
+func isSidecar(name string) bool {
+	return domain.IsGlobalsFile(name) || domain.IsSignatureFile(name) || domain.IsKeyFile(name) || domain.IsChecksumFile(name)
+}
+
+// WriteManifest writes entry as JSON to path
+func (r *CatalogRepositoryImpl) WriteManifest(path string, entry domain.CatalogEntry) error {
+	content, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest reads a manifest written by WriteManifest, on this host or another
+func (r *CatalogRepositoryImpl) ReadManifest(path string) (domain.CatalogEntry, error) {
+	var entry domain.CatalogEntry
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return entry, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return entry, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if entry.ID == "" || entry.Path == "" || entry.DatabaseType == "" {
+		return entry, fmt.Errorf("invalid manifest: id, path and database_type are required")
+	}
+	return entry, nil
+}
+
+// RemoveEntry deletes a backup and its catalog record, refusing while differential backups
+// build on it. Chunks of a deduplicated backup stay in the store until the next gc.
+func (r *CatalogRepositoryImpl) RemoveEntry(backupDir string, entry domain.CatalogEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	catalog, err := readCatalog(backupDir)
+	if err != nil {
+		return err
+	}
+
+	// Differential backups deleted by hand no longer need their full backup
+	var existing []domain.CatalogEntry
+	for _, recorded := range catalog {
+		if _, err := os.Stat(recorded.Path); err == nil {
+			existing = append(existing, recorded)
+		}
+	}
+	if dependents := domain.Dependents(existing, entry.Path); len(dependents) > 0 {
+		return &domain.BaseInUseError{Path: entry.Path, Dependents: dependents}
+	}
+
+	if err := removeBackup(entry); err != nil {
+		return err
+	}
+
+	remaining := catalog[:0]
+	for _, recorded := range catalog {
+		if filepath.Clean(recorded.Path) != filepath.Clean(entry.Path) {
+			remaining = append(remaining, recorded)
+		}
+	}
+	return writeCatalog(backupDir, remaining)
+}
+
+// RemoveLocal deletes a backup and its companions from disk as RemoveEntry does, leaving its
+// record, which says which stores keep it
+func (r *CatalogRepositoryImpl) RemoveLocal(entry domain.CatalogEntry) error {
+	if len(entry.Stores) == 0 {
+		return fmt.Errorf("%s is kept in no store", entry.Path)
+	}
+	return removeBackup(entry)
+}
+
+// removeBackup deletes a backup and the files kept next to it
+func removeBackup(entry domain.CatalogEntry) error {
+	if err := os.RemoveAll(entry.Path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", entry.Path, err)
+	}
+	if entry.DatabaseType.UsesPgDump() {
+		if err := os.Remove(domain.GlobalsPath(entry.Path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove globals of %s: %w", entry.Path, err)
+		}
+	}
+	for _, companion := range []string{domain.SignaturePath(entry.Path), domain.KeyPath(entry.Path), domain.ChecksumPath(entry.Path)} {
+		if err := os.Remove(companion); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", companion, err)
+		}
+	}
+	// Uploads that never completed leave their progress behind, for the backup and its parts
+	for _, pattern := range []string{domain.UploadStatePath(entry.Path, "*"), domain.UploadStatePath(domain.PartialPath(entry.Path)+".part*", "*")} {
+		states, _ := filepath.Glob(pattern)
+		for _, state := range states {
+			os.Remove(state)
+		}
+	}
+	return nil
+}
+
+// AddEvent appends event to the audit log of backupDir
+func (r *CatalogRepositoryImpl) AddEvent(backupDir string, event domain.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(backupDir, eventsFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return file.Close()
+}
+
+// ListEvents returns the audit log of backupDir, oldest first. A line cut short by a crash
+// while it was written is skipped.
+func (r *CatalogRepositoryImpl) ListEvents(backupDir string) ([]domain.AuditEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	content, err := os.ReadFile(filepath.Join(backupDir, eventsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	var events []domain.AuditEvent
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		var event domain.AuditEvent
+		if len(bytes.TrimSpace(line)) == 0 || json.Unmarshal(line, &event) != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events, nil
+}
+
+// scanBackups lists the dumps in <backupDir>/<dbType>, for backups taken before the catalog existed
+func scanBackups(backupDir string, dbType domain.DatabaseType) ([]domain.CatalogEntry, error) {
+	dir := filepath.Join(backupDir, dbType.String())
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var entries []domain.CatalogEntry
+	for _, file := range files {
+		// Backups still being written and chunk store temporaries are hidden
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		// MongoDB dumps are directories or .archive files, SQL dumps are files
+		archive := dbType == domain.DatabaseTypeMongoDB && !file.IsDir() && strings.Contains(file.Name(), ".archive")
+		if file.IsDir() != (dbType == domain.DatabaseTypeMongoDB) && !archive {
+			continue
+		}
+		// Roles and tablespaces, signatures, data keys and checksums belong to the dump next to them
+		if isSidecar(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		entry := domain.CatalogEntry{
+			DatabaseType: dbType,
+			Path:         filepath.Join(dir, file.Name()),
+			CreatedAt:    info.ModTime(),
+		}
+
+		name := file.Name()
+		if file.IsDir() {
+			// mongodump writes one subdirectory per database
+			if subdirs, err := os.ReadDir(entry.Path); err == nil && len(subdirs) == 1 && subdirs[0].IsDir() {
+				entry.Database = subdirs[0].Name()
+			}
+			name = "_" + name
+		} else {
+			name = domain.TrimCompressedExt(name)
+			name = name[:len(name)-len(filepath.Ext(name))]
+			entry.Database = timestampSuffix.ReplaceAllString(name, "")
+		}
+
+		// Prefer the timestamp in the name over the modification time, which copies reset
+		if match := timestampSuffix.FindStringSubmatch(name); match != nil {
+			layout := domain.DefaultTimestampFormat
+			if match[1] != "" {
+				layout = domain.ZonedTimestampFormat
+			}
+			if t, err := time.ParseInLocation(layout, match[0][1:], time.Local); err == nil {
+				entry.CreatedAt = t
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func readCatalog(backupDir string) ([]domain.CatalogEntry, error) {
+	content, err := os.ReadFile(filepath.Join(backupDir, catalogFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	var entries []domain.CatalogEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("invalid catalog %s: %w", filepath.Join(backupDir, catalogFile), err)
+	}
+	return entries, nil
+}
+
+// writeCatalog replaces the catalog atomically so an interrupted run cannot leave it truncated
+func writeCatalog(backupDir string, entries []domain.CatalogEntry) error {
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(backupDir, catalogFile+".tmp")
+	if err := os.WriteFile(tmp, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(backupDir, catalogFile)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	return nil
+}
+
+func newCatalogID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
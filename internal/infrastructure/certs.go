@@ -0,0 +1,236 @@
+package infrastructure
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// certMountDir is where docker-run mounts the client certificates in its temporary container
+const certMountDir = "/backup-tool-certs"
+
+// certFile is one certificate of domain.ClientCerts with the libpq parameter that names it
+type certFile struct {
+	param string // sslrootcert, sslcert or sslkey
+	path  string // As configured
+	mount string // File name under certMountDir
+}
+
+func certFiles(certs *domain.ClientCerts) []certFile {
+	if certs == nil {
+		return nil
+	}
+
+	var files []certFile
+	for _, file := range []certFile{
+		{param: "sslrootcert", path: certs.CA, mount: "ca.crt"},
+		{param: "sslcert", path: certs.Cert, mount: "client.crt"},
+		{param: "sslkey", path: certs.Key, mount: "client.key"},
+	} {
+		if file.path != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// certBinds mounts the client certificates read-only into a docker-run container
+func certBinds(config domain.DatabaseConfig) []string {
+	var binds []string
+	for _, file := range certFiles(config.Certs) {
+		source, err := filepath.Abs(file.path)
+		if err != nil {
+			source = file.path
+		}
+		binds = append(binds, source+":"+path.Join(certMountDir, file.mount)+":ro")
+	}
+	return binds
+}
+
+// certPath is where a client started with method finds the file
+func certPath(file certFile, method domain.BackupMethod) string {
+	if method == domain.BackupMethodDockerRun {
+		return path.Join(certMountDir, file.mount)
+	}
+	return file.path
+}
+
+// tlsParams returns the libpq connection parameters for the client certificates as a client
+// started with method sees them, sslmode first. Without certificates TLS is disabled.
+func tlsParams(config domain.DatabaseConfig, method domain.BackupMethod) [][2]string {
+	if config.Certs == nil {
+		return [][2]string{{"sslmode", "disable"}}
+	}
+
+	params := [][2]string{{"sslmode", config.Certs.TLSMode()}}
+	for _, file := range certFiles(config.Certs) {
+		params = append(params, [2]string{file.param, certPath(file, method)})
+	}
+	return params
+}
+
+// postgresTLSEnv returns the TLS settings as libpq environment variables quoted for sh, followed
+// by a space. Without certificates it is empty, leaving libpq's default of trying TLS first.
+func postgresTLSEnv(config domain.DatabaseConfig, method domain.BackupMethod) string {
+	if config.Certs == nil {
+		return ""
+	}
+	var vars []string
+	for _, param := range tlsParams(config, method) {
+		vars = append(vars, "PG"+strings.ToUpper(param[0])+"="+shellQuote(param[1])+" ")
+	}
+	return strings.Join(vars, "")
+}
+
+// postgresTLSVars returns the TLS settings as libpq environment variables for a container
+func postgresTLSVars(config domain.DatabaseConfig, method domain.BackupMethod) []string {
+	if config.Certs == nil {
+		return nil
+	}
+	var vars []string
+	for _, param := range tlsParams(config, method) {
+		vars = append(vars, "PG"+strings.ToUpper(param[0])+"="+param[1])
+	}
+	return vars
+}
+
+// mysqlSSLModes translates the TLS modes into mysql's --ssl-mode
+var mysqlSSLModes = map[string]string{
+	domain.TLSModeRequire:    "REQUIRED",
+	domain.TLSModeVerifyCA:   "VERIFY_CA",
+	domain.TLSModeVerifyFull: "VERIFY_IDENTITY",
+}
+
+// mysqlCertFlags names the mysql flag for each libpq certificate parameter
+var mysqlCertFlags = map[string]string{"sslrootcert": "--ssl-ca", "sslcert": "--ssl-cert", "sslkey": "--ssl-key"}
+
+// mysqlTLSFlags returns the TLS flags of mysql and mysqldump quoted for sh, preceded by a space.
+// MariaDB's clients have no --ssl-mode and verify the server with --ssl-verify-server-cert,
+// which checks the host name as well. IAM tokens are sent as they are, over the TLS connection
+// the managed services require, which the clients only do when told to.
+func mysqlTLSFlags(config domain.DatabaseConfig, method domain.BackupMethod) string {
+	var flags []string
+	if config.Managed != nil && config.Managed.IAMAuth {
+		flags = append(flags, "--enable-cleartext-plugin")
+	}
+	if config.Certs != nil {
+		mode := config.Certs.TLSMode()
+		if config.Type == domain.DatabaseTypeMariaDB {
+			flags = append(flags, "--ssl")
+			if mode != domain.TLSModeRequire {
+				flags = append(flags, "--ssl-verify-server-cert")
+			}
+		} else {
+			flags = append(flags, "--ssl-mode="+mysqlSSLModes[mode])
+		}
+		for _, file := range certFiles(config.Certs) {
+			flags = append(flags, mysqlCertFlags[file.param]+"="+shellQuote(certPath(file, method)))
+		}
+	}
+	if len(flags) == 0 {
+		return ""
+	}
+	return " " + strings.Join(flags, " ")
+}
+
+// mongoTLSArgs returns the TLS flags of the MongoDB tools. Cert holds the key as well, which
+// is how the tools read a client certificate.
+func mongoTLSArgs(config domain.DatabaseConfig, method domain.BackupMethod) []string {
+	if config.Certs == nil {
+		return nil
+	}
+
+	args := []string{"--tls"}
+	for _, file := range certFiles(config.Certs) {
+		switch file.param {
+		case "sslrootcert":
+			args = append(args, "--tlsCAFile", certPath(file, method))
+		case "sslcert":
+			args = append(args, "--tlsCertificateKeyFile", certPath(file, method))
+		}
+	}
+	switch config.Certs.TLSMode() {
+	case domain.TLSModeRequire:
+		args = append(args, "--tlsAllowInvalidCertificates")
+	case domain.TLSModeVerifyCA:
+		args = append(args, "--tlsAllowInvalidHostnames")
+	}
+	return args
+}
+
+// apiURL is the base URL of a database reached over its API from this machine: Host itself if
+// it has a scheme, otherwise Host and Port (defaultPort if unset) over https with certificates
+func apiURL(config domain.DatabaseConfig, defaultPort int) string {
+	if strings.Contains(config.Host, "://") {
+		return strings.TrimSuffix(config.Host, "/")
+	}
+	port := config.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	scheme := "http"
+	if config.Certs != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(config.Host, strconv.Itoa(port))
+}
+
+// clientTLS loads the client certificates for a connection made from this machine; nil certs
+// connect without TLS
+func clientTLS(certs *domain.ClientCerts) (*tls.Config, error) {
+	if certs == nil {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch certs.Mode {
+	case domain.TLSModeRequire:
+		config.InsecureSkipVerify = true
+	case domain.TLSModeVerifyCA:
+		// Verified below against the CA only, without the host name
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyChain(state, config.RootCAs)
+		}
+	}
+	if certs.CA != "" {
+		pem, err := os.ReadFile(certs.CA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", certs.CA)
+		}
+	}
+	if certs.Cert != "" {
+		pair, err := tls.LoadX509KeyPair(certs.Cert, certs.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	return config, nil
+}
+
+// verifyChain checks the server's certificate chain against roots, the system's if nil, but not
+// the host name it was issued for
+func verifyChain(state tls.ConnectionState, roots *x509.CertPool) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("server sent no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
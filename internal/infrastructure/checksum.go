@@ -0,0 +1,142 @@
+package infrastructure
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// ChecksumBackup hashes the files of the backup at path as they are, before packing, and
+// writes them in the format of sha256sum, so "sha256sum -c" checks a copy without this tool
+func (r *BackupRepositoryImpl) ChecksumBackup(path string) error {
+	files, err := rawDigests(path)
+	if err != nil {
+		return err
+	}
+	return writeChecksums(domain.ChecksumPath(path), files)
+}
+
+// writeChecksums writes the hashes of files to checksumPath in the format of sha256sum,
+// replacing an older file at once
+func writeChecksums(checksumPath string, files []signedFile) error {
+	var content strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&content, "%s  %s\n", file.SHA256, file.Name)
+	}
+	if err := os.WriteFile(checksumPath+".tmp", []byte(content.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write checksums: %w", err)
+	}
+	if err := os.Rename(checksumPath+".tmp", checksumPath); err != nil {
+		os.Remove(checksumPath + ".tmp")
+		return fmt.Errorf("failed to write checksums: %w", err)
+	}
+	return nil
+}
+
+// VerifyChecksum checks that every file of the backup at path, and no other, has the SHA-256
+// its checksum file lists
+func (r *RestoreRepositoryImpl) VerifyChecksum(path string) error {
+	listed, err := readChecksums(domain.ChecksumPath(path))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w for %s", domain.ErrNoChecksum, path)
+	}
+	if err != nil {
+		return err
+	}
+
+	files, err := rawDigests(path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		hash, ok := listed[file.Name]
+		if !ok {
+			return fmt.Errorf("%w: %s is not in the checksum file", domain.ErrChecksumMismatch, file.Name)
+		}
+		if hash != file.SHA256 {
+			return fmt.Errorf("%w: %s has SHA-256 %s, expected %s", domain.ErrChecksumMismatch, file.Name, file.SHA256, hash)
+		}
+		delete(listed, file.Name)
+	}
+	for name := range listed {
+		return fmt.Errorf("%w: %s is missing", domain.ErrChecksumMismatch, name)
+	}
+	return nil
+}
+
+// rawDigests returns the SHA-256 of the bytes of each file of the backup at path, named
+// relative to the backup's directory as backupDigests names them
+func rawDigests(path string) ([]signedFile, error) {
+	paths, err := backupFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []signedFile
+	for _, file := range paths {
+		name, err := filepath.Rel(filepath.Dir(path), file)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := rawDigest(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", file, err)
+		}
+		files = append(files, signedFile{Name: filepath.ToSlash(name), SHA256: sum})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// rawDigest returns the hex SHA-256 of the file at path
+func rawDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readChecksums reads a checksum file into the hashes by file name. Lines sha256sum writes in
+// binary mode, with '*' before the name, are read as well.
+func readChecksums(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if scanner.Text() == "" {
+			continue
+		}
+		hash, name, ok := strings.Cut(scanner.Text(), " ")
+		name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		if _, err := hex.DecodeString(hash); !ok || err != nil || len(hash) != 2*sha256.Size || name == "" {
+			return nil, fmt.Errorf("%w: line %d of %s is not a SHA-256 and file name", domain.ErrChecksumMismatch, line, path)
+		}
+		sums[name] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return sums, nil
+}
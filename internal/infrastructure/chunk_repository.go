@@ -0,0 +1,523 @@
+package infrastructure
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// manifestMagic starts every packed backup, so readers can tell it from a dump
+const manifestMagic = "backup-tool chunks v1\n"
+
+// Chunk boundaries fall where the rolling hash of the last 64 bytes has its low 20 bits
+// clear, about every MiB, so an insert or delete only changes the chunks around it
+const (
+	minChunkSize = 256 << 10
+	maxChunkSize = 4 << 20
+	chunkMask    = 1<<20 - 1
+)
+
+// collectGrace keeps chunks that a backup running at the same time may have just written
+// or reused, before its manifest refers to them
+const collectGrace = time.Hour
+
+// gearTable maps each byte to a fixed pseudo-random value for the rolling hash. It must
+// never change, or new backups would stop sharing chunks with older ones.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x6261636b75702d74) // splitmix64
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// chunkManifest lists the chunks of a packed backup in order
+type chunkManifest struct {
+	Store  string     `json:"store"`          // Chunk store, relative to the manifest's directory
+	Gzip   bool       `json:"gzip"`           // The backup was gzipped; chunks hold the plain content
+	Zstd   bool       `json:"zstd,omitempty"` // The backup was compressed with zstd, likewise
+	Size   int64      `json:"size"`
+	Chunks []chunkRef `json:"chunks"`
+}
+
+type chunkRef struct {
+	Hash string `json:"hash"` // SHA-256 of the plain chunk
+	Size int64  `json:"size"`
+}
+
+// ChunkRepositoryImpl implements domain.ChunkRepository with one gzipped file per chunk,
+// named by its hash
+type ChunkRepositoryImpl struct{}
+
+// NewChunkRepository creates a new chunk repository
+func NewChunkRepository() domain.ChunkRepository {
+	return &ChunkRepositoryImpl{}
+}
+
+// Pack splits the backup at path into chunks and replaces it with a manifest
+func (r *ChunkRepositoryImpl) Pack(path, storeDir string) (domain.PackStats, error) {
+	var stats domain.PackStats
+
+	f, err := os.Open(path)
+	if err != nil {
+		return stats, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return stats, err
+	}
+	if !info.Mode().IsRegular() {
+		return stats, fmt.Errorf("%s is not a single-file backup", path)
+	}
+	if packed, err := isManifest(f); err != nil || packed {
+		if err == nil {
+			err = fmt.Errorf("%s is already packed", path)
+		}
+		return stats, err
+	}
+
+	// Chunking the compressed stream would defeat deduplication, since compressed output
+	// differs from the first changed byte on
+	format, err := compressedFormat(f)
+	if err != nil {
+		return stats, fmt.Errorf("failed to read backup: %w", err)
+	}
+	in, err := decompressed(f)
+	if err != nil {
+		return stats, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	defer in.Close()
+
+	store, err := filepath.Rel(filepath.Dir(path), storeDir)
+	if err != nil {
+		return stats, err
+	}
+	manifest := chunkManifest{Store: filepath.ToSlash(store), Gzip: format == gzipExt, Zstd: format == zstdExt}
+
+	err = splitChunks(in, func(chunk []byte) error {
+		ref, stored, err := storeChunk(storeDir, chunk)
+		if err != nil {
+			return err
+		}
+		manifest.Chunks = append(manifest.Chunks, ref)
+		manifest.Size += ref.Size
+		if stored > 0 {
+			stats.NewChunks++
+			stats.StoredBytes += stored
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, diskFull(fmt.Errorf("failed to store chunks: %w", err))
+	}
+	stats.Bytes = manifest.Size
+	stats.Chunks = len(manifest.Chunks)
+
+	if err := replaceWithManifest(path, manifest); err != nil {
+		return stats, diskFull(err)
+	}
+	return stats, nil
+}
+
+// IsPacked reports whether path is a manifest
+func (r *ChunkRepositoryImpl) IsPacked(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+		return false, err
+	}
+	return isManifest(f)
+}
+
+// Open reassembles a packed backup, compressing it again if it was compressed
+func (r *ChunkRepositoryImpl) Open(path string) (io.ReadCloser, error) {
+	manifest, storeDir, err := readManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	chunks := &chunkReader{storeDir: storeDir, chunks: manifest.Chunks}
+	ext := ""
+	switch {
+	case manifest.Gzip:
+		ext = gzipExt
+	case manifest.Zstd:
+		ext = zstdExt
+	default:
+		return chunks, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		compressor := newCompressor(pw, ext, domain.Compression{})
+		_, err := io.Copy(compressor, chunks)
+		if closeErr := compressor.Close(); err == nil {
+			err = closeErr
+		}
+		chunks.Close()
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// Collect removes unreferenced chunks older than collectGrace
+func (r *ChunkRepositoryImpl) Collect(backupDir, storeDir string, dryRun bool) (domain.CollectStats, error) {
+	var stats domain.CollectStats
+	referenced := make(map[string]bool)
+
+	storeAbs, err := filepath.Abs(storeDir)
+	if err != nil {
+		return stats, err
+	}
+	err = filepath.WalkDir(backupDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && abs == storeAbs {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		manifest, manifestStore, err := readManifest(path)
+		if errors.Is(err, errNotPacked) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Manifests of another store, e.g. a copied backup directory, keep nothing here
+		if abs, err := filepath.Abs(manifestStore); err != nil || abs != storeAbs {
+			return nil
+		}
+		stats.Manifests++
+		for _, ref := range manifest.Chunks {
+			referenced[ref.Hash] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to read backups: %w", err)
+	}
+
+	present := make(map[string]bool)
+	cutoff := time.Now().Add(-collectGrace)
+	err = filepath.WalkDir(storeDir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == storeDir {
+			return filepath.SkipAll
+		}
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		name := entry.Name()
+		if referenced[name] {
+			present[name] = true
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		// Leftovers of interrupted writes start with a dot and are removed the same way
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+		stats.Removed++
+		stats.RemovedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to collect chunks: %w", err)
+	}
+
+	stats.Chunks = len(present)
+	stats.Missing = len(referenced) - len(present)
+	return stats, nil
+}
+
+// splitChunks cuts r into content-defined chunks and passes each to emit, which must not
+// keep the slice
+func splitChunks(r io.Reader, emit func(chunk []byte) error) error {
+	buf := make([]byte, maxChunkSize)
+	filled := 0
+	eof := false
+	for {
+		if !eof {
+			n, err := io.ReadFull(r, buf[filled:])
+			filled += n
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if filled == 0 {
+			return nil
+		}
+
+		cut := cutPoint(buf[:filled])
+		if err := emit(buf[:cut]); err != nil {
+			return err
+		}
+		filled = copy(buf, buf[cut:filled])
+	}
+}
+
+// cutPoint returns the length of the first chunk in data
+func cutPoint(data []byte) int {
+	if len(data) <= minChunkSize {
+		return len(data)
+	}
+	var h uint64
+	for i := minChunkSize; i < len(data); i++ {
+		h = h<<1 + gearTable[data[i]]
+		if h&chunkMask == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// storeChunk writes chunk to the store unless it is there already, returning the bytes
+// written. A chunk that is reused gets a new modification time, so Collect leaves it alone.
+func storeChunk(storeDir string, chunk []byte) (chunkRef, int64, error) {
+	sum := sha256.Sum256(chunk)
+	ref := chunkRef{Hash: hex.EncodeToString(sum[:]), Size: int64(len(chunk))}
+	path := chunkPath(storeDir, ref.Hash)
+
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil {
+		return ref, 0, nil
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ref, 0, err
+	}
+	tmp, err := os.CreateTemp(dir, "."+ref.Hash+".*")
+	if err != nil {
+		return ref, 0, err
+	}
+	gz := gzip.NewWriter(tmp)
+	_, err = gz.Write(chunk)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return ref, 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return ref, 0, err
+	}
+	return ref, info.Size(), nil
+}
+
+// chunkPath spreads chunks over 256 directories by the first byte of their hash
+func chunkPath(storeDir, hash string) string {
+	return filepath.Join(storeDir, hash[:2], hash)
+}
+
+// replaceWithManifest atomically swaps the backup at path for its manifest
+func replaceWithManifest(path string, manifest chunkManifest) error {
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	_, err = tmp.WriteString(manifestMagic)
+	if err == nil {
+		_, err = tmp.Write(append(content, '\n'))
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// errNotPacked is returned by readManifest for files that are not manifests
+var errNotPacked = errors.New("backup is not packed")
+
+// readManifest reads the manifest at path and resolves its chunk store
+func readManifest(path string) (chunkManifest, string, error) {
+	var manifest chunkManifest
+
+	f, err := os.Open(path)
+	if err != nil {
+		return manifest, "", fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(manifestMagic))
+	if string(magic) != manifestMagic {
+		return manifest, "", errNotPacked
+	}
+	br.Discard(len(manifestMagic))
+	if err := json.NewDecoder(br).Decode(&manifest); err != nil {
+		return manifest, "", fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return manifest, filepath.Join(filepath.Dir(path), filepath.FromSlash(manifest.Store)), nil
+}
+
+// isManifest reports whether f starts with the manifest magic, leaving its offset at the start
+func isManifest(f *os.File) (bool, error) {
+	magic := make([]byte, len(manifestMagic))
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return string(magic[:n]) == manifestMagic, nil
+}
+
+// openPlain returns the content of a backup file, reassembled from its chunks if it is
+// packed; gzip is left for the caller to undo
+func openPlain(path string) (io.ReadCloser, error) {
+	manifest, storeDir, err := readManifest(path)
+	if errors.Is(err, errNotPacked) {
+		return os.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{storeDir: storeDir, chunks: manifest.Chunks}, nil
+}
+
+// chunkReader reads the chunks of a manifest in order, checking each against its hash
+type chunkReader struct {
+	storeDir string
+	chunks   []chunkRef
+
+	file   *os.File
+	gz     *gzip.Reader
+	hash   hash.Hash
+	read   int64
+	closed bool
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.closed {
+			return 0, os.ErrClosed
+		}
+		if r.gz == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			if err := r.next(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.gz.Read(p)
+		r.hash.Write(p[:n])
+		r.read += int64(n)
+		if err == io.EOF {
+			if err := r.finish(); err != nil {
+				return n, err
+			}
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// next opens the first remaining chunk
+func (r *chunkReader) next() error {
+	ref := r.chunks[0]
+	f, err := os.Open(chunkPath(r.storeDir, ref.Hash))
+	if err != nil {
+		return fmt.Errorf("chunk %s is missing: %w", ref.Hash, err)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("chunk %s is corrupt: %w", ref.Hash, err)
+	}
+	r.file, r.gz, r.hash, r.read = f, gz, sha256.New(), 0
+	return nil
+}
+
+// finish checks the chunk just read and moves on to the next one
+func (r *chunkReader) finish() error {
+	ref := r.chunks[0]
+	r.chunks = r.chunks[1:]
+	r.file.Close()
+	r.file, r.gz = nil, nil
+	if r.read != ref.Size || hex.EncodeToString(r.hash.Sum(nil)) != ref.Hash {
+		return fmt.Errorf("chunk %s is corrupt", ref.Hash)
+	}
+	return nil
+}
+
+func (r *chunkReader) Close() error {
+	r.closed = true
+	if r.file != nil {
+		return r.file.Close()
+	}
+	return nil
+}
+
+// diskFull marks a failed write on a full filesystem with domain.ErrDiskFull
+func diskFull(err error) error {
+	if errors.Is(err, syscall.ENOSPC) && !errors.Is(err, domain.ErrDiskFull) {
+		return fmt.Errorf("%w: %w", domain.ErrDiskFull, err)
+	}
+	return err
+}
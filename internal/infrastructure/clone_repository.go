@@ -0,0 +1,118 @@
+package infrastructure
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// CloneRepositoryImpl implements domain.CloneRepository on top of the backup and restore repositories
+type CloneRepositoryImpl struct {
+	backup  *BackupRepositoryImpl
+	restore *RestoreRepositoryImpl
+}
+
+// NewCloneRepository creates a new clone repository
+func NewCloneRepository() domain.CloneRepository {
+	pool := newClientPool()
+	return &CloneRepositoryImpl{
+		backup:  &BackupRepositoryImpl{clientPool: pool},
+		restore: &RestoreRepositoryImpl{clientPool: pool},
+	}
+}
+
+// Clone dumps the source database and loads it into the target. SQL dumps and MongoDB archives
+// are piped straight from the source into the target.
+func (r *CloneRepositoryImpl) Clone(config domain.CloneConfig) error {
+	source, err := r.backup.ManagedLogin(config.Source)
+	if err != nil {
+		return err
+	}
+	target, err := r.restore.ManagedLogin(config.Target)
+	if err != nil {
+		return err
+	}
+
+	switch source.Type {
+	case domain.DatabaseTypePostgres, domain.DatabaseTypeTimescaleDB:
+		if source.Globals {
+			err := pipeDump(
+				func(w io.Writer) error {
+					return r.backup.dumpPostgresGlobals(source, config.SourceMethod, config.SourceNamespace, w)
+				},
+				func(in io.Reader) error {
+					return r.restore.loadPostgresGlobals(target, config.TargetMethod, config.TargetNamespace, in)
+				})
+			if err != nil {
+				return fmt.Errorf("failed to copy roles and tablespaces: %w", err)
+			}
+		}
+		return pipeDump(
+			func(w io.Writer) error {
+				return maskDump(source, w, func(w io.Writer) error {
+					return r.backup.dumpPostgres(source, config.SourceMethod, config.SourceNamespace, false, w)
+				})
+			},
+			func(in io.Reader) error {
+				return r.restore.loadPostgres(target, config.TargetMethod, config.TargetNamespace, in)
+			})
+
+	case domain.DatabaseTypeMySQL, domain.DatabaseTypeMariaDB:
+		if source.Physical {
+			return fmt.Errorf("physical MariaDB backups cannot be cloned; use a logical dump")
+		}
+		image := source.Type.String()
+		return pipeDump(
+			func(w io.Writer) error {
+				return maskDump(source, w, func(w io.Writer) error {
+					return r.backup.dumpMySQLCompatible(source, config.SourceMethod, config.SourceNamespace, image, false, w)
+				})
+			},
+			func(in io.Reader) error {
+				return r.restore.loadMySQLCompatible(target, config.TargetMethod, config.TargetNamespace, image, in)
+			})
+
+	case domain.DatabaseTypeMongoDB:
+		// An archive streams like a SQL dump, so nothing is copied through the local disk
+		return pipeDump(
+			func(w io.Writer) error {
+				return r.backup.dumpMongoArchive(source, config.SourceMethod, config.SourceNamespace, false, w)
+			},
+			func(in io.Reader) error {
+				return r.restore.loadMongoArchive(target, config.TargetMethod, config.TargetNamespace, mongoNamespaceArgs(source.Database, target.Database), in)
+			})
+	}
+
+	return fmt.Errorf("unsupported database type: %s", source.Type)
+}
+
+// pipeDump connects dump to load through a pipe. A failed dump fails the clone even when
+// load succeeded, since load cannot tell a truncated dump from a complete one.
+func pipeDump(dump func(w io.Writer) error, load func(in io.Reader) error) error {
+	reader, writer := io.Pipe()
+
+	dumpErr := make(chan error, 1)
+	go func() {
+		err := dump(writer)
+		writer.CloseWithError(err)
+		dumpErr <- err
+	}()
+
+	loadErr := load(reader)
+	// Unblock the dump if load stopped reading early
+	reader.Close()
+
+	err := <-dumpErr
+	if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		return fmt.Errorf("dump failed: %w", err)
+	}
+	if loadErr != nil {
+		return fmt.Errorf("restore failed: %w", loadErr)
+	}
+	if err != nil {
+		return fmt.Errorf("dump failed: %w", err)
+	}
+	return nil
+}
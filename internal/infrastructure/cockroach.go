@@ -0,0 +1,123 @@
+package infrastructure
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// cockroachManifest is the file a CockroachDB BACKUP writes once it is complete
+const cockroachManifest = "BACKUP_MANIFEST"
+
+// cockroachUserfileDir is the userfile directory backups are staged in. Userfile storage lives
+// in the cluster itself, so it is reachable from any client, unlike nodelocal storage.
+const cockroachUserfileDir = "backup-tool"
+
+// backupCockroachDB runs BACKUP INTO the cluster's userfile storage, downloads the backup with
+// cockroach userfile get and streams it as a tar archive to backupPath. The staged copy is
+// deleted again either way.
+func (r *BackupRepositoryImpl) backupCockroachDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	staged := cockroachUserfileDir + "/" + strings.TrimSuffix(filepath.Base(backupPath), filepath.Ext(backupPath))
+	connection := cockroachURL(config, method)
+
+	backup := fmt.Sprintf("BACKUP DATABASE %s INTO %s", quotePostgres("", config.Database), sqlString("userfile:///"+staged))
+	script := fmt.Sprintf(`d=$(mktemp -d) && cockroach sql --url %[1]s -e %[2]s >&2 `+
+		`&& cockroach userfile get --url %[1]s %[3]s "$d" >&2 && tar -C "$d" -cf - .; s=$?; `+
+		`cockroach userfile delete --url %[1]s %[4]s >&2; rm -rf "$d"; exit $s`,
+		shellQuote(connection), shellQuote(backup), shellQuote(staged), shellQuote(staged+"/*"))
+
+	return writeToFile(backupPath, config, func(w io.Writer) error {
+		w = limitWriter(w, config.Limits.BytesPerSecond)
+		command := []string{"sh", "-c", script}
+
+		switch method {
+		case domain.BackupMethodDockerRun:
+			if err := r.runContainer(runOptions(config.Limits, imageFor(config), command, nil, certBinds(config)), nil, w); err != nil {
+				return fmt.Errorf("docker run failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodDockerExec:
+			if err := r.streamContainer(config.Container, niceCommand(config.Limits, command), w); err != nil {
+				return fmt.Errorf("docker exec failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodKubectlExec:
+			if err := r.streamPod(config, namespace, niceCommand(config.Limits, command), w); err != nil {
+				return fmt.Errorf("pod exec failed: %w", err)
+			}
+			return nil
+		}
+		return fmt.Errorf("unknown backup method: %s", method)
+	})
+}
+
+// restoreCockroachDB uploads a backup archive to userfile storage and runs RESTORE DATABASE
+// from it, under config.Database's name. CockroachDB refuses to restore over a database that
+// exists, so the target has to be dropped or a new name given.
+func (r *RestoreRepositoryImpl) restoreCockroachDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace string) error {
+	name := "restore-" + strings.TrimSuffix(filepath.Base(backupPath), filepath.Ext(backupPath))
+	staged := cockroachUserfileDir + "/" + name
+	connection := cockroachURL(config, method)
+	if sourceDatabase == "" {
+		sourceDatabase = config.Database
+	}
+
+	restore := fmt.Sprintf("RESTORE DATABASE %s FROM LATEST IN %s", quotePostgres("", sourceDatabase), sqlString("userfile:///"+staged))
+	if sourceDatabase != config.Database {
+		restore += " WITH new_db_name = " + sqlString(config.Database)
+	}
+	// userfile upload -r keeps the directory's name, so the archive is unpacked into one named like the staged path
+	script := fmt.Sprintf(`d=$(mktemp -d) && mkdir "$d"/%[5]s && tar -xf - -C "$d"/%[5]s `+
+		`&& cockroach userfile upload --url %[1]s -r "$d"/%[5]s %[3]s >&2 && cockroach sql --url %[1]s -e %[2]s; s=$?; `+
+		`cockroach userfile delete --url %[1]s %[4]s >&2; rm -rf "$d"; exit $s`,
+		shellQuote(connection), shellQuote(restore), shellQuote(cockroachUserfileDir), shellQuote(staged+"/*"), shellQuote(name))
+
+	return readFromFile(backupPath, func(in io.Reader) error {
+		return r.runClient(config, method, namespace, []string{"sh", "-c", script}, in, io.Discard)
+	})
+}
+
+// cockroachURL is the connection URL of the cluster for the cockroach CLI, with the client
+// certificates in its query. Without certificates the connection is insecure.
+func cockroachURL(config domain.DatabaseConfig, method domain.BackupMethod) string {
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+	port := config.Port
+	if port == 0 {
+		port = 26257
+	}
+
+	user := config.User
+	if user == "" {
+		user = "root"
+	}
+
+	connection := url.URL{Scheme: "postgresql", Host: net.JoinHostPort(host, strconv.Itoa(port)), Path: "/defaultdb"}
+	if config.Password != "" {
+		connection.User = url.UserPassword(user, config.Password)
+	} else {
+		connection.User = url.User(user)
+	}
+
+	query := url.Values{}
+	for _, param := range tlsParams(config, method) {
+		query.Set(param[0], param[1])
+	}
+	connection.RawQuery = query.Encode()
+	return connection.String()
+}
+
+// sqlString quotes s as a SQL string literal
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
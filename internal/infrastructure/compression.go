@@ -0,0 +1,149 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// gzipExt and zstdExt mark backups that are written compressed
+const (
+	gzipExt = domain.GzipExt
+	zstdExt = domain.ZstdExt
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// compressedExt returns the extension of path that names its compression, gzipExt or zstdExt,
+// or "" when a backup written to path is not compressed
+func compressedExt(path string) string {
+	for _, ext := range []string{gzipExt, zstdExt} {
+		if strings.HasSuffix(path, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// isCompressedPath reports whether a backup written to path should be compressed
+func isCompressedPath(path string) bool {
+	return compressedExt(path) != ""
+}
+
+// compressedFormat returns how the content of f is compressed, gzipExt, zstdExt or "" for
+// plain content, leaving its offset at the start
+func compressedFormat(f *os.File) (string, error) {
+	magic := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return formatOf(magic[:n]), nil
+}
+
+// formatOf returns the compression the content starting with magic is in, as compressedFormat
+func formatOf(magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzipExt
+	case bytes.HasPrefix(magic, zstdMagic):
+		return zstdExt
+	}
+	return ""
+}
+
+// decompressed returns r, transparently decompressed if it starts with the gzip or zstd magic
+// bytes. zstd is run as a command, which Close stops if the content is not read to its end.
+func decompressed(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch formatOf(magic) {
+	case gzipExt:
+		return gzip.NewReader(br)
+	case zstdExt:
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(runLocal(br, pw, "zstd", "-d", "-c", "-q"))
+		}()
+		return pr, nil
+	}
+	return io.NopCloser(br), nil
+}
+
+// newCompressor returns a writer that compresses what is written to it into w, in the format
+// ext names. gzip uses compression.Tool; pigz and zstd run as commands on compression.Threads
+// threads. Close flushes the compressed stream and reports whether compressing failed.
+func newCompressor(w io.Writer, ext string, compression domain.Compression) io.WriteCloser {
+	var command []string
+	switch {
+	case ext == zstdExt:
+		// -T0 uses one thread per CPU
+		command = []string{"zstd", "-c", "-q", "-T" + strconv.Itoa(compression.Threads)}
+	case compression.Tool == domain.CompressionPigz:
+		command = []string{"pigz", "-c"}
+		if compression.Threads > 0 {
+			command = append(command, "-p", strconv.Itoa(compression.Threads))
+		}
+	default:
+		return gzip.NewWriter(w)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := runLocal(pr, w, command...)
+		// Writes fail with the command's error once it stopped reading
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	return &commandWriter{PipeWriter: pw, done: done}
+}
+
+// commandWriter writes to the input of a command that newCompressor started
+type commandWriter struct {
+	*io.PipeWriter
+	done chan error
+}
+
+// Close ends the input and waits for the command to finish writing its output
+func (c *commandWriter) Close() error {
+	c.PipeWriter.Close()
+	return <-c.done
+}
+
+// compressInContainer reports whether the dump for backupPath is gzipped in the container or
+// pod that runs the client tools, and then written to the file as it arrives. zstd is left to
+// the host, as client images rarely have it.
+func compressInContainer(config domain.DatabaseConfig, method domain.BackupMethod, backupPath string) bool {
+	return config.CompressInContainer && method != domain.BackupMethodDockerRun &&
+		compressedExt(backupPath) == gzipExt && len(config.Masking) == 0
+}
+
+// compressCommand pipes command's output through gzip if compress is set, or through pigz
+// where compression asks for it and the container has it. sh has no pipefail everywhere, so
+// the exit status of command is passed out of the pipeline on fd 3.
+func compressCommand(compress bool, compression domain.Compression, command []string) []string {
+	if !compress {
+		return command
+	}
+	gzipCommand := "gzip -c"
+	if compression.Tool == domain.CompressionPigz {
+		pigz := "pigz -c"
+		if compression.Threads > 0 {
+			pigz += " -p " + strconv.Itoa(compression.Threads)
+		}
+		gzipCommand = "if command -v pigz >/dev/null 2>&1; then " + pigz + "; else gzip -c; fi"
+	}
+	return append([]string{"sh", "-c", `exec 4>&1; s=$({ { "$@"; echo $? >&3; } | { ` + gzipCommand + `; } >&4; } 3>&1) && exit "${s:-1}"`, "sh"}, command...)
+}
@@ -0,0 +1,96 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// connectTimeout is how many seconds a connection test waits for the server, so a wrong host
+// fails quickly instead of hanging the prompts
+const connectTimeout = 10
+
+// TestConnection runs a trivial query against the database the way its backup reaches it: in
+// a temporary container, the database's container or its pod, or over the API. A wrong host,
+// password or container then shows while configuring instead of when the backup runs.
+func (r *BackupRepositoryImpl) TestConnection(config domain.DatabaseConfig, method domain.BackupMethod, namespace string) error {
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+
+	var command []string
+	switch config.Type {
+	case domain.DatabaseTypePostgres, domain.DatabaseTypeTimescaleDB:
+		command = shellCommand("%sPGPASSWORD=%s PGCONNECT_TIMEOUT=%d psql -h %s -U %s -d %s -tAc 'SELECT 1'",
+			postgresTLSEnv(config, method), shellQuote(config.Password), connectTimeout, shellQuote(host), shellQuote(config.User), shellQuote(config.Database))
+
+	case domain.DatabaseTypeMySQL, domain.DatabaseTypeMariaDB:
+		command = shellCommand("mysql -h %s -u%s -p%s%s --connect-timeout=%d -N -B -e 'SELECT 1' %s",
+			shellQuote(host), shellQuote(config.User), shellQuote(config.Password), mysqlTLSFlags(config, method), connectTimeout, shellQuote(config.Database))
+
+	case domain.DatabaseTypeMongoDB:
+		command = mongoEvalCommand(config, method, "db.runCommand({ ping: 1 }).ok")
+
+	case domain.DatabaseTypeCockroachDB:
+		command = shellCommand("cockroach sql --url %s -e 'SELECT 1'", shellQuote(cockroachURL(config, method)))
+
+	case domain.DatabaseTypeYugabyteDB:
+		command = shellCommand("%s PGCONNECT_TIMEOUT=%d ysqlsh %s -d %s -tAc 'SELECT 1'",
+			yugabyteEnv(config, method), connectTimeout, yugabyteArgs(config, method), shellQuote(config.Database))
+
+	case domain.DatabaseTypeInfluxDB:
+		if config.IsInfluxV1() {
+			command = shellCommand("influx -host %s -execute 'SHOW DATABASES'", shellQuote(host))
+		} else {
+			command = shellCommand("influx bucket list %s --name %s", influxArgs(config, host), shellQuote(config.Database))
+		}
+
+	case domain.DatabaseTypeNeo4j:
+		// Dumps from a stopped container need no login to test
+		if config.Neo4j.Strategy == domain.Neo4jStopContainer {
+			return domain.ErrNoConnectionTest
+		}
+		command = []string{"sh", "-c", neo4jCypher(config, method, "SHOW DATABASES")}
+
+	case domain.DatabaseTypeEtcd:
+		return r.testEtcd(config)
+
+	case domain.DatabaseTypeRabbitMQ:
+		resp, err := rabbitMQRequest(r.ctx, config, http.MethodGet, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+
+	default:
+		return domain.ErrNoConnectionTest
+	}
+
+	if err := r.runClient(config, method, namespace, command, nil, io.Discard); err != nil {
+		return fmt.Errorf("connection test failed: %w", err)
+	}
+	return nil
+}
+
+// testEtcd reads a key count from the etcd member, which needs the same login as a snapshot
+func (r *BackupRepositoryImpl) testEtcd(config domain.DatabaseConfig) error {
+	client, err := etcdClient(config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.ctx, etcdDialTimeout)
+	defer cancel()
+	if _, err := client.Get(ctx, "\x00", clientv3.WithFromKey(), clientv3.WithCountOnly()); err != nil {
+		return fmt.Errorf("connection test failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package infrastructure
+
+import "golang.org/x/sys/windows"
+
+// diskFree returns the bytes available to the current user on the volume holding dir
+func diskFree(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(free), nil
+}
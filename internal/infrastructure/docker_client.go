@@ -0,0 +1,285 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// DockerClient runs, execs into and copies from containers through the Docker Engine API,
+// so the docker binary does not need to be installed
+type DockerClient struct {
+	api *client.Client
+}
+
+// NewDockerClient creates a client from DOCKER_HOST, DOCKER_TLS_VERIFY and DOCKER_CERT_PATH
+func NewDockerClient() (*DockerClient, error) {
+	api, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	return &DockerClient{api: api}, nil
+}
+
+// RunOptions describes a temporary container
+type RunOptions struct {
+	Image       string
+	Command     []string
+	Env         []string
+	Binds       []string
+	VolumesFrom []string // Containers whose volumes are mounted too, e.g. a stopped database's data
+	NanoCPUs    int64    // CPU cap in billionths of a CPU; 0 is unlimited
+	Memory      int64    // Memory cap in bytes; 0 is unlimited
+}
+
+// Run starts a temporary container, streams its input and output and removes it afterwards
+func (c *DockerClient) Run(ctx context.Context, opts RunOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	logCommand("docker run "+opts.Image, opts.Command)
+	if err := c.ensureImage(ctx, opts.Image); err != nil {
+		return err
+	}
+
+	created, err := c.api.ContainerCreate(ctx,
+		&container.Config{
+			Image:        opts.Image,
+			Cmd:          opts.Command,
+			Env:          opts.Env,
+			AttachStdin:  stdin != nil,
+			OpenStdin:    stdin != nil,
+			StdinOnce:    stdin != nil,
+			AttachStdout: true,
+			AttachStderr: true,
+		},
+		&container.HostConfig{
+			Binds:       opts.Binds,
+			VolumesFrom: opts.VolumesFrom,
+			Resources: container.Resources{
+				NanoCPUs: opts.NanoCPUs,
+				Memory:   opts.Memory,
+			},
+		},
+		nil, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+	defer c.api.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{Force: true})
+
+	attach, err := c.api.ContainerAttach(ctx, created.ID, container.AttachOptions{
+		Stream: true,
+		Stdin:  stdin != nil,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach to container: %w", err)
+	}
+	defer attach.Close()
+	defer closeOnCancel(ctx, attach)()
+
+	if err := c.api.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+	sendStdin(attach, stdin)
+
+	if _, err := stdcopy.StdCopy(writerOrDiscard(stdout), writerOrDiscard(stderr), attach.Reader); err != nil {
+		return fmt.Errorf("failed to read container output: %w", err)
+	}
+
+	statusCh, errCh := c.api.ContainerWait(ctx, created.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("failed to wait for container: %w", err)
+	case status := <-statusCh:
+		if status.StatusCode != 0 {
+			return fmt.Errorf("exit status %d", status.StatusCode)
+		}
+	}
+
+	return nil
+}
+
+// Serve starts a long-running container named name in the background, such as a scratch
+// database server; Remove deletes it again
+func (c *DockerClient) Serve(ctx context.Context, name string, opts RunOptions) error {
+	logCommand("docker run -d "+opts.Image, opts.Command)
+	if err := c.ensureImage(ctx, opts.Image); err != nil {
+		return err
+	}
+
+	created, err := c.api.ContainerCreate(ctx,
+		&container.Config{
+			Image:  opts.Image,
+			Cmd:    opts.Command,
+			Env:    opts.Env,
+			Labels: map[string]string{"app.kubernetes.io/managed-by": "backup-tool"},
+		},
+		&container.HostConfig{
+			Binds: opts.Binds,
+			Resources: container.Resources{
+				NanoCPUs: opts.NanoCPUs,
+				Memory:   opts.Memory,
+			},
+		},
+		nil, nil, name)
+	if err != nil {
+		return fmt.Errorf("failed to create container %s: %w", name, err)
+	}
+	if err := c.api.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		c.api.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+		return fmt.Errorf("failed to start container %s: %w", name, err)
+	}
+	return nil
+}
+
+// Remove kills a container and deletes it along with its anonymous volumes
+func (c *DockerClient) Remove(ctx context.Context, containerName string) error {
+	if err := c.api.ContainerRemove(ctx, containerName, container.RemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+		return fmt.Errorf("failed to remove container %s: %w", containerName, err)
+	}
+	return nil
+}
+
+// Exec runs a command in a running container, streaming stdin to it and its output to stdout and stderr
+func (c *DockerClient) Exec(ctx context.Context, containerName string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	logCommand("container "+containerName, command)
+	exec, err := c.api.ContainerExecCreate(ctx, containerName, container.ExecOptions{
+		Cmd:          command,
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	attach, err := c.api.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to attach to exec: %w", err)
+	}
+	defer attach.Close()
+	defer closeOnCancel(ctx, attach)()
+	sendStdin(attach, stdin)
+
+	if _, err := stdcopy.StdCopy(writerOrDiscard(stdout), writerOrDiscard(stderr), attach.Reader); err != nil {
+		return fmt.Errorf("failed to read exec output: %w", err)
+	}
+
+	inspect, err := c.api.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("exit status %d", inspect.ExitCode)
+	}
+
+	return nil
+}
+
+// Containers lists the running containers by name, with their images
+func (c *DockerClient) Containers(ctx context.Context) ([]domain.Workload, error) {
+	containers, err := c.api.ContainerList(ctx, container.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	var workloads []domain.Workload
+	for _, running := range containers {
+		if len(running.Names) == 0 {
+			continue
+		}
+		workloads = append(workloads, domain.Workload{Name: strings.TrimPrefix(running.Names[0], "/"), Image: running.Image})
+	}
+	return workloads, nil
+}
+
+// Stop stops a running container, giving it Docker's default time to shut down cleanly
+func (c *DockerClient) Stop(ctx context.Context, containerName string) error {
+	if err := c.api.ContainerStop(ctx, containerName, container.StopOptions{}); err != nil {
+		return fmt.Errorf("failed to stop container %s: %w", containerName, err)
+	}
+	return nil
+}
+
+// Start starts a stopped container
+func (c *DockerClient) Start(ctx context.Context, containerName string) error {
+	if err := c.api.ContainerStart(ctx, containerName, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start container %s: %w", containerName, err)
+	}
+	return nil
+}
+
+// CopyFromContainer copies srcPath from a container into destDir, keeping the base name of srcPath.
+// bytesPerSecond caps the transfer rate; zero is unlimited.
+func (c *DockerClient) CopyFromContainer(ctx context.Context, containerName, srcPath, destDir string, bytesPerSecond int64) error {
+	reader, _, err := c.api.CopyFromContainer(ctx, containerName, srcPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return extractTar(limitReader(reader, bytesPerSecond), destDir)
+}
+
+// CopyToContainer copies the local directory srcDir into destDir inside a container,
+// keeping the base name of srcDir
+func (c *DockerClient) CopyToContainer(ctx context.Context, containerName, srcDir, destDir string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(createTar(srcDir, writer))
+	}()
+	defer reader.Close()
+
+	return c.api.CopyToContainer(ctx, containerName, destDir, reader, container.CopyToContainerOptions{})
+}
+
+// ensureImage pulls imageRef unless it is already present locally
+func (c *DockerClient) ensureImage(ctx context.Context, imageRef string) error {
+	if _, err := c.api.ImageInspect(ctx, imageRef); err == nil {
+		return nil
+	} else if !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to inspect image %s: %w", imageRef, err)
+	}
+
+	progress, err := c.api.ImagePull(ctx, imageRef, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", imageRef, err)
+	}
+	defer progress.Close()
+
+	_, err = io.Copy(io.Discard, progress)
+	return err
+}
+
+// sendStdin streams stdin into an attached connection and closes the write side when done
+func sendStdin(attach types.HijackedResponse, stdin io.Reader) {
+	if stdin == nil {
+		return
+	}
+	go func() {
+		io.Copy(attach.Conn, stdin)
+		attach.CloseWrite()
+	}()
+}
+
+// closeOnCancel closes an attached connection once ctx is cancelled, which only bounds setting
+// it up otherwise, so reading the output stops. The returned function ends the watch.
+func closeOnCancel(ctx context.Context, attach types.HijackedResponse) func() bool {
+	return context.AfterFunc(ctx, attach.Close)
+}
+
+func writerOrDiscard(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+	return w
+}
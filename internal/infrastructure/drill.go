@@ -0,0 +1,129 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+const (
+	// scratchReadyTimeout bounds how long a scratch server may take to initialize
+	scratchReadyTimeout = 3 * time.Minute
+
+	// scratchSteadyChecks is how many connection tests in a row a scratch server has to pass.
+	// The images start a temporary server to initialize the data directory and restart it
+	// afterwards, which a single test can catch.
+	scratchSteadyChecks = 3
+
+	scratchPollInterval = 2 * time.Second
+)
+
+// DrillRepositoryImpl implements domain.DrillRepository with containers of the engines' images,
+// which hold the server as well as the client tools
+type DrillRepositoryImpl struct {
+	*clientPool
+}
+
+// NewDrillRepository creates a new drill repository
+func NewDrillRepository() domain.DrillRepository {
+	return &DrillRepositoryImpl{clientPool: newClientPool()}
+}
+
+// StartScratch starts a server of config's engine and version with a random password and no
+// published ports, so nothing but docker exec reaches it, and waits until it accepts connections
+func (r *DrillRepositoryImpl) StartScratch(config domain.DatabaseConfig) (domain.DatabaseConfig, error) {
+	if config.Version == "" {
+		config.Version = "latest"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	password := make([]byte, 16)
+	rand.Read(password)
+
+	scratch := domain.DatabaseConfig{
+		Type:      config.Type,
+		Version:   config.Version,
+		Database:  config.Database,
+		Label:     config.Label,
+		Password:  hex.EncodeToString(password),
+		Container: "backup-tool-drill-" + invalidSnapshotChars.ReplaceAllString(strings.ToLower(config.Label), "-") + "-" + hex.EncodeToString(suffix),
+		TempDir:   "/tmp",
+	}
+
+	var env []string
+	switch config.Type {
+	case domain.DatabaseTypePostgres, domain.DatabaseTypeTimescaleDB:
+		scratch.User = "postgres"
+		env = []string{"POSTGRES_PASSWORD=" + scratch.Password, "POSTGRES_DB=" + config.Database}
+	case domain.DatabaseTypeMySQL:
+		scratch.User = "root"
+		env = []string{"MYSQL_ROOT_PASSWORD=" + scratch.Password, "MYSQL_DATABASE=" + config.Database}
+	case domain.DatabaseTypeMariaDB:
+		scratch.User = "root"
+		env = []string{"MARIADB_ROOT_PASSWORD=" + scratch.Password, "MARIADB_DATABASE=" + config.Database}
+	case domain.DatabaseTypeMongoDB:
+		scratch.User = "root"
+		scratch.AuthDatabase = "admin"
+		env = []string{"MONGO_INITDB_ROOT_USERNAME=root", "MONGO_INITDB_ROOT_PASSWORD=" + scratch.Password}
+	default:
+		return scratch, fmt.Errorf("restore drills are not supported for %s", config.Type)
+	}
+
+	docker, err := r.docker()
+	if err != nil {
+		return scratch, err
+	}
+	err = docker.Serve(r.ctx, scratch.Container, RunOptions{
+		Image: imageFor(config),
+		Env:   env,
+	})
+	if err != nil {
+		return scratch, err
+	}
+
+	if err := r.waitScratch(scratch); err != nil {
+		r.RemoveScratch(scratch)
+		return scratch, err
+	}
+	return scratch, nil
+}
+
+// waitScratch runs connection tests until scratchSteadyChecks pass in a row
+func (r *DrillRepositoryImpl) waitScratch(scratch domain.DatabaseConfig) error {
+	backup := &BackupRepositoryImpl{clientPool: r.clientPool}
+	ctx, cancel := context.WithTimeout(r.ctx, scratchReadyTimeout)
+	defer cancel()
+
+	var err error
+	for passed := 0; passed < scratchSteadyChecks; {
+		if err = backup.TestConnection(scratch, domain.BackupMethodDockerExec, ""); err == nil {
+			passed++
+		} else {
+			passed = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			if r.ctx.Err() != nil {
+				return r.ctx.Err()
+			}
+			return fmt.Errorf("scratch server %s did not accept connections within %s: %w", scratch.Container, scratchReadyTimeout, err)
+		case <-time.After(scratchPollInterval):
+		}
+	}
+	return nil
+}
+
+// RemoveScratch deletes a scratch server, also after an interrupt
+func (r *DrillRepositoryImpl) RemoveScratch(scratch domain.DatabaseConfig) error {
+	docker, err := r.docker()
+	if err != nil {
+		return err
+	}
+	return docker.Remove(context.Background(), scratch.Container)
+}
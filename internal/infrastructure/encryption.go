@@ -0,0 +1,651 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// Encrypted files start with encryptedMagic and a random nonce prefix, followed by the content
+// sealed with AES-256-GCM in segments of segmentSize bytes. Each segment's nonce is the prefix
+// and its number, and the last one is marked as such, so segments cannot be reordered, dropped
+// or cut off without failing to decrypt.
+const (
+	encryptedMagic = "backup-tool encrypted v1\n"
+	noncePrefixLen = 8
+	segmentSize    = 64 << 10
+	dataKeySize    = 32
+	encryptCipher  = "aes-256-gcm-segmented"
+)
+
+// vaultTimeout bounds each request to Vault's transit engine
+const vaultTimeout = 30 * time.Second
+
+// keyFile is the content of the file next to an encrypted backup: its data key, wrapped with
+// the KMS key, and where to find that key again
+type keyFile struct {
+	Cipher     string `json:"cipher"`
+	Provider   string `json:"provider"`
+	Key        string `json:"key"`
+	Region     string `json:"region,omitempty"`
+	Address    string `json:"address,omitempty"`
+	Mount      string `json:"mount,omitempty"`
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+func (k keyFile) encryption() domain.Encryption {
+	return domain.Encryption{Provider: k.Provider, Key: k.Key, Region: k.Region, Address: k.Address, Mount: k.Mount}
+}
+
+// EncryptBackup encrypts the files of the backup at path one by one, each replaced once it is
+// encrypted. The wrapped data key is written first, so no file is ever left encrypted without it.
+func (r *BackupRepositoryImpl) EncryptBackup(path string, encryption domain.Encryption) error {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	wrapped, err := wrapKey(r.ctx, encryption, dataKey)
+	if err != nil {
+		return err
+	}
+	if err := writeKeyFile(domain.KeyPath(path), keyFile{
+		Cipher:     encryptCipher,
+		Provider:   encryption.Provider,
+		Key:        encryption.Key,
+		Region:     encryption.Region,
+		Address:    encryption.Address,
+		Mount:      encryption.Mount,
+		WrappedKey: wrapped,
+	}); err != nil {
+		return err
+	}
+
+	files, err := backupFiles(path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := encryptFile(file, dataKey); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// BackupEncryption reads the KMS key of the backup at path from its key file
+func (r *BackupRepositoryImpl) BackupEncryption(path string) (*domain.Encryption, error) {
+	key, err := readKeyFile(domain.KeyPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	encryption := key.encryption()
+	return &encryption, nil
+}
+
+// RekeyBackup unwraps the data key of the backup at path with the KMS key it was wrapped with
+// and wraps it with the key of encryption. With reencrypt every file is first encrypted again
+// next to itself under a new data key, and the copies only replace the files once that key is
+// wrapped, so a failure leaves the backup as it was.
+func (r *BackupRepositoryImpl) RekeyBackup(path string, encryption domain.Encryption, reencrypt bool) error {
+	keyPath := domain.KeyPath(path)
+	old, err := readKeyFile(keyPath)
+	if err != nil {
+		return err
+	}
+	dataKey, err := unwrapKey(r.ctx, old.encryption(), old.WrappedKey)
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	discard := func() {
+		for _, file := range files {
+			os.Remove(file + ".rekeying")
+		}
+	}
+	if reencrypt {
+		newKey := make([]byte, dataKeySize)
+		if _, err := rand.Read(newKey); err != nil {
+			return err
+		}
+		if files, err = backupFiles(path); err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := reencryptFile(file, file+".rekeying", dataKey, newKey); err != nil {
+				discard()
+				return fmt.Errorf("failed to encrypt %s again: %w", file, err)
+			}
+		}
+		dataKey = newKey
+	}
+
+	wrapped, err := wrapKey(r.ctx, encryption, dataKey)
+	if err != nil {
+		discard()
+		return err
+	}
+	key := keyFile{
+		Cipher:     encryptCipher,
+		Provider:   encryption.Provider,
+		Key:        encryption.Key,
+		Region:     encryption.Region,
+		Address:    encryption.Address,
+		Mount:      encryption.Mount,
+		WrappedKey: wrapped,
+	}
+	if !reencrypt {
+		return writeKeyFile(keyPath, key)
+	}
+
+	// The new key is kept beside the old one until every file has been replaced
+	if err := writeKeyFile(keyPath+".new", key); err != nil {
+		discard()
+		return err
+	}
+	for _, file := range files {
+		if err := os.Rename(file+".rekeying", file); err != nil {
+			return fmt.Errorf("failed to replace %s, whose new key is in %s: %w", file, keyPath+".new", err)
+		}
+	}
+	return os.Rename(keyPath+".new", keyPath)
+}
+
+// DecryptBackup decrypts an encrypted backup into a directory of its own, see decryptBackup
+func (r *RestoreRepositoryImpl) DecryptBackup(path string) (string, error) {
+	return decryptBackup(r.ctx, path)
+}
+
+// decryptBackup returns path if the backup there is not encrypted, and otherwise decrypts it
+// with its globals file into a new directory under the backup's PartialDir, keeping their
+// names so they are recognised as they would be in place
+func decryptBackup(ctx context.Context, path string) (string, error) {
+	key, err := readKeyFile(domain.KeyPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return path, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := unwrapKey(ctx, key.encryption(), key.WrappedKey)
+	if err != nil {
+		return "", err
+	}
+
+	partial := filepath.Join(filepath.Dir(path), domain.PartialDir)
+	if err := os.MkdirAll(partial, 0o700); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(partial, "decrypted-")
+	if err != nil {
+		return "", err
+	}
+
+	files, err := backupFiles(path)
+	if err == nil {
+		for _, file := range files {
+			rel, relErr := filepath.Rel(filepath.Dir(path), file)
+			if relErr != nil {
+				err = relErr
+				break
+			}
+			if err = decryptFile(file, filepath.Join(dir, rel), dataKey); err != nil {
+				err = fmt.Errorf("failed to decrypt %s: %w", file, err)
+				break
+			}
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// backupFiles lists the regular files of the backup at path: the file itself or those in the
+// directory, and the globals file of a PostgreSQL dump
+func backupFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err == nil && entry.Type().IsRegular() {
+				files = append(files, file)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		files = append(files, path)
+	}
+	if globals := domain.GlobalsPath(path); globals != path && fileExists(globals) {
+		files = append(files, globals)
+	}
+	return files, nil
+}
+
+// encryptFile replaces the file at path with its encryption under dataKey
+func encryptFile(path string, dataKey []byte) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".encrypting"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = encryptStream(in, out, dataKey)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// decryptFile writes the decryption of the encrypted file at path to target
+func decryptFile(path, target string, dataKey []byte) error {
+	in, err := openPlain(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	err = decryptStream(in, out, dataKey)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// reencryptFile writes the file at path, encrypted under oldKey, to target encrypted under newKey
+func reencryptFile(path, target string, oldKey, newKey []byte) error {
+	in, err := openPlain(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(decryptStream(in, pw, oldKey))
+	}()
+	err = encryptStream(pr, out, newKey)
+	pr.CloseWithError(err)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// encryptStream writes in to out sealed in segments, see encryptedMagic
+func encryptStream(in io.Reader, out io.Writer, dataKey []byte) error {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, noncePrefixLen)
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(out, encryptedMagic); err != nil {
+		return err
+	}
+	if _, err := out.Write(prefix); err != nil {
+		return err
+	}
+
+	br := bufio.NewReaderSize(in, segmentSize)
+	plain := make([]byte, segmentSize)
+	sealed := make([]byte, 0, segmentSize+aead.Overhead())
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(br, plain)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		final := err != nil
+		if !final {
+			if _, err := br.Peek(1); err == io.EOF {
+				final = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if !final && counter == math.MaxUint32 {
+			return fmt.Errorf("too large to encrypt")
+		}
+
+		sealed = aead.Seal(sealed[:0], segmentNonce(prefix, counter), plain[:n], segmentData(final))
+		if _, err := out.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// decryptStream writes the content sealed in in to out, failing if any segment was changed,
+// moved or removed
+func decryptStream(in io.Reader, out io.Writer, dataKey []byte) error {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReaderSize(in, segmentSize+aead.Overhead())
+	header := make([]byte, len(encryptedMagic)+noncePrefixLen)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return fmt.Errorf("not an encrypted backup file")
+	}
+	prefix := header[len(encryptedMagic):]
+
+	sealed := make([]byte, segmentSize+aead.Overhead())
+	plain := make([]byte, 0, segmentSize)
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(br, sealed)
+		if err == io.EOF {
+			return fmt.Errorf("the file is cut short")
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		final := err != nil
+		if !final {
+			if _, err := br.Peek(1); err == io.EOF {
+				final = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		plain, err = aead.Open(plain[:0], segmentNonce(prefix, counter), sealed[:n], segmentData(final))
+		if err != nil {
+			return fmt.Errorf("the file was modified, cut short or encrypted with another key")
+		}
+		if _, err := out.Write(plain); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+func newAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// segmentNonce is the nonce of segment counter of a file
+func segmentNonce(prefix []byte, counter uint32) []byte {
+	return binary.BigEndian.AppendUint32(append([]byte{}, prefix...), counter)
+}
+
+// segmentData is the additional data of a segment, marking the last one of a file
+func segmentData(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// readKeyFile reads the wrapped data key of a backup
+func readKeyFile(path string) (keyFile, error) {
+	var key keyFile
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return key, err
+	}
+	if err := json.Unmarshal(content, &key); err != nil {
+		return key, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	if key.Cipher != encryptCipher {
+		return key, fmt.Errorf("key file %s: unknown cipher %q", path, key.Cipher)
+	}
+	return key, nil
+}
+
+// writeKeyFile writes the wrapped data key of a backup, replacing an older one at once
+func writeKeyFile(path string, key keyFile) error {
+	content, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", append(content, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	return nil
+}
+
+// wrapKey encrypts dataKey with the KMS key of encryption
+func wrapKey(ctx context.Context, encryption domain.Encryption, dataKey []byte) ([]byte, error) {
+	switch encryption.Provider {
+	case domain.KMSAWS:
+		client, err := kmsClient(ctx, encryption)
+		if err != nil {
+			return nil, err
+		}
+		out, err := client.Encrypt(ctx, &kms.EncryptInput{KeyId: aws.String(encryption.Key), Plaintext: dataKey})
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap the data key with %s: %w", encryption, err)
+		}
+		return out.CiphertextBlob, nil
+
+	case domain.KMSGCP:
+		var wrapped bytes.Buffer
+		err := runLocal(bytes.NewReader(dataKey), &wrapped,
+			"gcloud", "kms", "encrypt", "--key", encryption.Key, "--plaintext-file", "-", "--ciphertext-file", "-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap the data key with %s: %w", encryption, err)
+		}
+		return wrapped.Bytes(), nil
+
+	case domain.KMSVault:
+		var response struct {
+			Data struct {
+				Ciphertext string `json:"ciphertext"`
+			} `json:"data"`
+		}
+		err := vaultTransit(ctx, encryption, "encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}, &response)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap the data key with %s: %w", encryption, err)
+		}
+		return []byte(response.Data.Ciphertext), nil
+	}
+	return nil, fmt.Errorf("unknown KMS provider %q", encryption.Provider)
+}
+
+// unwrapKey decrypts a data key wrapped by wrapKey
+func unwrapKey(ctx context.Context, encryption domain.Encryption, wrapped []byte) ([]byte, error) {
+	var dataKey []byte
+	switch encryption.Provider {
+	case domain.KMSAWS:
+		client, err := kmsClient(ctx, encryption)
+		if err != nil {
+			return nil, err
+		}
+		out, err := client.Decrypt(ctx, &kms.DecryptInput{KeyId: aws.String(encryption.Key), CiphertextBlob: wrapped})
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap the data key with %s: %w", encryption, err)
+		}
+		dataKey = out.Plaintext
+
+	case domain.KMSGCP:
+		var plain bytes.Buffer
+		err := runLocal(bytes.NewReader(wrapped), &plain,
+			"gcloud", "kms", "decrypt", "--key", encryption.Key, "--ciphertext-file", "-", "--plaintext-file", "-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap the data key with %s: %w", encryption, err)
+		}
+		dataKey = plain.Bytes()
+
+	case domain.KMSVault:
+		var response struct {
+			Data struct {
+				Plaintext string `json:"plaintext"`
+			} `json:"data"`
+		}
+		err := vaultTransit(ctx, encryption, "decrypt", map[string]string{"ciphertext": string(wrapped)}, &response)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap the data key with %s: %w", encryption, err)
+		}
+		if dataKey, err = base64.StdEncoding.DecodeString(response.Data.Plaintext); err != nil {
+			return nil, fmt.Errorf("vault returned an invalid data key: %w", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown KMS provider %q", encryption.Provider)
+	}
+
+	if len(dataKey) != dataKeySize {
+		return nil, fmt.Errorf("%s returned a data key of %d bytes, expected %d", encryption, len(dataKey), dataKeySize)
+	}
+	return dataKey, nil
+}
+
+// kmsClient returns an AWS KMS client using the AWS SDK's default credential chain, as rdsClient does
+func kmsClient(ctx context.Context, encryption domain.Encryption) (*kms.Client, error) {
+	var options []func(*awsconfig.LoadOptions) error
+	if encryption.Region != "" {
+		options = append(options, awsconfig.WithRegion(encryption.Region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("no AWS region configured; set encryption.region")
+	}
+	return kms.NewFromConfig(cfg), nil
+}
+
+// vaultTransit posts request to an operation of Vault's transit engine for the key of
+// encryption and decodes the reply into response. The token is read from VAULT_TOKEN or
+// ~/.vault-token, as the vault CLI does, and VAULT_NAMESPACE is honoured.
+func vaultTransit(ctx context.Context, encryption domain.Encryption, operation string, request, response any) error {
+	address := valueOrEnv(encryption.Address, "VAULT_ADDR")
+	if address == "" {
+		return fmt.Errorf("no Vault address; set encryption.address or VAULT_ADDR")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if content, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				token = strings.TrimSpace(string(content))
+			}
+		}
+	}
+	if token == "" {
+		return fmt.Errorf("no Vault token; set VAULT_TOKEN or log in with the vault CLI")
+	}
+	mount := encryption.Mount
+	if mount == "" {
+		mount = "transit"
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, vaultTimeout)
+	defer cancel()
+	endpoint := fmt.Sprintf("%s/v1/%s/%s/%s", strings.TrimSuffix(address, "/"), strings.Trim(mount, "/"), operation, url.PathEscape(encryption.Key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set("Content-Type", "application/json")
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&failure)
+		if len(failure.Errors) > 0 {
+			return fmt.Errorf("vault replied %s: %s", resp.Status, strings.Join(failure.Errors, "; "))
+		}
+		return fmt.Errorf("vault replied %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// valueOrEnv returns value, or the environment variable name if value is empty
+func valueOrEnv(value, name string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(name)
+}
@@ -0,0 +1,351 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+var registerOnce sync.Once
+
+// RegisterEngines registers the built-in database engines with the domain registry. They
+// share one client pool, so each runtime is only connected to once.
+func RegisterEngines() {
+	registerOnce.Do(func() {
+		pool := newClientPool()
+		tools := engineTools{
+			backup:  &BackupRepositoryImpl{clientPool: pool},
+			restore: &RestoreRepositoryImpl{clientPool: pool},
+		}
+
+		domain.RegisterEngine(&postgresEngine{tools})
+		domain.RegisterEngine(&mysqlEngine{tools})
+		domain.RegisterEngine(&mariadbEngine{tools})
+		domain.RegisterEngine(&mongodbEngine{tools})
+		domain.RegisterEngine(&timescaledbEngine{postgresEngine{tools}})
+		domain.RegisterEngine(&influxdbEngine{tools})
+		domain.RegisterEngine(&cockroachdbEngine{tools})
+		domain.RegisterEngine(&yugabytedbEngine{tools})
+		domain.RegisterEngine(&neo4jEngine{tools})
+		domain.RegisterEngine(&etcdEngine{tools})
+		domain.RegisterEngine(&rabbitMQEngine{tools})
+	})
+}
+
+// imageFor returns the image holding the client tools of the database's engine and version
+func imageFor(config domain.DatabaseConfig) string {
+	if engine, err := domain.LookupEngine(config.Type); err == nil {
+		return engine.Image(config.Version)
+	}
+	return fmt.Sprintf("%s:%s", config.Type, config.Version)
+}
+
+// engineTools runs the client tools of the built-in engines
+type engineTools struct {
+	backup  *BackupRepositoryImpl
+	restore *RestoreRepositoryImpl
+}
+
+// sqlDumpSignature is what mysqldump and mariadb-dump write at the start and end of a dump
+var sqlDumpSignature = dumpSignature{
+	headers:  []string{"MySQL dump", "MariaDB dump"},
+	trailers: []string{"-- Dump completed"},
+}
+
+// postgresEngine backs up PostgreSQL with pg_dump and restores with psql
+type postgresEngine struct{ engineTools }
+
+func (e *postgresEngine) Type() domain.DatabaseType { return domain.DatabaseTypePostgres }
+func (e *postgresEngine) Name() string              { return "PostgreSQL" }
+func (e *postgresEngine) DefaultPort() int          { return 5432 }
+func (e *postgresEngine) Image(version string) string {
+	return fmt.Sprintf("postgres:%s", version)
+}
+
+func (e *postgresEngine) TestedTools() []string {
+	return []string{"pg_dump 12-17", "psql 12-17"}
+}
+
+func (e *postgresEngine) Dump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
+	return e.backup.backupPostgres(config, method, backupPath, namespace)
+}
+
+func (e *postgresEngine) Restore(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	return e.restore.restorePostgres(config, method, backupPath, namespace)
+}
+
+func (e *postgresEngine) Verify(backupPath string) error {
+	return validateSQLDump(backupPath, dumpSignature{
+		headers:  []string{"PGDMP", "PostgreSQL database dump"},
+		trailers: []string{"PostgreSQL database dump complete"},
+	})
+}
+
+// mysqlEngine backs up MySQL with mysqldump and restores with the mysql client
+type mysqlEngine struct{ engineTools }
+
+func (e *mysqlEngine) Type() domain.DatabaseType { return domain.DatabaseTypeMySQL }
+func (e *mysqlEngine) Name() string              { return "MySQL" }
+func (e *mysqlEngine) DefaultPort() int          { return 3306 }
+func (e *mysqlEngine) Image(version string) string {
+	return fmt.Sprintf("mysql:%s", version)
+}
+
+func (e *mysqlEngine) TestedTools() []string {
+	return []string{"mysqldump 8.0-8.4", "mysql 8.0-8.4"}
+}
+
+func (e *mysqlEngine) Dump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
+	return e.backup.backupMySQL(config, method, backupPath, namespace)
+}
+
+func (e *mysqlEngine) Restore(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	return e.restore.restoreMySQL(config, method, backupPath, namespace)
+}
+
+func (e *mysqlEngine) Verify(backupPath string) error {
+	return validateSQLDump(backupPath, sqlDumpSignature)
+}
+
+// mariadbEngine backs up MariaDB with mysqldump or, for physical backups, mariabackup
+type mariadbEngine struct{ engineTools }
+
+func (e *mariadbEngine) Type() domain.DatabaseType { return domain.DatabaseTypeMariaDB }
+func (e *mariadbEngine) Name() string              { return "MariaDB" }
+func (e *mariadbEngine) DefaultPort() int          { return 3306 }
+func (e *mariadbEngine) Image(version string) string {
+	return fmt.Sprintf("mariadb:%s", version)
+}
+
+func (e *mariadbEngine) TestedTools() []string {
+	return []string{"mariadb-dump 10.6-11.4", "mariadb 10.6-11.4", "mariabackup 10.6-11.4"}
+}
+
+func (e *mariadbEngine) Dump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
+	return e.backup.backupMariaDB(config, method, backupPath, namespace)
+}
+
+// Restore loads a logical dump; physical backups are prepared with PrepareMariaDB instead
+func (e *mariadbEngine) Restore(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	if domain.IsPhysicalBackup(backupPath) {
+		return fmt.Errorf("%s is a physical backup, which has to be prepared rather than loaded", backupPath)
+	}
+	return e.restore.restoreMariaDB(config, method, backupPath, namespace)
+}
+
+func (e *mariadbEngine) Verify(backupPath string) error {
+	if domain.IsPhysicalBackup(backupPath) {
+		return validateXbstream(backupPath)
+	}
+	return validateSQLDump(backupPath, sqlDumpSignature)
+}
+
+// mongodbEngine backs up MongoDB with mongodump and restores with mongorestore
+type mongodbEngine struct{ engineTools }
+
+func (e *mongodbEngine) Type() domain.DatabaseType { return domain.DatabaseTypeMongoDB }
+func (e *mongodbEngine) Name() string              { return "MongoDB" }
+func (e *mongodbEngine) DefaultPort() int          { return 27017 }
+func (e *mongodbEngine) Image(version string) string {
+	return fmt.Sprintf("mongo:%s", version)
+}
+
+func (e *mongodbEngine) TestedTools() []string {
+	return []string{"mongodump 100.9", "mongorestore 100.9", "MongoDB 5.0-7.0"}
+}
+
+func (e *mongodbEngine) Dump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
+	return e.backup.backupMongoDB(config, method, backupPath, namespace)
+}
+
+func (e *mongodbEngine) Restore(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	return e.restore.restoreMongoDB(config, method, backupPath, sourceDatabase, namespace, tempDir)
+}
+
+func (e *mongodbEngine) Verify(backupPath string) error {
+	if domain.IsOplogBackup(backupPath) {
+		return validateOplogDump(backupPath)
+	}
+	if info, err := os.Stat(backupPath); err == nil && !info.IsDir() {
+		return validateMongoArchive(backupPath)
+	}
+	return validateMongoDump(backupPath)
+}
+
+// timescaledbEngine backs up TimescaleDB like PostgreSQL. Restores switch the extension into
+// its restoring mode, so hypertables come back with their chunks intact.
+type timescaledbEngine struct{ postgresEngine }
+
+func (e *timescaledbEngine) Type() domain.DatabaseType { return domain.DatabaseTypeTimescaleDB }
+func (e *timescaledbEngine) Name() string              { return "TimescaleDB" }
+func (e *timescaledbEngine) Image(version string) string {
+	return fmt.Sprintf("timescale/timescaledb:%s", version)
+}
+
+func (e *timescaledbEngine) TestedTools() []string {
+	return []string{"pg_dump 14-17", "psql 14-17", "TimescaleDB 2.13-2.17"}
+}
+
+// influxdbEngine backs up InfluxDB with influx backup, or influxd backup for 1.x
+type influxdbEngine struct{ engineTools }
+
+func (e *influxdbEngine) Type() domain.DatabaseType { return domain.DatabaseTypeInfluxDB }
+func (e *influxdbEngine) Name() string              { return "InfluxDB" }
+func (e *influxdbEngine) DefaultPort() int          { return 8086 }
+func (e *influxdbEngine) Image(version string) string {
+	return fmt.Sprintf("influxdb:%s", version)
+}
+
+func (e *influxdbEngine) TestedTools() []string {
+	return []string{"influx 2.7"}
+}
+
+func (e *influxdbEngine) Dump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
+	return e.backup.backupInfluxDB(config, method, backupPath, namespace)
+}
+
+func (e *influxdbEngine) Restore(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	return e.restore.restoreInfluxDB(config, method, backupPath, sourceDatabase, namespace)
+}
+
+func (e *influxdbEngine) Verify(backupPath string) error {
+	return validateManifestArchive(backupPath, influxManifest)
+}
+
+// cockroachdbEngine backs up CockroachDB with BACKUP and RESTORE through userfile storage
+type cockroachdbEngine struct{ engineTools }
+
+func (e *cockroachdbEngine) Type() domain.DatabaseType { return domain.DatabaseTypeCockroachDB }
+func (e *cockroachdbEngine) Name() string              { return "CockroachDB" }
+func (e *cockroachdbEngine) DefaultPort() int          { return 26257 }
+func (e *cockroachdbEngine) Image(version string) string {
+	return fmt.Sprintf("cockroachdb/cockroach:%s", version)
+}
+
+func (e *cockroachdbEngine) TestedTools() []string {
+	return []string{"cockroach 23.1-24.2"}
+}
+
+func (e *cockroachdbEngine) Dump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
+	return e.backup.backupCockroachDB(config, method, backupPath, namespace)
+}
+
+func (e *cockroachdbEngine) Restore(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	return e.restore.restoreCockroachDB(config, method, backupPath, sourceDatabase, namespace)
+}
+
+func (e *cockroachdbEngine) Verify(backupPath string) error {
+	return validateManifestArchive(backupPath, cockroachManifest)
+}
+
+// yugabytedbEngine backs up YugabyteDB's YSQL API with ysql_dump and restores with ysqlsh
+type yugabytedbEngine struct{ engineTools }
+
+func (e *yugabytedbEngine) Type() domain.DatabaseType { return domain.DatabaseTypeYugabyteDB }
+func (e *yugabytedbEngine) Name() string              { return "YugabyteDB" }
+func (e *yugabytedbEngine) DefaultPort() int          { return 5433 }
+func (e *yugabytedbEngine) Image(version string) string {
+	return fmt.Sprintf("yugabytedb/yugabyte:%s", version)
+}
+
+func (e *yugabytedbEngine) TestedTools() []string {
+	return []string{"ysql_dump 2.18-2.20", "ysqlsh 2.18-2.20"}
+}
+
+func (e *yugabytedbEngine) Dump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
+	return e.backup.backupYugabyteDB(config, method, backupPath, namespace)
+}
+
+func (e *yugabytedbEngine) Restore(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	return e.restore.restoreYugabyteDB(config, method, backupPath, namespace)
+}
+
+// Verify accepts the header of either, as ysql_dump only renames some of pg_dump's comments
+func (e *yugabytedbEngine) Verify(backupPath string) error {
+	return validateSQLDump(backupPath, dumpSignature{
+		headers:  []string{"YSQL database dump", "PostgreSQL database dump"},
+		trailers: []string{"YSQL database dump complete", "PostgreSQL database dump complete"},
+	})
+}
+
+// neo4jEngine backs up Neo4j with neo4j-admin database dump or, online, database backup
+type neo4jEngine struct{ engineTools }
+
+func (e *neo4jEngine) Type() domain.DatabaseType { return domain.DatabaseTypeNeo4j }
+func (e *neo4jEngine) Name() string              { return "Neo4j" }
+func (e *neo4jEngine) DefaultPort() int          { return 7687 }
+func (e *neo4jEngine) Image(version string) string {
+	return fmt.Sprintf("neo4j:%s", version)
+}
+
+func (e *neo4jEngine) TestedTools() []string {
+	return []string{"neo4j-admin 5.x"}
+}
+
+func (e *neo4jEngine) Dump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
+	return e.backup.backupNeo4j(config, method, backupPath, namespace)
+}
+
+func (e *neo4jEngine) Restore(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	return e.restore.restoreNeo4j(config, method, backupPath, sourceDatabase, namespace)
+}
+
+func (e *neo4jEngine) Verify(backupPath string) error {
+	return validateNeo4jBackup(backupPath)
+}
+
+// etcdEngine snapshots an etcd member over its client API
+type etcdEngine struct{ engineTools }
+
+func (e *etcdEngine) Type() domain.DatabaseType { return domain.DatabaseTypeEtcd }
+func (e *etcdEngine) Name() string              { return "etcd" }
+func (e *etcdEngine) DefaultPort() int          { return 2379 }
+func (e *etcdEngine) Image(version string) string {
+	return fmt.Sprintf("registry.k8s.io/etcd:%s", version)
+}
+
+func (e *etcdEngine) TestedTools() []string {
+	return []string{"etcd API 3.5"}
+}
+
+func (e *etcdEngine) Dump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
+	return e.backup.backupEtcd(config, backupPath)
+}
+
+// Restore refuses: a snapshot is restored into a new data directory on every member, which
+// then has to be restarted on it, so it is left to the cluster's operator
+func (e *etcdEngine) Restore(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	return fmt.Errorf("etcd snapshots are restored on each member by hand: gunzip the snapshot, run etcdutl snapshot restore with a new --data-dir and restart the member on it")
+}
+
+func (e *etcdEngine) Verify(backupPath string) error {
+	return validateEtcdSnapshot(backupPath)
+}
+
+// rabbitMQEngine exports and imports RabbitMQ definitions over the management API
+type rabbitMQEngine struct{ engineTools }
+
+func (e *rabbitMQEngine) Type() domain.DatabaseType { return domain.DatabaseTypeRabbitMQ }
+func (e *rabbitMQEngine) Name() string              { return "RabbitMQ" }
+func (e *rabbitMQEngine) DefaultPort() int          { return 15672 }
+func (e *rabbitMQEngine) Image(version string) string {
+	return fmt.Sprintf("rabbitmq:%s", version)
+}
+
+func (e *rabbitMQEngine) TestedTools() []string {
+	return []string{"RabbitMQ management API 3.12-3.13"}
+}
+
+func (e *rabbitMQEngine) Dump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
+	return e.backup.backupRabbitMQ(config, backupPath)
+}
+
+func (e *rabbitMQEngine) Restore(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	return e.restore.restoreRabbitMQ(config, backupPath)
+}
+
+func (e *rabbitMQEngine) Verify(backupPath string) error {
+	return validateRabbitMQDefinitions(backupPath)
+}
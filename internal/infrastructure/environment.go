@@ -0,0 +1,69 @@
+package infrastructure
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// envLine matches the start of a variable in env output; other lines continue a multi-line value
+var envLine = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// ReadEnvironment returns the environment variables of the database's container or pod,
+// where the official images keep the credentials they were started with
+func (r *BackupRepositoryImpl) ReadEnvironment(config domain.DatabaseConfig, method domain.BackupMethod, namespace string) (map[string]string, error) {
+	var out bytes.Buffer
+	command := []string{"env"}
+
+	var err error
+	switch method {
+	case domain.BackupMethodDockerExec:
+		err = r.execContainer(config.Container, command, nil, &out)
+	case domain.BackupMethodKubectlExec:
+		err = r.execPod(config, namespace, command, nil, &out)
+	default:
+		return nil, fmt.Errorf("%s has no running container to read the environment of", method)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environment: %w", err)
+	}
+
+	env := make(map[string]string)
+	var last string
+	for _, line := range strings.Split(strings.TrimRight(out.String(), "\n"), "\n") {
+		if !envLine.MatchString(line) {
+			if last != "" {
+				env[last] += "\n" + line
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		env[key] = value
+		last = key
+	}
+	return env, nil
+}
+
+// ListWorkloads returns the running containers, or the running pods in namespace, that the
+// exec methods can back up a database in
+func (r *BackupRepositoryImpl) ListWorkloads(config domain.DatabaseConfig, method domain.BackupMethod, namespace string) ([]domain.Workload, error) {
+	switch method {
+	case domain.BackupMethodDockerExec:
+		docker, err := r.docker()
+		if err != nil {
+			return nil, err
+		}
+		return docker.Containers(r.ctx)
+
+	case domain.BackupMethodKubectlExec:
+		kube, err := r.kubernetes(config)
+		if err != nil {
+			return nil, err
+		}
+		return kube.RunningPods(r.ctx, namespace)
+	}
+	return nil, fmt.Errorf("%s has no running containers to list", method)
+}
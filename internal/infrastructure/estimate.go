@@ -0,0 +1,151 @@
+package infrastructure
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// EstimateSize asks the database engine roughly how large a dump of config.Database will be.
+// PostgreSQL reports its on-disk size, MySQL/MariaDB their table data and MongoDB its BSON data size.
+func (r *BackupRepositoryImpl) EstimateSize(config domain.DatabaseConfig, method domain.BackupMethod, namespace string) (int64, error) {
+	var image string
+	var command []string
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+
+	switch config.Type {
+	case domain.DatabaseTypePostgres, domain.DatabaseTypeTimescaleDB:
+		image = imageFor(config)
+		command = shellCommand("%sPGPASSWORD=%s psql -h %s -U %s -d %s -tAc 'SELECT pg_database_size(current_database())'",
+			postgresTLSEnv(config, method), shellQuote(config.Password), shellQuote(host), shellQuote(config.User), shellQuote(config.Database))
+
+	case domain.DatabaseTypeMySQL, domain.DatabaseTypeMariaDB:
+		image = fmt.Sprintf("%s:%s", config.Type, config.Version)
+		// A physical backup copies every database on the server, indexes included
+		query := fmt.Sprintf("SELECT COALESCE(SUM(data_length), 0) FROM information_schema.tables WHERE table_schema = %s", sqlString(config.Database))
+		if config.Physical {
+			query = "SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables"
+		}
+		command = shellCommand("mysql -h %s -u%s -p%s%s -N -B -e %s",
+			shellQuote(host), shellQuote(config.User), shellQuote(config.Password), mysqlTLSFlags(config, method), shellQuote(query))
+
+	case domain.DatabaseTypeMongoDB:
+		image = fmt.Sprintf("mongo:%s", config.Version)
+		command = mongoEvalCommand(config, method, fmt.Sprintf("print(db.getSiblingDB(%s).stats().dataSize)", strconv.Quote(config.Database)))
+
+	default:
+		return 0, fmt.Errorf("unsupported database type: %s", config.Type)
+	}
+
+	var out bytes.Buffer
+
+	var err error
+	switch method {
+	case domain.BackupMethodDockerRun:
+		err = r.runContainer(RunOptions{Image: image, Command: command, Binds: certBinds(config)}, nil, &out)
+	case domain.BackupMethodDockerExec:
+		err = r.execContainer(config.Container, command, nil, &out)
+	case domain.BackupMethodKubectlExec:
+		err = r.execPod(config, namespace, command, nil, &out)
+	case domain.BackupMethodSSH:
+		err = r.execSSH(config, command, nil, &out)
+	default:
+		return 0, fmt.Errorf("unknown backup method: %s", method)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("size query failed: %w", err)
+	}
+
+	// MongoDB may print the size as a double
+	size, err := strconv.ParseFloat(strings.TrimSpace(out.String()), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected size query output %q", strings.TrimSpace(out.String()))
+	}
+	return int64(size), nil
+}
+
+// FreeSpace returns the bytes available on the filesystem that will hold dir.
+// dir does not need to exist yet; its nearest existing parent is checked instead.
+func (r *BackupRepositoryImpl) FreeSpace(dir string) (int64, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	free, err := diskFree(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get free space of %s: %w", dir, err)
+	}
+	return free, nil
+}
+
+// checkTempSpace fails with a LowDiskSpaceError when tempDir in the database's container or pod
+// has less than need bytes free, rather than letting the copy fill it; pods often mount a small
+// tmpfs at /tmp. The copy goes ahead when the free space is unknown.
+func (p *clientPool) checkTempSpace(config domain.DatabaseConfig, method domain.BackupMethod, namespace, tempDir string, need int64) error {
+	free, err := p.containerFreeSpace(config, method, namespace, tempDir)
+	if err != nil || free >= need {
+		return nil
+	}
+
+	where := "container " + config.Container
+	switch method {
+	case domain.BackupMethodKubectlExec:
+		where = "pod " + config.Pod
+	case domain.BackupMethodSSH:
+		where = config.SSHHost
+	}
+	return fmt.Errorf("not enough room to stage the dump, set temp_dir to a larger volume: %w",
+		&domain.LowDiskSpaceError{Dir: tempDir + " in " + where, Free: free, Min: need})
+}
+
+// containerFreeSpace returns the bytes available on the filesystem that will hold dir inside the
+// database's container or pod; like FreeSpace, the nearest existing parent is checked
+func (p *clientPool) containerFreeSpace(config domain.DatabaseConfig, method domain.BackupMethod, namespace, dir string) (int64, error) {
+	command := shellCommand(`d=%s; while [ ! -d "$d" ]; do d=$(dirname "$d"); done; df -Pk "$d" | awk 'NR == 2 { print $4 }'`,
+		shellQuote(dir))
+
+	var out bytes.Buffer
+	if err := p.runClient(config, method, namespace, command, nil, &out); err != nil {
+		return 0, fmt.Errorf("failed to get free space of %s: %w", dir, err)
+	}
+	kilobytes, err := strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected df output %q", strings.TrimSpace(out.String()))
+	}
+	return kilobytes * 1024, nil
+}
+
+// shellCommand formats a script and runs it with sh
+func shellCommand(format string, args ...interface{}) []string {
+	return []string{"sh", "-c", fmt.Sprintf(format, args...)}
+}
+
+// RemoveBackup deletes a failed backup and the directory holding it once that is empty, such as
+// the staging directory
+func (r *BackupRepositoryImpl) RemoveBackup(path string) error {
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	os.Remove(filepath.Dir(path)) // Fails, as intended, while other backups are in it
+	return nil
+}
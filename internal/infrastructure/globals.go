@@ -0,0 +1,70 @@
+package infrastructure
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// dumpPostgresGlobals runs pg_dumpall --globals-only and streams the roles and tablespaces to w
+func (r *BackupRepositoryImpl) dumpPostgresGlobals(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, w io.Writer) error {
+	script := "pg_dumpall -h %s -U %s --globals-only"
+	// Managed services keep the role passwords in pg_authid from every account
+	if config.Managed != nil {
+		script += " --no-role-passwords"
+	}
+	return runPostgresScript(r.clientPool, config, method, namespace, script, nil, w)
+}
+
+// loadPostgresGlobals runs the globals read from in against the postgres database. Roles that
+// already exist only produce errors on stderr, so psql is not stopped on errors.
+func (r *RestoreRepositoryImpl) loadPostgresGlobals(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, in io.Reader) error {
+	return runPostgresScript(r.clientPool, config, method, namespace, "psql -h %s -U %s -d postgres -q", in, io.Discard)
+}
+
+// runPostgresScript runs a PostgreSQL client command, formatted with the host and user, where the
+// backup method reaches the server
+func runPostgresScript(pool *clientPool, config domain.DatabaseConfig, method domain.BackupMethod, namespace, format string, in io.Reader, out io.Writer) error {
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+	command := []string{"sh", "-c", fmt.Sprintf("%sPGPASSWORD=%s ", postgresTLSEnv(config, method), shellQuote(config.Password)) +
+		fmt.Sprintf(format, shellQuote(host), shellQuote(config.User))}
+
+	switch method {
+	case domain.BackupMethodDockerRun:
+		if err := pool.runContainer(RunOptions{Image: imageFor(config), Command: command, Binds: certBinds(config)}, in, out); err != nil {
+			return fmt.Errorf("docker run failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodDockerExec:
+		if err := pool.execContainer(config.Container, command, in, out); err != nil {
+			return fmt.Errorf("docker exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodKubectlExec:
+		if err := pool.execPod(config, namespace, command, in, out); err != nil {
+			return fmt.Errorf("pod exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodSSH:
+		if err := pool.execSSH(config, command, in, out); err != nil {
+			return fmt.Errorf("ssh exec failed: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown backup method: %s", method)
+}
+
+// fileExists reports whether path is an existing regular file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
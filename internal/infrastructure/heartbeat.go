@@ -0,0 +1,67 @@
+package infrastructure
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+const (
+	// heartbeatAttempts covers a brief network hiccup without holding up the run for long
+	heartbeatAttempts = 3
+
+	// maxHeartbeatMessage stays below the body size monitoring services accept
+	maxHeartbeatMessage = 10 * 1024
+)
+
+// HeartbeatRepositoryImpl implements domain.HeartbeatRepository over HTTP
+type HeartbeatRepositoryImpl struct {
+	client *http.Client
+}
+
+// NewHeartbeatRepository creates a new heartbeat repository
+func NewHeartbeatRepository() domain.HeartbeatRepository {
+	return &HeartbeatRepositoryImpl{
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Ping POSTs message to url, retrying a few times on errors
+func (r *HeartbeatRepositoryImpl) Ping(url, message string) error {
+	if len(message) > maxHeartbeatMessage {
+		message = message[:maxHeartbeatMessage]
+	}
+
+	var err error
+	for attempt := 1; attempt <= heartbeatAttempts; attempt++ {
+		if err = r.ping(url, message); err == nil {
+			return nil
+		}
+		if attempt < heartbeatAttempts {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+	return err
+}
+
+func (r *HeartbeatRepositoryImpl) ping(url, message string) error {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(message))
+	if err != nil {
+		return fmt.Errorf("invalid heartbeat URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", "backup-tool")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("heartbeat ping failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("heartbeat ping failed: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package infrastructure
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// BackupHostSnapshot quiesces the database, takes a ZFS or LVM snapshot of the volume holding
+// its data and archives the snapshot's files with tar. The database only waits for the
+// snapshot itself; the archive is read from the snapshot while it keeps running. The volume
+// lives on this machine, so the tool has to run there with the rights to snapshot and mount.
+func (r *BackupRepositoryImpl) BackupHostSnapshot(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	if method == domain.BackupMethodKubectlExec || method == domain.BackupMethodSSH {
+		return fmt.Errorf("host snapshots need %s or %s on the database's machine", domain.BackupMethodDockerRun, domain.BackupMethodDockerExec)
+	}
+
+	snapshot := hostSnapshot{options: *config.HostSnapshot, name: "backup-tool-" + snapshotName(backupPath)}
+	if err := r.quiesce(config, method, namespace, snapshot.create); err != nil {
+		snapshot.destroy()
+		return err
+	}
+	defer snapshot.destroy()
+
+	dir, unmount, err := snapshot.mount()
+	if err != nil {
+		return err
+	}
+	defer unmount()
+	if snapshot.options.Path != "" {
+		dir = filepath.Join(dir, snapshot.options.Path)
+	}
+
+	// GNU tar keeps owners, permissions and symlinks, which a data directory needs
+	command := niceCommand(config.Limits, []string{"tar", "--numeric-owner", "-C", dir, "-cf", "-", "."})
+	return writeToFile(backupPath, config, func(w io.Writer) error {
+		return runLocal(nil, limitWriter(w, config.Limits.BytesPerSecond), command...)
+	})
+}
+
+// ExtractHostSnapshot unpacks the archive of a ZFS or LVM snapshot into <name>.restored next to
+// it. Owners are kept when running as root, so the directory can replace the data directory.
+func (r *RestoreRepositoryImpl) ExtractHostSnapshot(backupPath string) (string, error) {
+	name := strings.TrimSuffix(domain.TrimCompressedExt(backupPath), domain.HostSnapshotExt)
+	dir := name + ".restored"
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	err := readFromFile(backupPath, func(in io.Reader) error {
+		return runLocal(in, io.Discard, "tar", "--numeric-owner", "--same-permissions", "-C", dir, "-xf", "-")
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// hostSnapshot is a ZFS or LVM snapshot taken for one backup
+type hostSnapshot struct {
+	options domain.HostSnapshotOptions
+	name    string
+}
+
+// create takes the snapshot; it is called while the database is quiesced
+func (s hostSnapshot) create() error {
+	switch s.options.Kind {
+	case domain.HostSnapshotZFS:
+		return runLocal(nil, io.Discard, "zfs", "snapshot", s.options.Volume+"@"+s.name)
+	case domain.HostSnapshotLVM:
+		size := s.options.Size
+		if size == "" {
+			size = domain.DefaultLVMSnapshotSize
+		}
+		return runLocal(nil, io.Discard, "lvcreate", "--snapshot", "--name", s.name, "--size", size, s.volume())
+	}
+	return fmt.Errorf("unknown snapshot type %q", s.options.Kind)
+}
+
+// destroy removes the snapshot, if it was taken
+func (s hostSnapshot) destroy() error {
+	switch s.options.Kind {
+	case domain.HostSnapshotZFS:
+		return runLocal(nil, io.Discard, "zfs", "destroy", s.options.Volume+"@"+s.name)
+	case domain.HostSnapshotLVM:
+		return runLocal(nil, io.Discard, "lvremove", "--force", path.Join(path.Dir(s.volume()), s.name))
+	}
+	return nil
+}
+
+// mount makes the snapshot's files readable and returns their directory. ZFS exposes snapshots
+// under the dataset's .zfs directory; LVM snapshots are mounted read-only in a temporary directory.
+func (s hostSnapshot) mount() (string, func(), error) {
+	if s.options.Kind == domain.HostSnapshotZFS {
+		var out bytes.Buffer
+		if err := runLocal(nil, &out, "zfs", "get", "-H", "-o", "value", "mountpoint", s.options.Volume); err != nil {
+			return "", nil, err
+		}
+		mountpoint := strings.TrimSpace(out.String())
+		if !filepath.IsAbs(mountpoint) {
+			return "", nil, fmt.Errorf("dataset %s is not mounted (mountpoint %s)", s.options.Volume, mountpoint)
+		}
+		return filepath.Join(mountpoint, ".zfs", "snapshot", s.name), func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", s.name)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create mount point: %w", err)
+	}
+	device := "/dev/" + path.Join(path.Dir(s.volume()), s.name)
+	err = runLocal(nil, io.Discard, "mount", "-o", "ro", device, dir)
+	if err != nil {
+		// XFS refuses a second filesystem with the UUID of the mounted origin unless told to
+		err = runLocal(nil, io.Discard, "mount", "-o", "ro,nouuid", device, dir)
+	}
+	if err != nil {
+		os.Remove(dir)
+		return "", nil, err
+	}
+	return dir, func() {
+		runLocal(nil, io.Discard, "umount", dir)
+		os.Remove(dir)
+	}, nil
+}
+
+// volume returns the LVM volume as vg/lv, also when given as /dev/vg/lv
+func (s hostSnapshot) volume() string {
+	return strings.TrimPrefix(s.options.Volume, "/dev/")
+}
+
+// runLocal runs a command on this machine, streaming stdin to it and its output to stdout
+func runLocal(stdin io.Reader, stdout io.Writer, command ...string) error {
+	logCommand("host", command)
+	var stderr stderrBuffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stderr.wrap(fmt.Errorf("%s failed: %w", command[0], err))
+	}
+	return nil
+}
+
+// validateHostSnapshot checks that an archive of a ZFS or LVM snapshot starts with a tar header
+func validateHostSnapshot(backupPath string) error {
+	f, err := os.Open(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	r, err := decompressed(f)
+	if err != nil {
+		return fmt.Errorf("archive is not valid gzip: %w", err)
+	}
+	defer r.Close()
+	if _, err := tar.NewReader(r).Next(); err != nil {
+		return fmt.Errorf("file is not a tar archive: %w", err)
+	}
+	return nil
+}
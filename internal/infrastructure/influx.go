@@ -0,0 +1,119 @@
+package infrastructure
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// influxRPCPort is where InfluxDB 1.x serves backups and restores
+const influxRPCPort = 8088
+
+// influxManifest ends the name of the file influx backup and influxd backup -portable write last
+const influxManifest = ".manifest"
+
+// backupInfluxDB runs influx backup (2.x) or influxd backup -portable (1.x) into a temporary
+// directory next to the database and streams the files it wrote as a tar archive to backupPath
+func (r *BackupRepositoryImpl) backupInfluxDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+	script := fmt.Sprintf(`d=$(mktemp -d) && %s "$d" >&2 && tar -C "$d" -cf - .; s=$?; rm -rf "$d"; exit $s`,
+		influxBackupCommand(config, host))
+
+	return writeToFile(backupPath, config, func(w io.Writer) error {
+		w = limitWriter(w, config.Limits.BytesPerSecond)
+		command := niceCommand(config.Limits, []string{"sh", "-c", script})
+
+		switch method {
+		case domain.BackupMethodDockerRun:
+			if err := r.runContainer(runOptions(config.Limits, imageFor(config), command, nil, nil), nil, w); err != nil {
+				return fmt.Errorf("docker run failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodDockerExec:
+			if err := r.streamContainer(config.Container, command, w); err != nil {
+				return fmt.Errorf("docker exec failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodKubectlExec:
+			if err := r.streamPod(config, namespace, command, w); err != nil {
+				return fmt.Errorf("pod exec failed: %w", err)
+			}
+			return nil
+		}
+		return fmt.Errorf("unknown backup method: %s", method)
+	})
+}
+
+// restoreInfluxDB unpacks an InfluxDB backup next to the database and restores sourceDatabase
+// from it into config.Database. InfluxDB refuses to restore into a bucket or database that
+// already exists.
+func (r *RestoreRepositoryImpl) restoreInfluxDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace string) error {
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+	if sourceDatabase == "" {
+		sourceDatabase = config.Database
+	}
+	script := fmt.Sprintf(`d=$(mktemp -d) && tar -xf - -C "$d" && %s "$d"; s=$?; rm -rf "$d"; exit $s`,
+		influxRestoreCommand(config, host, sourceDatabase))
+
+	return readFromFile(backupPath, func(in io.Reader) error {
+		return r.runClient(config, method, namespace, []string{"sh", "-c", script}, in, io.Discard)
+	})
+}
+
+// influxBackupCommand returns the backup command of the InfluxDB version, without its target directory
+func influxBackupCommand(config domain.DatabaseConfig, host string) string {
+	if config.IsInfluxV1() {
+		return fmt.Sprintf("influxd backup -portable -host %s -database %s",
+			shellQuote(fmt.Sprintf("%s:%d", host, influxRPCPort)), shellQuote(config.Database))
+	}
+	return fmt.Sprintf("influx backup %s --bucket %s", influxArgs(config, host), shellQuote(config.Database))
+}
+
+// influxRestoreCommand returns the restore command of the InfluxDB version, without its source directory
+func influxRestoreCommand(config domain.DatabaseConfig, host, sourceDatabase string) string {
+	if config.IsInfluxV1() {
+		command := fmt.Sprintf("influxd restore -portable -host %s -db %s",
+			shellQuote(fmt.Sprintf("%s:%d", host, influxRPCPort)), shellQuote(sourceDatabase))
+		if sourceDatabase != config.Database {
+			command += " -newdb " + shellQuote(config.Database)
+		}
+		return command
+	}
+
+	command := fmt.Sprintf("influx restore %s --bucket %s", influxArgs(config, host), shellQuote(sourceDatabase))
+	if sourceDatabase != config.Database {
+		command += " --new-bucket " + shellQuote(config.Database)
+	}
+	return command
+}
+
+// influxArgs connects the influx 2.x CLI to the server with the token and organization
+func influxArgs(config domain.DatabaseConfig, host string) string {
+	if !strings.Contains(host, "://") {
+		port := config.Port
+		if port == 0 {
+			port = 8086
+		}
+		host = "http://" + host + ":" + strconv.Itoa(port)
+	}
+
+	args := "--host " + shellQuote(host)
+	if config.Password != "" {
+		args += " --token " + shellQuote(config.Password)
+	}
+	if config.User != "" {
+		args += " --org " + shellQuote(config.User)
+	}
+	return args
+}
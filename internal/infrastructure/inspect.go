@@ -0,0 +1,574 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+var (
+	// pgVersionLine matches "-- Dumped from database version 16.2" and "-- Dumped by pg_dump version 16.2"
+	pgVersionLine = regexp.MustCompile(`^-- Dumped (from database|by pg_dump) version (.+)$`)
+	// pgCreateTable matches the start of a table definition in a plain pg_dump
+	pgCreateTable = regexp.MustCompile(`^CREATE (?:UNLOGGED )?TABLE (?:ONLY )?(.+?) \($`)
+
+	// mysqlDumpVersion finds the client version in the first line of a mysqldump or mariadb-dump,
+	// e.g. "-- MySQL dump 10.13  Distrib 8.0.36, for Linux (x86_64)"
+	mysqlDumpVersion = regexp.MustCompile(`Distrib ([^,\s]+)`)
+	mysqlServerLine  = regexp.MustCompile(`^-- Server version\s+(.+)$`)
+	mysqlHostLine    = regexp.MustCompile(`Database: (\S+)`)
+)
+
+// InspectBackup reads an artifact and summarizes what it holds, without a database to load it into
+func (r *BackupRepositoryImpl) InspectBackup(backupPath string) (domain.DumpSummary, error) {
+	summary := domain.DumpSummary{Path: backupPath}
+
+	// An encrypted backup is read from a decrypted copy, still reported under its own path
+	decrypted, err := decryptBackup(r.ctx, backupPath)
+	if err != nil {
+		return summary, err
+	}
+	if decrypted != backupPath {
+		defer os.RemoveAll(filepath.Dir(decrypted))
+		backupPath = decrypted
+	}
+
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		return summary, err
+	}
+	if info.IsDir() {
+		return summary, inspectMongoDirectory(backupPath, &summary)
+	}
+	summary.SizeBytes = info.Size()
+
+	switch {
+	case domain.IsSnapshotBackup(backupPath):
+		record, err := readSnapshotRecord(backupPath)
+		if err != nil {
+			return summary, err
+		}
+		summary.Format = "CSI volume snapshot"
+		summary.Notes = append(summary.Notes,
+			fmt.Sprintf("VolumeSnapshot %s/%s of claim %s, %s", record.Namespace, record.Name, record.PVC, domain.FormatBytes(record.Size)),
+			"The snapshot holds the data directory; it has no table listing")
+		return summary, nil
+	case domain.IsRDSSnapshot(backupPath):
+		record, err := readRDSSnapshotRecord(backupPath)
+		if err != nil {
+			return summary, err
+		}
+		summary.Format = "RDS snapshot"
+		summary.Notes = append(summary.Notes,
+			fmt.Sprintf("Snapshot %s, %s %s, %s", record.ARN, record.Engine, record.EngineVersion, domain.FormatBytes(record.Size)),
+			"The snapshot is kept by RDS; it has no table listing")
+		if record.ExportPath != "" {
+			summary.Notes = append(summary.Notes, fmt.Sprintf("Exported to %s by task %s", record.ExportPath, record.ExportTask))
+		}
+		return summary, nil
+	case domain.IsHostSnapshot(backupPath):
+		summary.Format = "ZFS/LVM snapshot archive"
+		summary.Notes = append(summary.Notes, "The archive holds the data directory; it has no table listing")
+		return summary, validateHostSnapshot(backupPath)
+	case domain.IsPhysicalBackup(backupPath):
+		summary.Format = "mariabackup xbstream"
+		summary.Notes = append(summary.Notes, "The stream holds the data directory; it has no table listing")
+		return summary, validateXbstream(backupPath)
+	case domain.IsInfluxBackup(backupPath):
+		summary.Format = "InfluxDB backup archive"
+		summary.Notes = append(summary.Notes, "The archive holds shard files; it has no table listing")
+		return summary, validateManifestArchive(backupPath, influxManifest)
+	case domain.IsCockroachBackup(backupPath):
+		summary.Format = "CockroachDB backup archive"
+		summary.Notes = append(summary.Notes, "The archive holds SST files; list its tables with SHOW BACKUP once restored to userfile storage")
+		return summary, validateManifestArchive(backupPath, cockroachManifest)
+	case domain.IsEtcdSnapshot(backupPath):
+		summary.Format = "etcd snapshot"
+		summary.Notes = append(summary.Notes, "The snapshot holds the keyspace; inspect it with etcdutl snapshot status")
+		return summary, validateEtcdSnapshot(backupPath)
+	case domain.IsRabbitMQDefinitions(backupPath):
+		return summary, inspectRabbitMQDefinitions(backupPath, &summary)
+	case domain.IsNeo4jBackup(backupPath):
+		summary.Format = "Neo4j backup archive"
+		summary.Notes = append(summary.Notes, "The archive holds a neo4j-admin dump or backup; it has no table listing")
+		return summary, validateNeo4jBackup(backupPath)
+	}
+
+	if f, err := os.Open(backupPath); err == nil {
+		summary.Chunked, _ = isManifest(f)
+		f.Close()
+	}
+	plain, err := openPlain(backupPath)
+	if err != nil {
+		return summary, err
+	}
+	defer plain.Close()
+
+	reader := bufio.NewReader(plain)
+	magic, _ := reader.Peek(len(zstdMagic))
+	switch formatOf(magic) {
+	case gzipExt:
+		summary.Compressed = domain.CompressionGzip
+	case zstdExt:
+		summary.Compressed = domain.CompressionZstd
+	}
+	if summary.Compressed != "" {
+		in, err := decompressed(reader)
+		if err != nil {
+			return summary, fmt.Errorf("failed to decompress: %w", err)
+		}
+		defer in.Close()
+		reader = bufio.NewReader(in)
+	}
+
+	head, _ := reader.Peek(512)
+	switch {
+	case domain.IsOplogBackup(backupPath):
+		return summary, inspectOplog(reader, &summary)
+	case bytes.HasPrefix(head, mongoArchiveMagic):
+		return summary, inspectMongoArchive(reader, &summary)
+	case bytes.HasPrefix(head, []byte("PGDMP")):
+		summary.Format = "pg_dump custom archive"
+		summary.Notes = append(summary.Notes, "List its contents with pg_restore -l")
+		return summary, nil
+	case bytes.Contains(head, []byte("PostgreSQL database dump")), bytes.Contains(head, []byte("YSQL database dump")):
+		return summary, inspectPostgresDump(reader, &summary)
+	case bytes.Contains(head, []byte("MySQL dump")), bytes.Contains(head, []byte("MariaDB dump")):
+		return summary, inspectMySQLDump(reader, &summary)
+	}
+	return summary, fmt.Errorf("not a recognized dump")
+}
+
+// inspectPostgresDump reads the versions, table definitions and COPY blocks of a plain pg_dump
+func inspectPostgresDump(reader *bufio.Reader, summary *domain.DumpSummary) error {
+	summary.Format = "pg_dump plain SQL"
+	index := make(map[string]int)
+	var versions []string
+	var table *domain.TableSummary
+	copying := ""
+
+	err := readLines(reader, func(line string) {
+		switch {
+		case copying != "":
+			if line == `\.` {
+				copying = ""
+			} else if i, ok := index[copying]; ok {
+				summary.Tables[i].Rows++
+			}
+		case table != nil:
+			if strings.HasPrefix(line, ")") {
+				index[table.QualifiedName()] = len(summary.Tables)
+				summary.Tables = append(summary.Tables, *table)
+				table = nil
+			} else if column := strings.TrimSuffix(strings.TrimSpace(line), ","); !strings.HasPrefix(column, "CONSTRAINT ") {
+				table.Columns = append(table.Columns, column)
+			}
+		default:
+			if match := pgVersionLine.FindStringSubmatch(line); match != nil {
+				if match[1] == "by pg_dump" {
+					versions = append([]string{"pg_dump " + match[2]}, versions...)
+				} else {
+					versions = append(versions, "server "+match[2])
+				}
+			} else if match := pgCreateTable.FindStringSubmatch(line); match != nil {
+				schema, name := splitQualified(match[1])
+				table = &domain.TableSummary{Schema: schema, Name: name}
+			} else if match := pgCopyLine.FindStringSubmatch(line); match != nil {
+				schema, name := splitQualified(match[1])
+				copying = domain.TableSummary{Schema: schema, Name: name}.QualifiedName()
+				// Data-only dumps have no definitions
+				if _, ok := index[copying]; !ok {
+					index[copying] = len(summary.Tables)
+					summary.Tables = append(summary.Tables, domain.TableSummary{Schema: schema, Name: name})
+				}
+			}
+		}
+	})
+	summary.Version = strings.Join(versions, ", ")
+	sortTables(summary.Tables)
+	return err
+}
+
+// inspectMySQLDump reads the versions, table definitions and INSERT statements of a mysqldump.
+// Rows are estimated from the value lists of extended inserts.
+func inspectMySQLDump(reader *bufio.Reader, summary *domain.DumpSummary) error {
+	summary.Format = "mysqldump SQL"
+	index := make(map[string]int)
+	var versions []string
+	var table *domain.TableSummary
+
+	err := readLines(reader, func(line string) {
+		if table != nil {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, ")") {
+				index[table.Name] = len(summary.Tables)
+				summary.Tables = append(summary.Tables, *table)
+				table = nil
+			} else if strings.HasPrefix(trimmed, "`") {
+				table.Columns = append(table.Columns, strings.TrimSuffix(trimmed, ","))
+			}
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(line, "-- MySQL dump") || strings.HasPrefix(line, "-- MariaDB dump"):
+			tool := "mysqldump"
+			if strings.HasPrefix(line, "-- MariaDB") {
+				tool = "mariadb-dump"
+				summary.Format = "mariadb-dump SQL"
+			}
+			if match := mysqlDumpVersion.FindStringSubmatch(line); match != nil {
+				versions = append(versions, tool+" "+match[1])
+			}
+		case mysqlServerLine.MatchString(line):
+			versions = append(versions, "server "+mysqlServerLine.FindStringSubmatch(line)[1])
+		case strings.HasPrefix(line, "-- Host:"):
+			if match := mysqlHostLine.FindStringSubmatch(line); match != nil {
+				summary.Database = match[1]
+			}
+		case mysqlCreate.MatchString(line):
+			table = &domain.TableSummary{Name: mysqlCreate.FindStringSubmatch(line)[1]}
+		case mysqlInsert.MatchString(line):
+			if i, ok := index[mysqlInsert.FindStringSubmatch(line)[1]]; ok {
+				summary.Tables[i].Rows += int64(strings.Count(line, "),(")) + 1
+			}
+		}
+	})
+	summary.Version = strings.Join(versions, ", ")
+	return err
+}
+
+// inspectMongoDirectory counts the documents of each collection in a mongodump directory
+func inspectMongoDirectory(backupPath string, summary *domain.DumpSummary) error {
+	summary.Format = "mongodump directory"
+
+	if content, err := os.ReadFile(filepath.Join(backupPath, "prelude.json")); err == nil {
+		var prelude struct {
+			ServerVersion string `json:"ServerVersion"`
+			ToolVersion   string `json:"ToolVersion"`
+		}
+		if json.Unmarshal(content, &prelude) == nil {
+			summary.Version = mongoVersions(prelude.ToolVersion, prelude.ServerVersion)
+		}
+	}
+
+	err := filepath.WalkDir(backupPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			summary.SizeBytes += info.Size()
+		}
+
+		name, gzipped := strings.CutSuffix(d.Name(), gzipExt)
+		name, ok := strings.CutSuffix(name, ".bson")
+		if !ok || strings.HasSuffix(name, ".metadata") {
+			return nil
+		}
+		if gzipped {
+			summary.Compressed = domain.CompressionGzip
+		}
+
+		table := domain.TableSummary{Name: name}
+		if rel, err := filepath.Rel(backupPath, filepath.Dir(path)); err == nil && rel != "." {
+			table.Schema = filepath.ToSlash(rel)
+		}
+		table.Rows, err = countBSONFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		summary.Tables = append(summary.Tables, table)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(summary.Tables) == 1 {
+		summary.Database = summary.Tables[0].Schema
+	}
+	sortTables(summary.Tables)
+	return nil
+}
+
+// inspectMongoArchive reads the prelude of a mongodump archive for the versions and collections,
+// then counts the documents in the namespace blocks that follow
+func inspectMongoArchive(reader *bufio.Reader, summary *domain.DumpSummary) error {
+	summary.Format = "mongodump archive"
+	if _, err := reader.Discard(len(mongoArchiveMagic)); err != nil {
+		return err
+	}
+
+	prelude, err := readBSON(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read archive prelude: %w", err)
+	}
+	fields := bsonStrings(prelude)
+	summary.Version = mongoVersions(fields["tool_version"], fields["server_version"])
+
+	index := make(map[string]int)
+	for {
+		doc, err := readBSON(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read archive prelude: %w", err)
+		}
+		if doc == nil {
+			break
+		}
+		fields := bsonStrings(doc)
+		table := domain.TableSummary{Schema: fields["db"], Name: fields["collection"]}
+		index[table.QualifiedName()] = len(summary.Tables)
+		summary.Tables = append(summary.Tables, table)
+	}
+
+	// Each block is a namespace header, that namespace's documents and a terminator
+	current := -1
+	header := true
+	for {
+		doc, err := readBSON(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			summary.Notes = append(summary.Notes, fmt.Sprintf("Document counts are incomplete: %v", err))
+			break
+		}
+		switch {
+		case doc == nil:
+			header = true
+		case header:
+			fields := bsonStrings(doc)
+			i, ok := index[domain.TableSummary{Schema: fields["db"], Name: fields["collection"]}.QualifiedName()]
+			current = -1
+			if ok {
+				current = i
+			}
+			header = false
+		case current >= 0:
+			summary.Tables[current].Rows++
+		}
+	}
+
+	if databases := tableSchemas(summary.Tables); len(databases) == 1 {
+		summary.Database = databases[0]
+	}
+	sortTables(summary.Tables)
+	return nil
+}
+
+// inspectOplog counts the entries of a differential MongoDB backup by namespace
+func inspectOplog(reader *bufio.Reader, summary *domain.DumpSummary) error {
+	summary.Format = "MongoDB oplog entries"
+	index := make(map[string]int)
+	for {
+		doc, err := readBSON(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("oplog dump is truncated: %w", err)
+		}
+		if doc == nil {
+			continue
+		}
+		schema, name := splitQualified(bsonStrings(doc)["ns"])
+		table := domain.TableSummary{Schema: schema, Name: name}
+		i, ok := index[table.QualifiedName()]
+		if !ok {
+			i = len(summary.Tables)
+			index[table.QualifiedName()] = i
+			summary.Tables = append(summary.Tables, table)
+		}
+		summary.Tables[i].Rows++
+	}
+	summary.Notes = append(summary.Notes, "Rows are oplog entries, replayed onto the full backup")
+	sortTables(summary.Tables)
+	return nil
+}
+
+// readBSON reads the next BSON document, returning nil for the terminator mongodump archives
+// separate their parts with and io.EOF at a clean end of input
+func readBSON(r io.Reader) ([]byte, error) {
+	prefix := make([]byte, 4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(prefix)
+	if length == 0xffffffff {
+		return nil, nil
+	}
+	if length < 5 || length > maxBSONDocument {
+		return nil, fmt.Errorf("invalid BSON document length %d", length)
+	}
+
+	doc := make([]byte, length)
+	copy(doc, prefix)
+	if _, err := io.ReadFull(r, doc[4:]); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return doc, nil
+}
+
+// bsonStrings returns the top-level string fields of a BSON document, skipping the others.
+// Parsing stops at a field type it cannot skip.
+func bsonStrings(doc []byte) map[string]string {
+	fields := make(map[string]string)
+	pos := 4
+	for pos < len(doc)-1 {
+		kind := doc[pos]
+		end := bytes.IndexByte(doc[pos+1:], 0)
+		if end < 0 {
+			break
+		}
+		key := string(doc[pos+1 : pos+1+end])
+		pos += end + 2
+
+		var size int
+		switch kind {
+		case 0x02: // String
+			if pos+4 > len(doc) {
+				return fields
+			}
+			n := int(binary.LittleEndian.Uint32(doc[pos:]))
+			if n < 1 || pos+4+n > len(doc) {
+				return fields
+			}
+			fields[key] = string(doc[pos+4 : pos+4+n-1])
+			size = 4 + n
+		case 0x03, 0x04: // Document, array
+			if pos+4 > len(doc) {
+				return fields
+			}
+			size = int(binary.LittleEndian.Uint32(doc[pos:]))
+		case 0x05: // Binary
+			if pos+4 > len(doc) {
+				return fields
+			}
+			size = 5 + int(binary.LittleEndian.Uint32(doc[pos:]))
+		case 0x01, 0x09, 0x11, 0x12: // Double, date, timestamp, int64
+			size = 8
+		case 0x07: // ObjectId
+			size = 12
+		case 0x08: // Boolean
+			size = 1
+		case 0x0a: // Null
+			size = 0
+		case 0x10: // Int32
+			size = 4
+		case 0x13: // Decimal128
+			size = 16
+		default:
+			return fields
+		}
+		pos += size
+	}
+	return fields
+}
+
+// countBSONFile counts the documents of a collection file in a mongodump directory
+func countBSONFile(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r, err := decompressed(f)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var count int64
+	prefix := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, prefix); errors.Is(err, io.EOF) {
+			return count, nil
+		} else if err != nil {
+			return count, fmt.Errorf("collection file is truncated")
+		}
+		length := int64(binary.LittleEndian.Uint32(prefix))
+		if length < 5 || length > maxBSONDocument {
+			return count, fmt.Errorf("file is not a BSON collection")
+		}
+		if n, err := io.CopyN(io.Discard, r, length-4); err != nil || n != length-4 {
+			return count, fmt.Errorf("collection file is truncated")
+		}
+		count++
+	}
+}
+
+// readLines calls line for each line of reader, without its line ending
+func readLines(reader *bufio.Reader, line func(string)) error {
+	for {
+		text, err := reader.ReadString('\n')
+		if text != "" {
+			line(strings.TrimRight(text, "\r\n"))
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// splitQualified splits schema.name, undoing the quotes around either part
+func splitQualified(qualified string) (string, string) {
+	unquote := func(s string) string { return strings.ReplaceAll(strings.Trim(s, `"`), `""`, `"`) }
+	if strings.HasSuffix(qualified, `"`) {
+		if i := strings.LastIndex(qualified, `."`); i >= 0 {
+			return unquote(qualified[:i]), unquote(qualified[i+1:])
+		}
+	}
+	schema, name, ok := strings.Cut(qualified, ".")
+	if !ok {
+		return "", unquote(qualified)
+	}
+	return unquote(schema), unquote(name)
+}
+
+func mongoVersions(tool, server string) string {
+	var versions []string
+	if tool != "" {
+		versions = append(versions, "mongodump "+tool)
+	}
+	if server != "" {
+		versions = append(versions, "server "+server)
+	}
+	return strings.Join(versions, ", ")
+}
+
+func tableSchemas(tables []domain.TableSummary) []string {
+	seen := make(map[string]bool)
+	var schemas []string
+	for _, table := range tables {
+		if !seen[table.Schema] {
+			seen[table.Schema] = true
+			schemas = append(schemas, table.Schema)
+		}
+	}
+	return schemas
+}
+
+func sortTables(tables []domain.TableSummary) {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].QualifiedName() < tables[j].QualifiedName() })
+}
@@ -0,0 +1,243 @@
+package infrastructure
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// KubernetesClient executes commands in pods and copies files out of them
+// using client-go, so kubectl does not need to be installed
+type KubernetesClient struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface // For VolumeSnapshots, which client-go has no typed client for
+}
+
+// NewKubernetesClient creates a client for the given kubeconfig file and context.
+// Empty values fall back to KUBECONFIG, ~/.kube/config, its current context or the in-cluster config.
+func NewKubernetesClient(kubeconfig, kubeContext string) (*KubernetesClient, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubernetes config: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	return &KubernetesClient{
+		config:    config,
+		clientset: clientset,
+		dynamic:   dynamicClient,
+	}, nil
+}
+
+// Exec runs a command in the first container of a pod, streaming stdin to it and its output to stdout and stderr
+func (c *KubernetesClient) Exec(ctx context.Context, namespace, pod string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	logCommand("pod "+namespace+"/"+pod, command)
+	req := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod).
+		Namespace(namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Command: command,
+			Stdin:   stdin != nil,
+			Stdout:  stdout != nil,
+			Stderr:  stderr != nil,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(c.config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create executor: %w", err)
+	}
+
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+}
+
+// RunningPods lists the running pods in namespace with the image of their first container,
+// which Exec runs commands in
+func (c *KubernetesClient) RunningPods(ctx context.Context, namespace string) ([]domain.Workload, error) {
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{FieldSelector: "status.phase=Running"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods in %s: %w", namespace, err)
+	}
+
+	var workloads []domain.Workload
+	for _, pod := range pods.Items {
+		if len(pod.Spec.Containers) == 0 {
+			continue
+		}
+		workloads = append(workloads, domain.Workload{Name: pod.Name, Image: pod.Spec.Containers[0].Image})
+	}
+	return workloads, nil
+}
+
+// CopyFromPod copies srcPath from a pod into destDir, keeping the base name of srcPath.
+// Like kubectl cp, it requires tar to be available inside the container.
+// bytesPerSecond caps the transfer rate; zero is unlimited.
+func (c *KubernetesClient) CopyFromPod(ctx context.Context, namespace, pod, srcPath, destDir string, bytesPerSecond int64) error {
+	reader, writer := io.Pipe()
+
+	execErr := make(chan error, 1)
+	go func() {
+		var stderr stderrBuffer
+		command := []string{"tar", "cf", "-", "-C", path.Dir(srcPath), path.Base(srcPath)}
+		err := stderr.wrap(c.Exec(ctx, namespace, pod, command, nil, writer, &stderr))
+		writer.CloseWithError(err)
+		execErr <- err
+	}()
+
+	extractErr := extractTar(limitReader(reader, bytesPerSecond), destDir)
+	if extractErr == nil {
+		// Read the padding after the end-of-archive marker so tar can exit with its own status,
+		// which is reported below
+		io.Copy(io.Discard, reader)
+	}
+	// Unblock tar if extracting stopped early
+	reader.Close()
+
+	err := <-execErr
+	if extractErr != nil {
+		return extractErr
+	}
+	// tar exits non-zero on files it could not read, even after writing a complete archive
+	if err != nil {
+		return fmt.Errorf("tar in pod failed: %w", err)
+	}
+	return nil
+}
+
+// CopyToPod copies the local directory srcDir into destDir inside a pod, keeping the base name of srcDir.
+// Like kubectl cp, it requires tar to be available inside the container.
+func (c *KubernetesClient) CopyToPod(ctx context.Context, namespace, pod, srcDir, destDir string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(createTar(srcDir, writer))
+	}()
+	defer reader.Close()
+
+	var stderr stderrBuffer
+	command := []string{"sh", "-c", fmt.Sprintf("mkdir -p %s && tar xf - -C %s", shellQuote(destDir), shellQuote(destDir))}
+	return stderr.wrap(c.Exec(ctx, namespace, pod, command, reader, io.Discard, &stderr))
+}
+
+// createTar writes srcDir, including its base name, as a tar stream
+func createTar(srcDir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	base := filepath.Dir(filepath.Clean(srcDir))
+
+	err := filepath.Walk(srcDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, file)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractTar unpacks a tar stream into destDir, rejecting entries that escape it
+func extractTar(r io.Reader, destDir string) error {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		target := filepath.Join(destDir, filepath.FromSlash(header.Name))
+		if target != filepath.Clean(destDir) && !strings.HasPrefix(target, filepath.Clean(destDir)+string(os.PathSeparator)) {
+			return fmt.Errorf("archive entry %q escapes destination", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
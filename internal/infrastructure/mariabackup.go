@@ -0,0 +1,150 @@
+package infrastructure
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// xbstreamMagic starts every chunk of an xbstream file
+var xbstreamMagic = []byte("XBSTCK01")
+
+// mariabackupBinary picks mariadb-backup, the tool's name since MariaDB 10.5, falling back to mariabackup
+const mariabackupBinary = "B=mariabackup; command -v mariadb-backup >/dev/null 2>&1 && B=mariadb-backup; "
+
+// streamMariaBackup copies the whole server with mariabackup and streams the xbstream to w
+func (r *BackupRepositoryImpl) streamMariaBackup(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, w io.Writer) error {
+	w = limitWriter(w, config.Limits.BytesPerSecond)
+
+	// The stream goes to stdout; --target-dir only holds scratch files
+	command := []string{"sh", "-c", mariabackupBinary + fmt.Sprintf(
+		"exec \"$B\" --backup --stream=xbstream --target-dir=/tmp --user=%s --password=%s",
+		shellQuote(config.User), shellQuote(config.Password))}
+
+	switch method {
+	case domain.BackupMethodDockerExec:
+		if err := r.streamContainer(config.Container, niceCommand(config.Limits, command), w); err != nil {
+			return fmt.Errorf("docker exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodKubectlExec:
+		if err := r.streamPod(config, namespace, niceCommand(config.Limits, command), w); err != nil {
+			return fmt.Errorf("pod exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodSSH:
+		if err := r.streamSSH(config, niceCommand(config.Limits, command), w); err != nil {
+			return fmt.Errorf("ssh exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodDockerRun:
+		return fmt.Errorf("physical backups need docker-exec, kubectl-exec or ssh to reach the data directory")
+	}
+
+	return fmt.Errorf("unknown backup method: %s", method)
+}
+
+// PrepareMariaDB extracts a mariabackup stream with mbstream and runs mariabackup --prepare on it.
+// docker-run prepares into a directory next to the backup on the host; the exec methods and ssh
+// prepare under tempDir in the container, pod or on the database's machine. Copying the result back needs the server stopped, so it is
+// left to the operator.
+func (r *RestoreRepositoryImpl) PrepareMariaDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) (string, error) {
+	name := filepath.Base(backupPath)
+	name = name[:strings.Index(name, domain.PhysicalBackupExt)]
+
+	switch method {
+	case domain.BackupMethodDockerRun:
+		hostDir, err := filepath.Abs(filepath.Join(filepath.Dir(backupPath), name+".prepared"))
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(hostDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create prepare directory: %w", err)
+		}
+
+		err = readFromFile(backupPath, func(in io.Reader) error {
+			return r.runContainer(RunOptions{
+				Image:   fmt.Sprintf("mariadb:%s", config.Version),
+				Command: []string{"sh", "-c", prepareScript("/prepared")},
+				Binds:   []string{fmt.Sprintf("%s:/prepared", hostDir)},
+			}, in, io.Discard)
+		})
+		if err != nil {
+			return "", fmt.Errorf("docker run failed: %w", err)
+		}
+		return hostDir, nil
+
+	case domain.BackupMethodDockerExec:
+		dir := path.Join(tempDir, name+".prepared")
+		err := readFromFile(backupPath, func(in io.Reader) error {
+			return r.execContainer(config.Container, []string{"sh", "-c", prepareScript(dir)}, in, io.Discard)
+		})
+		if err != nil {
+			return "", fmt.Errorf("docker exec failed: %w", err)
+		}
+		return dir, nil
+
+	case domain.BackupMethodKubectlExec:
+		dir := path.Join(tempDir, name+".prepared")
+		err := readFromFile(backupPath, func(in io.Reader) error {
+			return r.execPod(config, namespace, []string{"sh", "-c", prepareScript(dir)}, in, io.Discard)
+		})
+		if err != nil {
+			return "", fmt.Errorf("pod exec failed: %w", err)
+		}
+		return dir, nil
+
+	case domain.BackupMethodSSH:
+		dir := path.Join(tempDir, name+".prepared")
+		err := readFromFile(backupPath, func(in io.Reader) error {
+			return r.execSSH(config, []string{"sh", "-c", prepareScript(dir)}, in, io.Discard)
+		})
+		if err != nil {
+			return "", fmt.Errorf("ssh exec failed: %w", err)
+		}
+		return dir, nil
+	}
+
+	return "", fmt.Errorf("unknown backup method: %s", method)
+}
+
+// prepareScript unpacks the xbstream read from stdin into an emptied dir and prepares it
+func prepareScript(dir string) string {
+	dir = shellQuote(dir)
+	return mariabackupBinary + fmt.Sprintf(
+		"mkdir -p %[1]s && find %[1]s -mindepth 1 -delete && mbstream -x -C %[1]s && \"$B\" --prepare --target-dir=%[1]s",
+		dir)
+}
+
+// validateXbstream checks that a mariabackup stream, gzipped or not, starts with an xbstream chunk
+func validateXbstream(backupPath string) error {
+	f, err := openPlain(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	r, err := decompressed(f)
+	if err != nil {
+		return fmt.Errorf("backup is not valid gzip: %w", err)
+	}
+	defer r.Close()
+
+	header := make([]byte, len(xbstreamMagic))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("backup is empty or truncated")
+	}
+	if !bytes.Equal(header, xbstreamMagic) {
+		return fmt.Errorf("file is not an xbstream")
+	}
+	return nil
+}
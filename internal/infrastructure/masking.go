@@ -0,0 +1,319 @@
+package infrastructure
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// rowPlaceholder in a column rule's replacement is expanded to the row number, so masked
+// values in unique columns stay unique
+const rowPlaceholder = "{row}"
+
+var (
+	pgCopyLine     = regexp.MustCompile(`^COPY ([^ ]+) \((.*)\) FROM stdin;$`)
+	mysqlInsert    = regexp.MustCompile("^INSERT INTO `([^`]+)`(?: \\(([^)]*)\\))? VALUES ")
+	mysqlCreate    = regexp.MustCompile("^CREATE TABLE `([^`]+)` \\($")
+	mysqlColumnDef = regexp.MustCompile("^  `([^`]+)` ")
+)
+
+// maskDump runs dump with its output passed through the database's masking rules on the way to w
+func maskDump(config domain.DatabaseConfig, w io.Writer, dump func(w io.Writer) error) error {
+	if len(config.Masking) == 0 {
+		return dump(w)
+	}
+
+	masker, err := newMaskingWriter(w, config.Type, config.Masking)
+	if err != nil {
+		return err
+	}
+
+	err = dump(masker)
+	if closeErr := masker.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type columnRule struct {
+	column      string
+	replacement string
+}
+
+// maskingWriter rewrites a plain SQL dump line by line. Column rules replace values in
+// PostgreSQL COPY blocks and MySQL/MariaDB INSERT statements; pattern rules apply to every line.
+type maskingWriter struct {
+	out      io.Writer
+	dbType   domain.DatabaseType
+	columns  map[string][]columnRule // by unqualified table name
+	patterns []*regexp.Regexp
+	replaces []string
+	pending  []byte
+
+	// PostgreSQL: the COPY block being read, if any
+	copyTable string
+	copyMasks map[int]columnRule
+	inCopy    bool
+
+	// MySQL/MariaDB: column order from CREATE TABLE, by table
+	tableColumns map[string][]string
+	createTable  string
+
+	rows map[string]int
+}
+
+func newMaskingWriter(out io.Writer, dbType domain.DatabaseType, rules []domain.MaskingRule) (*maskingWriter, error) {
+	if !dbType.DumpsSQL() {
+		return nil, fmt.Errorf("masking is only supported for SQL dumps")
+	}
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("masking[%d]: %w", i, err)
+		}
+	}
+
+	m := &maskingWriter{
+		out:          out,
+		dbType:       dbType,
+		columns:      make(map[string][]columnRule),
+		tableColumns: make(map[string][]string),
+		rows:         make(map[string]int),
+	}
+	for _, rule := range rules {
+		if rule.Pattern != "" {
+			m.patterns = append(m.patterns, regexp.MustCompile(rule.Pattern))
+			m.replaces = append(m.replaces, rule.Replacement)
+			continue
+		}
+		table := unqualified(rule.Table)
+		m.columns[table] = append(m.columns[table], columnRule{column: rule.Column, replacement: rule.Replacement})
+	}
+	return m, nil
+}
+
+func (m *maskingWriter) Write(p []byte) (int, error) {
+	m.pending = append(m.pending, p...)
+
+	for {
+		i := bytes.IndexByte(m.pending, '\n')
+		if i < 0 {
+			break
+		}
+		if err := m.writeLine(string(m.pending[:i])); err != nil {
+			return 0, err
+		}
+		m.pending = m.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close flushes a final line without a trailing newline
+func (m *maskingWriter) Close() error {
+	if len(m.pending) == 0 {
+		return nil
+	}
+	line := m.mask(string(m.pending))
+	m.pending = nil
+	_, err := io.WriteString(m.out, line)
+	return err
+}
+
+func (m *maskingWriter) writeLine(line string) error {
+	_, err := io.WriteString(m.out, m.mask(line)+"\n")
+	return err
+}
+
+func (m *maskingWriter) mask(line string) string {
+	if m.dbType.WritesPgDumpFormat() {
+		line = m.maskPostgres(line)
+	} else {
+		line = m.maskMySQL(line)
+	}
+
+	for i, pattern := range m.patterns {
+		line = pattern.ReplaceAllString(line, m.replaces[i])
+	}
+	return line
+}
+
+// maskPostgres replaces columns in the tab-separated rows of a COPY ... FROM stdin block
+func (m *maskingWriter) maskPostgres(line string) string {
+	if m.inCopy {
+		if line == `\.` {
+			m.inCopy = false
+			return line
+		}
+
+		fields := strings.Split(line, "\t")
+		table := m.copyTable
+		m.rows[table]++
+		for index, rule := range m.copyMasks {
+			// NULLs carry no data and stay NULL
+			if index < len(fields) && fields[index] != `\N` {
+				fields[index] = escapeCopyValue(expandRow(rule.replacement, m.rows[table]))
+			}
+		}
+		return strings.Join(fields, "\t")
+	}
+
+	match := pgCopyLine.FindStringSubmatch(line)
+	if match == nil {
+		return line
+	}
+	table := unqualified(match[1])
+	rules := m.columns[table]
+	if len(rules) == 0 {
+		return line
+	}
+
+	m.copyMasks = make(map[int]columnRule)
+	for i, column := range strings.Split(match[2], ", ") {
+		for _, rule := range rules {
+			if strings.Trim(column, `"`) == rule.column {
+				m.copyMasks[i] = rule
+			}
+		}
+	}
+	m.inCopy = len(m.copyMasks) > 0
+	m.copyTable = table
+	return line
+}
+
+// maskMySQL learns column order from CREATE TABLE and replaces columns in INSERT statements
+func (m *maskingWriter) maskMySQL(line string) string {
+	if m.createTable != "" {
+		if strings.HasPrefix(line, ")") {
+			m.createTable = ""
+		} else if match := mysqlColumnDef.FindStringSubmatch(line); match != nil {
+			m.tableColumns[m.createTable] = append(m.tableColumns[m.createTable], match[1])
+		}
+		return line
+	}
+
+	if match := mysqlCreate.FindStringSubmatch(line); match != nil {
+		if len(m.columns[match[1]]) > 0 {
+			m.createTable = match[1]
+			m.tableColumns[match[1]] = nil
+		}
+		return line
+	}
+
+	match := mysqlInsert.FindStringSubmatch(line)
+	if match == nil || len(m.columns[match[1]]) == 0 {
+		return line
+	}
+	table := match[1]
+
+	columns := m.tableColumns[table]
+	if match[2] != "" {
+		columns = nil
+		for _, column := range strings.Split(match[2], ",") {
+			columns = append(columns, strings.Trim(strings.TrimSpace(column), "`"))
+		}
+	}
+
+	masks := make(map[int]columnRule)
+	for i, column := range columns {
+		for _, rule := range m.columns[table] {
+			if column == rule.column {
+				masks[i] = rule
+			}
+		}
+	}
+	if len(masks) == 0 {
+		return line
+	}
+
+	prefix := match[0]
+	return prefix + m.maskValues(table, line[len(prefix):], masks)
+}
+
+// maskValues rewrites the tuples of "(1,'a'),(2,'b');", replacing the masked field positions
+func (m *maskingWriter) maskValues(table, values string, masks map[int]columnRule) string {
+	var out strings.Builder
+	var field strings.Builder
+	index := 0
+	depth := 0
+	inString := false
+
+	flush := func() {
+		if rule, ok := masks[index]; ok && field.String() != "NULL" {
+			out.WriteString(quoteMySQLValue(expandRow(rule.replacement, m.rows[table])))
+		} else {
+			out.WriteString(field.String())
+		}
+		field.Reset()
+	}
+
+	for i := 0; i < len(values); i++ {
+		c := values[i]
+
+		if inString {
+			field.WriteByte(c)
+			if c == '\\' && i+1 < len(values) {
+				i++
+				field.WriteByte(values[i])
+			} else if c == '\'' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '\'' && depth == 1:
+			inString = true
+			field.WriteByte(c)
+		case c == '(' && depth == 0:
+			depth = 1
+			index = 0
+			m.rows[table]++
+			out.WriteByte(c)
+		case c == ',' && depth == 1:
+			flush()
+			index++
+			out.WriteByte(c)
+		case c == ')' && depth == 1:
+			flush()
+			depth = 0
+			out.WriteByte(c)
+		case depth == 1:
+			field.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// unqualified strips the schema and quotes from a table name: public."Users" -> Users
+func unqualified(table string) string {
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = table[i+1:]
+	}
+	return strings.Trim(table, "\"`")
+}
+
+func expandRow(replacement string, row int) string {
+	return strings.ReplaceAll(replacement, rowPlaceholder, strconv.Itoa(row))
+}
+
+// escapeCopyValue escapes a value for PostgreSQL's COPY text format
+func escapeCopyValue(value string) string {
+	if value == "NULL" {
+		return `\N`
+	}
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(value)
+}
+
+// quoteMySQLValue renders a value as a MySQL string literal
+func quoteMySQLValue(value string) string {
+	if value == "NULL" {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`, "\n", `\n`, "\r", `\r`).Replace(value) + "'"
+}
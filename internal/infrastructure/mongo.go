@@ -0,0 +1,246 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// mongoArgs returns the connection flags for mongodump and mongorestore started with method.
+// config.URI replaces the host and credentials, carrying options such as replicaSet itself.
+// An Atlas cluster is reached through its SRV record, which also turns on TLS.
+func mongoArgs(config domain.DatabaseConfig, method domain.BackupMethod) []string {
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+
+	var args []string
+	if config.URI != "" {
+		args = []string{"--uri", config.URI}
+	} else {
+		args = []string{"--host", host}
+		if config.Managed != nil && config.Managed.Provider == domain.ManagedAtlas {
+			args = []string{"--uri", "mongodb+srv://" + host + "/"}
+		}
+		if config.User != "" {
+			args = append(args, "--username", config.User, "--password", config.Password)
+		}
+		if config.AuthDatabase != "" {
+			args = append(args, "--authenticationDatabase", config.AuthDatabase)
+		}
+	}
+	if config.TLS && config.Certs == nil {
+		args = append(args, "--tls")
+	}
+	return append(args, mongoTLSArgs(config, method)...)
+}
+
+// mongoDumpArgs returns the mongodump command, followed by output. With oplog the whole instance
+// is dumped, since mongodump only records the oplog for full dumps.
+func mongoDumpArgs(config domain.DatabaseConfig, method domain.BackupMethod, output ...string) []string {
+	args := append([]string{"mongodump"}, mongoArgs(config, method)...)
+	if config.Oplog {
+		args = append(args, "--oplog")
+	} else {
+		args = append(args, "--db", config.Database)
+	}
+	return append(args, output...)
+}
+
+// mongoArchiveArgs selects the archive written to stdout, gzipped inside the container
+// so less data crosses the exec stream
+func mongoArchiveArgs(compress bool) []string {
+	if compress {
+		return []string{"--archive", "--gzip"}
+	}
+	return []string{"--archive"}
+}
+
+// mongoShellArgs returns the connection arguments for mongosh and the legacy mongo shell,
+// quoted for sh. The shells take a URI as a plain argument rather than --uri.
+func mongoShellArgs(config domain.DatabaseConfig, method domain.BackupMethod) string {
+	args := mongoArgs(config, method)
+	if args[0] == "--uri" {
+		args = args[1:]
+	}
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// mongoEvalCommand runs eval in mongosh, or in the legacy mongo shell that older images
+// ship instead. eval is quoted for sh, so it is passed as is.
+func mongoEvalCommand(config domain.DatabaseConfig, method domain.BackupMethod, eval string) []string {
+	args := mongoShellArgs(config, method)
+	return []string{"sh", "-c", fmt.Sprintf(
+		"if command -v mongosh >/dev/null 2>&1; then exec mongosh --quiet %s --eval %s; fi; exec mongo --quiet %s --eval %s",
+		args, shellQuote(eval), args, shellQuote(eval))}
+}
+
+// shellQuote quotes s as a single sh word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// unpackMongoDump runs dump, which writes a mongodump archive, and unpacks the archive into dir
+// as it arrives. A failed dump fails the backup even when the archive read so far unpacked.
+func unpackMongoDump(dir string, dump func(w io.Writer) error) error {
+	reader, writer := io.Pipe()
+
+	dumpErr := make(chan error, 1)
+	go func() {
+		err := dump(writer)
+		writer.CloseWithError(err)
+		dumpErr <- err
+	}()
+
+	unpackErr := func() error {
+		archive, err := decompressed(reader)
+		if err != nil {
+			return fmt.Errorf("archive is not valid gzip: %w", err)
+		}
+		defer archive.Close()
+		return unpackMongoArchive(archive, dir)
+	}()
+	// Unblock the dump if unpacking stopped early
+	reader.Close()
+
+	err := <-dumpErr
+	if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		return err
+	}
+	if unpackErr != nil {
+		return fmt.Errorf("failed to unpack dump: %w", unpackErr)
+	}
+	return err
+}
+
+// unpackMongoArchive writes the collections of a mongodump archive to dir the way mongodump --out
+// lays them out: <db>/<collection>.bson next to its .metadata.json, and for an oplog dump
+// oplog.bson at the top. The archive interleaves blocks of documents from several collections.
+func unpackMongoArchive(r io.Reader, dir string) error {
+	reader := bufio.NewReaderSize(r, 1<<20)
+	magic := make([]byte, len(mongoArchiveMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if !bytes.Equal(magic, mongoArchiveMagic) {
+		return fmt.Errorf("mongodump did not write an archive")
+	}
+
+	// The prelude is a header and the metadata of each collection
+	if _, err := readBSON(reader); err != nil {
+		return fmt.Errorf("failed to read archive prelude: %w", err)
+	}
+	for {
+		doc, err := readBSON(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read archive prelude: %w", err)
+		}
+		if doc == nil {
+			break
+		}
+		fields := bsonStrings(doc)
+		if fields["metadata"] == "" {
+			continue
+		}
+		dbDir, err := mongoDatabaseDir(dir, fields["db"])
+		if err != nil {
+			return err
+		}
+		file := filepath.Join(dbDir, mongoFileName(fields["collection"])+".metadata.json")
+		if err := os.WriteFile(file, []byte(fields["metadata"]), 0644); err != nil {
+			return fmt.Errorf("failed to write metadata: %w", err)
+		}
+	}
+
+	// Each block is a namespace header, that namespace's documents and a terminator. Every
+	// collection ends with a block without documents, so empty ones get their file too.
+	var block *os.File
+	var out *bufio.Writer
+	closeBlock := func() error {
+		if block == nil {
+			return nil
+		}
+		err := out.Flush()
+		if closeErr := block.Close(); err == nil {
+			err = closeErr
+		}
+		block = nil
+		return err
+	}
+	defer closeBlock()
+
+	header := true
+	for {
+		doc, err := readBSON(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("archive is truncated: %w", err)
+		}
+
+		switch {
+		case doc == nil:
+			if err := closeBlock(); err != nil {
+				return fmt.Errorf("failed to write collection: %w", err)
+			}
+			header = true
+
+		case header:
+			fields := bsonStrings(doc)
+			dbDir, err := mongoDatabaseDir(dir, fields["db"])
+			if err != nil {
+				return err
+			}
+			file := filepath.Join(dbDir, mongoFileName(fields["collection"])+".bson")
+			block, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				return fmt.Errorf("failed to create collection file: %w", err)
+			}
+			out = bufio.NewWriterSize(block, 1<<20)
+			header = false
+
+		default:
+			if _, err := out.Write(doc); err != nil {
+				return fmt.Errorf("failed to write collection: %w", err)
+			}
+		}
+	}
+
+	if !header {
+		return fmt.Errorf("archive is truncated inside a collection")
+	}
+	return closeBlock()
+}
+
+// mongoDatabaseDir creates the directory of database db under dir. The oplog has no database
+// and stays in dir itself.
+func mongoDatabaseDir(dir, db string) (string, error) {
+	if strings.ContainsAny(db, `/\`) || db == "." || db == ".." {
+		return "", fmt.Errorf("invalid database name %q in archive", db)
+	}
+	dbDir := filepath.Join(dir, db)
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return dbDir, nil
+}
+
+// mongoFileName escapes a collection name for use as a file name the way mongodump does, so
+// mongorestore maps the file back to the collection
+func mongoFileName(collection string) string {
+	return strings.NewReplacer("%", "%25", "/", "%2F").Replace(collection)
+}
@@ -0,0 +1,146 @@
+package infrastructure
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// neo4jDataDir is where the official image keeps its databases. Files loaded as root are
+// handed back to its owner, so the server can still open them.
+const neo4jDataDir = "/data"
+
+// backupNeo4j collects a neo4j-admin dump or online backup of config.Database in a temporary
+// directory next to the database and streams it as a tar archive to backupPath. The files
+// are compressed by neo4j-admin already.
+func (r *BackupRepositoryImpl) backupNeo4j(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	return writeToFile(backupPath, config, func(w io.Writer) error {
+		w = limitWriter(w, config.Limits.BytesPerSecond)
+
+		switch config.Neo4j.Strategy {
+		case domain.Neo4jStopContainer:
+			return r.whileStopped(config.Container, func() error {
+				return r.runContainer(neo4jVolumesRun(config, neo4jCollect(neo4jDumpCommand(config.Database))), nil, w)
+			})
+
+		case domain.Neo4jStopDatabase:
+			return r.whileDatabaseStopped(config, method, namespace, func() error {
+				return r.streamClient(config, method, namespace, niceCommand(config.Limits, neo4jCollect(neo4jDumpCommand(config.Database))), w)
+			})
+		}
+
+		command := neo4jCollect(fmt.Sprintf("neo4j-admin database backup --from=%s --to-path=\"$d\" %s",
+			shellQuote(neo4jBackupAddress(config, method)), shellQuote(config.Database)))
+		return r.streamClient(config, method, namespace, niceCommand(config.Limits, command), w)
+	})
+}
+
+// restoreNeo4j loads a dump, or restores an online backup, into config.Database. Both need the
+// database offline: the container is stopped for stop-container, otherwise the database, which
+// is then created if it did not exist.
+func (r *RestoreRepositoryImpl) restoreNeo4j(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace string) error {
+	if method == domain.BackupMethodDockerRun {
+		return fmt.Errorf("restoring Neo4j needs %s or %s, as neo4j-admin writes to the data directory", domain.BackupMethodDockerExec, domain.BackupMethodKubectlExec)
+	}
+	if sourceDatabase == "" {
+		sourceDatabase = config.Database
+	}
+
+	// A dump is loaded from <database>.dump, so it is renamed for a different target
+	script := fmt.Sprintf(`d=$(mktemp -d) && tar -xf - -C "$d" && `+
+		`if [ -f "$d"/%[1]s.dump ]; then `+
+		`{ [ %[1]s = %[2]s ] || mv "$d"/%[1]s.dump "$d"/%[2]s.dump; } && neo4j-admin database load --from-path="$d" --overwrite-destination=true %[2]s; `+
+		`else neo4j-admin database restore --from-path="$(ls "$d"/*.backup | tail -n 1)" --overwrite-destination=true %[2]s; fi `+
+		`&& if [ "$(id -u)" = 0 ] && [ -d %[3]s ]; then chown -R "$(stat -c %%u:%%g %[3]s)" %[3]s; fi; s=$?; rm -rf "$d"; exit $s`,
+		shellQuote(sourceDatabase), shellQuote(config.Database), neo4jDataDir)
+	command := []string{"sh", "-c", script}
+
+	return readFromFile(backupPath, func(in io.Reader) error {
+		if config.Neo4j.Strategy == domain.Neo4jStopContainer {
+			return r.whileStopped(config.Container, func() error {
+				return r.runContainer(neo4jVolumesRun(config, command), in, io.Discard)
+			})
+		}
+		return r.whileDatabaseStopped(config, method, namespace, func() error {
+			return r.runClient(config, method, namespace, command, in, io.Discard)
+		})
+	})
+}
+
+// whileDatabaseStopped stops config.Database with cypher-shell, runs fn and starts the
+// database again, also if fn was interrupted, creating it if fn was a restore under a new name.
+// Needs Enterprise edition.
+func (p *clientPool) whileDatabaseStopped(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, fn func() error) error {
+	database := "`" + strings.ReplaceAll(config.Database, "`", "``") + "`"
+	// A database that does not exist yet cannot be stopped, which is fine for a restore
+	stop := shellCommand("%s || true", neo4jCypher(config, method, fmt.Sprintf("STOP DATABASE %s WAIT", database)))
+	if err := p.runClient(config, method, namespace, stop, nil, io.Discard); err != nil {
+		return fmt.Errorf("failed to stop database: %w", err)
+	}
+
+	fnErr := fn()
+	start := []string{"sh", "-c", neo4jCypher(config, method, fmt.Sprintf("CREATE DATABASE %[1]s IF NOT EXISTS WAIT; START DATABASE %[1]s WAIT", database))}
+	if err := p.detached().runClient(config, method, namespace, start, nil, io.Discard); err != nil && fnErr == nil {
+		return fmt.Errorf("failed to start database, run START DATABASE %s by hand: %w", database, err)
+	}
+	return fnErr
+}
+
+// neo4jCypher returns the cypher-shell command running statements against the system database
+func neo4jCypher(config domain.DatabaseConfig, method domain.BackupMethod, statements string) string {
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+	port := config.Port
+	if port == 0 {
+		port = 7687
+	}
+	user := config.User
+	if user == "" {
+		user = "neo4j"
+	}
+	return fmt.Sprintf("cypher-shell -a %s -u %s -p %s -d system %s",
+		shellQuote("neo4j://"+net.JoinHostPort(host, strconv.Itoa(port))), shellQuote(user), shellQuote(config.Password), shellQuote(statements))
+}
+
+// neo4jDumpCommand dumps database into the directory in $d
+func neo4jDumpCommand(database string) string {
+	return fmt.Sprintf(`neo4j-admin database dump --to-path="$d" %s`, shellQuote(database))
+}
+
+// neo4jCollect runs command with a temporary directory in $d and writes what it left there to
+// stdout as a tar archive
+func neo4jCollect(command string) []string {
+	return []string{"sh", "-c", fmt.Sprintf(`d=$(mktemp -d) && %s >&2 && tar -C "$d" -cf - .; s=$?; rm -rf "$d"; exit $s`, command)}
+}
+
+// neo4jVolumesRun runs command in a temporary container of the database's image that mounts the
+// volumes of its stopped container
+func neo4jVolumesRun(config domain.DatabaseConfig, command []string) RunOptions {
+	opts := runOptions(config.Limits, imageFor(config), command, nil, nil)
+	opts.VolumesFrom = []string{config.Container}
+	return opts
+}
+
+// neo4jBackupAddress is where the server accepts online backups
+func neo4jBackupAddress(config domain.DatabaseConfig, method domain.BackupMethod) string {
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+	port := config.Neo4j.BackupPort
+	if port == 0 {
+		port = 6362
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// validateNeo4jBackup checks that an archive holds a neo4j-admin dump or backup artifact
+func validateNeo4jBackup(backupPath string) error {
+	return validateManifestArchive(backupPath, ".dump", ".backup")
+}
@@ -0,0 +1,207 @@
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// maxBSONDocument bounds the length prefix of an oplog entry; MongoDB documents are at most
+// 16MB, and oplog entries carry a little overhead on top
+const maxBSONDocument = 17 * 1024 * 1024
+
+// MongoOplogTimestamp returns the position of the newest entry in local.oplog.rs, which full
+// differential backups record so the next ones know where to start
+func (r *BackupRepositoryImpl) MongoOplogTimestamp(config domain.DatabaseConfig, method domain.BackupMethod, namespace string) (domain.OplogTimestamp, error) {
+	return r.oplogBound(config, method, namespace, -1)
+}
+
+// BackupMongoOplog dumps the entries of local.oplog.rs that touch config.Database and were
+// written after since, as BSON that mongorestore --oplogReplay applies
+func (r *BackupRepositoryImpl) BackupMongoOplog(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string, since domain.OplogTimestamp) error {
+	// Entries older than the oplog's window are gone, and the dump would silently miss them
+	oldest, err := r.oplogBound(config, method, namespace, 1)
+	if err != nil {
+		return err
+	}
+	if since.Before(oldest) {
+		return fmt.Errorf("the oplog no longer reaches back to the full backup at %s (oldest entry %s); take a full backup", since, oldest)
+	}
+
+	query, err := oplogQuery(config.Database, since)
+	if err != nil {
+		return err
+	}
+
+	command := append([]string{"mongodump"}, mongoArgs(config, method)...)
+	command = append(command, "--db", "local", "--collection", "oplog.rs", "--query", query, "--out", "-")
+
+	return writeToFile(backupPath, config, func(w io.Writer) error {
+		w = limitWriter(w, config.Limits.BytesPerSecond)
+
+		switch method {
+		case domain.BackupMethodDockerRun:
+			if err := r.runContainer(runOptions(config.Limits, fmt.Sprintf("mongo:%s", config.Version), command, nil, certBinds(config)), nil, w); err != nil {
+				return fmt.Errorf("docker run failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodDockerExec:
+			if err := r.streamContainer(config.Container, niceCommand(config.Limits, command), w); err != nil {
+				return fmt.Errorf("docker exec failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodKubectlExec:
+			if err := r.streamPod(config, namespace, niceCommand(config.Limits, command), w); err != nil {
+				return fmt.Errorf("pod exec failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodSSH:
+			if err := r.streamSSH(config, niceCommand(config.Limits, command), w); err != nil {
+				return fmt.Errorf("ssh exec failed: %w", err)
+			}
+			return nil
+		}
+
+		return fmt.Errorf("unknown backup method: %s", method)
+	})
+}
+
+// oplogBound returns the timestamp of the newest (order -1) or oldest (order 1) oplog entry
+func (r *BackupRepositoryImpl) oplogBound(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, order int) (domain.OplogTimestamp, error) {
+	// mongosh exposes Timestamp.t and .i only with newer bson versions; the legacy shell has both
+	eval := fmt.Sprintf("var ts = db.getSiblingDB('local').getCollection('oplog.rs').find({}, {ts: 1}).sort({$natural: %d}).limit(1).next().ts; "+
+		"print(ts.t !== undefined ? ts.t + ':' + ts.i : ts.getHighBits() + ':' + (ts.getLowBits() >>> 0))", order)
+	command := mongoEvalCommand(config, method, eval)
+
+	var out bytes.Buffer
+	var err error
+	switch method {
+	case domain.BackupMethodDockerRun:
+		err = r.runContainer(RunOptions{Image: fmt.Sprintf("mongo:%s", config.Version), Command: command, Binds: certBinds(config)}, nil, &out)
+	case domain.BackupMethodDockerExec:
+		err = r.execContainer(config.Container, command, nil, &out)
+	case domain.BackupMethodKubectlExec:
+		err = r.execPod(config, namespace, command, nil, &out)
+	case domain.BackupMethodSSH:
+		err = r.execSSH(config, command, nil, &out)
+	default:
+		return domain.OplogTimestamp{}, fmt.Errorf("unknown backup method: %s", method)
+	}
+	if err != nil {
+		return domain.OplogTimestamp{}, fmt.Errorf("failed to read the oplog (the server must be a replica set member): %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	return domain.ParseOplogTimestamp(lines[len(lines)-1])
+}
+
+// oplogQuery selects the oplog entries of database after since, in mongodump's extended JSON
+func oplogQuery(database string, since domain.OplogTimestamp) (string, error) {
+	query := map[string]interface{}{
+		"ts": map[string]interface{}{
+			"$gt": map[string]interface{}{
+				"$timestamp": map[string]uint32{"t": since.T, "i": since.I},
+			},
+		},
+		"ns": map[string]interface{}{
+			"$regex": "^" + regexp.QuoteMeta(database) + `\.`,
+		},
+	}
+	data, err := json.Marshal(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to build the oplog query: %w", err)
+	}
+	return string(data), nil
+}
+
+// ReplayMongoOplog applies the oplog entries of a differential backup on top of a restored
+// full backup. mongorestore expects them as oplog.bson in a dump directory, so the stream is
+// written to a scratch directory next to the client first. A non-zero until stops the replay
+// after the entries of that second, for point-in-time restores.
+func (r *RestoreRepositoryImpl) ReplayMongoOplog(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string, until time.Time) error {
+	var quoted []string
+	for _, arg := range mongoArgs(config, method) {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	if !until.IsZero() {
+		// --oplogLimit excludes the entries at and after the given timestamp
+		quoted = append(quoted, fmt.Sprintf("--oplogLimit=%d:0", until.Unix()+1))
+	}
+	script := fmt.Sprintf("d=$(mktemp -d) && cat > \"$d/oplog.bson\" && mongorestore %s --oplogReplay \"$d\"; rc=$?; rm -rf \"$d\"; exit $rc",
+		strings.Join(quoted, " "))
+	command := []string{"sh", "-c", script}
+
+	return readFromFile(backupPath, func(in io.Reader) error {
+		switch method {
+		case domain.BackupMethodDockerRun:
+			if err := r.runContainer(RunOptions{Image: fmt.Sprintf("mongo:%s", config.Version), Command: command, Binds: certBinds(config)}, in, io.Discard); err != nil {
+				return fmt.Errorf("docker run failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodDockerExec:
+			if err := r.execContainer(config.Container, command, in, io.Discard); err != nil {
+				return fmt.Errorf("docker exec failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodKubectlExec:
+			if err := r.execPod(config, namespace, command, in, io.Discard); err != nil {
+				return fmt.Errorf("pod exec failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodSSH:
+			if err := r.execSSH(config, command, in, io.Discard); err != nil {
+				return fmt.Errorf("ssh exec failed: %w", err)
+			}
+			return nil
+		}
+
+		return fmt.Errorf("unknown backup method: %s", method)
+	})
+}
+
+// validateOplogDump walks the BSON documents of a differential backup. An empty file is
+// valid: nothing was written to the database since the full backup.
+func validateOplogDump(backupPath string) error {
+	f, err := os.Open(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open oplog dump: %w", err)
+	}
+	defer f.Close()
+
+	r, err := decompressed(f)
+	if err != nil {
+		return fmt.Errorf("oplog dump is not valid gzip: %w", err)
+	}
+	defer r.Close()
+
+	prefix := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, prefix); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("oplog dump is truncated")
+		}
+
+		length := int64(binary.LittleEndian.Uint32(prefix))
+		if length < 5 || length > maxBSONDocument {
+			return fmt.Errorf("file is not a BSON oplog dump")
+		}
+		if n, err := io.CopyN(io.Discard, r, length-4); err != nil || n != length-4 {
+			return fmt.Errorf("oplog dump is truncated")
+		}
+	}
+}
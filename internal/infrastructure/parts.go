@@ -0,0 +1,156 @@
+package infrastructure
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// SplitBackup cuts the backup file at path into parts under PartialDir next to it, one at a
+// time, so splitting takes no more room than a part. Parts keep the backup's modification
+// time, so a store can tell a part cut again for a retry from another file.
+func (r *BackupRepositoryImpl) SplitBackup(path string, partSize int64, skip int, put func(index int, partPath string) error) ([]domain.Part, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	partial := domain.PartialPath(path)
+	if err := os.MkdirAll(filepath.Dir(partial), 0o755); err != nil {
+		return nil, err
+	}
+	defer os.Remove(filepath.Dir(partial)) // Fails, as intended, while backups are written in it
+
+	var parts []domain.Part
+	for index := 0; ; index++ {
+		if index < skip {
+			part, err := hashPart(in, partSize)
+			if err != nil {
+				return parts, fmt.Errorf("failed to read part %d of %s: %w", index+1, path, err)
+			}
+			parts = append(parts, part)
+			continue
+		}
+
+		partPath := domain.PartKey(partial, index)
+		part, err := writePart(in, partPath, partSize, info.ModTime())
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return parts, fmt.Errorf("failed to write part %d of %s: %w", index+1, path, err)
+		}
+		err = put(index, partPath)
+		os.Remove(partPath)
+		if err != nil {
+			return parts, fmt.Errorf("part %d: %w", index+1, err)
+		}
+		parts = append(parts, part)
+	}
+}
+
+// hashPart reads the next size bytes of in and returns them as a part
+func hashPart(in io.Reader, size int64) (domain.Part, error) {
+	hash := sha256.New()
+	n, err := io.Copy(hash, io.LimitReader(in, size))
+	if err != nil {
+		return domain.Part{}, err
+	}
+	if n == 0 {
+		return domain.Part{}, io.ErrUnexpectedEOF
+	}
+	return domain.Part{Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// writePart copies the next size bytes of in to a new file at path, modified at modTime, and
+// returns them as a part, or io.EOF once in is used up
+func writePart(in io.Reader, path string, size int64, modTime time.Time) (domain.Part, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return domain.Part{}, err
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(in, size))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n == 0 {
+		err = io.EOF
+	}
+	if err == nil {
+		err = os.Chtimes(path, modTime, modTime)
+	}
+	if err != nil {
+		os.Remove(path)
+		return domain.Part{}, err
+	}
+	return domain.Part{Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// JoinParts fetches the parts next to path one at a time, so joining takes no more room than
+// the backup and a part. Nothing is left at path if a part cannot be fetched or does not match.
+func (r *RestoreRepositoryImpl) JoinParts(path string, parts []domain.Part, fetch func(index int, partPath string) error) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	err = appendParts(out, path, parts, fetch)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// appendParts fetches each part next to path and appends it to out
+func appendParts(out io.Writer, path string, parts []domain.Part, fetch func(index int, partPath string) error) error {
+	for index, part := range parts {
+		partPath := domain.PartKey(path, index)
+		// Errors wrapping ErrNotInStore are passed on as they are, so the next store is tried
+		if err := fetch(index, partPath); err != nil {
+			os.Remove(partPath)
+			return err
+		}
+		err := appendPart(out, partPath, part)
+		os.Remove(partPath)
+		if err != nil {
+			return fmt.Errorf("part %d: %w", index+1, err)
+		}
+	}
+	return nil
+}
+
+// appendPart appends the file at partPath to out, checking it against part on the way
+func appendPart(out io.Writer, partPath string, part domain.Part) error {
+	in, err := os.Open(partPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, hash), in)
+	if err != nil {
+		return err
+	}
+	if n != part.Size {
+		return fmt.Errorf("%w: the part has %d bytes, expected %d", domain.ErrChecksumMismatch, n, part.Size)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != part.SHA256 {
+		return fmt.Errorf("%w: the part has SHA-256 %s, expected %s", domain.ErrChecksumMismatch, sum, part.SHA256)
+	}
+	return nil
+}
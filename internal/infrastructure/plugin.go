@@ -0,0 +1,298 @@
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// PluginPrefix starts the file name of every plugin executable, e.g. backup-plugin-clickhouse
+const PluginPrefix = "backup-plugin-"
+
+// pluginProtocol is the version of the request and response format plugins speak
+const pluginProtocol = 1
+
+// pluginRequest is written to a plugin's stdin, one request per run. Only the fields the
+// method needs are set.
+type pluginRequest struct {
+	Method         string          `json:"method"` // describe, dump, restore, verify, put, commit, get or list
+	Protocol       int             `json:"protocol"`
+	Database       *pluginDatabase `json:"database,omitempty"`
+	BackupMethod   string          `json:"backup_method,omitempty"`
+	BackupPath     string          `json:"backup_path,omitempty"`
+	SourceDatabase string          `json:"source_database,omitempty"`
+	Namespace      string          `json:"namespace,omitempty"`
+	TempDir        string          `json:"temp_dir,omitempty"`
+	Key            string          `json:"key,omitempty"`
+	PartialKey     string          `json:"partial_key,omitempty"` // commit only: where put wrote the backup
+}
+
+// pluginDatabase is the connection a plugin engine dumps or restores
+type pluginDatabase struct {
+	Type        string `json:"type"`
+	Label       string `json:"label,omitempty"`
+	Host        string `json:"host,omitempty"`
+	Port        int    `json:"port,omitempty"`
+	User        string `json:"user,omitempty"`
+	Password    string `json:"password,omitempty"`
+	Database    string `json:"database"`
+	Version     string `json:"version,omitempty"`
+	Container   string `json:"container,omitempty"`
+	Pod         string `json:"pod,omitempty"`
+	Kubeconfig  string `json:"kubeconfig,omitempty"`
+	KubeContext string `json:"kube_context,omitempty"`
+}
+
+// pluginResponse is read from a plugin's stdout. A non-empty error fails the request.
+type pluginResponse struct {
+	Error string `json:"error,omitempty"`
+
+	// Set by describe
+	Protocol    int    `json:"protocol,omitempty"`
+	Kind        string `json:"kind,omitempty"` // engine or store
+	Type        string `json:"type,omitempty"` // Engines only
+	Name        string `json:"name,omitempty"`
+	DefaultPort int    `json:"default_port,omitempty"`
+	Image       string `json:"image,omitempty"`  // Without tag; the database version is appended
+	Staged      bool   `json:"staged,omitempty"` // Stores only: put to a partial key, then commit it
+	Fetch       bool   `json:"fetch,omitempty"`  // Stores only: backups can be fetched back with get and list
+
+	// Set by get when nothing is stored under the key
+	Missing bool `json:"missing,omitempty"`
+
+	// Set by list: the keys stored below the requested one
+	Keys []string `json:"keys,omitempty"`
+}
+
+// LoadPlugins registers the engines and stores of the plugin executables in dir. A missing
+// dir holds no plugins. Plugins that cannot be loaded are skipped and reported in the
+// error; the others are registered all the same.
+func LoadPlugins(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+
+	var loaded []string
+	var errs []error
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), PluginPrefix) {
+			continue
+		}
+		if info, err := file.Info(); err != nil || info.Mode()&0111 == 0 {
+			continue
+		}
+
+		name, err := loadPlugin(filepath.Join(dir, file.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %w", file.Name(), err))
+			continue
+		}
+		loaded = append(loaded, name)
+	}
+	return loaded, errors.Join(errs...)
+}
+
+// loadPlugin asks the plugin at path what it provides and registers it
+func loadPlugin(path string) (string, error) {
+	client := pluginClient{path: path}
+	description, err := client.call(pluginRequest{Method: "describe"})
+	if err != nil {
+		return "", err
+	}
+	if description.Protocol != pluginProtocol {
+		return "", fmt.Errorf("speaks protocol %d, expected %d", description.Protocol, pluginProtocol)
+	}
+
+	switch description.Kind {
+	case "engine":
+		dbType := domain.DatabaseType(description.Type)
+		if dbType == "" {
+			return "", fmt.Errorf("engine plugin has no type")
+		}
+		if _, err := domain.LookupEngine(dbType); err == nil {
+			return "", fmt.Errorf("an engine for %s is already registered", dbType)
+		}
+		domain.RegisterEngine(&pluginEngine{client: client, description: description})
+		return dbType.String(), nil
+
+	case "store":
+		if description.Name == "" {
+			return "", fmt.Errorf("store plugin has no name")
+		}
+		if _, err := domain.LookupStore(description.Name); err == nil {
+			return "", fmt.Errorf("a store named %s is already registered", description.Name)
+		}
+		store := &pluginStore{client: client, name: description.Name, staged: description.Staged}
+		if description.Fetch {
+			domain.RegisterStore(fetchingPluginStore{store})
+		} else {
+			domain.RegisterStore(store)
+		}
+		return description.Name, nil
+	}
+	return "", fmt.Errorf("unknown plugin kind %q", description.Kind)
+}
+
+// pluginClient runs a plugin executable once per request
+type pluginClient struct {
+	path string
+}
+
+// call writes request to the plugin's stdin and reads its response from stdout. The tail of
+// its stderr is kept for the error when it exits unsuccessfully.
+func (c pluginClient) call(request pluginRequest) (pluginResponse, error) {
+	request.Protocol = pluginProtocol
+	body, err := json.Marshal(request)
+	if err != nil {
+		return pluginResponse{}, err
+	}
+
+	var stdout bytes.Buffer
+	var stderr stderrBuffer
+	cmd := exec.Command(c.path)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return pluginResponse{}, fmt.Errorf("%s failed: %w", request.Method, stderr.wrap(err))
+	}
+
+	var response pluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return pluginResponse{}, fmt.Errorf("invalid response to %s: %w", request.Method, err)
+	}
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+	return response, nil
+}
+
+// pluginEngine is a DatabaseEngine provided by a plugin executable
+type pluginEngine struct {
+	client      pluginClient
+	description pluginResponse
+}
+
+func (e *pluginEngine) Type() domain.DatabaseType { return domain.DatabaseType(e.description.Type) }
+func (e *pluginEngine) DefaultPort() int          { return e.description.DefaultPort }
+
+func (e *pluginEngine) Name() string {
+	if e.description.Name == "" {
+		return e.description.Type
+	}
+	return e.description.Name
+}
+
+func (e *pluginEngine) Image(version string) string {
+	if e.description.Image == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%s", e.description.Image, version)
+}
+
+func (e *pluginEngine) Dump(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string) error {
+	_, err := e.client.call(pluginRequest{
+		Method:       "dump",
+		Database:     pluginDatabaseOf(config),
+		BackupMethod: method.String(),
+		BackupPath:   backupPath,
+		Namespace:    namespace,
+		TempDir:      tempDir,
+	})
+	return err
+}
+
+func (e *pluginEngine) Restore(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	_, err := e.client.call(pluginRequest{
+		Method:         "restore",
+		Database:       pluginDatabaseOf(config),
+		BackupMethod:   method.String(),
+		BackupPath:     backupPath,
+		SourceDatabase: sourceDatabase,
+		Namespace:      namespace,
+		TempDir:        tempDir,
+	})
+	return err
+}
+
+func (e *pluginEngine) Verify(backupPath string) error {
+	_, err := e.client.call(pluginRequest{Method: "verify", BackupPath: backupPath})
+	return err
+}
+
+// pluginPartialSuffix marks the key a staged store plugin uploads to before the backup is committed
+const pluginPartialSuffix = ".partial"
+
+// pluginStore is a BackupStore provided by a plugin executable
+type pluginStore struct {
+	client pluginClient
+	name   string
+	staged bool // Uploads to a partial key and commits it, so the key only ever holds whole backups
+}
+
+func (s *pluginStore) Name() string { return s.name }
+
+func (s *pluginStore) Put(path, key string) error {
+	if !s.staged {
+		_, err := s.client.call(pluginRequest{Method: "put", BackupPath: path, Key: key})
+		return err
+	}
+
+	partialKey := key + pluginPartialSuffix
+	if _, err := s.client.call(pluginRequest{Method: "put", BackupPath: path, Key: partialKey}); err != nil {
+		return err
+	}
+	if _, err := s.client.call(pluginRequest{Method: "commit", Key: key, PartialKey: partialKey}); err != nil {
+		return fmt.Errorf("failed to commit %s: %w", partialKey, err)
+	}
+	return nil
+}
+
+// fetchingPluginStore is a store plugin that can also fetch backups back
+type fetchingPluginStore struct {
+	*pluginStore
+}
+
+func (s fetchingPluginStore) Get(key, path string) error {
+	response, err := s.client.call(pluginRequest{Method: "get", BackupPath: path, Key: key})
+	if err == nil && response.Missing {
+		return fmt.Errorf("%s in store %s: %w", key, s.name, domain.ErrNotInStore)
+	}
+	return err
+}
+
+func (s fetchingPluginStore) List(prefix string) ([]string, error) {
+	response, err := s.client.call(pluginRequest{Method: "list", Key: prefix})
+	if err != nil {
+		return nil, err
+	}
+	return response.Keys, nil
+}
+
+func pluginDatabaseOf(config domain.DatabaseConfig) *pluginDatabase {
+	return &pluginDatabase{
+		Type:        config.Type.String(),
+		Label:       config.Label,
+		Host:        config.Host,
+		Port:        config.Port,
+		User:        config.User,
+		Password:    config.Password,
+		Database:    config.Database,
+		Version:     config.Version,
+		Container:   config.Container,
+		Pod:         config.Pod,
+		Kubeconfig:  config.Kubeconfig,
+		KubeContext: config.KubeContext,
+	}
+}
@@ -0,0 +1,126 @@
+package infrastructure
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// snapshotLockedMarker is printed by the MySQL session once it holds the global read lock
+const snapshotLockedMarker = "backup-tool-locked"
+
+// quiesce runs snapshot while the database has flushed its data and holds off writes, so the
+// snapshot is consistent rather than merely crash-consistent. PostgreSQL recovers from its
+// WAL, so a checkpoint beforehand only shortens that recovery.
+func (r *BackupRepositoryImpl) quiesce(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, snapshot func() error) error {
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+
+	switch config.Type {
+	case domain.DatabaseTypePostgres, domain.DatabaseTypeTimescaleDB:
+		command := shellCommand("%sPGPASSWORD=%s psql -h %s -U %s -d %s -c CHECKPOINT",
+			postgresTLSEnv(config, method), shellQuote(config.Password), shellQuote(host), shellQuote(config.User), shellQuote(config.Database))
+		if err := r.runClient(config, method, namespace, command, nil, io.Discard); err != nil {
+			return fmt.Errorf("checkpoint failed: %w", err)
+		}
+		return snapshot()
+
+	case domain.DatabaseTypeMySQL, domain.DatabaseTypeMariaDB:
+		return r.withGlobalReadLock(config, method, namespace, host, snapshot)
+
+	case domain.DatabaseTypeMongoDB:
+		if err := r.runClient(config, method, namespace, mongoEvalCommand(config, method, "db.fsyncLock()"), nil, io.Discard); err != nil {
+			return fmt.Errorf("fsyncLock failed: %w", err)
+		}
+		snapshotErr := snapshot()
+		// The lock outlives the session, so it is lifted even if the snapshot was interrupted
+		if err := r.detached().runClient(config, method, namespace, mongoEvalCommand(config, method, "db.fsyncUnlock()"), nil, io.Discard); err != nil && snapshotErr == nil {
+			return fmt.Errorf("fsyncUnlock failed, run db.fsyncUnlock() by hand: %w", err)
+		}
+		return snapshotErr
+	}
+
+	return fmt.Errorf("unsupported database type: %s", config.Type)
+}
+
+// withGlobalReadLock runs snapshot while a mysql session holds FLUSH TABLES WITH READ LOCK.
+// The lock only lives as long as the session, so the statements are fed to one client over
+// stdin and the session is ended once the snapshot is cut.
+func (r *BackupRepositoryImpl) withGlobalReadLock(config domain.DatabaseConfig, method domain.BackupMethod, namespace, host string, snapshot func() error) error {
+	command := shellCommand("exec mysql -h %s -u%s -p%s%s --unbuffered -N -B",
+		shellQuote(host), shellQuote(config.User), shellQuote(config.Password), mysqlTLSFlags(config, method))
+
+	stdin, session := io.Pipe()
+	locked := &markerWriter{marker: []byte(snapshotLockedMarker), found: make(chan struct{})}
+	done := make(chan error, 1)
+	go func() {
+		err := r.runClient(config, method, namespace, command, stdin, locked)
+		// Unblocks the writes below if the client exits early
+		stdin.CloseWithError(io.ErrClosedPipe)
+		done <- err
+	}()
+
+	if _, err := fmt.Fprintf(session, "FLUSH TABLES WITH READ LOCK;\nSELECT '%s';\n", snapshotLockedMarker); err != nil {
+		if err := <-done; err != nil {
+			return fmt.Errorf("failed to lock tables: %w", err)
+		}
+		return fmt.Errorf("failed to lock tables: mysql exited")
+	}
+	select {
+	case <-locked.found:
+	case err := <-done:
+		if err == nil {
+			err = fmt.Errorf("mysql exited before the lock was taken")
+		}
+		return fmt.Errorf("failed to lock tables: %w", err)
+	}
+
+	snapshotErr := snapshot()
+	fmt.Fprintln(session, "UNLOCK TABLES;")
+	session.Close()
+	if err := <-done; err != nil && snapshotErr == nil {
+		return fmt.Errorf("failed to unlock tables: %w", err)
+	}
+	return snapshotErr
+}
+
+// runClient runs a database client command next to the database: in its container or pod, on
+// its machine over SSH, or for docker-run in a temporary container of the database's image
+func (p *clientPool) runClient(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, command []string, stdin io.Reader, stdout io.Writer) error {
+	switch method {
+	case domain.BackupMethodDockerRun:
+		return p.runContainer(RunOptions{Image: imageFor(config), Command: command, Binds: certBinds(config)}, stdin, stdout)
+	case domain.BackupMethodDockerExec:
+		return p.execContainer(config.Container, command, stdin, stdout)
+	case domain.BackupMethodKubectlExec:
+		return p.execPod(config, namespace, command, stdin, stdout)
+	case domain.BackupMethodSSH:
+		return p.execSSH(config, command, stdin, stdout)
+	}
+	return fmt.Errorf("unknown backup method: %s", method)
+}
+
+// markerWriter closes found once marker has been written to it
+type markerWriter struct {
+	marker []byte
+	found  chan struct{}
+	seen   []byte
+	once   sync.Once
+}
+
+func (w *markerWriter) Write(p []byte) (int, error) {
+	w.seen = append(w.seen, p...)
+	if bytes.Contains(w.seen, w.marker) {
+		w.once.Do(func() { close(w.found) })
+	}
+	// Keep just enough to find a marker split across writes
+	if len(w.seen) > len(w.marker) {
+		w.seen = w.seen[len(w.seen)-len(w.marker):]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,151 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// rabbitMQTimeout bounds one management API request; definitions are small even for large brokers
+const rabbitMQTimeout = time.Minute
+
+// rabbitMQDefinitions is the part of an exported definitions file that validation and
+// inspection read
+type rabbitMQDefinitions struct {
+	RabbitVersion   string            `json:"rabbit_version"`
+	RabbitMQVersion string            `json:"rabbitmq_version"`
+	Users           []json.RawMessage `json:"users"`
+	Vhosts          []json.RawMessage `json:"vhosts"`
+	Exchanges       []json.RawMessage `json:"exchanges"`
+	Bindings        []json.RawMessage `json:"bindings"`
+	Policies        []json.RawMessage `json:"policies"`
+	Queues          []struct {
+		Name  string `json:"name"`
+		Vhost string `json:"vhost"`
+	} `json:"queues"`
+}
+
+// backupRabbitMQ exports the definitions of the whole broker (users, vhosts, permissions,
+// policies, exchanges, queues and bindings) from the management API to backupPath. Messages
+// are not part of them.
+func (r *BackupRepositoryImpl) backupRabbitMQ(config domain.DatabaseConfig, backupPath string) error {
+	return writeToFile(backupPath, config, func(w io.Writer) error {
+		resp, err := rabbitMQRequest(r.ctx, config, http.MethodGet, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if _, err := io.Copy(limitWriter(w, config.Limits.BytesPerSecond), resp.Body); err != nil {
+			return fmt.Errorf("failed to download definitions: %w", err)
+		}
+		return nil
+	})
+}
+
+// restoreRabbitMQ imports definitions into the broker. RabbitMQ merges them with what exists:
+// missing objects are created and existing ones left alone, nothing is deleted.
+func (r *RestoreRepositoryImpl) restoreRabbitMQ(config domain.DatabaseConfig, backupPath string) error {
+	return readFromFile(backupPath, func(in io.Reader) error {
+		// Definitions are small, so they are sent with their length rather than chunked
+		definitions, err := io.ReadAll(in)
+		if err != nil {
+			return fmt.Errorf("failed to read definitions: %w", err)
+		}
+		resp, err := rabbitMQRequest(r.ctx, config, http.MethodPost, bytes.NewReader(definitions))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
+}
+
+// rabbitMQRequest sends a request to the definitions endpoint of the management API and fails
+// on anything but a success status
+func rabbitMQRequest(ctx context.Context, config domain.DatabaseConfig, method string, body io.Reader) (*http.Response, error) {
+	tlsConfig, err := clientTLS(config.Certs)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: rabbitMQTimeout, Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL(config, 15672)+"/api/definitions", body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid management API URL: %w", err)
+	}
+	req.SetBasicAuth(config.User, config.Password)
+	req.Header.Set("User-Agent", "backup-tool")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("management API request failed: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("management API request failed: %s: %s", resp.Status, message)
+	}
+	return resp, nil
+}
+
+// readRabbitMQDefinitions parses an exported definitions file, failing if it is not one
+func readRabbitMQDefinitions(backupPath string) (rabbitMQDefinitions, error) {
+	var definitions rabbitMQDefinitions
+	f, err := os.Open(backupPath)
+	if err != nil {
+		return definitions, fmt.Errorf("failed to open definitions: %w", err)
+	}
+	defer f.Close()
+
+	r, err := decompressed(f)
+	if err != nil {
+		return definitions, fmt.Errorf("definitions are not valid gzip: %w", err)
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(&definitions); err != nil {
+		return definitions, fmt.Errorf("definitions are not valid JSON: %w", err)
+	}
+	if definitions.RabbitVersion == "" && definitions.RabbitMQVersion == "" {
+		return definitions, fmt.Errorf("file is not a RabbitMQ definitions export")
+	}
+	return definitions, nil
+}
+
+// validateRabbitMQDefinitions checks that a file holds a definitions export
+func validateRabbitMQDefinitions(backupPath string) error {
+	_, err := readRabbitMQDefinitions(backupPath)
+	return err
+}
+
+// inspectRabbitMQDefinitions lists the queues of a definitions export as its tables, by vhost
+func inspectRabbitMQDefinitions(backupPath string, summary *domain.DumpSummary) error {
+	summary.Format = "RabbitMQ definitions"
+	definitions, err := readRabbitMQDefinitions(backupPath)
+	if err != nil {
+		return err
+	}
+
+	summary.Version = definitions.RabbitVersion
+	if summary.Version == "" {
+		summary.Version = definitions.RabbitMQVersion
+	}
+	for _, queue := range definitions.Queues {
+		summary.Tables = append(summary.Tables, domain.TableSummary{Schema: queue.Vhost, Name: queue.Name})
+	}
+	summary.Notes = append(summary.Notes,
+		fmt.Sprintf("%d vhosts, %d users, %d exchanges, %d bindings and %d policies",
+			len(definitions.Vhosts), len(definitions.Users), len(definitions.Exchanges), len(definitions.Bindings), len(definitions.Policies)),
+		"Definitions hold no messages; queues are listed without rows")
+	return nil
+}
@@ -0,0 +1,320 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// rdsSnapshotTimeout bounds how long RDS may take to make a snapshot available. Snapshots are
+// incremental, but the first one of a large instance copies all of its storage.
+const rdsSnapshotTimeout = 4 * time.Hour
+
+// repeatedDashes are collapsed when a backup name becomes an RDS identifier, which may not hold two in a row
+var repeatedDashes = regexp.MustCompile(`-{2,}`)
+
+// rdsSnapshotRecord is written to the backup directory in place of a dump, so the catalog can
+// list, size and restore RDS snapshot backups like any other
+type rdsSnapshotRecord struct {
+	ARN            string    `json:"arn"`
+	Identifier     string    `json:"identifier"`
+	Instance       string    `json:"instance,omitempty"`
+	Cluster        string    `json:"cluster,omitempty"`
+	Region         string    `json:"region"`
+	Engine         string    `json:"engine"`
+	EngineVersion  string    `json:"engine_version,omitempty"`
+	InstanceClass  string    `json:"instance_class,omitempty"`
+	SubnetGroup    string    `json:"subnet_group,omitempty"`
+	SecurityGroups []string  `json:"security_groups,omitempty"`
+	Size           int64     `json:"size"` // Storage allocated to the snapshotted instance or cluster
+	ExportTask     string    `json:"export_task,omitempty"`
+	ExportPath     string    `json:"export_path,omitempty"` // s3://bucket/prefix the export is written to
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// rdsClient returns an RDS client using the AWS SDK's default credential chain: environment,
+// shared profiles and instance or task roles, as the aws CLI does
+func rdsClient(ctx context.Context, config domain.DatabaseConfig) (*rds.Client, error) {
+	var options []func(*awsconfig.LoadOptions) error
+	if config.Managed != nil && config.Managed.Region != "" {
+		options = append(options, awsconfig.WithRegion(config.Managed.Region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("no AWS region configured; set managed.region")
+	}
+	return rds.NewFromConfig(cfg), nil
+}
+
+// BackupRDSSnapshot takes a snapshot of the RDS instance or Aurora cluster, waits until it is
+// available and writes a record of it to backupPath. RDS snapshots are crash consistent
+// without quiescing the database. An export to S3 is started but not waited for; it runs on
+// for a while after the backup and is tracked in the RDS console.
+func (r *BackupRepositoryImpl) BackupRDSSnapshot(config domain.DatabaseConfig, backupPath string) (string, error) {
+	ctx := r.ctx
+	client, err := rdsClient(ctx, config)
+	if err != nil {
+		return "", err
+	}
+
+	options := config.RDSSnapshot
+	record := rdsSnapshotRecord{
+		Identifier: rdsIdentifier(backupPath, 255),
+		Instance:   options.Instance,
+		Cluster:    options.Cluster,
+		Region:     client.Options().Region,
+	}
+	tags := []types.Tag{{Key: aws.String("managed-by"), Value: aws.String("backup-tool")}}
+
+	if options.Cluster != "" {
+		err = r.snapshotCluster(ctx, client, tags, &record)
+	} else {
+		err = r.snapshotInstance(ctx, client, tags, &record)
+	}
+	if err != nil {
+		// A snapshot whose backup was interrupted is not kept
+		if record.ARN != "" {
+			deleteRDSSnapshot(client, record)
+		}
+		return "", err
+	}
+
+	if export := options.Export; export != nil {
+		task := rdsIdentifier(backupPath, 60)
+		_, err := client.StartExportTask(ctx, &rds.StartExportTaskInput{
+			ExportTaskIdentifier: aws.String(task),
+			SourceArn:            aws.String(record.ARN),
+			S3BucketName:         aws.String(export.Bucket),
+			S3Prefix:             optionalString(export.Prefix),
+			IamRoleArn:           aws.String(export.Role),
+			KmsKeyId:             aws.String(export.KMSKey),
+		})
+		if err != nil {
+			return record.ARN, fmt.Errorf("snapshot %s was taken but its export to S3 failed to start: %w", record.Identifier, err)
+		}
+		record.ExportTask = task
+		record.ExportPath = "s3://" + strings.TrimSuffix(export.Bucket+"/"+export.Prefix, "/")
+	}
+
+	record.CreatedAt = time.Now()
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return record.ARN, fmt.Errorf("failed to encode snapshot record: %w", err)
+	}
+	if err := os.WriteFile(backupPath, append(data, '\n'), 0644); err != nil {
+		return record.ARN, fmt.Errorf("failed to write snapshot record: %w", err)
+	}
+	return record.ARN, nil
+}
+
+// snapshotInstance snapshots a DB instance and fills record from it and its snapshot
+func (r *BackupRepositoryImpl) snapshotInstance(ctx context.Context, client *rds.Client, tags []types.Tag, record *rdsSnapshotRecord) error {
+	instances, err := client.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String(record.Instance)})
+	if err != nil {
+		return fmt.Errorf("failed to describe DB instance %s: %w", record.Instance, err)
+	}
+	if len(instances.DBInstances) == 1 {
+		instance := instances.DBInstances[0]
+		record.InstanceClass = aws.ToString(instance.DBInstanceClass)
+		if instance.DBSubnetGroup != nil {
+			record.SubnetGroup = aws.ToString(instance.DBSubnetGroup.DBSubnetGroupName)
+		}
+		record.SecurityGroups = securityGroupIDs(instance.VpcSecurityGroups)
+	}
+
+	created, err := client.CreateDBSnapshot(ctx, &rds.CreateDBSnapshotInput{
+		DBInstanceIdentifier: aws.String(record.Instance),
+		DBSnapshotIdentifier: aws.String(record.Identifier),
+		Tags:                 tags,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot of DB instance %s: %w", record.Instance, err)
+	}
+	record.ARN = aws.ToString(created.DBSnapshot.DBSnapshotArn)
+
+	out, err := rds.NewDBSnapshotAvailableWaiter(client).WaitForOutput(ctx,
+		&rds.DescribeDBSnapshotsInput{DBSnapshotIdentifier: aws.String(record.Identifier)}, rdsSnapshotTimeout)
+	if err != nil {
+		return fmt.Errorf("snapshot %s did not become available: %w", record.Identifier, err)
+	}
+	if len(out.DBSnapshots) == 1 {
+		snapshot := out.DBSnapshots[0]
+		record.Engine = aws.ToString(snapshot.Engine)
+		record.EngineVersion = aws.ToString(snapshot.EngineVersion)
+		record.Size = int64(aws.ToInt32(snapshot.AllocatedStorage)) << 30
+	}
+	return nil
+}
+
+// snapshotCluster snapshots an Aurora cluster and fills record from it and its snapshot
+func (r *BackupRepositoryImpl) snapshotCluster(ctx context.Context, client *rds.Client, tags []types.Tag, record *rdsSnapshotRecord) error {
+	clusters, err := client.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{DBClusterIdentifier: aws.String(record.Cluster)})
+	if err != nil {
+		return fmt.Errorf("failed to describe DB cluster %s: %w", record.Cluster, err)
+	}
+	if len(clusters.DBClusters) == 1 {
+		cluster := clusters.DBClusters[0]
+		record.SubnetGroup = aws.ToString(cluster.DBSubnetGroup)
+		record.SecurityGroups = securityGroupIDs(cluster.VpcSecurityGroups)
+	}
+
+	created, err := client.CreateDBClusterSnapshot(ctx, &rds.CreateDBClusterSnapshotInput{
+		DBClusterIdentifier:         aws.String(record.Cluster),
+		DBClusterSnapshotIdentifier: aws.String(record.Identifier),
+		Tags:                        tags,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot of DB cluster %s: %w", record.Cluster, err)
+	}
+	record.ARN = aws.ToString(created.DBClusterSnapshot.DBClusterSnapshotArn)
+
+	out, err := rds.NewDBClusterSnapshotAvailableWaiter(client).WaitForOutput(ctx,
+		&rds.DescribeDBClusterSnapshotsInput{DBClusterSnapshotIdentifier: aws.String(record.Identifier)}, rdsSnapshotTimeout)
+	if err != nil {
+		return fmt.Errorf("snapshot %s did not become available: %w", record.Identifier, err)
+	}
+	if len(out.DBClusterSnapshots) == 1 {
+		snapshot := out.DBClusterSnapshots[0]
+		record.Engine = aws.ToString(snapshot.Engine)
+		record.EngineVersion = aws.ToString(snapshot.EngineVersion)
+		record.Size = int64(aws.ToInt32(snapshot.AllocatedStorage)) << 30
+	}
+	return nil
+}
+
+// deleteRDSSnapshot removes a snapshot left by a failed backup. RDS refuses while the snapshot
+// is still being created, in which case it stays behind, tagged managed-by=backup-tool.
+func deleteRDSSnapshot(client *rds.Client, record rdsSnapshotRecord) {
+	ctx := context.Background()
+	if record.Cluster != "" {
+		client.DeleteDBClusterSnapshot(ctx, &rds.DeleteDBClusterSnapshotInput{DBClusterSnapshotIdentifier: aws.String(record.Identifier)})
+		return
+	}
+	client.DeleteDBSnapshot(ctx, &rds.DeleteDBSnapshotInput{DBSnapshotIdentifier: aws.String(record.Identifier)})
+}
+
+// RestoreRDSSnapshot creates a DB instance, or an Aurora cluster, from the snapshot recorded at
+// backupPath, in the subnet and security groups of the snapshotted one. Restored clusters
+// have no instances yet; one has to be added before the database can be reached.
+func (r *RestoreRepositoryImpl) RestoreRDSSnapshot(config domain.DatabaseConfig, backupPath string) (string, error) {
+	record, err := readRDSSnapshotRecord(backupPath)
+	if err != nil {
+		return "", err
+	}
+	if config.Managed == nil || config.Managed.Region == "" {
+		// The snapshot lives in the region it was taken in, whatever the aws CLI defaults to now
+		managed := domain.ManagedOptions{Provider: domain.ManagedRDS, Region: record.Region}
+		if config.Managed != nil {
+			managed = *config.Managed
+			managed.Region = record.Region
+		}
+		config.Managed = &managed
+	}
+	ctx := r.ctx
+	client, err := rdsClient(ctx, config)
+	if err != nil {
+		return "", err
+	}
+
+	source := record.Instance
+	if record.Cluster != "" {
+		source = record.Cluster
+	}
+	identifier := rdsRestoreIdentifier(source)
+
+	if record.Cluster != "" {
+		_, err = client.RestoreDBClusterFromSnapshot(ctx, &rds.RestoreDBClusterFromSnapshotInput{
+			DBClusterIdentifier: aws.String(identifier),
+			SnapshotIdentifier:  aws.String(record.ARN),
+			Engine:              aws.String(record.Engine),
+			DBSubnetGroupName:   optionalString(record.SubnetGroup),
+			VpcSecurityGroupIds: record.SecurityGroups,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to restore DB cluster from snapshot %s: %w", record.Identifier, err)
+		}
+		return identifier, nil
+	}
+
+	_, err = client.RestoreDBInstanceFromDBSnapshot(ctx, &rds.RestoreDBInstanceFromDBSnapshotInput{
+		DBInstanceIdentifier: aws.String(identifier),
+		DBSnapshotIdentifier: aws.String(record.ARN),
+		DBInstanceClass:      optionalString(record.InstanceClass),
+		DBSubnetGroupName:    optionalString(record.SubnetGroup),
+		VpcSecurityGroupIds:  record.SecurityGroups,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to restore DB instance from snapshot %s: %w", record.Identifier, err)
+	}
+	return identifier, nil
+}
+
+// readRDSSnapshotRecord reads the record an RDS snapshot backup wrote
+func readRDSSnapshotRecord(path string) (rdsSnapshotRecord, error) {
+	var record rdsSnapshotRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return record, fmt.Errorf("failed to read snapshot record: %w", err)
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, fmt.Errorf("invalid snapshot record: %w", err)
+	}
+	if record.ARN == "" || record.Identifier == "" || record.Instance == "" && record.Cluster == "" {
+		return record, fmt.Errorf("snapshot record %s does not name an RDS snapshot", path)
+	}
+	return record, nil
+}
+
+// rdsIdentifier turns a backup name into an RDS snapshot or export task identifier: letters,
+// digits and single dashes, starting with a letter and at most max characters long
+func rdsIdentifier(backupPath string, max int) string {
+	name := repeatedDashes.ReplaceAllString(snapshotName(backupPath), "-")
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		name = "b-" + name
+	}
+	if len(name) > max {
+		name = "b-" + strings.TrimLeft(name[len(name)-max+2:], "-")
+	}
+	return strings.TrimRight(name, "-")
+}
+
+// rdsRestoreIdentifier names the instance or cluster restored from a snapshot of source after
+// it, with the time of the restore, in the 63 characters RDS allows
+func rdsRestoreIdentifier(source string) string {
+	suffix := "-restore-" + time.Now().Format("20060102-150405")
+	if len(source) > 63-len(suffix) {
+		source = strings.TrimRight(source[:63-len(suffix)], "-")
+	}
+	return source + suffix
+}
+
+// securityGroupIDs lists the VPC security groups an instance or cluster is a member of
+func securityGroupIDs(memberships []types.VpcSecurityGroupMembership) []string {
+	var ids []string
+	for _, membership := range memberships {
+		ids = append(ids, aws.ToString(membership.VpcSecurityGroupId))
+	}
+	return ids
+}
+
+// optionalString leaves empty settings unset, so RDS applies its default
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
@@ -0,0 +1,410 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// RestoreRepositoryImpl implements domain.RestoreRepository
+type RestoreRepositoryImpl struct {
+	*clientPool
+}
+
+// NewRestoreRepository creates a new restore repository
+func NewRestoreRepository() domain.RestoreRepository {
+	return &RestoreRepositoryImpl{
+		clientPool: newClientPool(),
+	}
+}
+
+// restorePostgres creates the target database if needed and loads a SQL dump into it with psql.
+// Roles and tablespaces saved next to the dump are created first, so object owners exist.
+func (r *RestoreRepositoryImpl) restorePostgres(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	if globalsPath := domain.GlobalsPath(backupPath); fileExists(globalsPath) {
+		err := readFromFile(globalsPath, func(in io.Reader) error {
+			return r.loadPostgresGlobals(config, method, namespace, in)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to restore roles and tablespaces: %w", err)
+		}
+	}
+
+	return readFromFile(backupPath, func(in io.Reader) error {
+		return r.loadPostgres(config, method, namespace, in)
+	})
+}
+
+// loadPostgres creates the target database if needed and runs psql on the dump read from in
+func (r *RestoreRepositoryImpl) loadPostgres(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, in io.Reader) error {
+	if config.Type == domain.DatabaseTypeTimescaleDB {
+		in = timescaleRestoring(in)
+	}
+
+	switch method {
+	case domain.BackupMethodDockerRun:
+		err := r.runContainer(RunOptions{
+			Image:   imageFor(config),
+			Command: []string{"sh", "-c", postgresRestoreScript(config.Host, config.User, config.Database)},
+			Env:     append([]string{fmt.Sprintf("PGPASSWORD=%s", config.Password)}, postgresTLSVars(config, method)...),
+			Binds:   certBinds(config),
+		}, in, io.Discard)
+		if err != nil {
+			return fmt.Errorf("docker run failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodDockerExec:
+		command := []string{"sh", "-c",
+			fmt.Sprintf("export %sPGPASSWORD=%s; %s",
+				postgresTLSEnv(config, method), shellQuote(config.Password), postgresRestoreScript("localhost", config.User, config.Database)),
+		}
+
+		if err := r.execContainer(config.Container, command, in, io.Discard); err != nil {
+			return fmt.Errorf("docker exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodKubectlExec:
+		command := []string{"sh", "-c",
+			fmt.Sprintf("export %sPGPASSWORD=%s; %s",
+				postgresTLSEnv(config, method), shellQuote(config.Password), postgresRestoreScript("localhost", config.User, config.Database)),
+		}
+
+		if err := r.execPod(config, namespace, command, in, io.Discard); err != nil {
+			return fmt.Errorf("pod exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodSSH:
+		command := []string{"sh", "-c",
+			fmt.Sprintf("export %sPGPASSWORD=%s; %s",
+				postgresTLSEnv(config, method), shellQuote(config.Password), postgresRestoreScript("localhost", config.User, config.Database)),
+		}
+
+		if err := r.execSSH(config, command, in, io.Discard); err != nil {
+			return fmt.Errorf("ssh exec failed: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown backup method: %s", method)
+}
+
+// restoreMySQL loads a SQL dump into a MySQL database
+func (r *RestoreRepositoryImpl) restoreMySQL(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	return readFromFile(backupPath, func(in io.Reader) error {
+		return r.loadMySQLCompatible(config, method, namespace, "mysql", in)
+	})
+}
+
+// restoreMariaDB loads a SQL dump into a MariaDB database
+func (r *RestoreRepositoryImpl) restoreMariaDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	return readFromFile(backupPath, func(in io.Reader) error {
+		return r.loadMySQLCompatible(config, method, namespace, "mariadb", in)
+	})
+}
+
+// loadMySQLCompatible creates the target database if needed and pipes the dump read from in
+// into the mysql client, for MySQL and MariaDB
+func (r *RestoreRepositoryImpl) loadMySQLCompatible(config domain.DatabaseConfig, method domain.BackupMethod, namespace, image string, in io.Reader) error {
+	switch method {
+	case domain.BackupMethodDockerRun:
+		err := r.runContainer(RunOptions{
+			Image:   fmt.Sprintf("%s:%s", image, config.Version),
+			Command: []string{"sh", "-c", mysqlRestoreScript(config.Host, config.User, config.Password, mysqlTLSFlags(config, method), config.Database)},
+			Binds:   certBinds(config),
+		}, in, io.Discard)
+		if err != nil {
+			return fmt.Errorf("docker run failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodDockerExec:
+		command := []string{"sh", "-c", mysqlRestoreScript("localhost", config.User, config.Password, mysqlTLSFlags(config, method), config.Database)}
+
+		if err := r.execContainer(config.Container, command, in, io.Discard); err != nil {
+			return fmt.Errorf("docker exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodKubectlExec:
+		command := []string{"sh", "-c", mysqlRestoreScript("localhost", config.User, config.Password, mysqlTLSFlags(config, method), config.Database)}
+
+		if err := r.execPod(config, namespace, command, in, io.Discard); err != nil {
+			return fmt.Errorf("pod exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodSSH:
+		command := []string{"sh", "-c", mysqlRestoreScript("localhost", config.User, config.Password, mysqlTLSFlags(config, method), config.Database)}
+
+		if err := r.execSSH(config, command, in, io.Discard); err != nil {
+			return fmt.Errorf("ssh exec failed: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown backup method: %s", method)
+}
+
+// restoreMongoDB loads the sourceDatabase collections of a mongodump directory or archive into a
+// MongoDB database with mongorestore, renaming their namespaces when the target database differs
+func (r *RestoreRepositoryImpl) restoreMongoDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, namespace, tempDir string) error {
+	return r.restoreMongo(config, method, backupPath, namespace, tempDir, mongoNamespaceArgs(sourceDatabase, config.Database))
+}
+
+// restoreMongo runs mongorestore with nsArgs on a mongodump directory or archive
+func (r *RestoreRepositoryImpl) restoreMongo(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace, tempDir string, nsArgs []string) error {
+	if info, err := os.Stat(backupPath); err == nil && !info.IsDir() {
+		// readFromFile undoes the archive's gzip, so mongorestore reads it plain
+		return readFromFile(backupPath, func(in io.Reader) error {
+			return r.loadMongoArchive(config, method, namespace, nsArgs, in)
+		})
+	}
+
+	ctx := r.ctx
+	timestamp := filepath.Base(backupPath)
+	dumpDir := path.Join(tempDir, timestamp)
+
+	if method != domain.BackupMethodDockerRun {
+		size, err := dirSize(backupPath)
+		if err != nil {
+			return err
+		}
+		if err := r.checkTempSpace(config, method, namespace, tempDir, size); err != nil {
+			return err
+		}
+	}
+
+	switch method {
+	case domain.BackupMethodDockerRun:
+		docker, err := r.docker()
+		if err != nil {
+			return err
+		}
+
+		hostDir, err := filepath.Abs(backupPath)
+		if err != nil {
+			return err
+		}
+
+		var stderr stderrBuffer
+		err = docker.Run(ctx, RunOptions{
+			Image:   fmt.Sprintf("mongo:%s", config.Version),
+			Command: append(append(append([]string{"mongorestore"}, mongoArgs(config, method)...), nsArgs...), "/restore"),
+			Binds:   append([]string{fmt.Sprintf("%s:/restore:ro", hostDir)}, certBinds(config)...),
+		}, nil, io.Discard, &stderr)
+		if err != nil {
+			return fmt.Errorf("docker run failed: %w", stderr.wrap(err))
+		}
+		return nil
+
+	case domain.BackupMethodDockerExec:
+		docker, err := r.docker()
+		if err != nil {
+			return err
+		}
+
+		// Copy the dump into the container
+		var stderr stderrBuffer
+		if err := docker.Exec(ctx, config.Container, []string{"mkdir", "-p", tempDir}, nil, io.Discard, &stderr); err != nil {
+			return fmt.Errorf("failed to prepare container: %w", stderr.wrap(err))
+		}
+		defer docker.Exec(context.Background(), config.Container, removeTempDir(dumpDir), nil, io.Discard, io.Discard)
+		if err := docker.CopyToContainer(ctx, config.Container, backupPath, tempDir); err != nil {
+			return fmt.Errorf("failed to copy backup to container: %w", err)
+		}
+
+		command := trackedCommand(dumpDir, append(append(append([]string{"mongorestore"}, mongoArgs(config, method)...), nsArgs...), dumpDir))
+		if err := docker.Exec(ctx, config.Container, command, nil, io.Discard, &stderr); err != nil {
+			return fmt.Errorf("failed to restore backup in container: %w", stderr.wrap(err))
+		}
+		return nil
+
+	case domain.BackupMethodKubectlExec:
+		kube, err := r.kubernetes(config)
+		if err != nil {
+			return err
+		}
+
+		// Copy the dump into the pod
+		defer kube.Exec(context.Background(), namespace, config.Pod, removeTempDir(dumpDir), nil, io.Discard, io.Discard)
+		if err := kube.CopyToPod(ctx, namespace, config.Pod, backupPath, tempDir); err != nil {
+			return fmt.Errorf("failed to copy backup to pod: %w", err)
+		}
+
+		var stderr stderrBuffer
+		command := trackedCommand(dumpDir, append(append(append([]string{"mongorestore"}, mongoArgs(config, method)...), nsArgs...), dumpDir))
+		if err := kube.Exec(ctx, namespace, config.Pod, command, nil, io.Discard, &stderr); err != nil {
+			return fmt.Errorf("failed to restore backup in pod: %w", stderr.wrap(err))
+		}
+		return nil
+
+	case domain.BackupMethodSSH:
+		client, err := r.ssh(config)
+		if err != nil {
+			return err
+		}
+
+		// Copy the dump to the database's machine
+		defer client.Exec(context.Background(), removeTempDir(dumpDir), nil, io.Discard, io.Discard)
+		if err := client.CopyTo(ctx, backupPath, tempDir); err != nil {
+			return fmt.Errorf("failed to copy backup over ssh: %w", err)
+		}
+
+		var stderr stderrBuffer
+		command := trackedCommand(dumpDir, append(append(append([]string{"mongorestore"}, mongoArgs(config, method)...), nsArgs...), dumpDir))
+		if err := client.Exec(ctx, command, nil, io.Discard, &stderr); err != nil {
+			return fmt.Errorf("failed to restore backup over ssh: %w", stderr.wrap(err))
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown backup method: %s", method)
+}
+
+// loadMongoArchive runs mongorestore --archive with nsArgs on the uncompressed archive read from in
+func (r *RestoreRepositoryImpl) loadMongoArchive(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, nsArgs []string, in io.Reader) error {
+	nsArgs = append(nsArgs[:len(nsArgs):len(nsArgs)], "--archive")
+
+	switch method {
+	case domain.BackupMethodDockerRun:
+		command := append(append([]string{"mongorestore"}, mongoArgs(config, method)...), nsArgs...)
+		if err := r.runContainer(RunOptions{Image: fmt.Sprintf("mongo:%s", config.Version), Command: command, Binds: certBinds(config)}, in, io.Discard); err != nil {
+			return fmt.Errorf("docker run failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodDockerExec:
+		command := append(append([]string{"mongorestore"}, mongoArgs(config, method)...), nsArgs...)
+		if err := r.execContainer(config.Container, command, in, io.Discard); err != nil {
+			return fmt.Errorf("docker exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodKubectlExec:
+		command := append(append([]string{"mongorestore"}, mongoArgs(config, method)...), nsArgs...)
+		if err := r.execPod(config, namespace, command, in, io.Discard); err != nil {
+			return fmt.Errorf("pod exec failed: %w", err)
+		}
+		return nil
+
+	case domain.BackupMethodSSH:
+		command := append(append([]string{"mongorestore"}, mongoArgs(config, method)...), nsArgs...)
+		if err := r.execSSH(config, command, in, io.Discard); err != nil {
+			return fmt.Errorf("ssh exec failed: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown backup method: %s", method)
+}
+
+// Query runs a SQL query with the engine's client, or a mongosh expression whose value is
+// printed, against config.Database and returns its output without surrounding space
+func (r *RestoreRepositoryImpl) Query(config domain.DatabaseConfig, method domain.BackupMethod, namespace, query string) (string, error) {
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+
+	var command []string
+	switch config.Type {
+	case domain.DatabaseTypePostgres, domain.DatabaseTypeTimescaleDB:
+		command = shellCommand("%sPGPASSWORD=%s psql -h %s -U %s -d %s -tAX -v ON_ERROR_STOP=1 -c %s",
+			postgresTLSEnv(config, method), shellQuote(config.Password), shellQuote(host), shellQuote(config.User), shellQuote(config.Database), shellQuote(query))
+
+	case domain.DatabaseTypeMySQL, domain.DatabaseTypeMariaDB:
+		command = shellCommand("mysql -h %s -u%s -p%s%s -N -B -e %s %s",
+			shellQuote(host), shellQuote(config.User), shellQuote(config.Password), mysqlTLSFlags(config, method), shellQuote(query), shellQuote(config.Database))
+
+	case domain.DatabaseTypeMongoDB:
+		// The legacy shell does not print the value of --eval, so both are told to
+		eval := fmt.Sprintf("db = db.getSiblingDB(%s); var result = (%s); print(typeof result === 'object' ? JSON.stringify(result) : result)",
+			strconv.Quote(config.Database), query)
+		args := mongoShellArgs(config, method)
+		command = shellCommand("if command -v mongosh >/dev/null 2>&1; then exec mongosh --quiet %s --eval %s; fi; exec mongo --quiet %s --eval %s",
+			args, shellQuote(eval), args, shellQuote(eval))
+
+	default:
+		return "", fmt.Errorf("checks are not supported for %s", config.Type)
+	}
+
+	var out bytes.Buffer
+	if err := r.runClient(config, method, namespace, command, nil, &out); err != nil {
+		return "", fmt.Errorf("query failed: %w", err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// timescaleRestoring brackets a plain dump with timescaledb_pre_restore and
+// timescaledb_post_restore, which keep the extension's triggers and background jobs from
+// interfering while hypertables and their chunks are loaded as they were dumped
+func timescaleRestoring(in io.Reader) io.Reader {
+	return io.MultiReader(
+		strings.NewReader("CREATE EXTENSION IF NOT EXISTS timescaledb;\nSELECT timescaledb_pre_restore();\n"),
+		in,
+		strings.NewReader("\nSELECT timescaledb_post_restore();\n"))
+}
+
+// postgresRestoreScript creates database unless it exists, then runs psql on stdin against it.
+// PGPASSWORD must already be set.
+func postgresRestoreScript(host, user, database string) string {
+	exists := fmt.Sprintf("SELECT 1 FROM pg_database WHERE datname = %s", sqlString(database))
+	return fmt.Sprintf(
+		"psql -h %[1]s -U %[2]s -d postgres -tAc %[4]s | grep -q 1 "+
+			"|| createdb -h %[1]s -U %[2]s %[3]s "+
+			"&& psql -h %[1]s -U %[2]s -d %[3]s -v ON_ERROR_STOP=1 -q",
+		shellQuote(host), shellQuote(user), shellQuote(database), shellQuote(exists))
+}
+
+// mysqlRestoreScript creates database unless it exists, then runs mysql on stdin against it.
+// tlsFlags are passed to both clients.
+func mysqlRestoreScript(host, user, password, tlsFlags, database string) string {
+	create := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", strings.ReplaceAll(database, "`", "``"))
+	return fmt.Sprintf(
+		"mysql -h %[1]s -u%[2]s -p%[3]s%[4]s -e %[6]s "+
+			"&& mysql -h %[1]s -u%[2]s -p%[3]s%[4]s %[5]s",
+		shellQuote(host), shellQuote(user), shellQuote(password), tlsFlags, shellQuote(database), shellQuote(create))
+}
+
+// mongoNamespaceArgs selects the source database's collections and maps them onto the target database
+func mongoNamespaceArgs(sourceDatabase, targetDatabase string) []string {
+	if sourceDatabase == "" {
+		sourceDatabase = targetDatabase
+	}
+
+	args := []string{"--nsInclude", fmt.Sprintf("%s.*", sourceDatabase)}
+	if sourceDatabase != targetDatabase {
+		args = append(args,
+			"--nsFrom", fmt.Sprintf("%s.*", sourceDatabase),
+			"--nsTo", fmt.Sprintf("%s.*", targetDatabase))
+	}
+	return args
+}
+
+// readFromFile opens backupPath and passes it to read, decompressed if it is compressed and
+// reassembled if it is packed into chunks
+func readFromFile(backupPath string, read func(in io.Reader) error) error {
+	f, err := openPlain(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer f.Close()
+
+	in, err := decompressed(f)
+	if err != nil {
+		return fmt.Errorf("failed to decompress backup file: %w", err)
+	}
+	defer in.Close()
+	return read(in)
+}
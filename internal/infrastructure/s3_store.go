@@ -0,0 +1,604 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/transfermanager"
+	tmtypes "github.com/aws/aws-sdk-go-v2/feature/s3/transfermanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// S3Store is the built-in domain.BackupStore for S3 buckets. With an Object Lock, every object
+// it uploads is locked until its own retention date, so the copy outlives anyone who gets
+// hold of the credentials, including ransomware.
+type S3Store struct {
+	mu     sync.Mutex
+	config domain.S3StoreConfig
+}
+
+const (
+	// resumableSize is the size from which files are uploaded in parts whose progress is kept
+	// next to them, so an interrupted upload goes on where it stopped rather than from zero
+	resumableSize = 64 << 20
+
+	s3PartSize = 16 << 20 // Smallest part of resumable uploads; larger files have larger parts
+	s3MaxParts = 10000    // Most parts S3 accepts for one object
+
+	// s3StreamPartSize is the part size of streamed uploads, whose size is not known up front,
+	// so a stream of up to s3MaxParts parts can be 625 GiB
+	s3StreamPartSize = 64 << 20
+)
+
+// s3UploadState is kept at domain.UploadStatePath while a resumable upload is under way. S3
+// knows which parts arrived; the state remembers the upload and the file it was started for.
+type s3UploadState struct {
+	Bucket   string    `json:"bucket"`
+	Key      string    `json:"key"`
+	UploadID string    `json:"upload_id"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	PartSize int64     `json:"part_size"`
+}
+
+// RegisterS3Stores registers the S3 stores declared in a configuration. Stores registered by
+// an earlier load of the configuration take the new settings, so a reload applies them.
+func RegisterS3Stores(configs []domain.S3StoreConfig) error {
+	for _, config := range configs {
+		existing, err := domain.LookupStore(config.Name)
+		if err != nil {
+			domain.RegisterStore(&S3Store{config: config})
+			continue
+		}
+		store, ok := existing.(*S3Store)
+		if !ok {
+			return fmt.Errorf("s3 store %s: a store plugin of that name is installed", config.Name)
+		}
+		store.mu.Lock()
+		store.config = config
+		store.mu.Unlock()
+	}
+	return nil
+}
+
+// Name is the name the store was declared with
+func (s *S3Store) Name() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config.Name
+}
+
+// Put uploads the backup at path under the store's prefix and key. A directory is uploaded
+// file by file below key. Each object only appears once it is complete, multipart uploads
+// included, and all of them share one retention date. Large files resume an upload of theirs
+// that was interrupted, see resumableSize.
+func (s *S3Store) Put(path, key string) error {
+	config, client, until, err := s.prepare()
+	if err != nil {
+		return err
+	}
+	uploader := transfermanager.New(client, func(o *transfermanager.Options) {
+		o.Concurrency = config.Concurrency
+	})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return s.uploadFile(client, uploader, config, path, key, info, until)
+	}
+	return filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return s.uploadFile(client, uploader, config, file, key+"/"+filepath.ToSlash(rel), info, until)
+	})
+}
+
+// Stream uploads what r yields to the bucket under key, in parts of s3StreamPartSize of which
+// config.Concurrency are uploaded at once while the next one is read. An error from r aborts
+// the upload, so nothing appears under key.
+func (s *S3Store) Stream(key string, r io.Reader) error {
+	config, client, until, err := s.prepare()
+	if err != nil {
+		return err
+	}
+	uploader := transfermanager.New(client, func(o *transfermanager.Options) {
+		o.Concurrency = config.Concurrency
+		o.PartSizeBytes = s3StreamPartSize
+	})
+	return s.upload(uploader, config, r, key, until)
+}
+
+// prepare returns the store's settings, with the default concurrency filled in, a client for
+// them and, with an Object Lock, the date objects uploaded now are locked until
+func (s *S3Store) prepare() (domain.S3StoreConfig, *s3.Client, *time.Time, error) {
+	s.mu.Lock()
+	config := s.config
+	s.mu.Unlock()
+
+	client, err := s3Client(interrupted, config)
+	if err != nil {
+		return config, nil, nil, err
+	}
+	if config.Concurrency == 0 {
+		config.Concurrency = domain.DefaultS3Concurrency
+	}
+	var until *time.Time
+	if config.ObjectLock != nil {
+		retainUntil := config.ObjectLock.RetainUntil(time.Now())
+		until = &retainUntil
+	}
+	return config, client, until, nil
+}
+
+// uploadFile copies one file to the bucket, resumably if it is large enough
+func (s *S3Store) uploadFile(client *s3.Client, uploader *transfermanager.Client, config domain.S3StoreConfig, path, key string, info fs.FileInfo, until *time.Time) error {
+	if info.Size() >= resumableSize {
+		return s.uploadResumable(client, config, path, key, info, until)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s.upload(uploader, config, file, key, until)
+}
+
+// upload copies body to the bucket under key, locked until until if that is set
+func (s *S3Store) upload(uploader *transfermanager.Client, config domain.S3StoreConfig, body io.Reader, key string, until *time.Time) error {
+	input := &transfermanager.UploadObjectInput{
+		Bucket: aws.String(config.Bucket),
+		Key:    aws.String(config.Prefix + key),
+		Body:   body,
+		// S3 only accepts locked objects with a checksum of their content
+		ChecksumAlgorithm: tmtypes.ChecksumAlgorithmCrc32,
+	}
+	if until != nil {
+		input.ObjectLockMode = tmtypes.ObjectLockMode(strings.ToUpper(config.ObjectLock.Mode))
+		input.ObjectLockRetainUntilDate = until
+	}
+	input.StorageClass = tmtypes.StorageClass(storageClass(config, key))
+
+	if _, err := uploader.UploadObject(interrupted, input); err != nil {
+		return fmt.Errorf("failed to upload s3://%s/%s: %w", config.Bucket, config.Prefix+key, err)
+	}
+	return nil
+}
+
+// uploadResumable copies one file to the bucket in a multipart upload whose state is kept
+// next to the file until the upload is complete. An upload of the same file that an earlier
+// attempt left behind is taken up again, with only the parts S3 lacks uploaded.
+func (s *S3Store) uploadResumable(client *s3.Client, config domain.S3StoreConfig, path, key string, info fs.FileInfo, until *time.Time) error {
+	statePath := domain.UploadStatePath(path, config.Name)
+	objectKey := config.Prefix + key
+	state, done, err := s.resume(client, config, statePath, objectKey, info)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state, err = s.startUpload(client, config, statePath, objectKey, info, until)
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	count := int32((info.Size() + state.PartSize - 1) / state.PartSize)
+	partSize := func(number int32) int64 {
+		return min(state.PartSize, info.Size()-int64(number-1)*state.PartSize)
+	}
+	completed := make([]s3types.CompletedPart, count)
+	var todo []int32
+	for number := int32(1); number <= count; number++ {
+		part, ok := done[number]
+		if ok && aws.ToInt64(part.Size) == partSize(number) {
+			completed[number-1] = s3types.CompletedPart{PartNumber: aws.Int32(number), ETag: part.ETag, ChecksumCRC32: part.ChecksumCRC32}
+			continue
+		}
+		todo = append(todo, number)
+	}
+
+	// The first part to fail stops the others; those that arrived are kept for the next attempt
+	ctx, cancel := context.WithCancel(interrupted)
+	defer cancel()
+	numbers := make(chan int32)
+	errs := make(chan error, config.Concurrency)
+	var wg sync.WaitGroup
+	for range min(config.Concurrency, len(todo)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range numbers {
+				size := partSize(number)
+				out, err := client.UploadPart(ctx, &s3.UploadPartInput{
+					Bucket:            aws.String(config.Bucket),
+					Key:               aws.String(objectKey),
+					UploadId:          aws.String(state.UploadID),
+					PartNumber:        aws.Int32(number),
+					Body:              io.NewSectionReader(file, int64(number-1)*state.PartSize, size),
+					ContentLength:     aws.Int64(size),
+					ChecksumAlgorithm: s3types.ChecksumAlgorithmCrc32,
+				})
+				if err != nil {
+					errs <- fmt.Errorf("part %d: %w", number, err)
+					cancel()
+					return
+				}
+				completed[number-1] = s3types.CompletedPart{PartNumber: aws.Int32(number), ETag: out.ETag, ChecksumCRC32: out.ChecksumCRC32}
+			}
+		}()
+	}
+feed:
+	for _, number := range todo {
+		select {
+		case numbers <- number:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(numbers)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return fmt.Errorf("failed to upload s3://%s/%s, to be resumed: %w", config.Bucket, objectKey, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to upload s3://%s/%s, to be resumed: %w", config.Bucket, objectKey, err)
+	}
+
+	_, err = client.CompleteMultipartUpload(interrupted, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(config.Bucket),
+		Key:             aws.String(objectKey),
+		UploadId:        aws.String(state.UploadID),
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete the upload of s3://%s/%s: %w", config.Bucket, objectKey, err)
+	}
+	os.Remove(statePath)
+	return nil
+}
+
+// resume returns the upload the state at statePath records for the file, with the parts S3
+// has of it, or nil if there is none to go on with. An upload started for another version of
+// the file, or for another bucket or key, is aborted.
+func (s *S3Store) resume(client *s3.Client, config domain.S3StoreConfig, statePath, objectKey string, info fs.FileInfo) (*s3UploadState, map[int32]s3types.Part, error) {
+	content, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil, nil, nil
+	}
+	var state s3UploadState
+	if err := json.Unmarshal(content, &state); err != nil || state.UploadID == "" {
+		return nil, nil, nil
+	}
+	if state.Bucket != config.Bucket || state.Key != objectKey || state.Size != info.Size() || !state.ModTime.Equal(info.ModTime()) {
+		client.AbortMultipartUpload(interrupted, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(state.Bucket),
+			Key:      aws.String(state.Key),
+			UploadId: aws.String(state.UploadID),
+		})
+		return nil, nil, nil
+	}
+
+	parts := make(map[int32]s3types.Part)
+	pages := s3.NewListPartsPaginator(client, &s3.ListPartsInput{
+		Bucket:   aws.String(state.Bucket),
+		Key:      aws.String(state.Key),
+		UploadId: aws.String(state.UploadID),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(interrupted)
+		var noSuchUpload *s3types.NoSuchUpload
+		if errors.As(err, &noSuchUpload) {
+			// Aborted, e.g. by a lifecycle rule, so the upload starts over
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list the uploaded parts of s3://%s/%s: %w", state.Bucket, state.Key, err)
+		}
+		for _, part := range page.Parts {
+			parts[aws.ToInt32(part.PartNumber)] = part
+		}
+	}
+	return &state, parts, nil
+}
+
+// startUpload starts a multipart upload of the file, locked until until if that is set, and
+// keeps its state at statePath
+func (s *S3Store) startUpload(client *s3.Client, config domain.S3StoreConfig, statePath, objectKey string, info fs.FileInfo, until *time.Time) (*s3UploadState, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(config.Bucket),
+		Key:    aws.String(objectKey),
+		// S3 only accepts locked objects with a checksum of their content
+		ChecksumAlgorithm: s3types.ChecksumAlgorithmCrc32,
+	}
+	if until != nil {
+		input.ObjectLockMode = s3types.ObjectLockMode(strings.ToUpper(config.ObjectLock.Mode))
+		input.ObjectLockRetainUntilDate = until
+	}
+	input.StorageClass = s3types.StorageClass(storageClass(config, objectKey))
+	out, err := client.CreateMultipartUpload(interrupted, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start uploading s3://%s/%s: %w", config.Bucket, objectKey, err)
+	}
+
+	state := &s3UploadState{
+		Bucket:   config.Bucket,
+		Key:      objectKey,
+		UploadID: aws.ToString(out.UploadId),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		PartSize: max(s3PartSize, (info.Size()+s3MaxParts-1)/s3MaxParts),
+	}
+	content, err := json.Marshal(state)
+	if err == nil {
+		err = os.WriteFile(statePath, content, 0o600)
+	}
+	if err != nil {
+		// An upload that could not be resumed is not worth keeping open
+		client.AbortMultipartUpload(interrupted, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(config.Bucket),
+			Key:      aws.String(objectKey),
+			UploadId: out.UploadId,
+		})
+		return nil, fmt.Errorf("failed to keep the state of uploading s3://%s/%s: %w", config.Bucket, objectKey, err)
+	}
+	return state, nil
+}
+
+// storageClass returns the storage class the object under key is uploaded in: config's for
+// backups and their parts, and the default for the small files that travel with them, which
+// restores and catalog sync read without retrieving them first
+func storageClass(config domain.S3StoreConfig, key string) string {
+	if domain.IsChecksumFile(key) || domain.IsSignatureFile(key) || domain.IsKeyFile(key) ||
+		domain.IsGlobalsFile(key) || domain.IsManifestKey(key) {
+		return ""
+	}
+	return config.StorageClass
+}
+
+// Get downloads the object under the store's prefix and key to path. Without one, the objects
+// below key are downloaded into a directory at path, as Put uploads directories. Objects in
+// Glacier that were not retrieved fail with domain.ErrArchived, see Retrieve.
+func (s *S3Store) Get(key, path string) error {
+	s.mu.Lock()
+	config := s.config
+	s.mu.Unlock()
+
+	client, err := s3Client(interrupted, config)
+	if err != nil {
+		return err
+	}
+	err = s.download(client, config, config.Prefix+key, path)
+	var noSuchKey *s3types.NoSuchKey
+	if !errors.As(err, &noSuchKey) {
+		return err
+	}
+
+	prefix := config.Prefix + key + "/"
+	found := false
+	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(config.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(interrupted)
+		if err != nil {
+			return fmt.Errorf("failed to list s3://%s/%s: %w", config.Bucket, prefix, err)
+		}
+		for _, object := range page.Contents {
+			rel := filepath.FromSlash(strings.TrimPrefix(aws.ToString(object.Key), prefix))
+			if strings.HasSuffix(aws.ToString(object.Key), "/") {
+				continue
+			}
+			// A key with ".." in it must not write outside path
+			if !filepath.IsLocal(rel) {
+				return fmt.Errorf("refusing to download s3://%s/%s outside %s", config.Bucket, aws.ToString(object.Key), path)
+			}
+			if err := s.download(client, config, aws.ToString(object.Key), filepath.Join(path, rel)); err != nil {
+				return err
+			}
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("s3://%s/%s: %w", config.Bucket, config.Prefix+key, domain.ErrNotInStore)
+	}
+	return nil
+}
+
+// List returns the keys below prefix, without the store's own prefix
+func (s *S3Store) List(prefix string) ([]string, error) {
+	s.mu.Lock()
+	config := s.config
+	s.mu.Unlock()
+
+	client, err := s3Client(interrupted, config)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(config.Bucket),
+		Prefix: aws.String(config.Prefix + prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(interrupted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list s3://%s/%s: %w", config.Bucket, config.Prefix+prefix, err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, strings.TrimPrefix(aws.ToString(object.Key), config.Prefix))
+		}
+	}
+	return keys, nil
+}
+
+// Retrieve starts restoring the object under the store's prefix and key from Glacier, or the
+// objects below key for a directory, for config.Retrieval.Days, unless that is under way, and
+// reports whether all of them can be downloaded
+func (s *S3Store) Retrieve(key string) (bool, error) {
+	s.mu.Lock()
+	config := s.config
+	s.mu.Unlock()
+
+	client, err := s3Client(interrupted, config)
+	if err != nil {
+		return false, err
+	}
+	ready, err := s.retrieve(client, config, config.Prefix+key)
+	var notFound *s3types.NotFound
+	if !errors.As(err, &notFound) {
+		return ready, err
+	}
+
+	prefix := config.Prefix + key + "/"
+	found := false
+	ready = true
+	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(config.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(interrupted)
+		if err != nil {
+			return false, fmt.Errorf("failed to list s3://%s/%s: %w", config.Bucket, prefix, err)
+		}
+		for _, object := range page.Contents {
+			found = true
+			// Every object is asked for at once rather than one after another
+			objectReady, err := s.retrieve(client, config, aws.ToString(object.Key))
+			if err != nil {
+				return false, err
+			}
+			ready = ready && objectReady
+		}
+	}
+	if !found {
+		return false, fmt.Errorf("s3://%s/%s: %w", config.Bucket, config.Prefix+key, domain.ErrNotInStore)
+	}
+	return ready, nil
+}
+
+// retrieve starts restoring one object from Glacier if it is archived there and not restored
+// or being restored yet, and reports whether it can be downloaded
+func (s *S3Store) retrieve(client *s3.Client, config domain.S3StoreConfig, objectKey string) (bool, error) {
+	head, err := client.HeadObject(interrupted, &s3.HeadObjectInput{
+		Bucket: aws.String(config.Bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to look up s3://%s/%s: %w", config.Bucket, objectKey, err)
+	}
+	if head.StorageClass != s3types.StorageClassGlacier && head.StorageClass != s3types.StorageClassDeepArchive {
+		return true, nil
+	}
+	// S3 reports a restore as ongoing-request="true" until the copy is there to download
+	if restore := aws.ToString(head.Restore); restore != "" {
+		return strings.Contains(restore, `ongoing-request="false"`), nil
+	}
+
+	tier := config.Retrieval.Tier
+	if tier == "" {
+		tier = domain.RetrievalStandard
+	}
+	days := config.Retrieval.Days
+	if days == 0 {
+		days = domain.DefaultRetrievalDays
+	}
+	_, err = client.RestoreObject(interrupted, &s3.RestoreObjectInput{
+		Bucket: aws.String(config.Bucket),
+		Key:    aws.String(objectKey),
+		RestoreRequest: &s3types.RestoreRequest{
+			Days:                 aws.Int32(int32(days)),
+			GlacierJobParameters: &s3types.GlacierJobParameters{Tier: s3types.Tier(strings.ToUpper(tier[:1]) + tier[1:])},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve s3://%s/%s from %s: %w", config.Bucket, objectKey, head.StorageClass, err)
+	}
+	return false, nil
+}
+
+// download copies one object to a new file at path
+func (s *S3Store) download(client *s3.Client, config domain.S3StoreConfig, objectKey, path string) error {
+	object, err := client.GetObject(interrupted, &s3.GetObjectInput{
+		Bucket: aws.String(config.Bucket),
+		Key:    aws.String(objectKey),
+	})
+	var archived *s3types.InvalidObjectState
+	if errors.As(err, &archived) {
+		return fmt.Errorf("s3://%s/%s is %w", config.Bucket, objectKey, domain.ErrArchived)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download s3://%s/%s: %w", config.Bucket, objectKey, err)
+	}
+	defer object.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, object.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to download s3://%s/%s: %w", config.Bucket, objectKey, err)
+	}
+	return nil
+}
+
+// s3Client returns an S3 client using the AWS SDK's default credential chain, as rdsClient does
+func s3Client(ctx context.Context, config domain.S3StoreConfig) (*s3.Client, error) {
+	var options []func(*awsconfig.LoadOptions) error
+	if config.Region != "" {
+		options = append(options, awsconfig.WithRegion(config.Region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("no AWS region configured; set region on s3 store %s", config.Name)
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+			o.UsePathStyle = true
+		}
+	}), nil
+}
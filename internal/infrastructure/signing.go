@@ -0,0 +1,241 @@
+package infrastructure
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// signatureHeader starts the message a signature is made over, so it cannot be mistaken for
+// one of another tool or version
+const signatureHeader = "backup-tool signature v1\n"
+
+// signatureFile is the content of a detached signature: the SHA-256 of every file of a backup
+// and an Ed25519 signature over them
+type signatureFile struct {
+	Algorithm string       `json:"algorithm"`
+	KeyID     string       `json:"key_id"`
+	Files     []signedFile `json:"files"`
+	Signature string       `json:"signature"`
+}
+
+// signedFile is one file of a signed backup, named relative to the backup's directory
+type signedFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+// SignBackup hashes the backup at path and writes the signature next to it, replacing an
+// older one at once so a restore never reads half of it
+func (r *BackupRepositoryImpl) SignBackup(path, keyFile string) error {
+	key, err := readPrivateKey(keyFile)
+	if err != nil {
+		return err
+	}
+	files, err := backupDigests(path)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(signatureFile{
+		Algorithm: "ed25519",
+		KeyID:     keyID(key.Public().(ed25519.PublicKey)),
+		Files:     files,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedMessage(files))),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	sigPath := domain.SignaturePath(path)
+	if err := os.WriteFile(sigPath+".tmp", append(content, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write signature: %w", err)
+	}
+	if err := os.Rename(sigPath+".tmp", sigPath); err != nil {
+		os.Remove(sigPath + ".tmp")
+		return fmt.Errorf("failed to write signature: %w", err)
+	}
+	return nil
+}
+
+// VerifySignature checks that the signature of the backup at path was made with the key in
+// keyFile and that every file it lists, and no other, still has the hash it was signed with
+func (r *RestoreRepositoryImpl) VerifySignature(path, keyFile string) error {
+	key, err := readPublicKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(domain.SignaturePath(path))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s is not signed", domain.ErrSignatureInvalid, path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+	var sig signatureFile
+	if err := json.Unmarshal(content, &sig); err != nil {
+		return fmt.Errorf("%w: unreadable signature %s: %v", domain.ErrSignatureInvalid, domain.SignaturePath(path), err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil || sig.Algorithm != "ed25519" || !ed25519.Verify(key, signedMessage(sig.Files), signature) {
+		if sig.KeyID != "" && sig.KeyID != keyID(key) {
+			return fmt.Errorf("%w: %s was signed with key %s, not %s", domain.ErrSignatureInvalid, path, sig.KeyID, keyID(key))
+		}
+		return fmt.Errorf("%w: the signature of %s is not valid", domain.ErrSignatureInvalid, path)
+	}
+
+	files, err := backupDigests(path)
+	if err != nil {
+		return err
+	}
+	signed := make(map[string]string, len(sig.Files))
+	for _, file := range sig.Files {
+		signed[file.Name] = file.SHA256
+	}
+	for _, file := range files {
+		hash, ok := signed[file.Name]
+		if !ok {
+			return fmt.Errorf("%w: %s was added after the backup was signed", domain.ErrSignatureInvalid, file.Name)
+		}
+		if hash != file.SHA256 {
+			return fmt.Errorf("%w: %s changed after it was signed", domain.ErrSignatureInvalid, file.Name)
+		}
+		delete(signed, file.Name)
+	}
+	for name := range signed {
+		return fmt.Errorf("%w: %s was removed after the backup was signed", domain.ErrSignatureInvalid, name)
+	}
+	return nil
+}
+
+// backupDigests hashes the files of the backup at path, see backupFiles. Files are named
+// relative to the backup's directory, so the signature also covers the backup's name.
+func backupDigests(path string) ([]signedFile, error) {
+	paths, err := backupFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []signedFile
+	for _, file := range paths {
+		name, err := filepath.Rel(filepath.Dir(path), file)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := fileDigest(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", file, err)
+		}
+		files = append(files, signedFile{Name: filepath.ToSlash(name), SHA256: sum})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// fileDigest returns the hex SHA-256 of the content of the file at path as restores read it:
+// uncompressed and reassembled from its chunks. Packing keeps the content but not the gzip
+// stream, so hashing the file as it is would break the signature of every packed backup.
+func fileDigest(path string) (string, error) {
+	f, err := openPlain(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	in, err := decompressed(f)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, in); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// signedMessage is what a signature is made over: one line with the hash and name of each file
+func signedMessage(files []signedFile) []byte {
+	var message strings.Builder
+	message.WriteString(signatureHeader)
+	for _, file := range files {
+		fmt.Fprintf(&message, "%s %s\n", file.SHA256, file.Name)
+	}
+	return []byte(message.String())
+}
+
+// keyID names a public key by the start of its SHA-256, to tell keys apart in errors
+func keyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// readPrivateKey reads an Ed25519 private key from a PKCS #8 PEM file
+func readPrivateKey(keyFile string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", keyFile, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an Ed25519 key", keyFile)
+	}
+	return private, nil
+}
+
+// readPublicKey reads an Ed25519 public key from a PEM file, which may also hold the private
+// key it belongs to
+func readPublicKey(keyFile string) (ed25519.PublicKey, error) {
+	block, err := readPEM(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "PRIVATE KEY" {
+		private, err := readPrivateKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return private.Public().(ed25519.PublicKey), nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("verification key %s: %w", keyFile, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("verification key %s is not an Ed25519 key", keyFile)
+	}
+	return public, nil
+}
+
+// readPEM returns the first PEM block of keyFile
+func readPEM(keyFile string) (*pem.Block, error) {
+	content, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s holds no PEM key", keyFile)
+	}
+	return block, nil
+}
@@ -0,0 +1,200 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHClient runs commands on a remote machine over SSH, so the dump tools installed next to a
+// database on a VM can be used without Docker or Kubernetes
+type SSHClient struct {
+	client *ssh.Client
+	where  string // user@host, for the command log
+}
+
+// NewSSHClient connects to target, [user@]host[:port], with the private key in keyFile, or
+// with the keys of the SSH agent and ~/.ssh when keyFile is empty. The host key has to be in
+// ~/.ssh/known_hosts.
+func NewSSHClient(target, keyFile string) (*SSHClient, error) {
+	userName, address := sshAddress(target)
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the home directory: %w", err)
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("~/.ssh/known_hosts does not exist, add %s with ssh-keyscan or by connecting once with ssh", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	auth, err := sshAuth(keyFile, home)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            userName,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         connectTimeout * time.Second,
+	})
+	if err != nil {
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return nil, fmt.Errorf("%s is not in ~/.ssh/known_hosts, add it with ssh-keyscan or by connecting once with ssh", address)
+		}
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	return &SSHClient{client: client, where: "ssh " + userName + "@" + address}, nil
+}
+
+// sshAddress splits target into the user, the current one by default, and host:port, port 22
+// by default
+func sshAddress(target string) (string, string) {
+	userName, host := "", target
+	if i := strings.LastIndex(target, "@"); i >= 0 {
+		userName, host = target[:i], target[i+1:]
+	}
+	if userName == "" {
+		if current, err := user.Current(); err == nil {
+			userName = current.Username
+		}
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(22))
+	}
+	return userName, host
+}
+
+// sshAuth returns keyFile's key, or the SSH agent's keys followed by the unencrypted default keys
+// in ~/.ssh
+func sshAuth(keyFile, home string) ([]ssh.AuthMethod, error) {
+	if keyFile != "" {
+		if rest, ok := strings.CutPrefix(keyFile, "~/"); ok {
+			keyFile = filepath.Join(home, rest)
+		}
+		signer, err := readSSHKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+
+	var auth []ssh.AuthMethod
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		if signer, err := readSSHKey(filepath.Join(home, ".ssh", name)); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("no SSH key found: set ssh_key, start an SSH agent or create ~/.ssh/id_ed25519")
+	}
+	return auth, nil
+}
+
+func readSSHKey(file string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH key %s (encrypted keys need an SSH agent): %w", file, err)
+	}
+	return signer, nil
+}
+
+// Exec runs a command on the remote machine through its login shell, streaming stdin to it and
+// its output to stdout and stderr. Cancelling ctx closes the session, which ends the command.
+func (c *SSHClient) Exec(ctx context.Context, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	logCommand(c.where, command)
+	session, err := c.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if stdin != nil {
+		// Copied apart from Wait, which would otherwise block on stdin after the command exited
+		pipe, err := session.StdinPipe()
+		if err != nil {
+			return fmt.Errorf("failed to open SSH session: %w", err)
+		}
+		go func() {
+			io.Copy(pipe, stdin)
+			pipe.Close()
+		}()
+	}
+
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = shellQuote(arg)
+	}
+	if err := session.Start(strings.Join(quoted, " ")); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		session.Signal(ssh.SIGTERM)
+		session.Close()
+		return ctx.Err()
+	}
+}
+
+// CopyTo copies srcDir, including its base name, into destDir on the remote machine
+func (c *SSHClient) CopyTo(ctx context.Context, srcDir, destDir string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(createTar(srcDir, writer))
+	}()
+	defer reader.Close()
+
+	var stderr stderrBuffer
+	command := shellCommand("mkdir -p %[1]s && tar xf - -C %[1]s", shellQuote(destDir))
+	return stderr.wrap(c.Exec(ctx, command, reader, io.Discard, &stderr))
+}
+
+// Alive reports whether the connection still answers
+func (c *SSHClient) Alive() bool {
+	_, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil)
+	return err == nil
+}
+
+// Close ends the connection
+func (c *SSHClient) Close() error {
+	return c.client.Close()
+}
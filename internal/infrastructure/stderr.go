@@ -0,0 +1,41 @@
+package infrastructure
+
+import (
+	"sync"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// maxStderr caps how much command stderr is kept for diagnostics
+const maxStderr = 16 * 1024
+
+// stderrBuffer keeps the tail of a command's stderr
+type stderrBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *stderrBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > maxStderr {
+		b.buf = b.buf[len(b.buf)-maxStderr:]
+	}
+	return len(p), nil
+}
+
+func (b *stderrBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// wrap attaches the captured stderr to a failed command's error
+func (b *stderrBuffer) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	return domain.NewCommandError(err, b.String())
+}
@@ -0,0 +1,211 @@
+package infrastructure
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// streamRecord is written to domain.StreamRecordPath of a dump streamed to a store, in place
+// of the dump, so the backup learns what the store received
+type streamRecord struct {
+	Store  string `json:"store"`
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// streamDump streams a dump to the store config.StreamTo under config.StreamKey instead of
+// writing it to backupPath, compressed as its name says if compress is set. Only the first and
+// last validationWindow bytes of the dump are kept, for the engine to verify them as it would
+// the whole dump before the store completes the copy, so a truncated dump never shows under
+// the key. The checksum file of the dump and its record are left next to backupPath.
+func streamDump(backupPath string, compress bool, config domain.DatabaseConfig, write func(w io.Writer) error) error {
+	store, err := domain.LookupStore(config.StreamTo)
+	if err != nil {
+		return err
+	}
+	streaming, ok := store.(domain.StreamingStore)
+	if !ok {
+		return fmt.Errorf("store %s cannot take streamed backups", config.StreamTo)
+	}
+	if config.StreamKey == "" {
+		return fmt.Errorf("no key to stream %s to", backupPath)
+	}
+
+	reader, writer := io.Pipe()
+	stored := make(chan error, 1)
+	go func() {
+		err := streaming.Stream(config.StreamKey, reader)
+		// A store that gave up stops the dump rather than leaving it blocked
+		if err != nil {
+			reader.CloseWithError(fmt.Errorf("store %s stopped taking the dump: %w", config.StreamTo, err))
+		}
+		stored <- err
+	}()
+
+	hash := sha256.New()
+	out := &countingWriter{w: io.MultiWriter(writer, hash)}
+	sample := &dumpSample{}
+	var w io.Writer
+	var compressor io.WriteCloser
+	var sampled chan error
+	switch {
+	case compress:
+		compressor = newCompressor(out, compressedExt(backupPath), config.Compression)
+		w = io.MultiWriter(compressor, sample)
+	case isCompressedPath(backupPath):
+		// Compressed where it was taken, so it is sampled as it decompresses
+		pipeReader, pipeWriter := io.Pipe()
+		sampled = make(chan error, 1)
+		go func() {
+			sampled <- sampleCompressed(pipeReader, sample)
+		}()
+		w, compressor = io.MultiWriter(out, pipeWriter), pipeWriter
+	default:
+		w = io.MultiWriter(out, sample)
+	}
+
+	err = write(w)
+	if compressor != nil {
+		if closeErr := compressor.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if sampled != nil {
+		if sampleErr := <-sampled; err == nil {
+			err = sampleErr
+		}
+	}
+	if err == nil {
+		err = verifySample(config.Type, backupPath, sample)
+	}
+	// Closing without an error lets the store complete the copy
+	writer.CloseWithError(err)
+	if storeErr := <-stored; err == nil {
+		err = storeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stream the dump to store %s: %w", config.StreamTo, err)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	files := []signedFile{{Name: filepath.Base(backupPath), SHA256: sum}}
+	if globals := domain.GlobalsPath(backupPath); globals != backupPath && fileExists(globals) {
+		globalsSum, err := rawDigest(globals)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", globals, err)
+		}
+		files = append(files, signedFile{Name: filepath.Base(globals), SHA256: globalsSum})
+	}
+	if err := writeChecksums(domain.ChecksumPath(backupPath), files); err != nil {
+		return err
+	}
+	return writeStreamRecord(domain.StreamRecordPath(backupPath), streamRecord{
+		Store:  config.StreamTo,
+		Key:    config.StreamKey,
+		Size:   out.n,
+		SHA256: sum,
+	})
+}
+
+// sampleCompressed decompresses what arrives on r into sample, reading r to its end whatever
+// the decompression makes of it, so the dump is never held up
+func sampleCompressed(r *io.PipeReader, sample *dumpSample) error {
+	in, err := decompressed(r)
+	if err == nil {
+		_, err = io.Copy(sample, in)
+		in.Close()
+	}
+	io.Copy(io.Discard, r)
+	return err
+}
+
+// verifySample writes the sample of a streamed dump to backupPath and has the engine of
+// dbType verify it, removing it again either way
+func verifySample(dbType domain.DatabaseType, backupPath string, sample *dumpSample) error {
+	engine, err := domain.LookupEngine(dbType)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(backupPath, sample.bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to write the sample of the dump: %w", err)
+	}
+	defer os.Remove(backupPath)
+	if err := engine.Verify(backupPath); err != nil {
+		return fmt.Errorf("backup validation failed: %w", err)
+	}
+	return nil
+}
+
+// dumpSample keeps the first and last validationWindow bytes written to it
+type dumpSample struct {
+	head []byte
+	tail []byte
+}
+
+func (s *dumpSample) Write(p []byte) (int, error) {
+	rest := p
+	if room := validationWindow - len(s.head); room > 0 {
+		take := min(room, len(rest))
+		s.head = append(s.head, rest[:take]...)
+		rest = rest[take:]
+	}
+	s.tail = append(s.tail, rest...)
+	if len(s.tail) > validationWindow {
+		s.tail = append(s.tail[:0], s.tail[len(s.tail)-validationWindow:]...)
+	}
+	return len(p), nil
+}
+
+// bytes returns a file that starts and ends as the dump did, in at most twice validationWindow
+// bytes
+func (s *dumpSample) bytes() []byte {
+	return append(append([]byte(nil), s.head...), s.tail...)
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeStreamRecord writes record to path
+func writeStreamRecord(path string, record streamRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write stream record: %w", err)
+	}
+	return nil
+}
+
+// readStreamRecord reads the record of a streamed dump
+func readStreamRecord(path string) (streamRecord, error) {
+	var record streamRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return record, fmt.Errorf("failed to read stream record: %w", err)
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, fmt.Errorf("invalid stream record: %w", err)
+	}
+	if record.Store == "" || record.Key == "" || record.Size == 0 {
+		return record, fmt.Errorf("stream record %s does not name a streamed dump", path)
+	}
+	return record, nil
+}
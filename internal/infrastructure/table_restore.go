@@ -0,0 +1,231 @@
+package infrastructure
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// pgDumpHeader matches the comment naming each object in a plain pg_dump, e.g.
+// "-- Name: users id; Type: DEFAULT; Schema: public; Owner: app"
+var pgDumpHeader = regexp.MustCompile(`^-- (?:Data for )?Name: (.+?); Type: (.+?); Schema: (.+?);`)
+
+// mysqlDumpHeader matches the comments mysqldump and mariadb-dump start each section with
+var mysqlDumpHeader = regexp.MustCompile("^-- (Table structure for table|Dumping data for table|Temporary (?:view|table) structure for view|Final view structure for view|Dumping events for database|Dumping routines for database|Current Database:|Dump completed)(?: `(.+)`)?")
+
+// RestoreTable loads a single table of a SQL dump into the target database, replacing the
+// table if it exists and leaving the rest of the database alone. table may be qualified with
+// its schema for PostgreSQL.
+func (r *RestoreRepositoryImpl) RestoreTable(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, table, namespace string) error {
+	var extract func(in io.Reader, w io.Writer, table string) (bool, error)
+	var load func(in io.Reader) error
+	switch config.Type {
+	case domain.DatabaseTypePostgres:
+		extract = extractPostgresTable
+		load = func(in io.Reader) error { return r.loadPostgres(config, method, namespace, in) }
+	case domain.DatabaseTypeMySQL, domain.DatabaseTypeMariaDB:
+		extract = extractMySQLTable
+		load = func(in io.Reader) error {
+			return r.loadMySQLCompatible(config, method, namespace, config.Type.String(), in)
+		}
+	default:
+		return fmt.Errorf("tables cannot be restored from %s backups", config.Type)
+	}
+
+	var found bool
+	err := readFromFile(backupPath, func(in io.Reader) error {
+		return pipeDump(
+			func(w io.Writer) error {
+				var err error
+				found, err = extract(in, w, table)
+				return err
+			},
+			load)
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("table %s not found in %s", table, backupPath)
+	}
+	return nil
+}
+
+// RestoreMongoCollection loads a single collection of sourceDatabase from a mongodump directory
+// or archive into config.Database, dropping the collection there first
+func (r *RestoreRepositoryImpl) RestoreMongoCollection(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, sourceDatabase, collection, namespace, tempDir string) error {
+	return r.restoreMongo(config, method, backupPath, namespace, tempDir, mongoCollectionArgs(sourceDatabase, config.Database, collection))
+}
+
+// mongoCollectionArgs selects one collection of the source database, maps it onto the target
+// database and replaces it there
+func mongoCollectionArgs(sourceDatabase, targetDatabase, collection string) []string {
+	if sourceDatabase == "" {
+		sourceDatabase = targetDatabase
+	}
+
+	args := []string{"--drop", "--nsInclude", fmt.Sprintf("%s.%s", sourceDatabase, collection)}
+	if sourceDatabase != targetDatabase {
+		args = append(args,
+			"--nsFrom", fmt.Sprintf("%s.%s", sourceDatabase, collection),
+			"--nsTo", fmt.Sprintf("%s.%s", targetDatabase, collection))
+	}
+	return args
+}
+
+// extractPostgresTable copies the settings at the top of a plain pg_dump and the sections of
+// one table to w: its definition, data, defaults, constraints, indexes, triggers, comments,
+// grants and the sequences it owns. The table is dropped first so the dump replaces it.
+func extractPostgresTable(in io.Reader, w io.Writer, table string) (bool, error) {
+	schema, name, qualified := strings.Cut(table, ".")
+	if !qualified {
+		schema, name = "", table
+	}
+	ref := `(?:"?` + regexp.QuoteMeta(schema) + `"?\.)`
+	if schema == "" {
+		ref = `(?:[^\s.]+\.)?`
+	}
+	ref += `"?` + regexp.QuoteMeta(name) + `"?`
+	onTable := regexp.MustCompile(`\bON (?:ONLY )?` + ref + `(?:\s|$)`)
+	alterTable := regexp.MustCompile(`\bALTER TABLE (?:ONLY )?` + ref + `\s`)
+	ownedBy := regexp.MustCompile(`\bOWNED BY ` + ref + `\.`)
+
+	reader := bufio.NewReader(in)
+	found := false
+	preamble := true
+	var section strings.Builder
+	var objectName, objectType, objectSchema string
+	sequences := make(map[string]string) // Definitions of sequences not known to be the table's yet
+	owned := make(map[string]bool)
+
+	belongs := func() bool {
+		if schema != "" && objectSchema != schema {
+			return false
+		}
+		first, _, _ := strings.Cut(objectName, " ")
+		body := section.String()
+		switch objectType {
+		case "TABLE", "TABLE DATA":
+			return objectName == name
+		case "CONSTRAINT", "FK CONSTRAINT", "DEFAULT", "TRIGGER", "POLICY", "ROW SECURITY":
+			return first == name
+		case "COMMENT", "ACL":
+			return objectName == "TABLE "+name || strings.HasPrefix(objectName, "COLUMN "+name+".")
+		case "INDEX":
+			return onTable.MatchString(body)
+		case "SEQUENCE":
+			// Identity columns are declared in a section named after their sequence
+			return alterTable.MatchString(body)
+		case "SEQUENCE OWNED BY":
+			return ownedBy.MatchString(body)
+		case "SEQUENCE SET":
+			return owned[objectName]
+		}
+		return false
+	}
+
+	flush := func() error {
+		defer section.Reset()
+		if preamble {
+			_, err := io.WriteString(w, section.String())
+			return err
+		}
+		if !belongs() {
+			if objectType == "SEQUENCE" {
+				sequences[objectName] = section.String()
+			}
+			return nil
+		}
+
+		if objectType == "TABLE" {
+			found = true
+			drop := fmt.Sprintf("DROP TABLE IF EXISTS %s;\n", quotePostgres(objectSchema, objectName))
+			if _, err := io.WriteString(w, drop); err != nil {
+				return err
+			}
+		}
+		if objectType == "SEQUENCE OWNED BY" {
+			owned[objectName] = true
+			if _, err := io.WriteString(w, sequences[objectName]); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, section.String())
+		return err
+	}
+
+	for {
+		line, readErr := reader.ReadString('\n')
+		if match := pgDumpHeader.FindStringSubmatch(strings.TrimRight(line, "\r\n")); match != nil {
+			if err := flush(); err != nil {
+				return found, err
+			}
+			preamble = false
+			objectName, objectType, objectSchema = match[1], match[2], match[3]
+		}
+
+		// Table data can be large, so it is streamed rather than collected
+		if objectType == "TABLE DATA" && !preamble {
+			if belongs() {
+				found = true
+				if _, err := io.WriteString(w, line); err != nil {
+					return found, err
+				}
+			}
+		} else {
+			section.WriteString(line)
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			return found, flush()
+		}
+		if readErr != nil {
+			return found, readErr
+		}
+	}
+}
+
+// extractMySQLTable copies the settings at the top of a mysqldump and the structure and data
+// sections of one table to w. mysqldump drops the table before creating it, and keeps the
+// table's triggers with its data.
+func extractMySQLTable(in io.Reader, w io.Writer, table string) (bool, error) {
+	reader := bufio.NewReader(in)
+	found := false
+	preamble := true
+	keep := true
+
+	for {
+		line, readErr := reader.ReadString('\n')
+		if match := mysqlDumpHeader.FindStringSubmatch(strings.TrimRight(line, "\r\n")); match != nil {
+			preamble = false
+			keep = (match[1] == "Table structure for table" || match[1] == "Dumping data for table") && match[2] == table
+			found = found || keep
+		}
+		if preamble || keep {
+			if _, err := io.WriteString(w, line); err != nil {
+				return found, err
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			return found, nil
+		}
+		if readErr != nil {
+			return found, readErr
+		}
+	}
+}
+
+// quotePostgres quotes a schema-qualified identifier for PostgreSQL
+func quotePostgres(schema, name string) string {
+	quote := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, `""`) + `"` }
+	if schema == "" || schema == "-" {
+		return quote(name)
+	}
+	return quote(schema) + "." + quote(name)
+}
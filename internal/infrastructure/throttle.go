@@ -0,0 +1,127 @@
+package infrastructure
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// throttleChunk bounds how much is written between pauses, so the rate stays smooth
+const throttleChunk = 32 * 1024
+
+// throttle paces reads or writes to bytesPerSecond on average
+type throttle struct {
+	bytesPerSecond int64
+	start          time.Time
+	total          int64
+}
+
+func newThrottle(bytesPerSecond int64) *throttle {
+	return &throttle{bytesPerSecond: bytesPerSecond, start: time.Now()}
+}
+
+// wait records n transferred bytes and sleeps until the average is back under the limit
+func (t *throttle) wait(n int) {
+	t.total += int64(n)
+	expected := time.Duration(float64(t.total) / float64(t.bytesPerSecond) * float64(time.Second))
+	if ahead := expected - time.Since(t.start); ahead > 0 {
+		time.Sleep(ahead)
+	}
+}
+
+type throttledWriter struct {
+	w io.Writer
+	*throttle
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > throttleChunk {
+			chunk = chunk[:throttleChunk]
+		}
+		n, err := t.w.Write(chunk)
+		written += n
+		t.wait(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+type throttledReader struct {
+	r io.Reader
+	*throttle
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := t.r.Read(p)
+	t.wait(n)
+	return n, err
+}
+
+// limitWriter caps the throughput of w; zero leaves it unlimited
+func limitWriter(w io.Writer, bytesPerSecond int64) io.Writer {
+	if bytesPerSecond <= 0 {
+		return w
+	}
+	return &throttledWriter{w: w, throttle: newThrottle(bytesPerSecond)}
+}
+
+// limitReader caps the throughput of r; zero leaves it unlimited
+func limitReader(r io.Reader, bytesPerSecond int64) io.Reader {
+	if bytesPerSecond <= 0 {
+		return r
+	}
+	return &throttledReader{r: r, throttle: newThrottle(bytesPerSecond)}
+}
+
+// niceCommand lowers the CPU and I/O priority of a command run inside a container or pod.
+// ionice is skipped when the image does not ship it.
+func niceCommand(limits domain.ResourceLimits, command []string) []string {
+	if limits.Nice == 0 && limits.IOClass == "" {
+		return command
+	}
+
+	var prefix string
+	if limits.Nice != 0 {
+		prefix = "nice -n " + strconv.Itoa(limits.Nice) + " "
+	}
+
+	script := "exec " + prefix + "\"$@\""
+	if class := ioniceClass(limits.IOClass); class != "" {
+		script = "if command -v ionice >/dev/null 2>&1; then exec ionice " + class + " " + prefix + "\"$@\"; fi; " + script
+	}
+
+	return append([]string{"sh", "-c", script, "sh"}, command...)
+}
+
+func ioniceClass(class string) string {
+	switch class {
+	case domain.IOClassIdle:
+		return "-c3"
+	case domain.IOClassBestEffort:
+		return "-c2 -n7"
+	}
+	return ""
+}
+
+// runOptions describes a temporary container capped by the database's resource limits
+func runOptions(limits domain.ResourceLimits, image string, command, env, binds []string) RunOptions {
+	return RunOptions{
+		Image:    image,
+		Command:  niceCommand(limits, command),
+		Env:      env,
+		Binds:    binds,
+		NanoCPUs: int64(limits.CPUs * 1e9),
+		Memory:   limits.MemoryBytes,
+	}
+}
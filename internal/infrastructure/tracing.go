@@ -0,0 +1,122 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// tracerName identifies the spans of this tool in the exported traces
+const tracerName = "github.com/wush/db-backup-tool"
+
+// spanImpl implements domain.Span with an OpenTelemetry span
+type spanImpl struct {
+	ctx    context.Context
+	span   trace.Span
+	tracer trace.Tracer
+}
+
+// NewTracer exports spans over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, and otherwise returns a tracer that records
+// nothing. The other OTEL_* variables, such as the headers and service name, are honoured.
+// shutdown flushes the spans that have not been exported yet.
+func NewTracer() (tracer domain.Tracer, shutdown func() error, err error) {
+	noop := func() error { return nil }
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" ||
+		strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return domain.NoopTracer, noop, nil
+	}
+
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, noop, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES come last so they override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("backup-tool")),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, noop, fmt.Errorf("failed to describe trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	shutdown = func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			return fmt.Errorf("failed to export traces: %w", err)
+		}
+		return nil
+	}
+
+	return &spanImpl{ctx: ctx, tracer: provider.Tracer(tracerName)}, shutdown, nil
+}
+
+// Start begins a child span, or a new trace when called on the tracer itself
+func (s *spanImpl) Start(name string, attributes domain.Attributes) domain.Span {
+	ctx, span := s.tracer.Start(s.ctx, name, trace.WithAttributes(toAttributes(attributes)...))
+	return &spanImpl{ctx: ctx, span: span, tracer: s.tracer}
+}
+
+// SetAttributes adds attributes to the span
+func (s *spanImpl) SetAttributes(attributes domain.Attributes) {
+	if s.span != nil {
+		s.span.SetAttributes(toAttributes(attributes)...)
+	}
+}
+
+// End finishes the span, recording err as its status
+func (s *spanImpl) End(err error) {
+	if s.span == nil {
+		return
+	}
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// toAttributes converts domain attributes into OpenTelemetry ones, leaving out empty strings
+func toAttributes(attributes domain.Attributes) []attribute.KeyValue {
+	var kvs []attribute.KeyValue
+	for key, value := range attributes {
+		switch v := value.(type) {
+		case string:
+			if v != "" {
+				kvs = append(kvs, attribute.String(key, v))
+			}
+		case bool:
+			kvs = append(kvs, attribute.Bool(key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(key, v))
+		case float64:
+			kvs = append(kvs, attribute.Float64(key, v))
+		default:
+			kvs = append(kvs, attribute.String(key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,102 @@
+package infrastructure
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// checksumMarker precedes the SHA-256 that checksumCommand writes to stderr
+const checksumMarker = "backup-tool-sha256 "
+
+// checksumCommand runs command and, once it succeeded, writes the SHA-256 of its stdout to
+// stderr. Images without sha256sum, mkfifo or a writable temp directory run command as is.
+// sh has no pipefail everywhere, so command's exit status is passed out of the pipeline on fd 3.
+func checksumCommand(command []string) []string {
+	script := `if ! command -v sha256sum >/dev/null 2>&1 || ! command -v mkfifo >/dev/null 2>&1 || ! d=$(mktemp -d 2>/dev/null); then exec "$@"; fi; ` +
+		`if ! mkfifo "$d/f"; then rm -rf "$d"; exec "$@"; fi; ` +
+		`sha256sum < "$d/f" > "$d/s" & ` +
+		`exec 4>&1; s=$({ { "$@"; echo $? >&3; } | tee "$d/f" >&4; } 3>&1); wait; ` +
+		`[ "$s" = 0 ] && echo "` + checksumMarker + `$(cut -c1-64 "$d/s")" >&2; rm -rf "$d"; exit "${s:-1}"`
+	return append([]string{"sh", "-c", script, "sh"}, command...)
+}
+
+// streamContainer runs a dump command in a container like execContainer and fails if what
+// reached stdout differs from what the command wrote
+func (p *clientPool) streamContainer(containerName string, command []string, stdout io.Writer) error {
+	docker, err := p.docker()
+	if err != nil {
+		return err
+	}
+
+	var stderr stderrBuffer
+	received := sha256.New()
+	err = docker.Exec(p.ctx, containerName, checksumCommand(command), nil, io.MultiWriter(stdout, received), &stderr)
+	return verifyTransfer(&stderr, received, err)
+}
+
+// streamPod runs a dump command in the database's pod like execPod and fails if what reached
+// stdout differs from what the command wrote
+func (p *clientPool) streamPod(config domain.DatabaseConfig, namespace string, command []string, stdout io.Writer) error {
+	kube, err := p.kubernetes(config)
+	if err != nil {
+		return err
+	}
+
+	var stderr stderrBuffer
+	received := sha256.New()
+	err = kube.Exec(p.ctx, namespace, config.Pod, checksumCommand(command), nil, io.MultiWriter(stdout, received), &stderr)
+	return verifyTransfer(&stderr, received, err)
+}
+
+// streamSSH runs a dump command on the database's machine like execSSH and fails if what reached
+// stdout differs from what the command wrote
+func (p *clientPool) streamSSH(config domain.DatabaseConfig, command []string, stdout io.Writer) error {
+	client, err := p.ssh(config)
+	if err != nil {
+		return err
+	}
+
+	var stderr stderrBuffer
+	received := sha256.New()
+	err = client.Exec(p.ctx, checksumCommand(command), nil, io.MultiWriter(stdout, received), &stderr)
+	return verifyTransfer(&stderr, received, err)
+}
+
+// streamClient runs a dump command next to the database like runClient, checking what the
+// exec methods stream out of the container or pod
+func (p *clientPool) streamClient(config domain.DatabaseConfig, method domain.BackupMethod, namespace string, command []string, stdout io.Writer) error {
+	switch method {
+	case domain.BackupMethodDockerExec:
+		return p.streamContainer(config.Container, command, stdout)
+	case domain.BackupMethodKubectlExec:
+		return p.streamPod(config, namespace, command, stdout)
+	case domain.BackupMethodSSH:
+		return p.streamSSH(config, command, stdout)
+	}
+	return p.runClient(config, method, namespace, command, nil, stdout)
+}
+
+// verifyTransfer compares the checksum a command reported on stderr with the one of what
+// arrived. A command that reported none, as its image lacks the tools, goes unchecked.
+func verifyTransfer(stderr *stderrBuffer, received hash.Hash, err error) error {
+	if err != nil {
+		return stderr.wrap(err)
+	}
+
+	output := stderr.String()
+	i := strings.LastIndex(output, checksumMarker)
+	if i < 0 {
+		return nil
+	}
+	sent := strings.TrimSpace(output[i+len(checksumMarker):])
+	if got := hex.EncodeToString(received.Sum(nil)); sent != got {
+		return fmt.Errorf("failed to verify dump: %w", &domain.ChecksumMismatchError{Sent: sent, Received: got})
+	}
+	return nil
+}
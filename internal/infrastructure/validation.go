@@ -0,0 +1,237 @@
+package infrastructure
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// validationWindow is how much of the start and end of a dump is inspected
+const validationWindow = 4096
+
+// dumpSignature describes the markers a complete dump is expected to contain
+type dumpSignature struct {
+	headers  []string // One of these must appear near the start
+	trailers []string // One of these must appear near the end; empty skips the check
+}
+
+// ValidateBackup checks that an artifact is non-empty and looks like a complete dump. Snapshots
+// and stream records are checked here; dumps are left to the engine of dbType.
+func (r *BackupRepositoryImpl) ValidateBackup(dbType domain.DatabaseType, backupPath string) error {
+	// Streamed dumps were verified before their store completed the copy
+	if domain.IsStreamRecord(backupPath) {
+		_, err := readStreamRecord(backupPath)
+		return err
+	}
+	if domain.IsSnapshotBackup(backupPath) {
+		_, err := readSnapshotRecord(backupPath)
+		return err
+	}
+	if domain.IsRDSSnapshot(backupPath) {
+		_, err := readRDSSnapshotRecord(backupPath)
+		return err
+	}
+	if domain.IsHostSnapshot(backupPath) {
+		return validateHostSnapshot(backupPath)
+	}
+
+	engine, err := domain.LookupEngine(dbType)
+	if err != nil {
+		return err
+	}
+	return engine.Verify(backupPath)
+}
+
+func validateSQLDump(backupPath string, signature dumpSignature) error {
+	f, err := os.Open(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open dump: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat dump: %w", err)
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("dump is empty")
+	}
+
+	var head, tail []byte
+	if format, err := compressedFormat(f); err != nil {
+		return fmt.Errorf("failed to read dump: %w", err)
+	} else if format != "" {
+		head, tail, err = readCompressedEnds(f)
+	} else {
+		head, tail, err = readEnds(f, info.Size())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read dump: %w", err)
+	}
+	if len(head) == 0 {
+		return fmt.Errorf("dump is empty")
+	}
+
+	if !containsAny(head, signature.headers) {
+		return fmt.Errorf("dump does not start with a recognized header (expected one of: %s)",
+			strings.Join(signature.headers, ", "))
+	}
+
+	// Custom-format pg_dump archives are binary and carry no text trailer
+	if bytes.HasPrefix(head, []byte("PGDMP")) || len(signature.trailers) == 0 {
+		return nil
+	}
+
+	if !containsAny(tail, signature.trailers) {
+		return fmt.Errorf("dump appears truncated (missing %q trailer)", signature.trailers[0])
+	}
+	return nil
+}
+
+// readEnds reads the first and last validationWindow bytes of a plain dump
+func readEnds(f *os.File, size int64) (head, tail []byte, err error) {
+	head = make([]byte, validationWindow)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+
+	tail = head
+	if size > validationWindow {
+		tail = make([]byte, validationWindow)
+		if _, err := f.ReadAt(tail, size-validationWindow); err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+	}
+	return head, tail, nil
+}
+
+// readCompressedEnds decompresses a compressed dump, which has to be read through to reach its end
+func readCompressedEnds(f *os.File) (head, tail []byte, err error) {
+	in, err := decompressed(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer in.Close()
+
+	head = make([]byte, validationWindow)
+	n, err := io.ReadFull(in, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+
+	tail = append([]byte(nil), head...)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := in.Read(buf)
+		tail = append(tail, buf[:n]...)
+		if len(tail) > validationWindow {
+			tail = append(tail[:0], tail[len(tail)-validationWindow:]...)
+		}
+		if err == io.EOF {
+			return head, tail, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+func validateMongoDump(backupPath string) error {
+	bsonFiles := 0
+	err := filepath.WalkDir(backupPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && (strings.HasSuffix(path, ".bson") || strings.HasSuffix(path, ".bson.gz")) {
+			bsonFiles++
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to inspect dump: %w", err)
+	}
+
+	if bsonFiles == 0 {
+		return fmt.Errorf("mongodump produced no BSON files")
+	}
+	return nil
+}
+
+// mongoArchiveMagic starts every mongodump archive
+var mongoArchiveMagic = []byte{0x6d, 0xe2, 0x99, 0x81}
+
+// validateManifestArchive checks that a tar archive of a native backup holds one of the files
+// the database's backup tool writes last, e.g. InfluxDB's .manifest or CockroachDB's BACKUP_MANIFEST
+func validateManifestArchive(backupPath string, manifests ...string) error {
+	f, err := os.Open(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	r, err := decompressed(f)
+	if err != nil {
+		return fmt.Errorf("archive is not valid gzip: %w", err)
+	}
+	defer r.Close()
+
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("backup has no %s, it is incomplete", strings.Join(manifests, " or "))
+		}
+		if err != nil {
+			return fmt.Errorf("file is not a tar archive: %w", err)
+		}
+		for _, manifest := range manifests {
+			if strings.HasSuffix(header.Name, manifest) {
+				return nil
+			}
+		}
+	}
+}
+
+// validateMongoArchive checks that a mongodump --archive file, gzipped or not, starts like an archive
+func validateMongoArchive(backupPath string) error {
+	f, err := os.Open(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	r, err := decompressed(f)
+	if err != nil {
+		return fmt.Errorf("archive is not valid gzip: %w", err)
+	}
+	defer r.Close()
+
+	header := make([]byte, len(mongoArchiveMagic))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("archive is empty or truncated")
+	}
+	if !bytes.Equal(header, mongoArchiveMagic) {
+		return fmt.Errorf("file is not a mongodump archive")
+	}
+	return nil
+}
+
+func containsAny(data []byte, markers []string) bool {
+	for _, marker := range markers {
+		if bytes.Contains(data, []byte(marker)) {
+			return true
+		}
+	}
+	return false
+}
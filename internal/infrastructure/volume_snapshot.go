@@ -0,0 +1,329 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// volumeSnapshots is the CSI snapshot API installed by the external-snapshotter CRDs
+var volumeSnapshots = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+
+const (
+	// snapshotCutTimeout bounds how long the database stays quiesced while the snapshot is taken
+	snapshotCutTimeout = 5 * time.Minute
+
+	// snapshotReadyTimeout bounds how long the driver may take to make the snapshot restorable
+	snapshotReadyTimeout = 30 * time.Minute
+
+	snapshotPollInterval = 2 * time.Second
+)
+
+// invalidSnapshotChars are replaced when a backup name becomes a Kubernetes object name
+var invalidSnapshotChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// snapshotRecord is written to the backup directory in place of a dump, so the catalog can
+// list, size and restore snapshot backups like any other
+type snapshotRecord struct {
+	Namespace    string    `json:"namespace"`
+	Name         string    `json:"name"`              // VolumeSnapshot
+	Content      string    `json:"content,omitempty"` // VolumeSnapshotContent bound to it
+	Class        string    `json:"class,omitempty"`
+	PVC          string    `json:"pvc"`
+	StorageClass string    `json:"storage_class,omitempty"`
+	AccessModes  []string  `json:"access_modes,omitempty"`
+	Size         int64     `json:"size"` // Restore size, or the claim's capacity if the driver reports none
+	KubeContext  string    `json:"kube_context,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// snapshotStatus is the part of a VolumeSnapshot's status a backup waits on
+type snapshotStatus struct {
+	cut         bool // creationTime is set: the data is captured and writes may resume
+	ready       bool // readyToUse: claims can be created from it
+	restoreSize int64
+	content     string
+}
+
+// BackupVolumeSnapshot quiesces the database, takes a CSI VolumeSnapshot of the claim holding
+// its data and writes a record of the snapshot to backupPath. Writes resume as soon as the
+// snapshot is cut; the backup then waits for the driver to make it restorable.
+func (r *BackupRepositoryImpl) BackupVolumeSnapshot(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	if method != domain.BackupMethodKubectlExec {
+		return fmt.Errorf("volume snapshots need %s", domain.BackupMethodKubectlExec)
+	}
+	kube, err := r.kubernetes(config)
+	if err != nil {
+		return err
+	}
+	ctx := r.ctx
+
+	claimName := config.Snapshot.PVC
+	if claimName == "" {
+		claims, err := kube.PodClaims(ctx, namespace, config.Pod)
+		if err != nil {
+			return err
+		}
+		if len(claims) != 1 {
+			return fmt.Errorf("pod %s mounts %d persistent volume claims; set snapshot.pvc to the one holding the data", config.Pod, len(claims))
+		}
+		claimName = claims[0]
+	}
+	claim, err := kube.Claim(ctx, namespace, claimName)
+	if err != nil {
+		return err
+	}
+
+	name := snapshotName(backupPath)
+	err = r.quiesce(config, method, namespace, func() error {
+		if err := kube.CreateVolumeSnapshot(ctx, namespace, name, claimName, config.Snapshot.Class); err != nil {
+			return err
+		}
+		_, err := kube.WaitVolumeSnapshot(ctx, namespace, name, false, snapshotCutTimeout)
+		return err
+	})
+	var status snapshotStatus
+	if err == nil {
+		status, err = kube.WaitVolumeSnapshot(ctx, namespace, name, true, snapshotReadyTimeout)
+	}
+	if err != nil {
+		// A snapshot cut after the database resumed is not consistent, so it is not kept; nor is
+		// one whose backup was interrupted
+		kube.DeleteVolumeSnapshot(context.Background(), namespace, name)
+		return err
+	}
+
+	record := snapshotRecord{
+		Namespace:   namespace,
+		Name:        name,
+		Content:     status.content,
+		Class:       config.Snapshot.Class,
+		PVC:         claimName,
+		Size:        status.restoreSize,
+		KubeContext: config.KubeContext,
+		CreatedAt:   time.Now(),
+	}
+	if claim.Spec.StorageClassName != nil {
+		record.StorageClass = *claim.Spec.StorageClassName
+	}
+	for _, mode := range claim.Spec.AccessModes {
+		record.AccessModes = append(record.AccessModes, string(mode))
+	}
+	if record.Size == 0 {
+		capacity := claim.Status.Capacity[corev1.ResourceStorage]
+		record.Size = capacity.Value()
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot record: %w", err)
+	}
+	if err := os.WriteFile(backupPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot record: %w", err)
+	}
+	return nil
+}
+
+// RestoreVolumeSnapshot creates a PersistentVolumeClaim named after the snapshotted claim from
+// the snapshot recorded at backupPath. VolumeSnapshots are namespaced, so the claim is created
+// in the snapshot's namespace.
+func (r *RestoreRepositoryImpl) RestoreVolumeSnapshot(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) (string, error) {
+	if method != domain.BackupMethodKubectlExec {
+		return "", fmt.Errorf("volume snapshots can only be restored with %s", domain.BackupMethodKubectlExec)
+	}
+	record, err := readSnapshotRecord(backupPath)
+	if err != nil {
+		return "", err
+	}
+	if namespace != record.Namespace {
+		return "", fmt.Errorf("snapshot %s is in namespace %s and can only be restored there", record.Name, record.Namespace)
+	}
+
+	kube, err := r.kubernetes(config)
+	if err != nil {
+		return "", err
+	}
+	return kube.CreateClaimFromSnapshot(r.ctx, namespace, record.PVC+"-restore-", record)
+}
+
+// readSnapshotRecord reads the record a snapshot backup wrote
+func readSnapshotRecord(path string) (snapshotRecord, error) {
+	var record snapshotRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return record, fmt.Errorf("failed to read snapshot record: %w", err)
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, fmt.Errorf("invalid snapshot record: %w", err)
+	}
+	if record.Name == "" || record.Namespace == "" || record.PVC == "" {
+		return record, fmt.Errorf("snapshot record %s does not name a snapshot", path)
+	}
+	return record, nil
+}
+
+// snapshotName turns a backup name into a snapshot name: lower case letters, digits and
+// dashes, at most 63 characters, as Kubernetes object names are
+func snapshotName(backupPath string) string {
+	name := strings.TrimSuffix(filepath.Base(backupPath), ".gz")
+	name = strings.TrimSuffix(strings.TrimSuffix(name, domain.SnapshotBackupExt), domain.HostSnapshotExt)
+	name = strings.TrimSuffix(name, domain.RDSSnapshotExt)
+	name = invalidSnapshotChars.ReplaceAllString(strings.ToLower(name), "-")
+	if len(name) > 63 {
+		name = name[len(name)-63:]
+	}
+	return strings.Trim(name, "-")
+}
+
+// PodClaims returns the PersistentVolumeClaims a pod mounts
+func (c *KubernetesClient) PodClaims(ctx context.Context, namespace, pod string) ([]string, error) {
+	p, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod %s: %w", pod, err)
+	}
+
+	var claims []string
+	for _, volume := range p.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claims = append(claims, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	return claims, nil
+}
+
+// Claim returns a PersistentVolumeClaim
+func (c *KubernetesClient) Claim(ctx context.Context, namespace, name string) (*corev1.PersistentVolumeClaim, error) {
+	claim, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get persistent volume claim %s: %w", name, err)
+	}
+	return claim, nil
+}
+
+// CreateVolumeSnapshot snapshots a claim; an empty class uses the cluster's default VolumeSnapshotClass
+func (c *KubernetesClient) CreateVolumeSnapshot(ctx context.Context, namespace, name, claim, class string) error {
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{"persistentVolumeClaimName": claim},
+	}
+	if class != "" {
+		spec["volumeSnapshotClassName"] = class
+	}
+
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshot",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{"app.kubernetes.io/managed-by": "backup-tool"},
+		},
+		"spec": spec,
+	}}
+	if _, err := c.dynamic.Resource(volumeSnapshots).Namespace(namespace).Create(ctx, snapshot, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create volume snapshot %s: %w", name, err)
+	}
+	return nil
+}
+
+// DeleteVolumeSnapshot removes a VolumeSnapshot
+func (c *KubernetesClient) DeleteVolumeSnapshot(ctx context.Context, namespace, name string) error {
+	return c.dynamic.Resource(volumeSnapshots).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+// WaitVolumeSnapshot polls a VolumeSnapshot until it is cut or, with ready, until claims can be
+// created from it
+func (c *KubernetesClient) WaitVolumeSnapshot(ctx context.Context, namespace, name string, ready bool, timeout time.Duration) (snapshotStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		snapshot, err := c.dynamic.Resource(volumeSnapshots).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return snapshotStatus{}, fmt.Errorf("failed to get volume snapshot %s: %w", name, err)
+		}
+
+		var status snapshotStatus
+		creationTime, _, _ := unstructured.NestedString(snapshot.Object, "status", "creationTime")
+		status.cut = creationTime != ""
+		status.ready, _, _ = unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+		status.content, _, _ = unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+		if size, _, _ := unstructured.NestedString(snapshot.Object, "status", "restoreSize"); size != "" {
+			if quantity, err := resource.ParseQuantity(size); err == nil {
+				status.restoreSize = quantity.Value()
+			}
+		}
+		if message, _, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); message != "" {
+			return status, fmt.Errorf("volume snapshot %s failed: %s", name, message)
+		}
+
+		if status.ready || status.cut && !ready {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			state := "taken"
+			if ready {
+				state = "ready"
+			}
+			return status, fmt.Errorf("volume snapshot %s was not %s within %s", name, state, timeout)
+		case <-time.After(snapshotPollInterval):
+		}
+	}
+}
+
+// CreateClaimFromSnapshot creates a claim with the size, storage class and access modes of the
+// snapshotted one, filled from the snapshot, and returns its generated name
+func (c *KubernetesClient) CreateClaimFromSnapshot(ctx context.Context, namespace, generateName string, record snapshotRecord) (string, error) {
+	accessModes := []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	if len(record.AccessModes) > 0 {
+		accessModes = nil
+		for _, mode := range record.AccessModes {
+			accessModes = append(accessModes, corev1.PersistentVolumeAccessMode(mode))
+		}
+	}
+
+	group := volumeSnapshots.Group
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: generateName,
+			Namespace:    namespace,
+			Labels:       map[string]string{"app.kubernetes.io/managed-by": "backup-tool"},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: accessModes,
+			DataSource: &corev1.TypedLocalObjectReference{
+				APIGroup: &group,
+				Kind:     "VolumeSnapshot",
+				Name:     record.Name,
+			},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: *resource.NewQuantity(record.Size, resource.BinarySI),
+				},
+			},
+		},
+	}
+	if record.StorageClass != "" {
+		claim.Spec.StorageClassName = &record.StorageClass
+	}
+
+	created, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, claim, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create persistent volume claim from snapshot %s: %w", record.Name, err)
+	}
+	return created.Name, nil
+}
@@ -0,0 +1,79 @@
+package infrastructure
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// backupYugabyteDB dumps a YSQL database with ysql_dump, which writes pg_dump's plain format
+func (r *BackupRepositoryImpl) backupYugabyteDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	script := fmt.Sprintf("%s ysql_dump %s%s %s",
+		yugabyteEnv(config, method), yugabyteArgs(config, method), pgDumpFlags(config.DumpMode), shellQuote(config.Database))
+
+	return writeSQLDump(config, method, backupPath, func(w io.Writer, compress bool) error {
+		w = limitWriter(w, config.Limits.BytesPerSecond)
+		command := []string{"sh", "-c", script}
+
+		switch method {
+		case domain.BackupMethodDockerRun:
+			if err := r.runContainer(runOptions(config.Limits, imageFor(config), command, nil, certBinds(config)), nil, w); err != nil {
+				return fmt.Errorf("docker run failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodDockerExec:
+			if err := r.streamContainer(config.Container, niceCommand(config.Limits, compressCommand(compress, config.Compression, command)), w); err != nil {
+				return fmt.Errorf("docker exec failed: %w", err)
+			}
+			return nil
+
+		case domain.BackupMethodKubectlExec:
+			if err := r.streamPod(config, namespace, niceCommand(config.Limits, compressCommand(compress, config.Compression, command)), w); err != nil {
+				return fmt.Errorf("pod exec failed: %w", err)
+			}
+			return nil
+		}
+		return fmt.Errorf("unknown backup method: %s", method)
+	})
+}
+
+// restoreYugabyteDB creates the target database unless it exists and runs ysqlsh on the dump
+func (r *RestoreRepositoryImpl) restoreYugabyteDB(config domain.DatabaseConfig, method domain.BackupMethod, backupPath, namespace string) error {
+	args := yugabyteArgs(config, method)
+	script := fmt.Sprintf(
+		"export %[1]s; ysqlsh %[2]s -d yugabyte -tAc %[3]s | grep -q 1 || ysqlsh %[2]s -d yugabyte -c %[4]s "+
+			"&& ysqlsh %[2]s -d %[5]s -v ON_ERROR_STOP=1 -q",
+		yugabyteEnv(config, method), args,
+		shellQuote("SELECT 1 FROM pg_database WHERE datname = "+sqlString(config.Database)),
+		shellQuote("CREATE DATABASE "+quotePostgres("", config.Database)),
+		shellQuote(config.Database))
+
+	return readFromFile(backupPath, func(in io.Reader) error {
+		return r.runClient(config, method, namespace, []string{"sh", "-c", script}, in, io.Discard)
+	})
+}
+
+// yugabyteArgs returns the host, port and user flags shared by ysql_dump and ysqlsh, quoted for sh
+func yugabyteArgs(config domain.DatabaseConfig, method domain.BackupMethod) string {
+	host := "localhost"
+	if method == domain.BackupMethodDockerRun {
+		host = config.Host
+	}
+	port := config.Port
+	if port == 0 {
+		port = 5433
+	}
+	return fmt.Sprintf("-h %s -p %d -U %s", shellQuote(host), port, shellQuote(config.User))
+}
+
+// yugabyteEnv returns the password and TLS settings as libpq environment variables, quoted for sh
+func yugabyteEnv(config domain.DatabaseConfig, method domain.BackupMethod) string {
+	vars := []string{"PGPASSWORD=" + shellQuote(config.Password)}
+	for _, param := range tlsParams(config, method) {
+		vars = append(vars, "PG"+strings.ToUpper(param[0])+"="+shellQuote(param[1]))
+	}
+	return strings.Join(vars, " ")
+}
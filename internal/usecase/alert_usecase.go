@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// AlertUsecase checks the expectations of the configured databases for serve, continuously,
+// and reports the databases that stop or start meeting them
+type AlertUsecase struct {
+	status        *StatusUsecase
+	heartbeatRepo domain.HeartbeatRepository
+	outputService domain.OutputService
+
+	failing map[string]string // Problems of the databases missing their expectations, by name
+}
+
+// NewAlertUsecase creates a new alert usecase
+func NewAlertUsecase(
+	catalogRepo domain.CatalogRepository,
+	heartbeatRepo domain.HeartbeatRepository,
+	outputService domain.OutputService,
+) *AlertUsecase {
+	return &AlertUsecase{
+		status:        NewStatusUsecase(catalogRepo),
+		heartbeatRepo: heartbeatRepo,
+		outputService: outputService,
+		failing:       make(map[string]string),
+	}
+}
+
+// Run checks the expectations every Alerts.Interval until ctx is done. loadConfig is called for
+// every check, so changes to the expectations and alerts apply without a restart.
+func (uc *AlertUsecase) Run(ctx context.Context, loadConfig func() (domain.BackupConfig, error)) {
+	for {
+		interval := uc.check(loadConfig)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// check compares the statuses with those of the last check and alerts for every database that
+// started or stopped missing its expectations since. It returns when to check again.
+func (uc *AlertUsecase) check(loadConfig func() (domain.BackupConfig, error)) time.Duration {
+	config, err := loadConfig()
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to check the backup expectations: %v", err))
+		return domain.DefaultAlertInterval
+	}
+	interval := config.Alerts.Interval
+	if interval == 0 {
+		interval = domain.DefaultAlertInterval
+	}
+	statuses, err := uc.status.Execute(config, time.Now())
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to check the backup expectations: %v", err))
+		return interval
+	}
+
+	failing := make(map[string]string)
+	var missed, recovered []string
+	for _, status := range statuses {
+		name := status.Name()
+		if problem := status.Problem(); problem != "" {
+			failing[name] = problem
+			if _, ok := uc.failing[name]; !ok {
+				missed = append(missed, fmt.Sprintf("%s misses its expectations: %s", name, problem))
+			}
+		} else if _, ok := uc.failing[name]; ok {
+			recovered = append(recovered, fmt.Sprintf("%s meets its expectations again", name))
+		}
+	}
+	// Databases removed from the config are forgotten without an alert
+	if len(missed) == 0 && len(recovered) == 0 {
+		uc.failing = failing
+		return interval
+	}
+
+	for _, change := range missed {
+		uc.outputService.PrintError(change)
+	}
+	for _, change := range recovered {
+		uc.outputService.PrintSuccess(change)
+	}
+	if config.Alerts.URL != "" {
+		if err := uc.heartbeatRepo.Ping(config.Alerts.URL, strings.Join(append(missed, recovered...), "\n")); err != nil {
+			// Keeping the last state sends the changes again with the next check
+			uc.outputService.PrintError(fmt.Sprintf("Failed to send the alert: %v", err))
+			return interval
+		}
+	}
+	uc.failing = failing
+	return interval
+}
@@ -1,9 +1,14 @@
 package usecase
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/wush/db-backup-tool/internal/domain"
@@ -12,57 +17,175 @@ import (
 // BackupUsecase implements backup business logic
 type BackupUsecase struct {
 	backupRepo    domain.BackupRepository
+	profileRepo   domain.ProfileRepository
+	catalogRepo   domain.CatalogRepository
+	chunkRepo     domain.ChunkRepository
+	heartbeatRepo domain.HeartbeatRepository
+	tracer        domain.Tracer
 	configService domain.ConfigService
 	outputService domain.OutputService
+	running       atomic.Bool
+	interrupted   atomic.Bool
 }
 
 // NewBackupUsecase creates a new backup usecase
 func NewBackupUsecase(
 	backupRepo domain.BackupRepository,
+	profileRepo domain.ProfileRepository,
+	catalogRepo domain.CatalogRepository,
+	chunkRepo domain.ChunkRepository,
+	heartbeatRepo domain.HeartbeatRepository,
+	tracer domain.Tracer,
 	configService domain.ConfigService,
 	outputService domain.OutputService,
 ) *BackupUsecase {
+	if tracer == nil {
+		tracer = domain.NoopTracer
+	}
 	return &BackupUsecase{
 		backupRepo:    backupRepo,
+		profileRepo:   profileRepo,
+		catalogRepo:   catalogRepo,
+		chunkRepo:     chunkRepo,
+		heartbeatRepo: heartbeatRepo,
+		tracer:        tracer,
 		configService: configService,
 		outputService: outputService,
 	}
 }
 
-// ExecuteInteractiveBackup runs the interactive backup process
-func (uc *BackupUsecase) ExecuteInteractiveBackup() error {
+// ExecuteInteractiveBackup runs the interactive backup process. With readEnvironment, the
+// credentials of databases in containers and pods are looked up in their environment.
+func (uc *BackupUsecase) ExecuteInteractiveBackup(readEnvironment bool) error {
+	return uc.executeInteractiveBackup("", nil, readEnvironment)
+}
+
+// ExecuteDiscoveredBackup runs the interactive backup process, first offering the databases
+// found in source, such as a docker-compose.yml, with their details filled in
+func (uc *BackupUsecase) ExecuteDiscoveredBackup(source string, discovered []domain.DiscoveredDatabase, readEnvironment bool) error {
+	return uc.executeInteractiveBackup(source, discovered, readEnvironment)
+}
+
+func (uc *BackupUsecase) executeInteractiveBackup(source string, discovered []domain.DiscoveredDatabase, readEnvironment bool) error {
 	uc.outputService.PrintHeader()
 	
-	// Step 1: Select backup method
-	method, err := uc.configService.SelectBackupMethod()
-	if err != nil {
-		return fmt.Errorf("failed to select backup method: %w", err)
+	// The answers of the last session are offered as defaults, sparing retyping them daily
+	if last, err := uc.profileRepo.LoadLastAnswers(); err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Could not load the answers of the last session: %v", err))
+	} else {
+		uc.configService.RememberAnswers(last)
 	}
 	
-	// Step 2: Select databases
-	dbTypes, err := uc.configService.SelectDatabases()
-	if err != nil {
-		return fmt.Errorf("failed to select databases: %w", err)
+	// Steps 1-2: Select backup method, then databases, going back to the method on request
+	var method domain.BackupMethod
+	var found []domain.DiscoveredDatabase
+	var dbTypes []domain.DatabaseType
+	for {
+		var err error
+		method, err = uc.configService.SelectBackupMethod()
+		if err != nil {
+			return fmt.Errorf("failed to select backup method: %w", err)
+		}
+		
+		found, dbTypes, err = uc.selectDatabases(source, discovered)
+		if errors.Is(err, domain.ErrBack) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to select databases: %w", err)
+		}
+		selected := append([]domain.DatabaseType{}, dbTypes...)
+		for _, db := range found {
+			selected = append(selected, db.Config.Type)
+		}
+		if !uc.methodSupports(method, selected) {
+			continue
+		}
+		break
 	}
 	
-	// Step 3: Get Kubernetes namespace if using kubectl-exec
+	// Step 3: Get Kubernetes namespace and cluster if using kubectl-exec
 	k8sNamespace := "default"
+	var kubeconfig, kubeContext string
 	if method == domain.BackupMethodKubectlExec {
 		ns, err := uc.configService.GetKubernetesNamespace()
 		if err != nil {
 			return fmt.Errorf("failed to get kubernetes namespace: %w", err)
 		}
 		k8sNamespace = ns
+		
+		kubeconfig, kubeContext, err = uc.configService.GetKubernetesContext()
+		if err != nil {
+			return fmt.Errorf("failed to get kubernetes context: %w", err)
+		}
 	}
 	
-	// Step 4: Configure each database
+	// Step 4: Configure each database, then any further instances, e.g. a second PostgreSQL server,
+	// offering the running containers or pods to pick from
+	runDefaults := domain.BackupConfig{K8sNamespace: k8sNamespace, Kubeconfig: kubeconfig, KubeContext: kubeContext}
+	if method == domain.BackupMethodDockerExec || method == domain.BackupMethodKubectlExec {
+		workloads, err := uc.backupRepo.ListWorkloads(withRunDefaults(runDefaults, domain.DatabaseConfig{}), method, k8sNamespace)
+		if err != nil {
+			uc.outputService.PrintError(fmt.Sprintf("Could not list the running containers or pods, type their names instead: %v", err))
+		}
+		uc.configService.OfferWorkloads(workloads)
+	}
 	var dbConfigs []domain.DatabaseConfig
-	for _, dbType := range dbTypes {
-		config, err := uc.configService.ConfigureDatabase(dbType, method)
+	for _, db := range found {
+		config, err := uc.configService.ConfigureDiscoveredDatabase(db, method)
+		if err != nil {
+			return fmt.Errorf("failed to configure %s: %w", db.Service, err)
+		}
+		if dbConfigs, err = uc.addDatabase(dbConfigs, config, method, runDefaults); err != nil {
+			return err
+		}
+	}
+	for additional := false; ; additional = true {
+		for _, dbType := range dbTypes {
+			config, err := uc.configureDatabase(dbType, method, runDefaults, readEnvironment)
+			if err != nil {
+				return fmt.Errorf("failed to configure %s: %w", dbType, err)
+			}
+			// Further instances usually need telling apart in names and reports
+			if additional {
+				config.Label, err = uc.configService.PromptLabel(config)
+				if err != nil {
+					return fmt.Errorf("failed to get label: %w", err)
+				}
+			}
+			if dbConfigs, err = uc.addDatabase(dbConfigs, config, method, runDefaults); err != nil {
+				return err
+			}
+		}
+		
+		// Back changes the database configured last, so it is only offered once there is one
+		dbType, more, err := uc.configService.SelectAnotherDatabase(len(dbConfigs) > 0)
+		for errors.Is(err, domain.ErrBack) {
+			last := dbConfigs[len(dbConfigs)-1]
+			dbConfigs = dbConfigs[:len(dbConfigs)-1]
+			var config domain.DatabaseConfig
+			if config, err = uc.configService.EditDatabase(last, method); err != nil {
+				return fmt.Errorf("failed to edit %s: %w", last.Type, err)
+			}
+			if dbConfigs, err = uc.addDatabase(dbConfigs, config, method, runDefaults); err != nil {
+				return err
+			}
+			dbType, more, err = uc.configService.SelectAnotherDatabase(len(dbConfigs) > 0)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to configure %s: %w", dbType, err)
+			return fmt.Errorf("failed to select databases: %w", err)
+		}
+		if !more {
+			break
+		}
+		dbTypes = []domain.DatabaseType{dbType}
+		if !uc.methodSupports(method, dbTypes) {
+			dbTypes = nil // Asks for another database again
 		}
-		dbConfigs = append(dbConfigs, config)
+	}
+	
+	if len(dbConfigs) == 0 {
+		return fmt.Errorf("no databases to back up")
 	}
 	
 	// Step 5: Build backup config
@@ -72,49 +195,1242 @@ func (uc *BackupUsecase) ExecuteInteractiveBackup() error {
 		BackupDir:    "backup",
 		TempDir:      "/tmp/db-backups",
 		K8sNamespace: k8sNamespace,
+		Kubeconfig:   kubeconfig,
+		KubeContext:  kubeContext,
 		Databases:    dbConfigs,
 	}
 	
-	// Step 6: Print summary and confirm
-	uc.outputService.PrintConfigSummary(backupConfig)
-	confirmed, err := uc.configService.ConfirmBackup(backupConfig)
+	// Step 6-8: Review, execute and summarize
+	backupConfig, err := uc.confirmAndRun(backupConfig)
 	if err != nil {
-		return fmt.Errorf("failed to get confirmation: %w", err)
+		return err
 	}
-	if !confirmed {
-		uc.outputService.PrintError("Backup cancelled by user")
-		return nil
+	if err := uc.profileRepo.SaveLastAnswers(backupConfig); err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to remember the answers: %v", err))
+	}
+	
+	// Step 9: Offer to save the answers for next time
+	name, err := uc.configService.PromptProfileName()
+	if err != nil {
+		return fmt.Errorf("failed to get profile name: %w", err)
+	}
+	if name != "" {
+		if err := uc.profileRepo.SaveProfile(name, backupConfig); err != nil {
+			uc.outputService.PrintError(fmt.Sprintf("Failed to save profile: %v", err))
+		} else {
+			uc.outputService.PrintSuccess(fmt.Sprintf("Profile %q saved (passwords are not stored)", name))
+		}
+	}
+	
+	return nil
+}
+
+// addDatabase appends config to the databases of the run after offering to test the connection
+// to it. Until the test passes, the database may be edited and tested again, kept as it is or
+// left out.
+func (uc *BackupUsecase) addDatabase(dbConfigs []domain.DatabaseConfig, config domain.DatabaseConfig, method domain.BackupMethod, runDefaults domain.BackupConfig) ([]domain.DatabaseConfig, error) {
+	test, err := uc.configService.ConfirmConnectionTest(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get confirmation: %w", err)
+	}
+	
+	for test {
+		login, err := uc.backupRepo.ManagedLogin(withRunDefaults(runDefaults, config))
+		if err == nil {
+			err = uc.backupRepo.TestConnection(login, method, runDefaults.K8sNamespace)
+		}
+		if err == nil {
+			uc.outputService.PrintSuccess(fmt.Sprintf("Connected to %s %s", config.Type, config.Database))
+			break
+		}
+		if errors.Is(err, domain.ErrNoConnectionTest) {
+			uc.outputService.PrintError(fmt.Sprintf("The connection to %s %s cannot be tested before the backup", config.Type, config.Database))
+			break
+		}
+		uc.outputService.PrintError(fmt.Sprintf("Could not connect to %s %s: %v", config.Type, config.Database, err))
+		
+		action, err := uc.configService.ReviewConnectionFailure(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get choice: %w", err)
+		}
+		switch action {
+		case domain.ReviewEdit:
+			if config, err = uc.configService.EditDatabase(config, method); err != nil {
+				return nil, fmt.Errorf("failed to edit %s: %w", config.Type, err)
+			}
+		case domain.ReviewRemove:
+			return dbConfigs, nil
+		default:
+			test = false
+		}
+	}
+	return append(dbConfigs, config), nil
+}
+
+// selectDatabases asks which of the discovered databases to back up and, if none, which
+// types of database to configure. Going back from the types returns to the discovered
+// databases, and from those, or the types if none were discovered, returns domain.ErrBack.
+func (uc *BackupUsecase) selectDatabases(source string, discovered []domain.DiscoveredDatabase) ([]domain.DiscoveredDatabase, []domain.DatabaseType, error) {
+	for {
+		if len(discovered) > 0 {
+			found, err := uc.configService.SelectDiscoveredDatabases(source, discovered)
+			if err != nil || len(found) > 0 {
+				return found, nil, err
+			}
+		}
+		
+		dbTypes, err := uc.configService.SelectDatabases()
+		if errors.Is(err, domain.ErrBack) && len(discovered) > 0 {
+			continue
+		}
+		return nil, dbTypes, err
+	}
+}
+
+// methodSupports reports whether method can back up databases of all of dbTypes, printing an
+// error for the first it cannot
+func (uc *BackupUsecase) methodSupports(method domain.BackupMethod, dbTypes []domain.DatabaseType) bool {
+	if method != domain.BackupMethodSSH {
+		return true
+	}
+	for _, dbType := range dbTypes {
+		if !dbType.BackedUpOverSSH() {
+			uc.outputService.PrintError(fmt.Sprintf("%s cannot be backed up over %s, pick another method or database", dbType, method))
+			return false
+		}
+	}
+	return true
+}
+
+// configureDatabase asks for the details of one database. With readEnvironment and an exec
+// method, the container or pod is asked first and the credentials in its environment are
+// offered, once confirmed, as defaults for the remaining questions.
+func (uc *BackupUsecase) configureDatabase(dbType domain.DatabaseType, method domain.BackupMethod, runDefaults domain.BackupConfig, readEnvironment bool) (domain.DatabaseConfig, error) {
+	if !readEnvironment || method == domain.BackupMethodDockerRun || method == domain.BackupMethodSSH {
+		return uc.configService.ConfigureDatabase(dbType, method)
+	}
+	
+	target, err := uc.configService.PromptTarget(dbType, method)
+	if err != nil {
+		return domain.DatabaseConfig{}, err
+	}
+	
+	env, err := uc.backupRepo.ReadEnvironment(withRunDefaults(runDefaults, target), method, runDefaults.K8sNamespace)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Could not read credentials from the environment: %v", err))
+		return uc.configService.ConfigureTargetDatabase(target, method)
+	}
+	
+	found := domain.CredentialsFromEnv(dbType, env)
+	if found.User == "" && found.Password == "" && found.Database == "" {
+		return uc.configService.ConfigureTargetDatabase(target, method)
+	}
+	
+	use, err := uc.configService.ConfirmCredentials(target, found, method)
+	if err != nil {
+		return domain.DatabaseConfig{}, err
+	}
+	if use {
+		target.User, target.Password, target.Database, target.AuthDatabase = found.User, found.Password, found.Database, found.AuthDatabase
+	}
+	return uc.configService.ConfigureTargetDatabase(target, method)
+}
+
+// ExecuteProfileBackup replays a saved profile, prompting only for passwords. A non-empty
+// filter keeps only the databases tagged with it.
+func (uc *BackupUsecase) ExecuteProfileBackup(name string, filter domain.Tags) error {
+	uc.outputService.PrintHeader()
+	
+	config, err := uc.profileRepo.LoadProfile(name)
+	if err != nil {
+		return fmt.Errorf("failed to load profile: %w", err)
+	}
+	config.Timestamp = time.Now()
+	
+	config.Only(filter)
+	if len(config.Databases) == 0 {
+		return fmt.Errorf("no databases in profile %q are tagged %s", name, filter)
+	}
+	
+	for i := range config.Databases {
+		db := &config.Databases[i]
+		if db.Password != "" || !db.NeedsPassword() {
+			continue
+		}
+		password, err := uc.configService.PromptPassword(*db)
+		if err != nil {
+			return fmt.Errorf("failed to get password for %s: %w", db.Database, err)
+		}
+		db.Password = password
+	}
+	
+	_, err = uc.confirmAndRun(config)
+	return err
+}
+
+// confirmAndRun prints the configuration and size estimate and runs the backups once confirmed.
+// Until then databases may be edited or removed, each change showing the summary again, and
+// config is returned as changed.
+func (uc *BackupUsecase) confirmAndRun(config domain.BackupConfig) (domain.BackupConfig, error) {
+	runID := newRunID()
+	for {
+		// Labels are derived again, as an edited database may have been renamed
+		run := config
+		run.RunID = runID
+		run.Databases = append([]domain.DatabaseConfig(nil), config.Databases...)
+		run.AssignLabels()
+		uc.outputService.PrintConfigSummary(run)
+		uc.outputService.PrintEstimate(uc.estimate(run))
+		
+		action, i, err := uc.configService.ReviewBackup(run)
+		if err != nil {
+			return config, fmt.Errorf("failed to get confirmation: %w", err)
+		}
+		
+		switch action {
+		case domain.ReviewEdit:
+			edited, err := uc.configService.EditDatabase(config.Databases[i], config.Method)
+			if err != nil {
+				return config, fmt.Errorf("failed to edit %s: %w", config.Databases[i].Type, err)
+			}
+			config.Databases[i] = edited
+			
+		case domain.ReviewRemove:
+			config.Databases = append(config.Databases[:i:i], config.Databases[i+1:]...)
+			
+		case domain.ReviewCancel:
+			uc.outputService.PrintError("Backup cancelled by user")
+			return config, nil
+			
+		default:
+			results := uc.executeBackups(run)
+			uc.outputService.PrintSummary(results)
+			return config, nil
+		}
+	}
+}
+
+// ExecuteBackup runs a non-interactive backup from a prepared configuration, limited to the
+// databases tagged with filter if it is not empty, returning an error if any database failed
+func (uc *BackupUsecase) ExecuteBackup(config domain.BackupConfig, filter domain.Tags) error {
+	if config.RunID == "" {
+		config.RunID = newRunID()
+	}
+	uc.outputService.PrintHeader()
+	uc.ping(config.Heartbeat.Start, fmt.Sprintf("Run %s\n", config.RunID))
+	
+	results, err := uc.executeConfiguredBackup(config, filter)
+	if err != nil {
+		uc.ping(config.Heartbeat.Failure, heartbeatReport(config.RunID, results, err))
+	} else {
+		uc.ping(config.Heartbeat.Success, heartbeatReport(config.RunID, results, nil))
+	}
+	
+	return err
+}
+
+// Interrupt stops a running backup: the commands of the databases being backed up are stopped
+// and they are reported as interrupted, and the databases after them are not started. It returns
+// false when no backup is running, e.g. while prompting. Safe to call from a signal handler.
+func (uc *BackupUsecase) Interrupt() bool {
+	if !uc.running.Load() {
+		return false
+	}
+	uc.interrupted.Store(true)
+	uc.backupRepo.Interrupt()
+	return true
+}
+
+// executeConfiguredBackup backs up the databases of config matching filter
+func (uc *BackupUsecase) executeConfiguredBackup(config domain.BackupConfig, filter domain.Tags) ([]domain.BackupResult, error) {
+	if config.Timestamp.IsZero() {
+		config.Timestamp = time.Now()
 	}
 	
-	// Step 7: Execute backups
-	results := uc.executeBackups(backupConfig)
+	config.Only(filter)
+	if len(config.Databases) == 0 {
+		return nil, fmt.Errorf("no databases are tagged %s", filter)
+	}
+	config.AssignLabels()
 	
-	// Step 8: Print summary
+	uc.outputService.PrintConfigSummary(config)
+	
+	results := uc.executeBackups(config)
 	uc.outputService.PrintSummary(results)
 	
-	return nil
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+	if uc.interrupted.Load() {
+		return results, fmt.Errorf("%w: %d of %d backups completed", domain.ErrInterrupted, len(results)-failed, len(results))
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d backups failed", failed, len(results))
+	}
+	
+	return results, nil
+}
+
+// ping reports to the heartbeat URL, if one is set; a monitoring service being
+// unreachable must not fail the backup, so errors are only printed
+func (uc *BackupUsecase) ping(url, message string) {
+	if url == "" || uc.heartbeatRepo == nil {
+		return
+	}
+	if err := uc.heartbeatRepo.Ping(url, message); err != nil {
+		uc.outputService.PrintError(err.Error())
+	}
+}
+
+// heartbeatReport summarises a run for the monitoring service, which shows it with the ping
+func heartbeatReport(runID string, results []domain.BackupResult, err error) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Run %s\n", runID)
+	if err != nil {
+		fmt.Fprintf(&b, "Backup failed: %v\n", err)
+	}
+	for _, result := range results {
+		name := result.Database
+		if result.Label != "" {
+			name = result.Label
+		}
+		if result.Success {
+			fmt.Fprintf(&b, "OK %s - %s: %s (%s)\n", result.DatabaseType, name, result.BackupPath, result.Size)
+			for _, warning := range result.Warnings {
+				fmt.Fprintf(&b, "WARNING %s - %s: %s\n", result.DatabaseType, name, warning)
+			}
+		} else if errors.Is(result.Error, domain.ErrInterrupted) {
+			fmt.Fprintf(&b, "INTERRUPTED %s - %s: %v\n", result.DatabaseType, name, result.Error)
+		} else {
+			fmt.Fprintf(&b, "FAILED %s - %s: %v\n", result.DatabaseType, name, result.Error)
+		}
+	}
+	return b.String()
+}
+
+// backupJob is a database of a run and the name of its backup, resolved before any backup
+// starts. err keeps the database from being backed up.
+type backupJob struct {
+	dbConfig domain.DatabaseConfig
+	base     *domain.CatalogEntry
+	name     string
+	err      error
 }
 
-// executeBackups performs the actual backup operations
+// dumpedJob is a job whose dump is done, on its way to its stores and the catalog
+type dumpedJob struct {
+	index    int
+	span     domain.Span
+	dbConfig domain.DatabaseConfig
+	result   domain.BackupResult
+	started  bool // The job got as far as its dump, so copies it left pending are resumed
+}
+
+// executeBackups performs the actual backup operations, config.Parallel databases at a time.
+// Finished dumps are copied to their stores by config.Uploads.Parallel uploaders of their own,
+// which take them from a queue of config.Uploads.Queue. Results are returned in the order of
+// config.Databases, however the backups finish.
 func (uc *BackupUsecase) executeBackups(config domain.BackupConfig) []domain.BackupResult {
-	var results []domain.BackupResult
+	uc.running.Store(true)
+	defer uc.running.Store(false)
+	
+	workers := config.Parallel
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(config.Databases) {
+		workers = len(config.Databases)
+	}
+	uploaders := config.Uploads.Parallel
+	if uploaders < 1 {
+		uploaders = workers
+	}
+	queued := config.Uploads.Queue
+	if queued < 1 {
+		queued = domain.DefaultUploadQueue
+	}
 	
-	timestamp := config.Timestamp.Format("2006-01-02_15-04-05")
+	run := uc.tracer.Start("backup", domain.Attributes{
+		"backup.run_id":    config.RunID,
+		"backup.method":    config.Method.String(),
+		"backup.databases": len(config.Databases),
+		"backup.parallel":  workers,
+		"backup.uploaders": uploaders,
+	})
 	
-	for _, dbConfig := range config.Databases {
-		result := uc.backupDatabase(dbConfig, config.Method, timestamp, config.K8sNamespace, config.TempDir)
-		results = append(results, result)
-		uc.outputService.PrintBackupResult(result)
+	// Two dumps with the same name would overwrite each other, so names are claimed before
+	// backups run at once; MongoDB dumps can share a directory since mongodump writes one
+	// subdirectory per database
+	jobs := make([]backupJob, len(config.Databases))
+	used := make(map[string]bool)
+	for i, dbConfig := range config.Databases {
+		dbConfig = withRunDefaults(config, dbConfig)
+		job := backupJob{dbConfig: dbConfig}
+		if dbConfig.Type == domain.DatabaseTypeMongoDB && dbConfig.Differential {
+			job.base = uc.differentialBase(config, dbConfig)
+		}
+		job.name, job.err = backupName(config, dbConfig, job.base != nil)
+		if job.err == nil && dbConfig.StreamTo != "" {
+			job.err = checkStream(config, dbConfig)
+		}
+		path := filepath.Join(dbConfig.BackupDir, dbConfig.Type.String(), job.name)
+		if dbConfig.Type == domain.DatabaseTypeMongoDB && !dbConfig.Archive && job.base == nil && dbConfig.Snapshot == nil && dbConfig.HostSnapshot == nil && dbConfig.RDSSnapshot == nil {
+			path = filepath.Join(path, dbConfig.Database)
+		}
+		if job.err == nil && used[path] {
+			job.err = fmt.Errorf("backup name %s is already used by another database in this run", job.name)
+		}
+		if job.err == nil {
+			used[path] = true
+		}
+		jobs[i] = job
 	}
 	
+	results := make([]domain.BackupResult, len(jobs))
+	
+	// A full queue holds the dumps up until an uploader is free again
+	queue := make(chan dumpedJob, queued)
+	var uploading sync.WaitGroup
+	for w := 0; w < uploaders; w++ {
+		uploading.Add(1)
+		go func() {
+			defer uploading.Done()
+			for dumped := range queue {
+				results[dumped.index] = uc.finishJob(config, dumped)
+			}
+		}()
+	}
+	
+	next := make(chan int)
+	var dumping sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		dumping.Add(1)
+		go func() {
+			defer dumping.Done()
+			for i := range next {
+				dumped := uc.dumpJob(run, config, jobs[i])
+				dumped.index = i
+				// Backups that go nowhere are finished at once rather than queued
+				if dumped.started && len(dumped.dbConfig.Stores) > 0 {
+					queue <- dumped
+				} else {
+					results[i] = uc.finishJob(config, dumped)
+				}
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	dumping.Wait()
+	close(queue)
+	uploading.Wait()
+	
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+	var err error
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d backups failed", failed, len(results))
+	}
+	run.End(err)
+	
 	return results
 }
 
+// dumpJob backs up the database of job, encrypts and signs the backup
+func (uc *BackupUsecase) dumpJob(run domain.Span, config domain.BackupConfig, job backupJob) dumpedJob {
+	dbConfig := job.dbConfig
+	span := run.Start("backup "+dbConfig.Type.String(), domain.Attributes{
+		"db.system":     dbConfig.Type.String(),
+		"db.name":       dbConfig.Database,
+		"backup.label":  dbConfig.Label,
+		"backup.method": config.Method.String(),
+	})
+	span = timedPhases{Span: span, report: func(phase string, elapsed time.Duration) {
+		uc.outputService.PrintPhase(dbConfig.Type, dbConfig.Label, phase, elapsed)
+	}}
+	
+	var result domain.BackupResult
+	err := job.err
+	if err == nil && uc.interrupted.Load() {
+		err = fmt.Errorf("%w before it started", domain.ErrInterrupted)
+	}
+	if err != nil {
+		result = domain.BackupResult{DatabaseType: dbConfig.Type, Database: dbConfig.Database, Label: dbConfig.Label, Tags: dbConfig.Tags, Error: err}
+	} else {
+		result = uc.backupDatabase(span, dbConfig, job.base, config.Method, dbConfig.BackupDir, job.name, config.K8sNamespace, dbConfig.TempDir)
+		// Commands cut short fail with whatever their closed connection caused
+		if !result.Success && uc.interrupted.Load() && !errors.Is(result.Error, domain.ErrInterrupted) {
+			result.Error = fmt.Errorf("%w: %v", domain.ErrInterrupted, result.Error)
+		}
+	}
+	if result.Success && dbConfig.Encryption != nil && domain.IsEncryptable(result.BackupPath) {
+		uc.encrypt(span, dbConfig, *dbConfig.Encryption, &result)
+	}
+	if result.Success && config.Signing != nil {
+		uc.sign(span, config.Signing.Key, result.BackupPath)
+	}
+	return dumpedJob{span: span, dbConfig: dbConfig, result: result, started: err == nil}
+}
+
+// finishJob copies the backup of a dumped job to its stores, after the copies earlier backups
+// of its database left pending, packs and records it and prints the result
+func (uc *BackupUsecase) finishJob(config domain.BackupConfig, dumped dumpedJob) domain.BackupResult {
+	span, dbConfig, result := dumped.span, dumped.dbConfig, dumped.result
+	if dumped.started && !uc.interrupted.Load() {
+		uc.resumeCopies(span, config, dbConfig)
+	}
+	var copied copies
+	if result.Success && result.StreamedTo != "" {
+		copied = uc.publishStream(span, dbConfig, result)
+	} else if result.Success {
+		copied = uc.copyToStores(span, dbConfig, result.BackupPath)
+	}
+	// Copies left to resume need the dump as it is, and streamed dumps are not here to pack
+	if result.Success && config.Dedup && len(copied.pending) == 0 && result.StreamedTo == "" {
+		result.Packed = uc.pack(span, dbConfig, result.BackupPath)
+	}
+	if result.Success {
+		uc.checkTrends(dbConfig, &result)
+		uc.recordBackup(span, config, dbConfig, result, copied)
+		if dbConfig.LocalKeep > 0 {
+			uc.tier(span, dbConfig)
+		}
+	} else {
+		uc.recordFailure(config, dbConfig, result)
+	}
+	span.SetAttributes(domain.Attributes{"backup.size_bytes": result.SizeBytes})
+	span.End(result.Error)
+	uc.outputService.PrintBackupResult(result)
+	return result
+}
+
+// timedPhases passes the phases of a database's backup on to its span and reports how long
+// each took once it ended
+type timedPhases struct {
+	domain.Span
+	report func(phase string, elapsed time.Duration)
+}
+
+// Start starts a phase that is reported when it ends
+func (t timedPhases) Start(name string, attributes domain.Attributes) domain.Span {
+	return &timedPhase{Span: t.Span.Start(name, attributes), name: name, started: time.Now(), report: t.report}
+}
+
+// timedPhase is a phase of a backup, see timedPhases
+type timedPhase struct {
+	domain.Span
+	name    string
+	started time.Time
+	report  func(phase string, elapsed time.Duration)
+}
+
+// End ends the phase's span and reports how long it took
+func (p *timedPhase) End(err error) {
+	p.Span.End(err)
+	p.report(p.name, time.Since(p.started))
+}
+
+// backupName renders the file name (or MongoDB directory name) of a database's backup.
+// differential names the oplog dump of a differential MongoDB backup instead.
+func backupName(config domain.BackupConfig, dbConfig domain.DatabaseConfig, differential bool) (string, error) {
+	timestamp, err := domain.FormatTimestamp(config.Timestamp, config.TimestampFormat, config.Timezone)
+	if err != nil {
+		return "", err
+	}
+	
+	label := dbConfig.Label
+	if label == "" {
+		label = dbConfig.Database
+	}
+	
+	mode := dbConfig.DumpMode
+	if mode == "" {
+		mode = domain.DumpModeFull
+	}
+	
+	nameTemplate := config.NameTemplate
+	ext := ".sql"
+	if dbConfig.Snapshot != nil {
+		ext = domain.SnapshotBackupExt
+		if nameTemplate == "" {
+			nameTemplate = domain.DefaultSnapshotNameTemplate
+		}
+	} else if dbConfig.RDSSnapshot != nil {
+		ext = domain.RDSSnapshotExt
+		if nameTemplate == "" {
+			nameTemplate = domain.DefaultRDSSnapshotNameTemplate
+		}
+	} else if dbConfig.HostSnapshot != nil {
+		ext = domain.HostSnapshotExt + ".gz"
+		if nameTemplate == "" {
+			nameTemplate = domain.DefaultHostSnapshotNameTemplate
+		}
+	} else if dbConfig.Type == domain.DatabaseTypeMariaDB && dbConfig.Physical {
+		ext = domain.PhysicalBackupExt + ".gz"
+		if nameTemplate == "" {
+			nameTemplate = domain.DefaultPhysicalNameTemplate
+		}
+	} else if dbConfig.Type == domain.DatabaseTypeInfluxDB {
+		ext = domain.InfluxBackupExt + ".gz"
+		if nameTemplate == "" {
+			nameTemplate = domain.DefaultInfluxNameTemplate
+		}
+	} else if dbConfig.Type == domain.DatabaseTypeCockroachDB {
+		ext = domain.CockroachBackupExt + ".gz"
+		if nameTemplate == "" {
+			nameTemplate = domain.DefaultCockroachNameTemplate
+		}
+	} else if dbConfig.Type == domain.DatabaseTypeNeo4j {
+		ext = domain.Neo4jBackupExt
+		if nameTemplate == "" {
+			nameTemplate = domain.DefaultNeo4jNameTemplate
+		}
+	} else if dbConfig.Type == domain.DatabaseTypeEtcd {
+		ext = domain.EtcdSnapshotExt + ".gz"
+		if nameTemplate == "" {
+			nameTemplate = domain.DefaultEtcdNameTemplate
+		}
+	} else if dbConfig.Type == domain.DatabaseTypeRabbitMQ {
+		ext = domain.RabbitMQDefinitionsExt
+		if nameTemplate == "" {
+			nameTemplate = domain.DefaultRabbitMQNameTemplate
+		}
+	} else if differential {
+		ext = domain.OplogBackupExt + ".gz"
+		if nameTemplate == "" {
+			nameTemplate = domain.DefaultMongoOplogNameTemplate
+		}
+	} else if dbConfig.Type == domain.DatabaseTypeMongoDB && dbConfig.Archive {
+		ext = ".archive.gz"
+		if nameTemplate == "" {
+			nameTemplate = domain.DefaultMongoArchiveNameTemplate
+		}
+	} else if dbConfig.Type == domain.DatabaseTypeMongoDB {
+		ext = ""
+		if nameTemplate == "" && label != dbConfig.Database {
+			nameTemplate = domain.DefaultLabeledMongoNameTemplate
+		} else if nameTemplate == "" {
+			nameTemplate = domain.DefaultMongoNameTemplate
+		}
+	}
+	if nameTemplate == "" {
+		nameTemplate = domain.DefaultNameTemplate
+	}
+	
+	name, err := domain.BackupName{
+		Label:       label,
+		Database:    dbConfig.Database,
+		Type:        dbConfig.Type.String(),
+		Host:        dbConfig.Host,
+		Method:      config.Method.String(),
+		Mode:        string(mode),
+		Environment: config.Environment,
+		Timestamp:   timestamp,
+		Ext:         ext,
+	}.Render(nameTemplate)
+	
+	// Validation and restore tell oplog dumps and snapshots apart by their name
+	if err == nil && (differential && !domain.IsOplogBackup(name) ||
+		dbConfig.Snapshot != nil && !domain.IsSnapshotBackup(name) ||
+		dbConfig.RDSSnapshot != nil && !domain.IsRDSSnapshot(name) ||
+		dbConfig.HostSnapshot != nil && !domain.IsHostSnapshot(name)) {
+		name += ext
+	}
+	return dbConfig.Compression.Name(name), err
+}
+
+// differentialBase returns the full backup a differential MongoDB backup of dbConfig builds
+// on, or nil when a full backup is due: there is none yet, or the last is FullEvery old
+func (uc *BackupUsecase) differentialBase(config domain.BackupConfig, dbConfig domain.DatabaseConfig) *domain.CatalogEntry {
+	entries, err := uc.catalogRepo.ListEntries(dbConfig.BackupDir, domain.DatabaseTypeMongoDB)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to read the backup catalog, taking a full backup of %s: %v", dbConfig.Label, err))
+		return nil
+	}
+	
+	fullEvery := dbConfig.FullEvery
+	if fullEvery == 0 {
+		fullEvery = domain.DefaultFullEvery
+	}
+	
+	// Entries are newest first, so the first full backup of this database is the last one taken
+	for _, entry := range entries {
+		if entry.Database != dbConfig.Database || entry.Label != dbConfig.Label || entry.OplogTimestamp == "" || entry.Base != "" {
+			continue
+		}
+		if config.Timestamp.Sub(entry.CreatedAt) >= fullEvery {
+			return nil
+		}
+		return &entry
+	}
+	return nil
+}
+
+// withRunDefaults fills in the cluster settings, limits, destinations and KMS key a database did not set itself
+func withRunDefaults(config domain.BackupConfig, dbConfig domain.DatabaseConfig) domain.DatabaseConfig {
+	if dbConfig.KubeContext == "" {
+		dbConfig.KubeContext = config.KubeContext
+	}
+	if dbConfig.Kubeconfig == "" {
+		dbConfig.Kubeconfig = config.Kubeconfig
+	}
+	if dbConfig.Limits.IsZero() {
+		dbConfig.Limits = config.Limits
+	}
+	// The free space floor protects the disk rather than the database, so it is kept even
+	// when a database sets limits of its own
+	if dbConfig.Limits.MinFreeBytes == 0 {
+		dbConfig.Limits.MinFreeBytes = config.Limits.MinFreeBytes
+	}
+	if dbConfig.BackupDir == "" {
+		dbConfig.BackupDir = config.BackupDir
+	}
+	if dbConfig.Stores == nil {
+		dbConfig.Stores = config.Stores
+	}
+	if dbConfig.PartSize == 0 {
+		dbConfig.PartSize = config.PartSize
+	}
+	if dbConfig.StreamTo == "" {
+		dbConfig.StreamTo = config.StreamTo
+	}
+	if dbConfig.LocalKeep == 0 {
+		dbConfig.LocalKeep = config.LocalKeep
+	}
+	// Streamed backups are only in the store they were streamed to
+	if dbConfig.StreamTo != "" {
+		dbConfig.Stores = []string{dbConfig.StreamTo}
+	}
+	if dbConfig.TempDir == "" {
+		dbConfig.TempDir = config.TempDir
+	}
+	if dbConfig.Encryption == nil {
+		dbConfig.Encryption = config.Encryption
+	}
+	if dbConfig.MaxAge == 0 {
+		dbConfig.MaxAge = config.MaxAge
+	}
+	if dbConfig.Compression.Tool == "" {
+		dbConfig.Compression.Tool = config.Compression.Tool
+	}
+	if dbConfig.Compression.Threads == 0 {
+		dbConfig.Compression.Threads = config.Compression.Threads
+	}
+	if dbConfig.Anomalies.SizeDrop == 0 {
+		dbConfig.Anomalies.SizeDrop = config.Anomalies.SizeDrop
+	}
+	if dbConfig.Anomalies.Slowdown == 0 {
+		dbConfig.Anomalies.Slowdown = config.Anomalies.Slowdown
+	}
+	return dbConfig
+}
+
+// checkStream reports why the dumps of dbConfig cannot be streamed to its StreamTo store
+func checkStream(config domain.BackupConfig, dbConfig domain.DatabaseConfig) error {
+	if err := dbConfig.CheckStream(); err != nil {
+		return err
+	}
+	// Signatures are made over the finished file
+	if config.Signing != nil {
+		return fmt.Errorf("signed backups cannot be streamed")
+	}
+	store, err := domain.LookupStore(dbConfig.StreamTo)
+	if err != nil {
+		return err
+	}
+	if _, ok := store.(domain.StreamingStore); !ok {
+		return fmt.Errorf("store %s cannot take streamed backups", dbConfig.StreamTo)
+	}
+	return nil
+}
+
+// estimate asks each engine for its expected dump size and checks the space left in the backup directory
+func (uc *BackupUsecase) estimate(config domain.BackupConfig) domain.BackupEstimate {
+	estimate := domain.BackupEstimate{BackupDir: config.BackupDir}
+	
+	for _, dbConfig := range config.Databases {
+		// Snapshots stay in the cluster or in RDS and streamed dumps in their store, taking no
+		// space in the backup directory, nor do databases with a directory of their own
+		if dbConfig.Snapshot != nil || dbConfig.RDSSnapshot != nil || dbConfig.StreamTo != "" || config.StreamTo != "" ||
+			dbConfig.BackupDir != "" && filepath.Clean(dbConfig.BackupDir) != filepath.Clean(config.BackupDir) {
+			continue
+		}
+		var size int64
+		login, err := uc.backupRepo.ManagedLogin(withRunDefaults(config, dbConfig))
+		if err == nil {
+			size, err = uc.backupRepo.EstimateSize(login, config.Method, config.K8sNamespace)
+		}
+		estimate.Databases = append(estimate.Databases, domain.SizeEstimate{
+			DatabaseType: dbConfig.Type,
+			Database:     dbConfig.Database,
+			Label:        dbConfig.Label,
+			Bytes:        size,
+			Error:        err,
+		})
+	}
+	
+	estimate.FreeBytes, estimate.FreeError = uc.backupRepo.FreeSpace(config.BackupDir)
+	return estimate
+}
+
+// pack moves a finished backup into the chunk store. MongoDB dump directories and snapshot
+// records are kept as they are. The dump is only replaced once its chunks are stored, so a failure leaves
+// it in place and is only worth a warning.
+func (uc *BackupUsecase) pack(span domain.Span, dbConfig domain.DatabaseConfig, backupPath string) *domain.PackStats {
+	if uc.chunkRepo == nil || domain.IsSnapshotBackup(backupPath) || domain.IsRDSSnapshot(backupPath) ||
+		dbConfig.Type == domain.DatabaseTypeMongoDB && !dbConfig.Archive && !domain.IsOplogBackup(backupPath) {
+		return nil
+	}
+	
+	phase := span.Start("dedup", nil)
+	stats, err := uc.chunkRepo.Pack(backupPath, domain.ChunkStore(dbConfig.BackupDir))
+	phase.SetAttributes(domain.Attributes{"backup.chunks": stats.Chunks, "backup.stored_bytes": stats.StoredBytes})
+	phase.End(err)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to deduplicate %s, kept as is: %v", backupPath, err))
+		return nil
+	}
+	return &stats
+}
+
+// storeKey returns the key the backup at backupPath is kept under in the stores of dbConfig:
+// its path relative to the backup directory
+func storeKey(dbConfig domain.DatabaseConfig, backupPath string) string {
+	key, err := filepath.Rel(dbConfig.BackupDir, backupPath)
+	if err != nil {
+		key = filepath.Base(backupPath)
+	}
+	// Tenants may share a store, where their backups could otherwise have the same key
+	if dbConfig.Tenant != "" {
+		key = filepath.Join(dbConfig.Tenant, key)
+	}
+	return filepath.ToSlash(key)
+}
+
+// copies says where copyToStores copied a backup
+type copies struct {
+	stored  []string             // Stores holding a copy
+	parts   []domain.Part        // Parts the copies were cut into, if any
+	pending []domain.PendingCopy // Copies that failed, for later runs to resume
+}
+
+// copyToStores copies a finished backup to the configured stores before it is packed, so they
+// hold the dump rather than a chunk manifest. The backup itself is fine, so a store failing is
+// only worth a warning, and the copy is left for the next run to resume.
+func (uc *BackupUsecase) copyToStores(span domain.Span, dbConfig domain.DatabaseConfig, backupPath string) copies {
+	var copied copies
+	if len(dbConfig.Stores) == 0 {
+		return copied
+	}
+	key := storeKey(dbConfig, backupPath)
+	
+	// The checksums describe the backup as the stores receive it, so pull can check the copy
+	phase := span.Start("checksum", nil)
+	err := uc.backupRepo.ChecksumBackup(backupPath)
+	phase.End(err)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to write the checksums of %s: %v", backupPath, err))
+	}
+	
+	for _, name := range dbConfig.Stores {
+		phase := span.Start("store "+name, nil)
+		store, err := domain.LookupStore(name)
+		var put []domain.Part
+		if err == nil {
+			put, err = putCopy(uc.backupRepo, store, backupPath, key, dbConfig.PartSize, 0)
+		}
+		phase.SetAttributes(domain.Attributes{"backup.parts": len(put)})
+		phase.End(err)
+		if err != nil {
+			uc.outputService.PrintError(fmt.Sprintf("Failed to copy %s to store %s, left for the next run: %v", backupPath, name, err))
+			copied.pending = append(copied.pending, domain.PendingCopy{Store: name, Parts: put})
+			continue
+		}
+		// Every store is given the same parts, as they are cut at the same size
+		copied.stored, copied.parts = append(copied.stored, name), put
+	}
+	return copied
+}
+
+// publishStream puts the companions of a streamed dump, its checksums and globals, in the store
+// it went to and removes them here, where they were kept in place of the dump. The dump is in
+// the store already, so a companion failing is only worth a warning.
+func (uc *BackupUsecase) publishStream(span domain.Span, dbConfig domain.DatabaseConfig, result domain.BackupResult) copies {
+	partial := domain.PartialPath(result.BackupPath)
+	key := storeKey(dbConfig, result.BackupPath)
+	
+	phase := span.Start("store "+result.StreamedTo, nil)
+	store, err := domain.LookupStore(result.StreamedTo)
+	if err == nil {
+		err = putCompanions(store, partial, key)
+	}
+	phase.End(err)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to copy the checksums of %s to store %s: %v", key, result.StreamedTo, err))
+	}
+	for _, companion := range companions(partial, key) {
+		uc.backupRepo.RemoveBackup(companion[0])
+	}
+	return copies{stored: []string{result.StreamedTo}}
+}
+
+// resumeCopies copies the earlier backups of dbConfig that are still on disk to the stores
+// their copies failed for, going on from where each copy stopped. A backup whose copies are
+// all done is published to its new stores and, with dedup, packed. Copies to stores the
+// database is no longer copied to are given up.
+func (uc *BackupUsecase) resumeCopies(span domain.Span, config domain.BackupConfig, dbConfig domain.DatabaseConfig) {
+	entries, err := uc.catalogRepo.ListRecords(dbConfig.BackupDir)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to look for copies to resume: %v", err))
+		return
+	}
+	
+	for _, entry := range entries {
+		if len(entry.Pending) == 0 || !backupOf(dbConfig, entry) {
+			continue
+		}
+		if _, err := os.Stat(entry.Path); err != nil {
+			continue
+		}
+		if uc.chunkRepo != nil {
+			if packed, err := uc.chunkRepo.IsPacked(entry.Path); err == nil && packed {
+				continue
+			}
+		}
+		key := storeKey(dbConfig, entry.Path)
+		
+		var stored []string
+		var pending []domain.PendingCopy
+		for _, left := range entry.Pending {
+			if !slices.Contains(dbConfig.Stores, left.Store) {
+				continue
+			}
+			// The copy is cut as it started, or as the other copies were, so the parts line up
+			partSize := dbConfig.PartSize
+			switch {
+			case len(left.Parts) > 0:
+				partSize = left.Parts[0].Size
+			case len(entry.Parts) > 0:
+				partSize = entry.Parts[0].Size
+			case len(entry.Stores) > 0:
+				partSize = 0
+			}
+			
+			phase := span.Start("resume "+left.Store, nil)
+			store, err := domain.LookupStore(left.Store)
+			var put []domain.Part
+			if err == nil {
+				put, err = putCopy(uc.backupRepo, store, entry.Path, key, partSize, len(left.Parts))
+			}
+			phase.End(err)
+			if err != nil {
+				uc.outputService.PrintError(fmt.Sprintf("Failed to resume copying %s to store %s: %v", entry.Path, left.Store, err))
+				if len(put) > len(left.Parts) {
+					left.Parts = put
+				}
+				pending = append(pending, left)
+				continue
+			}
+			uc.outputService.PrintSuccess(fmt.Sprintf("Copied %s to store %s", entry.Path, left.Store))
+			stored = append(stored, left.Store)
+			entry.Stores = append(entry.Stores, left.Store)
+			entry.Parts = put
+		}
+		entry.Pending = pending
+		
+		if err := uc.catalogRepo.UpdateEntry(dbConfig.BackupDir, entry); err != nil {
+			uc.outputService.PrintError(fmt.Sprintf("Failed to record the copies of %s: %v", entry.Path, err))
+			continue
+		}
+		if len(stored) > 0 {
+			if err := putManifest(uc.catalogRepo, uc.backupRepo, entry, key, stored); err != nil {
+				uc.outputService.PrintError(fmt.Sprintf("Failed to put the manifest of %s in its stores: %v", key, err))
+			}
+		}
+		if config.Dedup && len(pending) == 0 {
+			uc.pack(span, dbConfig, entry.Path)
+		}
+	}
+}
+
+// companions pairs the files that travel with the backup at backupPath, so a copy fetched back
+// is complete and can be checked, verified and decrypted, with their keys next to key: its
+// globals, checksums, signature and data key
+func companions(backupPath, key string) [][2]string {
+	pairs := [][2]string{{domain.GlobalsPath(backupPath), domain.GlobalsPath(key)}}
+	for _, ext := range []string{domain.ChecksumExt, domain.SignatureExt, domain.KeyExt} {
+		pairs = append(pairs, [2]string{backupPath + ext, key + ext})
+	}
+	return pairs
+}
+
+// putCopy copies the backup at backupPath, with the companions it has, to store under key. A
+// file larger than partSize, unless that is zero, is copied in parts, which are returned; the
+// first skip parts were copied by an earlier attempt. On failure the parts copied so far are
+// returned, so the copy can go on from there.
+func putCopy(backupRepo domain.BackupRepository, store domain.BackupStore, backupPath, key string, partSize int64, skip int) ([]domain.Part, error) {
+	var parts []domain.Part
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	if partSize > 0 && !info.IsDir() && info.Size() > partSize {
+		parts, err = backupRepo.SplitBackup(backupPath, partSize, skip, func(index int, partPath string) error {
+			return store.Put(partPath, domain.PartKey(key, index))
+		})
+	} else {
+		err = store.Put(backupPath, key)
+	}
+	if err != nil {
+		return parts, err
+	}
+	return parts, putCompanions(store, backupPath, key)
+}
+
+// putCompanions copies the companions the backup at backupPath has to store, next to key
+func putCompanions(store domain.BackupStore, backupPath, key string) error {
+	for _, companion := range companions(backupPath, key) {
+		if _, err := os.Stat(companion[0]); err != nil || companion[0] == backupPath {
+			continue
+		}
+		if err := store.Put(companion[0], companion[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishManifest puts the catalog entry of a backup next to its copies, so catalog sync on
+// other hosts, such as one replacing this, learns of the backup
+func (uc *BackupUsecase) publishManifest(span domain.Span, dbConfig domain.DatabaseConfig, entry domain.CatalogEntry) {
+	key := storeKey(dbConfig, entry.Path)
+	phase := span.Start("manifest", nil)
+	err := putManifest(uc.catalogRepo, uc.backupRepo, entry, key, entry.Stores)
+	phase.End(err)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to put the manifest of %s in its stores: %v", key, err))
+	}
+}
+
+// putManifest puts entry in the named stores as the manifest of the backup under key. The
+// entry's path is the key there, as hosts may keep their backup directories elsewhere.
+func putManifest(catalogRepo domain.CatalogRepository, backupRepo domain.BackupRepository, entry domain.CatalogEntry, key string, stores []string) error {
+	manifest := domain.PartialPath(entry.Path) + domain.ManifestExt
+	defer backupRepo.RemoveBackup(manifest)
+	
+	entry.Path = key
+	if err := catalogRepo.WriteManifest(manifest, entry); err != nil {
+		return err
+	}
+	for _, name := range stores {
+		store, err := domain.LookupStore(name)
+		if err == nil {
+			err = store.Put(manifest, key+domain.ManifestExt)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encrypt encrypts a finished backup before it is signed, copied or recorded. A backup that
+// cannot be encrypted is removed rather than kept in plain, and fails.
+func (uc *BackupUsecase) encrypt(span domain.Span, dbConfig domain.DatabaseConfig, encryption domain.Encryption, result *domain.BackupResult) {
+	phase := span.Start("encrypt", nil)
+	err := uc.backupRepo.EncryptBackup(result.BackupPath, encryption)
+	phase.End(err)
+	if err != nil {
+		uc.discardPartial(dbConfig, result.BackupPath)
+		uc.backupRepo.RemoveBackup(domain.KeyPath(result.BackupPath))
+		result.Success = false
+		result.Error = fmt.Errorf("failed to encrypt the backup, which was removed: %w", err)
+		return
+	}
+	
+	result.EncryptionKey = encryption.String()
+	if size, err := uc.backupRepo.GetFileSize(result.BackupPath); err == nil {
+		result.SizeBytes = size
+		result.Size = domain.FormatBytes(size)
+	}
+}
+
+// sign writes the signature of a finished backup before it is copied or packed. The backup
+// itself is fine, so signing failing is only worth a warning; restores that verify will
+// refuse it until it is signed.
+func (uc *BackupUsecase) sign(span domain.Span, keyFile, backupPath string) {
+	phase := span.Start("sign", nil)
+	err := uc.backupRepo.SignBackup(backupPath, keyFile)
+	phase.End(err)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to sign %s: %v", backupPath, err))
+	}
+}
+
+// recordBackup adds a successful backup to the catalog so it can be restored later
+func (uc *BackupUsecase) recordBackup(span domain.Span, config domain.BackupConfig, dbConfig domain.DatabaseConfig, result domain.BackupResult, copied copies) {
+	source := dbConfig.Host
+	switch config.Method {
+	case domain.BackupMethodDockerExec:
+		source = dbConfig.Container
+	case domain.BackupMethodKubectlExec:
+		source = fmt.Sprintf("%s/%s", config.K8sNamespace, dbConfig.Pod)
+	case domain.BackupMethodSSH:
+		source = dbConfig.SSHHost
+	}
+	
+	entry := domain.CatalogEntry{
+		DatabaseType: dbConfig.Type,
+		Database:     dbConfig.Database,
+		Label:        dbConfig.Label,
+		Tags:         dbConfig.Tags,
+		Tenant:       dbConfig.Tenant,
+		Method:       config.Method,
+		Source:       source,
+		Path:         result.BackupPath,
+		Size:         result.Size,
+		SizeBytes:    result.SizeBytes,
+		CreatedAt:    config.Timestamp,
+		Duration:     result.Duration,
+		RunID:        config.RunID,
+		
+		OplogTimestamp: result.OplogTimestamp,
+		Base:           result.Base,
+		SnapshotARN:    result.SnapshotARN,
+		EncryptionKey:  result.EncryptionKey,
+		Stores:         copied.stored,
+		Parts:          copied.parts,
+		Pending:        copied.pending,
+		
+		ToolVersion: domain.Build.Version,
+		Format:      domain.ArtifactFormat,
+	}
+	
+	// The dump itself is fine, so a catalog problem is only worth a warning
+	phase := span.Start("catalog", nil)
+	entry, err := uc.catalogRepo.AddEntry(dbConfig.BackupDir, entry)
+	phase.End(err)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to add %s to the backup catalog: %v", result.BackupPath, err))
+		return
+	}
+	if len(copied.stored) > 0 {
+		uc.publishManifest(span, dbConfig, entry)
+	}
+}
+
+// tier removes the backups of dbConfig's database beyond its newest LocalKeep from disk,
+// keeping their records, once every copy of them is in its stores. A full backup stays while
+// differential backups build on it, so restoring one of those only fetches the one backup.
+func (uc *BackupUsecase) tier(span domain.Span, dbConfig domain.DatabaseConfig) {
+	entries, err := uc.catalogRepo.ListEntries(dbConfig.BackupDir, dbConfig.Type)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to list the backups of %s to move off the disk: %v", dbConfig.Database, err))
+		return
+	}
+	records, err := uc.catalogRepo.ListRecords(dbConfig.BackupDir)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to list the backups of %s to move off the disk: %v", dbConfig.Database, err))
+		return
+	}
+	
+	phase := span.Start("tier", nil)
+	kept, moved := 0, 0
+	for _, entry := range entries {
+		if entry.Database != dbConfig.Database || entry.Label != dbConfig.Label {
+			continue
+		}
+		if kept++; kept <= dbConfig.LocalKeep {
+			continue
+		}
+		// Snapshots are kept in the cluster or in RDS, and a copy still to resume needs the backup
+		if len(entry.Stores) == 0 || len(entry.Pending) > 0 || domain.IsSnapshotBackup(entry.Path) || domain.IsRDSSnapshot(entry.Path) ||
+			len(domain.Dependents(records, entry.Path)) > 0 {
+			continue
+		}
+		if err := uc.catalogRepo.RemoveLocal(entry); err != nil {
+			uc.outputService.PrintError(fmt.Sprintf("Failed to move %s off the disk: %v", entry.Path, err))
+			continue
+		}
+		moved++
+		uc.outputService.PrintSuccess(fmt.Sprintf("Moved %s off the disk; it is kept in %s", entry.Path, strings.Join(entry.Stores, ", ")))
+	}
+	phase.SetAttributes(domain.Attributes{"backup.tiered": moved})
+	phase.End(nil)
+}
+
+// checkTrends compares a successful backup with the previous ones of its database and warns
+// of it straying from them, see domain.Anomalies
+func (uc *BackupUsecase) checkTrends(dbConfig domain.DatabaseConfig, result *domain.BackupResult) {
+	entries, err := uc.catalogRepo.ListRecords(dbConfig.BackupDir)
+	if err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to compare %s with the previous backups: %v", result.BackupPath, err))
+		return
+	}
+	
+	// Differential backups are compared with differential ones, full backups with full ones
+	var previous []domain.CatalogEntry
+	for _, entry := range entries {
+		if backupOf(dbConfig, entry) && (entry.Base == "") == (result.Base == "") {
+			previous = append(previous, entry)
+		}
+	}
+	slices.SortStableFunc(previous, func(a, b domain.CatalogEntry) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	
+	// Differential backups only hold the changes since their base, and snapshots hold no dump
+	if result.Base == "" && !domain.IsSnapshotBackup(result.BackupPath) && !domain.IsRDSSnapshot(result.BackupPath) && !domain.IsHostSnapshot(result.BackupPath) {
+		if warning := dbConfig.Anomalies.SizeWarning(result.SizeBytes, previous); warning != "" {
+			result.Warnings = append(result.Warnings, warning)
+		}
+	}
+	if warning := dbConfig.Anomalies.DurationWarning(result.Duration, previous); warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
+}
+
+// recordFailure adds a failed backup to the audit log, since it leaves no catalog entry behind
+func (uc *BackupUsecase) recordFailure(config domain.BackupConfig, dbConfig domain.DatabaseConfig, result domain.BackupResult) {
+	event := domain.AuditEvent{
+		Time: time.Now(),
+		Kind: domain.AuditEventBackupFailed,
+		Backup: domain.CatalogEntry{
+			DatabaseType: dbConfig.Type,
+			Database:     dbConfig.Database,
+			Label:        dbConfig.Label,
+			Tags:         dbConfig.Tags,
+			Method:       config.Method,
+			CreatedAt:    config.Timestamp,
+			Duration:     result.Duration,
+			RunID:        config.RunID,
+		},
+	}
+	if result.Error != nil {
+		event.Detail = result.Error.Error()
+	}
+	if err := uc.catalogRepo.AddEvent(dbConfig.BackupDir, event); err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to add the failed backup of %s to the audit log: %v", dbConfig.Label, err))
+	}
+}
+
 // backupDatabase performs backup for a single database
 func (uc *BackupUsecase) backupDatabase(
+	span domain.Span,
 	dbConfig domain.DatabaseConfig,
+	base *domain.CatalogEntry,
 	method domain.BackupMethod,
-	timestamp string,
+	baseDir string,
+	name string,
 	namespace string,
 	tempDir string,
 ) domain.BackupResult {
@@ -123,60 +1439,179 @@ func (uc *BackupUsecase) backupDatabase(
 	result := domain.BackupResult{
 		DatabaseType: dbConfig.Type,
 		Database:     dbConfig.Database,
+		Label:        dbConfig.Label,
+		Tags:         dbConfig.Tags,
 		Success:      false,
 	}
 	
 	// Print backup start message
 	uc.outputService.PrintBackupStart(dbConfig.Type, dbConfig, method)
 	
+	// IAM tokens only live for minutes, so one is fetched right before each dump
+	dbConfig, err := uc.backupRepo.ManagedLogin(dbConfig)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(startTime)
+		return result
+	}
+	
 	// Create backup directory
-	backupDir := filepath.Join("backup", dbConfig.Type.String())
+	backupDir := filepath.Join(baseDir, dbConfig.Type.String())
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
 		result.Error = fmt.Errorf("failed to create backup directory: %w", err)
 		result.Duration = time.Since(startTime)
 		return result
 	}
 	
-	var backupPath string
-	var err error
+	// A dump started below the free space floor would only be cut short; streamed dumps take
+	// no room on the disk
+	if min := dbConfig.Limits.MinFreeBytes; min > 0 && dbConfig.StreamTo == "" {
+		if free, err := uc.backupRepo.FreeSpace(backupDir); err == nil && free < min {
+			result.Error = &domain.LowDiskSpaceError{Dir: backupDir, Free: free, Min: min}
+			result.Duration = time.Since(startTime)
+			return result
+		}
+	}
+	
+	backupPath := filepath.Join(backupDir, name)
+	
+	// Backups are written next to the finished ones and moved into place once they validated,
+	// so nothing reading the backup directory sees one before it is complete. Snapshot records
+	// are written in one go once the snapshot exists.
+	writePath := backupPath
+	if dbConfig.Snapshot == nil && dbConfig.RDSSnapshot == nil {
+		writePath = domain.PartialPath(backupPath)
+		if err := os.MkdirAll(filepath.Dir(writePath), 0755); err != nil {
+			result.Error = fmt.Errorf("failed to create backup directory: %w", err)
+			result.Duration = time.Since(startTime)
+			return result
+		}
+	}
+	// Streamed dumps go under the key their copy would have, and leave a record behind
+	checkPath := writePath
+	if dbConfig.StreamTo != "" {
+		dbConfig.StreamKey = storeKey(dbConfig, backupPath)
+		checkPath = domain.StreamRecordPath(writePath)
+	}
+	// SQL dumps are compressed while they are written, so the dump span covers compression too
+	phase := span.Start("dump", domain.Attributes{"backup.path": backupPath})
 	
-	// Execute backup based on database type
-	switch dbConfig.Type {
-	case domain.DatabaseTypePostgres:
-		backupPath = filepath.Join(backupDir, fmt.Sprintf("%s_%s.sql", dbConfig.Database, timestamp))
-		err = uc.backupRepo.BackupPostgres(dbConfig, method, backupPath, namespace)
+	// Snapshots are engine independent; everything else is dumped by the engine of its type
+	switch {
+	case dbConfig.Snapshot != nil:
+		err = uc.backupRepo.BackupVolumeSnapshot(dbConfig, method, backupPath, namespace)
 		
-	case domain.DatabaseTypeMySQL:
-		backupPath = filepath.Join(backupDir, fmt.Sprintf("%s_%s.sql", dbConfig.Database, timestamp))
-		err = uc.backupRepo.BackupMySQL(dbConfig, method, backupPath, namespace)
+	case dbConfig.RDSSnapshot != nil:
+		result.SnapshotARN, err = uc.backupRepo.BackupRDSSnapshot(dbConfig, backupPath)
 		
-	case domain.DatabaseTypeMariaDB:
-		backupPath = filepath.Join(backupDir, fmt.Sprintf("%s_%s.sql", dbConfig.Database, timestamp))
-		err = uc.backupRepo.BackupMariaDB(dbConfig, method, backupPath, namespace)
+	case dbConfig.HostSnapshot != nil:
+		err = uc.backupRepo.BackupHostSnapshot(dbConfig, method, writePath, namespace)
 		
-	case domain.DatabaseTypeMongoDB:
-		backupPath = filepath.Join(backupDir, timestamp)
-		err = uc.backupRepo.BackupMongoDB(dbConfig, method, backupPath, namespace, tempDir)
+	case base != nil:
+		// Only MongoDB takes differential backups, as oplog dumps
+		result.Base = base.Path
+		var since domain.OplogTimestamp
+		if since, err = domain.ParseOplogTimestamp(base.OplogTimestamp); err == nil {
+			err = uc.backupRepo.BackupMongoOplog(dbConfig, method, writePath, namespace, since)
+		}
+		
+	default:
+		var engine domain.DatabaseEngine
+		if engine, err = domain.LookupEngine(dbConfig.Type); err != nil {
+			break
+		}
+		
+		// Taken before the dump starts, so the next differential backup also replays what was
+		// written while it ran; oplog entries can be applied twice without harm
+		if dbConfig.Differential {
+			var since domain.OplogTimestamp
+			if since, err = uc.backupRepo.MongoOplogTimestamp(dbConfig, method, namespace); err != nil {
+				break
+			}
+			result.OplogTimestamp = since.String()
+		}
+		err = engine.Dump(dbConfig, method, writePath, namespace, tempDir)
 	}
 	
+	phase.End(err)
 	result.Duration = time.Since(startTime)
 	result.BackupPath = backupPath
 	
 	if err != nil {
 		result.Error = err
+		var cmdErr *domain.CommandError
+		if errors.As(err, &cmdErr) {
+			result.Stderr = cmdErr.Stderr
+		}
+		uc.discardPartial(dbConfig, writePath)
 		return result
 	}
 	
+	// Make sure the tool actually produced a dump rather than an empty or truncated file
+	phase = span.Start("verify", nil)
+	err = uc.backupRepo.ValidateBackup(dbConfig.Type, checkPath)
+	phase.End(err)
+	if err != nil {
+		result.Error = fmt.Errorf("backup validation failed: %w", err)
+		uc.discardPartial(dbConfig, writePath)
+		return result
+	}
+	
+	// The globals go first, so the dump never appears without them. Those of a streamed dump
+	// stay with its checksums until they follow the dump to its store.
+	if writePath != backupPath && dbConfig.StreamTo == "" {
+		if dbConfig.Globals {
+			err = uc.backupRepo.FinalizeBackup(domain.GlobalsPath(writePath), domain.GlobalsPath(backupPath))
+		}
+		if err == nil {
+			err = uc.backupRepo.FinalizeBackup(writePath, backupPath)
+		}
+		if err != nil {
+			result.Error = err
+			uc.discardPartial(dbConfig, writePath)
+			return result
+		}
+	}
+	
 	// Get backup size
-	isDirectory := dbConfig.Type == domain.DatabaseTypeMongoDB
-	size, err := uc.backupRepo.GetFileSize(backupPath, isDirectory)
+	sizePath := backupPath
+	if dbConfig.StreamTo != "" {
+		sizePath = checkPath
+	}
+	size, err := uc.backupRepo.GetFileSize(sizePath)
 	if err != nil {
 		result.Error = fmt.Errorf("backup created but failed to get size: %w", err)
 		return result
 	}
+	if dbConfig.StreamTo != "" {
+		uc.backupRepo.RemoveBackup(checkPath)
+		result.StreamedTo = dbConfig.StreamTo
+	}
 	
-	result.Size = size
+	result.SizeBytes = size
+	result.Size = domain.FormatBytes(size)
 	result.Success = true
 	
 	return result
 }
+
+// discardPartial removes what a failed backup left at writePath, so it is never moved into
+// place. Snapshot records are kept, as the snapshot they point at may exist.
+func (uc *BackupUsecase) discardPartial(dbConfig domain.DatabaseConfig, writePath string) {
+	if dbConfig.Snapshot != nil || dbConfig.RDSSnapshot != nil {
+		return
+	}
+	
+	paths := []string{writePath}
+	if dbConfig.Globals {
+		paths = append(paths, domain.GlobalsPath(writePath))
+	}
+	if dbConfig.StreamTo != "" {
+		paths = append(paths, domain.ChecksumPath(writePath), domain.StreamRecordPath(writePath))
+	}
+	for _, path := range paths {
+		if err := uc.backupRepo.RemoveBackup(path); err != nil {
+			uc.outputService.PrintError(fmt.Sprintf("Failed to remove the partial backup of %s: %v", dbConfig.Label, err))
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// ChainUsecase shows and prunes the chains of full and differential backups in a backup directory
+type ChainUsecase struct {
+	catalogRepo   domain.CatalogRepository
+	outputService domain.OutputService
+}
+
+// NewChainUsecase creates a new chain usecase
+func NewChainUsecase(
+	catalogRepo domain.CatalogRepository,
+	outputService domain.OutputService,
+) *ChainUsecase {
+	return &ChainUsecase{
+		catalogRepo:   catalogRepo,
+		outputService: outputService,
+	}
+}
+
+// Show prints the current restore chain of each database or label named database under backupDir
+func (uc *ChainUsecase) Show(backupDir, database string) error {
+	found := false
+	for _, dbType := range domain.EngineTypes() {
+		entries, err := restorableEntries(uc.catalogRepo, backupDir, dbType)
+		if err != nil {
+			return err
+		}
+
+		groups := make(map[string][]domain.CatalogEntry)
+		var labels []string
+		for _, entry := range entries {
+			if entry.Database != database && entry.Label != database {
+				continue
+			}
+			if _, ok := groups[entry.Label]; !ok {
+				labels = append(labels, entry.Label)
+			}
+			groups[entry.Label] = append(groups[entry.Label], entry)
+		}
+
+		for _, label := range labels {
+			found = true
+			chains, broken := domain.Chains(groups[label])
+			for _, entry := range broken {
+				uc.outputService.PrintError(fmt.Sprintf("%s cannot be restored: its full backup %s is missing", entry.Path, entry.Base))
+			}
+			if len(chains) > 0 {
+				uc.outputService.PrintChain(chains[0])
+			}
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no backups of %s found in %s", database, backupDir)
+	}
+	return nil
+}
+
+// Prune removes all but the newest keep backups of each database under backupDir, counting
+// those only kept in stores, whose records go while their copies stay. A full backup that
+// kept differential backups build on is kept as well, since they cannot be restored without it.
+func (uc *ChainUsecase) Prune(backupDir string, keep int, dryRun bool) error {
+	var removed, retained, failed int
+	for _, dbType := range domain.EngineTypes() {
+		entries, err := restorableEntries(uc.catalogRepo, backupDir, dbType)
+		if err != nil {
+			return err
+		}
+
+		// Entries are newest first, so everything past the first keep of a database goes
+		seen := make(map[string]int)
+		var candidates []domain.CatalogEntry
+		for _, entry := range entries {
+			key := entry.Database + "\x00" + entry.Label
+			seen[key]++
+			if seen[key] > keep {
+				candidates = append(candidates, entry)
+			}
+		}
+		// Remove differential backups before the full backups they build on
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].IsDifferential() && !candidates[j].IsDifferential()
+		})
+
+		gone := make(map[string]bool)
+		for _, entry := range candidates {
+			var remaining []domain.CatalogEntry
+			for _, other := range entries {
+				if !gone[filepath.Clean(other.Path)] {
+					remaining = append(remaining, other)
+				}
+			}
+			if dependents := domain.Dependents(remaining, entry.Path); len(dependents) > 0 {
+				uc.outputService.PrintSuccess(fmt.Sprintf("Keeping %s: %d differential backups build on it", entry.Path, len(dependents)))
+				retained++
+				continue
+			}
+
+			if !dryRun {
+				if err := uc.catalogRepo.RemoveEntry(backupDir, entry); err != nil {
+					var inUse *domain.BaseInUseError
+					if errors.As(err, &inUse) {
+						uc.outputService.PrintSuccess(fmt.Sprintf("Keeping %s: %d differential backups build on it", entry.Path, len(inUse.Dependents)))
+						retained++
+					} else {
+						uc.outputService.PrintError(fmt.Sprintf("Failed to remove %s: %v", entry.Path, err))
+						failed++
+					}
+					continue
+				}
+				uc.recordRemoval(backupDir, entry, keep)
+			}
+			gone[filepath.Clean(entry.Path)] = true
+			removed++
+			if dryRun {
+				uc.outputService.PrintSuccess(fmt.Sprintf("Would remove %s", entry.Path))
+			} else {
+				uc.outputService.PrintSuccess(fmt.Sprintf("Removed %s", entry.Path))
+			}
+		}
+	}
+
+	if dryRun {
+		uc.outputService.PrintSuccess(fmt.Sprintf("Would remove %d backups, keeping %d full backups still in use", removed, retained))
+	} else {
+		uc.outputService.PrintSuccess(fmt.Sprintf("Removed %d backups, kept %d full backups still in use", removed, retained))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d backups could not be removed", failed)
+	}
+	return nil
+}
+
+// PruneConfig prunes every backup directory of config, keeping the backups a tenant's
+// directory is configured to keep and keep in the others. Directories without either are
+// left alone.
+func (uc *ChainUsecase) PruneConfig(config domain.BackupConfig, keep int, dryRun bool) error {
+	var failed []string
+	for _, backupDir := range config.BackupDirs() {
+		dirKeep := keep
+		if tenant, ok := config.Tenant(config.TenantOf(backupDir)); ok && tenant.Keep > 0 {
+			dirKeep = tenant.Keep
+		}
+		if dirKeep < 1 {
+			uc.outputService.PrintSuccess(fmt.Sprintf("Skipping %s: no keep is configured for it, pass -keep", backupDir))
+			continue
+		}
+
+		uc.outputService.PrintSuccess(fmt.Sprintf("Pruning %s, keeping %d backups per database", backupDir, dirKeep))
+		if err := uc.Prune(backupDir, dirKeep, dryRun); err != nil {
+			uc.outputService.PrintError(err.Error())
+			failed = append(failed, backupDir)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("pruning failed in %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// recordRemoval adds a pruned backup to the audit log, which only warns on failure since the
+// backup is gone either way
+func (uc *ChainUsecase) recordRemoval(backupDir string, entry domain.CatalogEntry, keep int) {
+	event := domain.AuditEvent{
+		Time:   time.Now(),
+		Kind:   domain.AuditEventRemoval,
+		Backup: entry,
+		Detail: fmt.Sprintf("prune -keep %d", keep),
+	}
+	if err := uc.catalogRepo.AddEvent(backupDir, event); err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to add the removal of %s to the audit log: %v", entry.Path, err))
+	}
+}
@@ -0,0 +1,157 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// CloneUsecase copies a database from one environment into another, e.g. to refresh staging from production
+type CloneUsecase struct {
+	cloneRepo     domain.CloneRepository
+	configService domain.ConfigService
+	outputService domain.OutputService
+}
+
+// NewCloneUsecase creates a new clone usecase
+func NewCloneUsecase(
+	cloneRepo domain.CloneRepository,
+	configService domain.ConfigService,
+	outputService domain.OutputService,
+) *CloneUsecase {
+	return &CloneUsecase{
+		cloneRepo:     cloneRepo,
+		configService: configService,
+		outputService: outputService,
+	}
+}
+
+// ExecuteInteractiveClone asks for a source and a target database and copies one into the other
+func (uc *CloneUsecase) ExecuteInteractiveClone() error {
+	uc.outputService.PrintHeader()
+
+	// Step 1: Select database type
+	dbType, err := uc.configService.SelectDatabaseType()
+	if err != nil {
+		return fmt.Errorf("failed to select database type: %w", err)
+	}
+
+	// Step 2: Configure the source
+	sourceMethod, sourceKube, err := uc.selectMethod()
+	if err != nil {
+		return err
+	}
+	source, err := uc.configService.ConfigureDatabase(dbType, sourceMethod)
+	if err != nil {
+		return fmt.Errorf("failed to configure source: %w", err)
+	}
+
+	// Step 3: Configure the target, defaulting to the source's database name
+	targetMethod, targetKube, err := uc.selectMethod()
+	if err != nil {
+		return err
+	}
+	target, err := uc.configService.ConfigureRestoreTarget(domain.CatalogEntry{
+		DatabaseType: dbType,
+		Database:     source.Database,
+	}, targetMethod)
+	if err != nil {
+		return fmt.Errorf("failed to configure target: %w", err)
+	}
+
+	config := domain.CloneConfig{
+		Source:          source,
+		SourceMethod:    sourceMethod,
+		SourceNamespace: sourceKube.namespace,
+		Target:          target,
+		TargetMethod:    targetMethod,
+		TargetNamespace: targetKube.namespace,
+		TempDir:         "/tmp/db-backups",
+	}
+	sourceKube.applyTo(&config.Source)
+	targetKube.applyTo(&config.Target)
+
+	// Step 4: Confirm, since the target is overwritten
+	confirmed, err := uc.configService.ConfirmClone(config)
+	if err != nil {
+		return fmt.Errorf("failed to get confirmation: %w", err)
+	}
+	if !confirmed {
+		uc.outputService.PrintError("Clone cancelled by user")
+		return nil
+	}
+
+	return uc.ExecuteClone(config)
+}
+
+// ExecuteClone copies config.Source into config.Target without prompting
+func (uc *CloneUsecase) ExecuteClone(config domain.CloneConfig) error {
+	startTime := time.Now()
+	uc.outputService.PrintCloneStart(config)
+
+	result := domain.RestoreResult{
+		DatabaseType: config.Target.Type,
+		Database:     config.Target.Database,
+		BackupPath:   config.Source.Database,
+	}
+
+	err := uc.cloneRepo.Clone(config)
+	result.Duration = time.Since(startTime)
+
+	if err != nil {
+		result.Error = err
+		var cmdErr *domain.CommandError
+		if errors.As(err, &cmdErr) {
+			result.Stderr = cmdErr.Stderr
+		}
+		uc.outputService.PrintRestoreResult(result)
+		return fmt.Errorf("clone of %s failed", config.Source.Database)
+	}
+
+	result.Success = true
+	uc.outputService.PrintRestoreResult(result)
+	return nil
+}
+
+// kubeSettings holds the cluster answers given for one side of a clone
+type kubeSettings struct {
+	namespace   string
+	kubeconfig  string
+	kubeContext string
+}
+
+// applyTo fills in the cluster settings a database did not set itself
+func (k kubeSettings) applyTo(config *domain.DatabaseConfig) {
+	if config.KubeContext == "" {
+		config.KubeContext = k.kubeContext
+	}
+	if config.Kubeconfig == "" {
+		config.Kubeconfig = k.kubeconfig
+	}
+}
+
+// selectMethod asks how to reach one side of the clone, and which cluster for kubectl-exec
+func (uc *CloneUsecase) selectMethod() (domain.BackupMethod, kubeSettings, error) {
+	settings := kubeSettings{namespace: "default"}
+
+	method, err := uc.configService.SelectBackupMethod()
+	if err != nil {
+		return "", settings, fmt.Errorf("failed to select method: %w", err)
+	}
+
+	if method == domain.BackupMethodKubectlExec {
+		settings.namespace, err = uc.configService.GetKubernetesNamespace()
+		if err != nil {
+			return "", settings, fmt.Errorf("failed to get kubernetes namespace: %w", err)
+		}
+
+		settings.kubeconfig, settings.kubeContext, err = uc.configService.GetKubernetesContext()
+		if err != nil {
+			return "", settings, fmt.Errorf("failed to get kubernetes context: %w", err)
+		}
+	}
+
+	return method, settings, nil
+}
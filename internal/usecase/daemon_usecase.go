@@ -0,0 +1,331 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// maxRuns is how many finished runs are kept in memory for status queries
+const maxRuns = 100
+
+// DaemonUsecase runs backups in the background for serve mode and keeps track of them
+type DaemonUsecase struct {
+	loadConfig  func() (domain.BackupConfig, error)
+	newBackup   func(output domain.OutputService) *BackupUsecase
+	newRestore  func(output domain.OutputService) *RestoreUsecase
+	catalogRepo domain.CatalogRepository
+	chunkRepo   domain.ChunkRepository
+
+	mu      sync.Mutex
+	runs    []*domain.Run
+	active  *domain.Run
+	changed chan struct{} // Closed and replaced whenever a run changes
+}
+
+// NewDaemonUsecase creates a daemon usecase. loadConfig is called for every run, so config
+// changes apply without a restart; newBackup and newRestore build usecases reporting to the given output.
+func NewDaemonUsecase(
+	loadConfig func() (domain.BackupConfig, error),
+	newBackup func(output domain.OutputService) *BackupUsecase,
+	newRestore func(output domain.OutputService) *RestoreUsecase,
+	catalogRepo domain.CatalogRepository,
+	chunkRepo domain.ChunkRepository,
+) *DaemonUsecase {
+	return &DaemonUsecase{
+		loadConfig:  loadConfig,
+		newBackup:   newBackup,
+		newRestore:  newRestore,
+		catalogRepo: catalogRepo,
+		chunkRepo:   chunkRepo,
+		changed:     make(chan struct{}),
+	}
+}
+
+// StartRun starts a backup of the databases tagged with filter (all if empty) and returns at once.
+// Only one run or restore may be active at a time.
+func (uc *DaemonUsecase) StartRun(filter domain.Tags) (domain.Run, error) {
+	config, err := uc.loadConfig()
+	if err != nil {
+		return domain.Run{}, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	run := &domain.Run{Kind: domain.RunKindBackup, Filter: filter}
+	return uc.start(run, func(output domain.OutputService) error {
+		// The run's log, catalog entries and reports carry the ID the API returned
+		config.RunID = run.ID
+		return uc.newBackup(output).ExecuteBackup(config, filter)
+	})
+}
+
+// StartRestore restores the catalog entry with the given ID into the configured database with the
+// same type and label, and returns at once. It shares the one-at-a-time limit of StartRun.
+func (uc *DaemonUsecase) StartRestore(id string) (domain.Run, error) {
+	config, err := uc.loadConfig()
+	if err != nil {
+		return domain.Run{}, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	entry, ok, err := uc.FindBackup(id)
+	if err != nil {
+		return domain.Run{}, err
+	}
+	if !ok {
+		return domain.Run{}, fmt.Errorf("%w: %s", domain.ErrBackupNotFound, id)
+	}
+
+	target, ok := restoreTarget(config, entry)
+	if !ok {
+		return domain.Run{}, fmt.Errorf("%w: %s", domain.ErrNoRestoreTarget, displayLabel(entry))
+	}
+
+	run := &domain.Run{Kind: domain.RunKindRestore, Backup: entry.ID}
+	return uc.start(run, func(output domain.OutputService) error {
+		return uc.newRestore(output).ExecuteRestore(entry, target, config.Method, config.K8sNamespace, config.TempDir,
+			domain.RestoreOptions{VerifyKey: config.Signing.VerifyKey()})
+	})
+}
+
+// start registers run as the active run and executes it in the background
+func (uc *DaemonUsecase) start(run *domain.Run, execute func(output domain.OutputService) error) (domain.Run, error) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if uc.active != nil {
+		return domain.Run{}, domain.ErrRunInProgress
+	}
+
+	run.ID = newRunID()
+	run.Status = domain.RunStatusRunning
+	run.StartedAt = time.Now()
+	uc.active = run
+	uc.runs = append(uc.runs, run)
+	if len(uc.runs) > maxRuns {
+		uc.runs = uc.runs[len(uc.runs)-maxRuns:]
+	}
+	uc.notify()
+
+	go func() {
+		uc.finish(run, execute(&runRecorder{uc: uc, run: run}))
+	}()
+	return copyRun(run), nil
+}
+
+// finish records the outcome of run
+func (uc *DaemonUsecase) finish(run *domain.Run, err error) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	run.Current = ""
+	run.FinishedAt = time.Now()
+	run.Status = domain.RunStatusSucceeded
+	if err != nil {
+		run.Status = domain.RunStatusFailed
+		run.Error = err.Error()
+	}
+	uc.active = nil
+	uc.notify()
+}
+
+// update changes run under the lock and wakes up watchers
+func (uc *DaemonUsecase) update(run *domain.Run, change func(run *domain.Run)) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	change(run)
+	uc.notify()
+}
+
+// notify wakes up everyone waiting in WatchRun; uc.mu must be held
+func (uc *DaemonUsecase) notify() {
+	close(uc.changed)
+	uc.changed = make(chan struct{})
+}
+
+// GetRun returns a run by ID
+func (uc *DaemonUsecase) GetRun(id string) (domain.Run, bool) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if run := uc.findRun(id); run != nil {
+		return copyRun(run), true
+	}
+	return domain.Run{}, false
+}
+
+// WatchRun calls send with the run now and again after every change, until the run has
+// finished, send fails or ctx is cancelled
+func (uc *DaemonUsecase) WatchRun(ctx context.Context, id string, send func(run domain.Run) error) error {
+	for {
+		uc.mu.Lock()
+		run := uc.findRun(id)
+		changed := uc.changed
+		var snapshot domain.Run
+		if run != nil {
+			snapshot = copyRun(run)
+		}
+		uc.mu.Unlock()
+
+		if run == nil {
+			return fmt.Errorf("%w: %s", domain.ErrRunNotFound, id)
+		}
+		if err := send(snapshot); err != nil {
+			return err
+		}
+		if snapshot.Status != domain.RunStatusRunning {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// findRun returns the run with the given ID; uc.mu must be held
+func (uc *DaemonUsecase) findRun(id string) *domain.Run {
+	for _, run := range uc.runs {
+		if run.ID == id {
+			return run
+		}
+	}
+	return nil
+}
+
+// ListRuns returns the runs kept in memory, newest first
+func (uc *DaemonUsecase) ListRuns() []domain.Run {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	runs := make([]domain.Run, 0, len(uc.runs))
+	for i := len(uc.runs) - 1; i >= 0; i-- {
+		runs = append(runs, copyRun(uc.runs[i]))
+	}
+	return runs
+}
+
+// ListBackups returns the backups of every database type in the configured backup directories, newest
+// first, including those only kept in stores, which restores fetch from there
+func (uc *DaemonUsecase) ListBackups() ([]domain.CatalogEntry, error) {
+	config, err := uc.loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	return NewListUsecase(uc.catalogRepo).Execute(config.BackupDirs(), "")
+}
+
+// OpenPackedBackup returns the content of a backup stored as chunks, as it was before it was
+// packed; ok is false for backups stored as plain files or directories
+func (uc *DaemonUsecase) OpenPackedBackup(entry domain.CatalogEntry) (content io.ReadCloser, ok bool, err error) {
+	if packed, err := uc.chunkRepo.IsPacked(entry.Path); err != nil || !packed {
+		return nil, false, err
+	}
+	content, err = uc.chunkRepo.Open(entry.Path)
+	return content, err == nil, err
+}
+
+// FindBackup returns the catalog entry with the given ID
+func (uc *DaemonUsecase) FindBackup(id string) (domain.CatalogEntry, bool, error) {
+	entries, err := uc.ListBackups()
+	if err != nil {
+		return domain.CatalogEntry{}, false, err
+	}
+	for _, entry := range entries {
+		if entry.ID != "" && entry.ID == id {
+			return entry, true, nil
+		}
+	}
+	return domain.CatalogEntry{}, false, nil
+}
+
+// restoreTarget finds the configured database a backup belongs to, matching the label
+// and falling back to the database name for backups recorded without one. Labels are only
+// unique within a tenant, so only the databases of the tenant holding the backup are matched.
+func restoreTarget(config domain.BackupConfig, entry domain.CatalogEntry) (domain.DatabaseConfig, bool) {
+	config.AssignLabels()
+	tenant := config.TenantOf(entry.Path)
+	for _, db := range config.Databases {
+		if db.Tenant == tenant && backupOf(db, entry) {
+			return withRunDefaults(config, db), true
+		}
+	}
+	return domain.DatabaseConfig{}, false
+}
+
+// backupOf reports whether entry is a backup of the configured database db. Backups taken
+// before labels existed only carry the database name.
+func backupOf(db domain.DatabaseConfig, entry domain.CatalogEntry) bool {
+	return db.Type == entry.DatabaseType && (db.Label == entry.Label || entry.Label == "" && db.Database == entry.Database)
+}
+
+func displayLabel(entry domain.CatalogEntry) string {
+	if entry.Label != "" {
+		return fmt.Sprintf("%s %s", entry.DatabaseType, entry.Label)
+	}
+	return fmt.Sprintf("%s %s", entry.DatabaseType, entry.Database)
+}
+
+// copyRun copies a run so callers can read it without holding the lock
+func copyRun(run *domain.Run) domain.Run {
+	c := *run
+	c.Results = append([]domain.BackupResult(nil), run.Results...)
+	if run.Restore != nil {
+		restore := *run.Restore
+		c.Restore = &restore
+	}
+	return c
+}
+
+// newRunID returns a random (version 4) UUID identifying a run, shared by the daemon's runs and
+// the backups they take
+func newRunID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// runRecorder is the output service of a background run: it records progress and results on the run
+type runRecorder struct {
+	uc  *DaemonUsecase
+	run *domain.Run
+}
+
+func (r *runRecorder) PrintBackupStart(dbType domain.DatabaseType, config domain.DatabaseConfig, method domain.BackupMethod) {
+	r.uc.update(r.run, func(run *domain.Run) { run.Current = config.Label })
+}
+
+func (r *runRecorder) PrintBackupResult(result domain.BackupResult) {
+	r.uc.update(r.run, func(run *domain.Run) { run.Results = append(run.Results, result) })
+}
+
+func (r *runRecorder) PrintRestoreStart(entry domain.CatalogEntry, target domain.DatabaseConfig, method domain.BackupMethod) {
+	r.uc.update(r.run, func(run *domain.Run) { run.Current = target.Label })
+}
+
+func (r *runRecorder) PrintRestoreResult(result domain.RestoreResult) {
+	r.uc.update(r.run, func(run *domain.Run) { run.Restore = &result })
+}
+
+func (r *runRecorder) PrintHeader()                                  {}
+func (r *runRecorder) PrintConfigSummary(config domain.BackupConfig) {}
+func (r *runRecorder) PrintEstimate(estimate domain.BackupEstimate)  {}
+func (r *runRecorder) PrintCloneStart(config domain.CloneConfig)     {}
+func (r *runRecorder) PrintChain(chain domain.BackupChain)           {}
+func (r *runRecorder) PrintDumpSummary(summary domain.DumpSummary)   {}
+func (r *runRecorder) PrintSchemaDiff(diff domain.SchemaDiff)        {}
+func (r *runRecorder) PrintDrillResult(result domain.DrillResult)    {}
+func (r *runRecorder) PrintSummary(results []domain.BackupResult)    {}
+func (r *runRecorder) PrintError(message string)                     {}
+func (r *runRecorder) PrintSuccess(message string)                   {}
+func (r *runRecorder) PrintCommand(where, command string)            {}
+func (r *runRecorder) PrintPhase(dbType domain.DatabaseType, label, phase string, elapsed time.Duration) {
+}
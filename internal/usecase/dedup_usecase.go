@@ -0,0 +1,96 @@
+package usecase
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// DedupUsecase maintains the chunk store of a backup directory
+type DedupUsecase struct {
+	chunkRepo     domain.ChunkRepository
+	catalogRepo   domain.CatalogRepository
+	outputService domain.OutputService
+}
+
+// NewDedupUsecase creates a new dedup usecase
+func NewDedupUsecase(
+	chunkRepo domain.ChunkRepository,
+	catalogRepo domain.CatalogRepository,
+	outputService domain.OutputService,
+) *DedupUsecase {
+	return &DedupUsecase{
+		chunkRepo:     chunkRepo,
+		catalogRepo:   catalogRepo,
+		outputService: outputService,
+	}
+}
+
+// Repack moves the single-file backups under backupDir that are still plain dumps into the
+// chunk store, e.g. after dedup was turned on, and then collects unused chunks
+func (uc *DedupUsecase) Repack(backupDir string) error {
+	storeDir := domain.ChunkStore(backupDir)
+	var packed, failed int
+	var before, stored int64
+
+	for _, dbType := range domain.EngineTypes() {
+		entries, err := uc.catalogRepo.ListEntries(backupDir, dbType)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			info, err := os.Stat(entry.Path)
+			if err != nil || !info.Mode().IsRegular() || domain.IsSnapshotBackup(entry.Path) || domain.IsRDSSnapshot(entry.Path) {
+				continue
+			}
+			if isPacked, err := uc.chunkRepo.IsPacked(entry.Path); err != nil || isPacked {
+				continue
+			}
+
+			stats, err := uc.chunkRepo.Pack(entry.Path, storeDir)
+			if err != nil {
+				uc.outputService.PrintError(fmt.Sprintf("Failed to pack %s: %v", entry.Path, err))
+				failed++
+				continue
+			}
+			packed++
+			before += info.Size()
+			stored += stats.StoredBytes
+			uc.outputService.PrintSuccess(fmt.Sprintf("Packed %s: %s new in %d of %d chunks",
+				entry.Path, domain.FormatBytes(stats.StoredBytes), stats.NewChunks, stats.Chunks))
+		}
+	}
+
+	uc.outputService.PrintSuccess(fmt.Sprintf("Packed %d backups of %s into %s of new chunks",
+		packed, domain.FormatBytes(before), domain.FormatBytes(stored)))
+
+	if err := uc.Collect(backupDir, false); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d backups could not be packed", failed)
+	}
+	return nil
+}
+
+// Collect removes the chunks no backup refers to any more, e.g. after old backups were
+// deleted. With dryRun nothing is removed.
+func (uc *DedupUsecase) Collect(backupDir string, dryRun bool) error {
+	stats, err := uc.chunkRepo.Collect(backupDir, domain.ChunkStore(backupDir), dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	uc.outputService.PrintSuccess(fmt.Sprintf("%s %d unused chunks (%s); %d chunks are used by %d backups",
+		verb, stats.Removed, domain.FormatBytes(stats.RemovedBytes), stats.Chunks, stats.Manifests))
+
+	if stats.Missing > 0 {
+		return fmt.Errorf("%d chunks used by backups are missing from %s", stats.Missing, domain.ChunkStore(backupDir))
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// DrillUsecase proves backups restorable: it restores the newest backup of each configured
+// database into a scratch server and runs the database's checks against it
+type DrillUsecase struct {
+	drillRepo     domain.DrillRepository
+	catalogRepo   domain.CatalogRepository
+	restore       *RestoreUsecase
+	outputService domain.OutputService
+	running       atomic.Bool
+	interrupted   atomic.Bool
+}
+
+// NewDrillUsecase creates a new drill usecase
+func NewDrillUsecase(
+	drillRepo domain.DrillRepository,
+	restoreRepo domain.RestoreRepository,
+	catalogRepo domain.CatalogRepository,
+	outputService domain.OutputService,
+) *DrillUsecase {
+	return &DrillUsecase{
+		drillRepo:     drillRepo,
+		catalogRepo:   catalogRepo,
+		restore:       NewRestoreUsecase(restoreRepo, catalogRepo, nil, outputService),
+		outputService: outputService,
+	}
+}
+
+// Execute drills the databases of config tagged with filter, one after another, and fails
+// unless every backup restored and passed its checks
+func (uc *DrillUsecase) Execute(config domain.BackupConfig, filter domain.Tags) error {
+	uc.outputService.PrintHeader()
+
+	config.Only(filter)
+	if len(config.Databases) == 0 {
+		return fmt.Errorf("no databases are tagged %s", filter)
+	}
+	config.AssignLabels()
+
+	uc.running.Store(true)
+	defer uc.running.Store(false)
+
+	failed := 0
+	for i, dbConfig := range config.Databases {
+		dbConfig = withRunDefaults(config, dbConfig)
+		result, entry := uc.drill(dbConfig, config.Signing.VerifyKey())
+		if uc.interrupted.Load() {
+			return fmt.Errorf("%w: %d of %d drills completed", domain.ErrInterrupted, i, len(config.Databases))
+		}
+		uc.outputService.PrintDrillResult(result)
+		if result.BackupPath != "" {
+			uc.recordDrill(dbConfig.BackupDir, entry, result)
+		}
+		if !result.Passed() {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d drills failed", failed, len(config.Databases))
+	}
+	return nil
+}
+
+// Interrupt stops a running drill, removing its scratch server, and keeps the databases after
+// it from being drilled. It returns false when no drill is running. Safe to call from a signal handler.
+func (uc *DrillUsecase) Interrupt() bool {
+	if !uc.running.Load() {
+		return false
+	}
+	uc.interrupted.Store(true)
+	uc.drillRepo.Interrupt()
+	return true
+}
+
+// drill restores the newest backup of dbConfig into a scratch server, runs its checks and
+// removes the server again. A backup whose signature does not match verifyKey, if set, fails
+// the drill. It returns the backup drilled along with the result.
+func (uc *DrillUsecase) drill(dbConfig domain.DatabaseConfig, verifyKey string) (result domain.DrillResult, entry domain.CatalogEntry) {
+	startTime := time.Now()
+	result = domain.DrillResult{
+		DatabaseType: dbConfig.Type,
+		Database:     dbConfig.Database,
+		Label:        dbConfig.Label,
+	}
+	defer func() { result.Duration = time.Since(startTime) }()
+
+	entry, err := uc.newestBackup(dbConfig)
+	if err != nil {
+		result.Error = err
+		return result, entry
+	}
+	result.BackupPath = entry.Path
+	result.BackupTime = entry.CreatedAt
+
+	if domain.IsSnapshotBackup(entry.Path) || domain.IsRDSSnapshot(entry.Path) || domain.IsHostSnapshot(entry.Path) || domain.IsPhysicalBackup(entry.Path) {
+		result.Error = fmt.Errorf("%s is a copy of the data directory; drills restore dumps", entry.Path)
+		return result, entry
+	}
+
+	scratch, err := uc.drillRepo.StartScratch(dbConfig)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to start a scratch server: %w", err)
+		return result, entry
+	}
+	defer func() {
+		if err := uc.drillRepo.RemoveScratch(scratch); err != nil {
+			uc.outputService.PrintError(fmt.Sprintf("Failed to remove scratch server %s: %v", scratch.Container, err))
+		}
+	}()
+
+	scratch.Checks = dbConfig.Checks
+	restored := uc.restore.restoreDatabase(entry, scratch, domain.BackupMethodDockerExec, "", scratch.TempDir, domain.RestoreOptions{VerifyKey: verifyKey})
+	result.Error = restored.Error
+	result.Stderr = restored.Stderr
+	result.Checks = restored.Checks
+	return result, entry
+}
+
+// recordDrill adds the outcome of a drill to the audit log of the backup's directory
+func (uc *DrillUsecase) recordDrill(backupDir string, entry domain.CatalogEntry, result domain.DrillResult) {
+	event := domain.AuditEvent{
+		Time:   time.Now(),
+		Kind:   domain.AuditEventDrill,
+		Backup: entry,
+		Passed: result.Passed(),
+	}
+	switch failed := domain.FailedChecks(result.Checks); {
+	case result.Error != nil:
+		event.Detail = result.Error.Error()
+	case failed > 0:
+		var failures []string
+		for _, check := range result.Checks {
+			if check.Error != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", check.Query, check.Error))
+			}
+		}
+		event.Detail = fmt.Sprintf("%d of %d checks failed: %s", failed, len(result.Checks), strings.Join(failures, "; "))
+	default:
+		event.Detail = fmt.Sprintf("restored, %d checks passed", len(result.Checks))
+	}
+	if err := uc.catalogRepo.AddEvent(backupDir, event); err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to add the drill of %s to the audit log: %v", entry.Path, err))
+	}
+}
+
+// newestBackup returns the newest backup of dbConfig in its backup directory
+func (uc *DrillUsecase) newestBackup(dbConfig domain.DatabaseConfig) (domain.CatalogEntry, error) {
+	entries, err := uc.catalogRepo.ListEntries(dbConfig.BackupDir, dbConfig.Type)
+	if err != nil {
+		return domain.CatalogEntry{}, fmt.Errorf("failed to list backups: %w", err)
+	}
+	for _, entry := range entries {
+		if backupOf(dbConfig, entry) {
+			return entry, nil
+		}
+	}
+	return domain.CatalogEntry{}, fmt.Errorf("no backups of %s found in %s", dbConfig.Label, dbConfig.BackupDir)
+}
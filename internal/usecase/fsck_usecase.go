@@ -0,0 +1,371 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// FsckUsecase cross-checks the catalog against the backups on disk and the copies in stores,
+// the way fsck checks a file system against its metadata
+type FsckUsecase struct {
+	backupRepo    domain.BackupRepository
+	restoreRepo   domain.RestoreRepository
+	catalogRepo   domain.CatalogRepository
+	chunkRepo     domain.ChunkRepository
+	outputService domain.OutputService
+}
+
+// NewFsckUsecase creates a new fsck usecase
+func NewFsckUsecase(
+	backupRepo domain.BackupRepository,
+	restoreRepo domain.RestoreRepository,
+	catalogRepo domain.CatalogRepository,
+	chunkRepo domain.ChunkRepository,
+	outputService domain.OutputService,
+) *FsckUsecase {
+	return &FsckUsecase{
+		backupRepo:    backupRepo,
+		restoreRepo:   restoreRepo,
+		catalogRepo:   catalogRepo,
+		chunkRepo:     chunkRepo,
+		outputService: outputService,
+	}
+}
+
+// fsckRecord is a backup of the catalog of backupDir and the key its copies have in stores
+type fsckRecord struct {
+	backupDir string
+	entry     domain.CatalogEntry
+	key       string
+}
+
+// fsckRun counts what one fsck found and fixed
+type fsckRun struct {
+	outputService domain.OutputService
+	repair        bool
+	checked       int
+	problems      int
+	repaired      int
+}
+
+// flag reports a problem and, when repairing, fixes it with fix, which returns what it did.
+// Problems only a person can sort out have no fix.
+func (r *fsckRun) flag(problem string, fix func() (string, error)) {
+	r.problems++
+	r.outputService.PrintError(problem)
+	if !r.repair || fix == nil {
+		return
+	}
+	done, err := fix()
+	if err != nil {
+		r.outputService.PrintError(fmt.Sprintf("Failed to repair: %v", err))
+		return
+	}
+	r.repaired++
+	r.outputService.PrintSuccess(done)
+}
+
+// Execute checks every backup directory of config, then every store that can list its keys.
+// On disk it flags records of backups kept nowhere any more, dumps missing from the catalog,
+// backups whose files no longer match their checksums and sidecar files whose backup is gone.
+// In stores it flags recorded copies that are missing, with options.Deep copies that no longer
+// match their checksums, and objects belonging to no backup. It fails while problems remain.
+func (uc *FsckUsecase) Execute(config domain.BackupConfig, options domain.FsckOptions) error {
+	run := &fsckRun{outputService: uc.outputService, repair: options.Repair}
+
+	var records []fsckRecord
+	for _, backupDir := range config.BackupDirs() {
+		found, err := uc.checkLocal(run, config, backupDir)
+		if err != nil {
+			return err
+		}
+		records = append(records, found...)
+	}
+	if err := uc.checkStores(run, config, records, options.Deep); err != nil {
+		return err
+	}
+
+	if options.Repair {
+		uc.outputService.PrintSuccess(fmt.Sprintf("Checked %d backups: %d problems, %d repaired", run.checked, run.problems, run.repaired))
+	} else {
+		uc.outputService.PrintSuccess(fmt.Sprintf("Checked %d backups: %d problems", run.checked, run.problems))
+	}
+	if left := run.problems - run.repaired; left > 0 {
+		return fmt.Errorf("%d problems left", left)
+	}
+	return nil
+}
+
+// checkLocal checks the catalog of backupDir against the files under it and returns its records
+func (uc *FsckUsecase) checkLocal(run *fsckRun, config domain.BackupConfig, backupDir string) ([]fsckRecord, error) {
+	entries, err := uc.catalogRepo.ListRecords(backupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []fsckRecord
+	known := make(map[string]bool)
+	for _, entry := range entries {
+		run.checked++
+		known[filepath.Clean(entry.Path)] = true
+		key, err := entryKey(config, backupDir, entry)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, fsckRecord{backupDir: backupDir, entry: entry, key: key})
+
+		if _, err := os.Stat(entry.Path); err != nil {
+			// Backups learnt of from stores, or pruned locally, are kept there
+			if len(entry.Stores) == 0 {
+				run.flag(fmt.Sprintf("%s is in the catalog but neither on disk nor in any store", entry.Path), func() (string, error) {
+					return "Dropped the record of " + entry.Path, uc.catalogRepo.RemoveEntry(backupDir, entry)
+				})
+			}
+			continue
+		}
+		if err := uc.verifyLocal(entry.Path); err != nil {
+			run.flag(fmt.Sprintf("%s is damaged: %v", entry.Path, err), nil)
+		}
+	}
+
+	// Dumps the catalog lacks, e.g. copied in by hand
+	for _, dbType := range domain.EngineTypes() {
+		scanned, err := uc.catalogRepo.ListEntries(backupDir, dbType)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range scanned {
+			if known[filepath.Clean(entry.Path)] {
+				continue
+			}
+			run.checked++
+			run.flag(fmt.Sprintf("%s is not in the catalog", entry.Path), func() (string, error) {
+				recorded, err := uc.catalogRepo.AddEntry(backupDir, entry)
+				return fmt.Sprintf("Recorded %s as %s", entry.Path, recorded.ID), err
+			})
+			if err := uc.verifyLocal(entry.Path); err != nil {
+				run.flag(fmt.Sprintf("%s is damaged: %v", entry.Path, err), nil)
+			}
+		}
+	}
+
+	orphans, err := uc.catalogRepo.ListOrphans(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, orphan := range orphans {
+		run.flag(fmt.Sprintf("%s belongs to no backup", orphan), func() (string, error) {
+			return "Removed " + orphan, uc.backupRepo.RemoveBackup(orphan)
+		})
+	}
+	return records, nil
+}
+
+// verifyLocal checks the backup at path against its checksums. The chunks of a packed backup
+// are checked against their hashes instead, as packing does not keep the dump's bytes.
+func (uc *FsckUsecase) verifyLocal(path string) error {
+	if packed, err := uc.chunkRepo.IsPacked(path); err == nil && packed {
+		content, err := uc.chunkRepo.Open(path)
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+		_, err = io.Copy(io.Discard, content)
+		return err
+	}
+
+	err := uc.restoreRepo.VerifyChecksum(path)
+	if errors.Is(err, domain.ErrNoChecksum) {
+		return nil
+	}
+	return err
+}
+
+// checkStores checks the copies records claim each store of config has, and what else the
+// store holds
+func (uc *FsckUsecase) checkStores(run *fsckRun, config domain.BackupConfig, records []fsckRecord, deep bool) error {
+	staging, err := os.MkdirTemp("", "fsck-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	for _, name := range storesOf(config, nil) {
+		store, err := domain.LookupStore(name)
+		if err != nil {
+			run.flag(err.Error(), nil)
+			continue
+		}
+		fetching, ok := store.(domain.FetchingStore)
+		if !ok {
+			uc.outputService.PrintError(fmt.Sprintf("Store %s cannot list its backups and was skipped", name))
+			continue
+		}
+		keys, err := fetching.List("")
+		if err != nil {
+			run.flag(fmt.Sprintf("Failed to list store %s: %v", name, err), nil)
+			continue
+		}
+
+		// A backup directory is stored as the objects below its key
+		stored := make(map[string]bool)
+		for _, key := range keys {
+			for k := key; k != "." && k != "/" && !stored[k]; k = path.Dir(k) {
+				stored[k] = true
+			}
+		}
+		claimed := make(map[string]bool)
+		claim := func(key string) {
+			claimed[key], claimed[key+domain.ManifestExt] = true, true
+			for _, companion := range companions(key, key) {
+				claimed[companion[1]] = true
+			}
+		}
+
+		for i := range records {
+			record := &records[i]
+			// Copies the next run resumes are incomplete by design
+			if slices.ContainsFunc(record.entry.Pending, func(pending domain.PendingCopy) bool { return pending.Store == name }) {
+				claim(record.key)
+				continue
+			}
+			if !slices.Contains(record.entry.Stores, name) {
+				continue
+			}
+			claim(record.key)
+			if !storedCopy(stored, record.key, record.entry.Parts) {
+				run.flag(fmt.Sprintf("%s is missing from store %s", record.key, name), func() (string, error) {
+					return uc.recopy(record, name, store)
+				})
+				continue
+			}
+			if !deep {
+				continue
+			}
+			// Retrieving every archived copy from cold storage would take hours and cost a lot
+			err := uc.verifyCopy(fetching, record, staging)
+			if errors.Is(err, domain.ErrArchived) {
+				uc.outputService.PrintSuccess(fmt.Sprintf("Not checking the copy of %s in store %s, which is archived in cold storage", record.key, name))
+				continue
+			}
+			if err != nil {
+				run.flag(fmt.Sprintf("The copy of %s in store %s is damaged: %v", record.key, name, err), func() (string, error) {
+					return uc.recopy(record, name, store)
+				})
+			}
+		}
+
+		// Manifests put by other hosts account for their backups
+		for _, key := range keys {
+			backupKey, ok := cutManifestExt(key)
+			if !ok || claimed[backupKey] {
+				continue
+			}
+			claim(backupKey)
+			if !stored[backupKey] && !stored[domain.PartKey(backupKey, 0)] {
+				run.flag(fmt.Sprintf("Store %s has the manifest of %s but not the backup", name, backupKey), nil)
+			}
+		}
+		for _, key := range keys {
+			if !claimedKey(claimed, key) {
+				run.flag(fmt.Sprintf("%s in store %s belongs to no backup", key, name), nil)
+			}
+		}
+	}
+	return nil
+}
+
+// recopy repairs a copy missing from or damaged in the named store: the backup is copied there
+// again if it is still on disk, or else the store is dropped from its record
+func (uc *FsckUsecase) recopy(record *fsckRecord, name string, store domain.BackupStore) (string, error) {
+	if _, err := os.Stat(record.entry.Path); err == nil {
+		if err := uc.verifyLocal(record.entry.Path); err != nil {
+			return "", fmt.Errorf("the backup on disk is damaged as well: %w", err)
+		}
+		// The copy is cut into parts of the size it was recorded with, so the record still fits
+		var partSize int64
+		if len(record.entry.Parts) > 0 {
+			partSize = record.entry.Parts[0].Size
+		}
+		if _, err := putCopy(uc.backupRepo, store, record.entry.Path, record.key, partSize, 0); err != nil {
+			return "", err
+		}
+		if err := putManifest(uc.catalogRepo, uc.backupRepo, record.entry, record.key, []string{name}); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Copied %s to store %s again", record.entry.Path, name), nil
+	}
+
+	record.entry.Stores = slices.DeleteFunc(slices.Clone(record.entry.Stores), func(stored string) bool {
+		return stored == name
+	})
+	if len(record.entry.Stores) == 0 {
+		return fmt.Sprintf("Dropped the record of %s, which is kept nowhere any more", record.entry.Path),
+			uc.catalogRepo.RemoveEntry(record.backupDir, record.entry)
+	}
+	return fmt.Sprintf("Dropped store %s from the record of %s", name, record.entry.Path),
+		uc.catalogRepo.UpdateEntry(record.backupDir, record.entry)
+}
+
+// verifyCopy fetches the copy of a backup from store into staging and checks it against its
+// checksums. Copies stored without checksums cannot be checked and pass.
+func (uc *FsckUsecase) verifyCopy(store domain.FetchingStore, record *fsckRecord, staging string) error {
+	dir, err := os.MkdirTemp(staging, "")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	fetched := filepath.Join(dir, filepath.Base(record.entry.Path))
+	if err := fetchCopy(uc.restoreRepo, store, record.key, record.entry.Parts, fetched); err != nil {
+		return err
+	}
+	err = uc.restoreRepo.VerifyChecksum(fetched)
+	if errors.Is(err, domain.ErrNoChecksum) {
+		return nil
+	}
+	return err
+}
+
+// cutManifestExt returns the key of the backup a manifest key belongs to
+func cutManifestExt(key string) (string, bool) {
+	if !domain.IsManifestKey(key) {
+		return "", false
+	}
+	return key[:len(key)-len(domain.ManifestExt)], true
+}
+
+// storedCopy reports whether the keys a store holds include the copy of the backup under key,
+// or every one of its parts
+func storedCopy(stored map[string]bool, key string, parts []domain.Part) bool {
+	if len(parts) == 0 {
+		return stored[key]
+	}
+	for i := range parts {
+		if !stored[domain.PartKey(key, i)] {
+			return false
+		}
+	}
+	return true
+}
+
+// claimedKey reports whether key, the backup a part key belongs to, or a directory it is in,
+// belongs to a backup
+func claimedKey(claimed map[string]bool, key string) bool {
+	if backupKey, ok := domain.CutPartKey(key); ok {
+		key = backupKey
+	}
+	for k := key; k != "." && k != "/"; k = path.Dir(k) {
+		if claimed[k] {
+			return true
+		}
+	}
+	return false
+}
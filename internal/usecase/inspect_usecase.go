@@ -0,0 +1,55 @@
+package usecase
+
+import (
+	"fmt"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// InspectUsecase describes backup artifacts without restoring them
+type InspectUsecase struct {
+	backupRepo    domain.BackupRepository
+	outputService domain.OutputService
+}
+
+// NewInspectUsecase creates a new inspect usecase
+func NewInspectUsecase(
+	backupRepo domain.BackupRepository,
+	outputService domain.OutputService,
+) *InspectUsecase {
+	return &InspectUsecase{
+		backupRepo:    backupRepo,
+		outputService: outputService,
+	}
+}
+
+// Inspect prints the format, versions and tables of the artifact at path
+func (uc *InspectUsecase) Inspect(path string) error {
+	summary, err := uc.backupRepo.InspectBackup(path)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", path, err)
+	}
+	uc.outputService.PrintDumpSummary(summary)
+	return nil
+}
+
+// Diff prints how the tables and columns of the dump at to differ from those of the dump at from
+func (uc *InspectUsecase) Diff(from, to string) error {
+	before, err := uc.backupRepo.InspectBackup(from)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", from, err)
+	}
+	after, err := uc.backupRepo.InspectBackup(to)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", to, err)
+	}
+	// Artifacts without a table listing say so in a note
+	for _, summary := range []domain.DumpSummary{before, after} {
+		if len(summary.Tables) == 0 && len(summary.Notes) > 0 {
+			return fmt.Errorf("%s is a %s, whose tables cannot be compared", summary.Path, summary.Format)
+		}
+	}
+
+	uc.outputService.PrintSchemaDiff(domain.DiffSchemas(before, after))
+	return nil
+}
@@ -0,0 +1,43 @@
+package usecase
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// ListUsecase lists the backups restore can pick from
+type ListUsecase struct {
+	catalogRepo domain.CatalogRepository
+}
+
+// NewListUsecase creates a new list usecase
+func NewListUsecase(catalogRepo domain.CatalogRepository) *ListUsecase {
+	return &ListUsecase{catalogRepo: catalogRepo}
+}
+
+// Execute returns the backups in dirs of dbType, or of every database type when it is empty,
+// newest first, including those only kept in stores, which restores fetch from there
+func (uc *ListUsecase) Execute(dirs []string, dbType domain.DatabaseType) ([]domain.CatalogEntry, error) {
+	types := domain.EngineTypes()
+	if dbType != "" {
+		types = []domain.DatabaseType{dbType}
+	}
+
+	var entries []domain.CatalogEntry
+	for _, dir := range dirs {
+		for _, dbType := range types {
+			typed, err := restorableEntries(uc.catalogRepo, dir, dbType)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list backups: %w", err)
+			}
+			entries = append(entries, typed...)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
@@ -0,0 +1,311 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// PullUsecase fetches a backup of the catalog back from the store it was copied to, e.g. after
+// the backup directory was lost or pruned, and leaves it checked and decrypted
+type PullUsecase struct {
+	restoreRepo   domain.RestoreRepository
+	catalogRepo   domain.CatalogRepository
+	outputService domain.OutputService
+}
+
+// NewPullUsecase creates a new pull usecase
+func NewPullUsecase(
+	restoreRepo domain.RestoreRepository,
+	catalogRepo domain.CatalogRepository,
+	outputService domain.OutputService,
+) *PullUsecase {
+	return &PullUsecase{
+		restoreRepo:   restoreRepo,
+		catalogRepo:   catalogRepo,
+		outputService: outputService,
+	}
+}
+
+// Execute fetches the backup with the given ID from the first store of config that has it,
+// checks it against its checksums and signature, decrypts it and writes it to options.Dir.
+// It returns where the backup was written.
+func (uc *PullUsecase) Execute(config domain.BackupConfig, id string, options domain.PullOptions) (string, error) {
+	entry, backupDir, err := uc.find(config, id)
+	if err != nil {
+		return "", err
+	}
+	if _, err := entry.Compatibility(); err != nil {
+		return "", err
+	}
+	key, err := entryKey(config, backupDir, entry)
+	if err != nil {
+		return "", err
+	}
+
+	dir := options.Dir
+	if dir == "" {
+		dir = "."
+	}
+	target := filepath.Join(dir, filepath.Base(entry.Path))
+	if _, err := os.Lstat(target); err == nil {
+		return "", fmt.Errorf("%s already exists", target)
+	}
+
+	// The backup is fetched into a directory next to the target, so it only shows up there
+	// once it is checked and decrypted
+	partial := filepath.Join(dir, domain.PartialDir)
+	if err := os.MkdirAll(partial, 0o700); err != nil {
+		return "", err
+	}
+	staging, err := os.MkdirTemp(partial, "pull-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(partial)
+	defer os.RemoveAll(staging)
+
+	// The stores recorded with the backup are tried first
+	names := []string{options.Store}
+	if options.Store == "" {
+		names = storesOf(config, entry.Stores)
+	}
+	fetched := filepath.Join(staging, filepath.Base(entry.Path))
+	storeName, err := uc.fetch(names, key, entry.Parts, fetched)
+	if err != nil {
+		return "", err
+	}
+	uc.outputService.PrintSuccess(fmt.Sprintf("Fetched %s from store %s", key, storeName))
+
+	switch err := uc.restoreRepo.VerifyChecksum(fetched); {
+	case errors.Is(err, domain.ErrNoChecksum):
+		uc.outputService.PrintError(fmt.Sprintf("%s was stored without checksums, so the copy could not be checked", key))
+	case err != nil:
+		return "", err
+	default:
+		uc.outputService.PrintSuccess("Checksums match")
+	}
+	if verifyKey := config.Signing.VerifyKey(); verifyKey != "" {
+		if err := uc.restoreRepo.VerifySignature(fetched, verifyKey); err != nil {
+			return "", err
+		}
+		uc.outputService.PrintSuccess("Signature verified")
+	}
+
+	plain, err := uc.restoreRepo.DecryptBackup(fetched)
+	if err != nil {
+		return "", err
+	}
+	if plain != fetched {
+		uc.outputService.PrintSuccess("Decrypted the backup")
+	}
+
+	if err := os.Rename(plain, target); err != nil {
+		return "", fmt.Errorf("failed to move the backup to %s: %w", target, err)
+	}
+	if globals := domain.GlobalsPath(plain); globals != plain {
+		if err := os.Rename(globals, domain.GlobalsPath(target)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to move the globals to %s: %w", domain.GlobalsPath(target), err)
+		}
+	}
+	uc.outputService.PrintSuccess(fmt.Sprintf("Pulled %s to %s", id, target))
+	return target, nil
+}
+
+// find returns the catalog entry with the given ID and the backup directory holding it. The
+// backup need not be on disk any more, e.g. when catalog sync learnt of it from a store.
+func (uc *PullUsecase) find(config domain.BackupConfig, id string) (domain.CatalogEntry, string, error) {
+	for _, backupDir := range config.BackupDirs() {
+		entries, err := uc.catalogRepo.ListRecords(backupDir)
+		if err != nil {
+			return domain.CatalogEntry{}, "", err
+		}
+		for _, entry := range entries {
+			if entry.ID != "" && entry.ID == id {
+				return entry, backupDir, nil
+			}
+		}
+	}
+	return domain.CatalogEntry{}, "", fmt.Errorf("no backup with ID %s in the catalog", id)
+}
+
+// fetch downloads the backup under key, with the files that travel with it, to path from the
+// first of the named stores that has it, joining its parts if it was copied in parts. It
+// returns the store's name.
+func (uc *PullUsecase) fetch(names []string, key string, parts []domain.Part, path string) (string, error) {
+	if len(names) == 0 {
+		return "", fmt.Errorf("the config has no stores to pull from")
+	}
+
+	for _, name := range names {
+		store, err := domain.LookupStore(name)
+		if err != nil && len(names) == 1 {
+			return "", err
+		}
+		fetching, ok := store.(domain.FetchingStore)
+		if !ok {
+			if len(names) == 1 {
+				return "", fmt.Errorf("store %s cannot fetch backups back", name)
+			}
+			// Stores recorded on another host may not be set up here
+			continue
+		}
+
+		err = fetchCopy(uc.restoreRepo, fetching, key, parts, path)
+		if errors.Is(err, domain.ErrArchived) {
+			os.RemoveAll(path)
+			if err = uc.retrieve(fetching, key, parts); err == nil {
+				err = fetchCopy(uc.restoreRepo, fetching, key, parts, path)
+			}
+		}
+		if errors.Is(err, domain.ErrNotInStore) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch %s from store %s: %w", key, name, err)
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("%s is in none of the stores %s", key, strings.Join(names, ", "))
+}
+
+// retrievalPoll is how often retrieve asks whether a copy is back from cold storage
+var retrievalPoll = time.Minute
+
+// retrieve has store bring the copy of a backup under key, or each of its parts, back from
+// cold storage and waits until they are all fetchable, which can take hours
+func (uc *PullUsecase) retrieve(store domain.FetchingStore, key string, parts []domain.Part) error {
+	retrieving, ok := store.(domain.RetrievingStore)
+	if !ok {
+		return fmt.Errorf("%s is archived in store %s, which cannot retrieve it", key, store.Name())
+	}
+	keys := []string{key}
+	if len(parts) > 0 {
+		keys = keys[:0]
+		for i := range parts {
+			keys = append(keys, domain.PartKey(key, i))
+		}
+	}
+
+	started := time.Now()
+	for {
+		ready := true
+		for _, key := range keys {
+			fetchable, err := retrieving.Retrieve(key)
+			if err != nil {
+				return err
+			}
+			ready = ready && fetchable
+		}
+		if ready {
+			if time.Since(started) > retrievalPoll {
+				uc.outputService.PrintSuccess(fmt.Sprintf("Retrieved %s from cold storage in %s", key, time.Since(started).Round(time.Minute)))
+			}
+			return nil
+		}
+		if time.Since(started) < retrievalPoll {
+			uc.outputService.PrintSuccess(fmt.Sprintf("Retrieving %s from cold storage in store %s; this can take hours", key, store.Name()))
+		}
+		time.Sleep(retrievalPoll)
+	}
+}
+
+// fetchCopy downloads the backup under key in store to path, with the companions it has. A
+// backup copied in parts is joined from them again.
+func fetchCopy(restoreRepo domain.RestoreRepository, store domain.FetchingStore, key string, parts []domain.Part, path string) error {
+	var err error
+	if len(parts) > 0 {
+		err = restoreRepo.JoinParts(path, parts, func(index int, partPath string) error {
+			return store.Get(domain.PartKey(key, index), partPath)
+		})
+	} else {
+		err = store.Get(key, path)
+	}
+	if err != nil {
+		return err
+	}
+	for _, companion := range companions(path, key) {
+		if err := store.Get(companion[1], companion[0]); err != nil && !errors.Is(err, domain.ErrNotInStore) {
+			return err
+		}
+	}
+	return nil
+}
+
+// restorableEntries returns the backups of dbType under backupDir newest first, as
+// ListEntries does, along with those recorded in its catalog that are no longer on disk but
+// kept in stores, with their StoreKey set, e.g. those moved there by DatabaseConfig.LocalKeep
+func restorableEntries(catalogRepo domain.CatalogRepository, backupDir string, dbType domain.DatabaseType) ([]domain.CatalogEntry, error) {
+	entries, err := catalogRepo.ListEntries(backupDir, dbType)
+	if err != nil {
+		return nil, err
+	}
+	records, err := catalogRepo.ListRecords(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.DatabaseType != dbType || len(record.Stores) == 0 {
+			continue
+		}
+		if _, err := os.Stat(record.Path); err == nil {
+			continue
+		}
+		key, err := filepath.Rel(backupDir, record.Path)
+		if err != nil {
+			continue
+		}
+		if record.Tenant != "" {
+			key = filepath.Join(record.Tenant, key)
+		}
+		record.StoreKey = filepath.ToSlash(key)
+		entries = append(entries, record)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+// entryKey returns the key the backup of entry, recorded in the catalog of backupDir, has in
+// the stores of config, as storeKey does when it is copied
+func entryKey(config domain.BackupConfig, backupDir string, entry domain.CatalogEntry) (string, error) {
+	key, err := filepath.Rel(backupDir, entry.Path)
+	if err != nil {
+		return "", err
+	}
+	if tenant := config.TenantOf(entry.Path); tenant != "" {
+		key = filepath.Join(tenant, key)
+	}
+	return filepath.ToSlash(key), nil
+}
+
+// storesOf returns the names of every store the backups of config are copied to, the run's,
+// the tenants' and the databases' own, after those in first
+func storesOf(config domain.BackupConfig, first []string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(stores []string) {
+		for _, name := range stores {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	add(first)
+	add(config.Stores)
+	for _, tenant := range config.Tenants {
+		add(tenant.Stores)
+	}
+	for _, db := range config.Databases {
+		add(db.Stores)
+	}
+	return names
+}
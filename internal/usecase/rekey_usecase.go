@@ -0,0 +1,134 @@
+package usecase
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// RekeyUsecase moves encrypted backups to another KMS key, e.g. when whoever held the old one
+// leaves, and records the new key in the catalog
+type RekeyUsecase struct {
+	backupRepo    domain.BackupRepository
+	catalogRepo   domain.CatalogRepository
+	outputService domain.OutputService
+}
+
+// NewRekeyUsecase creates a new rekey usecase
+func NewRekeyUsecase(
+	backupRepo domain.BackupRepository,
+	catalogRepo domain.CatalogRepository,
+	outputService domain.OutputService,
+) *RekeyUsecase {
+	return &RekeyUsecase{
+		backupRepo:    backupRepo,
+		catalogRepo:   catalogRepo,
+		outputService: outputService,
+	}
+}
+
+// Execute moves the encrypted backups under the backup directories of config to the KMS key
+// of its encryption block, or of the tenant a directory belongs to. Backups already on that
+// key are skipped unless they are re-encrypted, and re-encrypted backups are signed again when
+// config has a signing key.
+func (uc *RekeyUsecase) Execute(config domain.BackupConfig, options domain.RekeyOptions) error {
+	targets := make(map[string]domain.Encryption)
+	for _, backupDir := range config.BackupDirs() {
+		if encryption := config.EncryptionOf(backupDir); encryption != nil {
+			targets[backupDir] = *encryption
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("the config has no encryption block naming the key to move to")
+	}
+
+	verb, done := "re-wrap", "Re-wrapped"
+	if options.Reencrypt {
+		verb, done = "re-encrypt", "Re-encrypted"
+	}
+	var moved, current, failed int
+	for _, backupDir := range config.BackupDirs() {
+		target, ok := targets[backupDir]
+		if !ok {
+			continue
+		}
+		for _, dbType := range domain.EngineTypes() {
+			entries, err := uc.catalogRepo.ListEntries(backupDir, dbType)
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range entries {
+				encryption, err := uc.backupRepo.BackupEncryption(entry.Path)
+				if err != nil {
+					uc.outputService.PrintError(fmt.Sprintf("Failed to read the key of %s: %v", entry.Path, err))
+					failed++
+					continue
+				}
+				if encryption == nil || options.From != "" && encryption.String() != options.From {
+					continue
+				}
+				if *encryption == target && !options.Reencrypt {
+					current++
+					continue
+				}
+
+				if options.DryRun {
+					uc.outputService.PrintSuccess(fmt.Sprintf("Would %s %s from %s to %s", verb, entry.Path, encryption, target))
+					moved++
+					continue
+				}
+				if err := uc.backupRepo.RekeyBackup(entry.Path, target, options.Reencrypt); err != nil {
+					uc.outputService.PrintError(fmt.Sprintf("Failed to %s %s: %v", verb, entry.Path, err))
+					failed++
+					continue
+				}
+				if options.Reencrypt {
+					uc.resign(config.Signing, entry.Path)
+					uc.rechecksum(entry.Path)
+				}
+				entry.EncryptionKey = target.String()
+				if err := uc.catalogRepo.UpdateEntry(backupDir, entry); err != nil {
+					uc.outputService.PrintError(fmt.Sprintf("%s was rekeyed but could not be recorded in the catalog: %v", entry.Path, err))
+				}
+				uc.outputService.PrintSuccess(fmt.Sprintf("%s %s from %s to %s", done, entry.Path, encryption, target))
+				moved++
+			}
+		}
+	}
+
+	if options.DryRun {
+		uc.outputService.PrintSuccess(fmt.Sprintf("Would %s %d backups, %d already use their key", verb, moved, current))
+	} else {
+		uc.outputService.PrintSuccess(fmt.Sprintf("%s %d backups, %d already used their key", done, moved, current))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d backups could not be rekeyed", failed)
+	}
+	return nil
+}
+
+// resign signs a re-encrypted backup again, since its files changed. Without a signing key the
+// old signature no longer matches, which restores would reject, so that is pointed out.
+func (uc *RekeyUsecase) resign(signing *domain.Signing, path string) {
+	if signing != nil && signing.Key != "" {
+		if err := uc.backupRepo.SignBackup(path, signing.Key); err != nil {
+			uc.outputService.PrintError(fmt.Sprintf("Failed to sign %s again: %v", path, err))
+		}
+		return
+	}
+	if _, err := os.Stat(domain.SignaturePath(path)); err == nil {
+		uc.outputService.PrintError(fmt.Sprintf("The signature of %s no longer matches; configure a signing key to sign it again", path))
+	}
+}
+
+// rechecksum writes the checksums of a re-encrypted backup again, if it had any
+func (uc *RekeyUsecase) rechecksum(path string) {
+	if _, err := os.Stat(domain.ChecksumPath(path)); err != nil {
+		return
+	}
+	if err := uc.backupRepo.ChecksumBackup(path); err != nil {
+		uc.outputService.PrintError(fmt.Sprintf("Failed to write the checksums of %s again: %v", path, err))
+	}
+}
@@ -0,0 +1,81 @@
+package usecase
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// ReportUsecase assembles compliance reports from the catalog and audit log of a backup directory
+type ReportUsecase struct {
+	catalogRepo domain.CatalogRepository
+}
+
+// NewReportUsecase creates a new report usecase
+func NewReportUsecase(catalogRepo domain.CatalogRepository) *ReportUsecase {
+	return &ReportUsecase{catalogRepo: catalogRepo}
+}
+
+// Generate reports the backups taken under backupDir from from up to to, with the failed
+// backups, drills and removals of the period. Backups removed since are taken from the
+// audit log, which keeps their catalog entries.
+func (uc *ReportUsecase) Generate(backupDir string, from, to time.Time) (domain.ComplianceReport, error) {
+	if !from.Before(to) {
+		return domain.ComplianceReport{}, fmt.Errorf("the period must end after it starts")
+	}
+	report := domain.ComplianceReport{
+		BackupDir:   backupDir,
+		From:        from,
+		To:          to,
+		GeneratedAt: time.Now(),
+	}
+	inPeriod := func(t time.Time) bool {
+		return !t.Before(from) && t.Before(to)
+	}
+
+	events, err := uc.catalogRepo.ListEvents(backupDir)
+	if err != nil {
+		return report, err
+	}
+
+	seen := make(map[string]bool)
+	for _, dbType := range domain.EngineTypes() {
+		entries, err := uc.catalogRepo.ListEntries(backupDir, dbType)
+		if err != nil {
+			return report, err
+		}
+		for _, entry := range entries {
+			if inPeriod(entry.CreatedAt) && !seen[filepath.Clean(entry.Path)] {
+				report.Backups = append(report.Backups, entry)
+				seen[filepath.Clean(entry.Path)] = true
+			}
+		}
+	}
+
+	for _, event := range events {
+		removed := filepath.Clean(event.Backup.Path)
+		if event.Kind == domain.AuditEventRemoval && inPeriod(event.Backup.CreatedAt) && !seen[removed] {
+			report.Backups = append(report.Backups, event.Backup)
+			seen[removed] = true
+		}
+		if !inPeriod(event.Time) {
+			continue
+		}
+		switch event.Kind {
+		case domain.AuditEventBackupFailed:
+			report.Failures = append(report.Failures, event)
+		case domain.AuditEventDrill:
+			report.Verifications = append(report.Verifications, event)
+		case domain.AuditEventRemoval:
+			report.Removals = append(report.Removals, event)
+		}
+	}
+
+	sort.SliceStable(report.Backups, func(i, j int) bool {
+		return report.Backups[i].CreatedAt.Before(report.Backups[j].CreatedAt)
+	})
+	return report, nil
+}
@@ -0,0 +1,481 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// RestoreUsecase implements restore business logic
+type RestoreUsecase struct {
+	restoreRepo   domain.RestoreRepository
+	catalogRepo   domain.CatalogRepository
+	configService domain.ConfigService
+	outputService domain.OutputService
+}
+
+// NewRestoreUsecase creates a new restore usecase
+func NewRestoreUsecase(
+	restoreRepo domain.RestoreRepository,
+	catalogRepo domain.CatalogRepository,
+	configService domain.ConfigService,
+	outputService domain.OutputService,
+) *RestoreUsecase {
+	return &RestoreUsecase{
+		restoreRepo:   restoreRepo,
+		catalogRepo:   catalogRepo,
+		configService: configService,
+		outputService: outputService,
+	}
+}
+
+// ExecuteInteractiveRestore lets the user pick a backup under backupDir and restores it into a
+// target database. With options.At set, the backup is chosen to bring the database to that time.
+func (uc *RestoreUsecase) ExecuteInteractiveRestore(backupDir string, options domain.RestoreOptions) error {
+	uc.outputService.PrintHeader()
+
+	// Step 1: Select database type
+	dbType, err := uc.configService.SelectDatabaseType()
+	if err != nil {
+		return fmt.Errorf("failed to select database type: %w", err)
+	}
+
+	// Only the oplog of differential MongoDB backups can be replayed up to a point in time; other
+	// backups hold the single moment they were taken
+	if !options.At.IsZero() && dbType != domain.DatabaseTypeMongoDB {
+		return fmt.Errorf("-at needs log replay, which only differential MongoDB backups have; pick a %s backup without -at", dbType)
+	}
+
+	// Step 2: Pick a backup, including those only kept in stores
+	entries, err := restorableEntries(uc.catalogRepo, backupDir, dbType)
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no %s backups found in %s", dbType, backupDir)
+	}
+
+	var entry domain.CatalogEntry
+	if options.At.IsZero() {
+		entry, err = uc.configService.SelectBackup(entries)
+	} else {
+		entry, err = uc.selectPointInTime(entries, options.At)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to select backup: %w", err)
+	}
+
+	// Step 3: Select how to reach the target
+	method, err := uc.configService.SelectBackupMethod()
+	if err != nil {
+		return fmt.Errorf("failed to select restore method: %w", err)
+	}
+
+	namespace := "default"
+	var kubeconfig, kubeContext string
+	if method == domain.BackupMethodKubectlExec {
+		namespace, err = uc.configService.GetKubernetesNamespace()
+		if err != nil {
+			return fmt.Errorf("failed to get kubernetes namespace: %w", err)
+		}
+
+		kubeconfig, kubeContext, err = uc.configService.GetKubernetesContext()
+		if err != nil {
+			return fmt.Errorf("failed to get kubernetes context: %w", err)
+		}
+	}
+
+	// Step 4: Configure the target database, which may use a different name than the backup
+	target, err := uc.configService.ConfigureRestoreTarget(entry, method)
+	if err != nil {
+		return fmt.Errorf("failed to configure %s: %w", dbType, err)
+	}
+	if target.KubeContext == "" {
+		target.KubeContext = kubeContext
+	}
+	if target.Kubeconfig == "" {
+		target.Kubeconfig = kubeconfig
+	}
+	for _, db := range options.Configured {
+		if backupOf(db, entry) {
+			target.Checks = db.Checks
+			break
+		}
+	}
+
+	// Step 5: Confirm, since restoring writes into the target
+	confirmed, err := uc.configService.ConfirmRestore(entry, target, method)
+	if err != nil {
+		return fmt.Errorf("failed to get confirmation: %w", err)
+	}
+	if !confirmed {
+		uc.outputService.PrintError("Restore cancelled by user")
+		return nil
+	}
+
+	// Step 6: Restore
+	result := uc.restoreDatabase(entry, target, method, namespace, "/tmp/db-backups", options)
+	uc.outputService.PrintRestoreResult(result)
+	if !result.Success {
+		return fmt.Errorf("restore of %s failed: %w", target.Database, result.Error)
+	}
+	if failed := domain.FailedChecks(result.Checks); failed > 0 {
+		return fmt.Errorf("%s was restored but %d of %d checks failed", target.Database, failed, len(result.Checks))
+	}
+
+	return nil
+}
+
+// ExecuteRestore restores entry into target without prompting, for callers that chose both up front
+func (uc *RestoreUsecase) ExecuteRestore(
+	entry domain.CatalogEntry,
+	target domain.DatabaseConfig,
+	method domain.BackupMethod,
+	namespace string,
+	tempDir string,
+	options domain.RestoreOptions,
+) error {
+	result := uc.restoreDatabase(entry, target, method, namespace, tempDir, options)
+	uc.outputService.PrintRestoreResult(result)
+	if !result.Success {
+		return fmt.Errorf("restore of %s failed: %w", target.Database, result.Error)
+	}
+	if failed := domain.FailedChecks(result.Checks); failed > 0 {
+		return fmt.Errorf("%s was restored but %d of %d checks failed", target.Database, failed, len(result.Checks))
+	}
+	return nil
+}
+
+// selectPointInTime picks the differential backup whose oplog brings each database in entries to
+// at and lets the user choose between the databases if there are several. A database whose
+// backups cannot be replayed up to at is left out, since restoring it would not reach at.
+func (uc *RestoreUsecase) selectPointInTime(entries []domain.CatalogEntry, at time.Time) (domain.CatalogEntry, error) {
+	groups := make(map[string][]domain.CatalogEntry)
+	var keys []string
+	for _, entry := range entries {
+		key := entry.Database + "\x00" + entry.Label
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], entry)
+	}
+
+	var candidates []domain.CatalogEntry
+	var newest *domain.CatalogEntry
+	for _, key := range keys {
+		entry, err := domain.PointInTime(groups[key], at)
+		if err != nil {
+			continue
+		}
+		if entry.IsDifferential() && !entry.CreatedAt.Before(at) {
+			candidates = append(candidates, entry)
+		} else if newest == nil || entry.CreatedAt.After(newest.CreatedAt) {
+			newest = &entry
+		}
+	}
+	if len(candidates) == 0 {
+		if newest == nil {
+			return domain.CatalogEntry{}, fmt.Errorf("no backup was taken before %s", at.Format("2006-01-02 15:04:05"))
+		}
+		return domain.CatalogEntry{}, fmt.Errorf("no differential backup was taken after %s, so no oplog reaches it; the newest backup before it is %s from %s, restore it without -at",
+			at.Format("2006-01-02 15:04:05"), newest.Path, newest.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	entry := candidates[0]
+	if len(candidates) > 1 {
+		var err error
+		if entry, err = uc.configService.SelectBackup(candidates); err != nil {
+			return domain.CatalogEntry{}, err
+		}
+	}
+
+	uc.outputService.PrintSuccess(fmt.Sprintf("Restoring %s and replaying the oplog of %s up to %s",
+		entry.Base, entry.Path, at.Format("2006-01-02 15:04:05")))
+	return entry, nil
+}
+
+// restoreDatabase restores a single backup, or one table of it, into the target database. A
+// differential MongoDB backup only replays its oplog up to options.At, if set.
+func (uc *RestoreUsecase) restoreDatabase(
+	entry domain.CatalogEntry,
+	target domain.DatabaseConfig,
+	method domain.BackupMethod,
+	namespace string,
+	tempDir string,
+	options domain.RestoreOptions,
+) domain.RestoreResult {
+	startTime := time.Now()
+
+	result := domain.RestoreResult{
+		DatabaseType: target.Type,
+		Database:     target.Database,
+		BackupPath:   entry.Path,
+		Table:        options.Table,
+	}
+
+	uc.outputService.PrintRestoreStart(entry, target, method)
+	
+	warning, err := entry.Compatibility()
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(startTime)
+		return result
+	}
+	if warning != "" {
+		uc.outputService.PrintError(warning)
+	}
+
+	if target.TempDir != "" {
+		tempDir = target.TempDir
+	}
+
+	entry, retrieved, err := uc.retrieve(entry)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(startTime)
+		return result
+	}
+	defer removeAll(retrieved)
+
+	if err := uc.verifySignatures(entry, options); err != nil {
+		result.Error = err
+		result.Duration = time.Since(startTime)
+		return result
+	}
+	
+	entry, decrypted, err := uc.decrypt(entry)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(startTime)
+		return result
+	}
+	defer removeAll(decrypted)
+
+	target, err = uc.restoreRepo.ManagedLogin(target)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(startTime)
+		return result
+	}
+
+	switch {
+	case options.Table != "":
+		err = uc.restoreTable(entry, target, method, namespace, tempDir, options.Table)
+	case domain.IsSnapshotBackup(entry.Path):
+		result.Claim, err = uc.restoreRepo.RestoreVolumeSnapshot(target, method, entry.Path, namespace)
+	case domain.IsRDSSnapshot(entry.Path):
+		result.Instance, err = uc.restoreRepo.RestoreRDSSnapshot(target, entry.Path)
+	case domain.IsHostSnapshot(entry.Path):
+		result.PreparedDir, err = uc.restoreRepo.ExtractHostSnapshot(entry.Path)
+	case domain.IsPhysicalBackup(entry.Path):
+		result.PreparedDir, err = uc.restoreRepo.PrepareMariaDB(target, method, entry.Path, namespace, tempDir)
+	case entry.IsDifferential():
+		err = uc.restoreDifferential(entry, target, method, namespace, tempDir, options.At)
+	default:
+		var engine domain.DatabaseEngine
+		if engine, err = domain.LookupEngine(target.Type); err == nil {
+			err = engine.Restore(target, method, entry.Path, entry.Database, namespace, tempDir)
+		}
+	}
+
+	// Host snapshots and physical backups are unpacked next to the file they were read from,
+	// which for an encrypted backup is its decrypted copy and for one kept in stores the copy
+	// fetched from them
+	for _, dir := range append(decrypted, retrieved...) {
+		if err == nil && result.PreparedDir != "" && strings.HasPrefix(result.PreparedDir, dir) {
+			moved := filepath.Join(filepath.Dir(result.BackupPath), filepath.Base(result.PreparedDir))
+			if err = os.Rename(result.PreparedDir, moved); err == nil {
+				result.PreparedDir = moved
+			}
+			break
+		}
+	}
+	
+	result.Duration = time.Since(startTime)
+
+	if err != nil {
+		result.Error = err
+		var cmdErr *domain.CommandError
+		if errors.As(err, &cmdErr) {
+			result.Stderr = cmdErr.Stderr
+		}
+		return result
+	}
+
+	result.Success = true
+
+	// Snapshots and physical backups are not in the target yet, and a table is only part of it
+	if options.Table == "" && result.PreparedDir == "" && result.Claim == "" && result.Instance == "" {
+		result.Checks = uc.runChecks(target, method, namespace)
+	}
+	return result
+}
+
+// verifySignatures refuses a backup, or the full backup a differential one builds on, whose
+// signature does not match options.VerifyKey, unless options.SkipVerify is set. Without a key,
+// it refuses signed backups, as their signatures cannot be checked, and lets unsigned ones through.
+func (uc *RestoreUsecase) verifySignatures(entry domain.CatalogEntry, options domain.RestoreOptions) error {
+	paths := []string{entry.Path}
+	if entry.IsDifferential() {
+		paths = append(paths, entry.Base)
+	}
+
+	if options.VerifyKey == "" {
+		for _, path := range paths {
+			if _, err := os.Stat(domain.SignaturePath(path)); err != nil {
+				continue
+			}
+			if options.SkipVerify {
+				uc.outputService.PrintError(fmt.Sprintf("WARNING: %s is signed, but its signature was not verified: no key was given", path))
+				continue
+			}
+			return fmt.Errorf("refusing to restore %s: %w: %s is signed, but no key was given to verify it with", entry.Path, domain.ErrSignatureInvalid, path)
+		}
+		return nil
+	}
+	if options.SkipVerify {
+		uc.outputService.PrintError(fmt.Sprintf("Not verifying the signature of %s", entry.Path))
+		return nil
+	}
+
+	for _, path := range paths {
+		if err := uc.restoreRepo.VerifySignature(path, options.VerifyKey); err != nil {
+			return fmt.Errorf("refusing to restore %s: %w", entry.Path, err)
+		}
+	}
+	return nil
+}
+
+// retrieve returns entry pointing at a copy of its backup fetched from its stores, retrieved
+// from cold storage if need be, if it is only kept there, along with the directory holding
+// the copy. The copy is checked against its checksums, as pull does.
+func (uc *RestoreUsecase) retrieve(entry domain.CatalogEntry) (domain.CatalogEntry, []string, error) {
+	if entry.StoreKey == "" {
+		return entry, nil, nil
+	}
+
+	// Next to where the backup was, as it may not fit in the system's temporary directory; the
+	// leading dot keeps it out of backup listings
+	if err := os.MkdirAll(filepath.Dir(entry.Path), 0o755); err != nil {
+		return entry, nil, err
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(entry.Path), ".restore-")
+	if err != nil {
+		return entry, nil, err
+	}
+
+	fetched := filepath.Join(dir, filepath.Base(entry.Path))
+	pull := NewPullUsecase(uc.restoreRepo, uc.catalogRepo, uc.outputService)
+	storeName, err := pull.fetch(entry.Stores, entry.StoreKey, entry.Parts, fetched)
+	if err == nil {
+		uc.outputService.PrintSuccess(fmt.Sprintf("Fetched %s from store %s", entry.StoreKey, storeName))
+		err = uc.restoreRepo.VerifyChecksum(fetched)
+	}
+	switch {
+	case errors.Is(err, domain.ErrNoChecksum):
+		uc.outputService.PrintError(fmt.Sprintf("%s was stored without checksums, so the copy could not be checked", entry.StoreKey))
+	case err != nil:
+		os.RemoveAll(dir)
+		return entry, nil, fmt.Errorf("failed to fetch %s from its stores: %w", entry.Path, err)
+	}
+	entry.Path = fetched
+	return entry, []string{dir}, nil
+}
+
+// decrypt returns entry pointing at decrypted copies of its backup, and of the full backup a
+// differential one builds on, if they are encrypted, along with the directories holding the copies
+func (uc *RestoreUsecase) decrypt(entry domain.CatalogEntry) (domain.CatalogEntry, []string, error) {
+	var dirs []string
+	for _, path := range []*string{&entry.Path, &entry.Base} {
+		if *path == "" {
+			continue
+		}
+		plain, err := uc.restoreRepo.DecryptBackup(*path)
+		if err != nil {
+			removeAll(dirs)
+			return entry, nil, fmt.Errorf("failed to decrypt %s: %w", *path, err)
+		}
+		if plain != *path {
+			dirs = append(dirs, filepath.Dir(plain))
+			*path = plain
+		}
+	}
+	return entry, dirs, nil
+}
+
+// removeAll removes the directories of decrypted copies
+func removeAll(dirs []string) {
+	for _, dir := range dirs {
+		os.RemoveAll(dir)
+	}
+}
+
+// runChecks runs the checks of target against it
+func (uc *RestoreUsecase) runChecks(target domain.DatabaseConfig, method domain.BackupMethod, namespace string) []domain.CheckResult {
+	var results []domain.CheckResult
+	for _, check := range target.Checks {
+		output, err := uc.restoreRepo.Query(target, method, namespace, check.Query)
+		if err == nil {
+			err = check.Evaluate(output)
+		}
+		results = append(results, domain.CheckResult{Check: check, Result: output, Error: err})
+	}
+	return results
+}
+
+// restoreTable restores one table or collection of a logical dump, leaving the rest of the
+// target database as it is
+func (uc *RestoreUsecase) restoreTable(
+	entry domain.CatalogEntry,
+	target domain.DatabaseConfig,
+	method domain.BackupMethod,
+	namespace string,
+	tempDir string,
+	table string,
+) error {
+	switch {
+	case domain.IsSnapshotBackup(entry.Path), domain.IsRDSSnapshot(entry.Path), domain.IsHostSnapshot(entry.Path), domain.IsPhysicalBackup(entry.Path):
+		return fmt.Errorf("%s is a copy of the data directory; single tables can only be restored from dumps", entry.Path)
+	case entry.IsDifferential():
+		return fmt.Errorf("%s replays changes to the whole database; restore the collection from its full backup %s instead", entry.Path, entry.Base)
+	case target.Type == domain.DatabaseTypeMongoDB:
+		return uc.restoreRepo.RestoreMongoCollection(target, method, entry.Path, entry.Database, table, namespace, tempDir)
+	}
+	return uc.restoreRepo.RestoreTable(target, method, entry.Path, table, namespace)
+}
+
+// restoreDifferential restores the full backup a differential MongoDB backup builds on and
+// replays the oplog entries written since. The entries name their database, so they can only
+// be applied to a database of the same name.
+func (uc *RestoreUsecase) restoreDifferential(
+	entry domain.CatalogEntry,
+	target domain.DatabaseConfig,
+	method domain.BackupMethod,
+	namespace string,
+	tempDir string,
+	until time.Time,
+) error {
+	if entry.Database != "" && entry.Database != target.Database {
+		return fmt.Errorf("a differential backup of %s cannot be restored into %s; restore its full backup %s instead", entry.Database, target.Database, entry.Base)
+	}
+	if _, err := os.Stat(entry.Base); err != nil {
+		return fmt.Errorf("full backup %s of this differential backup is missing: %w", entry.Base, err)
+	}
+
+	engine, err := domain.LookupEngine(target.Type)
+	if err != nil {
+		return err
+	}
+	if err := engine.Restore(target, method, entry.Base, entry.Database, namespace, tempDir); err != nil {
+		return fmt.Errorf("failed to restore full backup %s: %w", entry.Base, err)
+	}
+	if err := uc.restoreRepo.ReplayMongoOplog(target, method, entry.Path, namespace, until); err != nil {
+		return fmt.Errorf("failed to replay the oplog: %w", err)
+	}
+	return nil
+}
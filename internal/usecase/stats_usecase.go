@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"slices"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// StatsUsecase shows how the backups of the configured databases developed, so growth and
+// slowdowns stand out before they fill a disk or miss a window
+type StatsUsecase struct {
+	catalogRepo domain.CatalogRepository
+}
+
+// NewStatsUsecase creates a new stats usecase
+func NewStatsUsecase(catalogRepo domain.CatalogRepository) *StatsUsecase {
+	return &StatsUsecase{catalogRepo: catalogRepo}
+}
+
+// Execute returns the last backups of every database of config, at most last of them, as the
+// catalog recorded them
+func (uc *StatsUsecase) Execute(config domain.BackupConfig, last int) ([]domain.BackupTrend, error) {
+	config.AssignLabels()
+
+	listed := make(map[string][]domain.CatalogEntry) // Records by backup directory
+	var trends []domain.BackupTrend
+	for _, db := range config.Databases {
+		db = withRunDefaults(config, db)
+		entries, ok := listed[db.BackupDir]
+		if !ok {
+			var err error
+			entries, err = uc.catalogRepo.ListRecords(db.BackupDir)
+			if err != nil {
+				return nil, err
+			}
+			listed[db.BackupDir] = entries
+		}
+
+		trend := domain.BackupTrend{Database: db}
+		for _, entry := range entries {
+			if backupOf(db, entry) {
+				trend.Backups = append(trend.Backups, entry)
+			}
+		}
+		slices.SortStableFunc(trend.Backups, func(a, b domain.CatalogEntry) int {
+			return a.CreatedAt.Compare(b.CreatedAt)
+		})
+		if len(trend.Backups) > last {
+			trend.Backups = trend.Backups[len(trend.Backups)-last:]
+		}
+		trends = append(trends, trend)
+	}
+	return trends, nil
+}
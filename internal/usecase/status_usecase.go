@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"os"
+	"slices"
+	"time"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// StatusUsecase tells how fresh the backups of the configured databases are, for monitoring
+type StatusUsecase struct {
+	catalogRepo domain.CatalogRepository
+}
+
+// NewStatusUsecase creates a new status usecase
+func NewStatusUsecase(catalogRepo domain.CatalogRepository) *StatusUsecase {
+	return &StatusUsecase{catalogRepo: catalogRepo}
+}
+
+// Execute returns the status of every database of config as of now: its newest backup on disk,
+// or in its store for databases streamed to one, with its age and size to check against the
+// database's expectations
+func (uc *StatusUsecase) Execute(config domain.BackupConfig, now time.Time) ([]domain.BackupStatus, error) {
+	config.AssignLabels()
+
+	listed := make(map[string][]domain.CatalogEntry) // Backups by backup directory, type and whether streamed
+	var statuses []domain.BackupStatus
+	for _, db := range config.Databases {
+		db = withRunDefaults(config, db)
+		key := db.BackupDir + "\x00" + db.Type.String()
+		if db.StreamTo != "" {
+			key += "\x00streamed"
+		}
+		entries, ok := listed[key]
+		if !ok {
+			var err error
+			if db.StreamTo != "" {
+				entries, err = uc.streamedEntries(db)
+			} else {
+				entries, err = uc.catalogRepo.ListEntries(db.BackupDir, db.Type)
+			}
+			if err != nil {
+				return nil, err
+			}
+			listed[key] = entries
+		}
+
+		status := domain.BackupStatus{Database: db, MaxAge: db.MaxAge, MinSize: db.MinSize}
+		// Entries are newest first, and tenants have backup directories of their own
+		for _, entry := range entries {
+			if backupOf(db, entry) {
+				status.Last = &entry
+				status.Age = now.Sub(entry.CreatedAt)
+				status.Size = sizeOf(entry)
+				break
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// streamedEntries returns the backups of db's type recorded in its catalog, newest first,
+// including those kept only in a store, as streamed backups are
+func (uc *StatusUsecase) streamedEntries(db domain.DatabaseConfig) ([]domain.CatalogEntry, error) {
+	records, err := uc.catalogRepo.ListRecords(db.BackupDir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []domain.CatalogEntry
+	for _, entry := range records {
+		if entry.DatabaseType == db.Type {
+			entries = append(entries, entry)
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b domain.CatalogEntry) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return entries, nil
+}
+
+// sizeOf returns the size of a backup as the catalog recorded it, or for dumps that predate
+// the catalog as it is on disk. It is -1 for directories, whose size was not recorded.
+func sizeOf(entry domain.CatalogEntry) int64 {
+	if entry.SizeBytes > 0 {
+		return entry.SizeBytes
+	}
+	info, err := os.Stat(entry.Path)
+	if err != nil || info.IsDir() {
+		return -1
+	}
+	return info.Size()
+}
@@ -0,0 +1,214 @@
+package usecase
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/wush/db-backup-tool/internal/domain"
+)
+
+// SyncUsecase reconciles the catalog with the manifests the hosts backing up to the same
+// stores put next to their copies, so a host replacing another knows its backups at once
+type SyncUsecase struct {
+	catalogRepo   domain.CatalogRepository
+	outputService domain.OutputService
+}
+
+// NewSyncUsecase creates a new catalog sync usecase
+func NewSyncUsecase(catalogRepo domain.CatalogRepository, outputService domain.OutputService) *SyncUsecase {
+	return &SyncUsecase{
+		catalogRepo:   catalogRepo,
+		outputService: outputService,
+	}
+}
+
+// syncRecord is a backup of the catalog and the backup directory whose catalog holds it
+type syncRecord struct {
+	backupDir string
+	entry     domain.CatalogEntry
+}
+
+// Execute reads the manifests in every store of config that can list its keys. Backups the
+// catalog lacks are added with the store as where they are kept, and backups it has learn of
+// the stores holding copies. Stores that no longer have a recorded backup's manifest are
+// dropped from its record, and records of backups kept neither on disk nor in any store are
+// removed.
+func (uc *SyncUsecase) Execute(config domain.BackupConfig, dryRun bool) error {
+	config.AssignLabels()
+	records := make(map[string]syncRecord)
+	for _, backupDir := range config.BackupDirs() {
+		entries, err := uc.catalogRepo.ListRecords(backupDir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.ID != "" {
+				records[entry.ID] = syncRecord{backupDir: backupDir, entry: entry}
+			}
+		}
+	}
+
+	staging, err := os.MkdirTemp("", "catalog-sync-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	listed := make(map[string]map[string]bool) // IDs with a manifest, by the store they are in
+	changed := make(map[string]bool)
+	addedIDs := make(map[string]bool)
+	var added, failed int
+	for _, name := range storesOf(config, nil) {
+		store, err := domain.LookupStore(name)
+		if err != nil {
+			uc.outputService.PrintError(err.Error())
+			failed++
+			continue
+		}
+		fetching, ok := store.(domain.FetchingStore)
+		if !ok {
+			uc.outputService.PrintError(fmt.Sprintf("Store %s cannot list its backups and was skipped", name))
+			continue
+		}
+		keys, err := fetching.List("")
+		if err != nil {
+			uc.outputService.PrintError(fmt.Sprintf("Failed to list store %s: %v", name, err))
+			failed++
+			continue
+		}
+
+		ids := make(map[string]bool)
+		listed[name] = ids
+		for i, key := range keys {
+			if !domain.IsManifestKey(key) {
+				continue
+			}
+			entry, err := uc.readManifest(fetching, key, filepath.Join(staging, fmt.Sprintf("%s-%d", name, i)))
+			if err != nil {
+				uc.outputService.PrintError(fmt.Sprintf("Skipped %s in store %s: %v", key, name, err))
+				failed++
+				continue
+			}
+			ids[entry.ID] = true
+
+			if record, ok := records[entry.ID]; ok {
+				if !slices.Contains(record.entry.Stores, name) {
+					record.entry.Stores = append(record.entry.Stores, name)
+					records[entry.ID] = record
+					changed[entry.ID] = true
+				}
+				continue
+			}
+			backupDir, path, ok := localPath(config, entry)
+			if !ok {
+				continue
+			}
+			entry.Path = path
+			entry.Stores = []string{name}
+			records[entry.ID] = syncRecord{backupDir: backupDir, entry: entry}
+			changed[entry.ID] = true
+			addedIDs[entry.ID] = true
+			added++
+			uc.report(dryRun, "Would add", "Added", fmt.Sprintf("%s %s from store %s", entry.ID, path, name))
+		}
+	}
+
+	for id, record := range records {
+		stores := slices.DeleteFunc(slices.Clone(record.entry.Stores), func(name string) bool {
+			return listed[name] != nil && !listed[name][id]
+		})
+		if len(stores) != len(record.entry.Stores) {
+			record.entry.Stores = stores
+			records[id] = record
+			changed[id] = true
+		}
+	}
+
+	var updated, dropped int
+	for _, id := range slices.Sorted(maps.Keys(changed)) {
+		record := records[id]
+		_, statErr := os.Stat(record.entry.Path)
+		gone := len(record.entry.Stores) == 0 && statErr != nil
+		switch {
+		case gone:
+			uc.report(dryRun, "Would drop", "Dropped", fmt.Sprintf("%s %s, which is in no store any more", id, record.entry.Path))
+			dropped++
+		case !addedIDs[id]:
+			updated++
+		}
+		if dryRun {
+			continue
+		}
+		if gone {
+			err = uc.catalogRepo.RemoveEntry(record.backupDir, record.entry)
+		} else {
+			err = uc.catalogRepo.UpdateEntry(record.backupDir, record.entry)
+		}
+		if err != nil {
+			uc.outputService.PrintError(fmt.Sprintf("Failed to record %s in the catalog: %v", id, err))
+			failed++
+		}
+	}
+
+	if dryRun {
+		uc.outputService.PrintSuccess(fmt.Sprintf("Would add %d backups, update %d and drop %d", added, updated, dropped))
+	} else {
+		uc.outputService.PrintSuccess(fmt.Sprintf("Added %d backups, updated %d and dropped %d", added, updated, dropped))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d stores or manifests could not be read or recorded", failed)
+	}
+	return nil
+}
+
+// readManifest fetches the manifest under key to path and reads it
+func (uc *SyncUsecase) readManifest(store domain.FetchingStore, key, path string) (domain.CatalogEntry, error) {
+	if err := store.Get(key, path); err != nil {
+		return domain.CatalogEntry{}, err
+	}
+	return uc.catalogRepo.ReadManifest(path)
+}
+
+// report prints what was done, or with dryRun what would be
+func (uc *SyncUsecase) report(dryRun bool, would, done, what string) {
+	if dryRun {
+		uc.outputService.PrintSuccess(would + " " + what)
+	} else {
+		uc.outputService.PrintSuccess(done + " " + what)
+	}
+}
+
+// localPath returns where the backup of a manifest, whose path is its key in the store, is
+// kept in config: under the backup directory of its database, or of its tenant or the run
+// if the database is not configured. ok is false for backups of another tenant than config's.
+func localPath(config domain.BackupConfig, entry domain.CatalogEntry) (backupDir, path string, ok bool) {
+	key := entry.Path
+	backupDir = config.BackupDir
+	if entry.Tenant != "" {
+		tenant, ok := config.Tenant(entry.Tenant)
+		if !ok {
+			return "", "", false
+		}
+		backupDir = tenant.BackupDir
+		key = strings.TrimPrefix(key, tenant.Name+"/")
+	} else if config.TenantOf(config.BackupDir) != "" {
+		// A config narrowed to one tenant keeps the backups of no other
+		return "", "", false
+	}
+	for _, db := range config.Databases {
+		if db.Tenant == entry.Tenant && backupOf(db, entry) {
+			backupDir = withRunDefaults(config, db).BackupDir
+			break
+		}
+	}
+
+	rel := filepath.FromSlash(key)
+	if !filepath.IsLocal(rel) {
+		return "", "", false
+	}
+	return backupDir, filepath.Join(backupDir, rel), true
+}